@@ -0,0 +1,10 @@
+//go:build gui
+
+package main
+
+import "github.com/okamyuji/go-image-processor/gui"
+
+// runGUI opens the graphical user interface
+func runGUI() {
+	gui.Run()
+}
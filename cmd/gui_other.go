@@ -0,0 +1,17 @@
+//go:build !gui
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/okamyuji/go-image-processor/i18n"
+)
+
+// runGUI reports that the GUI is missing. It needs cgo and the graphics
+// libraries of the platform, so it is only built with the gui build tag.
+func runGUI() {
+	fmt.Println(i18n.T("This binary was built without the GUI; build it with: go build -tags gui ./cmd"))
+	os.Exit(1)
+}
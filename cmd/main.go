@@ -1,20 +1,37 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"image"
+	"image/color"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/okamyuji/go-image-processor/config"
+	"github.com/okamyuji/go-image-processor/i18n"
 	processor "github.com/okamyuji/go-image-processor/pkg"
 )
 
 func init() {
+	i18n.SetLanguage(i18n.Detect(os.Getenv))
 	log.SetPrefix("go-image-processor: ")
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-	_ = config.GetConfig()
 	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
 		Level: slog.LevelInfo,
 	}))
@@ -22,42 +39,532 @@ func init() {
 }
 
 func printUsage() {
-	fmt.Println("Usage: go-image-processor <command> [arguments]")
-	fmt.Println("\nCommands:")
-	fmt.Println("  resize -width <width> -height <height> <input> <output>")
-	fmt.Println("  denoise <input> <output>")
+	fmt.Println(i18n.T("Usage:"), "go-image-processor [-tmp-dir <dir>] [-fsync] [-mmap] [-deterministic] [-lang en|ja] <command> [arguments]")
+	fmt.Println("\n" + i18n.T("Commands:"))
+	fmt.Println("  resize [-width <length> -height <length> | -scale <percent> | -geometry <geometry>] [-mode fit|fill|stretch|pad] [-gravity <gravity>] [-background <color>] [-dpi <dpi>] [-no-upscale | -only-enlarge] [-interpolation <filter>] [-tiled] <input> <output>")
+	fmt.Println("  denoise [-roi x,y,w,h] [-auto] [-radius <radius>] [-luma-strength <radius>] [-chroma-strength <radius>] <input> <output>")
 	fmt.Println("  rotate -angle <angle> <input> <output>")
-	fmt.Println("  autorotate <input> <output>")
-	fmt.Println("  binarize <input> <output>")
-	fmt.Println("  concatvert <output> <input1> <input2> [input3...]")
-	fmt.Println("  concathorz <output> <input1> <input2> [input3...]")
+	fmt.Println("  transform <input> <output> <operation>...")
+	fmt.Println("  autorotate [-method hough|projection] [-max-angle <degrees>] [-min-confidence <0-1>] <input> <output>")
+	fmt.Println("  binarize [-roi x,y,w,h | -tiled] [-threshold <0-255>] <input> <output>")
+	fmt.Println("  concatvert [-stream] [-caption] [-label <text>...] [-caption-gravity <gravity>] [-font <file>] [-font-size <pixels>] <output> <input1> <input2> [input3...]")
+	fmt.Println("  concathorz [-overlap] [-caption] [-label <text>...] [-caption-gravity <gravity>] [-font <file>] [-font-size <pixels>] <output> <input1> <input2> [input3...]")
 	fmt.Println("  generatetest -width <width> -height <height> <output>")
-	fmt.Println("\nUse 'go-image-processor <command> -h' for more information about a command.")
+	fmt.Println("  textregions <input>")
+	fmt.Println("  segment [-roi x,y,w,h] -levels <levels> <input> <output>")
+	fmt.Println("  skeleton [-roi x,y,w,h] <input> <output>")
+	fmt.Println("  trace <input> <output.svg>")
+	fmt.Println("  checksum [-tile <size>] [-verify <checksums.json>] [-max-distance <bits>] <input> [input...]")
+	fmt.Println("  group [-gap <duration>] [-max-distance <bits>] <directory>")
+	fmt.Println("  interleave [-back-in-order] [-rotate-back] [-dry-run] [-json] <fronts> <backs> <output-directory>")
+	fmt.Println("  blankdetect [-coverage <fraction>] [-margin <fraction>] [-json] <input> [input...]")
+	fmt.Println("  deblock [-roi x,y,w,h] [-strength <1-5>] <input> <output>")
+	fmt.Println("  faces <input>")
+	fmt.Println("  blurfaces [-roi x,y,w,h] [-json] <input> <output>")
+	fmt.Println("  facecrop [-margin <fraction>] [-size <pixels>] [-json] <input> <output>")
+	fmt.Println("  watermark [-position auto|<gravity>] [-scale <fraction>] [-opacity <0-1>] [-margin <pixels>] <input> <watermark> <output>")
+	fmt.Println("  colorblind [-roi x,y,w,h] -type protanopia|deuteranopia|tritanopia <input> <output>")
+	fmt.Println("  contrast <input>")
+	fmt.Println("  negative [-roi x,y,w,h] [-base <color>] [-border <fraction>] <input> <output>")
+	fmt.Println("  docclean [-roi x,y,w,h] [-preset document|whiteboard] <input> <output>")
+	fmt.Println("  halftone [-roi x,y,w,h] [-pitch <pixels>] [-angle <degrees>] <input> <output>")
+	fmt.Println("  comic [-roi x,y,w,h] [-levels <levels>] [-edge-threshold <strength>] <input> <output>")
+	fmt.Println("  preview [-width <columns>] [-ascii] <input>")
+	fmt.Println("  convert -colortype gray|gray16|rgb|rgba|palette [-bits 1|2|4|8|16] [-colors <n> | -palette <colors>] [-dither] [-interlace] <input> <output.png>")
+	fmt.Println("  batch [-roi x,y,w,h] [-timeout <duration>] [-workers <n>] [-report <report.json>] [-symlinks follow|skip] [-preserve-times] [-preserve-mode] [-preserve-owner] [-blank keep|skip|delete] [-blank-coverage <fraction>] [-webhook <url>] [-encrypt-key <source>] <operation> <input-location> <output-location>")
+	fmt.Println("  normalize [-colortype <type>] [-bits <bits>] [-dpi <dpi>] [-name <template>] [-no-deskew] [-no-trim] [-workers <n>] [-report <report.json>] <input-directory> <output-directory>")
+	fmt.Println("\n" + i18n.T("Global options:"))
+	fmt.Println("  -tmp-dir <dir>  " + i18n.T("Write outputs to <dir> before moving them into place (default: the output directory)"))
+	fmt.Println("  -fsync          " + i18n.T("Sync each output to disk before moving it into place"))
+	fmt.Println("  -mmap           " + i18n.T("Memory-map inputs instead of reading them into memory"))
+	fmt.Println("  -deterministic  " + i18n.T("Make outputs bit-identical from run to run"))
+	fmt.Println("  -lang <en|ja>   " + i18n.T("Language of the messages (default: from LC_ALL, LC_MESSAGES or LANG)"))
+	fmt.Println("  fixext [-reencode] [-dry-run] [-json] <file> [file...]")
+	fmt.Println("  classify [-json] <input>")
+	fmt.Println("  exifthumb [-json] <input> <output.jpg>")
+	fmt.Println("  fastpreview <input> <output>")
+	fmt.Println("  recipe [-json] <recipe-file> (<input> <output> | <input>... <output-dir>)")
+	fmt.Println("  wasm [-timeout <duration>] <module.wasm> <input> <output> [param...]")
+	fmt.Println("  thumbnail [-size <pixels>] [-square] <input> <output.png|->")
+	fmt.Println("  capture [-window <id>] [-delay <duration>] [-region x,y,w,h] [-redact x,y,w,h]... [-box x,y,w,h]... [-box-color <color>] [-fit WxH] [-recipe <file>] [-clipboard] [-json] [output.png]")
+	fmt.Println("  thumbnail-daemon [-flavors normal,large] [-interval <duration>] [-entry] <dir> [dir...]")
+	fmt.Println("  worker [-workers <n>] [-grace <duration>] [-health <addr>] [-reload] <queue-url>")
+	fmt.Println("  serve [-addr <addr>] [-max-upload <bytes>] [-max-memory <bytes>] [-grace <duration>] [-encrypt-key <source>]")
+	fmt.Println("  decrypt [-key <source>] <input.enc> <output>")
+	fmt.Println("  roiquality [-region x,y,w,h]... [-text] [-margin <pixels>] [-quality <1-100>] [-background-quality <1-100>] [-json] <input> <output.jpg>")
+	fmt.Println("  mrc [-dpi <dpi>] [-background-scale <factor>] [-foreground-scale <factor>] [-quality <1-100>] [-threshold <0-255>] [-json] <output.pdf> <input> [input...]")
+	fmt.Println("  crop (-rect x,y,w,h | -size WxH [-gravity <gravity>]) <input> <output>")
+	fmt.Println("  inpaint [-region x,y,w,h]... [-mask <image>] [-detect] [-radius <pixels>] [-json] <input> <output>")
+	fmt.Println("  estimatedpi [-font-size <points>] [-json] <input> <output>")
+	fmt.Println("  extend (-border <pixels> | -top/-right/-bottom/-left <pixels> | -aspect W:H [-gravity <gravity>]) [-background <color>] <input> <output>")
+	fmt.Println("  docdewarp [-corners x1,y1,x2,y2,x3,y3,x4,y4] [-json] <input> <output>")
+	fmt.Println("  bookdewarp [-strips 24] [-json] <input> <output>")
+	fmt.Println("  gui")
+	if operations := processor.RegisteredOperations(); len(operations) > 0 {
+		fmt.Println("\n" + i18n.T("Registered operations:"))
+		for _, name := range operations {
+			fmt.Printf("  %s [arguments] <input> <output>\n", name)
+		}
+	}
+	if plugins := processor.ListPlugins(); len(plugins) > 0 {
+		fmt.Println("\n" + i18n.T("Plugins:"))
+		for _, name := range plugins {
+			fmt.Printf("  %s [arguments] <input> <output>\n", name)
+		}
+	}
+	fmt.Println("\n" + i18n.T("Use 'go-image-processor <command> -h' for more information about a command."))
 }
 
 func handleError(err error) {
-	switch e := err.(type) {
-	case *processor.ErrInvalidInput:
-		slog.Error("invalid input file",
-			"path", e.Path)
-	case *processor.ErrInvalidOutput:
-		slog.Error("invalid output file",
-			"path", e.Path)
-	case *processor.ErrProcessing:
-		slog.Error("processing error",
-			"operation", e.Op,
-			"error", e.Err)
-	case *processor.ErrUnsupportedFormat:
-		slog.Error("unsupported format",
-			"format", e.Format)
+	var inputErr *processor.ErrInvalidInput
+	var outputErr *processor.ErrInvalidOutput
+	var procErr *processor.ErrProcessing
+	var formatErr *processor.ErrUnsupportedFormat
+	switch {
+	case errors.As(err, &inputErr):
+		slog.Error(i18n.T("invalid input file"),
+			"path", inputErr.Path,
+			"error", inputErr.Err)
+	case errors.As(err, &outputErr):
+		slog.Error(i18n.T("invalid output file"),
+			"path", outputErr.Path,
+			"error", outputErr.Err)
+	case errors.As(err, &procErr):
+		slog.Error(i18n.T("processing error"),
+			"operation", procErr.Op,
+			"error", procErr.Err)
+	case errors.As(err, &formatErr):
+		slog.Error(i18n.T("unsupported format"),
+			"format", formatErr.Format)
 	default:
-		slog.Error("unexpected error",
+		slog.Error(i18n.T("unexpected error"),
 			"error", err)
 	}
 	os.Exit(1)
 }
 
+// listImages returns the image files directly inside dir, sorted by name
+func listImages(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, &processor.ErrInvalidInput{Path: dir, Err: err}
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isImageName(entry.Name()) {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// sortNatural orders paths by file name, comparing runs of digits by value so
+// that scan_9.jpg comes before scan_10.jpg
+func sortNatural(paths []string) {
+	slices.SortStableFunc(paths, func(a, b string) int {
+		return naturalCompare(filepath.Base(a), filepath.Base(b))
+	})
+}
+
+// naturalCompare compares a and b like strings.Compare, except that runs of
+// digits are compared by their value
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		da, db := digitRun(a), digitRun(b)
+		if da > 0 && db > 0 {
+			na, nb := strings.TrimLeft(a[:da], "0"), strings.TrimLeft(b[:db], "0")
+			if c := cmp.Or(cmp.Compare(len(na), len(nb)), strings.Compare(na, nb)); c != 0 {
+				return c
+			}
+			a, b = a[da:], b[db:]
+			continue
+		}
+		if a[0] != b[0] {
+			return cmp.Compare(a[0], b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// digitRun is the number of digits s starts with
+func digitRun(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// isImageName reports whether a file name has an image extension
+func isImageName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// listStoredImages returns the images in a directory of a storage
+func listStoredImages(s processor.Storage, dir string) ([]string, error) {
+	names, err := s.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var images []string
+	for _, name := range names {
+		if isImageName(name) {
+			images = append(images, name)
+		}
+	}
+	return images, nil
+}
+
+// batchOperations are the operations the batch command can apply; each reads
+// one input file and writes one output file
+var batchOperations = map[string]processor.Operation{
+	"denoise":    processor.DenoiseImage,
+	"binarize":   processor.BinarizeImage,
+	"autorotate": processor.AutoRotateImage,
+	"edges":      processor.DetectEdges,
+	"skeleton":   processor.SkeletonizeImage,
+	"deblock": func(inputPath, outputPath string) error {
+		return processor.DeblockImage(inputPath, outputPath, 2)
+	},
+	"docclean": func(inputPath, outputPath string) error {
+		return processor.DocCleanImage(inputPath, outputPath, processor.DocCleanDocument)
+	},
+	"blurfaces": func(inputPath, outputPath string) error {
+		_, err := processor.BlurFacesImage(inputPath, outputPath)
+		return err
+	},
+	"normalize": func(inputPath, outputPath string) error {
+		_, err := processor.NormalizeImage(inputPath, outputPath, processor.NormalizeOptions{})
+		return err
+	},
+	"resize": func(inputPath, outputPath string) error {
+		c := processor.Default().Config()
+		_, err := processor.ResizeImageWithOptions(inputPath, outputPath, processor.ResizeOptions{
+			Width:     uint(c.DefaultWidth),
+			Height:    uint(c.DefaultHeight),
+			NoUpscale: true,
+		})
+		return err
+	},
+}
+
+// batchOperation returns the batch operation of a name: a built-in one, or
+// an operation registered with processor.Register, run without arguments
+func batchOperation(name string) (processor.Operation, bool) {
+	if operation, ok := batchOperations[name]; ok {
+		return operation, true
+	}
+	if _, ok := processor.LookupOperation(name); !ok {
+		return nil, false
+	}
+	return func(inputPath, outputPath string) error {
+		return processor.RunOperation(name, nil, inputPath, outputPath)
+	}, true
+}
+
+// regionOperations are the batch operations that can be restricted to a
+// region with -roi, working on the decoded region
+var regionOperations = map[string]processor.RegionOperation{
+	"denoise": func(img image.Image) (image.Image, error) {
+		return processor.Denoise(img), nil
+	},
+	"binarize": func(img image.Image) (image.Image, error) {
+		return processor.Binarize(img), nil
+	},
+	"edges": func(img image.Image) (image.Image, error) {
+		return processor.Edges(img), nil
+	},
+	"skeleton": func(img image.Image) (image.Image, error) {
+		return processor.Skeletonize(img), nil
+	},
+	"deblock": func(img image.Image) (image.Image, error) {
+		return processor.Deblock(img, 2), nil
+	},
+	"docclean": func(img image.Image) (image.Image, error) {
+		return processor.DocClean(img, processor.DocCleanDocument)
+	},
+	"blurfaces": func(img image.Image) (image.Image, error) {
+		blurred, _, err := processor.BlurFaces(img)
+		return blurred, err
+	},
+}
+
+// regionOperation returns the region form of a batch operation: a built-in
+// one, or an operation registered with processor.Register, run without
+// arguments
+func regionOperation(name string) (processor.RegionOperation, bool) {
+	if operation, ok := regionOperations[name]; ok {
+		return operation, true
+	}
+	fn, ok := processor.LookupOperation(name)
+	if !ok {
+		return nil, false
+	}
+	return func(img image.Image) (image.Image, error) {
+		return fn(img, nil)
+	}, true
+}
+
+// roiFlag adds the -roi option, which restricts an operation to a rectangle
+func roiFlag(fs *flag.FlagSet) *string {
+	return fs.String("roi", "", i18n.T("Only process the rectangle x,y,width,height or WxH+X+Y and keep the rest of the image as is"))
+}
+
+// tiledFlag adds the -tiled flag to fs
+func tiledFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("tiled", false, i18n.T("Process the image a few rows at a time so images larger than memory fit; the output is PNG for .png and JPEG otherwise"))
+}
+
+// tiledOptions returns the options of -tiled when it is set, which cannot be
+// combined with -roi because the region is cut out of the decoded image
+func tiledOptions(tiled bool, roi, label string) ([]processor.Option, error) {
+	if !tiled {
+		return nil, nil
+	}
+	if roi != "" {
+		return nil, errors.New(i18n.T("-tiled cannot be combined with -roi"))
+	}
+	return []processor.Option{processor.WithTiled(), processor.WithProgress(progressBar(label))}, nil
+}
+
+// withROI runs operation on the whole input, or region only inside roi when
+// it is set
+func withROI(roi, inputPath, outputPath string, operation processor.Operation, region processor.RegionOperation) error {
+	if roi == "" {
+		return operation(inputPath, outputPath)
+	}
+	box, err := processor.ParseBox(roi)
+	if err != nil {
+		return &processor.ErrProcessing{Op: "roi", Err: err}
+	}
+	return processor.ApplyInRegion(inputPath, outputPath, box, region)
+}
+
+// captionFlags are the options labeling the images of a concatenation
+type captionFlags struct {
+	caption    *bool
+	labels     labelList
+	gravity    *string
+	font       *string
+	size       *float64
+	color      *string
+	background *string
+}
+
+// addCaptionFlags adds the caption options to fs
+func addCaptionFlags(fs *flag.FlagSet) *captionFlags {
+	c := &captionFlags{
+		caption:    fs.Bool("caption", false, i18n.T("Label each image with its file name")),
+		gravity:    fs.String("caption-gravity", "south", i18n.T("Position of the labels: north puts them above the images, south below, and east or west aligns them")),
+		font:       fs.String("font", "", i18n.T("TrueType or OpenType font of the labels")),
+		size:       fs.Float64("font-size", 0, i18n.T("Font size of the labels in pixels (0 scales it with the image)")),
+		color:      fs.String("caption-color", "black", i18n.T("Color of the labels")),
+		background: fs.String("caption-background", "white", i18n.T("Background color of the labels")),
+	}
+	fs.Var(&c.labels, "label", i18n.T("Label of an image instead of its file name, repeated in the order of the inputs"))
+	return c
+}
+
+// options returns the option labeling the images, or none when neither
+// -caption nor -label is given
+func (c *captionFlags) options() ([]processor.Option, error) {
+	if !*c.caption && len(c.labels) == 0 {
+		return nil, nil
+	}
+	opts := processor.CaptionOptions{
+		Labels:   c.labels,
+		FontPath: *c.font,
+		Size:     *c.size,
+	}
+	var err error
+	if opts.Gravity, err = processor.ParseGravity(*c.gravity); err != nil {
+		return nil, &processor.ErrProcessing{Op: "caption", Err: err}
+	}
+	if opts.Color, err = processor.ParseColor(*c.color); err != nil {
+		return nil, &processor.ErrProcessing{Op: "caption", Err: err}
+	}
+	if opts.Background, err = processor.ParseColor(*c.background); err != nil {
+		return nil, &processor.ErrProcessing{Op: "caption", Err: err}
+	}
+	return []processor.Option{processor.WithCaptions(opts)}, nil
+}
+
+// labelList is a repeatable option collecting labels
+type labelList []string
+
+func (l *labelList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *labelList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// boxList is a repeatable option collecting rectangles
+type boxList []processor.Box
+
+func (b *boxList) String() string {
+	return fmt.Sprint(*b)
+}
+
+func (b *boxList) Set(s string) error {
+	box, err := processor.ParseBox(s)
+	if err != nil {
+		return err
+	}
+	*b = append(*b, box)
+	return nil
+}
+
+// parseRoutes parses class=operation pairs separated by commas, such as
+// "document=binarize,photo=resize", into routes of batch operations
+func parseRoutes(spec string) (processor.ClassRoutes, error) {
+	routes := processor.ClassRoutes{}
+	for _, pair := range strings.Split(spec, ",") {
+		class, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid route %q (want class=operation)", pair)
+		}
+		switch class {
+		case processor.ClassDocument, processor.ClassPhoto, processor.ClassMixed:
+		default:
+			return nil, fmt.Errorf("unknown class %q (want document, photo or mixed)", class)
+		}
+		operation, ok := batchOperation(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown batch operation %q", name)
+		}
+		routes[class] = operation
+	}
+	return routes, nil
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		handleError(err)
+	}
+}
+
+// writeJSONFile writes v to path as indented JSON
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return &processor.ErrInvalidOutput{Path: path, Err: err}
+	}
+	return nil
+}
+
+// parseGlobalOptions applies the options given before the command and
+// removes them from os.Args
+// runPlugin runs a plugin command. When the last two arguments are an input
+// and an output, the image is passed through the plugin handshake; otherwise
+// the plugin runs on the terminal, for example to print its help.
+func runPlugin(pluginPath string, args []string) {
+	if len(args) < 2 || strings.HasPrefix(args[len(args)-1], "-") {
+		cmd := exec.Command(pluginPath, args...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				os.Exit(exitErr.ExitCode())
+			}
+			handleError(err)
+		}
+		return
+	}
+	n := len(args)
+	if err := processor.RunPlugin(pluginPath, args[:n-2], args[n-2], args[n-1]); err != nil {
+		handleError(err)
+	}
+	fmt.Println(i18n.T("Image processed successfully"))
+}
+
+// runOperation runs the operation registered under name with the command
+// line "[arguments] <input> <output>"
+func runOperation(name string, args []string) {
+	if len(args) < 2 {
+		fmt.Println(i18n.T("Usage:"), "go-image-processor", name, "[arguments] <input> <output>")
+		os.Exit(1)
+	}
+	n := len(args)
+	if err := processor.RunOperation(name, args[:n-2], args[n-2], args[n-1]); err != nil {
+		handleError(err)
+	}
+	fmt.Println(i18n.T("Image processed successfully"))
+}
+
+// applyGlobalOptions applies the global options to a configuration; it is
+// set by parseGlobalOptions
+var applyGlobalOptions func(*config.Config)
+
+func parseGlobalOptions() {
+	globalCmd := flag.NewFlagSet("go-image-processor", flag.ContinueOnError)
+	tmpDir := globalCmd.String("tmp-dir", "", i18n.T("Directory for temporary output files (default: next to each output)"))
+	fsync := globalCmd.Bool("fsync", false, i18n.T("Sync each output to disk before renaming it into place"))
+	mmap := globalCmd.Bool("mmap", false, i18n.T("Memory-map input files instead of reading them into memory"))
+	deterministic := globalCmd.Bool("deterministic", false, i18n.T("Use fixed seeds and process rows in order, for bit-identical outputs"))
+	lang := globalCmd.String("lang", string(i18n.Language()), i18n.T("Language of the messages: en or ja"))
+	if err := globalCmd.Parse(os.Args[1:]); err != nil {
+		printUsage()
+		os.Exit(1)
+	}
+	language, err := i18n.Parse(*lang)
+	if err != nil {
+		handleError(err)
+	}
+	i18n.SetLanguage(language)
+	os.Args = append(os.Args[:1], globalCmd.Args()...)
+
+	applyGlobalOptions = func(c *config.Config) {
+		if *tmpDir != "" {
+			c.TempDir = *tmpDir
+		}
+		if *fsync {
+			c.Fsync = true
+		}
+		if *mmap {
+			c.Mmap = true
+		}
+		if *deterministic {
+			c.Deterministic = true
+		}
+	}
+	if *tmpDir == "" && !*fsync && !*mmap && !*deterministic {
+		return
+	}
+	c := *config.GetConfig()
+	applyGlobalOptions(&c)
+	processor.SetConfig(&c)
+}
+
+// loadServiceConfig loads and validates config.yaml for the commands that
+// enforce its tenants, ending the program if it is invalid: falling back to
+// the defaults would drop the tenants and accept every request. Without a
+// config.yaml no tenants are configured and the defaults apply.
+func loadServiceConfig() {
+	if _, err := os.Stat("config.yaml"); errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err := processor.ReloadConfig("config.yaml", applyGlobalOptions); err != nil {
+		handleError(err)
+	}
+}
+
 func main() {
+	parseGlobalOptions()
 	if len(os.Args) < 2 {
 		printUsage()
 		os.Exit(1)
@@ -66,157 +573,341 @@ func main() {
 	switch os.Args[1] {
 	case "resize":
 		resizeCmd := flag.NewFlagSet("resize", flag.ExitOnError)
-		width := resizeCmd.Int("width", 0, "Width to resize the image to")
-		height := resizeCmd.Int("height", 0, "Height to resize the image to")
+		width := resizeCmd.String("width", "", i18n.T("Width to resize the image to, in pixels or with a unit (mm, cm, in)"))
+		height := resizeCmd.String("height", "", i18n.T("Height to resize the image to, in pixels or with a unit (mm, cm, in)"))
+		dpi := resizeCmd.Float64("dpi", 0, i18n.T("Print resolution for physical sizes, recorded in the output (default: from the source)"))
+		scaleFlag := resizeCmd.String("scale", "", i18n.T("Scale relative to the source size, e.g. 50% or 0.5"))
+		geometry := resizeCmd.String("geometry", "", i18n.T("Target size as a geometry: 800x600, 800x, x600 or 50%"))
+		noUpscale := resizeCmd.Bool("no-upscale", false, i18n.T("Keep images smaller than the target at their original size"))
+		onlyEnlarge := resizeCmd.Bool("only-enlarge", false, i18n.T("Keep images larger than the target at their original size"))
+		interpolationFlag := resizeCmd.String("interpolation", "lanczos3", i18n.T("Resampling filter: nearest, bilinear, bicubic, mitchell, lanczos2 or lanczos3"))
+		modeFlag := resizeCmd.String("mode", "fit", i18n.T("How to bring the image to width x height: fit inside, fill and crop, stretch, or pad"))
+		gravityFlag := resizeCmd.String("gravity", "center", i18n.T("Where the image goes when filling or padding, e.g. north or 25%,75%"))
+		backgroundFlag := resizeCmd.String("background", "white", i18n.T("Color of the padding"))
+		tiled := tiledFlag(resizeCmd)
 		if err := resizeCmd.Parse(os.Args[2:]); err != nil {
-			fmt.Println("Usage: go-image-processor resize <input> <output> -width <width> -height <height>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor resize <input> <output> (-width <length> -height <length> | -scale <percent> | -geometry <geometry>) [-mode fit|fill|stretch|pad] [-gravity <gravity>] [-background <color>] [-dpi <dpi>] [-no-upscale | -only-enlarge] [-interpolation <filter>] [-tiled]")
 			os.Exit(1)
 		}
-		if resizeCmd.NArg() < 2 || *width == 0 || *height == 0 {
-			fmt.Println("Usage: go-image-processor resize <input> <output> -width <width> -height <height>")
+		if resizeCmd.NArg() < 2 || (*scaleFlag == "" && *width == "" && *height == "" && *geometry == "") {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor resize <input> <output> (-width <length> -height <length> | -scale <percent> | -geometry <geometry>) [-mode fit|fill|stretch|pad] [-gravity <gravity>] [-background <color>] [-dpi <dpi>] [-no-upscale | -only-enlarge] [-interpolation <filter>] [-tiled]")
 			os.Exit(1)
 		}
-		if err := resizeCmd.Parse(os.Args[2:]); err != nil {
-			fmt.Println("Usage: go-image-processor resize <input> <output> -width <width> -height <height>")
-			os.Exit(1)
+		var scale float64
+		if *scaleFlag != "" {
+			var err error
+			scale, err = processor.ParseScale(*scaleFlag)
+			if err != nil {
+				handleError(err)
+			}
 		}
-		if resizeCmd.NArg() < 2 || *width == 0 || *height == 0 {
-			fmt.Println("Usage: go-image-processor resize <input> <output> -width <width> -height <height>")
-			os.Exit(1)
+		var printWidth, printHeight processor.Length
+		for _, dim := range []struct {
+			value  string
+			length *processor.Length
+		}{{*width, &printWidth}, {*height, &printHeight}} {
+			if dim.value == "" {
+				continue
+			}
+			var err error
+			*dim.length, err = processor.ParseLength(dim.value)
+			if err != nil {
+				handleError(err)
+			}
+		}
+
+		interpolation, err := processor.ParseInterpolation(*interpolationFlag)
+		if err != nil {
+			handleError(err)
+		}
+		mode, err := processor.ParseResizeMode(*modeFlag)
+		if err != nil {
+			handleError(&processor.ErrProcessing{Op: "resize", Err: err})
+		}
+		gravity, err := processor.ParseGravity(*gravityFlag)
+		if err != nil {
+			handleError(&processor.ErrProcessing{Op: "resize", Err: err})
+		}
+		background, err := processor.ParseColor(*backgroundFlag)
+		if err != nil {
+			handleError(&processor.ErrProcessing{Op: "resize", Err: err})
+		}
+
+		if *geometry != "" {
+			g, err := processor.ParseGeometry(*geometry)
+			if err != nil {
+				handleError(err)
+			}
+			if g.HasOffset || g.IsAspect() {
+				handleError(fmt.Errorf("resize takes a size or a scale, not %s", g))
+			}
+			printWidth, printHeight, scale = g.Width, g.Height, g.Scale
 		}
 
-		err := processor.ResizeImage(resizeCmd.Arg(0), resizeCmd.Arg(1), uint(*width), uint(*height))
+		result, err := processor.ResizeImageWithOptions(resizeCmd.Arg(0), resizeCmd.Arg(1), processor.ResizeOptions{
+			PrintWidth:    printWidth,
+			PrintHeight:   printHeight,
+			DPI:           *dpi,
+			Scale:         scale,
+			Mode:          mode,
+			Gravity:       &gravity,
+			Background:    background,
+			NoUpscale:     *noUpscale,
+			OnlyEnlarge:   *onlyEnlarge,
+			Interpolation: interpolation,
+			Tiled:         *tiled,
+		})
 		if err != nil {
 			handleError(err)
 		}
-		fmt.Println("Image resized successfully")
+		if result.Skipped {
+			fmt.Println(i18n.Sprintf("Image kept at its original size (%dx%d)", result.Width, result.Height))
+		} else {
+			fmt.Println(i18n.Sprintf("Image resized successfully (%dx%d)", result.Width, result.Height))
+		}
 
 	case "denoise":
 		denoiseCmd := flag.NewFlagSet("denoise", flag.ExitOnError)
+		roi := roiFlag(denoiseCmd)
+		radius := denoiseCmd.Int("radius", 1, i18n.T("Median filter radius"))
+		auto := denoiseCmd.Bool("auto", false, i18n.T("Estimate the noise level and choose the filter radius automatically"))
+		lumaStrength := denoiseCmd.Int("luma-strength", 1, i18n.T("Median filter radius for luma (filters in YCbCr)"))
+		chromaStrength := denoiseCmd.Int("chroma-strength", 2, i18n.T("Median filter radius for chroma (filters in YCbCr)"))
 		if err := denoiseCmd.Parse(os.Args[2:]); err != nil {
-			fmt.Println("Usage: go-image-processor denoise <input> <output>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor denoise [-roi x,y,w,h] [-auto] [-radius <radius>] [-luma-strength <radius>] [-chroma-strength <radius>] <input> <output>")
 			os.Exit(1)
 		}
 		if denoiseCmd.NArg() < 2 {
-			fmt.Println("Usage: go-image-processor denoise <input> <output>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor denoise [-roi x,y,w,h] [-auto] [-radius <radius>] [-luma-strength <radius>] [-chroma-strength <radius>] <input> <output>")
 			os.Exit(1)
 		}
-		err := processor.DenoiseImage(denoiseCmd.Arg(0), denoiseCmd.Arg(1))
+		separate := false
+		denoiseCmd.Visit(func(f *flag.Flag) {
+			if f.Name == "luma-strength" || f.Name == "chroma-strength" {
+				separate = true
+			}
+		})
+		opts := processor.DenoiseOptions{
+			Radius:       *radius,
+			Auto:         *auto,
+			Separate:     separate,
+			LumaRadius:   *lumaStrength,
+			ChromaRadius: *chromaStrength,
+			Progress:     progressBar(i18n.T("Denoising")),
+		}
+		var result *processor.DenoiseResult
+		err := withROI(*roi, denoiseCmd.Arg(0), denoiseCmd.Arg(1), func(inputPath, outputPath string) error {
+			var err error
+			result, err = processor.DenoiseImageWithOptions(inputPath, outputPath, opts)
+			return err
+		}, func(img image.Image) (image.Image, error) {
+			var err error
+			img, result, err = processor.DenoiseWithOptions(img, opts)
+			return img, err
+		})
 		if err != nil {
 			handleError(err)
 		}
-		fmt.Println("Image denoised successfully")
+		switch {
+		case separate && *auto:
+			fmt.Println(i18n.Sprintf("Image denoised successfully (noise sigma: %.1f, luma radius: %d, chroma radius: %d)",
+				result.NoiseSigma, result.LumaRadius, result.ChromaRadius))
+		case separate:
+			fmt.Println(i18n.Sprintf("Image denoised successfully (luma radius: %d, chroma radius: %d)", result.LumaRadius, result.ChromaRadius))
+		case *auto:
+			fmt.Println(i18n.Sprintf("Image denoised successfully (noise sigma: %.1f, radius: %d)", result.NoiseSigma, result.Radius))
+		default:
+			fmt.Println(i18n.Sprintf("Image denoised successfully (radius: %d)", result.Radius))
+		}
 
 	case "rotate":
 		rotateCmd := flag.NewFlagSet("rotate", flag.ExitOnError)
-		angle := rotateCmd.Float64("angle", 0, "Angle to rotate the image by")
+		angle := rotateCmd.Float64("angle", 0, i18n.T("Angle to rotate the image by"))
 		if err := rotateCmd.Parse(os.Args[2:]); err != nil {
-			fmt.Println("Usage: go-image-processor rotate <input> <output> -angle <angle>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor rotate <input> <output> -angle <angle>")
 			os.Exit(1)
 		}
 		if rotateCmd.NArg() < 2 || *angle == 0 {
-			fmt.Println("Usage: go-image-processor rotate <input> <output> -angle <angle>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor rotate <input> <output> -angle <angle>")
 			os.Exit(1)
 		}
 		if rotateCmd.NArg() < 2 || *angle == 0 {
-			fmt.Println("Usage: go-image-processor rotate <input> <output> -angle <angle>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor rotate <input> <output> -angle <angle>")
 			os.Exit(1)
 		}
 
-		err := processor.RotateImage(rotateCmd.Arg(0), rotateCmd.Arg(1), *angle)
+		err := processor.RotateImageWith(rotateCmd.Arg(0), rotateCmd.Arg(1), *angle, processor.WithProgress(progressBar(i18n.T("Rotating"))))
 		if err != nil {
 			handleError(err)
 		}
-		fmt.Println("Image rotated successfully")
+		fmt.Println(i18n.T("Image rotated successfully"))
+
+	case "transform":
+		transformCmd := flag.NewFlagSet("transform", flag.ExitOnError)
+		if err := transformCmd.Parse(os.Args[2:]); err != nil || transformCmd.NArg() < 3 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor transform <input> <output> <operation>...")
+			fmt.Println(i18n.T("Operations: resize:<geometry>, rotate:<degrees>, crop:<width>x<height>+<x>+<y>, flipx, flipy"))
+			os.Exit(1)
+		}
+		var ops []processor.Op
+		for _, arg := range transformCmd.Args()[2:] {
+			op, err := processor.ParseOp(arg)
+			if err != nil {
+				handleError(err)
+			}
+			ops = append(ops, op)
+		}
+		if err := processor.Transform(transformCmd.Arg(0), transformCmd.Arg(1), ops...); err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Image transformed successfully"))
+
 	case "autorotate":
 		autoRotateCmd := flag.NewFlagSet("autorotate", flag.ExitOnError)
+		maxAngle := autoRotateCmd.Float64("max-angle", 0, i18n.T("Skip rotation when the detected skew exceeds this many degrees (0 means no limit)"))
+		minConfidence := autoRotateCmd.Float64("min-confidence", 0, i18n.T("Skip rotation when the detection confidence is below this value (0 to 1)"))
+		method := autoRotateCmd.String("method", processor.SkewMethodHough, i18n.T("Skew detection method: hough or projection"))
+		content := autoRotateCmd.Bool("content", false, i18n.T("Turn photos without an EXIF orientation upright from where the sky is"))
 		if err := autoRotateCmd.Parse(os.Args[2:]); err != nil {
-			fmt.Println("Usage: go-image-processor autorotate <input> <output>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor autorotate [-method hough|projection] [-max-angle <degrees>] [-min-confidence <0-1>] [-content] <input> <output>")
 			os.Exit(1)
 		}
 		if autoRotateCmd.NArg() < 2 {
-			fmt.Println("Usage: go-image-processor autorotate <input> <output>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor autorotate [-method hough|projection] [-max-angle <degrees>] [-min-confidence <0-1>] [-content] <input> <output>")
 			os.Exit(1)
 		}
 
-		err := processor.AutoRotateImage(autoRotateCmd.Arg(0), autoRotateCmd.Arg(1))
+		result, err := processor.AutoRotateImageWithOptions(autoRotateCmd.Arg(0), autoRotateCmd.Arg(1), processor.AutoRotateOptions{
+			Method:        *method,
+			MaxAngle:      *maxAngle,
+			MinConfidence: *minConfidence,
+			Content:       *content,
+			Progress:      progressBar(i18n.T("Auto-rotating")),
+		})
 		if err != nil {
 			handleError(err)
 		}
-		fmt.Println("Image auto-rotated successfully")
+		if result.Rotated {
+			fmt.Println(i18n.Sprintf("Image auto-rotated successfully (angle: %.1f, confidence: %.2f)", result.Angle, result.Confidence))
+		} else {
+			fmt.Println(i18n.Sprintf("Rotation skipped (angle: %.1f, confidence: %.2f)", result.Angle, result.Confidence))
+		}
+
 	case "binarize":
 		binarizeCmd := flag.NewFlagSet("binarize", flag.ExitOnError)
+		roi := roiFlag(binarizeCmd)
+		threshold := binarizeCmd.Int("threshold", -1, i18n.T("Gray level above which pixels turn white, 0-255 (default: Otsu's method)"))
+		tiled := tiledFlag(binarizeCmd)
 		if err := binarizeCmd.Parse(os.Args[2:]); err != nil {
-			fmt.Println("Usage: go-image-processor binarize <input> <output>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor binarize [-roi x,y,w,h | -tiled] [-threshold <0-255>] <input> <output>")
 			os.Exit(1)
 		}
 
 		if binarizeCmd.NArg() < 2 {
-			fmt.Println("Usage: go-image-processor binarize <input> <output>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor binarize [-roi x,y,w,h | -tiled] [-threshold <0-255>] <input> <output>")
 			os.Exit(1)
 		}
 
-		err := processor.BinarizeImage(binarizeCmd.Arg(0), binarizeCmd.Arg(1))
+		opts, err := tiledOptions(*tiled, *roi, i18n.T("Binarizing"))
 		if err != nil {
 			handleError(err)
 		}
-		fmt.Println("Image binarized successfully")
+		if *threshold >= 0 {
+			if *threshold > 255 {
+				handleError(fmt.Errorf("threshold must be between 0 and 255, got %d", *threshold))
+			}
+			opts = append(opts, processor.WithThreshold(uint8(*threshold)))
+		}
+		err = withROI(*roi, binarizeCmd.Arg(0), binarizeCmd.Arg(1), func(inputPath, outputPath string) error {
+			return processor.BinarizeImageWith(inputPath, outputPath, opts...)
+		}, func(img image.Image) (image.Image, error) {
+			return processor.BinarizeWith(img, opts...)
+		})
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Image binarized successfully"))
 
 	case "concatvert":
 		concatVertCmd := flag.NewFlagSet("concatvert", flag.ExitOnError)
+		stream := concatVertCmd.Bool("stream", false, i18n.T("Write a PNG row by row instead of drawing the whole image in memory"))
+		captions := addCaptionFlags(concatVertCmd)
 		if err := concatVertCmd.Parse(os.Args[2:]); err != nil {
-			fmt.Println("Usage: go-image-processor concatvert <output> <input1> <input2> [input3...]")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor concatvert [-stream] [-caption] [-label <text>...] <output> <input1> <input2> [input3...]")
 			os.Exit(1)
 		}
 
 		if concatVertCmd.NArg() < 3 {
-			fmt.Println("Usage: go-image-processor concatvert <output> <input1> <input2> [input3...]")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor concatvert [-stream] [-caption] [-label <text>...] <output> <input1> <input2> [input3...]")
 			os.Exit(1)
 		}
 
 		outputPath := concatVertCmd.Arg(0)
 		inputPaths := concatVertCmd.Args()[1:]
-		err := processor.ConcatenateImagesVertically(inputPaths, outputPath)
+		opts, err := captions.options()
+		if err != nil {
+			handleError(err)
+		}
+		opts = append(opts, processor.WithProgress(progressBar(i18n.T("Concatenating"))))
+		if *stream {
+			err = processor.ConcatenateImagesVerticallyStream(inputPaths, outputPath, opts...)
+		} else {
+			err = processor.ConcatenateImagesVerticallyWith(inputPaths, outputPath, opts...)
+		}
 		if err != nil {
 			handleError(err)
 		}
-		fmt.Println("Images concatenated vertically successfully")
+		fmt.Println(i18n.T("Images concatenated vertically successfully"))
 
 	case "concathorz":
 		concatHorzCmd := flag.NewFlagSet("concathorz", flag.ExitOnError)
+		overlap := concatHorzCmd.Bool("overlap", false, i18n.T("Detect overlaps between images and blend the seams"))
+		captions := addCaptionFlags(concatHorzCmd)
 		if err := concatHorzCmd.Parse(os.Args[2:]); err != nil {
-			fmt.Println("Usage: go-image-processor concathorz <output> <input1> <input2> [input3...]")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor concathorz [-overlap] [-caption] [-label <text>...] <output> <input1> <input2> [input3...]")
 			os.Exit(1)
 		}
 
 		if concatHorzCmd.NArg() < 3 {
-			fmt.Println("Usage: go-image-processor concathorz <output> <input1> <input2> [input3...]")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor concathorz [-overlap] [-caption] [-label <text>...] <output> <input1> <input2> [input3...]")
 			os.Exit(1)
 		}
 
 		outputPath := concatHorzCmd.Arg(0)
 		inputPaths := concatHorzCmd.Args()[1:]
-		err := processor.ConcatenateImagesHorizontally(inputPaths, outputPath)
+		opts, err := captions.options()
 		if err != nil {
 			handleError(err)
 		}
-		fmt.Println("Images concatenated horizontally successfully")
+		if *overlap {
+			if len(opts) > 0 {
+				handleError(&processor.ErrProcessing{Op: "caption", Err: errors.New(i18n.T("-overlap blends the images into one panorama, which cannot be labeled"))})
+			}
+			err = processor.StitchImagesHorizontally(inputPaths, outputPath)
+		} else {
+			opts = append(opts, processor.WithProgress(progressBar(i18n.T("Concatenating"))))
+			err = processor.ConcatenateImagesHorizontallyWith(inputPaths, outputPath, opts...)
+		}
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Images concatenated horizontally successfully"))
 
 	case "generatetest":
 		generateTestCmd := flag.NewFlagSet("generatetest", flag.ExitOnError)
-		width := generateTestCmd.Int("width", 100, "Width of the test image")
-		height := generateTestCmd.Int("height", 100, "Height of the test image")
+		width := generateTestCmd.Int("width", 100, i18n.T("Width of the test image"))
+		height := generateTestCmd.Int("height", 100, i18n.T("Height of the test image"))
 		if err := generateTestCmd.Parse(os.Args[2:]); err != nil {
-			fmt.Println("Usage: go-image-processor generatetest <output> -width <width> -height <height>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor generatetest <output> -width <width> -height <height>")
 			os.Exit(1)
 		}
 		if generateTestCmd.NArg() < 1 || *width == 0 || *height == 0 {
-			fmt.Println("Usage: go-image-processor generatetest <output> -width <width> -height <height>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor generatetest <output> -width <width> -height <height>")
 			os.Exit(1)
 		}
 
 		if generateTestCmd.NArg() < 1 {
-			fmt.Println("Usage: go-image-processor generatetest <output> -width <width> -height <height>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor generatetest <output> -width <width> -height <height>")
 			os.Exit(1)
 		}
 
@@ -225,26 +916,1508 @@ func main() {
 		if err != nil {
 			handleError(err)
 		}
-		fmt.Println("Test image generated successfully")
+		fmt.Println(i18n.T("Test image generated successfully"))
+
 	case "edges":
 		edgesCmd := flag.NewFlagSet("edges", flag.ExitOnError)
+		roi := roiFlag(edgesCmd)
+		tiled := tiledFlag(edgesCmd)
 		if err := edgesCmd.Parse(os.Args[2:]); err != nil {
-			fmt.Println("Usage: go-image-processor edges <input> <output>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor edges [-roi x,y,w,h | -tiled] <input> <output>")
 			os.Exit(1)
 		}
 
 		if edgesCmd.NArg() < 2 {
-			fmt.Println("Usage: go-image-processor edges <input> <output>")
+			fmt.Println(i18n.T("Usage:"), "go-image-processor edges [-roi x,y,w,h | -tiled] <input> <output>")
 			os.Exit(1)
 		}
 
-		err := processor.DetectEdges(edgesCmd.Arg(0), edgesCmd.Arg(1))
+		opts, err := tiledOptions(*tiled, *roi, i18n.T("Detecting edges"))
 		if err != nil {
 			handleError(err)
 		}
-		fmt.Println("Edge detection completed successfully")
-	default:
-		fmt.Printf("Unknown command: %s\n", os.Args[1])
+		err = withROI(*roi, edgesCmd.Arg(0), edgesCmd.Arg(1), func(inputPath, outputPath string) error {
+			return processor.DetectEdgesWith(inputPath, outputPath, opts...)
+		}, func(img image.Image) (image.Image, error) {
+			return processor.EdgesWith(img, opts...)
+		})
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Edge detection completed successfully"))
+
+	case "textregions":
+		textRegionsCmd := flag.NewFlagSet("textregions", flag.ExitOnError)
+		if err := textRegionsCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor textregions <input>")
+			os.Exit(1)
+		}
+
+		if textRegionsCmd.NArg() < 1 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor textregions <input>")
+			os.Exit(1)
+		}
+
+		regions, err := processor.DetectTextRegions(textRegionsCmd.Arg(0))
+		if err != nil {
+			handleError(err)
+		}
+		printJSON(regions)
+
+	case "segment":
+		segmentCmd := flag.NewFlagSet("segment", flag.ExitOnError)
+		roi := roiFlag(segmentCmd)
+		levels := segmentCmd.Int("levels", 3, i18n.T("Number of gray levels in the output"))
+		if err := segmentCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor segment [-roi x,y,w,h] -levels <levels> <input> <output>")
+			os.Exit(1)
+		}
+
+		if segmentCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor segment [-roi x,y,w,h] -levels <levels> <input> <output>")
+			os.Exit(1)
+		}
+
+		var thresholds []uint8
+		err := withROI(*roi, segmentCmd.Arg(0), segmentCmd.Arg(1), func(inputPath, outputPath string) error {
+			var err error
+			thresholds, err = processor.MultiOtsuImage(inputPath, outputPath, *levels)
+			return err
+		}, func(img image.Image) (image.Image, error) {
+			var err error
+			img, thresholds, err = processor.MultiOtsu(img, *levels)
+			return img, err
+		})
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.Sprintf("Image segmented successfully (thresholds: %v)", thresholds))
+
+	case "skeleton":
+		skeletonCmd := flag.NewFlagSet("skeleton", flag.ExitOnError)
+		roi := roiFlag(skeletonCmd)
+		if err := skeletonCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor skeleton [-roi x,y,w,h] <input> <output>")
+			os.Exit(1)
+		}
+
+		if skeletonCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor skeleton [-roi x,y,w,h] <input> <output>")
+			os.Exit(1)
+		}
+
+		err := withROI(*roi, skeletonCmd.Arg(0), skeletonCmd.Arg(1), func(inputPath, outputPath string) error {
+			return processor.SkeletonizeImage(inputPath, outputPath)
+		}, func(img image.Image) (image.Image, error) {
+			return processor.Skeletonize(img), nil
+		})
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Image skeletonized successfully"))
+
+	case "trace":
+		traceCmd := flag.NewFlagSet("trace", flag.ExitOnError)
+		if err := traceCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor trace <input> <output.svg>")
+			os.Exit(1)
+		}
+
+		if traceCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor trace <input> <output.svg>")
+			os.Exit(1)
+		}
+
+		err := processor.TraceImage(traceCmd.Arg(0), traceCmd.Arg(1))
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Image traced successfully"))
+
+	case "checksum":
+		checksumCmd := flag.NewFlagSet("checksum", flag.ExitOnError)
+		tileSize := checksumCmd.Int("tile", 0, i18n.T("Also hash tiles of this size (0 disables tiling)"))
+		verifyPath := checksumCmd.String("verify", "", i18n.T("Compare against checksums previously written by this command"))
+		maxDistance := checksumCmd.Int("max-distance", 0, i18n.T("Perceptual hash distance still accepted by -verify"))
+		if err := checksumCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor checksum [-tile <size>] [-verify <checksums.json>] [-max-distance <bits>] <input> [input...]")
+			os.Exit(1)
+		}
+
+		if checksumCmd.NArg() < 1 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor checksum [-tile <size>] [-verify <checksums.json>] [-max-distance <bits>] <input> [input...]")
+			os.Exit(1)
+		}
+
+		var checksums []*processor.ImageChecksum
+		for _, path := range checksumCmd.Args() {
+			checksum, err := processor.ComputeChecksum(path, *tileSize)
+			if err != nil {
+				handleError(err)
+			}
+			checksums = append(checksums, checksum)
+		}
+
+		if *verifyPath == "" {
+			printJSON(checksums)
+			break
+		}
+
+		data, err := os.ReadFile(*verifyPath)
+		if err != nil {
+			handleError(&processor.ErrInvalidInput{Path: *verifyPath, Err: err})
+		}
+		var expected []*processor.ImageChecksum
+		if err := json.Unmarshal(data, &expected); err != nil {
+			handleError(err)
+		}
+		byFile := make(map[string]*processor.ImageChecksum)
+		for _, c := range expected {
+			byFile[c.File] = c
+		}
+
+		failed := false
+		for _, c := range checksums {
+			want, ok := byFile[c.File]
+			if !ok {
+				fmt.Println(i18n.Sprintf("%s: no recorded checksum", c.File))
+				failed = true
+				continue
+			}
+			// The tiles are compared at the size they were recorded with
+			if size := want.TileSize(); size > 0 && size != *tileSize {
+				if c, err = processor.ComputeChecksum(c.File, size); err != nil {
+					handleError(err)
+				}
+			}
+			comparison, err := c.Compare(want)
+			if err != nil {
+				handleError(err)
+			}
+			switch {
+			case comparison.Identical:
+				fmt.Println(i18n.Sprintf("%s: identical", c.File))
+			case comparison.Distance <= *maxDistance && comparison.MaxTileDistance() <= *maxDistance:
+				fmt.Println(i18n.Sprintf("%s: perceptually identical (distance %d)", c.File, comparison.Distance))
+			default:
+				fmt.Println(i18n.Sprintf("%s: different (distance %d)", c.File, comparison.Distance))
+				failed = true
+			}
+			// Tiles changed beyond the accepted distance locate a local edit
+			for _, tile := range comparison.Tiles {
+				if tile.Distance > *maxDistance {
+					fmt.Println(i18n.Sprintf("  tile %d,%d,%d,%d: different (distance %d)", tile.X, tile.Y, tile.Width, tile.Height, tile.Distance))
+				}
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+
+	case "group":
+		groupCmd := flag.NewFlagSet("group", flag.ExitOnError)
+		gap := groupCmd.Duration("gap", 2*time.Second, i18n.T("Maximum time between photos of the same group"))
+		maxDistance := groupCmd.Int("max-distance", 20, i18n.T("Maximum perceptual hash distance between photos of the same group"))
+		if err := groupCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor group [-gap <duration>] [-max-distance <bits>] <directory>")
+			os.Exit(1)
+		}
+
+		if groupCmd.NArg() < 1 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor group [-gap <duration>] [-max-distance <bits>] <directory>")
+			os.Exit(1)
+		}
+
+		inputPaths, err := listImages(groupCmd.Arg(0))
+		if err != nil {
+			handleError(err)
+		}
+		groups, err := processor.GroupPhotos(inputPaths, *gap, *maxDistance)
+		if err != nil {
+			handleError(err)
+		}
+		printJSON(groups)
+
+	case "interleave":
+		interleaveCmd := flag.NewFlagSet("interleave", flag.ExitOnError)
+		backInOrder := interleaveCmd.Bool("back-in-order", false, i18n.T("The back sides run from the first sheet to the last instead of in reverse"))
+		rotateBack := interleaveCmd.Bool("rotate-back", false, i18n.T("Turn the back sides by 180 degrees"))
+		dryRun := interleaveCmd.Bool("dry-run", false, i18n.T("Only print the page order"))
+		jsonOutput := interleaveCmd.Bool("json", false, i18n.T("Print the results as JSON"))
+		if err := interleaveCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor interleave [-back-in-order] [-rotate-back] [-dry-run] [-json] <fronts> <backs> <output-directory>")
+			os.Exit(1)
+		}
+		if interleaveCmd.NArg() < 3 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor interleave [-back-in-order] [-rotate-back] [-dry-run] [-json] <fronts> <backs> <output-directory>")
+			os.Exit(1)
+		}
+
+		var sides [2][]string
+		for i := range sides {
+			paths, err := listImages(interleaveCmd.Arg(i))
+			if err != nil {
+				handleError(err)
+			}
+			sortNatural(paths)
+			sides[i] = paths
+		}
+		outputDir := interleaveCmd.Arg(2)
+		pages, err := processor.InterleaveScans(sides[0], sides[1], outputDir, processor.InterleaveOptions{
+			BackInOrder: *backInOrder,
+			RotateBack:  *rotateBack,
+			DryRun:      *dryRun,
+		})
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(pages)
+			break
+		}
+		for _, page := range pages {
+			if page.Side == "front" {
+				fmt.Println(i18n.Sprintf("Page %d: front side %s", page.Page, page.Source))
+			} else {
+				fmt.Println(i18n.Sprintf("Page %d: back side %s", page.Page, page.Source))
+			}
+		}
+		if !*dryRun {
+			fmt.Println(i18n.Sprintf("%d pages written to %s", len(pages), outputDir))
+		}
+
+	case "blankdetect":
+		blankCmd := flag.NewFlagSet("blankdetect", flag.ExitOnError)
+		coverage := blankCmd.Float64("coverage", processor.DefaultBlankCoverage, i18n.T("Fraction of the page covered by ink below which it is blank"))
+		margin := blankCmd.Float64("margin", processor.DefaultBlankMargin, i18n.T("Fraction of each side ignored, where scanners leave shadows"))
+		jsonOutput := blankCmd.Bool("json", false, i18n.T("Print the results as JSON"))
+		if err := blankCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor blankdetect [-coverage <fraction>] [-margin <fraction>] [-json] <input> [input...]")
+			os.Exit(1)
+		}
+		if blankCmd.NArg() < 1 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor blankdetect [-coverage <fraction>] [-margin <fraction>] [-json] <input> [input...]")
+			os.Exit(1)
+		}
+
+		type blankPage struct {
+			File string `json:"file"`
+			*processor.BlankResult
+		}
+		var pages []blankPage
+		for _, path := range blankCmd.Args() {
+			result, err := processor.DetectBlankImage(path, processor.BlankOptions{Coverage: *coverage, Margin: *margin})
+			if err != nil {
+				handleError(err)
+			}
+			pages = append(pages, blankPage{File: path, BlankResult: result})
+		}
+		if *jsonOutput {
+			printJSON(pages)
+			break
+		}
+		for _, page := range pages {
+			if page.Blank {
+				fmt.Println(i18n.Sprintf("%s: blank (ink coverage %.3f%%)", page.File, page.Coverage*100))
+			} else {
+				fmt.Println(i18n.Sprintf("%s: not blank (ink coverage %.3f%%)", page.File, page.Coverage*100))
+			}
+		}
+
+	case "deblock":
+		deblockCmd := flag.NewFlagSet("deblock", flag.ExitOnError)
+		roi := roiFlag(deblockCmd)
+		strength := deblockCmd.Int("strength", 2, i18n.T("Filter strength from 1 (gentle) to 5 (aggressive)"))
+		if err := deblockCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor deblock [-roi x,y,w,h] [-strength <1-5>] <input> <output>")
+			os.Exit(1)
+		}
+		if deblockCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor deblock [-roi x,y,w,h] [-strength <1-5>] <input> <output>")
+			os.Exit(1)
+		}
+		err := withROI(*roi, deblockCmd.Arg(0), deblockCmd.Arg(1), func(inputPath, outputPath string) error {
+			return processor.DeblockImage(inputPath, outputPath, *strength)
+		}, func(img image.Image) (image.Image, error) {
+			return processor.Deblock(img, *strength), nil
+		})
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Image deblocked successfully"))
+
+	case "faces":
+		facesCmd := flag.NewFlagSet("faces", flag.ExitOnError)
+		if err := facesCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor faces <input>")
+			os.Exit(1)
+		}
+		if facesCmd.NArg() < 1 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor faces <input>")
+			os.Exit(1)
+		}
+		faces, err := processor.DetectFaces(facesCmd.Arg(0))
+		if err != nil {
+			handleError(err)
+		}
+		printJSON(faces)
+
+	case "blurfaces":
+		blurFacesCmd := flag.NewFlagSet("blurfaces", flag.ExitOnError)
+		roi := roiFlag(blurFacesCmd)
+		jsonOutput := blurFacesCmd.Bool("json", false, i18n.T("Print the blurred face boxes as JSON"))
+		if err := blurFacesCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor blurfaces [-roi x,y,w,h] [-json] <input> <output>")
+			os.Exit(1)
+		}
+		if blurFacesCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor blurfaces [-roi x,y,w,h] [-json] <input> <output>")
+			os.Exit(1)
+		}
+		var faces []processor.Face
+		err := withROI(*roi, blurFacesCmd.Arg(0), blurFacesCmd.Arg(1), func(inputPath, outputPath string) error {
+			var err error
+			faces, err = processor.BlurFacesImage(inputPath, outputPath)
+			return err
+		}, func(img image.Image) (image.Image, error) {
+			var err error
+			img, faces, err = processor.BlurFaces(img)
+			return img, err
+		})
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(faces)
+		} else {
+			fmt.Println(i18n.Sprintf("Faces blurred successfully (%d faces)", len(faces)))
+		}
+
+	case "facecrop":
+		faceCropCmd := flag.NewFlagSet("facecrop", flag.ExitOnError)
+		margin := faceCropCmd.Float64("margin", 0.4, i18n.T("Space kept around the face, as a fraction of its size"))
+		size := faceCropCmd.Uint("size", 0, i18n.T("Resize the crop to a square of this size (0 keeps the crop size)"))
+		jsonOutput := faceCropCmd.Bool("json", false, i18n.T("Print the cropped face box as JSON"))
+		if err := faceCropCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor facecrop [-margin <fraction>] [-size <pixels>] [-json] <input> <output>")
+			os.Exit(1)
+		}
+		if faceCropCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor facecrop [-margin <fraction>] [-size <pixels>] [-json] <input> <output>")
+			os.Exit(1)
+		}
+		face, err := processor.FaceCropImage(faceCropCmd.Arg(0), faceCropCmd.Arg(1), *margin, *size)
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(face)
+		} else {
+			fmt.Println(i18n.T("Image cropped to face successfully"))
+		}
+
+	case "watermark":
+		watermarkCmd := flag.NewFlagSet("watermark", flag.ExitOnError)
+		position := watermarkCmd.String("position", "bottom-right", i18n.T("Where to place the mark: a gravity such as south-east or 30%,70%; auto picks the least detailed corner"))
+		scale := watermarkCmd.Float64("scale", 0.2, i18n.T("Width of the mark relative to the image width"))
+		opacity := watermarkCmd.Float64("opacity", 0.5, i18n.T("Opacity of the mark"))
+		margin := watermarkCmd.Int("margin", 10, i18n.T("Distance from the image edges in pixels"))
+		if err := watermarkCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor watermark [-position auto|<gravity>] [-scale <fraction>] [-opacity <0-1>] [-margin <pixels>] <input> <watermark> <output>")
+			os.Exit(1)
+		}
+		if watermarkCmd.NArg() < 3 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor watermark [-position auto|<gravity>] [-scale <fraction>] [-opacity <0-1>] [-margin <pixels>] <input> <watermark> <output>")
+			os.Exit(1)
+		}
+		result, err := processor.WatermarkImage(watermarkCmd.Arg(0), watermarkCmd.Arg(1), watermarkCmd.Arg(2), processor.WatermarkOptions{
+			Position: *position,
+			Scale:    *scale,
+			Opacity:  *opacity,
+			Margin:   *margin,
+		})
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.Sprintf("Image watermarked successfully (position: %s)", result.Position))
+
+	case "colorblind":
+		colorBlindCmd := flag.NewFlagSet("colorblind", flag.ExitOnError)
+		roi := roiFlag(colorBlindCmd)
+		deficiency := colorBlindCmd.String("type", "deuteranopia", i18n.T("Color vision deficiency to simulate: protanopia, deuteranopia or tritanopia"))
+		if err := colorBlindCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor colorblind [-roi x,y,w,h] -type protanopia|deuteranopia|tritanopia <input> <output>")
+			os.Exit(1)
+		}
+		if colorBlindCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor colorblind [-roi x,y,w,h] -type protanopia|deuteranopia|tritanopia <input> <output>")
+			os.Exit(1)
+		}
+		err := withROI(*roi, colorBlindCmd.Arg(0), colorBlindCmd.Arg(1), func(inputPath, outputPath string) error {
+			return processor.SimulateColorBlindness(inputPath, outputPath, *deficiency)
+		}, func(img image.Image) (image.Image, error) {
+			return processor.SimulateDeficiency(img, *deficiency)
+		})
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Color blindness simulated successfully"))
+
+	case "contrast":
+		contrastCmd := flag.NewFlagSet("contrast", flag.ExitOnError)
+		if err := contrastCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor contrast <input>")
+			os.Exit(1)
+		}
+		if contrastCmd.NArg() < 1 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor contrast <input>")
+			os.Exit(1)
+		}
+		report, err := processor.CheckContrast(contrastCmd.Arg(0))
+		if err != nil {
+			handleError(err)
+		}
+		printJSON(report)
+		if !report.Passes {
+			os.Exit(1)
+		}
+
+	case "negative":
+		negativeCmd := flag.NewFlagSet("negative", flag.ExitOnError)
+		roi := roiFlag(negativeCmd)
+		baseFlag := negativeCmd.String("base", "", i18n.T("Film base color as hex, rgb() or a name (default: measured from the film border)"))
+		border := negativeCmd.Float64("border", 0.03, i18n.T("Fraction of each side sampled for the film base color"))
+		if err := negativeCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor negative [-roi x,y,w,h] [-base <color>] [-border <fraction>] <input> <output>")
+			os.Exit(1)
+		}
+		if negativeCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor negative [-roi x,y,w,h] [-base <color>] [-border <fraction>] <input> <output>")
+			os.Exit(1)
+		}
+		opts := processor.NegativeOptions{Border: *border}
+		if *baseFlag != "" {
+			base, err := processor.ParseColor(*baseFlag)
+			if err != nil {
+				handleError(err)
+			}
+			opts.Base = color.RGBAModel.Convert(base).(color.RGBA)
+		}
+		var result *processor.NegativeResult
+		err := withROI(*roi, negativeCmd.Arg(0), negativeCmd.Arg(1), func(inputPath, outputPath string) error {
+			var err error
+			result, err = processor.InvertNegativeImage(inputPath, outputPath, opts)
+			return err
+		}, func(img image.Image) (image.Image, error) {
+			img, result = processor.InvertNegative(img, opts)
+			return img, nil
+		})
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.Sprintf("Negative inverted successfully (film base: %s)", result.Base))
+
+	case "docclean":
+		docCleanCmd := flag.NewFlagSet("docclean", flag.ExitOnError)
+		roi := roiFlag(docCleanCmd)
+		preset := docCleanCmd.String("preset", "document", i18n.T("Cleanup preset: document or whiteboard"))
+		if err := docCleanCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor docclean [-roi x,y,w,h] [-preset document|whiteboard] <input> <output>")
+			os.Exit(1)
+		}
+		if docCleanCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor docclean [-roi x,y,w,h] [-preset document|whiteboard] <input> <output>")
+			os.Exit(1)
+		}
+		err := withROI(*roi, docCleanCmd.Arg(0), docCleanCmd.Arg(1), func(inputPath, outputPath string) error {
+			return processor.DocCleanImage(inputPath, outputPath, *preset)
+		}, func(img image.Image) (image.Image, error) {
+			return processor.DocClean(img, *preset)
+		})
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Document cleaned successfully"))
+
+	case "halftone":
+		halftoneCmd := flag.NewFlagSet("halftone", flag.ExitOnError)
+		roi := roiFlag(halftoneCmd)
+		pitch := halftoneCmd.Float64("pitch", 6, i18n.T("Distance between dot centers in pixels"))
+		angle := halftoneCmd.Float64("angle", 45, i18n.T("Screen angle in degrees"))
+		if err := halftoneCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor halftone [-roi x,y,w,h] [-pitch <pixels>] [-angle <degrees>] <input> <output>")
+			os.Exit(1)
+		}
+		if halftoneCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor halftone [-roi x,y,w,h] [-pitch <pixels>] [-angle <degrees>] <input> <output>")
+			os.Exit(1)
+		}
+		err := withROI(*roi, halftoneCmd.Arg(0), halftoneCmd.Arg(1), func(inputPath, outputPath string) error {
+			return processor.HalftoneImage(inputPath, outputPath, *pitch, *angle)
+		}, func(img image.Image) (image.Image, error) {
+			return processor.Halftone(img, *pitch, *angle)
+		})
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Halftone rendered successfully"))
+
+	case "comic":
+		comicCmd := flag.NewFlagSet("comic", flag.ExitOnError)
+		roi := roiFlag(comicCmd)
+		levels := comicCmd.Int("levels", 4, i18n.T("Number of tones per color channel"))
+		edgeThreshold := comicCmd.Float64("edge-threshold", 200, i18n.T("Edge strength above which pixels are inked"))
+		if err := comicCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor comic [-roi x,y,w,h] [-levels <levels>] [-edge-threshold <strength>] <input> <output>")
+			os.Exit(1)
+		}
+		if comicCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor comic [-roi x,y,w,h] [-levels <levels>] [-edge-threshold <strength>] <input> <output>")
+			os.Exit(1)
+		}
+		err := withROI(*roi, comicCmd.Arg(0), comicCmd.Arg(1), func(inputPath, outputPath string) error {
+			return processor.ComicImage(inputPath, outputPath, *levels, *edgeThreshold)
+		}, func(img image.Image) (image.Image, error) {
+			return processor.Comic(img, *levels, *edgeThreshold)
+		})
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Comic rendered successfully"))
+
+	case "preview":
+		previewCmd := flag.NewFlagSet("preview", flag.ExitOnError)
+		width := previewCmd.Int("width", 80, i18n.T("Number of terminal columns to use"))
+		ascii := previewCmd.Bool("ascii", false, i18n.T("Render plain ASCII characters instead of ANSI truecolor blocks"))
+		if err := previewCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor preview [-width <columns>] [-ascii] <input>")
+			os.Exit(1)
+		}
+		if previewCmd.NArg() < 1 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor preview [-width <columns>] [-ascii] <input>")
+			os.Exit(1)
+		}
+		err := processor.RenderTerminalPreview(os.Stdout, previewCmd.Arg(0), processor.TerminalPreviewOptions{
+			Width: *width,
+			ASCII: *ascii,
+		})
+		if err != nil {
+			handleError(err)
+		}
+
+	case "convert":
+		convertCmd := flag.NewFlagSet("convert", flag.ExitOnError)
+		colorType := convertCmd.String("colortype", "", i18n.T("Output color type: gray, gray16, rgb, rgba or palette"))
+		bits := convertCmd.Int("bits", 0, i18n.T("Bits per sample (default: 8, or 16 for gray16)"))
+		colors := convertCmd.Int("colors", 0, i18n.T("Palette size for -colortype palette (default: 2^bits)"))
+		paletteFlag := convertCmd.String("palette", "", i18n.T("Fixed palette for -colortype palette, as comma-separated colors (default: generated from the image)"))
+		dither := convertCmd.Bool("dither", false, i18n.T("Use Floyd-Steinberg dithering when reducing colors"))
+		interlace := convertCmd.Bool("interlace", false, i18n.T("Write an Adam7 interlaced PNG for progressive display"))
+		if err := convertCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor convert -colortype gray|gray16|rgb|rgba|palette [-bits 1|2|4|8|16] [-colors <n> | -palette <colors>] [-dither] [-interlace] <input> <output.png>")
+			os.Exit(1)
+		}
+		if convertCmd.NArg() < 2 || *colorType == "" {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor convert -colortype gray|gray16|rgb|rgba|palette [-bits 1|2|4|8|16] [-colors <n> | -palette <colors>] [-dither] [-interlace] <input> <output.png>")
+			os.Exit(1)
+		}
+		var palette processor.Palette
+		if *paletteFlag != "" {
+			var err error
+			palette, err = processor.ParsePalette(*paletteFlag)
+			if err != nil {
+				handleError(err)
+			}
+		}
+		err := processor.ConvertImage(convertCmd.Arg(0), convertCmd.Arg(1), processor.ConvertOptions{
+			ColorType: *colorType,
+			Bits:      *bits,
+			Colors:    *colors,
+			Palette:   palette,
+			Dither:    *dither,
+			Interlace: *interlace,
+		})
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Image converted successfully"))
+
+	case "batch":
+		batchCmd := flag.NewFlagSet("batch", flag.ExitOnError)
+		roi := roiFlag(batchCmd)
+		timeout := batchCmd.Duration("timeout", time.Minute, i18n.T("Longest time a single file may take (0 for no limit)"))
+		workers := batchCmd.Int("workers", 0, i18n.T("Number of files processed in parallel (default: number of CPUs)"))
+		reportPath := batchCmd.String("report", "", i18n.T("Write a JSON report of every file (status, timings, sizes, errors) to this path"))
+		symlinks := batchCmd.String("symlinks", "follow", i18n.T("How to treat inputs that are symbolic links (follow or skip)"))
+		preserveTimes := batchCmd.Bool("preserve-times", false, i18n.T("Give each output the modification time of its input"))
+		preserveMode := batchCmd.Bool("preserve-mode", false, i18n.T("Give each output the permissions of its input"))
+		preserveOwner := batchCmd.Bool("preserve-owner", false, i18n.T("Give each output the owner and group of its input"))
+		blank := batchCmd.String("blank", "keep", i18n.T("What to do with blank pages (keep, skip or delete the input)"))
+		blankCoverage := batchCmd.Float64("blank-coverage", processor.DefaultBlankCoverage, i18n.T("Fraction of the page covered by ink below which it is blank"))
+		webhook := batchCmd.String("webhook", "", i18n.T("Post the report to this URL when the run finishes, in addition to the configured webhooks"))
+		encryptKey := batchCmd.String("encrypt-key", processor.Default().Config().EncryptionKey, i18n.T("Encrypt the outputs with AES-GCM, with the key read from env:NAME, file:PATH or cmd:COMMAND"))
+		if err := batchCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor batch [-roi x,y,w,h] [-timeout <duration>] [-workers <n>] [-report <report.json>] [-symlinks follow|skip] [-preserve-times] [-preserve-mode] [-preserve-owner] [-blank keep|skip|delete] [-blank-coverage <fraction>] [-webhook <url>] [-encrypt-key <source>] <operation> <input-location> <output-location>")
+			os.Exit(1)
+		}
+		if batchCmd.NArg() < 3 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor batch [-roi x,y,w,h] [-timeout <duration>] [-workers <n>] [-report <report.json>] [-symlinks follow|skip] [-preserve-times] [-preserve-mode] [-preserve-owner] [-blank keep|skip|delete] [-blank-coverage <fraction>] [-webhook <url>] [-encrypt-key <source>] <operation> <input-location> <output-location>")
+			os.Exit(1)
+		}
+		operation, ok := batchOperation(batchCmd.Arg(0))
+		if recipePath, isRecipe := strings.CutPrefix(batchCmd.Arg(0), "recipe:"); !ok && isRecipe {
+			recipe, err := processor.LoadRecipe(recipePath)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			operation = func(inputPath, outputPath string) error {
+				_, err := recipe.Run(inputPath, outputPath)
+				return err
+			}
+			ok = true
+		}
+		if !ok && strings.Contains(batchCmd.Arg(0), "=") {
+			routes, err := parseRoutes(batchCmd.Arg(0))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			operation = func(inputPath, outputPath string) error {
+				_, err := processor.RouteImage(inputPath, outputPath, routes)
+				return err
+			}
+			ok = true
+		}
+		if !ok {
+			fmt.Println(i18n.Sprintf("Unknown batch operation: %s", batchCmd.Arg(0)))
+			os.Exit(1)
+		}
+		if *roi != "" {
+			region, ok := regionOperation(batchCmd.Arg(0))
+			if !ok {
+				fmt.Println(i18n.Sprintf("-roi cannot be used with %s", batchCmd.Arg(0)))
+				os.Exit(1)
+			}
+			box, err := processor.ParseBox(*roi)
+			if err != nil {
+				handleError(&processor.ErrProcessing{Op: "roi", Err: err})
+			}
+			operation = func(inputPath, outputPath string) error {
+				return processor.ApplyInRegion(inputPath, outputPath, box, region)
+			}
+		}
+		outputExt := ".jpg"
+		if *encryptKey != "" {
+			encryption, err := processor.LoadEncryption(*encryptKey)
+			if err != nil {
+				handleError(err)
+			}
+			operation = encryption.Operation(operation)
+			outputExt += processor.EncryptedExt
+		}
+		symlinkPolicy, err := processor.ParseSymlinkPolicy(*symlinks)
+		if err != nil {
+			handleError(err)
+		}
+		blankPolicy, err := processor.ParseBlankPolicy(*blank)
+		if err != nil {
+			handleError(err)
+		}
+		inputStore, inputDir, err := processor.OpenStorage(batchCmd.Arg(1))
+		if err != nil {
+			handleError(err)
+		}
+		defer inputStore.Close()
+		outputStore, outputDir, err := processor.OpenStorage(batchCmd.Arg(2))
+		if err != nil {
+			handleError(err)
+		}
+		defer outputStore.Close()
+		local := processor.IsLocalStorage(inputStore) && processor.IsLocalStorage(outputStore)
+		if !local && (*preserveTimes || *preserveMode || *preserveOwner) {
+			fmt.Println(i18n.T("-preserve-times, -preserve-mode and -preserve-owner need local input and output directories"))
+			os.Exit(1)
+		}
+		if !processor.IsLocalStorage(inputStore) && blankPolicy != processor.BlankKeep {
+			fmt.Println(i18n.T("-blank needs a local input directory"))
+			os.Exit(1)
+		}
+		var inputPaths []string
+		if processor.IsLocalStorage(inputStore) {
+			inputPaths, err = listImages(inputDir)
+		} else {
+			inputPaths, err = listStoredImages(inputStore, inputDir)
+		}
+		if err != nil {
+			handleError(err)
+		}
+		if err := processor.CheckBatchOutputs(inputPaths, outputExt); err != nil {
+			handleError(err)
+		}
+		if processor.IsLocalStorage(outputStore) {
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				handleError(&processor.ErrInvalidOutput{Path: outputDir, Err: err})
+			}
+		}
+
+		report := processor.RunBatch(inputPaths, processor.BatchOptions{
+			Timeout:       *timeout,
+			Workers:       *workers,
+			Progress:      progressBar(i18n.T("Processing files")),
+			Symlinks:      symlinkPolicy,
+			PreserveTimes: *preserveTimes,
+			PreserveMode:  *preserveMode,
+			PreserveOwner: *preserveOwner,
+			Blank:         blankPolicy,
+			BlankOptions:  processor.BlankOptions{Coverage: *blankCoverage},
+		}, func(inputPath string) (string, error) {
+			name := processor.BatchOutputName(inputPath, outputExt)
+			if local {
+				outputPath := filepath.Join(outputDir, name)
+				return outputPath, operation(inputPath, outputPath)
+			}
+			outputPath := path.Join(outputDir, name)
+			if processor.IsLocalStorage(outputStore) {
+				outputPath = filepath.Join(outputDir, name)
+			}
+			return outputPath, processor.ProcessStored(inputStore, inputPath, outputStore, outputPath, operation)
+		})
+		report.Operation = batchCmd.Arg(0)
+		report.Parameters = map[string]string{
+			"input":          processor.RedactLocation(batchCmd.Arg(1)),
+			"output":         processor.RedactLocation(batchCmd.Arg(2)),
+			"timeout":        timeout.String(),
+			"workers":        strconv.Itoa(*workers),
+			"roi":            *roi,
+			"symlinks":       string(symlinkPolicy),
+			"preserve-times": strconv.FormatBool(*preserveTimes),
+			"preserve-mode":  strconv.FormatBool(*preserveMode),
+			"preserve-owner": strconv.FormatBool(*preserveOwner),
+			"blank":          string(blankPolicy),
+			"encrypted":      strconv.FormatBool(*encryptKey != ""),
+		}
+		if *reportPath != "" {
+			if err := writeJSONFile(*reportPath, report); err != nil {
+				handleError(err)
+			}
+		}
+		event := processor.BatchEvent(report)
+		processor.NotifyWebhooks(event)
+		processor.NotifyBatch(report)
+		if *webhook != "" {
+			if err := processor.SendWebhook(config.Webhook{URL: *webhook}, event); err != nil {
+				fmt.Println(i18n.Sprintf("Webhook failed: %v", err))
+			}
+		}
+		fmt.Println(i18n.Sprintf("Processed %d files: %d succeeded, %d skipped, %d failed", len(inputPaths), report.Succeeded, report.Skipped, len(report.Failures)))
+		for _, failure := range report.Failures {
+			fmt.Printf("  %s: %s\n", failure.File, failure.Error)
+		}
+		if len(report.Failures) > 0 {
+			os.Exit(1)
+		}
+
+	case "normalize":
+		normalizeCmd := flag.NewFlagSet("normalize", flag.ExitOnError)
+		colorType := normalizeCmd.String("colortype", "", i18n.T("Write PNGs of this color type (gray, gray16, rgb, rgba or palette) instead of color JPEGs"))
+		bits := normalizeCmd.Int("bits", 0, i18n.T("Bits per sample (default: 8, or 16 for gray16)"))
+		dpi := normalizeCmd.Float64("dpi", 0, i18n.T("Resample the pages to this resolution (0 keeps the resolution of each page)"))
+		name := normalizeCmd.String("name", processor.DefaultNormalizeName, i18n.T("Template of the output names: {name}, {index} and {date} are replaced"))
+		noDeskew := normalizeCmd.Bool("no-deskew", false, i18n.T("Do not correct the skew"))
+		noTrim := normalizeCmd.Bool("no-trim", false, i18n.T("Do not trim the borders"))
+		workers := normalizeCmd.Int("workers", 0, i18n.T("Number of files processed in parallel (default: number of CPUs)"))
+		reportPath := normalizeCmd.String("report", "", i18n.T("Write a JSON report of every file (status, timings, sizes, errors) to this path"))
+		if err := normalizeCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor normalize [-colortype <type>] [-bits <bits>] [-dpi <dpi>] [-name <template>] [-no-deskew] [-no-trim] [-workers <n>] [-report <report.json>] <input-directory> <output-directory>")
+			os.Exit(1)
+		}
+		if normalizeCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor normalize [-colortype <type>] [-bits <bits>] [-dpi <dpi>] [-name <template>] [-no-deskew] [-no-trim] [-workers <n>] [-report <report.json>] <input-directory> <output-directory>")
+			os.Exit(1)
+		}
+
+		inputPaths, err := listImages(normalizeCmd.Arg(0))
+		if err != nil {
+			handleError(err)
+		}
+		sortNatural(inputPaths)
+		report, err := processor.NormalizeImages(context.Background(), inputPaths, normalizeCmd.Arg(1), processor.NormalizeOptions{
+			NoDeskew:  *noDeskew,
+			NoTrim:    *noTrim,
+			ColorType: *colorType,
+			Bits:      *bits,
+			DPI:       *dpi,
+			Name:      *name,
+		}, processor.BatchOptions{
+			Workers:  *workers,
+			Progress: progressBar(i18n.T("Processing files")),
+		})
+		if err != nil {
+			handleError(err)
+		}
+		report.Operation = "normalize"
+		if *reportPath != "" {
+			if err := writeJSONFile(*reportPath, report); err != nil {
+				handleError(err)
+			}
+		}
+		fmt.Println(i18n.Sprintf("Processed %d files: %d succeeded, %d skipped, %d failed", len(inputPaths), report.Succeeded, report.Skipped, len(report.Failures)))
+		for _, failure := range report.Failures {
+			fmt.Printf("  %s: %s\n", failure.File, failure.Error)
+		}
+		if len(report.Failures) > 0 {
+			os.Exit(1)
+		}
+
+	case "fixext":
+		fixextCmd := flag.NewFlagSet("fixext", flag.ExitOnError)
+		reencode := fixextCmd.Bool("reencode", false, i18n.T("Convert mismatched files to the format of their extension instead of renaming them"))
+		dryRun := fixextCmd.Bool("dry-run", false, i18n.T("Only report mismatched files"))
+		jsonOutput := fixextCmd.Bool("json", false, i18n.T("Print the results as JSON"))
+		if err := fixextCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor fixext [-reencode] [-dry-run] [-json] <file> [file...]")
+			os.Exit(1)
+		}
+		if fixextCmd.NArg() < 1 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor fixext [-reencode] [-dry-run] [-json] <file> [file...]")
+			os.Exit(1)
+		}
+		var fixes []*processor.ExtensionFix
+		for _, path := range fixextCmd.Args() {
+			fix, err := processor.FixExtension(path, processor.FixExtensionOptions{
+				Reencode: *reencode,
+				DryRun:   *dryRun,
+			})
+			if err != nil {
+				handleError(err)
+			}
+			fixes = append(fixes, fix)
+		}
+		if *jsonOutput {
+			printJSON(fixes)
+			break
+		}
+		for _, fix := range fixes {
+			switch {
+			case !fix.Mismatch:
+				fmt.Println(i18n.Sprintf("%s: %s data, extension matches", fix.Path, fix.Format))
+			case fix.NewPath != "":
+				fmt.Println(i18n.Sprintf("%s: %s data, renamed to %s", fix.Path, fix.Format, fix.NewPath))
+			case fix.Reencoded:
+				fmt.Println(i18n.Sprintf("%s: %s data, re-encoded to match the extension", fix.Path, fix.Format))
+			default:
+				fmt.Println(i18n.Sprintf("%s: %s data, extension does not match", fix.Path, fix.Format))
+			}
+		}
+	case "classify":
+		classifyCmd := flag.NewFlagSet("classify", flag.ExitOnError)
+		jsonOutput := classifyCmd.Bool("json", false, i18n.T("Print the classification and its measurements as JSON"))
+		if err := classifyCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor classify [-json] <input>")
+			os.Exit(1)
+		}
+		if classifyCmd.NArg() < 1 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor classify [-json] <input>")
+			os.Exit(1)
+		}
+		c, err := processor.ClassifyImage(classifyCmd.Arg(0))
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(c)
+			break
+		}
+		fmt.Println(i18n.Sprintf("%s (photo tiles: %.0f%%, bimodality: %.2f, saturation: %.2f)", c.Class, c.PhotoFraction*100, c.Bimodality, c.Saturation))
+	case "exifthumb":
+		exifThumbCmd := flag.NewFlagSet("exifthumb", flag.ExitOnError)
+		jsonOutput := exifThumbCmd.Bool("json", false, i18n.T("Print the thumbnail size and orientation as JSON"))
+		if err := exifThumbCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor exifthumb [-json] <input> <output.jpg>")
+			os.Exit(1)
+		}
+		if exifThumbCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor exifthumb [-json] <input> <output.jpg>")
+			os.Exit(1)
+		}
+		thumb, err := processor.ExtractExifThumbnail(exifThumbCmd.Arg(0), exifThumbCmd.Arg(1))
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(thumb)
+			break
+		}
+		fmt.Println(i18n.Sprintf("Thumbnail extracted successfully (%dx%d, %d bytes)", thumb.Width, thumb.Height, thumb.Bytes))
+	case "fastpreview":
+		fastPreviewCmd := flag.NewFlagSet("fastpreview", flag.ExitOnError)
+		if err := fastPreviewCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor fastpreview <input> <output>")
+			os.Exit(1)
+		}
+		if fastPreviewCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor fastpreview <input> <output>")
+			os.Exit(1)
+		}
+		if err := processor.FastPreviewImage(fastPreviewCmd.Arg(0), fastPreviewCmd.Arg(1)); err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Preview created successfully"))
+	case "recipe":
+		recipeCmd := flag.NewFlagSet("recipe", flag.ExitOnError)
+		jsonOutput := recipeCmd.Bool("json", false, i18n.T("Print the steps that ran as JSON"))
+		if err := recipeCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor recipe [-json] <recipe-file> (<input> <output> | <input>... <output-dir>)")
+			os.Exit(1)
+		}
+		if recipeCmd.NArg() < 3 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor recipe [-json] <recipe-file> (<input> <output> | <input>... <output-dir>)")
+			os.Exit(1)
+		}
+		recipe, err := processor.LoadRecipe(recipeCmd.Arg(0))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if n := recipeCmd.NArg(); n > 3 {
+			inputPaths := recipeCmd.Args()[1 : n-1]
+			report, err := recipe.ProcessBatch(context.Background(), inputPaths, recipeCmd.Arg(n-1), processor.BatchOptions{
+				Progress: progressBar(i18n.T("Processing files")),
+			})
+			if err != nil {
+				handleError(err)
+			}
+			report.Operation = "recipe:" + recipeCmd.Arg(0)
+			if *jsonOutput {
+				printJSON(report)
+			} else {
+				fmt.Println(i18n.Sprintf("Processed %d files: %d succeeded, %d skipped, %d failed", len(inputPaths), report.Succeeded, report.Skipped, len(report.Failures)))
+				for _, failure := range report.Failures {
+					fmt.Printf("  %s: %s\n", failure.File, failure.Error)
+				}
+			}
+			if len(report.Failures) > 0 {
+				os.Exit(1)
+			}
+			break
+		}
+		result, err := recipe.Run(recipeCmd.Arg(1), recipeCmd.Arg(2))
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(result)
+			break
+		}
+		fmt.Println(i18n.Sprintf("Recipe applied successfully (%s)", strings.Join(result.Steps, ", ")))
+	case "wasm":
+		wasmCmd := flag.NewFlagSet("wasm", flag.ExitOnError)
+		timeout := wasmCmd.Duration("timeout", 30*time.Second, i18n.T("Stop the filter if it runs longer than this"))
+		if err := wasmCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor wasm [-timeout <duration>] <module.wasm> <input> <output> [param...]")
+			os.Exit(1)
+		}
+		if wasmCmd.NArg() < 3 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor wasm [-timeout <duration>] <module.wasm> <input> <output> [param...]")
+			os.Exit(1)
+		}
+		opts := processor.WasmOptions{Module: wasmCmd.Arg(0), Timeout: *timeout}
+		for _, arg := range wasmCmd.Args()[3:] {
+			param, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				fmt.Println(i18n.Sprintf("Invalid parameter %q: parameters must be numbers", arg))
+				os.Exit(1)
+			}
+			opts.Params = append(opts.Params, param)
+		}
+		if err := processor.WasmFilterImage(wasmCmd.Arg(1), wasmCmd.Arg(2), opts); err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("WASM filter applied successfully"))
+	case "thumbnail":
+		thumbnailCmd := flag.NewFlagSet("thumbnail", flag.ExitOnError)
+		size := thumbnailCmd.Int("size", 256, i18n.T("Largest side of the thumbnail in pixels"))
+		square := thumbnailCmd.Bool("square", false, i18n.T("Crop the middle to a sharpened square JPEG for galleries"))
+		if err := thumbnailCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor thumbnail [-size <pixels>] [-square] <input> <output.png|->")
+			os.Exit(1)
+		}
+		if thumbnailCmd.NArg() < 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor thumbnail [-size <pixels>] [-square] <input> <output.png|->")
+			os.Exit(1)
+		}
+		if *square {
+			if thumbnailCmd.Arg(1) == "-" {
+				input, err := os.Open(thumbnailCmd.Arg(0))
+				if err != nil {
+					handleError(&processor.ErrInvalidInput{Path: thumbnailCmd.Arg(0), Err: err})
+				}
+				defer input.Close()
+				if err := processor.ThumbnailReader(input, os.Stdout, *size); err != nil {
+					handleError(err)
+				}
+				break
+			}
+			if err := processor.Thumbnail(thumbnailCmd.Arg(0), thumbnailCmd.Arg(1), *size); err != nil {
+				handleError(err)
+			}
+			fmt.Println(i18n.T("Thumbnail created successfully"))
+			break
+		}
+		// "-" writes the PNG to stdout for shell extensions and other helpers
+		if thumbnailCmd.Arg(1) == "-" {
+			if err := processor.WriteThumbnail(os.Stdout, thumbnailCmd.Arg(0), *size); err != nil {
+				handleError(err)
+			}
+			break
+		}
+		if err := processor.ThumbnailImage(thumbnailCmd.Arg(0), thumbnailCmd.Arg(1), *size); err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Thumbnail created successfully"))
+	case "capture":
+		captureCmd := flag.NewFlagSet("capture", flag.ExitOnError)
+		window := captureCmd.String("window", "", i18n.T("Capture the window with this id instead of the whole screen (X11 and macOS)"))
+		delay := captureCmd.Duration("delay", 0, i18n.T("Wait before capturing, e.g. 3s to open a menu"))
+		region := captureCmd.String("region", "", i18n.T("Keep only the rectangle x,y,width,height or WxH+X+Y"))
+		var redact, boxes boxList
+		captureCmd.Var(&redact, "redact", i18n.T("Black out the rectangle x,y,width,height (repeatable)"))
+		captureCmd.Var(&boxes, "box", i18n.T("Outline the rectangle x,y,width,height (repeatable)"))
+		boxColor := captureCmd.String("box-color", "red", i18n.T("Color of the outlines"))
+		fit := captureCmd.String("fit", "", i18n.T("Shrink the screenshot to fit WxH"))
+		recipePath := captureCmd.String("recipe", "", i18n.T("Apply a recipe to the screenshot"))
+		clipboard := captureCmd.Bool("clipboard", false, i18n.T("Copy the screenshot to the clipboard"))
+		jsonOutput := captureCmd.Bool("json", false, i18n.T("Print the tool and size as JSON"))
+		if err := captureCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor capture [-window <id>] [-delay <duration>] [-region x,y,w,h] [-redact x,y,w,h]... [-box x,y,w,h]... [-box-color <color>] [-fit WxH] [-recipe <file>] [-clipboard] [-json] [output.png]")
+			os.Exit(1)
+		}
+		if captureCmd.NArg() < 1 && !*clipboard {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor capture [-window <id>] [-delay <duration>] [-region x,y,w,h] [-redact x,y,w,h]... [-box x,y,w,h]... [-box-color <color>] [-fit WxH] [-recipe <file>] [-clipboard] [-json] [output.png]")
+			os.Exit(1)
+		}
+		opts := processor.CaptureOptions{
+			Window:    *window,
+			Delay:     *delay,
+			Redact:    redact,
+			Boxes:     boxes,
+			Clipboard: *clipboard,
+		}
+		if *region != "" {
+			box, err := processor.ParseBox(*region)
+			if err != nil {
+				handleError(&processor.ErrProcessing{Op: "capture", Err: err})
+			}
+			opts.Region = box
+		}
+		c, err := processor.ParseColor(*boxColor)
+		if err != nil {
+			handleError(&processor.ErrProcessing{Op: "capture", Err: err})
+		}
+		opts.BoxColor = c
+		if *fit != "" {
+			g, err := processor.ParseGeometry(*fit)
+			if err != nil || !g.IsSize() || g.Width.IsPhysical() || g.Height.IsPhysical() {
+				handleError(&processor.ErrProcessing{Op: "capture", Err: fmt.Errorf("-fit takes a size in pixels such as 1280x800, got %q", *fit)})
+			}
+			opts.Width, opts.Height = int(g.Width.Value), int(g.Height.Value)
+		}
+		if *recipePath != "" {
+			recipe, err := processor.LoadRecipe(*recipePath)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			opts.Recipe = recipe
+		}
+		result, err := processor.CaptureScreen(captureCmd.Arg(0), opts)
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(result)
+			break
+		}
+		fmt.Println(i18n.Sprintf("Screen captured successfully (%dx%d)", result.Width, result.Height))
+	case "thumbnail-daemon":
+		daemonCmd := flag.NewFlagSet("thumbnail-daemon", flag.ExitOnError)
+		flavors := daemonCmd.String("flavors", "normal,large", i18n.T("Thumbnail cache sizes to fill: normal, large, x-large, xx-large"))
+		interval := daemonCmd.Duration("interval", 10*time.Second, i18n.T("How often the directories are scanned for new images"))
+		entry := daemonCmd.Bool("entry", false, i18n.T("Print a freedesktop .thumbnailer file for this program and exit"))
+		if err := daemonCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor thumbnail-daemon [-flavors normal,large] [-interval <duration>] [-entry] <dir> [dir...]")
+			os.Exit(1)
+		}
+		if *entry {
+			exe, err := os.Executable()
+			if err != nil {
+				exe = "go-image-processor"
+			}
+			fmt.Print(processor.ThumbnailerEntry(exe))
+			break
+		}
+		if daemonCmd.NArg() < 1 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor thumbnail-daemon [-flavors normal,large] [-interval <duration>] [-entry] <dir> [dir...]")
+			os.Exit(1)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := processor.ThumbnailDaemon(ctx, daemonCmd.Args(), processor.ThumbnailDaemonOptions{
+			Flavors:  strings.Split(*flavors, ","),
+			Interval: *interval,
+		})
+		stop()
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Thumbnail daemon stopped"))
+	case "worker":
+		workerCmd := flag.NewFlagSet("worker", flag.ExitOnError)
+		workers := workerCmd.Int("workers", 0, i18n.T("Number of requests processed in parallel (default: number of CPUs)"))
+		grace := workerCmd.Duration("grace", 25*time.Second, i18n.T("How long requests in progress may take to finish after SIGTERM (0 for no limit)"))
+		healthAddr := workerCmd.String("health", "", i18n.T("Serve /healthz and /readyz on this address, e.g. :8081"))
+		reload := workerCmd.Bool("reload", false, i18n.T("Apply changes to config.yaml and its preset files without restarting"))
+		roots := workerCmd.String("roots", ".", i18n.T("Comma-separated directories and sftp:// or dav:// URLs requests may read from and write to"))
+		if err := workerCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor worker [-workers <n>] [-grace <duration>] [-health <addr>] [-reload] [-roots <locations>] <queue-url>")
+			os.Exit(1)
+		}
+		if workerCmd.NArg() < 1 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor worker [-workers <n>] [-grace <duration>] [-health <addr>] [-reload] [-roots <locations>] <queue-url>")
+			os.Exit(1)
+		}
+		loadServiceConfig()
+		health := &processor.Health{}
+		if *healthAddr != "" {
+			server := &http.Server{Addr: *healthAddr, Handler: health.Handler(), ReadHeaderTimeout: 10 * time.Second}
+			go func() {
+				if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					slog.Error(i18n.T("health endpoint failed"), "error", err)
+				}
+			}()
+			defer server.Close()
+		}
+		queue, err := processor.OpenQueue(workerCmd.Arg(0))
+		if err != nil {
+			handleError(err)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		if *reload {
+			go processor.WatchConfig(ctx, "config.yaml", processor.WatchOptions{Adjust: applyGlobalOptions})
+		}
+		err = processor.RunWorker(ctx, queue, processor.WorkerOptions{
+			Workers:     *workers,
+			GracePeriod: *grace,
+			Health:      health,
+			Roots:       strings.Split(*roots, ","),
+		})
+		stop()
+		queue.Close()
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("Worker stopped"))
+	case "gui":
+		runGUI()
+	case "serve":
+		serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+		addr := serveCmd.String("addr", "localhost:8080", i18n.T("Address to listen on"))
+		maxUpload := serveCmd.Int64("max-upload", 64<<20, i18n.T("Largest image accepted, in bytes"))
+		maxMemory := serveCmd.Int64("max-memory", 0, i18n.T("Most memory the images of a request may take, in bytes (default: no limit)"))
+		grace := serveCmd.Duration("grace", 25*time.Second, i18n.T("How long requests in progress may take to finish after SIGTERM"))
+		encryptKey := serveCmd.String("encrypt-key", processor.Default().Config().EncryptionKey, i18n.T("Encrypt the responses with AES-GCM, with the key read from env:NAME, file:PATH or cmd:COMMAND"))
+		if err := serveCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor serve [-addr <addr>] [-max-upload <bytes>] [-max-memory <bytes>] [-grace <duration>] [-encrypt-key <source>]")
+			os.Exit(1)
+		}
+		loadServiceConfig()
+		var encryption *processor.Encryption
+		if *encryptKey != "" {
+			var err error
+			if encryption, err = processor.LoadEncryption(*encryptKey); err != nil {
+				handleError(err)
+			}
+		}
+		health := &processor.Health{}
+		server := &http.Server{
+			Addr:    *addr,
+			Handler: processor.NewServer(processor.ServerOptions{MaxUploadSize: *maxUpload, MemoryBudget: *maxMemory, Health: health, Encryption: encryption}),
+			// Slow clients cannot hold connections open indefinitely
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       2 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		serveErr := make(chan error, 1)
+		go func() {
+			serveErr <- server.ListenAndServe()
+		}()
+		health.SetReady(true)
+		slog.Info(i18n.T("serving"), "addr", *addr, "operations", processor.ServerOperations())
+		select {
+		case err := <-serveErr:
+			stop()
+			handleError(&processor.ErrProcessing{Op: "serve", Err: err})
+		case <-ctx.Done():
+		}
+		stop()
+		health.Drain()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *grace)
+		err := server.Shutdown(shutdownCtx)
+		cancel()
+		if err != nil {
+			handleError(&processor.ErrProcessing{Op: "serve", Err: err})
+		}
+		fmt.Println(i18n.T("Server stopped"))
+	case "decrypt":
+		decryptCmd := flag.NewFlagSet("decrypt", flag.ExitOnError)
+		key := decryptCmd.String("key", processor.Default().Config().EncryptionKey, i18n.T("Where to read the key from: env:NAME, file:PATH or cmd:COMMAND"))
+		if err := decryptCmd.Parse(os.Args[2:]); err != nil || decryptCmd.NArg() != 2 || *key == "" {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor decrypt [-key <source>] <input.enc> <output>")
+			os.Exit(1)
+		}
+		encryption, err := processor.LoadEncryption(*key)
+		if err != nil {
+			handleError(err)
+		}
+		if err := encryption.DecryptFile(decryptCmd.Arg(0), decryptCmd.Arg(1)); err != nil {
+			handleError(err)
+		}
+		fmt.Println(i18n.T("File decrypted successfully"))
+	case "roiquality":
+		roiQualityCmd := flag.NewFlagSet("roiquality", flag.ExitOnError)
+		var regions boxList
+		roiQualityCmd.Var(&regions, "region", i18n.T("Keep the rectangle x,y,width,height at full quality (repeatable)"))
+		text := roiQualityCmd.Bool("text", false, i18n.T("Keep the detected text lines at full quality"))
+		margin := roiQualityCmd.Int("margin", 8, i18n.T("Pixels kept at full quality around every region"))
+		quality := roiQualityCmd.Int("quality", 0, i18n.T("JPEG quality of the regions, 1-100 (default: the configured quality)"))
+		background := roiQualityCmd.Int("background-quality", 30, i18n.T("JPEG quality of the rest of the image, 1-100"))
+		jsonOutput := roiQualityCmd.Bool("json", false, i18n.T("Print the regions kept and their coverage as JSON"))
+		if err := roiQualityCmd.Parse(os.Args[2:]); err != nil || roiQualityCmd.NArg() != 2 || (len(regions) == 0 && !*text) {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor roiquality [-region x,y,w,h]... [-text] [-margin <pixels>] [-quality <1-100>] [-background-quality <1-100>] [-json] <input> <output.jpg>")
+			os.Exit(1)
+		}
+		result, err := processor.RegionQualityImage(roiQualityCmd.Arg(0), roiQualityCmd.Arg(1), processor.RegionQualityOptions{
+			Regions:           regions,
+			Text:              *text,
+			Margin:            *margin,
+			Quality:           *quality,
+			BackgroundQuality: *background,
+		})
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(result)
+			break
+		}
+		fmt.Println(i18n.Sprintf("Image saved with %.1f%% at full quality", result.Coverage*100))
+	case "mrc":
+		mrcCmd := flag.NewFlagSet("mrc", flag.ExitOnError)
+		dpi := mrcCmd.Float64("dpi", 300, i18n.T("Resolution of the scans, which sets the page size"))
+		backgroundScale := mrcCmd.Int("background-scale", 3, i18n.T("Factor by which the background layer is reduced"))
+		foregroundScale := mrcCmd.Int("foreground-scale", 6, i18n.T("Factor by which the text color layer is reduced"))
+		quality := mrcCmd.Int("quality", 50, i18n.T("JPEG quality of the background and text color layers, 1-100"))
+		threshold := mrcCmd.Int("threshold", 0, i18n.T("Gray level at or below which a pixel is text (default: found with Otsu's method)"))
+		jsonOutput := mrcCmd.Bool("json", false, i18n.T("Print the sizes of the layers as JSON"))
+		if err := mrcCmd.Parse(os.Args[2:]); err != nil || mrcCmd.NArg() < 2 || *threshold < 0 || *threshold > 255 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor mrc [-dpi <dpi>] [-background-scale <factor>] [-foreground-scale <factor>] [-quality <1-100>] [-threshold <0-255>] [-json] <output.pdf> <input> [input...]")
+			os.Exit(1)
+		}
+		result, err := processor.MRCPDF(mrcCmd.Args()[1:], mrcCmd.Arg(0), processor.MRCOptions{
+			DPI:             *dpi,
+			BackgroundScale: *backgroundScale,
+			ForegroundScale: *foregroundScale,
+			Quality:         *quality,
+			Threshold:       uint8(*threshold),
+		})
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(result)
+			break
+		}
+		fmt.Println(i18n.Sprintf("PDF written: %d pages, %d bytes", len(result.Pages), result.Size))
+	case "crop":
+		cropCmd := flag.NewFlagSet("crop", flag.ExitOnError)
+		rect := cropCmd.String("rect", "", i18n.T("Rectangle to keep as x,y,width,height or WxH+X+Y"))
+		size := cropCmd.String("size", "", i18n.T("Size to keep as WxH, placed by -gravity"))
+		gravityFlag := cropCmd.String("gravity", "center", i18n.T("Part of the image -size keeps (center, north, south-east, ...)"))
+		if err := cropCmd.Parse(os.Args[2:]); err != nil || cropCmd.NArg() != 2 || (*rect == "") == (*size == "") {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor crop (-rect x,y,w,h | -size WxH [-gravity <gravity>]) <input> <output>")
+			os.Exit(1)
+		}
+		if *rect != "" {
+			box, err := processor.ParseBox(*rect)
+			if err != nil {
+				handleError(&processor.ErrProcessing{Op: "crop", Err: err})
+			}
+			if err := processor.CropImage(cropCmd.Arg(0), cropCmd.Arg(1), box.Rect()); err != nil {
+				handleError(err)
+			}
+		} else {
+			g, err := processor.ParseGeometry(*size)
+			if err != nil {
+				handleError(&processor.ErrProcessing{Op: "crop", Err: err})
+			}
+			if !g.IsSize() || g.HasOffset || g.Width.IsPhysical() || g.Height.IsPhysical() {
+				handleError(&processor.ErrProcessing{Op: "crop", Err: fmt.Errorf("-size needs a size in pixels, got %q", *size)})
+			}
+			gravity, err := processor.ParseGravity(*gravityFlag)
+			if err != nil {
+				handleError(&processor.ErrProcessing{Op: "crop", Err: err})
+			}
+			if err := processor.CropImageGravity(cropCmd.Arg(0), cropCmd.Arg(1), gravity, int(g.Width.Pixels(0)), int(g.Height.Pixels(0))); err != nil {
+				handleError(err)
+			}
+		}
+		fmt.Println(i18n.T("Image cropped successfully"))
+	case "inpaint":
+		inpaintCmd := flag.NewFlagSet("inpaint", flag.ExitOnError)
+		var regions boxList
+		inpaintCmd.Var(&regions, "region", i18n.T("Fill the rectangle x,y,width,height (repeatable)"))
+		maskPath := inpaintCmd.String("mask", "", i18n.T("Image of the same size whose light pixels are filled"))
+		detect := inpaintCmd.Bool("detect", false, i18n.T("Fill strongly colored marks such as stamps and pen"))
+		radius := inpaintCmd.Int("radius", 5, i18n.T("Radius of the neighborhood every pixel is filled from"))
+		jsonOutput := inpaintCmd.Bool("json", false, i18n.T("Print the number of pixels filled as JSON"))
+		if err := inpaintCmd.Parse(os.Args[2:]); err != nil || inpaintCmd.NArg() != 2 || (len(regions) == 0 && *maskPath == "" && !*detect) {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor inpaint [-region x,y,w,h]... [-mask <image>] [-detect] [-radius <pixels>] [-json] <input> <output>")
+			os.Exit(1)
+		}
+		opts := processor.InpaintOptions{Regions: regions, Detect: *detect, Radius: *radius}
+		if *maskPath != "" {
+			mask, err := processor.Open(*maskPath)
+			if err != nil {
+				handleError(err)
+			}
+			if opts.Mask, err = mask.Image(); err != nil {
+				handleError(err)
+			}
+		}
+		result, err := processor.InpaintImage(inpaintCmd.Arg(0), inpaintCmd.Arg(1), opts)
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(result)
+			break
+		}
+		fmt.Println(i18n.Sprintf("Image inpainted: %d pixels filled (%.1f%%)", result.Pixels, result.Coverage*100))
+	case "estimatedpi":
+		estimateCmd := flag.NewFlagSet("estimatedpi", flag.ExitOnError)
+		fontSize := estimateCmd.Float64("font-size", 11, i18n.T("Size in points assumed for the body text"))
+		jsonOutput := estimateCmd.Bool("json", false, i18n.T("Print the estimate and the measurements as JSON"))
+		if err := estimateCmd.Parse(os.Args[2:]); err != nil || estimateCmd.NArg() != 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor estimatedpi [-font-size <points>] [-json] <input> <output>")
+			os.Exit(1)
+		}
+		estimate, err := processor.EstimateDPIImage(estimateCmd.Arg(0), estimateCmd.Arg(1), processor.DPIEstimateOptions{FontSize: *fontSize})
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(estimate)
+			break
+		}
+		fmt.Println(i18n.Sprintf("Estimated resolution: %g DPI (%d lines measured)", estimate.DPI, estimate.Lines))
+		if estimate.Recorded > 0 && estimate.Recorded != estimate.DPI {
+			fmt.Println(i18n.Sprintf("The input recorded %g DPI", estimate.Recorded))
+		}
+	case "extend":
+		extendCmd := flag.NewFlagSet("extend", flag.ExitOnError)
+		border := extendCmd.Int("border", 0, i18n.T("Width in pixels of the border added to every side"))
+		top := extendCmd.Int("top", 0, i18n.T("Width in pixels of the border added to the top"))
+		right := extendCmd.Int("right", 0, i18n.T("Width in pixels of the border added to the right"))
+		bottom := extendCmd.Int("bottom", 0, i18n.T("Width in pixels of the border added to the bottom"))
+		left := extendCmd.Int("left", 0, i18n.T("Width in pixels of the border added to the left"))
+		aspect := extendCmd.String("aspect", "", i18n.T("Aspect ratio W:H to extend the canvas to"))
+		gravityFlag := extendCmd.String("gravity", "center", i18n.T("Where -aspect places the image on the canvas"))
+		backgroundFlag := extendCmd.String("background", "white", i18n.T("Color of the added area"))
+		if err := extendCmd.Parse(os.Args[2:]); err != nil || extendCmd.NArg() != 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor extend (-border <pixels> | -top/-right/-bottom/-left <pixels> | -aspect W:H [-gravity <gravity>]) [-background <color>] <input> <output>")
+			os.Exit(1)
+		}
+		if (*border == 0 && *top == 0 && *right == 0 && *bottom == 0 && *left == 0) == (*aspect == "") {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor extend (-border <pixels> | -top/-right/-bottom/-left <pixels> | -aspect W:H [-gravity <gravity>]) [-background <color>] <input> <output>")
+			os.Exit(1)
+		}
+		background, err := processor.ParseColor(*backgroundFlag)
+		if err != nil {
+			handleError(&processor.ErrProcessing{Op: "extend", Err: err})
+		}
+		if *aspect != "" {
+			g, err := processor.ParseGeometry(*aspect)
+			if err != nil || !g.IsAspect() {
+				handleError(&processor.ErrProcessing{Op: "extend", Err: fmt.Errorf("-aspect needs a ratio such as 16:9, got %q", *aspect)})
+			}
+			gravity, err := processor.ParseGravity(*gravityFlag)
+			if err != nil {
+				handleError(&processor.ErrProcessing{Op: "extend", Err: err})
+			}
+			err = processor.ExtendImage(extendCmd.Arg(0), extendCmd.Arg(1), g.AspectWidth, g.AspectHeight, gravity, background)
+			if err != nil {
+				handleError(err)
+			}
+		} else {
+			err := processor.PadImage(extendCmd.Arg(0), extendCmd.Arg(1), *border+*top, *border+*right, *border+*bottom, *border+*left, background)
+			if err != nil {
+				handleError(err)
+			}
+		}
+		fmt.Println(i18n.T("Image extended successfully"))
+	case "docdewarp":
+		docDewarpCmd := flag.NewFlagSet("docdewarp", flag.ExitOnError)
+		cornersFlag := docDewarpCmd.String("corners", "", i18n.T("Corners of the page clockwise from the top left, instead of detecting them"))
+		jsonOutput := docDewarpCmd.Bool("json", false, i18n.T("Print the corners of the page and the output size as JSON"))
+		if err := docDewarpCmd.Parse(os.Args[2:]); err != nil || docDewarpCmd.NArg() != 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor docdewarp [-corners x1,y1,x2,y2,x3,y3,x4,y4] [-json] <input> <output>")
+			os.Exit(1)
+		}
+		var opts processor.DocDewarpOptions
+		if *cornersFlag != "" {
+			corners, err := processor.ParseQuad(*cornersFlag)
+			if err != nil {
+				handleError(&processor.ErrProcessing{Op: "docdewarp", Err: err})
+			}
+			opts.Corners = &corners
+		}
+		result, err := processor.DocDewarpImage(docDewarpCmd.Arg(0), docDewarpCmd.Arg(1), opts)
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(result)
+			break
+		}
+		fmt.Println(i18n.Sprintf("Page straightened to %dx%d (corners %s)", result.Width, result.Height, result.Corners))
+	case "bookdewarp":
+		bookDewarpCmd := flag.NewFlagSet("bookdewarp", flag.ExitOnError)
+		strips := bookDewarpCmd.Int("strips", 24, i18n.T("Number of vertical strips the text lines are traced across"))
+		jsonOutput := bookDewarpCmd.Bool("json", false, i18n.T("Print the number of text lines and the largest shift as JSON"))
+		if err := bookDewarpCmd.Parse(os.Args[2:]); err != nil || bookDewarpCmd.NArg() != 2 {
+			fmt.Println(i18n.T("Usage:"), "go-image-processor bookdewarp [-strips 24] [-json] <input> <output>")
+			os.Exit(1)
+		}
+		result, err := processor.BookDewarpImage(bookDewarpCmd.Arg(0), bookDewarpCmd.Arg(1), processor.BookDewarpOptions{Strips: *strips})
+		if err != nil {
+			handleError(err)
+		}
+		if *jsonOutput {
+			printJSON(result)
+			break
+		}
+		fmt.Println(i18n.Sprintf("Page flattened from %d text lines (largest shift %.1f pixels)", result.Lines, result.MaxShift))
+	default:
+		if _, ok := processor.LookupOperation(os.Args[1]); ok {
+			runOperation(os.Args[1], os.Args[2:])
+			break
+		}
+		if pluginPath, err := processor.FindPlugin(os.Args[1]); err == nil {
+			runPlugin(pluginPath, os.Args[2:])
+			break
+		}
+		fmt.Println(i18n.Sprintf("Unknown command: %s", os.Args[1]))
 		printUsage()
 		os.Exit(1)
 	}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	processor "github.com/okamyuji/go-image-processor/pkg"
+)
+
+// progressWidth is the number of cells of a progress bar
+const progressWidth = 30
+
+// progressBar returns a ProgressFunc drawing a progress bar labeled label on
+// stderr, or nil when stderr is not a terminal, so redirected logs are not
+// cluttered with it
+func progressBar(label string) processor.ProgressFunc {
+	if info, err := os.Stderr.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return func(done, total int) {
+		filled := done * progressWidth / total
+		fmt.Fprintf(os.Stderr, "\r%s [%s%s] %3d%%", label,
+			strings.Repeat("#", filled), strings.Repeat(" ", progressWidth-filled), done*100/total)
+		if done == total {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
+	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -13,6 +18,108 @@ type Config struct {
 	DefaultHeight int `yaml:"default_height"`
 	DefaultAngle  int `yaml:"default_angle"`
 	JpegQuality   int `yaml:"jpeg_quality"`
+
+	// TempDir is where outputs are written before being renamed into place.
+	// Empty means the destination directory.
+	TempDir string `yaml:"tmp_dir"`
+	// Fsync syncs each output to disk before it is renamed into place
+	Fsync bool `yaml:"fsync"`
+	// Mmap memory-maps input files instead of reading them into memory,
+	// on platforms that support it
+	Mmap bool `yaml:"mmap"`
+	// Deterministic makes outputs bit-identical from run to run: generated
+	// images use a fixed seed and rows are processed in order on one
+	// goroutine
+	Deterministic bool `yaml:"deterministic"`
+	// EncryptionKey is where the key that encrypts batch and server outputs
+	// is read from: env:NAME, file:PATH or cmd:COMMAND. Empty leaves the
+	// outputs unencrypted.
+	EncryptionKey string `yaml:"encryption_key"`
+
+	// Webhooks are notified when a batch run finishes
+	Webhooks []Webhook `yaml:"webhooks"`
+	// Notify sends a summary of each batch run by email or to Slack
+	Notify Notify `yaml:"notify"`
+	// Tenants are the teams sharing a worker, told apart by the API key of
+	// their requests. When any are configured, requests without a known key
+	// are rejected.
+	Tenants []Tenant `yaml:"tenants"`
+}
+
+// Tenant holds the presets and limits of one team
+type Tenant struct {
+	Name   string `yaml:"name"`
+	APIKey string `yaml:"api_key"`
+	// Presets are named recipes the tenant's requests can use
+	Presets map[string]string `yaml:"presets"`
+	// PresetFiles are named recipes kept in files, relative to the config
+	// file; LoadConfig reads them into Presets
+	PresetFiles map[string]string `yaml:"preset_files"`
+	// MaxWidth and MaxHeight reject larger inputs; zero allows any size
+	MaxWidth  int `yaml:"max_width"`
+	MaxHeight int `yaml:"max_height"`
+	// Operations lists the recipe steps the tenant may use; empty allows all
+	Operations []string `yaml:"operations"`
+	// MaxQuality caps the JPEG quality of quality steps; zero leaves it alone
+	MaxQuality int `yaml:"max_quality"`
+	// Watermark, when set, is stamped on every output
+	Watermark *TenantWatermark `yaml:"watermark"`
+	// Root is the directory or sftp:// or dav:// URL the tenant's requests
+	// are confined to, inside the roots of the worker; relative locations
+	// are taken inside it. Empty confines them to the roots of the worker only.
+	Root string `yaml:"root"`
+}
+
+// TenantWatermark is the watermark policy of a tenant
+type TenantWatermark struct {
+	// Image is the path of the mark
+	Image string `yaml:"image"`
+	// Position is a gravity or "auto"; empty uses auto
+	Position string  `yaml:"position"`
+	Scale    float64 `yaml:"scale"`
+	Opacity  float64 `yaml:"opacity"`
+}
+
+// Notify configures the summaries sent when a batch run finishes
+type Notify struct {
+	Email *EmailNotifier `yaml:"email"`
+	Slack *SlackNotifier `yaml:"slack"`
+	// Thumbnails is how many output thumbnails are attached to emails;
+	// zero uses 4 and a negative value attaches none
+	Thumbnails int `yaml:"thumbnails"`
+	// MinDuration skips the summary of runs that finish sooner
+	MinDuration time.Duration `yaml:"min_duration"`
+}
+
+// EmailNotifier sends summaries through an SMTP server
+type EmailNotifier struct {
+	Host string `yaml:"host"`
+	// Port defaults to 587
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// SlackNotifier posts summaries to a Slack incoming webhook
+type SlackNotifier struct {
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+// Webhook is an endpoint that receives a JSON event when a job finishes
+type Webhook struct {
+	URL string `yaml:"url"`
+	// Secret signs each request with HMAC-SHA256; empty sends unsigned requests
+	Secret string `yaml:"secret"`
+	// Events limits the events sent (batch.completed, batch.failed); empty sends all
+	Events []string `yaml:"events"`
+	// Retries is how often a failed delivery is retried; zero uses 3 and a
+	// negative value disables retries
+	Retries int `yaml:"retries"`
+	// RetryDelay is the wait before the first retry, doubled for each
+	// further one; zero uses one second
+	RetryDelay time.Duration `yaml:"retry_delay"`
 }
 
 // LoadConfig reads the config file and returns a Config struct
@@ -27,22 +134,117 @@ func LoadConfig(filename string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := c.loadPresetFiles(filepath.Dir(filename)); err != nil {
+		return nil, err
+	}
 
 	return &c, nil
 }
 
+// PresetPaths returns the paths of the preset files the config names,
+// resolved against the directory of the config file
+func (c *Config) PresetPaths(dir string) []string {
+	var paths []string
+	for _, t := range c.Tenants {
+		for _, path := range t.PresetFiles {
+			paths = append(paths, resolvePath(dir, path))
+		}
+	}
+	return paths
+}
+
+// resolvePath resolves a path from the config file against dir, the
+// directory of the config file. On Windows, a path rooted without a drive,
+// such as \presets\a.recipe, is on the drive or share of dir, and a path with
+// a drive or share is used as it is.
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		return path
+	}
+	if path != "" && os.IsPathSeparator(path[0]) {
+		return filepath.VolumeName(dir) + path
+	}
+	return filepath.Join(dir, path)
+}
+
+// loadPresetFiles reads the preset files of every tenant into its presets
+func (c *Config) loadPresetFiles(dir string) error {
+	for i := range c.Tenants {
+		t := &c.Tenants[i]
+		for name, path := range t.PresetFiles {
+			path = resolvePath(dir, path)
+			source, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("tenant %s: preset %s: %w", t.Name, name, err)
+			}
+			if t.Presets == nil {
+				t.Presets = map[string]string{}
+			}
+			t.Presets[name] = string(source)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the values are usable.
+// Returns every problem found, joined.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.DefaultWidth < 0 || c.DefaultHeight < 0 {
+		errs = append(errs, fmt.Errorf("default size %dx%d is negative", c.DefaultWidth, c.DefaultHeight))
+	}
+	if c.JpegQuality < 0 || c.JpegQuality > 100 {
+		errs = append(errs, fmt.Errorf("jpeg_quality %d is not between 0 and 100", c.JpegQuality))
+	}
+	for _, w := range c.Webhooks {
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, fmt.Errorf("webhook URL %q is not an HTTP URL", w.URL))
+		}
+	}
+	if e := c.Notify.Email; e != nil && (e.Host == "" || e.From == "" || len(e.To) == 0) {
+		errs = append(errs, errors.New("email notifier needs host, from and to"))
+	}
+	if s := c.Notify.Slack; s != nil && s.WebhookURL == "" {
+		errs = append(errs, errors.New("slack notifier needs webhook_url"))
+	}
+	keys := map[string]bool{}
+	for _, t := range c.Tenants {
+		switch {
+		case t.Name == "":
+			errs = append(errs, errors.New("tenant without a name"))
+		case t.APIKey == "":
+			errs = append(errs, fmt.Errorf("tenant %s has no api_key", t.Name))
+		case keys[t.APIKey]:
+			errs = append(errs, fmt.Errorf("tenant %s shares its api_key with another tenant", t.Name))
+		}
+		keys[t.APIKey] = true
+		if t.MaxWidth < 0 || t.MaxHeight < 0 || t.MaxQuality < 0 || t.MaxQuality > 100 {
+			errs = append(errs, fmt.Errorf("tenant %s has invalid limits", t.Name))
+		}
+		if t.Watermark != nil && t.Watermark.Image == "" {
+			errs = append(errs, fmt.Errorf("tenant %s has a watermark without an image", t.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // GetConfig loads the configuration or returns default values
 func GetConfig() *Config {
 	config, err := LoadConfig("config.yaml")
 	if err != nil {
 		slog.Warn("error loading config file, using default values",
 			"error", err)
-		return &Config{
-			DefaultWidth:  800,
-			DefaultHeight: 600,
-			DefaultAngle:  90,
-			JpegQuality:   75,
-		}
+		return Default()
 	}
 	return config
 }
+
+// Default returns the configuration used when config.yaml cannot be loaded
+func Default() *Config {
+	return &Config{
+		DefaultWidth:  800,
+		DefaultHeight: 600,
+		DefaultAngle:  90,
+		JpegQuality:   75,
+	}
+}
@@ -0,0 +1,311 @@
+// Package gui is the graphical user interface of the image processor, run by
+// the gui command of binaries built with the gui build tag. It processes
+// images in the same process, with the recipes of the processor package.
+package gui
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/app"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+	"github.com/okamyuji/go-image-processor/gui/widgets"
+	processor "github.com/okamyuji/go-image-processor/pkg"
+)
+
+// Keyboard shortcuts, with Control or Command depending on the platform
+var (
+	shortcutOpen    = &desktop.CustomShortcut{KeyName: fyne.KeyO, Modifier: fyne.KeyModifierShortcutDefault}
+	shortcutSave    = &desktop.CustomShortcut{KeyName: fyne.KeyS, Modifier: fyne.KeyModifierShortcutDefault}
+	shortcutProcess = &desktop.CustomShortcut{KeyName: fyne.KeyReturn, Modifier: fyne.KeyModifierShortcutDefault}
+	shortcutUndo    = &desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierShortcutDefault}
+	shortcutRedo    = &desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierShortcutDefault | fyne.KeyModifierShift}
+)
+
+// Run opens the image processor window and returns when it is closed
+func Run() {
+	// The ID gives the app a preferences store, which keeps the appearance
+	a := app.NewWithID("com.github.okamyuji.go-image-processor")
+	a.Settings().SetTheme(newAppTheme(a.Preferences()))
+	w := a.NewWindow("Image Processor")
+
+	inputEntry := widget.NewEntry()
+	inputEntry.SetPlaceHolder("Input file path")
+
+	outputEntry := widget.NewEntry()
+	outputEntry.SetPlaceHolder("Output file path")
+
+	paramForm := widgets.NewParamForm(widgets.Operation{})
+	operationSelect := widget.NewSelect(widgets.OperationNames(widgets.Operations), func(value string) {
+		op, _ := widgets.LookupOperation(widgets.Operations, value)
+		paramForm.SetOperation(op)
+	})
+	operationSelect.PlaceHolder = "Select an operation"
+
+	// The pipeline tab runs several operations at once, as a recipe
+	builder := widgets.NewPipelineBuilder(widgets.Operations)
+	operationTab := container.NewTabItem("Operation", container.NewVBox(
+		widget.NewForm(&widget.FormItem{Text: "Operation", Widget: operationSelect, HintText: "What to do with the image"}),
+		paramForm,
+	))
+	pipelineTab := container.NewTabItem("Pipeline", builder)
+	tabs := container.NewAppTabs(operationTab, pipelineTab)
+
+	// The preview and histogram show the input when it is chosen and the
+	// output after every step
+	preview := widgets.NewPreview()
+	histogram := widgets.NewHistogram()
+	showImage := func(path string) {
+		img := loadPreview(path)
+		preview.SetImage(img)
+		histogram.SetImage(img)
+	}
+
+	// The status line repeats the outcome of every action as text, so it can
+	// be read without the dialogs
+	status := widget.NewLabel("Ready")
+	status.Wrapping = fyne.TextWrapWord
+	builder.OnError = func(err error) { showError(err, status, w) }
+	builder.OnChanged = func() {
+		status.SetText(fmt.Sprintf("The pipeline has %d steps", len(builder.Steps())))
+	}
+
+	// Chaining applies the next operation to the result of the previous
+	// ones, so a series of steps can be built up and stepped through
+	chainCheck := widget.NewCheck("Apply to the current result", nil)
+
+	// Recipes run in the background, so the window stays responsive while
+	// the progress bar follows the slow steps; busy keeps a second run from
+	// starting meanwhile
+	progress := widget.NewProgressBar()
+	progress.Hide()
+	var busy atomic.Bool
+
+	var steps history
+	process := func() {
+		if busy.Load() {
+			status.SetText("Still processing the previous image")
+			return
+		}
+		input := inputEntry.Text
+		output := outputEntry.Text
+		pipeline := tabs.Selected() == pipelineTab
+
+		if (!pipeline && operationSelect.Selected == "") || input == "" || output == "" {
+			showError(fmt.Errorf("please fill in all required fields"), status, w)
+			return
+		}
+		// Single operations run as one-step recipes, pipelines as the recipe
+		// the builder assembled
+		var operation, source string
+		if pipeline {
+			pipelineSteps := builder.Steps()
+			if len(pipelineSteps) == 0 {
+				showError(fmt.Errorf("please add a step to the pipeline"), status, w)
+				return
+			}
+			names := make([]string, len(pipelineSteps))
+			for i, step := range pipelineSteps {
+				names[i] = step.Operation.Name
+			}
+			operation = strings.Join(names, ", ")
+			source = builder.Recipe()
+		} else {
+			step, err := paramForm.Step()
+			if err != nil {
+				showError(err, status, w)
+				return
+			}
+			operation = step.Operation.Name
+			source = step.String()
+		}
+		recipe, err := processor.ParseRecipe(source)
+		if err != nil {
+			showError(err, status, w)
+			return
+		}
+		if err := steps.begin(output); err != nil {
+			showError(fmt.Errorf("cannot read the output file: %v", err), status, w)
+			return
+		}
+		if chainCheck.Checked && steps.steps() > 0 {
+			input = output
+		}
+
+		busy.Store(true)
+		progress.SetValue(0)
+		progress.Show()
+		status.SetText(fmt.Sprintf("Processing %s with %s", filepath.Base(input), operation))
+		go func() {
+			defer func() {
+				progress.Hide()
+				busy.Store(false)
+			}()
+			_, err := recipe.RunWithOptions(input, output, processor.RecipeOptions{
+				Progress: func(done, total int) {
+					progress.SetValue(float64(done) / float64(total))
+				},
+			})
+			if err != nil {
+				showError(fmt.Errorf("error processing image: %v", err), status, w)
+				return
+			}
+			if err := steps.commit(operation); err != nil {
+				showError(fmt.Errorf("cannot read the output file: %v", err), status, w)
+				return
+			}
+
+			showImage(output)
+			status.SetText(fmt.Sprintf("Processed %s with %s into %s (step %d)", filepath.Base(input), operation, filepath.Base(output), steps.steps()))
+			dialog.ShowInformation("Success", "Image processed successfully", w)
+		}()
+	}
+
+	undo := func() {
+		if busy.Load() {
+			return
+		}
+		if !steps.canUndo() {
+			status.SetText("Nothing to undo")
+			return
+		}
+		label, err := steps.undo()
+		if err != nil {
+			showError(fmt.Errorf("cannot undo: %v", err), status, w)
+			return
+		}
+		showImage(steps.path)
+		status.SetText(fmt.Sprintf("Undid %s, %s is at step %d", label, filepath.Base(steps.path), steps.steps()))
+	}
+
+	redo := func() {
+		if busy.Load() {
+			return
+		}
+		if !steps.canRedo() {
+			status.SetText("Nothing to redo")
+			return
+		}
+		label, err := steps.redo()
+		if err != nil {
+			showError(fmt.Errorf("cannot redo: %v", err), status, w)
+			return
+		}
+		showImage(steps.path)
+		status.SetText(fmt.Sprintf("Redid %s, %s is at step %d", label, filepath.Base(steps.path), steps.steps()))
+	}
+
+	open := func() {
+		dialog.ShowFileOpen(func(file fyne.URIReadCloser, err error) {
+			if err != nil || file == nil {
+				return
+			}
+			file.Close()
+			path := filepath.FromSlash(file.URI().Path())
+			inputEntry.SetText(path)
+			showImage(path)
+			status.SetText("Input: " + path)
+			w.Canvas().Focus(outputEntry)
+		}, w)
+	}
+
+	save := func() {
+		dialog.ShowFileSave(func(file fyne.URIWriteCloser, err error) {
+			if err != nil || file == nil {
+				return
+			}
+			file.Close()
+			path := filepath.FromSlash(file.URI().Path())
+			outputEntry.SetText(path)
+			status.SetText("Output: " + path)
+		}, w)
+	}
+
+	// Enter in any field processes, as the Process button does
+	for _, entry := range []*widget.Entry{inputEntry, outputEntry} {
+		entry.OnSubmitted = func(string) { process() }
+	}
+	paramForm.OnSubmitted = process
+
+	processButton := widget.NewButton("Process", process)
+	processButton.Importance = widget.HighImportance
+
+	for shortcut, action := range map[*desktop.CustomShortcut]func(){
+		shortcutOpen:    open,
+		shortcutSave:    save,
+		shortcutProcess: process,
+		shortcutUndo:    undo,
+		shortcutRedo:    redo,
+	} {
+		w.Canvas().AddShortcut(shortcut, func(fyne.Shortcut) { action() })
+	}
+	openItem := fyne.NewMenuItem("Open Input...", open)
+	openItem.Shortcut = shortcutOpen
+	saveItem := fyne.NewMenuItem("Choose Output...", save)
+	saveItem.Shortcut = shortcutSave
+	processItem := fyne.NewMenuItem("Process", process)
+	processItem.Shortcut = shortcutProcess
+	undoItem := fyne.NewMenuItem("Undo Processing", undo)
+	undoItem.Shortcut = shortcutUndo
+	redoItem := fyne.NewMenuItem("Redo Processing", redo)
+	redoItem.Shortcut = shortcutRedo
+	w.SetMainMenu(fyne.NewMainMenu(
+		fyne.NewMenu("File", openItem, saveItem),
+		fyne.NewMenu("Edit", processItem, undoItem, redoItem),
+		fyne.NewMenu("View",
+			fyne.NewMenuItem("Appearance...", func() { showAppearance(a, w) }),
+		),
+	))
+
+	// Tab moves through the fields in the order they are shown. Fyne does not
+	// expose widgets to screen readers yet, so every field has a visible label
+	// and a hint describing it.
+	form := widget.NewForm(
+		&widget.FormItem{Text: "Input file", Widget: inputEntry, HintText: "Image to process (Ctrl+O to browse)"},
+		&widget.FormItem{Text: "Output file", Widget: outputEntry, HintText: "Where to write the result (Ctrl+S to browse)"},
+	)
+
+	controls := container.NewBorder(
+		form,
+		container.NewVBox(chainCheck, processButton, progress, status),
+		nil, nil,
+		tabs,
+	)
+	content := container.NewHSplit(controls, container.NewBorder(nil, histogram, nil, nil, preview))
+
+	w.SetContent(content)
+	w.Resize(fyne.NewSize(800, 500))
+	w.Canvas().Focus(operationSelect)
+	w.ShowAndRun()
+}
+
+// showError reports an error in a dialog and on the status line
+func showError(err error, status *widget.Label, w fyne.Window) {
+	status.SetText("Error: " + err.Error())
+	dialog.ShowError(err, w)
+}
+
+// loadPreview decodes the image at path for the preview, or returns nil if
+// it cannot be read
+func loadPreview(path string) image.Image {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil
+	}
+	return img
+}
@@ -0,0 +1,118 @@
+package gui
+
+import (
+	"errors"
+	"os"
+)
+
+// outputVersion is the content of the output file after a processing step
+type outputVersion struct {
+	// label names the operation that produced the version
+	label   string
+	data    []byte
+	existed bool
+}
+
+// history keeps every version of the output file, so processing steps can be
+// undone and redone before the result is used. The first version is the file
+// as it was before the first step.
+type history struct {
+	path     string
+	versions []outputVersion
+	current  int
+}
+
+// readVersion reads the output file as it is now
+func readVersion(path string, label string) (outputVersion, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return outputVersion{label: label}, nil
+	}
+	if err != nil {
+		return outputVersion{}, err
+	}
+	return outputVersion{label: label, data: data, existed: true}, nil
+}
+
+// begin starts a processing step on path. A different output path starts a
+// new history with the file as it is now.
+func (h *history) begin(path string) error {
+	if h.path == path && len(h.versions) > 0 {
+		return nil
+	}
+	original, err := readVersion(path, "original")
+	if err != nil {
+		return err
+	}
+	*h = history{path: path, versions: []outputVersion{original}}
+	return nil
+}
+
+// commit records the output file after a successful step. Versions that were
+// undone are dropped, as in an editor.
+func (h *history) commit(label string) error {
+	version, err := readVersion(h.path, label)
+	if err != nil {
+		return err
+	}
+	h.versions = append(h.versions[:h.current+1], version)
+	h.current++
+	return nil
+}
+
+// steps returns the number of processing steps that are applied
+func (h *history) steps() int {
+	return h.current
+}
+
+func (h *history) canUndo() bool {
+	return h.current > 0
+}
+
+func (h *history) canRedo() bool {
+	return h.current < len(h.versions)-1
+}
+
+// undo restores the version before the current one and returns the label of
+// the step that was undone
+func (h *history) undo() (string, error) {
+	if !h.canUndo() {
+		return "", errors.New("nothing to undo")
+	}
+	label := h.versions[h.current].label
+	if err := h.restore(h.current - 1); err != nil {
+		return "", err
+	}
+	return label, nil
+}
+
+// redo restores the version after the current one and returns the label of
+// the step that was redone
+func (h *history) redo() (string, error) {
+	if !h.canRedo() {
+		return "", errors.New("nothing to redo")
+	}
+	if err := h.restore(h.current + 1); err != nil {
+		return "", err
+	}
+	return h.versions[h.current].label, nil
+}
+
+// restore writes version i to the output file and makes it the current one
+func (h *history) restore(i int) error {
+	version := h.versions[i]
+	var err error
+	if version.existed {
+		err = os.WriteFile(h.path, version.data, 0644)
+	} else {
+		err = os.Remove(h.path)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	h.current = i
+	return nil
+}
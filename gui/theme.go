@@ -0,0 +1,107 @@
+package gui
+
+import (
+	"image/color"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Preference keys of the appearance settings
+const (
+	prefTheme   = "theme"
+	prefDensity = "density"
+)
+
+// Theme modes: follow the system, or force a variant
+const (
+	themeSystem = "system"
+	themeLight  = "light"
+	themeDark   = "dark"
+)
+
+// densityScales are the spacing factors of the UI densities
+var densityScales = map[string]float32{
+	"compact":     0.6,
+	"normal":      1,
+	"comfortable": 1.5,
+}
+
+// appTheme is the default Fyne theme with a forced light or dark variant
+// and scaled spacing
+type appTheme struct {
+	mode    string
+	density string
+}
+
+// newAppTheme returns the theme stored in the preferences
+func newAppTheme(prefs fyne.Preferences) *appTheme {
+	return &appTheme{
+		mode:    prefs.StringWithFallback(prefTheme, themeSystem),
+		density: prefs.StringWithFallback(prefDensity, "normal"),
+	}
+}
+
+func (t *appTheme) Color(name fyne.ThemeColorName, variant fyne.ThemeVariant) color.Color {
+	switch t.mode {
+	case themeLight:
+		variant = theme.VariantLight
+	case themeDark:
+		variant = theme.VariantDark
+	}
+	return theme.DefaultTheme().Color(name, variant)
+}
+
+func (t *appTheme) Font(style fyne.TextStyle) fyne.Resource {
+	return theme.DefaultTheme().Font(style)
+}
+
+func (t *appTheme) Icon(name fyne.ThemeIconName) fyne.Resource {
+	return theme.DefaultTheme().Icon(name)
+}
+
+func (t *appTheme) Size(name fyne.ThemeSizeName) float32 {
+	size := theme.DefaultTheme().Size(name)
+	switch name {
+	case theme.SizeNamePadding, theme.SizeNameInnerPadding, theme.SizeNameLineSpacing:
+		if scale, ok := densityScales[t.density]; ok {
+			return size * scale
+		}
+	}
+	return size
+}
+
+// showAppearance opens the dialog that changes the theme and density. Changes
+// apply at once and are saved in the preferences.
+func showAppearance(a fyne.App, w fyne.Window) {
+	prefs := a.Preferences()
+	apply := func() {
+		a.Settings().SetTheme(newAppTheme(prefs))
+	}
+
+	modes := widget.NewRadioGroup([]string{themeSystem, themeLight, themeDark}, func(mode string) {
+		if mode == "" {
+			return
+		}
+		prefs.SetString(prefTheme, mode)
+		apply()
+	})
+	modes.Horizontal = true
+	modes.SetSelected(prefs.StringWithFallback(prefTheme, themeSystem))
+
+	density := widget.NewSelect([]string{"compact", "normal", "comfortable"}, func(value string) {
+		prefs.SetString(prefDensity, value)
+		apply()
+	})
+	density.SetSelected(prefs.StringWithFallback(prefDensity, "normal"))
+
+	dialog.ShowCustom("Appearance", "Close", container.NewVBox(
+		widget.NewLabel("Theme:"),
+		modes,
+		widget.NewLabel("Density:"),
+		density,
+	), w)
+}
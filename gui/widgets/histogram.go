@@ -0,0 +1,81 @@
+package widgets
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Histogram shows how the brightness of an image is distributed, as one bar
+// per gray level from black on the left to white on the right
+type Histogram struct {
+	widget.BaseWidget
+
+	bins   [256]int
+	raster *canvas.Raster
+}
+
+// NewHistogram creates a histogram of no image
+func NewHistogram() *Histogram {
+	h := &Histogram{}
+	h.raster = canvas.NewRaster(h.draw)
+	h.raster.SetMinSize(fyne.NewSize(256, 80))
+	h.ExtendBaseWidget(h)
+	return h
+}
+
+// SetImage shows the histogram of img, or an empty one if img is nil
+func (h *Histogram) SetImage(img image.Image) {
+	if img == nil {
+		h.bins = [256]int{}
+	} else {
+		h.bins = LuminanceHistogram(img)
+	}
+	h.raster.Refresh()
+}
+
+// Bins returns the number of pixels at each gray level
+func (h *Histogram) Bins() [256]int {
+	return h.bins
+}
+
+// draw renders the bars at the given size, scaled to the fullest bin
+func (h *Histogram) draw(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	peak := 0
+	for _, n := range h.bins {
+		peak = max(peak, n)
+	}
+	if peak == 0 || width == 0 {
+		return img
+	}
+	bar := image.NewUniform(theme.Color(theme.ColorNameForeground))
+	for x := 0; x < width; x++ {
+		n := h.bins[x*len(h.bins)/width]
+		top := height - n*height/peak
+		draw.Draw(img, image.Rect(x, top, x+1, height), bar, image.Point{}, draw.Src)
+	}
+	return img
+}
+
+// CreateRenderer implements fyne.Widget
+func (h *Histogram) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(h.raster)
+}
+
+// LuminanceHistogram counts the pixels of img at each gray level
+func LuminanceHistogram(img image.Image) [256]int {
+	var bins [256]int
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			bins[color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y]++
+		}
+	}
+	return bins
+}
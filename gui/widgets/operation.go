@@ -0,0 +1,117 @@
+// Package widgets provides the Fyne widgets of the image processor GUI, so
+// other Fyne applications can embed them: an image preview, a brightness
+// histogram, a parameter form for the operations and a pipeline builder that
+// assembles operations into a recipe.
+//
+// The widgets only describe and show processing; running an operation is up
+// to the application, for example by passing Step.Args to the command line
+// tool or PipelineBuilder.Recipe to its recipe command.
+package widgets
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Param is a parameter of an operation, passed as the command line flag of
+// the same name
+type Param struct {
+	// Name is the flag name, such as "width"
+	Name string
+	// Label is shown next to the field
+	Label string
+	// Hint describes the parameter below the field
+	Hint string
+	// Optional parameters may be left empty
+	Optional bool
+}
+
+// Operation is a processing operation with the parameters it asks for
+type Operation struct {
+	Name   string
+	Params []Param
+}
+
+// Operations are the operations offered by the GUI, in the order they are
+// listed
+var Operations = []Operation{
+	{Name: "resize", Params: []Param{
+		{Name: "width", Label: "Width", Hint: "New width in pixels"},
+		{Name: "height", Label: "Height", Hint: "New height in pixels"},
+	}},
+	{Name: "rotate", Params: []Param{
+		{Name: "angle", Label: "Angle", Hint: "Degrees clockwise"},
+	}},
+	{Name: "denoise"},
+	{Name: "binarize"},
+	{Name: "edges"},
+	{Name: "autorotate"},
+}
+
+// OperationNames returns the names of operations, in order
+func OperationNames(operations []Operation) []string {
+	names := make([]string, len(operations))
+	for i, op := range operations {
+		names[i] = op.Name
+	}
+	return names
+}
+
+// LookupOperation finds the operation with the given name
+func LookupOperation(operations []Operation, name string) (Operation, bool) {
+	for _, op := range operations {
+		if op.Name == name {
+			return op, true
+		}
+	}
+	return Operation{}, false
+}
+
+// Step is an operation with the values of its parameters, in the order of
+// Operation.Params. Optional parameters that are not set are empty.
+type Step struct {
+	Operation Operation
+	Values    []string
+}
+
+// NewStep checks that every required parameter of op has a value and returns
+// the step
+func NewStep(op Operation, values []string) (Step, error) {
+	if len(values) != len(op.Params) {
+		return Step{}, fmt.Errorf("%s takes %d parameters, got %d", op.Name, len(op.Params), len(values))
+	}
+	var missing []string
+	for i, param := range op.Params {
+		values[i] = strings.TrimSpace(values[i])
+		if values[i] == "" && !param.Optional {
+			missing = append(missing, param.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return Step{}, fmt.Errorf("please specify %s for %s operation", strings.Join(missing, " and "), op.Name)
+	}
+	return Step{Operation: op, Values: values}, nil
+}
+
+// Args returns the command line flags of the step, which follow the input
+// and output paths
+func (s Step) Args() []string {
+	var args []string
+	for i, param := range s.Operation.Params {
+		if s.Values[i] != "" {
+			args = append(args, "-"+param.Name, s.Values[i])
+		}
+	}
+	return args
+}
+
+// String returns the step as a recipe line, such as "resize 800 600"
+func (s Step) String() string {
+	fields := []string{s.Operation.Name}
+	for _, value := range s.Values {
+		if value != "" {
+			fields = append(fields, value)
+		}
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,103 @@
+package widgets
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ParamForm asks for the parameters of one operation, with a labeled field
+// and a hint for each. Values are kept per parameter name while the
+// operation changes, so switching between operations that share a parameter
+// does not lose it.
+type ParamForm struct {
+	widget.BaseWidget
+
+	// OnSubmitted is called when Enter is pressed in a field
+	OnSubmitted func()
+
+	operation Operation
+	entries   map[string]*widget.Entry
+	content   *fyne.Container
+}
+
+// NewParamForm creates a form for the parameters of op
+func NewParamForm(op Operation) *ParamForm {
+	f := &ParamForm{
+		entries: make(map[string]*widget.Entry),
+		content: container.NewVBox(),
+	}
+	f.ExtendBaseWidget(f)
+	f.SetOperation(op)
+	return f
+}
+
+// Operation returns the operation the form asks for
+func (f *ParamForm) Operation() Operation {
+	return f.operation
+}
+
+// SetOperation shows the fields of the parameters of op. An operation
+// without parameters shows no fields.
+func (f *ParamForm) SetOperation(op Operation) {
+	f.operation = op
+	f.content.Objects = nil
+	if len(op.Params) > 0 {
+		form := widget.NewForm()
+		for _, param := range op.Params {
+			form.Append(param.Label, f.entry(param.Name))
+			form.Items[len(form.Items)-1].HintText = param.Hint
+		}
+		f.content.Objects = []fyne.CanvasObject{form}
+	}
+	f.content.Refresh()
+}
+
+// entry returns the field of the parameter name, creating it the first time
+func (f *ParamForm) entry(name string) *widget.Entry {
+	entry, ok := f.entries[name]
+	if !ok {
+		entry = widget.NewEntry()
+		entry.OnSubmitted = func(string) {
+			if f.OnSubmitted != nil {
+				f.OnSubmitted()
+			}
+		}
+		f.entries[name] = entry
+	}
+	return entry
+}
+
+// Entries returns the fields of the current operation, in order
+func (f *ParamForm) Entries() []*widget.Entry {
+	entries := make([]*widget.Entry, len(f.operation.Params))
+	for i, param := range f.operation.Params {
+		entries[i] = f.entry(param.Name)
+	}
+	return entries
+}
+
+// SetValues fills in the fields of the current operation, in order
+func (f *ParamForm) SetValues(values []string) {
+	for i, entry := range f.Entries() {
+		if i < len(values) {
+			entry.SetText(values[i])
+		}
+	}
+}
+
+// Step returns the operation with the values entered, or an error naming
+// the required parameters that are empty
+func (f *ParamForm) Step() (Step, error) {
+	entries := f.Entries()
+	values := make([]string, len(entries))
+	for i, entry := range entries {
+		values[i] = entry.Text
+	}
+	return NewStep(f.operation, values)
+}
+
+// CreateRenderer implements fyne.Widget
+func (f *ParamForm) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(f.content)
+}
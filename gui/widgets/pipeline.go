@@ -0,0 +1,154 @@
+package widgets
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// PipelineBuilder assembles a sequence of operations. Steps are added with an
+// operation selector and a parameter form, listed in the order they run, and
+// can be selected to move them up or down or remove them.
+type PipelineBuilder struct {
+	widget.BaseWidget
+
+	// OnChanged is called after steps are added, moved or removed
+	OnChanged func()
+	// OnError is called when a step cannot be added, for example because a
+	// required parameter is empty
+	OnError func(error)
+
+	operations []Operation
+	steps      []Step
+	selected   int
+
+	operationSelect *widget.Select
+	form            *ParamForm
+	list            *widget.List
+}
+
+// NewPipelineBuilder creates an empty pipeline of the given operations
+func NewPipelineBuilder(operations []Operation) *PipelineBuilder {
+	b := &PipelineBuilder{operations: operations, selected: -1}
+	b.form = NewParamForm(Operation{})
+	b.form.OnSubmitted = b.addFromForm
+	b.operationSelect = widget.NewSelect(OperationNames(operations), func(name string) {
+		op, _ := LookupOperation(b.operations, name)
+		b.form.SetOperation(op)
+	})
+	b.operationSelect.PlaceHolder = "Select an operation"
+	b.list = widget.NewList(
+		func() int { return len(b.steps) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(fmt.Sprintf("%d. %s", id+1, b.steps[id]))
+		},
+	)
+	b.list.OnSelected = func(id widget.ListItemID) { b.selected = id }
+	b.list.OnUnselected = func(widget.ListItemID) { b.selected = -1 }
+	b.ExtendBaseWidget(b)
+	return b
+}
+
+// Steps returns the steps in the order they run
+func (b *PipelineBuilder) Steps() []Step {
+	return append([]Step(nil), b.steps...)
+}
+
+// SetSteps replaces the steps
+func (b *PipelineBuilder) SetSteps(steps []Step) {
+	b.steps = append([]Step(nil), steps...)
+	b.changed(-1)
+}
+
+// AddStep appends a step to the end of the pipeline
+func (b *PipelineBuilder) AddStep(step Step) {
+	b.steps = append(b.steps, step)
+	b.changed(len(b.steps) - 1)
+}
+
+// RemoveStep removes step i
+func (b *PipelineBuilder) RemoveStep(i int) {
+	if i < 0 || i >= len(b.steps) {
+		return
+	}
+	b.steps = append(b.steps[:i], b.steps[i+1:]...)
+	b.changed(min(i, len(b.steps)-1))
+}
+
+// MoveStep moves step i to position j
+func (b *PipelineBuilder) MoveStep(i, j int) {
+	if i < 0 || i >= len(b.steps) || j < 0 || j >= len(b.steps) {
+		return
+	}
+	step := b.steps[i]
+	b.steps = append(b.steps[:i], b.steps[i+1:]...)
+	b.steps = append(b.steps[:j], append([]Step{step}, b.steps[j:]...)...)
+	b.changed(j)
+}
+
+// Recipe returns the steps as a recipe, one step per line, for the recipe
+// command
+func (b *PipelineBuilder) Recipe() string {
+	var sb strings.Builder
+	for _, step := range b.steps {
+		sb.WriteString(step.String())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// addFromForm adds the operation and parameters entered in the form
+func (b *PipelineBuilder) addFromForm() {
+	if b.operationSelect.Selected == "" {
+		b.fail(fmt.Errorf("please select an operation to add"))
+		return
+	}
+	step, err := b.form.Step()
+	if err != nil {
+		b.fail(err)
+		return
+	}
+	b.AddStep(step)
+}
+
+// fail reports err to OnError
+func (b *PipelineBuilder) fail(err error) {
+	if b.OnError != nil {
+		b.OnError(err)
+	}
+}
+
+// changed refreshes the list with step i selected, or none if i is -1, and
+// reports the change
+func (b *PipelineBuilder) changed(i int) {
+	b.list.Refresh()
+	if i >= 0 {
+		b.list.Select(i)
+	} else {
+		b.list.UnselectAll()
+	}
+	if b.OnChanged != nil {
+		b.OnChanged()
+	}
+}
+
+// CreateRenderer implements fyne.Widget
+func (b *PipelineBuilder) CreateRenderer() fyne.WidgetRenderer {
+	addButton := widget.NewButtonWithIcon("Add Step", theme.ContentAddIcon(), b.addFromForm)
+	upButton := widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() { b.MoveStep(b.selected, b.selected-1) })
+	downButton := widget.NewButtonWithIcon("", theme.MoveDownIcon(), func() { b.MoveStep(b.selected, b.selected+1) })
+	removeButton := widget.NewButtonWithIcon("", theme.ContentRemoveIcon(), func() { b.RemoveStep(b.selected) })
+
+	top := container.NewVBox(
+		widget.NewForm(&widget.FormItem{Text: "Operation", Widget: b.operationSelect, HintText: "Operation of the next step"}),
+		b.form,
+		addButton,
+	)
+	bottom := container.NewHBox(upButton, downButton, removeButton)
+	return widget.NewSimpleRenderer(container.NewBorder(top, bottom, nil, nil, b.list))
+}
@@ -0,0 +1,56 @@
+package widgets
+
+import (
+	"fmt"
+	"image"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Preview shows an image scaled to fit the space it is given, with its size
+// in pixels below it
+type Preview struct {
+	widget.BaseWidget
+
+	img    image.Image
+	canvas *canvas.Image
+	info   *widget.Label
+}
+
+// NewPreview creates a preview that shows no image
+func NewPreview() *Preview {
+	p := &Preview{
+		canvas: canvas.NewImageFromImage(nil),
+		info:   widget.NewLabel("No image"),
+	}
+	p.canvas.FillMode = canvas.ImageFillContain
+	p.canvas.SetMinSize(fyne.NewSize(200, 150))
+	p.ExtendBaseWidget(p)
+	return p
+}
+
+// Image returns the image shown, or nil
+func (p *Preview) Image() image.Image {
+	return p.img
+}
+
+// SetImage shows img, or nothing if img is nil
+func (p *Preview) SetImage(img image.Image) {
+	p.img = img
+	p.canvas.Image = img
+	p.canvas.Refresh()
+	if img == nil {
+		p.info.SetText("No image")
+		return
+	}
+	b := img.Bounds()
+	p.info.SetText(fmt.Sprintf("%d x %d pixels", b.Dx(), b.Dy()))
+}
+
+// CreateRenderer implements fyne.Widget
+func (p *Preview) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(container.NewBorder(nil, p.info, nil, nil, p.canvas))
+}
@@ -0,0 +1,133 @@
+package widgets
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+
+	"fyne.io/fyne/v2/test"
+)
+
+func TestStep(t *testing.T) {
+	resize, ok := LookupOperation(Operations, "resize")
+	if !ok {
+		t.Fatal("Expected the resize operation")
+	}
+	step, err := NewStep(resize, []string{" 800", "600 "})
+	if err != nil {
+		t.Fatalf("Failed to create step: %v", err)
+	}
+	if got, want := step.Args(), []string{"-width", "800", "-height", "600"}; !slices.Equal(got, want) {
+		t.Errorf("Args() = %q, want %q", got, want)
+	}
+	if got := step.String(); got != "resize 800 600" {
+		t.Errorf("String() = %q, want %q", got, "resize 800 600")
+	}
+
+	_, err = NewStep(resize, []string{"", ""})
+	if err == nil || err.Error() != "please specify width and height for resize operation" {
+		t.Errorf("Expected an error naming the missing parameters, got %v", err)
+	}
+}
+
+func TestParamForm(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	resize, _ := LookupOperation(Operations, "resize")
+	rotate, _ := LookupOperation(Operations, "rotate")
+	form := NewParamForm(resize)
+	form.SetValues([]string{"640", "480"})
+
+	form.SetOperation(rotate)
+	if len(form.Entries()) != 1 {
+		t.Fatalf("Expected 1 field for rotate, got %d", len(form.Entries()))
+	}
+	if _, err := form.Step(); err == nil {
+		t.Error("Expected an error for a missing angle")
+	}
+	form.SetValues([]string{"90"})
+	step, err := form.Step()
+	if err != nil || step.String() != "rotate 90" {
+		t.Errorf("Step() = %q, %v, want rotate 90", step, err)
+	}
+
+	// The values of an operation are kept when switching back to it
+	form.SetOperation(resize)
+	step, err = form.Step()
+	if err != nil || step.String() != "resize 640 480" {
+		t.Errorf("Step() = %q, %v, want resize 640 480", step, err)
+	}
+}
+
+func TestPipelineBuilder(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	changes := 0
+	b := NewPipelineBuilder(Operations)
+	b.OnChanged = func() { changes++ }
+	for _, line := range [][]string{{"resize", "800", "600"}, {"rotate", "90"}, {"binarize"}} {
+		op, _ := LookupOperation(Operations, line[0])
+		step, err := NewStep(op, line[1:])
+		if err != nil {
+			t.Fatalf("Failed to create step: %v", err)
+		}
+		b.AddStep(step)
+	}
+	if got := b.Recipe(); got != "resize 800 600\nrotate 90\nbinarize\n" {
+		t.Errorf("Recipe() = %q", got)
+	}
+
+	b.MoveStep(2, 0)
+	b.RemoveStep(2)
+	if got := b.Recipe(); got != "binarize\nresize 800 600\n" {
+		t.Errorf("Recipe() after move and remove = %q", got)
+	}
+	if changes != 5 {
+		t.Errorf("Expected 5 changes, got %d", changes)
+	}
+
+	// Out of range moves are ignored
+	b.MoveStep(0, 5)
+	if len(b.Steps()) != 2 {
+		t.Errorf("Expected 2 steps, got %d", len(b.Steps()))
+	}
+}
+
+func TestHistogramAndPreview(t *testing.T) {
+	a := test.NewApp()
+	defer a.Quit()
+
+	img := image.NewGray(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		img.SetGray(x, 0, color.Gray{Y: 255})
+	}
+	bins := LuminanceHistogram(img)
+	if bins[0] != 4 || bins[255] != 4 {
+		t.Errorf("Expected 4 black and 4 white pixels, got %d and %d", bins[0], bins[255])
+	}
+
+	h := NewHistogram()
+	h.SetImage(img)
+	if h.Bins() != bins {
+		t.Error("Histogram bins differ from LuminanceHistogram")
+	}
+	w := test.NewWindow(h)
+	defer w.Close()
+	h.SetImage(nil)
+	if h.Bins() != [256]int{} {
+		t.Error("Expected an empty histogram without an image")
+	}
+
+	p := NewPreview()
+	p.SetImage(img)
+	if p.info.Text != "4 x 2 pixels" {
+		t.Errorf("Preview info = %q, want %q", p.info.Text, "4 x 2 pixels")
+	}
+	p.SetImage(nil)
+	if p.Image() != nil || p.info.Text != "No image" {
+		t.Errorf("Expected no image, got info %q", p.info.Text)
+	}
+}
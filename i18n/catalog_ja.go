@@ -0,0 +1,311 @@
+package i18n
+
+// japanese is the Japanese catalog
+var japanese = map[string]string{
+	// Usage
+	"Usage:":                 "使い方:",
+	"Commands:":              "コマンド:",
+	"Global options:":        "グローバルオプション:",
+	"Plugins:":               "プラグイン:",
+	"Registered operations:": "登録済みの操作:",
+	"Use 'go-image-processor <command> -h' for more information about a command.":          "各コマンドの詳細は 'go-image-processor <command> -h' で表示できます。",
+	"Write outputs to <dir> before moving them into place (default: the output directory)": "出力を <dir> に書き込んでから所定の場所へ移動する (デフォルト: 出力先のディレクトリ)",
+	"Sync each output to disk before moving it into place":                                 "移動する前に各出力をディスクに同期する",
+	"Memory-map inputs instead of reading them into memory":                                "入力をメモリに読み込まずにメモリマップする",
+	"Language of the messages (default: from LC_ALL, LC_MESSAGES or LANG)":                 "メッセージの言語 (デフォルト: LC_ALL、LC_MESSAGES または LANG から判定)",
+	"Language of the messages: en or ja":                                                   "メッセージの言語: en または ja",
+	"Directory for temporary output files (default: next to each output)":                  "一時出力ファイルのディレクトリ (デフォルト: 各出力と同じ場所)",
+	"Sync each output to disk before renaming it into place":                               "名前を変更する前に各出力をディスクに同期する",
+	"Make outputs bit-identical from run to run":                                           "実行ごとにビット単位で同一の出力にする",
+	"Use fixed seeds and process rows in order, for bit-identical outputs":                 "固定シードを使い行を順に処理して、ビット単位で同一の出力にする",
+	"Memory-map input files instead of reading them into memory":                           "入力ファイルをメモリに読み込まずにメモリマップする",
+	"This binary was built without the GUI; build it with: go build -tags gui ./cmd":       "このバイナリは GUI なしでビルドされています。次のコマンドでビルドしてください: go build -tags gui ./cmd",
+	"Unknown command: %s": "不明なコマンドです: %s",
+
+	// Progress bars
+	"Rotating":         "回転中",
+	"Auto-rotating":    "自動回転中",
+	"Denoising":        "ノイズ除去中",
+	"Concatenating":    "連結中",
+	"Binarizing":       "二値化中",
+	"Detecting edges":  "エッジ検出中",
+	"Processing files": "ファイル処理中",
+
+	// Errors and logs
+	"invalid input file":     "入力ファイルが無効です",
+	"invalid output file":    "出力ファイルが無効です",
+	"processing error":       "処理エラー",
+	"unsupported format":     "対応していない形式です",
+	"unexpected error":       "予期しないエラー",
+	"health endpoint failed": "ヘルスチェックのエンドポイントが失敗しました",
+	"serving":                "待ち受け中",
+
+	// Shared flags
+	"Only process the rectangle x,y,width,height or WxH+X+Y and keep the rest of the image as is": "矩形 x,y,width,height または WxH+X+Y だけを処理し、画像の残りはそのままにする",
+	"Image processed successfully": "画像を処理しました",
+
+	// resize
+	"Width to resize the image to, in pixels or with a unit (mm, cm, in)":                    "リサイズ後の幅。ピクセル数または単位付き (mm、cm、in)",
+	"Height to resize the image to, in pixels or with a unit (mm, cm, in)":                   "リサイズ後の高さ。ピクセル数または単位付き (mm、cm、in)",
+	"Print resolution for physical sizes, recorded in the output (default: from the source)": "物理サイズに使う印刷解像度。出力に記録される (デフォルト: 入力の解像度)",
+	"Scale relative to the source size, e.g. 50% or 0.5":                                     "元のサイズに対する倍率。例: 50% または 0.5",
+	"Target size as a geometry: 800x600, 800x, x600 or 50%":                                  "ジオメトリで指定するサイズ: 800x600、800x、x600 または 50%",
+	"Keep images smaller than the target at their original size":                             "目標より小さい画像は元のサイズのままにする",
+	"Keep images larger than the target at their original size":                              "目標より大きい画像は元のサイズのままにする",
+	"Resampling filter: nearest, bilinear, bicubic, mitchell, lanczos2 or lanczos3":          "リサンプリングフィルター: nearest、bilinear、bicubic、mitchell、lanczos2 または lanczos3",
+	"Image kept at its original size (%dx%d)":                                                "画像を元のサイズのままにしました (%dx%d)",
+	"Image resized successfully (%dx%d)":                                                     "画像をリサイズしました (%dx%d)",
+
+	// denoise
+	"Median filter radius": "メディアンフィルターの半径",
+	"Estimate the noise level and choose the filter radius automatically":                 "ノイズレベルを推定してフィルターの半径を自動で選ぶ",
+	"Median filter radius for luma (filters in YCbCr)":                                    "輝度のメディアンフィルターの半径 (YCbCr でフィルター)",
+	"Median filter radius for chroma (filters in YCbCr)":                                  "色差のメディアンフィルターの半径 (YCbCr でフィルター)",
+	"Image denoised successfully (noise sigma: %.1f, luma radius: %d, chroma radius: %d)": "画像のノイズを除去しました (ノイズσ: %.1f、輝度の半径: %d、色差の半径: %d)",
+	"Image denoised successfully (luma radius: %d, chroma radius: %d)":                    "画像のノイズを除去しました (輝度の半径: %d、色差の半径: %d)",
+	"Image denoised successfully (radius: %d)":                                            "画像のノイズを除去しました (半径: %d)",
+	"Image denoised successfully (noise sigma: %.1f, radius: %d)":                         "画像のノイズを除去しました (ノイズσ: %.1f、半径: %d)",
+
+	// rotate and autorotate
+	"Angle to rotate the image by": "画像を回転する角度",
+	"Image rotated successfully":   "画像を回転しました",
+	"Skip rotation when the detected skew exceeds this many degrees (0 means no limit)": "検出した傾きがこの角度を超えるときは回転しない (0 は制限なし)",
+	"Skip rotation when the detection confidence is below this value (0 to 1)":          "検出の信頼度がこの値未満のときは回転しない (0 から 1)",
+	"Skew detection method: hough or projection":                                        "傾きの検出方法: hough または projection",
+	"Turn photos without an EXIF orientation upright from where the sky is":             "EXIF の向きがない写真を空の位置から正しい向きに回転する",
+
+	// transform
+	"Operations: resize:<geometry>, rotate:<degrees>, crop:<width>x<height>+<x>+<y>, flipx, flipy": "操作: resize:<ジオメトリ>、rotate:<角度>、crop:<幅>x<高さ>+<x>+<y>、flipx、flipy",
+	"File decrypted successfully":                                                "ファイルを復号しました",
+	"PDF written: %d pages, %d bytes":                                            "PDF を書き出しました: %d ページ、%d バイト",
+	"Rectangle to keep as x,y,width,height or WxH+X+Y":                           "残す矩形 (x,y,幅,高さ または WxH+X+Y)",
+	"Size to keep as WxH, placed by -gravity":                                    "残すサイズ (WxH)。位置は -gravity で決まります",
+	"Part of the image -size keeps (center, north, south-east, ...)":             "-size で残す画像の部分 (center、north、south-east など)",
+	"Image cropped successfully":                                                 "画像を切り抜きました",
+	"Fill the rectangle x,y,width,height (repeatable)":                           "矩形 x,y,幅,高さ を周囲から補完 (複数指定可)",
+	"Image of the same size whose light pixels are filled":                       "明るい画素を補完する、同じサイズのマスク画像",
+	"Fill strongly colored marks such as stamps and pen":                         "印鑑やペン書きなど色の強い書き込みを補完",
+	"Radius of the neighborhood every pixel is filled from":                      "各画素の補完に使う近傍の半径",
+	"Print the number of pixels filled as JSON":                                  "補完した画素数を JSON で出力",
+	"Image inpainted: %d pixels filled (%.1f%%)":                                 "画像を補完しました: %d 画素 (%.1f%%)",
+	"Size in points assumed for the body text":                                   "本文の文字サイズとして仮定するポイント数",
+	"Print the estimate and the measurements as JSON":                            "推定値と計測値を JSON で出力",
+	"Estimated resolution: %g DPI (%d lines measured)":                           "推定解像度: %g DPI (%d 行を計測)",
+	"The input recorded %g DPI":                                                  "入力に記録されていた解像度は %g DPI でした",
+	"Width in pixels of the border added to every side":                          "四辺すべてに追加する余白の幅 (ピクセル)",
+	"Width in pixels of the border added to the top":                             "上に追加する余白の幅 (ピクセル)",
+	"Width in pixels of the border added to the right":                           "右に追加する余白の幅 (ピクセル)",
+	"Width in pixels of the border added to the bottom":                          "下に追加する余白の幅 (ピクセル)",
+	"Width in pixels of the border added to the left":                            "左に追加する余白の幅 (ピクセル)",
+	"Aspect ratio W:H to extend the canvas to":                                   "キャンバスを広げる先の縦横比 (W:H)",
+	"Where -aspect places the image on the canvas":                               "-aspect で広げたキャンバス上の画像の位置",
+	"Color of the added area":                                                    "追加する領域の色",
+	"Image extended successfully":                                                "キャンバスを拡張しました",
+	"Corners of the page clockwise from the top left, instead of detecting them": "検出の代わりに使うページの四隅 (左上から時計回り)",
+	"Print the corners of the page and the output size as JSON":                  "ページの四隅と出力サイズを JSON で出力",
+	"Page straightened to %dx%d (corners %s)":                                    "ページを %dx%d に補正しました (四隅 %s)",
+	"Number of vertical strips the text lines are traced across":                 "テキスト行を追跡する縦の帯の数",
+	"Print the number of text lines and the largest shift as JSON":               "テキスト行の数と最大の移動量を JSON で出力",
+	"Page flattened from %d text lines (largest shift %.1f pixels)":              "%d 行のテキストからページを平らにしました (最大移動量 %.1f ピクセル)",
+	"Image saved with %.1f%% at full quality":                                    "画像を保存しました (%.1f%% を最高品質で保持)",
+	"Image transformed successfully":                                             "画像を変換しました",
+	"Image auto-rotated successfully (angle: %.1f, confidence: %.2f)":            "画像を自動回転しました (角度: %.1f、信頼度: %.2f)",
+	"Rotation skipped (angle: %.1f, confidence: %.2f)":                           "回転を見送りました (角度: %.1f、信頼度: %.2f)",
+
+	// binarize
+	"Gray level above which pixels turn white, 0-255 (default: Otsu's method)": "これより明るい画素を白にするグレーレベル、0-255 (デフォルト: 大津の方法)",
+	"Image binarized successfully":                                             "画像を二値化しました",
+
+	// concatenation and test images
+	"Images concatenated vertically successfully":                                                         "画像を縦に連結しました",
+	"Write a PNG row by row instead of drawing the whole image in memory":                                 "画像全体をメモリに描かず PNG を行ごとに書き出す",
+	"Detect overlaps between images and blend the seams":                                                  "画像どうしの重なりを検出して継ぎ目をなじませる",
+	"Label each image with its file name":                                                                 "各画像にファイル名のラベルを付ける",
+	"Position of the labels: north puts them above the images, south below, and east or west aligns them": "ラベルの位置: north で画像の上、south で下に置き、east や west で寄せる",
+	"TrueType or OpenType font of the labels":                                                             "ラベルの TrueType または OpenType フォント",
+	"Font size of the labels in pixels (0 scales it with the image)":                                      "ラベルのフォントサイズ (ピクセル、0 で画像に合わせる)",
+	"Color of the labels":            "ラベルの色",
+	"Background color of the labels": "ラベルの背景色",
+	"Label of an image instead of its file name, repeated in the order of the inputs": "ファイル名の代わりに使う画像のラベル (入力の順に繰り返し指定)",
+	"-overlap blends the images into one panorama, which cannot be labeled":           "-overlap は画像を一枚のパノラマに合成するため、ラベルを付けられません",
+	"Images concatenated horizontally successfully":                                   "画像を横に連結しました",
+	"Width of the test image":                                                         "テスト画像の幅",
+	"Height of the test image":                                                        "テスト画像の高さ",
+	"Test image generated successfully":                                               "テスト画像を生成しました",
+	"Edge detection completed successfully":                                           "エッジ検出が完了しました",
+
+	// Tiled processing
+	"Process the image a few rows at a time so images larger than memory fit; the output is PNG for .png and JPEG otherwise": "メモリに収まらない画像も扱えるよう数行ずつ処理する (出力は .png なら PNG、それ以外は JPEG)",
+	"-tiled cannot be combined with -roi": "-tiled は -roi と同時に指定できません",
+	"-roi cannot be used with %s":         "-roi は %s と同時に指定できません",
+
+	// segment, skeleton and trace
+	"Number of gray levels in the output":           "出力のグレーレベル数",
+	"Image segmented successfully (thresholds: %v)": "画像を領域分割しました (しきい値: %v)",
+	"Image skeletonized successfully":               "画像を細線化しました",
+	"Image traced successfully":                     "画像をトレースしました",
+
+	// checksum and group
+	"Also hash tiles of this size (0 disables tiling)":                  "このサイズのタイルごとのハッシュも計算する (0 はタイル分割なし)",
+	"Compare against checksums previously written by this command":      "このコマンドで以前に書き出したチェックサムと照合する",
+	"Perceptual hash distance still accepted by -verify":                "-verify で一致とみなす知覚ハッシュの距離",
+	"%s: no recorded checksum":                                          "%s: 記録されたチェックサムがありません",
+	"%s: identical":                                                     "%s: 同一",
+	"%s: perceptually identical (distance %d)":                          "%s: 見た目が同一 (距離 %d)",
+	"%s: different (distance %d)":                                       "%s: 異なる (距離 %d)",
+	"  tile %d,%d,%d,%d: different (distance %d)":                       "  タイル %d,%d,%d,%d: 異なる (距離 %d)",
+	"Maximum time between photos of the same group":                     "同じグループの写真どうしの最大時間間隔",
+	"Maximum perceptual hash distance between photos of the same group": "同じグループの写真どうしの最大知覚ハッシュ距離",
+
+	// interleave
+	"The back sides run from the first sheet to the last instead of in reverse": "裏面が逆順ではなく最初の用紙から最後の用紙の順に並んでいる",
+	"Turn the back sides by 180 degrees":                                        "裏面を 180 度回転する",
+	"Only print the page order":                                                 "ページの順序を表示するだけにする",
+	"Page %d: front side %s":                                                    "%d ページ: 表面 %s",
+	"Page %d: back side %s":                                                     "%d ページ: 裏面 %s",
+	"%d pages written to %s":                                                    "%d ページを %s に書き出しました",
+
+	// blankdetect
+	"Fraction of the page covered by ink below which it is blank":  "インクの占める割合がこれ未満のページを白紙とみなす",
+	"Fraction of each side ignored, where scanners leave shadows":  "スキャナーの影が残る各辺の無視する割合",
+	"%s: blank (ink coverage %.3f%%)":                              "%s: 白紙 (インク被覆率 %.3f%%)",
+	"%s: not blank (ink coverage %.3f%%)":                          "%s: 白紙ではない (インク被覆率 %.3f%%)",
+	"What to do with blank pages (keep, skip or delete the input)": "白紙ページの扱い (keep: 処理する、skip: 飛ばす、delete: 入力を削除する)",
+	"-blank needs a local input directory":                         "-blank にはローカルの入力ディレクトリが必要です",
+
+	// deblock and faces
+	"Filter strength from 1 (gentle) to 5 (aggressive)":                "フィルターの強さ。1 (弱い) から 5 (強い)",
+	"Image deblocked successfully":                                     "画像のブロックノイズを除去しました",
+	"Print the blurred face boxes as JSON":                             "ぼかした顔の矩形を JSON で出力する",
+	"Faces blurred successfully (%d faces)":                            "顔をぼかしました (%d 件)",
+	"Space kept around the face, as a fraction of its size":            "顔の周りに残す余白。顔の大きさに対する割合",
+	"Resize the crop to a square of this size (0 keeps the crop size)": "切り抜きをこのサイズの正方形にリサイズする (0 は切り抜きのサイズのまま)",
+	"Print the cropped face box as JSON":                               "切り抜いた顔の矩形を JSON で出力する",
+	"Image cropped to face successfully":                               "画像を顔に合わせて切り抜きました",
+
+	// watermark, colorblind and negative
+	"Where to place the mark: a gravity such as south-east or 30%,70%; auto picks the least detailed corner": "透かしの位置: south-east や 30%,70% のような配置。auto は最も模様の少ない隅を選ぶ",
+	"Width of the mark relative to the image width":                                                          "画像の幅に対する透かしの幅",
+	"Opacity of the mark":                                                              "透かしの不透明度",
+	"Distance from the image edges in pixels":                                          "画像の端からの距離 (ピクセル)",
+	"Image watermarked successfully (position: %s)":                                    "透かしを入れました (位置: %s)",
+	"Color vision deficiency to simulate: protanopia, deuteranopia or tritanopia":      "シミュレーションする色覚特性: protanopia、deuteranopia または tritanopia",
+	"Color blindness simulated successfully":                                           "色覚特性をシミュレーションしました",
+	"Film base color as hex, rgb() or a name (default: measured from the film border)": "フィルムベースの色。16 進数、rgb() または色名 (デフォルト: フィルムの縁から測定)",
+	"Fraction of each side sampled for the film base color":                            "フィルムベースの色を測る各辺の割合",
+	"Negative inverted successfully (film base: %s)":                                   "ネガを反転しました (フィルムベース: %s)",
+
+	// docclean, halftone and comic
+	"Cleanup preset: document or whiteboard":     "クリーンアップのプリセット: document または whiteboard",
+	"Document cleaned successfully":              "文書をクリーンアップしました",
+	"Distance between dot centers in pixels":     "網点の中心の間隔 (ピクセル)",
+	"Screen angle in degrees":                    "スクリーン角度 (度)",
+	"Halftone rendered successfully":             "網点画像を生成しました",
+	"Number of tones per color channel":          "色チャンネルごとの階調数",
+	"Edge strength above which pixels are inked": "これを超えるエッジの強さの画素に線を描く",
+	"Comic rendered successfully":                "漫画風の画像を生成しました",
+
+	// preview and convert
+	"Number of terminal columns to use":                                                                   "使用する端末の桁数",
+	"Render plain ASCII characters instead of ANSI truecolor blocks":                                      "ANSI トゥルーカラーのブロックではなく ASCII 文字で表示する",
+	"Output color type: gray, gray16, rgb, rgba or palette":                                               "出力の色の種類: gray、gray16、rgb、rgba または palette",
+	"Bits per sample (default: 8, or 16 for gray16)":                                                      "サンプルあたりのビット数 (デフォルト: 8、gray16 では 16)",
+	"Palette size for -colortype palette (default: 2^bits)":                                               "-colortype palette のパレットの大きさ (デフォルト: 2^bits)",
+	"Fixed palette for -colortype palette, as comma-separated colors (default: generated from the image)": "-colortype palette の固定パレット。カンマ区切りの色 (デフォルト: 画像から生成)",
+	"Use Floyd-Steinberg dithering when reducing colors":                                                  "減色するときに Floyd-Steinberg ディザリングを使う",
+	"Write an Adam7 interlaced PNG for progressive display":                                               "段階的に表示できる Adam7 インターレース PNG を書き出す",
+	"Image converted successfully":                                                                        "画像を変換しました",
+
+	// normalize
+	"Write PNGs of this color type (gray, gray16, rgb, rgba or palette) instead of color JPEGs": "カラー JPEG ではなくこの色の種類 (gray、gray16、rgb、rgba または palette) の PNG を書き出す",
+	"Resample the pages to this resolution (0 keeps the resolution of each page)":               "ページをこの解像度にリサンプリングする (0 は各ページの解像度のまま)",
+	"Template of the output names: {name}, {index} and {date} are replaced":                     "出力ファイル名のテンプレート: {name}、{index}、{date} が置き換えられる",
+	"Do not correct the skew": "傾きを補正しない",
+	"Do not trim the borders": "余白を切り取らない",
+
+	// batch
+	"Longest time a single file may take (0 for no limit)":                                        "1 ファイルにかけられる最長時間 (0 は制限なし)",
+	"Number of files processed in parallel (default: number of CPUs)":                             "並列に処理するファイル数 (デフォルト: CPU 数)",
+	"Write a JSON report of every file (status, timings, sizes, errors) to this path":             "全ファイルの JSON レポート (状態、所要時間、サイズ、エラー) をこのパスに書き出す",
+	"How to treat inputs that are symbolic links (follow or skip)":                                "シンボリックリンクの入力の扱い (follow または skip)",
+	"Give each output the modification time of its input":                                         "各出力の更新日時を入力に合わせる",
+	"Give each output the permissions of its input":                                               "各出力のパーミッションを入力に合わせる",
+	"Give each output the owner and group of its input":                                           "各出力の所有者とグループを入力に合わせる",
+	"Encrypt the outputs with AES-GCM, with the key read from env:NAME, file:PATH or cmd:COMMAND": "出力を AES-GCM で暗号化する。鍵は env:NAME、file:PATH または cmd:COMMAND から読み込む",
+	"Post the report to this URL when the run finishes, in addition to the configured webhooks":   "終了時に、設定済みの Webhook に加えてこの URL にレポートを送信する",
+	"Unknown batch operation: %s":                                                                 "不明なバッチ処理です: %s",
+	"-preserve-times, -preserve-mode and -preserve-owner need local input and output directories": "-preserve-times、-preserve-mode、-preserve-owner にはローカルの入力・出力ディレクトリが必要です",
+	"Webhook failed: %v": "Webhook が失敗しました: %v",
+	"Processed %d files: %d succeeded, %d skipped, %d failed": "%d 件のファイルを処理しました: 成功 %d 件、スキップ %d 件、失敗 %d 件",
+
+	// fixext, classify and exifthumb
+	"Convert mismatched files to the format of their extension instead of renaming them": "拡張子と合わないファイルを、名前を変えずに拡張子の形式へ変換する",
+	"Only report mismatched files":                                 "拡張子と合わないファイルを報告するだけにする",
+	"Print the results as JSON":                                    "結果を JSON で出力する",
+	"%s: %s data, extension matches":                               "%s: %s データ、拡張子は一致しています",
+	"%s: %s data, renamed to %s":                                   "%s: %s データ、%s に名前を変更しました",
+	"%s: %s data, re-encoded to match the extension":               "%s: %s データ、拡張子に合わせて再エンコードしました",
+	"%s: %s data, extension does not match":                        "%s: %s データ、拡張子が一致しません",
+	"Print the classification and its measurements as JSON":        "分類と測定値を JSON で出力する",
+	"%s (photo tiles: %.0f%%, bimodality: %.2f, saturation: %.2f)": "%s (写真タイル: %.0f%%、二峰性: %.2f、彩度: %.2f)",
+	"Print the thumbnail size and orientation as JSON":             "サムネイルのサイズと向きを JSON で出力する",
+	"Thumbnail extracted successfully (%dx%d, %d bytes)":           "サムネイルを取り出しました (%dx%d、%d バイト)",
+	"Preview created successfully":                                 "プレビューを作成しました",
+
+	// recipe, wasm and thumbnail
+	"Print the steps that ran as JSON":                         "実行したステップを JSON で出力する",
+	"Recipe applied successfully (%s)":                         "レシピを適用しました (%s)",
+	"Stop the filter if it runs longer than this":              "フィルターがこれより長くかかったら停止する",
+	"Invalid parameter %q: parameters must be numbers":         "無効なパラメーター %q: パラメーターは数値で指定してください",
+	"WASM filter applied successfully":                         "WASM フィルターを適用しました",
+	"Largest side of the thumbnail in pixels":                  "サムネイルの長辺 (ピクセル)",
+	"Thumbnail created successfully":                           "サムネイルを作成しました",
+	"Crop the middle to a sharpened square JPEG for galleries": "ギャラリー用に中央を正方形に切り抜きシャープにした JPEG を作成",
+
+	// capture
+	"Capture the window with this id instead of the whole screen (X11 and macOS)":          "画面全体ではなくこの ID のウィンドウをキャプチャする (X11 と macOS)",
+	"Wait before capturing, e.g. 3s to open a menu":                                        "キャプチャまで待つ時間。例: メニューを開くなら 3s",
+	"Keep only the rectangle x,y,width,height or WxH+X+Y":                                  "矩形 x,y,width,height または WxH+X+Y だけを残す",
+	"Black out the rectangle x,y,width,height (repeatable)":                                "矩形 x,y,width,height を黒く塗りつぶす (複数指定可)",
+	"Outline the rectangle x,y,width,height (repeatable)":                                  "矩形 x,y,width,height を枠で囲む (複数指定可)",
+	"Color of the outlines":                                                                "枠の色",
+	"Shrink the screenshot to fit WxH":                                                     "スクリーンショットを WxH に収まるよう縮小する",
+	"Apply a recipe to the screenshot":                                                     "スクリーンショットにレシピを適用する",
+	"Copy the screenshot to the clipboard":                                                 "スクリーンショットをクリップボードにコピーする",
+	"Print the tool and size as JSON":                                                      "使用したツールとサイズを JSON で出力する",
+	"Keep the rectangle x,y,width,height at full quality (repeatable)":                     "矩形 x,y,幅,高さ を最高品質で保持する (複数指定可)",
+	"Keep the detected text lines at full quality":                                         "検出したテキスト行を最高品質で保持する",
+	"Pixels kept at full quality around every region":                                      "各領域の周囲で最高品質を保つピクセル数",
+	"JPEG quality of the regions, 1-100 (default: the configured quality)":                 "領域の JPEG 品質 (1-100、既定: 設定の品質)",
+	"JPEG quality of the rest of the image, 1-100":                                         "それ以外の部分の JPEG 品質 (1-100)",
+	"Resolution of the scans, which sets the page size":                                    "スキャンの解像度 (ページサイズを決める)",
+	"Factor by which the background layer is reduced":                                      "背景レイヤーの縮小率",
+	"Factor by which the text color layer is reduced":                                      "文字色レイヤーの縮小率",
+	"JPEG quality of the background and text color layers, 1-100":                          "背景レイヤーと文字色レイヤーの JPEG 品質 (1-100)",
+	"Gray level at or below which a pixel is text (default: found with Otsu's method)":     "この階調以下の画素を文字とみなす (既定: 大津の方法で決定)",
+	"Print the sizes of the layers as JSON":                                                "各レイヤーのサイズを JSON で出力する",
+	"How to bring the image to width x height: fit inside, fill and crop, stretch, or pad": "幅 x 高さへの合わせ方: fit (内側に収める)、fill (埋めて切り抜く)、stretch (引き伸ばす)、pad (余白を付ける)",
+	"Where the image goes when filling or padding, e.g. north or 25%,75%":                  "fill や pad で画像を置く位置 (例: north、25%,75%)",
+	"Color of the padding":                                                                 "余白の色",
+	"Print the regions kept and their coverage as JSON":                                    "保持した領域と割合を JSON で出力する",
+	"Screen captured successfully (%dx%d)":                                                 "画面をキャプチャしました (%dx%d)",
+
+	// thumbnail-daemon, worker and serve
+	"Thumbnail cache sizes to fill: normal, large, x-large, xx-large":                            "作成するサムネイルキャッシュのサイズ: normal、large、x-large、xx-large",
+	"How often the directories are scanned for new images":                                       "新しい画像を探してディレクトリを走査する間隔",
+	"Print a freedesktop .thumbnailer file for this program and exit":                            "このプログラム用の freedesktop .thumbnailer ファイルを出力して終了する",
+	"Thumbnail daemon stopped":                                                                   "サムネイルデーモンを停止しました",
+	"Number of requests processed in parallel (default: number of CPUs)":                         "並列に処理するリクエスト数 (デフォルト: CPU 数)",
+	"How long requests in progress may take to finish after SIGTERM (0 for no limit)":            "SIGTERM の後、処理中のリクエストの完了を待つ時間 (0 は制限なし)",
+	"Serve /healthz and /readyz on this address, e.g. :8081":                                     "/healthz と /readyz をこのアドレスで提供する。例: :8081",
+	"Apply changes to config.yaml and its preset files without restarting":                       "config.yaml とプリセットファイルの変更を再起動せずに反映する",
+	"Comma-separated directories and sftp:// or dav:// URLs requests may read from and write to": "リクエストが読み書きできるディレクトリと sftp:// または dav:// の URL (カンマ区切り)",
+	"Worker stopped":                   "ワーカーを停止しました",
+	"Address to listen on":             "待ち受けるアドレス",
+	"Largest image accepted, in bytes": "受け付ける画像の最大サイズ (バイト)",
+	"Most memory the images of a request may take, in bytes (default: no limit)":                    "1 リクエストの画像が使えるメモリの上限 (バイト、デフォルト: 無制限)",
+	"Encrypt the responses with AES-GCM, with the key read from env:NAME, file:PATH or cmd:COMMAND": "レスポンスを AES-GCM で暗号化する。鍵は env:NAME、file:PATH または cmd:COMMAND から読み込む",
+	"Where to read the key from: env:NAME, file:PATH or cmd:COMMAND":                                "鍵の読み込み元: env:NAME、file:PATH または cmd:COMMAND",
+	"How long requests in progress may take to finish after SIGTERM":                                "SIGTERM の後、処理中のリクエストの完了を待つ時間",
+	"Server stopped": "サーバーを停止しました",
+}
@@ -0,0 +1,96 @@
+// Package i18n translates the messages of the command line tool. Messages
+// are written in English in the code and looked up in the catalog of the
+// selected language, falling back to the English text when the catalog has
+// no entry for them:
+//
+//	fmt.Println(i18n.Sprintf("Image resized successfully (%dx%d)", w, h))
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Lang is a language the messages are available in
+type Lang string
+
+// Supported languages
+const (
+	English  Lang = "en"
+	Japanese Lang = "ja"
+)
+
+// catalogs map the English messages to their translations; English needs
+// no catalog
+var catalogs = map[Lang]map[string]string{
+	Japanese: japanese,
+}
+
+// current is the language messages are translated to
+var current atomic.Value
+
+// Languages lists the supported languages
+func Languages() []Lang {
+	return []Lang{English, Japanese}
+}
+
+// Parse parses a language code such as "ja" or a locale such as
+// "ja_JP.UTF-8". The C and POSIX locales are English.
+// Returns an error for other languages.
+func Parse(s string) (Lang, error) {
+	code := strings.ToLower(s)
+	if i := strings.IndexAny(code, "_-.@"); i >= 0 {
+		code = code[:i]
+	}
+	switch code {
+	case "en", "c", "posix":
+		return English, nil
+	case "ja":
+		return Japanese, nil
+	}
+	return "", fmt.Errorf("unsupported language %q (want en or ja)", s)
+}
+
+// Detect returns the language of the locale set in the environment, read
+// with getenv from LC_ALL, LC_MESSAGES and LANG in that order as POSIX
+// does. Unset and unsupported locales are English.
+func Detect(getenv func(string) string) Lang {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := getenv(name); value != "" {
+			if lang, err := Parse(value); err == nil {
+				return lang
+			}
+			return English
+		}
+	}
+	return English
+}
+
+// SetLanguage selects the language of the messages returned by T and Sprintf
+func SetLanguage(lang Lang) {
+	current.Store(lang)
+}
+
+// Language returns the selected language, English unless SetLanguage was called
+func Language() Lang {
+	if lang, ok := current.Load().(Lang); ok {
+		return lang
+	}
+	return English
+}
+
+// T returns the translation of msg in the selected language, or msg itself
+// when there is none
+func T(msg string) string {
+	if translated, ok := catalogs[Language()][msg]; ok {
+		return translated
+	}
+	return msg
+}
+
+// Sprintf formats the translation of format like fmt.Sprintf. The
+// translation keeps the verbs of format in the same order.
+func Sprintf(format string, args ...any) string {
+	return fmt.Sprintf(T(format), args...)
+}
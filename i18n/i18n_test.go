@@ -0,0 +1,90 @@
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Lang
+	}{
+		{"en", English},
+		{"ja", Japanese},
+		{"JA", Japanese},
+		{"ja_JP.UTF-8", Japanese},
+		{"ja-JP", Japanese},
+		{"en_US.UTF-8", English},
+		{"C", English},
+		{"C.UTF-8", English},
+		{"POSIX", English},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+	for _, input := range []string{"", "de_DE.UTF-8", "japanese"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Expected Parse(%q) to fail", input)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want Lang
+	}{
+		{map[string]string{}, English},
+		{map[string]string{"LANG": "ja_JP.UTF-8"}, Japanese},
+		{map[string]string{"LC_MESSAGES": "ja_JP.UTF-8", "LANG": "en_US.UTF-8"}, Japanese},
+		{map[string]string{"LC_ALL": "C", "LC_MESSAGES": "ja_JP.UTF-8"}, English},
+		{map[string]string{"LC_ALL": "de_DE.UTF-8", "LANG": "ja_JP.UTF-8"}, English},
+	}
+	for _, tt := range tests {
+		getenv := func(name string) string { return tt.env[name] }
+		if got := Detect(getenv); got != tt.want {
+			t.Errorf("Detect(%v) = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	defer SetLanguage(Language())
+
+	SetLanguage(Japanese)
+	if got := T("Usage:"); got != "使い方:" {
+		t.Errorf("T(%q) = %q, want %q", "Usage:", got, "使い方:")
+	}
+	if got := T("no such message"); got != "no such message" {
+		t.Errorf("Expected an unknown message to be returned as is, got %q", got)
+	}
+	if got := Sprintf("Image resized successfully (%dx%d)", 800, 600); got != "画像をリサイズしました (800x600)" {
+		t.Errorf("Sprintf() = %q", got)
+	}
+
+	SetLanguage(English)
+	if got := T("Usage:"); got != "Usage:" {
+		t.Errorf("T(%q) = %q in English", "Usage:", got)
+	}
+}
+
+// verbs matches the fmt verbs of a message
+var verbs = regexp.MustCompile(`%[-+#0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+func TestCatalogVerbs(t *testing.T) {
+	for lang, catalog := range catalogs {
+		for msg, translated := range catalog {
+			if translated == "" {
+				t.Errorf("%s: empty translation of %q", lang, msg)
+			}
+			if want, got := verbs.FindAllString(msg, -1), verbs.FindAllString(translated, -1); !slices.Equal(got, want) {
+				t.Errorf("%s: translation of %q has verbs %q, want %q", lang, msg, got, want)
+			}
+		}
+	}
+}
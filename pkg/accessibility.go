@@ -0,0 +1,297 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+)
+
+// Color vision deficiencies accepted by SimulateColorBlindness
+const (
+	Protanopia   = "protanopia"
+	Deuteranopia = "deuteranopia"
+	Tritanopia   = "tritanopia"
+)
+
+// colorBlindnessMatrices are the full-severity simulation matrices of
+// Machado, Oliveira and Fernandes (2009), applied to linear RGB
+var colorBlindnessMatrices = map[string][3][3]float64{
+	Protanopia: {
+		{0.152286, 1.052583, -0.204868},
+		{0.114503, 0.786281, 0.099216},
+		{-0.003882, -0.048116, 1.051998},
+	},
+	Deuteranopia: {
+		{0.367322, 0.860646, -0.227968},
+		{0.280085, 0.672501, 0.047413},
+		{-0.011820, 0.042940, 0.968881},
+	},
+	Tritanopia: {
+		{1.255528, -0.076749, -0.178779},
+		{-0.078411, 0.930809, 0.147602},
+		{0.004733, 0.691367, 0.303900},
+	},
+}
+
+// WCAG 2 contrast ratio thresholds
+const (
+	wcagAA      = 4.5
+	wcagAALarge = 3.0
+	wcagAAA     = 7.0
+)
+
+// largeTextHeight is the text line height, in pixels, from which the relaxed
+// WCAG threshold for large text applies. Pixel height only approximates the
+// point size WCAG refers to.
+const largeTextHeight = 24
+
+// ContrastRegion is the contrast check result for one text region
+type ContrastRegion struct {
+	Box
+	Foreground string  `json:"foreground"`
+	Background string  `json:"background"`
+	Ratio      float64 `json:"ratio"`
+	AA         bool    `json:"aa"`
+	AAA        bool    `json:"aaa"`
+	// Simulated is the contrast ratio as seen with each color vision deficiency
+	Simulated map[string]float64 `json:"simulated"`
+}
+
+// ContrastReport is the result of CheckContrast
+type ContrastReport struct {
+	Regions []ContrastRegion `json:"regions"`
+	// MinRatio is the lowest ratio over all regions and simulations
+	MinRatio float64 `json:"min_ratio"`
+	// Passes is true when every region meets WCAG AA, including under simulation
+	Passes bool `json:"passes"`
+}
+
+// SimulateColorBlindness renders the image as seen with a color vision deficiency.
+// It takes the paths of the input and output files and the deficiency
+// (protanopia, deuteranopia or tritanopia).
+// Returns an error if the operation fails.
+func SimulateColorBlindness(inputPath string, outputPath string, deficiency string) error {
+	slog.Info("simulating color blindness",
+		"input", inputPath,
+		"deficiency", deficiency)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	out, err := SimulateDeficiency(img, deficiency)
+	if err != nil {
+		return err
+	}
+	return saveJPEG(outputPath, out)
+}
+
+// SimulateColorBlindnessReader renders the image read from r like
+// SimulateColorBlindness and writes it to w as JPEG.
+// Returns an error if the operation fails.
+func SimulateColorBlindnessReader(r io.Reader, w io.Writer, deficiency string) error {
+	img, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	out, err := SimulateDeficiency(img, deficiency)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, out)
+}
+
+// SimulateDeficiency renders the image as seen with a color vision deficiency
+// (protanopia, deuteranopia or tritanopia), like SimulateColorBlindness.
+// Returns an error if the deficiency is unknown.
+func SimulateDeficiency(img image.Image, deficiency string) (image.Image, error) {
+	matrix, ok := colorBlindnessMatrices[deficiency]
+	if !ok {
+		return nil, &ErrProcessing{Op: "colorblind", Err: fmt.Errorf("unknown color vision deficiency: %s", deficiency)}
+	}
+
+	out := toRGBA(img)
+	for i := 0; i < len(out.Pix); i += 4 {
+		c := simulateColor(color.RGBA{R: out.Pix[i], G: out.Pix[i+1], B: out.Pix[i+2]}, matrix)
+		out.Pix[i], out.Pix[i+1], out.Pix[i+2] = c.R, c.G, c.B
+	}
+	return out, nil
+}
+
+// CheckContrast measures the WCAG contrast ratio between the text and its
+// background in every text region of the image, as seen with normal vision
+// and with each simulated color vision deficiency.
+// It takes the path of the input file.
+// Returns the report, or an error if the operation fails.
+func CheckContrast(inputPath string) (*ContrastReport, error) {
+	slog.Info("checking contrast", "input", inputPath)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	return checkContrast(img), nil
+}
+
+// CheckContrastReader measures the contrast of the text in the image read
+// from r like CheckContrast.
+// Returns the report, or an error if the operation fails.
+func CheckContrastReader(r io.Reader) (*ContrastReport, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	return checkContrast(img), nil
+}
+
+// checkContrast measures the contrast of every text region of the image
+func checkContrast(img image.Image) *ContrastReport {
+	rgba := toRGBA(img)
+	regions := detectTextRegions(toGray(rgba))
+
+	report := &ContrastReport{MinRatio: math.Inf(1), Passes: true}
+	for _, word := range regions.Words {
+		r := word.Rect()
+		fg, bg := textColors(rgba.SubImage(r).(*image.RGBA))
+		region := ContrastRegion{
+			Box:        word,
+			Foreground: hexColor(fg),
+			Background: hexColor(bg),
+			Ratio:      contrastRatio(fg, bg),
+			Simulated:  make(map[string]float64),
+		}
+		minRatio := region.Ratio
+		for deficiency, matrix := range colorBlindnessMatrices {
+			ratio := contrastRatio(simulateColor(fg, matrix), simulateColor(bg, matrix))
+			region.Simulated[deficiency] = ratio
+			minRatio = math.Min(minRatio, ratio)
+		}
+
+		threshold := wcagAA
+		if r.Dy() >= largeTextHeight {
+			threshold = wcagAALarge
+		}
+		region.AA = region.Ratio >= threshold
+		region.AAA = region.Ratio >= wcagAAA
+		report.Passes = report.Passes && minRatio >= threshold
+		report.MinRatio = math.Min(report.MinRatio, minRatio)
+		report.Regions = append(report.Regions, region)
+	}
+	if len(report.Regions) == 0 {
+		report.MinRatio = 0
+	}
+
+	slog.Info("checked contrast",
+		"regions", len(report.Regions),
+		"min_ratio", report.MinRatio,
+		"passes", report.Passes)
+	return report
+}
+
+// textColors splits a text region into ink and background with Otsu's method
+// and returns the mean color of each. The less common class is taken as the
+// ink, so light text on a dark background is handled too.
+func textColors(region *image.RGBA) (fg, bg color.RGBA) {
+	mask := otsuInkMask(toGray(region))
+	var sums [2][3]int
+	var counts [2]int
+	bounds := region.Bounds()
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			class := 0
+			if mask[i] {
+				class = 1
+			}
+			c := region.RGBAAt(x, y)
+			sums[class][0] += int(c.R)
+			sums[class][1] += int(c.G)
+			sums[class][2] += int(c.B)
+			counts[class]++
+			i++
+		}
+	}
+
+	mean := func(class int) color.RGBA {
+		n := max(counts[class], 1)
+		return color.RGBA{R: uint8(sums[class][0] / n), G: uint8(sums[class][1] / n), B: uint8(sums[class][2] / n), A: 255}
+	}
+	dark, light := mean(1), mean(0)
+	if counts[1] <= counts[0] {
+		return dark, light
+	}
+	return light, dark
+}
+
+// simulateColor applies a color vision deficiency matrix to an sRGB color
+func simulateColor(c color.RGBA, matrix [3][3]float64) color.RGBA {
+	in := [3]float64{srgbToLinear(c.R), srgbToLinear(c.G), srgbToLinear(c.B)}
+	var out [3]uint8
+	for i, row := range matrix {
+		out[i] = linearToSRGB(row[0]*in[0] + row[1]*in[1] + row[2]*in[2])
+	}
+	return color.RGBA{R: out[0], G: out[1], B: out[2], A: c.A}
+}
+
+// contrastRatio returns the WCAG contrast ratio between two colors, from 1 to 21
+func contrastRatio(a, b color.RGBA) float64 {
+	la, lb := relativeLuminance(a), relativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// relativeLuminance returns the WCAG relative luminance of an sRGB color
+func relativeLuminance(c color.RGBA) float64 {
+	return 0.2126*srgbToLinear(c.R) + 0.7152*srgbToLinear(c.G) + 0.0722*srgbToLinear(c.B)
+}
+
+// srgbLinearTable maps 8-bit sRGB components to linear light in [0, 1]
+var srgbLinearTable = func() [256]float64 {
+	var table [256]float64
+	for i := range table {
+		c := float64(i) / 255
+		if c <= 0.04045 {
+			table[i] = c / 12.92
+		} else {
+			table[i] = math.Pow((c+0.055)/1.055, 2.4)
+		}
+	}
+	return table
+}()
+
+// srgbToLinear decodes an 8-bit sRGB component to linear light in [0, 1]
+func srgbToLinear(v uint8) float64 {
+	return srgbLinearTable[v]
+}
+
+// linearToSRGB encodes linear light to an 8-bit sRGB component, clamping out-of-gamut values
+func linearToSRGB(c float64) uint8 {
+	c = math.Min(math.Max(c, 0), 1)
+	if c <= 0.0031308 {
+		c *= 12.92
+	} else {
+		c = 1.055*math.Pow(c, 1/2.4) - 0.055
+	}
+	return uint8(c*255 + 0.5)
+}
+
+// hexColor formats a color as #rrggbb
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// ParseHexColor parses an opaque color written as #rrggbb or rrggbb
+func ParseHexColor(s string) (color.RGBA, error) {
+	var c color.RGBA
+	if _, err := fmt.Sscanf(strings.TrimPrefix(s, "#"), "%02x%02x%02x", &c.R, &c.G, &c.B); err != nil || len(strings.TrimPrefix(s, "#")) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	c.A = 255
+	return c, nil
+}
@@ -0,0 +1,114 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// generateColoredText draws a row of box-shaped glyphs in fg on bg
+func generateColoredText(outputPath string, fg, bg color.Color) error {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 80))
+	draw.Draw(img, img.Bounds(), &image.Uniform{bg}, image.Point{}, draw.Src)
+	for _, x0 := range []int{20, 36, 52, 110, 126, 142} {
+		for y := 30; y < 50; y++ {
+			for x := x0; x < x0+12; x++ {
+				if x < x0+3 || x >= x0+9 || y < 33 || y >= 47 {
+					img.Set(x, y, fg)
+				}
+			}
+		}
+	}
+	return saveJPEG(outputPath, img)
+}
+
+func TestContrastRatio(t *testing.T) {
+	black := color.RGBA{A: 255}
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	if ratio := contrastRatio(black, white); math.Abs(ratio-21) > 0.01 {
+		t.Errorf("Expected black on white to be 21:1, got %.2f", ratio)
+	}
+	if ratio := contrastRatio(white, white); ratio != 1 {
+		t.Errorf("Expected identical colors to be 1:1, got %.2f", ratio)
+	}
+}
+
+func TestSimulateColor(t *testing.T) {
+	red := color.RGBA{R: 200, G: 40, B: 40, A: 255}
+	green := color.RGBA{R: 40, G: 140, B: 40, A: 255}
+
+	// Red and green are told apart with normal vision but are much closer in
+	// luminance and hue for someone with deuteranopia
+	normal := colorDistance(red, green)
+	simulated := colorDistance(simulateColor(red, colorBlindnessMatrices[Deuteranopia]), simulateColor(green, colorBlindnessMatrices[Deuteranopia]))
+	if simulated >= normal/2 {
+		t.Errorf("Expected deuteranopia to bring red and green together, distance %.1f -> %.1f", normal, simulated)
+	}
+
+	// Grays are unaffected
+	gray := color.RGBA{R: 128, G: 128, B: 128, A: 255}
+	for deficiency, matrix := range colorBlindnessMatrices {
+		if c := simulateColor(gray, matrix); colorDistance(c, gray) > 3 {
+			t.Errorf("Expected gray to stay gray with %s, got %v", deficiency, c)
+		}
+	}
+}
+
+// colorDistance returns the Euclidean distance between two colors in RGB
+func colorDistance(a, b color.RGBA) float64 {
+	dr, dg, db := float64(a.R)-float64(b.R), float64(a.G)-float64(b.G), float64(a.B)-float64(b.B)
+	return math.Sqrt(dr*dr + dg*dg + db*db)
+}
+
+func TestCheckContrast(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	goodPath := filepath.Join(testDir, "test_input_contrast_good.jpg")
+	if err := generateColoredText(goodPath, color.Black, color.White); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	report, err := CheckContrast(goodPath)
+	if err != nil {
+		t.Fatalf("Failed to check contrast: %v", err)
+	}
+	if len(report.Regions) == 0 || !report.Passes {
+		t.Errorf("Expected black text on white to pass, got %+v", report)
+	}
+
+	poorPath := filepath.Join(testDir, "test_input_contrast_poor.jpg")
+	if err := generateColoredText(poorPath, color.RGBA{R: 40, G: 40, B: 40, A: 255}, color.RGBA{R: 90, G: 90, B: 90, A: 255}); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	report, err = CheckContrast(poorPath)
+	if err != nil {
+		t.Fatalf("Failed to check contrast: %v", err)
+	}
+	if len(report.Regions) == 0 || report.Passes {
+		t.Errorf("Expected dark gray text on gray to fail, got %+v", report)
+	}
+}
+
+func TestSimulateColorBlindness(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_colorblind.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_colorblind.jpg")
+	if err := generateSingleTestImage(testInputPath, 100, 100); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	for _, deficiency := range []string{Protanopia, Deuteranopia, Tritanopia} {
+		if err := SimulateColorBlindness(testInputPath, testOutputPath, deficiency); err != nil {
+			t.Errorf("Failed to simulate %s: %v", deficiency, err)
+		}
+	}
+	if err := SimulateColorBlindness(testInputPath, testOutputPath, "monochromacy"); err == nil {
+		t.Errorf("Expected an error for an unknown deficiency")
+	}
+}
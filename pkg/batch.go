@@ -0,0 +1,337 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchOptions controls RunBatch and ProcessBatch
+type BatchOptions struct {
+	// Timeout is the longest a single file may take; zero means no limit
+	Timeout time.Duration
+	// Workers is the number of files processed in parallel; zero uses the number of CPUs
+	Workers int
+	// Progress receives the number of files finished, whatever their
+	// outcome, and the number of files
+	Progress ProgressFunc
+	// OutputExt is the extension of the outputs named by ProcessBatch; empty
+	// uses .jpg, the format most operations write
+	OutputExt string
+
+	// Symlinks selects whether linked inputs are processed or skipped;
+	// the zero value follows them
+	Symlinks SymlinkPolicy
+	// PreserveTimes, PreserveMode and PreserveOwner copy the modification
+	// time, permissions and owner of each input to its output
+	PreserveTimes bool
+	PreserveMode  bool
+	PreserveOwner bool
+
+	// Blank selects whether blank pages are processed, skipped or deleted;
+	// the zero value processes them. BlankOptions tunes their detection.
+	Blank        BlankPolicy
+	BlankOptions BlankOptions
+}
+
+// BatchFailure describes a file that could not be processed
+type BatchFailure struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+	// Panicked is true when processing crashed instead of returning an error
+	Panicked bool `json:"panicked,omitempty"`
+	// TimedOut is true when processing took longer than the timeout
+	TimedOut bool `json:"timed_out,omitempty"`
+}
+
+// BatchFileResult is the audit record of one file in a batch run
+type BatchFileResult struct {
+	File   string `json:"file"`
+	Output string `json:"output,omitempty"`
+	// Status is "ok", "skipped", "error", "panic", "timeout" or "cancelled"
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+	// Blank is true when the file was skipped as a blank page
+	Blank bool `json:"blank,omitempty"`
+
+	InputBytes   int64 `json:"input_bytes"`
+	InputWidth   int   `json:"input_width,omitempty"`
+	InputHeight  int   `json:"input_height,omitempty"`
+	OutputBytes  int64 `json:"output_bytes,omitempty"`
+	OutputWidth  int   `json:"output_width,omitempty"`
+	OutputHeight int   `json:"output_height,omitempty"`
+}
+
+// BatchReport summarizes a batch run
+type BatchReport struct {
+	// Operation and Parameters are filled in by the caller to describe the run
+	Operation  string            `json:"operation,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	Started    time.Time         `json:"started"`
+	DurationMS float64           `json:"duration_ms"`
+	Succeeded  int               `json:"succeeded"`
+	Skipped    int               `json:"skipped,omitempty"`
+	Cancelled  int               `json:"cancelled,omitempty"`
+	Failures   []BatchFailure    `json:"failures"`
+	Files      []BatchFileResult `json:"files"`
+}
+
+// RunBatch calls process for every input file in parallel. process returns
+// the path of the file it wrote, which is recorded in the report. Each call is
+// isolated: a panic or a call exceeding the timeout is reported as a failure
+// for that file and the batch carries on with the others.
+// A timed out call cannot be stopped and keeps running in the background
+// until it returns; its result is discarded.
+// It takes the input file paths, the options and the function processing one file.
+// Returns a report of the successes and failures and a record of every file, in input order.
+func RunBatch(inputPaths []string, opts BatchOptions, process func(inputPath string) (string, error)) *BatchReport {
+	return runBatch(context.Background(), inputPaths, opts, process)
+}
+
+// Operation processes one input file into one output file, like
+// BinarizeImage or DenoiseImage
+type Operation func(inputPath, outputPath string) error
+
+// ProcessBatch applies op to every input file in parallel, writing each
+// output to outputDir with the name of its input and the extension of
+// opts.OutputExt. Files are isolated from one another as in RunBatch, and
+// once ctx is cancelled the files not yet started are reported as cancelled
+// while those in progress finish.
+// It takes the context, the input file paths, the output directory, the
+// operation and the options.
+// Returns a report of every file, in input order, and the error of ctx if it
+// was cancelled, or an error if two inputs would be written to the same
+// output or the output directory cannot be created.
+func ProcessBatch(ctx context.Context, inputPaths []string, outputDir string, op Operation, opts BatchOptions) (*BatchReport, error) {
+	ext := opts.OutputExt
+	if ext == "" {
+		ext = ".jpg"
+	} else if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	if err := CheckBatchOutputs(inputPaths, ext); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, &ErrInvalidOutput{Path: outputDir, Err: err}
+	}
+	report := runBatch(ctx, inputPaths, opts, func(inputPath string) (string, error) {
+		outputPath := filepath.Join(outputDir, BatchOutputName(inputPath, ext))
+		return outputPath, op(inputPath, outputPath)
+	})
+	return report, ctx.Err()
+}
+
+// BatchOutputName returns the name of the output of an input in a batch: the
+// base name of the input with the extension ext
+func BatchOutputName(inputPath string, ext string) string {
+	return strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath)) + ext
+}
+
+// CheckBatchOutputs returns an error if two inputs would be written to the
+// same output once given the extension ext, as a.png and a.jpg are. Names
+// differing only in case collide too, as on case-insensitive file systems.
+func CheckBatchOutputs(inputPaths []string, ext string) error {
+	seen := make(map[string]string, len(inputPaths))
+	for _, inputPath := range inputPaths {
+		name := BatchOutputName(inputPath, ext)
+		key := strings.ToLower(name)
+		if other, ok := seen[key]; ok {
+			return &ErrProcessing{Op: "batch", Err: fmt.Errorf("%s and %s would both be written to %s", other, inputPath, name)}
+		}
+		seen[key] = inputPath
+	}
+	return nil
+}
+
+// runBatch does the work of RunBatch and ProcessBatch, leaving the files not
+// started once ctx is cancelled
+func runBatch(ctx context.Context, inputPaths []string, opts BatchOptions, process func(inputPath string) (string, error)) *BatchReport {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	slog.Info("running batch",
+		"count", len(inputPaths),
+		"workers", workers,
+		"timeout", opts.Timeout,
+		"symlinks", opts.Symlinks)
+
+	started := time.Now()
+	results := make([]BatchFileResult, len(inputPaths))
+	failures := make([]*BatchFailure, len(inputPaths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var progressMu sync.Mutex
+	finished := 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				switch {
+				case ctx.Err() != nil:
+					results[i] = BatchFileResult{File: inputPaths[i], Status: "cancelled"}
+				case opts.Symlinks == SymlinkSkip && isSymlink(inputPaths[i]):
+					results[i] = BatchFileResult{File: inputPaths[i], Status: "skipped"}
+				default:
+					results[i], failures[i] = runIsolated(inputPaths[i], opts, process)
+				}
+				progressMu.Lock()
+				finished++
+				opts.Progress.report(finished, len(inputPaths))
+				progressMu.Unlock()
+			}
+		}()
+	}
+	for i := range inputPaths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	report := &BatchReport{
+		Started:    started,
+		DurationMS: durationMS(time.Since(started)),
+		Failures:   []BatchFailure{},
+		Files:      results,
+	}
+	for i, failure := range failures {
+		switch {
+		case failure != nil:
+			report.Failures = append(report.Failures, *failure)
+		case results[i].Status == "skipped":
+			report.Skipped++
+		case results[i].Status == "cancelled":
+			report.Cancelled++
+		default:
+			report.Succeeded++
+		}
+	}
+	slog.Info("batch finished",
+		"succeeded", report.Succeeded,
+		"skipped", report.Skipped,
+		"cancelled", report.Cancelled,
+		"failed", len(report.Failures))
+	return report
+}
+
+// runIsolated processes one file, converting a panic or a timeout into a failure,
+// and copies the input's file metadata to the output as opts asks. A blank
+// page is skipped, or deleted, before processing when opts asks for it.
+// Returns the audit record of the file and the failure, if any.
+func runIsolated(inputPath string, opts BatchOptions, process func(inputPath string) (string, error)) (BatchFileResult, *BatchFailure) {
+	timeout := opts.Timeout
+	type outcome struct {
+		output  string
+		blank   bool
+		failure *BatchFailure
+	}
+	result := BatchFileResult{File: inputPath}
+	result.InputBytes, result.InputWidth, result.InputHeight = fileImageInfo(inputPath)
+	start := time.Now()
+
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				slog.Error("panic while processing file",
+					"path", inputPath,
+					"panic", r,
+					"stack", string(debug.Stack()))
+				done <- outcome{failure: &BatchFailure{File: inputPath, Error: fmt.Sprint("panic: ", r), Panicked: true}}
+			}
+		}()
+		blank, err := skipBlank(inputPath, opts)
+		if blank && err == nil {
+			done <- outcome{blank: true}
+			return
+		}
+		var output string
+		if err == nil {
+			output, err = process(inputPath)
+		}
+		if err == nil {
+			err = preserveFileInfo(inputPath, output, opts)
+		}
+		if err != nil {
+			done <- outcome{output: output, failure: &BatchFailure{File: inputPath, Error: err.Error()}}
+			return
+		}
+		done <- outcome{output: output}
+	}()
+
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+
+	var o outcome
+	select {
+	case o = <-done:
+	case <-timeoutC:
+		slog.Error("processing timed out",
+			"path", inputPath,
+			"timeout", timeout)
+		o.failure = &BatchFailure{File: inputPath, Error: fmt.Sprintf("timed out after %s", timeout), TimedOut: true}
+	}
+	result.DurationMS = durationMS(time.Since(start))
+
+	switch {
+	case o.blank:
+		result.Status = "skipped"
+		result.Blank = true
+	case o.failure == nil:
+		result.Status = "ok"
+		result.Output = o.output
+		result.OutputBytes, result.OutputWidth, result.OutputHeight = fileImageInfo(o.output)
+	case o.failure.Panicked:
+		result.Status = "panic"
+	case o.failure.TimedOut:
+		result.Status = "timeout"
+	default:
+		result.Status = "error"
+	}
+	if o.failure != nil {
+		result.Error = o.failure.Error
+	}
+	return result, o.failure
+}
+
+// fileImageInfo returns the size of a file and the dimensions of the image in
+// it, reading only the image header. Values are zero when unavailable.
+func fileImageInfo(path string) (size int64, width, height int) {
+	if path == "" {
+		return 0, 0, 0
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, 0
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+	if config, _, err := image.DecodeConfig(file); err == nil {
+		width, height = config.Width, config.Height
+	}
+	return size, width, height
+}
+
+// durationMS converts a duration to fractional milliseconds
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,171 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunBatch(t *testing.T) {
+	inputs := []string{"ok1.jpg", "panic.jpg", "error.jpg", "slow.jpg", "ok2.jpg"}
+	report := RunBatch(inputs, BatchOptions{Timeout: 50 * time.Millisecond, Workers: 2}, func(path string) (string, error) {
+		switch path {
+		case "panic.jpg":
+			var pixels []uint8
+			_ = pixels[10]
+		case "error.jpg":
+			return "", errors.New("corrupt file")
+		case "slow.jpg":
+			time.Sleep(time.Second)
+		}
+		return "", nil
+	})
+
+	if report.Succeeded != 2 {
+		t.Errorf("Expected 2 successes, got %d", report.Succeeded)
+	}
+	if len(report.Failures) != 3 {
+		t.Fatalf("Expected 3 failures, got %+v", report.Failures)
+	}
+	// Failures are reported in input order
+	if f := report.Failures[0]; f.File != "panic.jpg" || !f.Panicked {
+		t.Errorf("Expected a panic for panic.jpg, got %+v", f)
+	}
+	if f := report.Failures[1]; f.File != "error.jpg" || f.Error != "corrupt file" || f.Panicked || f.TimedOut {
+		t.Errorf("Expected an error for error.jpg, got %+v", f)
+	}
+	if f := report.Failures[2]; f.File != "slow.jpg" || !f.TimedOut {
+		t.Errorf("Expected a timeout for slow.jpg, got %+v", f)
+	}
+
+	var statuses []string
+	for _, file := range report.Files {
+		statuses = append(statuses, file.Status)
+	}
+	if fmt.Sprint(statuses) != "[ok panic error timeout ok]" {
+		t.Errorf("Unexpected file statuses %v", statuses)
+	}
+}
+
+func TestProcessBatch(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	var inputs []string
+	for i := range 4 {
+		path := filepath.Join(testDir, fmt.Sprintf("test_input_process_%d.png", i))
+		if err := generateSingleTestImage(path, 60, 40); err != nil {
+			t.Fatalf("Failed to generate test image: %v", err)
+		}
+		inputs = append(inputs, path)
+	}
+	inputs = append(inputs, filepath.Join(testDir, "missing.png"))
+	outputDir := filepath.Join(testDir, "out")
+
+	var calls [][2]int
+	report, err := ProcessBatch(context.Background(), inputs, outputDir, BinarizeImage, BatchOptions{Workers: 2, Progress: progressRecorder(&calls)})
+	if err != nil {
+		t.Fatalf("Failed to process the batch: %v", err)
+	}
+	checkProgress(t, "batch", calls)
+	if report.Succeeded != 4 || len(report.Failures) != 1 || report.Failures[0].File != inputs[4] {
+		t.Errorf("Expected 4 successes and the missing file failed, got %+v", report)
+	}
+	if out := report.Files[0].Output; out != filepath.Join(outputDir, "test_input_process_0.jpg") || report.Files[0].OutputWidth != 60 {
+		t.Errorf("Expected a JPEG named after the input, got %+v", report.Files[0])
+	}
+
+	// Files not started once the context is cancelled are left alone
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err = ProcessBatch(ctx, inputs, outputDir, func(inputPath, outputPath string) error {
+		t.Errorf("Expected no file processed after cancellation, got %s", inputPath)
+		return nil
+	}, BatchOptions{OutputExt: "png"})
+	if !errors.Is(err, context.Canceled) || report.Cancelled != len(inputs) || report.Files[0].Status != "cancelled" {
+		t.Errorf("Expected every file cancelled, got %v and %+v", err, report)
+	}
+
+	// Inputs differing only in their extension would overwrite each other
+	colliding := []string{inputs[0], strings.TrimSuffix(inputs[0], ".png") + ".JPG"}
+	if _, err := ProcessBatch(context.Background(), colliding, outputDir, BinarizeImage, BatchOptions{}); err == nil {
+		t.Error("Expected an error for inputs written to the same output")
+	}
+}
+
+func TestRunBatchReport(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_batch.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_batch.jpg")
+	if err := generateSingleTestImage(testInputPath, 100, 80); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	report := RunBatch([]string{testInputPath}, BatchOptions{}, func(path string) (string, error) {
+		return testOutputPath, ResizeImage(path, testOutputPath, 50, 40)
+	})
+	if len(report.Files) != 1 {
+		t.Fatalf("Expected 1 file record, got %d", len(report.Files))
+	}
+	file := report.Files[0]
+	if file.Status != "ok" || file.Output != testOutputPath {
+		t.Errorf("Unexpected file record %+v", file)
+	}
+	if file.InputWidth != 100 || file.InputHeight != 80 || file.OutputWidth != 50 || file.OutputHeight != 40 {
+		t.Errorf("Unexpected dimensions in %+v", file)
+	}
+	if file.InputBytes == 0 || file.OutputBytes == 0 || file.DurationMS <= 0 {
+		t.Errorf("Expected sizes and timing in %+v", file)
+	}
+}
+
+func TestRunBatchFileMetadata(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_meta.jpg")
+	testLinkPath := filepath.Join(testDir, "test_input_link.jpg")
+	if err := generateSingleTestImage(testInputPath, 40, 30); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	if err := os.Symlink(testInputPath, testLinkPath); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(testInputPath, mtime, mtime); err != nil {
+		t.Fatalf("Failed to set input time: %v", err)
+	}
+	if err := os.Chmod(testInputPath, 0o640); err != nil {
+		t.Fatalf("Failed to set input mode: %v", err)
+	}
+
+	opts := BatchOptions{Symlinks: SymlinkSkip, PreserveTimes: true, PreserveMode: true}
+	report := RunBatch([]string{testInputPath, testLinkPath}, opts, func(path string) (string, error) {
+		output := filepath.Join(testDir, "out_"+filepath.Base(path))
+		return output, BinarizeImage(path, output)
+	})
+	if report.Succeeded != 1 || report.Skipped != 1 || len(report.Failures) != 0 {
+		t.Fatalf("Expected 1 success and 1 skip, got %+v", report)
+	}
+	if report.Files[1].Status != "skipped" {
+		t.Errorf("Expected the link to be skipped, got %q", report.Files[1].Status)
+	}
+
+	info, err := os.Stat(report.Files[0].Output)
+	if err != nil {
+		t.Fatalf("Failed to stat output: %v", err)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("Expected modification time %v, got %v", mtime, info.ModTime())
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("Expected mode 0640, got %v", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,176 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"os"
+)
+
+const (
+	// DefaultBlankCoverage is the ink coverage below which a page is blank
+	DefaultBlankCoverage = 0.0001
+	// DefaultBlankMargin is the fraction of each side ignored by blank page
+	// detection, where scanners leave shadows and the edges of the sheet
+	DefaultBlankMargin = 0.05
+	// blankInkLevel is the gray level below which a flattened pixel is ink
+	blankInkLevel = 128
+	// blankNeighbors is the number of the 8 neighbors of an ink pixel that
+	// must be ink too, so dust and sensor noise are not counted
+	blankNeighbors = 2
+)
+
+// BlankOptions are the parameters of blank page detection
+type BlankOptions struct {
+	// Coverage is the fraction of ink below which a page is blank; zero uses
+	// DefaultBlankCoverage
+	Coverage float64
+	// Margin is the fraction of the width and height ignored on each side;
+	// zero uses DefaultBlankMargin and a negative value checks the whole page
+	Margin float64
+}
+
+// BlankResult is the outcome of blank page detection
+type BlankResult struct {
+	Blank bool `json:"blank"`
+	// Coverage is the fraction of the page, within the margins, covered by ink
+	Coverage float64 `json:"coverage"`
+	// Threshold is the coverage below which the page was found blank
+	Threshold float64 `json:"threshold"`
+}
+
+// DetectBlankImage reports whether the input is a blank page, such as the
+// back of a single-sided sheet fed through a duplex scanner. The lighting is
+// flattened as by DocCleanImage, so the paper is white however the page was
+// lit, and the dark pixels inside the margins are counted as ink, except
+// isolated ones left by dust and noise. The page is blank when the ink covers
+// less than the coverage of opts.
+// It takes the path of the input file and the options.
+// Returns the ink coverage and whether the page is blank, or an error if the
+// operation fails.
+func DetectBlankImage(inputPath string, opts BlankOptions) (*BlankResult, error) {
+	slog.Info("detecting blank page", "input", inputPath)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	result := DetectBlank(img, opts)
+	slog.Info("blank page detection finished",
+		"blank", result.Blank,
+		"coverage", result.Coverage)
+	return result, nil
+}
+
+// DetectBlankImageReader reports whether the image read from r is a blank
+// page like DetectBlankImage.
+// Returns the ink coverage and whether the page is blank, or an error if the
+// operation fails.
+func DetectBlankImageReader(r io.Reader, opts BlankOptions) (*BlankResult, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	return DetectBlank(img, opts), nil
+}
+
+// DetectBlank reports whether the image is a blank page like
+// DetectBlankImage.
+func DetectBlank(img image.Image, opts BlankOptions) *BlankResult {
+	threshold := opts.Coverage
+	if threshold <= 0 {
+		threshold = DefaultBlankCoverage
+	}
+	margin := opts.Margin
+	switch {
+	case margin == 0:
+		margin = DefaultBlankMargin
+	case margin < 0:
+		margin = 0
+	}
+
+	flat := flattenIllumination(toRGBA(img))
+	w, h := flat.Rect.Dx(), flat.Rect.Dy()
+	ink := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := flat.RGBAAt(x, y)
+			ink[y*w+x] = (299*int(c.R)+587*int(c.G)+114*int(c.B))/1000 < blankInkLevel
+		}
+	}
+
+	mx, my := int(float64(w)*min(margin, 0.45)), int(float64(h)*min(margin, 0.45))
+	inked, total := 0, 0
+	for y := my; y < h-my; y++ {
+		for x := mx; x < w-mx; x++ {
+			total++
+			if !ink[y*w+x] {
+				continue
+			}
+			neighbors := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if (dx != 0 || dy != 0) && nx >= 0 && nx < w && ny >= 0 && ny < h && ink[ny*w+nx] {
+						neighbors++
+					}
+				}
+			}
+			if neighbors >= blankNeighbors {
+				inked++
+			}
+		}
+	}
+
+	result := &BlankResult{Blank: true, Threshold: threshold}
+	if total > 0 {
+		result.Coverage = float64(inked) / float64(total)
+		result.Blank = result.Coverage < threshold
+	}
+	return result
+}
+
+// BlankPolicy selects what batch runs do with blank pages
+type BlankPolicy string
+
+const (
+	// BlankKeep processes blank pages like any other
+	BlankKeep BlankPolicy = "keep"
+	// BlankSkip leaves blank pages out of the output and reports them as
+	// skipped
+	BlankSkip BlankPolicy = "skip"
+	// BlankDelete skips blank pages like BlankSkip and deletes their input
+	// files
+	BlankDelete BlankPolicy = "delete"
+)
+
+// ParseBlankPolicy converts a policy name to a BlankPolicy.
+// An empty name selects BlankKeep.
+func ParseBlankPolicy(name string) (BlankPolicy, error) {
+	switch BlankPolicy(name) {
+	case "", BlankKeep:
+		return BlankKeep, nil
+	case BlankSkip, BlankDelete:
+		return BlankPolicy(name), nil
+	}
+	return "", fmt.Errorf("invalid blank page policy %q (want keep, skip or delete)", name)
+}
+
+// skipBlank reports whether the input is a blank page to be left out of a
+// batch run, deleting it when opts asks for it
+func skipBlank(inputPath string, opts BatchOptions) (bool, error) {
+	if opts.Blank == "" || opts.Blank == BlankKeep {
+		return false, nil
+	}
+	result, err := DetectBlankImage(inputPath, opts.BlankOptions)
+	if err != nil || !result.Blank {
+		return false, err
+	}
+	if opts.Blank == BlankDelete {
+		if err := os.Remove(inputPath); err != nil {
+			return true, &ErrInvalidInput{Path: inputPath, Err: err}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,87 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// scannedPage draws unevenly lit paper with sensor noise, dust, a shadow
+// along the left edge and the given line of text
+func scannedPage(text string) *image.RGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, 600, 800))
+	for y := 0; y < 800; y++ {
+		for x := 0; x < 600; x++ {
+			v := 235 - x*60/600 + rng.Intn(13) - 6
+			if x < 20 {
+				v = 40
+			}
+			img.SetRGBA(x, y, color.RGBA{uint8(v), uint8(v), uint8(v - 10), 255})
+		}
+	}
+	for range 40 {
+		img.SetRGBA(30+rng.Intn(540), 30+rng.Intn(740), color.RGBA{20, 20, 20, 255})
+	}
+	d := font.Drawer{Dst: img, Src: image.NewUniform(color.RGBA{30, 30, 40, 255}), Face: basicfont.Face7x13, Dot: fixed.P(100, 300)}
+	d.DrawString(text)
+	return img
+}
+
+func TestDetectBlank(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		text      string
+		opts      BlankOptions
+		wantBlank bool
+	}{
+		{"blank", "", BlankOptions{}, true},
+		{"one line", "Signed on the 3rd of May", BlankOptions{}, false},
+		{"one line below a high threshold", "Signed on the 3rd of May", BlankOptions{Coverage: 0.01}, true},
+		{"shadow without margin", "", BlankOptions{Margin: -1}, false},
+	} {
+		result := DetectBlank(scannedPage(tt.text), tt.opts)
+		if result.Blank != tt.wantBlank {
+			t.Errorf("%s: expected blank %v, got %+v", tt.name, tt.wantBlank, result)
+		}
+	}
+}
+
+func TestRunBatchBlank(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	encode := func(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) }
+
+	for _, policy := range []BlankPolicy{BlankSkip, BlankDelete} {
+		blank := writeTestImage(t, testDir, "test_input_blank.jpg", scannedPage(""), encode)
+		text := writeTestImage(t, testDir, "test_input_text.jpg", scannedPage("Signed on the 3rd of May"), encode)
+		var processed []string
+		report := RunBatch([]string{blank, text}, BatchOptions{Workers: 1, Blank: policy}, func(path string) (string, error) {
+			processed = append(processed, path)
+			return "", nil
+		})
+		if report.Succeeded != 1 || report.Skipped != 1 || len(processed) != 1 || processed[0] != text {
+			t.Errorf("%s: expected only the text page processed, got %+v", policy, report)
+		}
+		if f := report.Files[0]; f.Status != "skipped" || !f.Blank {
+			t.Errorf("%s: expected the blank page skipped, got %+v", policy, f)
+		}
+		_, err := os.Stat(filepath.Join(testDir, "test_input_blank.jpg"))
+		if deleted := os.IsNotExist(err); deleted != (policy == BlankDelete) {
+			t.Errorf("%s: expected the blank input deleted %v, got %v", policy, policy == BlankDelete, err)
+		}
+	}
+
+	if _, err := ParseBlankPolicy("discard"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,279 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"math"
+	"sort"
+)
+
+// defaultBookStrips is the number of vertical strips the text lines are
+// traced across by default
+const defaultBookStrips = 24
+
+// minBookStrips is the fewest strips a curve can be traced across
+const minBookStrips = 4
+
+// minBookLines is the fewest text lines BookDewarp fits the page to; the
+// model has a curve and its change down the page to find
+const minBookLines = 3
+
+// BookDewarpOptions controls BookDewarp
+type BookDewarpOptions struct {
+	// Strips is the number of vertical strips the text lines are traced
+	// across; zero is 24. More strips follow sharper curls on large images.
+	Strips int
+}
+
+// BookDewarpResult describes the curl BookDewarp removed from a page
+type BookDewarpResult struct {
+	// Lines is the number of text lines the curl was measured from
+	Lines int `json:"lines"`
+	// MaxShift is the largest vertical distance in pixels a part of the page
+	// was moved
+	MaxShift float64 `json:"max_shift"`
+}
+
+// BookDewarpImage flattens the curled page of an open book photographed from
+// above, as BookDewarp.
+// It takes the paths of the input and output files and the options.
+// Returns the number of text lines measured and the largest correction, or
+// an error if the page has too few text lines or the operation fails.
+func BookDewarpImage(inputPath string, outputPath string, opts BookDewarpOptions) (*BookDewarpResult, error) {
+	slog.Info("dewarping book page",
+		"input", inputPath,
+		"output", outputPath,
+		"strips", opts.Strips)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	page, result, err := BookDewarp(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveJPEG(outputPath, page); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// BookDewarpImageReader flattens the curled page read from r and writes it to
+// w as JPEG, like BookDewarpImage.
+// Returns the number of text lines measured and the largest correction, or
+// an error if the page has too few text lines or the operation fails.
+func BookDewarpImageReader(r io.Reader, w io.Writer, opts BookDewarpOptions) (*BookDewarpResult, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	page, result, err := BookDewarp(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := encodeJPEG(w, page); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// BookDewarp straightens the text lines of a page that curls toward the spine
+// of an open book, which DocDewarp cannot do since the page is not flat. The
+// page is modeled as a cylinder with its axis along the spine: seen from
+// above, every line bends by the same curve of x, scaled by how far down the
+// page it is. The text is separated from the paper as in SplitMRC and the
+// centers of the lines are traced across opts.Strips vertical strips; the
+// shift of the lines from their median heights is fitted with a cubic in x
+// plus a cubic in x times y, and each column is moved vertically by it. Slight
+// skew is removed along with the curl, but the text squeezed toward the spine
+// keeps its width. The page should be cropped and upright, as DocDewarp and
+// AutoRotate leave it, and hold lines of text across most of its width.
+// Returns the flattened page and the correction, or an error if the options
+// are invalid or the page has too few text lines to fit.
+func BookDewarp(img image.Image, opts BookDewarpOptions) (image.Image, *BookDewarpResult, error) {
+	strips := opts.Strips
+	if strips == 0 {
+		strips = defaultBookStrips
+	}
+	rgba := toRGBA(img)
+	w, h := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	if strips < minBookStrips || strips > w {
+		return nil, nil, &ErrProcessing{Op: "bookdewarp", Err: fmt.Errorf("strips must be between %d and the width %d, got %d", minBookStrips, w, strips)}
+	}
+
+	text, _ := textMask(rgba, 0)
+	lines := traceTextLines(text, w, h, strips)
+	if len(lines) < minBookLines {
+		return nil, nil, &ErrProcessing{Op: "bookdewarp", Err: fmt.Errorf("found %d text lines across the page, at least %d are needed", len(lines), minBookLines)}
+	}
+	curl, err := fitCurl(lines, w, h)
+	if err != nil {
+		return nil, nil, &ErrProcessing{Op: "bookdewarp", Err: fmt.Errorf("the text lines do not fit a curl: %w", err)}
+	}
+
+	result := &BookDewarpResult{Lines: len(lines)}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		a, b := curl.at(float64(x), w)
+		result.MaxShift = max(result.MaxShift, math.Abs(a), math.Abs(a+b))
+		for y := 0; y < h; y++ {
+			v := float64(y) + a + b*float64(y)/float64(h)
+			c := white
+			if v >= 0 && v <= float64(h-1) {
+				c = bilinearRGBA(rgba, float64(x), v)
+			}
+			dst.SetRGBA(x, y, c)
+		}
+	}
+	result.MaxShift = math.Round(result.MaxShift*10) / 10
+	return dst, result, nil
+}
+
+// textLine is a text line traced across the strips of a page: the center of
+// the line in every strip it was found in, as x and y
+type textLine [][2]float64
+
+// traceTextLines finds the centers of the text lines in every vertical strip
+// of the text mask and links them from strip to strip into lines, keeping
+// the lines found in half the strips or more
+func traceTextLines(text []bool, w, h, strips int) []textLine {
+	centers := make([][]float64, strips)
+	var gaps []float64
+	for s := range centers {
+		x0, x1 := s*w/strips, (s+1)*w/strips
+		profile := make([]float64, h)
+		for y := 0; y < h; y++ {
+			for _, ink := range text[y*w+x0 : y*w+x1] {
+				if ink {
+					profile[y]++
+				}
+			}
+		}
+		centers[s] = profileCenters(profile, x1-x0)
+		for i := 1; i < len(centers[s]); i++ {
+			gaps = append(gaps, centers[s][i]-centers[s][i-1])
+		}
+	}
+	if len(gaps) == 0 {
+		return nil
+	}
+	// A line moves less than half the distance to the next between strips,
+	// and rises or falls by less than 20 degrees, which keeps hatching and
+	// diagonal stripes from passing for lines
+	sort.Float64s(gaps)
+	tolerance := min(gaps[len(gaps)/2]*0.4, float64(w)/float64(strips)*0.35)
+
+	var tracks []textLine
+	var last []int
+	for s, ys := range centers {
+		x := (float64(s) + 0.5) * float64(w) / float64(strips)
+		taken := make([]bool, len(tracks))
+		for _, y := range ys {
+			best := -1
+			for i, track := range tracks {
+				// Lines are followed over a few strips of words missing
+				if taken[i] || s-last[i] > 3 {
+					continue
+				}
+				d := math.Abs(track[len(track)-1][1] - y)
+				if d <= tolerance && (best < 0 || d < math.Abs(tracks[best][len(tracks[best])-1][1]-y)) {
+					best = i
+				}
+			}
+			if best < 0 {
+				tracks = append(tracks, textLine{{x, y}})
+				last = append(last, s)
+				taken = append(taken, true)
+				continue
+			}
+			tracks[best] = append(tracks[best], [2]float64{x, y})
+			last[best] = s
+			taken[best] = true
+		}
+	}
+	var lines []textLine
+	for _, track := range tracks {
+		if len(track)*2 >= strips {
+			lines = append(lines, track)
+		}
+	}
+	return lines
+}
+
+// profileCenters splits the profile of a strip width pixels wide into lines,
+// runs of rows holding text, and returns the center of each weighted by its
+// text, which the dense core of the lowercase letters dominates
+func profileCenters(profile []float64, width int) []float64 {
+	floor := max(float64(width)*0.05, 1)
+	var centers []float64
+	for start := 0; start < len(profile); {
+		if profile[start] < floor {
+			start++
+			continue
+		}
+		end := start
+		var sum, weighted float64
+		for end < len(profile) && profile[end] >= floor {
+			sum += profile[end]
+			weighted += profile[end] * float64(end)
+			end++
+		}
+		// Specks of dirt are not lines
+		if end-start >= 3 {
+			centers = append(centers, weighted/sum)
+		}
+		start = end
+	}
+	return centers
+}
+
+// bookCurl is the shift of a curled page: a row y of column x is found at
+// y + a(x) + b(x) y/h in the photo, a and b being cubics in x scaled to -1..1
+type bookCurl [8]float64
+
+// at returns a(x) and b(x) for column x of a page w pixels wide
+func (c bookCurl) at(x float64, w int) (float64, float64) {
+	t := x/float64(w)*2 - 1
+	return c[0] + t*(c[1]+t*(c[2]+t*c[3])), c[4] + t*(c[5]+t*(c[6]+t*c[7]))
+}
+
+// fitCurl fits the curl to the traced lines by least squares, taking the
+// median height of every line as where it belongs
+func fitCurl(lines []textLine, w, h int) (bookCurl, error) {
+	a := make([][]float64, 8)
+	for i := range a {
+		a[i] = make([]float64, 8)
+	}
+	b := make([]float64, 8)
+	for _, line := range lines {
+		ys := make([]float64, len(line))
+		for i, p := range line {
+			ys[i] = p[1]
+		}
+		sort.Float64s(ys)
+		y0 := ys[len(ys)/2]
+		for _, p := range line {
+			t := p[0]/float64(w)*2 - 1
+			s := y0 / float64(h)
+			basis := [8]float64{1, t, t * t, t * t * t, s, s * t, s * t * t, s * t * t * t}
+			for i := range basis {
+				for j := range basis {
+					a[i][j] += basis[i] * basis[j]
+				}
+				b[i] += basis[i] * (p[1] - y0)
+			}
+		}
+	}
+	solution, err := solveLinear(a, b)
+	if err != nil {
+		return bookCurl{}, err
+	}
+	var c bookCurl
+	copy(c[:], solution)
+	return c, nil
+}
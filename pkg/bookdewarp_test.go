@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// curledPage returns a 400x300 page of text bars with its lines rising toward
+// the spine on the right by shift(x, y) pixels, as in a photo of an open book,
+// and the same page flat
+func curledPage(shift func(x, y float64) float64) (*image.RGBA, *image.RGBA) {
+	ink := func(x, y float64) bool {
+		return x >= 20 && x < 380 && y >= 20 && y < 280 && int(y)%20 < 8 && int(x)%30 < 24
+	}
+	paper, text := color.RGBA{240, 235, 225, 0xff}, color.RGBA{30, 30, 30, 0xff}
+	curled := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	flat := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			fx, fy := float64(x), float64(y)
+			curled.SetRGBA(x, y, paper)
+			if ink(fx, fy+shift(fx, fy)) {
+				curled.SetRGBA(x, y, text)
+			}
+			flat.SetRGBA(x, y, paper)
+			if ink(fx, fy) {
+				flat.SetRGBA(x, y, text)
+			}
+		}
+	}
+	return curled, flat
+}
+
+// blankRows returns the number of rows of the page with no ink across it
+func blankRows(img image.Image) int {
+	bounds := img.Bounds()
+	blank := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		dark := 0
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r>>8 < 128 {
+				dark++
+			}
+		}
+		if dark < 4 {
+			blank++
+		}
+	}
+	return blank
+}
+
+func TestBookDewarp(t *testing.T) {
+	shift := func(x, y float64) float64 {
+		t := x / 400
+		return (10 + 0.04*y) * t * t
+	}
+	curled, flat := curledPage(shift)
+	want := blankRows(flat)
+	if got := blankRows(curled); got > want/2 {
+		t.Fatalf("Expected the curl to smear the lines, %d of %d blank rows left", got, want)
+	}
+
+	page, result, err := BookDewarp(curled, BookDewarpOptions{})
+	if err != nil {
+		t.Fatalf("BookDewarp failed: %v", err)
+	}
+	if page.Bounds() != curled.Bounds() {
+		t.Errorf("Expected the size to be kept, got %v", page.Bounds())
+	}
+	if result.Lines < 10 || result.MaxShift < 8 || result.MaxShift > 30 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	// Straight lines leave the rows between them blank again
+	if got := blankRows(page); got < want*4/5 {
+		t.Errorf("Expected the lines to be straightened, %d of %d blank rows", got, want)
+	}
+
+	// A flat page is left as it is
+	same, result, err := BookDewarp(flat, BookDewarpOptions{})
+	if err != nil {
+		t.Fatalf("BookDewarp failed on a flat page: %v", err)
+	}
+	if result.MaxShift > 1 || blankRows(same) != want {
+		t.Errorf("Expected a flat page to stay flat, got %+v", result)
+	}
+
+	if _, _, err := BookDewarp(image.NewGray(image.Rect(0, 0, 100, 100)), BookDewarpOptions{}); err == nil {
+		t.Error("Expected an error for a page without text")
+	}
+	if _, _, err := BookDewarp(curled, BookDewarpOptions{Strips: 2}); err == nil {
+		t.Error("Expected an error for too few strips")
+	}
+
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	input := writeTestImage(t, testDir, "test_input.png", curled, encodePNGBuffer)
+	output := filepath.Join(testDir, "test_output.jpg")
+	if _, err := BookDewarpImage(input, output, BookDewarpOptions{Strips: 16}); err != nil {
+		t.Fatalf("BookDewarpImage failed: %v", err)
+	}
+	if got := decodeTestFile(t, output).Bounds(); got != curled.Bounds() {
+		t.Errorf("Expected a 400x300 output, got %v", got)
+	}
+}
@@ -0,0 +1,216 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// CaptionOptions label the images of a concatenation, so that a comparison
+// strip says what each image is. Every label is drawn on a band of its own
+// next to its image, so no pixels of the images are covered.
+type CaptionOptions struct {
+	// Labels are the texts of the images, in order. An image without a
+	// label, or with an empty one, is labeled with its file name.
+	Labels []string
+	// Gravity places the labels: gravities with Y below 0.5, such as north,
+	// put the bands above the images and the others below, and X aligns the
+	// text within its band. The zero value puts them above, on the left.
+	Gravity Gravity
+	// FontPath is a TrueType or OpenType font file, or a collection whose
+	// first font is used. The default Go Regular font only covers Latin,
+	// Greek and Cyrillic, so labels in other scripts need a font of their own.
+	FontPath string
+	// Size is the font size in pixels; zero scales it with the result, to
+	// 1/32 of its width when vertical and of its height when horizontal, and
+	// at least 12
+	Size float64
+	// Color is the color of the text; zero uses black
+	Color color.NRGBA
+	// Background fills the bands; zero uses white
+	Background color.NRGBA
+}
+
+// WithCaptions labels each image of a concatenation with a line of text on a
+// band above or below it
+func WithCaptions(opts CaptionOptions) Option {
+	return func(s *settings) {
+		s.captions = &opts
+	}
+}
+
+// minCaptionSize is the smallest font size picked for captions
+const minCaptionSize = 12
+
+// goRegular is the parsed default caption font
+var goRegular = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(goregular.TTF)
+})
+
+// captioner draws the labels of a concatenation. A font face is not safe for
+// concurrent use, so drawing is serialized; a label is quick to draw next to
+// decoding an image.
+type captioner struct {
+	mu      sync.Mutex
+	face    font.Face
+	labels  []string
+	gravity Gravity
+	above   bool
+	// band is the height of a band, pad the space around the text
+	band, pad int
+	fg, bg    *image.Uniform
+}
+
+// captioner returns the captioner set by WithCaptions for the sources, or
+// nil without one. The file names of the paths, if any, label the images
+// without a label of their own.
+func (s *settings) captioner(sources []concatSource, paths []string, vertical bool) (*captioner, error) {
+	if s.captions == nil {
+		return nil, nil
+	}
+	opts := s.captions
+	labels := make([]string, len(sources))
+	for i := range labels {
+		if i < len(opts.Labels) && opts.Labels[i] != "" {
+			labels[i] = opts.Labels[i]
+		} else if i < len(paths) {
+			labels[i] = filepath.Base(paths[i])
+		}
+	}
+
+	size := opts.Size
+	switch {
+	case size < 0:
+		return nil, &ErrProcessing{Op: "caption", Err: fmt.Errorf("font size must not be negative, got %g", size)}
+	case size == 0:
+		size = max(minCaptionSize, float64(concatSpan(sources, vertical))/32)
+	}
+	f, err := loadFont(opts.FontPath)
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, &ErrProcessing{Op: "caption", Err: err}
+	}
+
+	fg, bg := opts.Color, opts.Background
+	if fg.A == 0 {
+		fg = color.NRGBA{A: 255}
+	}
+	if bg.A == 0 {
+		bg = color.NRGBA{255, 255, 255, 255}
+	}
+	metrics := face.Metrics()
+	pad := max(2, int(size/4))
+	return &captioner{
+		face:    face,
+		labels:  labels,
+		gravity: opts.Gravity,
+		above:   opts.Gravity.Y < 0.5,
+		band:    (metrics.Ascent + metrics.Descent).Ceil() + 2*pad,
+		pad:     pad,
+		fg:      image.NewUniform(fg),
+		bg:      image.NewUniform(bg),
+	}, nil
+}
+
+// loadFont parses the font file at path, or returns the default font when
+// path is empty
+func loadFont(path string) (*opentype.Font, error) {
+	if path == "" {
+		f, err := goRegular()
+		if err != nil {
+			return nil, &ErrProcessing{Op: "caption", Err: err}
+		}
+		return f, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &ErrInvalidInput{Path: path, Err: err}
+	}
+	// A single font parses as a collection of one
+	collection, err := opentype.ParseCollection(data)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "caption", Err: fmt.Errorf("%s: %w", path, err)}
+	}
+	f, err := collection.Font(0)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "caption", Err: fmt.Errorf("%s: %w", path, err)}
+	}
+	return f, nil
+}
+
+// layout makes room for a band above or below each image placed by
+// concatLayout, returning the moved rectangles of the images and their bands
+func (c *captioner) layout(rects []image.Rectangle, vertical bool) (images, bands []image.Rectangle) {
+	images = make([]image.Rectangle, len(rects))
+	bands = make([]image.Rectangle, len(rects))
+	for i, r := range rects {
+		// Stacked images each push the following ones down by a band, side
+		// by side ones share a single row of bands
+		shift := 0
+		if vertical {
+			shift = i * c.band
+		}
+		if c.above {
+			shift += c.band
+		}
+		r = r.Add(image.Pt(0, shift))
+		images[i] = r
+		if c.above {
+			bands[i] = image.Rect(r.Min.X, r.Min.Y-c.band, r.Max.X, r.Min.Y)
+		} else {
+			bands[i] = image.Rect(r.Min.X, r.Max.Y, r.Max.X, r.Max.Y+c.band)
+		}
+	}
+	return images, bands
+}
+
+// draw fills the band of dst and writes label i in it, shortened with an
+// ellipsis when it does not fit
+func (c *captioner) draw(dst draw.Image, band image.Rectangle, i int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	draw.Draw(dst, band, c.bg, image.Point{}, draw.Src)
+	text := c.fit(c.labels[i], band.Dx()-2*c.pad)
+	if text == "" {
+		return
+	}
+	metrics := c.face.Metrics()
+	size := image.Pt(font.MeasureString(c.face, text).Ceil(), (metrics.Ascent + metrics.Descent).Ceil())
+	r := Gravity{X: c.gravity.X, Y: 0.5}.Place(band, size, c.pad)
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  c.fg,
+		Face: c.face,
+		Dot:  fixed.P(r.Min.X, r.Min.Y+metrics.Ascent.Ceil()),
+	}
+	d.DrawString(text)
+}
+
+// fit returns text, or its longest prefix followed by an ellipsis that fits
+// in width pixels, or nothing when not even the ellipsis fits
+func (c *captioner) fit(text string, width int) string {
+	if font.MeasureString(c.face, text).Ceil() <= width {
+		return text
+	}
+	runes := []rune(text)
+	for n := len(runes) - 1; n >= 0; n-- {
+		shortened := string(runes[:n]) + "…"
+		if font.MeasureString(c.face, shortened).Ceil() <= width {
+			return shortened
+		}
+	}
+	return ""
+}
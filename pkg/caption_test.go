@@ -0,0 +1,173 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSolidPNGs writes n solid gray PNGs of different sizes and returns their paths
+func writeSolidPNGs(t *testing.T, dir string, n int) []string {
+	t.Helper()
+	var paths []string
+	for i := 0; i < n; i++ {
+		img := image.NewRGBA(image.Rect(0, 0, 200+i*40, 80+i*20))
+		draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{128, 128, 128, 255}}, image.Point{}, draw.Src)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatalf("Failed to encode test image: %v", err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("test_caption_%d.png", i))
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("Failed to write test image: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// hasColor reports whether any pixel of r in img is c
+func hasColor(img *image.RGBA, r image.Rectangle, c color.RGBA) bool {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if img.RGBAAt(x, y) == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestCaptions(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	paths := writeSolidPNGs(t, testDir, 3)
+	sources, err := Default().fileSources(paths)
+	if err != nil {
+		t.Fatalf("Failed to read sources: %v", err)
+	}
+	black := color.RGBA{0, 0, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+	gray := color.RGBA{128, 128, 128, 255}
+
+	for _, tt := range []struct {
+		gravity  Gravity
+		vertical bool
+	}{
+		{GravitySouth, true},
+		{GravityNorthWest, true},
+		{GravitySouthEast, false},
+		{GravityNorth, false},
+	} {
+		s, err := newSettings("concatenate", []Option{WithCaptions(CaptionOptions{Gravity: tt.gravity, Size: 14})})
+		if err != nil {
+			t.Fatalf("Failed to apply options: %v", err)
+		}
+		captions, err := s.captioner(sources, paths, tt.vertical)
+		if err != nil {
+			t.Fatalf("Failed to prepare captions: %v", err)
+		}
+		concatenated, err := concatenate(sources, tt.vertical, captions, nil)
+		if err != nil {
+			t.Fatalf("Failed to concatenate: %v", err)
+		}
+		rects, bands := captions.layout(concatLayout(sources, tt.vertical), tt.vertical)
+
+		plain := concatLayout(sources, tt.vertical)
+		want := plain[len(plain)-1].Max.Add(image.Pt(0, captions.band))
+		if tt.vertical {
+			want = plain[len(plain)-1].Max.Add(image.Pt(0, len(plain)*captions.band))
+		}
+		if got := concatenated.Bounds().Max; got != want {
+			t.Errorf("%v: expected the result to end at %v, got %v", tt.gravity, want, got)
+		}
+		for i, band := range bands {
+			if rects[i].Overlaps(band) {
+				t.Errorf("%v: band %v covers image %v", tt.gravity, band, rects[i])
+			}
+			if above := band.Max.Y <= rects[i].Min.Y; above != (tt.gravity.Y < 0.5) {
+				t.Errorf("%v: expected the band above only for northern gravities, got %v for %v", tt.gravity, band, rects[i])
+			}
+			if !hasColor(concatenated, band, black) || !hasColor(concatenated, band, white) {
+				t.Errorf("%v: expected black text on white in band %d", tt.gravity, i)
+			}
+			if hasColor(concatenated, rects[i].Inset(1), white) || !hasColor(concatenated, rects[i], gray) {
+				t.Errorf("%v: expected image %d to be left as is", tt.gravity, i)
+			}
+		}
+	}
+}
+
+func TestCaptionOptions(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	paths := writeSolidPNGs(t, testDir, 2)
+	sources, err := Default().fileSources(paths)
+	if err != nil {
+		t.Fatalf("Failed to read sources: %v", err)
+	}
+
+	// Custom labels replace the file names, a long one is shortened and
+	// the colors of the text and band are set
+	red := color.NRGBA{255, 0, 0, 255}
+	s, _ := newSettings("concatenate", []Option{WithCaptions(CaptionOptions{
+		Labels:     []string{"", strings.Repeat("long label ", 40)},
+		Gravity:    GravitySouth,
+		Color:      red,
+		Background: color.NRGBA{0, 0, 255, 255},
+	})})
+	captions, err := s.captioner(sources, paths, true)
+	if err != nil {
+		t.Fatalf("Failed to prepare captions: %v", err)
+	}
+	if captions.labels[0] != "test_caption_0.png" {
+		t.Errorf("Expected the file name as the first label, got %q", captions.labels[0])
+	}
+	if fitted := captions.fit(captions.labels[1], 280); !strings.HasSuffix(fitted, "…") {
+		t.Errorf("Expected a long label to be shortened, got %q", fitted)
+	}
+	concatenated, err := concatenate(sources, true, captions, nil)
+	if err != nil {
+		t.Fatalf("Failed to concatenate: %v", err)
+	}
+	_, bands := captions.layout(concatLayout(sources, true), true)
+	for i, band := range bands {
+		if !hasColor(concatenated, band, color.RGBA{255, 0, 0, 255}) || !hasColor(concatenated, band, color.RGBA{0, 0, 255, 255}) {
+			t.Errorf("Expected red text on blue in band %d", i)
+		}
+	}
+
+	// The streamed PNG has the same captions
+	var out bytes.Buffer
+	if err := streamVertically(&out, sources, captions, nil); err != nil {
+		t.Fatalf("Failed to stream: %v", err)
+	}
+	streamed, err := png.Decode(&out)
+	if err != nil {
+		t.Fatalf("Failed to decode the streamed output: %v", err)
+	}
+	if !bytes.Equal(toRGBA(streamed).Pix, concatenated.Pix) {
+		t.Error("Expected the streamed captions to match")
+	}
+
+	missing := filepath.Join(testDir, "missing.ttf")
+	s, _ = newSettings("concatenate", []Option{WithCaptions(CaptionOptions{FontPath: missing})})
+	_, err = s.captioner(sources, paths, true)
+	var inputErr *ErrInvalidInput
+	if !errors.As(err, &inputErr) || inputErr.Path != missing {
+		t.Errorf("Expected an invalid input error for %s, got %v", missing, err)
+	}
+	s, _ = newSettings("concatenate", []Option{WithCaptions(CaptionOptions{FontPath: paths[0]})})
+	var procErr *ErrProcessing
+	if _, err := s.captioner(sources, paths, true); !errors.As(err, &procErr) {
+		t.Errorf("Expected a processing error for a file that is not a font, got %v", err)
+	}
+}
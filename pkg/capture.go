@@ -0,0 +1,246 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nfnt/resize"
+)
+
+// defaultBoxWidth is the line width of the outlines drawn by capture
+const defaultBoxWidth = 3
+
+// CaptureOptions controls CaptureScreen. The steps run in the order of the
+// fields: the screenshot is cropped, redacted, annotated, fitted and passed
+// through the recipe before it is written.
+type CaptureOptions struct {
+	// Window is the id of the window to capture in the platform's window
+	// system; empty captures the whole screen
+	Window string
+	// Delay waits before capturing, for example to open a menu
+	Delay time.Duration
+	// Region, when not empty, is the part of the screenshot to keep
+	Region Box
+	// Redact lists rectangles that are filled in black, hiding passwords and
+	// personal data for good
+	Redact []Box
+	// Boxes lists rectangles to outline, pointing at parts of the screenshot
+	Boxes []Box
+	// BoxColor is the color of the outlines; zero uses red
+	BoxColor color.NRGBA
+	// Width and Height shrink the screenshot to fit; zero leaves a side free
+	Width, Height int
+	// Recipe, when set, is applied last
+	Recipe *Recipe
+	// Clipboard copies the result to the clipboard
+	Clipboard bool
+}
+
+// CaptureResult describes a screenshot
+type CaptureResult struct {
+	// Tool is the program that took the screenshot
+	Tool   string `json:"tool"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// CaptureScreen takes a screenshot of the screen or a window and prepares it
+// for documentation: the region, redactions and outlines are in pixels of
+// the screenshot, before it is fitted. Screenshots are taken with the tools
+// of the platform: screencapture on macOS, grim on Wayland, ImageMagick's
+// import on X11 and PowerShell on Windows.
+// It takes the path of the output PNG, which may be empty when the result
+// only goes to the clipboard, and the options.
+// Returns the size of the result, or an error if no tool could take it.
+func CaptureScreen(outputPath string, opts CaptureOptions) (*CaptureResult, error) {
+	if outputPath == "" && !opts.Clipboard {
+		return nil, &ErrInvalidOutput{Path: outputPath}
+	}
+	if opts.Delay > 0 {
+		time.Sleep(opts.Delay)
+	}
+
+	dir := currentConfig().TempDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	workDir, err := os.MkdirTemp(dir, "capture-*")
+	if err != nil {
+		return nil, &ErrProcessing{Op: "capture", Err: err}
+	}
+	defer os.RemoveAll(workDir)
+
+	shotPath := filepath.Join(workDir, "screen.png")
+	tool, args, err := captureCommand(opts.Window, shotPath)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "capture", Err: err}
+	}
+	slog.Info("capturing screen", "tool", tool, "window", opts.Window)
+	if output, err := exec.Command(tool, args...).CombinedOutput(); err != nil {
+		return nil, &ErrProcessing{Op: "capture", Err: fmt.Errorf("%s: %v: %s", tool, err, strings.TrimSpace(string(output)))}
+	}
+	shot, err := loadImage(shotPath)
+	if err != nil {
+		return nil, err
+	}
+
+	img := toRGBA(shot)
+	if opts.Region.Width > 0 && opts.Region.Height > 0 {
+		r := opts.Region.Rect().Intersect(img.Bounds())
+		if r.Empty() {
+			return nil, &ErrProcessing{Op: "capture", Err: fmt.Errorf("region %v is outside the %dx%d screenshot", opts.Region.Rect(), img.Bounds().Dx(), img.Bounds().Dy())}
+		}
+		img = toRGBA(img.SubImage(r))
+	}
+	for _, b := range opts.Redact {
+		draw.Draw(img, b.Rect(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	}
+	boxColor := opts.BoxColor
+	if boxColor.A == 0 {
+		boxColor = color.NRGBA{R: 255, A: 255}
+	}
+	for _, b := range opts.Boxes {
+		outlineBox(img, b.Rect(), boxColor, defaultBoxWidth)
+	}
+	var result image.Image = img
+	if w, h := img.Bounds().Dx(), img.Bounds().Dy(); opts.Width > 0 || opts.Height > 0 {
+		maxWidth, maxHeight := opts.Width, opts.Height
+		if maxWidth <= 0 {
+			maxWidth = w
+		}
+		if maxHeight <= 0 {
+			maxHeight = h
+		}
+		if w > maxWidth || h > maxHeight {
+			result = resize.Thumbnail(uint(maxWidth), uint(maxHeight), img, resize.Lanczos3)
+		}
+	}
+
+	finalPath := filepath.Join(workDir, "capture.png")
+	if err := savePNG(finalPath, result); err != nil {
+		return nil, err
+	}
+	if opts.Recipe != nil {
+		recipePath := filepath.Join(workDir, "recipe.png")
+		if _, err := opts.Recipe.Run(finalPath, recipePath); err != nil {
+			return nil, err
+		}
+		finalPath = recipePath
+	}
+	if outputPath != "" {
+		if err := copyFile(finalPath, outputPath); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Clipboard {
+		if err := copyImageToClipboard(finalPath); err != nil {
+			return nil, &ErrProcessing{Op: "clipboard", Err: err}
+		}
+	}
+
+	file, err := os.Open(finalPath)
+	if err != nil {
+		return nil, &ErrInvalidInput{Path: finalPath, Err: err}
+	}
+	defer file.Close()
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "decode", Err: err}
+	}
+	return &CaptureResult{Tool: filepath.Base(tool), Width: config.Width, Height: config.Height}, nil
+}
+
+// outlineBox draws the outline of r, width pixels thick, inside r
+func outlineBox(img *image.RGBA, r image.Rectangle, c color.Color, width int) {
+	src := image.NewUniform(c)
+	width = min(width, r.Dx()/2, r.Dy()/2)
+	for _, side := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+width),
+		image.Rect(r.Min.X, r.Max.Y-width, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+width, r.Max.Y),
+		image.Rect(r.Max.X-width, r.Min.Y, r.Max.X, r.Max.Y),
+	} {
+		draw.Draw(img, side, src, image.Point{}, draw.Over)
+	}
+}
+
+// captureCommand returns the program and arguments that write a screenshot
+// of the screen, or of a window when one is given, to path as PNG
+func captureCommand(window string, path string) (string, []string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		args := []string{"-x", "-t", "png"}
+		if window != "" {
+			args = append(args, "-l"+window)
+		}
+		return "screencapture", append(args, path), nil
+	case "windows":
+		if window != "" {
+			return "", nil, errors.New("window capture is not supported on Windows; capture the screen with a region instead")
+		}
+		script := `Add-Type -AssemblyName System.Windows.Forms,System.Drawing
+$b = [System.Windows.Forms.SystemInformation]::VirtualScreen
+$bmp = New-Object System.Drawing.Bitmap $b.Width, $b.Height
+$g = [System.Drawing.Graphics]::FromImage($bmp)
+$g.CopyFromScreen($b.Left, $b.Top, 0, 0, $bmp.Size)
+$bmp.Save($args[0], [System.Drawing.Imaging.ImageFormat]::Png)`
+		return "powershell", []string{"-NoProfile", "-NonInteractive", "-Command", "& {" + script + "}", path}, nil
+	}
+
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if window != "" {
+			return "", nil, errors.New("window capture needs X11; capture the screen with a region instead")
+		}
+		if _, err := exec.LookPath("grim"); err != nil {
+			return "", nil, errors.New("screen capture on Wayland needs grim")
+		}
+		return "grim", []string{"-t", "png", path}, nil
+	}
+	if _, err := exec.LookPath("import"); err != nil {
+		return "", nil, errors.New("screen capture on X11 needs ImageMagick's import")
+	}
+	if window == "" {
+		window = "root"
+	}
+	return "import", []string{"-window", window, "png:" + path}, nil
+}
+
+// copyImageToClipboard puts the PNG at path on the clipboard with the tools
+// of the platform. wl-copy and xclip keep running in the background to serve
+// the clipboard, so their output is not collected, which would wait for them.
+func copyImageToClipboard(path string) error {
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "darwin":
+		cmd = exec.Command("osascript", "-e",
+			fmt.Sprintf(`set the clipboard to (read (POSIX file %q) as «class PNGf»)`, path))
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command",
+			`& {Add-Type -AssemblyName System.Windows.Forms,System.Drawing; [System.Windows.Forms.Clipboard]::SetImage([System.Drawing.Image]::FromFile($args[0]))}`, path)
+	default:
+		cmd = exec.Command("xclip", "-selection", "clipboard", "-target", "image/png", "-in")
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			cmd = exec.Command("wl-copy", "--type", "image/png")
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		cmd.Stdin = file
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCaptureScreen(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the fake capture tools are shell scripts for Wayland")
+	}
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// A white 200x100 "screen"
+	screen := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for i := range screen.Pix {
+		screen.Pix[i] = 255
+	}
+	screenPath := filepath.Join(testDir, "screen.png")
+	if err := savePNG(screenPath, screen); err != nil {
+		t.Fatalf("Failed to save screen: %v", err)
+	}
+	clipboardPath := filepath.Join(testDir, "clipboard.png")
+	bin := filepath.Join(testDir, "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	tools := map[string]string{
+		"grim":    "#!/bin/sh\ncp \"$GIP_TEST_SCREEN\" \"$3\"\n",
+		"wl-copy": "#!/bin/sh\ncat > \"$GIP_TEST_CLIPBOARD\"\n",
+	}
+	for name, script := range tools {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("WAYLAND_DISPLAY", "wayland-test")
+	t.Setenv("GIP_TEST_SCREEN", screenPath)
+	t.Setenv("GIP_TEST_CLIPBOARD", clipboardPath)
+
+	outputPath := filepath.Join(testDir, "shot.png")
+	result, err := CaptureScreen(outputPath, CaptureOptions{
+		Region:    Box{X: 20, Y: 10, Width: 100, Height: 80},
+		Redact:    []Box{{X: 0, Y: 0, Width: 10, Height: 10}},
+		Boxes:     []Box{{X: 50, Y: 20, Width: 40, Height: 40}},
+		Width:     50,
+		Height:    50,
+		Clipboard: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to capture: %v", err)
+	}
+	if result.Tool != "grim" || result.Width != 50 || result.Height != 40 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if _, err := os.Stat(clipboardPath); err != nil {
+		t.Errorf("Expected the capture on the clipboard: %v", err)
+	}
+
+	// Without fitting, the edits can be checked pixel by pixel
+	if _, err := CaptureScreen(outputPath, CaptureOptions{
+		Region: Box{X: 20, Y: 10, Width: 100, Height: 80},
+		Redact: []Box{{X: 0, Y: 0, Width: 10, Height: 10}},
+		Boxes:  []Box{{X: 50, Y: 20, Width: 40, Height: 40}},
+	}); err != nil {
+		t.Fatalf("Failed to capture: %v", err)
+	}
+	shot, err := loadImage(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to load capture: %v", err)
+	}
+	checks := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{5, 5, color.RGBA{0, 0, 0, 255}},         // redacted
+		{51, 30, color.RGBA{255, 0, 0, 255}},     // outline
+		{70, 40, color.RGBA{255, 255, 255, 255}}, // inside the outline
+	}
+	for _, c := range checks {
+		if got := color.RGBAModel.Convert(shot.At(c.x, c.y)); got != c.want {
+			t.Errorf("Pixel %d,%d: expected %v, got %v", c.x, c.y, c.want, got)
+		}
+	}
+
+	if _, err := CaptureScreen(outputPath, CaptureOptions{Window: "0x1234"}); err == nil {
+		t.Error("Window capture should fail on Wayland")
+	}
+	if _, err := CaptureScreen("", CaptureOptions{}); err == nil {
+		t.Error("A capture without output or clipboard should fail")
+	}
+}
@@ -0,0 +1,267 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"math/bits"
+	"os"
+	"strconv"
+)
+
+// ImageChecksum holds exact and perceptual hashes of an image.
+// SHA256 covers the encoded file bytes and PixelSHA256 the decoded 8-bit RGBA
+// pixels, so re-encoding an identical picture changes only the former.
+// PerceptualHash is a 64-bit difference hash that stays close for visually
+// similar images.
+type ImageChecksum struct {
+	File           string         `json:"file"`
+	Width          int            `json:"width"`
+	Height         int            `json:"height"`
+	SHA256         string         `json:"sha256"`
+	PixelSHA256    string         `json:"pixel_sha256"`
+	PerceptualHash string         `json:"perceptual_hash"`
+	Tiles          []TileChecksum `json:"tiles,omitempty"`
+}
+
+// TileChecksum holds the hashes of one tile of an image
+type TileChecksum struct {
+	Box
+	PixelSHA256    string `json:"pixel_sha256"`
+	PerceptualHash string `json:"perceptual_hash"`
+}
+
+// ComputeChecksum computes the exact and perceptual hashes of the input image.
+// When tileSize is positive the image is also split into tileSize x tileSize tiles,
+// in row-major order, and each tile is hashed on its own.
+// It takes the path of the input file and the tile size.
+// Returns the checksums, or an error if the operation fails.
+func ComputeChecksum(inputPath string, tileSize int) (*ImageChecksum, error) {
+	slog.Info("computing checksum",
+		"input", inputPath,
+		"tile_size", tileSize)
+
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil, &ErrInvalidInput{Path: inputPath, Err: err}
+	}
+	defer file.Close()
+
+	fileHash := sha256.New()
+	if _, err := io.Copy(fileHash, file); err != nil {
+		return nil, &ErrProcessing{Op: "read", Err: err}
+	}
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	checksum := imageChecksum(img, hex.EncodeToString(fileHash.Sum(nil)), tileSize)
+	checksum.File = inputPath
+	return checksum, nil
+}
+
+// ComputeChecksumReader computes the hashes of the image read from r like
+// ComputeChecksum. The File field of the result is left empty.
+// Returns the checksums, or an error if the operation fails.
+func ComputeChecksumReader(r io.Reader, tileSize int) (*ImageChecksum, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "read", Err: err}
+	}
+	img, err := decodeImageData(data, "")
+	if err != nil {
+		return nil, err
+	}
+	fileHash := sha256.Sum256(data)
+	return imageChecksum(img, hex.EncodeToString(fileHash[:]), tileSize), nil
+}
+
+// imageChecksum hashes the pixels of the image, and of its tiles when tileSize
+// is positive, and records the given hash of the encoded file
+func imageChecksum(img image.Image, fileHash string, tileSize int) *ImageChecksum {
+	bounds := img.Bounds()
+	checksum := &ImageChecksum{
+		Width:          bounds.Dx(),
+		Height:         bounds.Dy(),
+		SHA256:         fileHash,
+		PixelSHA256:    pixelSHA256(img, bounds),
+		PerceptualHash: formatHash(differenceHash(img, bounds)),
+	}
+
+	if tileSize > 0 {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y += tileSize {
+			for x := bounds.Min.X; x < bounds.Max.X; x += tileSize {
+				tile := image.Rect(x, y, x+tileSize, y+tileSize).Intersect(bounds)
+				checksum.Tiles = append(checksum.Tiles, TileChecksum{
+					Box:            boxFromRect(tile),
+					PixelSHA256:    pixelSHA256(img, tile),
+					PerceptualHash: formatHash(differenceHash(img, tile)),
+				})
+			}
+		}
+	}
+
+	return checksum
+}
+
+// TileSize returns the size of the tiles of the checksum, zero without tiles
+func (c *ImageChecksum) TileSize() int {
+	if len(c.Tiles) == 0 {
+		return 0
+	}
+	return max(c.Tiles[0].Width, c.Tiles[0].Height)
+}
+
+// ChecksumComparison is the result of comparing two checksums
+type ChecksumComparison struct {
+	// Identical reports whether the pixels are identical
+	Identical bool `json:"identical"`
+	// Distance is the Hamming distance between the perceptual hashes (0 to 64)
+	Distance int `json:"distance"`
+	// Tiles are the tiles whose pixels differ, when both checksums have tiles
+	Tiles []TileDifference `json:"tiles,omitempty"`
+}
+
+// TileDifference is a tile whose pixels differ between two checksums, with
+// the Hamming distance between its perceptual hashes
+type TileDifference struct {
+	Box
+	Distance int `json:"distance"`
+}
+
+// MaxTileDistance returns the largest distance of the differing tiles, or
+// zero when none differ
+func (c *ChecksumComparison) MaxTileDistance() int {
+	distance := 0
+	for _, tile := range c.Tiles {
+		distance = max(distance, tile.Distance)
+	}
+	return distance
+}
+
+// Compare compares the pixels and perceptual hashes of two checksums and,
+// when both have tiles, of each of their tiles, so a local edit shows in
+// the tiles it touches even when the whole image barely changes.
+// Returns an error if a hash is invalid or the tiles of the two do not match.
+func (c *ImageChecksum) Compare(other *ImageChecksum) (*ChecksumComparison, error) {
+	distance, err := hashDistance(c.PerceptualHash, other.PerceptualHash)
+	if err != nil {
+		return nil, err
+	}
+	result := &ChecksumComparison{Identical: c.PixelSHA256 == other.PixelSHA256, Distance: distance}
+	if len(c.Tiles) == 0 || len(other.Tiles) == 0 {
+		return result, nil
+	}
+	if len(c.Tiles) != len(other.Tiles) {
+		return nil, fmt.Errorf("tiles do not match: %d and %d tiles", len(c.Tiles), len(other.Tiles))
+	}
+	for i, tile := range c.Tiles {
+		if tile.Box != other.Tiles[i].Box {
+			return nil, fmt.Errorf("tiles do not match: %v and %v", tile.Box, other.Tiles[i].Box)
+		}
+		if tile.PixelSHA256 == other.Tiles[i].PixelSHA256 {
+			continue
+		}
+		distance, err := hashDistance(tile.PerceptualHash, other.Tiles[i].PerceptualHash)
+		if err != nil {
+			return nil, err
+		}
+		result.Tiles = append(result.Tiles, TileDifference{Box: tile.Box, Distance: distance})
+	}
+	return result, nil
+}
+
+// hashDistance returns the distance between two perceptual hashes rendered
+// by formatHash
+func hashDistance(a, b string) (int, error) {
+	x, err := parseHash(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := parseHash(b)
+	if err != nil {
+		return 0, err
+	}
+	return HashDistance(x, y), nil
+}
+
+// HashDistance returns the number of differing bits between two perceptual hashes
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// pixelSHA256 hashes the dimensions and 8-bit RGBA pixels of a region
+func pixelSHA256(img image.Image, region image.Rectangle) string {
+	h := sha256.New()
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[0:4], uint32(region.Dx()))
+	binary.BigEndian.PutUint32(header[4:8], uint32(region.Dy()))
+	h.Write(header[:])
+
+	buf := make([]byte, region.Dx()*4)
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		h.Write(rgbaRow(img, region.Min.X, region.Max.X, y, buf))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// differenceHash computes a 64-bit dHash of a region: the region is reduced to
+// 9x8 gray cells by area averaging and each bit records whether a cell is
+// brighter than its right neighbour
+func differenceHash(img image.Image, region image.Rectangle) uint64 {
+	const cols, rows = 9, 8
+	var sums [rows][cols]float64
+	var counts [rows][cols]float64
+
+	w, h := region.Dx(), region.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		cy := (y - region.Min.Y) * rows / h
+		for x := region.Min.X; x < region.Max.X; x++ {
+			cx := (x - region.Min.X) * cols / w
+			r, g, b, _ := img.At(x, y).RGBA()
+			// Integer luma weights keep the result identical across platforms
+			sums[cy][cx] += float64((299*r + 587*g + 114*b) / 1000)
+			counts[cy][cx]++
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols-1; x++ {
+			hash <<= 1
+			left, right := 0.0, 0.0
+			if counts[y][x] > 0 {
+				left = sums[y][x] / counts[y][x]
+			}
+			if counts[y][x+1] > 0 {
+				right = sums[y][x+1] / counts[y][x+1]
+			}
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// formatHash renders a perceptual hash as 16 hex digits
+func formatHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// parseHash parses a perceptual hash rendered by formatHash
+func parseHash(s string) (uint64, error) {
+	hash, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash %q: %w", s, err)
+	}
+	return hash, nil
+}
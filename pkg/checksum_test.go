@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestComputeChecksum(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input.jpg")
+	if err := generateSingleTestImage(testInputPath, 100, 100); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	checksum, err := ComputeChecksum(testInputPath, 64)
+	if err != nil {
+		t.Fatalf("Failed to compute checksum: %v", err)
+	}
+	if len(checksum.Tiles) != 4 {
+		t.Errorf("Expected 4 tiles, got %d", len(checksum.Tiles))
+	}
+
+	// Re-encoding the decoded pixels losslessly keeps the pixel hash
+	img, err := loadImage(testInputPath)
+	if err != nil {
+		t.Fatalf("Failed to load test image: %v", err)
+	}
+	pngPath := filepath.Join(testDir, "test_input.png")
+	out, err := os.Create(pngPath)
+	if err != nil {
+		t.Fatalf("Failed to create PNG: %v", err)
+	}
+	if err := png.Encode(out, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	out.Close()
+
+	reencoded, err := ComputeChecksum(pngPath, 0)
+	if err != nil {
+		t.Fatalf("Failed to compute checksum: %v", err)
+	}
+	comparison, err := checksum.Compare(reencoded)
+	if err != nil {
+		t.Fatalf("Failed to compare checksums: %v", err)
+	}
+	if !comparison.Identical || comparison.Distance != 0 {
+		t.Errorf("Expected identical pixels, got %+v", comparison)
+	}
+	if checksum.SHA256 == reencoded.SHA256 {
+		t.Errorf("Expected file hashes of JPEG and PNG to differ")
+	}
+}
+
+func TestCompareChecksumTiles(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), uint8(x ^ y), 255})
+		}
+	}
+	original := imageChecksum(img, "", 64)
+
+	// A local edit in one tile
+	edited := image.NewRGBA(img.Bounds())
+	copy(edited.Pix, img.Pix)
+	for y := 140; y < 180; y++ {
+		for x := 10; x < 50; x++ {
+			edited.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+		}
+	}
+	comparison, err := original.Compare(imageChecksum(edited, "", 64))
+	if err != nil {
+		t.Fatalf("Failed to compare checksums: %v", err)
+	}
+	if comparison.Identical || len(comparison.Tiles) != 1 || comparison.Tiles[0].Box != (Box{X: 0, Y: 128, Width: 64, Height: 64}) {
+		t.Fatalf("Expected the edited tile reported, got %+v", comparison)
+	}
+	if comparison.MaxTileDistance() == 0 {
+		t.Errorf("Expected the edited tile to have a perceptual distance, got %+v", comparison.Tiles)
+	}
+
+	if _, err := original.Compare(imageChecksum(img, "", 32)); err == nil {
+		t.Error("Expected an error for tiles of different sizes")
+	}
+}
+
+func TestDifferenceHashSimilarity(t *testing.T) {
+	a := image.NewGray(image.Rect(0, 0, 90, 80))
+	b := image.NewGray(image.Rect(0, 0, 90, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 90; x++ {
+			a.Pix[y*90+x] = uint8((x * 7) ^ (y * 3))
+			b.Pix[y*90+x] = a.Pix[y*90+x] / 2
+		}
+	}
+	// Halving brightness keeps the relative ordering of cells
+	if d := HashDistance(differenceHash(a, a.Bounds()), differenceHash(b, b.Bounds())); d > 6 {
+		t.Errorf("Expected similar hashes, got distance %d", d)
+	}
+}
@@ -0,0 +1,255 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Image classes returned by ClassifyImage
+const (
+	ClassDocument = "document"
+	ClassPhoto    = "photo"
+	ClassMixed    = "mixed"
+)
+
+const (
+	// classifyGrid is the number of tiles along each axis
+	classifyGrid = 8
+	// classifyBlankStdDev is the gray-level spread below which a tile is blank paper or sky
+	classifyBlankStdDev = 8.0
+	// classifyBimodality is the share of variance the Otsu split must explain in a document tile
+	classifyBimodality = 0.85
+	// classifyFlatGradient is the Sobel magnitude below which a pixel counts as flat
+	classifyFlatGradient = 24.0
+	// classifyEdgeGradient is the Sobel magnitude above which a pixel counts as a strong edge
+	classifyEdgeGradient = 200.0
+	// classifySaturation is the mean saturation above which a tile is a color picture
+	classifySaturation = 0.25
+	// classifyDocumentShare and classifyPhotoShare bound the share of photo tiles
+	// of pure documents and pure photos; anything in between is mixed
+	classifyDocumentShare = 0.2
+	classifyPhotoShare    = 0.8
+)
+
+// Classification describes the content of an image
+type Classification struct {
+	// Class is ClassDocument, ClassPhoto or ClassMixed
+	Class string `json:"class"`
+	// Bimodality is the share of gray-level variance explained by splitting
+	// at the Otsu threshold: near 1 for ink on paper, lower for continuous tone
+	Bimodality float64 `json:"bimodality"`
+	// Saturation is the mean HSV saturation, 0-1
+	Saturation float64 `json:"saturation"`
+	// EdgeDensity is the fraction of pixels on strong edges
+	EdgeDensity float64 `json:"edge_density"`
+	// FlatFraction is the fraction of pixels without a noticeable gradient
+	FlatFraction float64 `json:"flat_fraction"`
+	// PhotoFraction is the share of non-blank tiles that look like a photo
+	PhotoFraction float64 `json:"photo_fraction"`
+}
+
+// ClassifyImage decides whether the input is a text document, a photo or a
+// mixture of both, so that documents and photos can be routed to different
+// operations. The image is split into tiles and each tile is judged by the
+// bimodality of its histogram, its saturation and its edge statistics.
+// It takes the path of the input file.
+// Returns the classification, or an error if the operation fails.
+func ClassifyImage(inputPath string) (*Classification, error) {
+	slog.Info("classifying image", "input", inputPath)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	c := classifyImage(img)
+	slog.Info("image classified",
+		"class", c.Class,
+		"photo_fraction", c.PhotoFraction)
+	return c, nil
+}
+
+// ClassifyImageReader classifies the image read from r like ClassifyImage.
+// Returns the classification, or an error if the operation fails.
+func ClassifyImageReader(r io.Reader) (*Classification, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	return classifyImage(img), nil
+}
+
+// tileStats holds the statistics of a region used by classifyImage
+type tileStats struct {
+	histogram  [256]int
+	count      int
+	saturation float64
+	flat       int
+	edges      int
+}
+
+func (s *tileStats) add(o *tileStats) {
+	for i, n := range o.histogram {
+		s.histogram[i] += n
+	}
+	s.count += o.count
+	s.saturation += o.saturation
+	s.flat += o.flat
+	s.edges += o.edges
+}
+
+// bimodality returns the between-class variance at the Otsu threshold as a
+// fraction of the total variance, and the variance of the gray levels
+func (s *tileStats) bimodality() (eta, variance float64) {
+	if s.count == 0 {
+		return 0, 0
+	}
+	var sum, sumSq float64
+	for v, n := range s.histogram {
+		sum += float64(v * n)
+		sumSq += float64(v * v * n)
+	}
+	total := float64(s.count)
+	mean := sum / total
+	variance = sumSq/total - mean*mean
+	if variance <= 0 {
+		return 0, 0
+	}
+
+	threshold := int(otsuThreshold(s.histogram[:], s.count))
+	var w0, sum0 float64
+	for v := 0; v <= threshold; v++ {
+		w0 += float64(s.histogram[v])
+		sum0 += float64(v * s.histogram[v])
+	}
+	w1 := total - w0
+	if w0 == 0 || w1 == 0 {
+		return 0, variance
+	}
+	mean0, mean1 := sum0/w0, (sum-sum0)/w1
+	between := w0 * w1 / (total * total) * (mean0 - mean1) * (mean0 - mean1)
+	return between / variance, variance
+}
+
+// classifyImage computes the classification of an image
+func classifyImage(img image.Image) *Classification {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	gray := toGray(img)
+	_, _, mag := sobelGradients(gray)
+
+	cols, rows := min(classifyGrid, w), min(classifyGrid, h)
+	tiles := make([]tileStats, cols*rows)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			tile := &tiles[(y*rows/h)*cols+x*cols/w]
+			tile.histogram[gray.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y]++
+			tile.count++
+			tile.saturation += saturation(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+			switch m := mag[y*w+x]; {
+			case m < classifyFlatGradient:
+				tile.flat++
+			case m >= classifyEdgeGradient:
+				tile.edges++
+			}
+		}
+	}
+
+	var whole tileStats
+	var documentTiles, photoTiles int
+	for i := range tiles {
+		tile := &tiles[i]
+		whole.add(tile)
+		eta, variance := tile.bimodality()
+		if variance < classifyBlankStdDev*classifyBlankStdDev {
+			continue
+		}
+		isDocument := eta >= classifyBimodality &&
+			tile.saturation/float64(tile.count) < classifySaturation &&
+			tile.flat*2 >= tile.count
+		if isDocument {
+			documentTiles++
+		} else {
+			photoTiles++
+		}
+	}
+
+	c := &Classification{Class: ClassDocument}
+	if whole.count > 0 {
+		c.Bimodality, _ = whole.bimodality()
+		c.Saturation = whole.saturation / float64(whole.count)
+		c.EdgeDensity = float64(whole.edges) / float64(whole.count)
+		c.FlatFraction = float64(whole.flat) / float64(whole.count)
+	}
+	if documentTiles+photoTiles > 0 {
+		c.PhotoFraction = float64(photoTiles) / float64(documentTiles+photoTiles)
+	}
+	switch {
+	case c.PhotoFraction >= classifyPhotoShare:
+		c.Class = ClassPhoto
+	case c.PhotoFraction > classifyDocumentShare:
+		c.Class = ClassMixed
+	}
+	return c
+}
+
+// saturation returns the HSV saturation of a color, 0-1
+func saturation(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	hi, lo := max(r, g, b), min(r, g, b)
+	if hi == 0 {
+		return 0
+	}
+	return float64(hi-lo) / float64(hi)
+}
+
+// ClassRoutes maps an image class to the operation applied to images of that class
+type ClassRoutes map[string]func(inputPath, outputPath string) error
+
+// RouteImage classifies the input and applies the operation routed for its
+// class, so that, for example, documents are binarized while photos are only
+// resized. Inputs of a class without a route are copied unchanged.
+// It takes the paths of the input and output files and the routes.
+// Returns the class of the input, or an error if the operation fails.
+func RouteImage(inputPath string, outputPath string, routes ClassRoutes) (string, error) {
+	c, err := ClassifyImage(inputPath)
+	if err != nil {
+		return "", err
+	}
+	operation, ok := routes[c.Class]
+	if !ok {
+		slog.Info("no operation for class, copying", "class", c.Class)
+		return c.Class, copyFile(inputPath, outputPath)
+	}
+	if err := operation(inputPath, outputPath); err != nil {
+		return c.Class, err
+	}
+	return c.Class, nil
+}
+
+// copyFile copies the file at src to dst
+func (p *Processor) copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return &ErrInvalidInput{Path: src, Err: err}
+	}
+	defer in.Close()
+
+	out, err := p.createOutput(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return &ErrProcessing{Op: "copy", Err: err}
+	}
+	return out.Commit()
+}
+
+// copyFile is Processor.copyFile on the default Processor
+func copyFile(src, dst string) error {
+	return defaultProcessor.copyFile(src, dst)
+}
@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// syntheticPage draws dark text-like strokes on white paper in the left part
+// of the page, up to photoFrom, and a colorful continuous-tone scene to its right
+func syntheticPage(w, h, photoFrom int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x >= photoFrom {
+				fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+				img.Set(x, y, color.RGBA{
+					R: uint8(128 + 100*math.Sin(fx*9+fy*4)),
+					G: uint8(128 + 90*math.Cos(fy*7-fx*3)),
+					B: uint8(128 + 80*math.Sin((fx+fy)*5)),
+					A: 255,
+				})
+				continue
+			}
+			ink := y%16 >= 4 && y%16 < 12 && x%12 < 8 && (x/12+y/16)%5 != 0
+			if ink {
+				img.Set(x, y, color.RGBA{20, 20, 20, 255})
+			} else {
+				img.Set(x, y, color.RGBA{245, 245, 240, 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestClassifyImage(t *testing.T) {
+	tests := []struct {
+		name      string
+		photoFrom int
+		want      string
+	}{
+		{"document", 320, ClassDocument},
+		{"photo", 0, ClassPhoto},
+		{"mixed", 160, ClassMixed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := classifyImage(syntheticPage(320, 240, tt.photoFrom))
+			if c.Class != tt.want {
+				t.Errorf("Expected %s, got %+v", tt.want, c)
+			}
+		})
+	}
+}
+
+func TestRouteImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_document.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_document.jpg")
+	if err := saveJPEG(testInputPath, syntheticPage(320, 240, 320)); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+
+	var routed string
+	routes := ClassRoutes{
+		ClassDocument: func(in, out string) error { routed = ClassDocument; return BinarizeImage(in, out) },
+		ClassPhoto:    func(in, out string) error { routed = ClassPhoto; return nil },
+	}
+	class, err := RouteImage(testInputPath, testOutputPath, routes)
+	if err != nil {
+		t.Fatalf("RouteImage failed: %v", err)
+	}
+	if class != ClassDocument || routed != ClassDocument {
+		t.Errorf("Expected the document route, got class %q and route %q", class, routed)
+	}
+	if _, err := os.Stat(testOutputPath); err != nil {
+		t.Errorf("Output file was not created: %v", err)
+	}
+}
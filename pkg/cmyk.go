@@ -0,0 +1,142 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// jpegSegments calls fn with the marker and payload of every segment of a
+// JPEG before its first scan, until fn returns false
+func jpegSegments(data []byte, fn func(marker byte, segment []byte) bool) {
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return
+	}
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xff {
+		marker := data[pos+1]
+		if marker == 0xff {
+			// Fill byte before a marker
+			pos++
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 {
+			return
+		}
+		length := int(data[pos+2])<<8 | int(data[pos+3])
+		if length < 2 || pos+2+length > len(data) {
+			return
+		}
+		if !fn(marker, data[pos+4:pos+2+length]) {
+			return
+		}
+		pos += 2 + length
+	}
+}
+
+// jpegComponents returns the number of color components of a JPEG, 4 for
+// CMYK, or 0 if data is not a JPEG
+func jpegComponents(data []byte) int {
+	n := 0
+	jpegSegments(data, func(marker byte, segment []byte) bool {
+		// The start of frame markers, leaving out DHT, JPG and DAC
+		if marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc {
+			if len(segment) >= 6 {
+				n = int(segment[5])
+			}
+			return false
+		}
+		return true
+	})
+	return n
+}
+
+// jpegICCProfile returns the ICC profile embedded in the APP2 segments of a
+// JPEG, or nil. Profiles over 64 KB are split over several segments, which
+// are numbered.
+func jpegICCProfile(data []byte) []byte {
+	type chunk struct {
+		seq  byte
+		data []byte
+	}
+	var chunks []chunk
+	jpegSegments(data, func(marker byte, segment []byte) bool {
+		if marker == 0xe2 && len(segment) > 14 && string(segment[:12]) == "ICC_PROFILE\x00" {
+			chunks = append(chunks, chunk{segment[12], segment[14:]})
+		}
+		return true
+	})
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].seq < chunks[j].seq })
+	var profile []byte
+	for _, c := range chunks {
+		profile = append(profile, c.data...)
+	}
+	return profile
+}
+
+// adobeCMYKSegment is an Adobe APP14 segment marking a JPEG as CMYK
+var adobeCMYKSegment = []byte{0xff, 0xee, 0x00, 0x0e, 'A', 'd', 'o', 'b', 'e', 0x00, 0x64, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+// decodeCMYKJPEG retries a 4-component JPEG that image/jpeg refused with err.
+// Without an Adobe APP14 segment, image/jpeg cannot tell CMYK from YCCK and
+// gives up; such files come from tools other than Photoshop and store plain
+// CMYK, so the segment is added and the inversion image/jpeg then applies
+// for Adobe files is undone. Other errors are only given a clearer message.
+func decodeCMYKJPEG(data []byte, err error) (image.Image, error) {
+	if !strings.Contains(err.Error(), "Adobe APP14") {
+		return nil, fmt.Errorf("CMYK JPEG: %w", err)
+	}
+	patched := append(append(append([]byte(nil), data[:2]...), adobeCMYKSegment...), data[2:]...)
+	img, _, retryErr := image.Decode(bytes.NewReader(patched))
+	if retryErr != nil {
+		return nil, fmt.Errorf("CMYK JPEG: %w", retryErr)
+	}
+	cmyk, ok := img.(*image.CMYK)
+	if !ok {
+		return nil, fmt.Errorf("CMYK JPEG: %w", err)
+	}
+	for i := range cmyk.Pix {
+		cmyk.Pix[i] = 0xff - cmyk.Pix[i]
+	}
+	return cmyk, nil
+}
+
+// cmykToRGBA converts a CMYK image to RGB, through the ICC profile embedded
+// in its file when it is a CMYK profile the package supports. Without one,
+// the inks are combined as color.CMYK does, which ignores how they mix on
+// paper and makes dark and saturated colors too strong. The rows are
+// converted in parallel unless deterministic is set.
+func cmykToRGBA(img *image.CMYK, profile []byte, deterministic bool) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(bounds)
+
+	var t *iccCMYK
+	if len(profile) > 0 {
+		var err error
+		if t, err = parseICCCMYK(profile); err != nil {
+			slog.Debug("ignoring the embedded color profile", "error", err)
+		}
+	}
+	w := bounds.Dx()
+	parallelRows(deterministic, bounds.Min.Y, bounds.Max.Y, func() func(y int) {
+		return func(y int) {
+			src := img.Pix[img.PixOffset(bounds.Min.X, y):][: 4*w : 4*w]
+			dst := rgba.Pix[rgba.PixOffset(bounds.Min.X, y):][: 4*w : 4*w]
+			for i := 0; i < 4*w; i += 4 {
+				s := src[i : i+4 : i+4]
+				d := dst[i : i+4 : i+4]
+				if t != nil {
+					d[0], d[1], d[2] = t.rgb(s[0], s[1], s[2], s[3])
+				} else {
+					d[0], d[1], d[2] = color.CMYKToRGB(s[0], s[1], s[2], s[3])
+				}
+				d[3] = 0xff
+			}
+		}
+	})
+	return rgba
+}
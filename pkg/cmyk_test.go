@@ -0,0 +1,231 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// encodeCMYKJPEG encodes a CMYK image as a baseline JPEG of four
+// non-interleaved scans, one per ink, built from grayscale JPEGs of the
+// channels since image/jpeg only writes one or three components. Adobe files
+// carry the APP14 segment and store the inks inverted, as Photoshop does;
+// the others store them as they are. The profile, if any, goes in an APP2.
+func encodeCMYKJPEG(t *testing.T, img *image.CMYK, adobe bool, profile []byte) []byte {
+	t.Helper()
+	bounds := img.Bounds()
+	var tables []byte
+	var scans [4][]byte
+	for c := 0; c < 4; c++ {
+		channel := image.NewGray(bounds)
+		for i := range channel.Pix {
+			v := img.Pix[4*i+c]
+			if adobe {
+				v = 0xff - v
+			}
+			channel.Pix[i] = v
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, channel, &jpeg.Options{Quality: 100}); err != nil {
+			t.Fatalf("Failed to encode channel %d: %v", c, err)
+		}
+		data := buf.Bytes()
+		for pos := 2; pos < len(data); {
+			marker := data[pos+1]
+			length := int(binary.BigEndian.Uint16(data[pos+2:]))
+			switch marker {
+			case 0xdb, 0xc4:
+				if c == 0 {
+					tables = append(tables, data[pos:pos+2+length]...)
+				}
+			case 0xda:
+				// The entropy-coded data runs up to the end of image marker
+				scans[c] = data[pos+2+length : len(data)-2]
+				pos = len(data)
+				continue
+			}
+			pos += 2 + length
+		}
+	}
+
+	out := []byte{0xff, 0xd8}
+	if adobe {
+		out = append(out, adobeCMYKSegment...)
+	}
+	if profile != nil {
+		segment := append([]byte("ICC_PROFILE\x00\x01\x01"), profile...)
+		out = append(out, 0xff, 0xe2, byte((len(segment)+2)>>8), byte(len(segment)+2))
+		out = append(out, segment...)
+	}
+	out = append(out, tables...)
+	w, h := bounds.Dx(), bounds.Dy()
+	out = append(out, 0xff, 0xc0, 0, 20, 8, byte(h>>8), byte(h), byte(w>>8), byte(w), 4)
+	for c := byte(1); c <= 4; c++ {
+		out = append(out, c, 0x11, 0)
+	}
+	for c, scan := range scans {
+		out = append(out, 0xff, 0xda, 0, 8, 1, byte(c+1), 0x00, 0, 63, 0)
+		out = append(out, scan...)
+	}
+	return append(out, 0xff, 0xd9)
+}
+
+// cmykTestImage has bands of cyan, magenta, yellow and black ink over a ramp
+// of coverage
+func cmykTestImage() *image.CMYK {
+	img := image.NewCMYK(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			var c color.CMYK
+			v := uint8(y * 8)
+			switch x / 16 {
+			case 0:
+				c.C = v
+			case 1:
+				c.M = v
+			case 2:
+				c.Y = v
+			case 3:
+				c.K = v
+			}
+			img.SetCMYK(x, y, c)
+		}
+	}
+	return img
+}
+
+// iccTestProfile is a CMYK profile whose lut16 maps every color to the Lab
+// color lab
+func iccTestProfile(lab [3]uint16) []byte {
+	var lut []byte
+	lut = append(lut, "mft2\x00\x00\x00\x00"...)
+	lut = append(lut, 4, 3, 2, 0)
+	lut = append(lut, make([]byte, 36)...)
+	lut = binary.BigEndian.AppendUint16(lut, 2)
+	lut = binary.BigEndian.AppendUint16(lut, 2)
+	for c := 0; c < 4; c++ {
+		lut = binary.BigEndian.AppendUint16(lut, 0)
+		lut = binary.BigEndian.AppendUint16(lut, 0xffff)
+	}
+	for i := 0; i < 16; i++ {
+		for _, v := range lab {
+			lut = binary.BigEndian.AppendUint16(lut, v)
+		}
+	}
+	for c := 0; c < 3; c++ {
+		lut = binary.BigEndian.AppendUint16(lut, 0)
+		lut = binary.BigEndian.AppendUint16(lut, 0xffff)
+	}
+
+	header := make([]byte, 128)
+	copy(header[12:], "prtr")
+	copy(header[16:], "CMYK")
+	copy(header[20:], "Lab ")
+	copy(header[36:], "acsp")
+	profile := binary.BigEndian.AppendUint32(header, 1)
+	profile = append(profile, "A2B0"...)
+	profile = binary.BigEndian.AppendUint32(profile, 144)
+	profile = binary.BigEndian.AppendUint32(profile, uint32(len(lut)))
+	profile = append(profile, lut...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+	return profile
+}
+
+func TestDecodeCMYK(t *testing.T) {
+	src := cmykTestImage()
+
+	for _, adobe := range []bool{true, false} {
+		data := encodeCMYKJPEG(t, src, adobe, nil)
+		img, err := decodeImageData(data, "")
+		if err != nil {
+			t.Fatalf("Failed to decode a CMYK JPEG (Adobe: %v): %v", adobe, err)
+		}
+		rgba, ok := img.(*image.RGBA)
+		if !ok {
+			t.Fatalf("Expected an RGBA image, got %T", img)
+		}
+		for _, p := range []image.Point{{8, 31}, {24, 31}, {40, 31}, {56, 31}, {8, 0}} {
+			r, g, b := color.CMYKToRGB(src.Pix[src.PixOffset(p.X, p.Y)], src.Pix[src.PixOffset(p.X, p.Y)+1], src.Pix[src.PixOffset(p.X, p.Y)+2], src.Pix[src.PixOffset(p.X, p.Y)+3])
+			got := rgba.RGBAAt(p.X, p.Y)
+			if absDiff(got.R, r) > 4 || absDiff(got.G, g) > 4 || absDiff(got.B, b) > 4 {
+				t.Errorf("Adobe %v, pixel %v: expected about %v, got %v", adobe, p, color.RGBA{r, g, b, 0xff}, got)
+			}
+		}
+	}
+
+	// The embedded profile decides the colors: this one makes everything a
+	// middle gray, L* 50
+	profile := iccTestProfile([3]uint16{0x7f80, 0x8000, 0x8000})
+	img, err := decodeImageData(encodeCMYKJPEG(t, src, true, profile), "")
+	if err != nil {
+		t.Fatalf("Failed to decode a CMYK JPEG with a profile: %v", err)
+	}
+	for _, p := range []image.Point{{0, 0}, {56, 31}} {
+		if got := img.(*image.RGBA).RGBAAt(p.X, p.Y); absDiff(got.R, 119) > 1 || got.R != got.G || got.G != got.B {
+			t.Errorf("Pixel %v: expected the gray of L* 50, got %v", p, got)
+		}
+	}
+
+	// Unsupported features are reported as such
+	data := encodeCMYKJPEG(t, src, true, nil)
+	sof := bytes.Index(data, []byte{0xff, 0xc0})
+	data[sof+10+3*1+1] = 0x22
+	if _, err := decodeImageData(data, ""); err == nil || !strings.Contains(err.Error(), "CMYK JPEG") {
+		t.Errorf("Expected an error naming CMYK JPEGs, got %v", err)
+	}
+
+	// The file operations see the converted colors
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	input := filepath.Join(testDir, "test_input_cmyk.jpg")
+	if err := os.WriteFile(input, encodeCMYKJPEG(t, src, false, nil), 0o644); err != nil {
+		t.Fatalf("Failed to write the input: %v", err)
+	}
+	output := filepath.Join(testDir, "test_output.jpg")
+	if err := ResizeImage(input, output, 32, 16); err != nil {
+		t.Fatalf("Failed to resize a CMYK JPEG: %v", err)
+	}
+	if got := decodeTestFile(t, output).Bounds(); got != image.Rect(0, 0, 32, 16) {
+		t.Errorf("Expected a 32x16 output, got %v", got)
+	}
+}
+
+func TestEncodeGray16(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	var buf bytes.Buffer
+	if err := encodeJPEGQuality(&buf, img, 90); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	decoded, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if _, ok := decoded.(*image.Gray); !ok {
+		t.Errorf("Expected a grayscale JPEG for a 16-bit gray image, got %T", decoded)
+	}
+
+	transformed, err := transformImage(img, []Op{RotateOp(90)})
+	if err != nil {
+		t.Fatalf("Failed to transform: %v", err)
+	}
+	if _, ok := transformed.(*image.RGBA64); !ok {
+		t.Errorf("Expected the transform of a 16-bit image to stay 16-bit, got %T", transformed)
+	}
+}
+
+// absDiff returns the difference between two samples
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,191 @@
+package processor
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// namedColors are the color names accepted by ParseColor, from CSS
+var namedColors = map[string]color.NRGBA{
+	"transparent": {0, 0, 0, 0},
+	"black":       {0, 0, 0, 255},
+	"white":       {255, 255, 255, 255},
+	"gray":        {128, 128, 128, 255},
+	"grey":        {128, 128, 128, 255},
+	"silver":      {192, 192, 192, 255},
+	"lightgray":   {211, 211, 211, 255},
+	"darkgray":    {169, 169, 169, 255},
+	"red":         {255, 0, 0, 255},
+	"maroon":      {128, 0, 0, 255},
+	"orange":      {255, 165, 0, 255},
+	"yellow":      {255, 255, 0, 255},
+	"gold":        {255, 215, 0, 255},
+	"olive":       {128, 128, 0, 255},
+	"lime":        {0, 255, 0, 255},
+	"green":       {0, 128, 0, 255},
+	"teal":        {0, 128, 128, 255},
+	"cyan":        {0, 255, 255, 255},
+	"aqua":        {0, 255, 255, 255},
+	"blue":        {0, 0, 255, 255},
+	"navy":        {0, 0, 128, 255},
+	"purple":      {128, 0, 128, 255},
+	"magenta":     {255, 0, 255, 255},
+	"fuchsia":     {255, 0, 255, 255},
+	"pink":        {255, 192, 203, 255},
+	"brown":       {165, 42, 42, 255},
+	"beige":       {245, 245, 220, 255},
+	"ivory":       {255, 255, 240, 255},
+}
+
+// ParseColor parses a color written as hex (#rgb, #rgba, #rrggbb or
+// #rrggbbaa, with or without the #), as rgb(r, g, b) or rgba(r, g, b, a), or
+// as a CSS color name such as "navy" or "transparent". Channels in rgb() are
+// 0-255 or percentages; the alpha of rgba() is 0-1 or a percentage.
+func ParseColor(s string) (color.NRGBA, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	invalid := fmt.Errorf("invalid color %q", s)
+
+	if c, ok := namedColors[s]; ok {
+		return c, nil
+	}
+	if args, ok := cutColorFunction(s); ok {
+		if len(args) != 3 && len(args) != 4 || strings.HasPrefix(s, "rgba") != (len(args) == 4) {
+			return color.NRGBA{}, invalid
+		}
+		c := color.NRGBA{A: 255}
+		for i, arg := range args {
+			scale := 255.0
+			if i == 3 {
+				scale = 1
+			}
+			v, err := parseColorChannel(arg, scale)
+			if err != nil {
+				return color.NRGBA{}, invalid
+			}
+			channel := []*uint8{&c.R, &c.G, &c.B, &c.A}[i]
+			*channel = uint8(math.Round(v * 255))
+		}
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 || len(hex) == 4 {
+		long := make([]byte, 0, 8)
+		for i := range len(hex) {
+			long = append(long, hex[i], hex[i])
+		}
+		hex = string(long)
+	}
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.NRGBA{}, invalid
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, invalid
+	}
+	if len(hex) == 6 {
+		v = v<<8 | 0xff
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// cutColorFunction returns the arguments of rgb(...) or rgba(...)
+func cutColorFunction(s string) ([]string, bool) {
+	for _, name := range []string{"rgba(", "rgb("} {
+		if inner, ok := strings.CutPrefix(s, name); ok {
+			inner, ok = strings.CutSuffix(inner, ")")
+			if !ok {
+				return nil, true
+			}
+			args := strings.Split(inner, ",")
+			for i := range args {
+				args[i] = strings.TrimSpace(args[i])
+			}
+			return args, true
+		}
+	}
+	return nil, false
+}
+
+// parseColorChannel parses a channel of rgb() as a fraction of full scale
+func parseColorChannel(s string, scale float64) (float64, error) {
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		s, scale = p, 100
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || v > scale {
+		return 0, fmt.Errorf("invalid channel %q", s)
+	}
+	return v / scale, nil
+}
+
+// FormatColor formats a color as #rrggbb, or #rrggbbaa when it is not opaque
+func FormatColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
+
+// Palette is an ordered list of colors
+type Palette []color.NRGBA
+
+// ParsePalette parses a comma-separated list of colors, such as
+// "black,white,#ff0000". Commas inside rgb() and rgba() do not separate colors.
+func ParsePalette(s string) (Palette, error) {
+	var p Palette
+	depth, start := 0, 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			switch s[i] {
+			case '(':
+				depth++
+				continue
+			case ')':
+				depth--
+				continue
+			}
+			if s[i] != ',' || depth > 0 {
+				continue
+			}
+		}
+		c, err := ParseColor(s[start:i])
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, c)
+		start = i + 1
+	}
+	return p, nil
+}
+
+// String formats the palette as ParsePalette accepts it
+func (p Palette) String() string {
+	names := make([]string, len(p))
+	for i, c := range p {
+		names[i] = FormatColor(c)
+	}
+	return strings.Join(names, ",")
+}
+
+// Colors returns the palette as a color.Palette, for image.Paletted and the
+// quantizers of image/draw
+func (p Palette) Colors() color.Palette {
+	colors := make(color.Palette, len(p))
+	for i, c := range p {
+		colors[i] = c
+	}
+	return colors
+}
+
+// Nearest returns the palette color closest to c by Euclidean distance in RGBA
+func (p Palette) Nearest(c color.Color) color.NRGBA {
+	if len(p) == 0 {
+		return color.NRGBA{}
+	}
+	return p[p.Colors().Index(c)]
+}
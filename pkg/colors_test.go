@@ -0,0 +1,110 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		input string
+		want  color.NRGBA
+	}{
+		{"#ff8000", color.NRGBA{255, 128, 0, 255}},
+		{"FF8000", color.NRGBA{255, 128, 0, 255}},
+		{"#f80", color.NRGBA{255, 136, 0, 255}},
+		{"#f808", color.NRGBA{255, 136, 0, 136}},
+		{"#ff800080", color.NRGBA{255, 128, 0, 128}},
+		{"rgb(255, 128, 0)", color.NRGBA{255, 128, 0, 255}},
+		{"rgb(100%, 50%, 0%)", color.NRGBA{255, 128, 0, 255}},
+		{"rgba(0, 0, 255, 0.5)", color.NRGBA{0, 0, 255, 128}},
+		{"rgba(0, 0, 255, 25%)", color.NRGBA{0, 0, 255, 64}},
+		{" Navy ", color.NRGBA{0, 0, 128, 255}},
+		{"transparent", color.NRGBA{0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		got, err := ParseColor(tt.input)
+		if err != nil {
+			t.Errorf("ParseColor(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseColor(%q) = %v, expected %v", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "#12345", "#gggggg", "rgb(1, 2)", "rgb(1, 2, 3, 4)", "rgba(1, 2, 3)", "rgb(256, 0, 0)", "rgba(0, 0, 0, 2)", "rgb(1, 2, 3", "chartreuse-ish"} {
+		if _, err := ParseColor(input); err == nil {
+			t.Errorf("ParseColor(%q) should fail", input)
+		}
+	}
+}
+
+func TestFormatColor(t *testing.T) {
+	if got := FormatColor(color.NRGBA{255, 128, 0, 255}); got != "#ff8000" {
+		t.Errorf("Expected #ff8000, got %s", got)
+	}
+	if got := FormatColor(color.NRGBA{255, 128, 0, 128}); got != "#ff800080" {
+		t.Errorf("Expected #ff800080, got %s", got)
+	}
+}
+
+func TestParsePalette(t *testing.T) {
+	p, err := ParsePalette("black, rgb(255, 0, 0), rgba(0, 0, 255, 50%),#fff")
+	if err != nil {
+		t.Fatalf("Failed to parse palette: %v", err)
+	}
+	if got := p.String(); got != "#000000,#ff0000,#0000ff80,#ffffff" {
+		t.Errorf("Unexpected palette %s", got)
+	}
+	if got := p.Nearest(color.RGBA{200, 30, 20, 255}); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("Expected red as the nearest color, got %v", got)
+	}
+	if _, err := ParsePalette("black,,white"); err == nil {
+		t.Error("ParsePalette should reject an empty color")
+	}
+}
+
+func TestConvertImageFixedPalette(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_palette.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_palette.png")
+	if err := generateSingleTestImage(testInputPath, 60, 40); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	palette, err := ParsePalette("black,white,#ff000080")
+	if err != nil {
+		t.Fatalf("Failed to parse palette: %v", err)
+	}
+	opts := ConvertOptions{ColorType: ColorTypePalette, Bits: 2, Palette: palette}
+	if err := ConvertImage(testInputPath, testOutputPath, opts); err != nil {
+		t.Fatalf("Failed to convert image: %v", err)
+	}
+
+	img, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load output: %v", err)
+	}
+	paletted, ok := img.(*image.Paletted)
+	if !ok {
+		t.Fatalf("Expected a paletted image, got %T", img)
+	}
+	if len(paletted.Palette) != 3 {
+		t.Fatalf("Expected 3 palette entries, got %d", len(paletted.Palette))
+	}
+	for i, want := range palette {
+		if got := color.NRGBAModel.Convert(paletted.Palette[i]).(color.NRGBA); got != want {
+			t.Errorf("Palette entry %d: expected %v, got %v", i, want, got)
+		}
+	}
+
+	opts.Bits = 1
+	if err := ConvertImage(testInputPath, testOutputPath, opts); err == nil {
+		t.Error("A 3-color palette should not fit in 1 bit")
+	}
+}
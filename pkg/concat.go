@@ -0,0 +1,376 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nfnt/resize"
+)
+
+// concatSource is an input of a concatenation: its size, known before it is
+// decoded, and a function decoding it
+type concatSource struct {
+	size   image.Point
+	decode func() (image.Image, error)
+}
+
+// fileSources reads the sizes of the images at the given paths from their
+// headers; the images are decoded later by the workers of concatenate
+func (p *Processor) fileSources(paths []string) ([]concatSource, error) {
+	sources := make([]concatSource, len(paths))
+	for i, path := range paths {
+		size, err := readImageSize(path)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = concatSource{size: size, decode: func() (image.Image, error) {
+			return p.loadImage(path)
+		}}
+	}
+	return sources, nil
+}
+
+// readImageSize returns the size of the image at path, reading only its header
+func readImageSize(path string) (image.Point, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return image.Point{}, &ErrInvalidInput{Path: path, Err: err}
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return image.Point{}, &ErrProcessing{Op: "decode", Err: err}
+	}
+	return image.Pt(config.Width, config.Height), nil
+}
+
+// readerSources reads the encoded images from the readers, in order, and
+// their sizes from the headers. A reader can only be read once, so the
+// encoded data is kept until the workers of concatenate decode it.
+func (p *Processor) readerSources(inputs []io.Reader) ([]concatSource, error) {
+	sources := make([]concatSource, len(inputs))
+	for i, r := range inputs {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, &ErrProcessing{Op: "read", Err: err}
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, &ErrProcessing{Op: "decode", Err: err}
+		}
+		sources[i] = concatSource{size: image.Pt(config.Width, config.Height), decode: func() (image.Image, error) {
+			return p.decodeImageData(data, "")
+		}}
+	}
+	return sources, nil
+}
+
+// imageSources wraps decoded images as sources
+func imageSources(images []image.Image) []concatSource {
+	sources := make([]concatSource, len(images))
+	for i, img := range images {
+		sources[i] = concatSource{size: img.Bounds().Size(), decode: func() (image.Image, error) {
+			return img, nil
+		}}
+	}
+	return sources
+}
+
+// concatSpan is the width of the widest source, or the height of the
+// tallest one, which all the sources are scaled to
+func concatSpan(sources []concatSource, vertical bool) int {
+	span := 0
+	for _, src := range sources {
+		if vertical {
+			span = max(span, src.size.X)
+		} else {
+			span = max(span, src.size.Y)
+		}
+	}
+	return span
+}
+
+// concatLayout places the sources from top to bottom, scaled to the width of
+// the widest one, or from left to right, scaled to the height of the tallest
+// one, keeping their aspect ratios
+func concatLayout(sources []concatSource, vertical bool) []image.Rectangle {
+	span := concatSpan(sources, vertical)
+	rects := make([]image.Rectangle, len(sources))
+	offset := 0
+	for i, src := range sources {
+		ratio := float64(src.size.X) / float64(src.size.Y)
+		if vertical {
+			height := int(float64(span) / ratio)
+			rects[i] = image.Rect(0, offset, span, offset+height)
+			offset += height
+		} else {
+			width := int(float64(span) * ratio)
+			rects[i] = image.Rect(offset, 0, offset+width, span)
+			offset += width
+		}
+	}
+	return rects
+}
+
+// concatenate draws the sources into one image laid out by concatLayout.
+// A bounded pool of workers decodes and resizes the sources concurrently and
+// draws each straight into its strip of the result, so at most one full-size
+// image per worker is held in memory at a time. The strips do not overlap,
+// so the workers never write the same pixels. When a source fails, the
+// sources not yet started are skipped and the error of the first failed one,
+// in input order, is returned. The sources done are reported to progress.
+// With captions, the labels are drawn on their bands once the images are in.
+func concatenate(sources []concatSource, vertical bool, captions *captioner, progress ProgressFunc) (*image.RGBA, error) {
+	return concatenateContext(context.Background(), sources, vertical, captions, progress)
+}
+
+// concatenateContext concatenates the sources like concatenate, checking ctx
+// for cancellation before each source is started.
+func concatenateContext(ctx context.Context, sources []concatSource, vertical bool, captions *captioner, progress ProgressFunc) (*image.RGBA, error) {
+	rects := concatLayout(sources, vertical)
+	var bands []image.Rectangle
+	if captions != nil {
+		rects, bands = captions.layout(rects, vertical)
+	}
+	var bounds image.Rectangle
+	for _, r := range append(rects, bands...) {
+		bounds = bounds.Union(r)
+	}
+	concatenated := image.NewRGBA(bounds)
+
+	errs := make([]error, len(sources))
+	var failed atomic.Bool
+	var mu sync.Mutex
+	done := 0
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.NumCPU(), len(sources)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if failed.Load() || ctx.Err() != nil {
+					continue
+				}
+				if err := drawSource(concatenated, rects[i], sources[i]); err != nil {
+					errs[i] = err
+					failed.Store(true)
+					continue
+				}
+				mu.Lock()
+				done++
+				progress.report(done, len(sources))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range sources {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, band := range bands {
+		captions.draw(concatenated, band, i)
+	}
+	return concatenated, nil
+}
+
+// drawSource decodes the source, resizes it to the size of r and draws it
+// into r of dst
+func drawSource(dst draw.Image, r image.Rectangle, src concatSource) error {
+	img, err := src.decode()
+	if err != nil {
+		return err
+	}
+	resized := resize.Resize(uint(r.Dx()), uint(r.Dy()), img, resize.Lanczos3)
+	draw.Draw(dst, r, resized, resized.Bounds().Min, draw.Src)
+	return nil
+}
+
+// ConcatenateImagesVerticallyStream combines the images like
+// ConcatenateImagesVertically, but writes the result as a PNG row by row
+// while the inputs are decoded, instead of drawing it into one canvas first.
+// Only the strips of the few inputs being decoded are held in memory, so
+// hundreds of scanned receipts can be joined into one long strip whose
+// canvas would not fit. The output is always PNG, whatever its extension.
+// Progress is reported to the function set by WithProgress, and the images
+// are labeled as set by WithCaptions.
+// Returns an error if an option is invalid or the operation fails.
+func ConcatenateImagesVerticallyStream(inputPaths []string, outputPath string, opts ...Option) error {
+	return defaultProcessor.ConcatenateImagesVerticallyStream(inputPaths, outputPath, opts...)
+}
+
+// ConcatenateImagesVerticallyStream is the package function ConcatenateImagesVerticallyStream with the configuration and logger of p
+func (p *Processor) ConcatenateImagesVerticallyStream(inputPaths []string, outputPath string, opts ...Option) error {
+	out, err := p.createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := p.ConcatenateImagesVerticallyPNG(inputPaths, out, opts...); err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+// ConcatenateImagesVerticallyPNG streams the images at the given paths,
+// combined like ConcatenateImagesVerticallyStream, to w as a PNG.
+// Returns an error if an option is invalid or the operation fails.
+func ConcatenateImagesVerticallyPNG(inputPaths []string, w io.Writer, opts ...Option) error {
+	return defaultProcessor.ConcatenateImagesVerticallyPNG(inputPaths, w, opts...)
+}
+
+// ConcatenateImagesVerticallyPNG is the package function ConcatenateImagesVerticallyPNG with the configuration and logger of p
+func (p *Processor) ConcatenateImagesVerticallyPNG(inputPaths []string, w io.Writer, opts ...Option) error {
+	s, err := newSettings("concatenate", opts)
+	if err != nil {
+		return err
+	}
+	p.logger().Info("streaming vertical concatenation",
+		"count", len(inputPaths))
+
+	sources, err := p.fileSources(inputPaths)
+	if err != nil {
+		return err
+	}
+	captions, err := s.captioner(sources, inputPaths, true)
+	if err != nil {
+		return err
+	}
+	w = s.countOutput(w)
+	return s.recordOutput(w, streamVertically(w, sources, captions, s.progress))
+}
+
+// streamVertically writes the sources laid out from top to bottom by
+// concatLayout, with the bands of the captions if any, to w as an RGBA PNG.
+// The encoder asks for the pixels row by row, so it only needs the strip of
+// the source it has reached; the following sources are drawn meanwhile by
+// prefetchStrips.
+func streamVertically(w io.Writer, sources []concatSource, captions *captioner, progress ProgressFunc) error {
+	if len(sources) == 0 {
+		return &ErrProcessing{Op: "concatenate", Err: errors.New("no images to concatenate")}
+	}
+	rects := concatLayout(sources, true)
+	bands := make([]image.Rectangle, len(sources))
+	if captions != nil {
+		rects, bands = captions.layout(rects, true)
+	}
+	// A strip is a source with its band, in the coordinates of the result
+	strips := make([]image.Rectangle, len(sources))
+	for i := range strips {
+		strips[i] = rects[i].Union(bands[i])
+	}
+	next, stop := prefetchStrips(len(sources), func(i int) (*image.NRGBA, error) {
+		strip := image.NewNRGBA(strips[i])
+		if err := drawSource(strip, rects[i], sources[i]); err != nil {
+			return nil, err
+		}
+		if captions != nil {
+			captions.draw(strip, bands[i], i)
+		}
+		return strip, nil
+	})
+	defer stop()
+
+	hdr := pngHeader{
+		width:     strips[0].Dx(),
+		height:    strips[len(strips)-1].Max.Y,
+		colorType: pngColorRGBA,
+		bitDepth:  8,
+	}
+	// strip is strip i, drawn. After a failure the remaining rows are left
+	// transparent, which is cheap to encode, and the error is returned once
+	// the encoder is done.
+	var strip *image.NRGBA
+	var failure error
+	i := -1
+	sample := func(x, y int, samples []uint16) {
+		for i < 0 || y >= strips[i].Max.Y {
+			i++
+			if failure == nil {
+				strip, failure = next()
+			}
+			progress.report(i, len(sources))
+		}
+		if failure != nil {
+			clear(samples)
+			return
+		}
+		offset := strip.PixOffset(x, y)
+		for c := range samples {
+			samples[c] = uint16(strip.Pix[offset+c])
+		}
+	}
+	if err := encodePNG(w, hdr, sample); err != nil {
+		return &ErrProcessing{Op: "encode", Err: err}
+	}
+	if failure != nil {
+		return failure
+	}
+	progress.report(len(sources), len(sources))
+	return nil
+}
+
+// stripResult is a drawn strip, or the error drawing it
+type stripResult struct {
+	strip *image.NRGBA
+	err   error
+}
+
+// prefetchStrips draws the n strips of a streamed concatenation with drawStrip in
+// the background, one per CPU at a time, and returns a function delivering
+// them in order. A strip is only started when a slot frees up, which happens
+// when next hands over an earlier one, so at most one strip per CPU waits in
+// memory. stop abandons the strips not yet started.
+func prefetchStrips(n int, drawStrip func(i int) (*image.NRGBA, error)) (next func() (*image.NRGBA, error), stop func()) {
+	results := make([]chan stripResult, n)
+	for i := range results {
+		results[i] = make(chan stripResult, 1)
+	}
+	slots := make(chan struct{}, runtime.NumCPU())
+	done := make(chan struct{})
+	go func() {
+		for i := range n {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func() {
+				strip, err := drawStrip(i)
+				results[i] <- stripResult{strip: strip, err: err}
+			}()
+		}
+	}()
+
+	k := 0
+	next = func() (*image.NRGBA, error) {
+		r := <-results[k]
+		<-slots
+		k++
+		return r.strip, r.err
+	}
+	var once sync.Once
+	stop = func() {
+		once.Do(func() { close(done) })
+	}
+	return next, stop
+}
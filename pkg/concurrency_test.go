@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/okamyuji/go-image-processor/config"
+)
+
+// TestConcurrentProcessing runs many operations at once while the
+// configuration changes; run with -race to detect data races
+func TestConcurrentProcessing(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_concurrent.jpg")
+	if err := generateSingleTestImage(testInputPath, 64, 64); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	original := currentConfig()
+	defer SetConfig(original)
+
+	operations := map[string]func(input, output string) error{
+		"resize":   func(in, out string) error { return ResizeImage(in, out, 32, 32) },
+		"denoise":  DenoiseImage,
+		"rotate":   func(in, out string) error { return RotateImage(in, out, 30) },
+		"deblock":  func(in, out string) error { return DeblockImage(in, out, 2) },
+		"binarize": BinarizeImage,
+		"halftone": func(in, out string) error { return HalftoneImage(in, out, 4, 45) },
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 8; i++ {
+		for name, operation := range operations {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				output := filepath.Join(testDir, fmt.Sprintf("test_output_%s_%d.jpg", name, i))
+				if err := operation(testInputPath, output); err != nil {
+					errs <- fmt.Errorf("%s: %w", name, err)
+				}
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			SetConfig(&config.Config{JpegQuality: 50 + i})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Concurrent operation failed: %v", err)
+	}
+}
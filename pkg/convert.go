@@ -0,0 +1,264 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Color types accepted by ConvertImage
+const (
+	ColorTypeGray    = "gray"
+	ColorTypeGray16  = "gray16"
+	ColorTypeRGB     = "rgb"
+	ColorTypeRGBA    = "rgba"
+	ColorTypePalette = "palette"
+)
+
+// ConvertOptions controls the pixel format written by ConvertImage
+type ConvertOptions struct {
+	// ColorType is one of the ColorType* constants
+	ColorType string
+	// Bits is the bit depth per sample: 1, 2, 4, 8 or 16 for gray, 8 or 16
+	// for rgb and rgba, and 1, 2, 4 or 8 for palette. Zero uses 8
+	// (16 for gray16).
+	Bits int
+	// Colors is the palette size for the palette color type; zero uses
+	// the largest palette the bit depth allows
+	Colors int
+	// Palette is a fixed palette for the palette color type, used instead of
+	// one generated from the image; Colors is ignored when it is set
+	Palette Palette
+	// Dither applies Floyd-Steinberg error diffusion when reducing to a
+	// palette or to fewer than 8 bits of gray
+	Dither bool
+	// Interlace writes an Adam7 interlaced PNG, which browsers can show at
+	// low resolution before it has finished downloading
+	Interlace bool
+}
+
+// ConvertImage writes the input image as a PNG with an exact color type and bit depth,
+// for systems with strict format requirements such as fax, e-ink and embedded displays.
+// For the palette color type the palette is generated from the image with
+// median cut, unless a fixed palette is given.
+// It takes the paths of the input and output files and the options.
+// Returns an error if the operation fails.
+func ConvertImage(inputPath string, outputPath string, opts ConvertOptions) error {
+	slog.Info("converting pixel format",
+		"input", inputPath,
+		"color_type", opts.ColorType,
+		"bits", opts.Bits,
+		"colors", opts.Colors,
+		"interlace", opts.Interlace)
+
+	if ext := strings.ToLower(filepath.Ext(outputPath)); ext != ".png" {
+		return &ErrUnsupportedFormat{Format: ext}
+	}
+	hdr, err := convertHeader(opts)
+	if err != nil {
+		return err
+	}
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+
+	out, err := createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := writeConverted(out, img, hdr, opts); err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+// ConvertImageReader writes the image read from r to w as a PNG with an exact
+// color type and bit depth, like ConvertImage.
+// Returns an error if the operation fails.
+func ConvertImageReader(r io.Reader, w io.Writer, opts ConvertOptions) error {
+	hdr, err := convertHeader(opts)
+	if err != nil {
+		return err
+	}
+	img, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	return writeConverted(w, img, hdr, opts)
+}
+
+// writeConverted encodes the image as a PNG in the format of hdr
+func writeConverted(w io.Writer, img image.Image, hdr pngHeader, opts ConvertOptions) error {
+	bounds := img.Bounds()
+	hdr.width, hdr.height = bounds.Dx(), bounds.Dy()
+	hdr.interlace = opts.Interlace
+
+	var sample func(x, y int, samples []uint16)
+	switch {
+	case hdr.colorType == pngColorPalette:
+		colors := opts.Colors
+		if len(opts.Palette) > 0 {
+			colors = len(opts.Palette)
+		}
+		if colors <= 0 {
+			colors = 1 << hdr.bitDepth
+		}
+		if colors > 1<<hdr.bitDepth {
+			return &ErrProcessing{Op: "convert", Err: fmt.Errorf("%d colors do not fit in %d bits", colors, hdr.bitDepth)}
+		}
+		if len(opts.Palette) > 0 {
+			hdr.palette = opts.Palette.Colors()
+		} else {
+			hdr.palette = medianCutPalette(toRGBA(img), colors)
+		}
+		paletted := quantize(img, hdr.palette, opts.Dither)
+		sample = func(x, y int, samples []uint16) {
+			samples[0] = uint16(paletted.ColorIndexAt(x, y))
+		}
+
+	case hdr.colorType == pngColorGray && hdr.bitDepth < 8:
+		// Quantize to the available levels; palette index i is gray level i
+		levels := 1 << hdr.bitDepth
+		palette := make(color.Palette, levels)
+		for i := range palette {
+			palette[i] = color.Gray{Y: uint8(i * 255 / (levels - 1))}
+		}
+		paletted := quantize(toGray(img), palette, opts.Dither)
+		sample = func(x, y int, samples []uint16) {
+			samples[0] = uint16(paletted.ColorIndexAt(x, y))
+		}
+
+	case hdr.colorType == pngColorGray:
+		shift := 16 - hdr.bitDepth
+		sample = func(x, y int, samples []uint16) {
+			samples[0] = color.Gray16Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray16).Y >> shift
+		}
+
+	default:
+		shift := 16 - hdr.bitDepth
+		sample = func(x, y int, samples []uint16) {
+			c := color.NRGBA64Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA64)
+			samples[0], samples[1], samples[2] = c.R>>shift, c.G>>shift, c.B>>shift
+			if len(samples) == 4 {
+				samples[3] = c.A >> shift
+			}
+		}
+	}
+
+	if err := encodePNG(w, hdr, sample); err != nil {
+		return &ErrProcessing{Op: "encode", Err: err}
+	}
+	return nil
+}
+
+// convertHeader validates the options and returns the PNG format they describe
+func convertHeader(opts ConvertOptions) (pngHeader, error) {
+	bits := opts.Bits
+	var colorType uint8
+	var allowed []int
+	switch opts.ColorType {
+	case ColorTypeGray:
+		colorType, allowed = pngColorGray, []int{1, 2, 4, 8, 16}
+	case ColorTypeGray16:
+		colorType, allowed = pngColorGray, []int{16}
+		if bits == 0 {
+			bits = 16
+		}
+	case ColorTypeRGB:
+		colorType, allowed = pngColorRGB, []int{8, 16}
+	case ColorTypeRGBA:
+		colorType, allowed = pngColorRGBA, []int{8, 16}
+	case ColorTypePalette:
+		colorType, allowed = pngColorPalette, []int{1, 2, 4, 8}
+	default:
+		return pngHeader{}, &ErrProcessing{Op: "convert", Err: fmt.Errorf("unknown color type: %s", opts.ColorType)}
+	}
+	if bits == 0 {
+		bits = 8
+	}
+	for _, b := range allowed {
+		if b == bits {
+			return pngHeader{colorType: colorType, bitDepth: uint8(bits)}, nil
+		}
+	}
+	return pngHeader{}, &ErrProcessing{Op: "convert", Err: fmt.Errorf("color type %s does not support %d bits", opts.ColorType, bits)}
+}
+
+// quantize maps the image onto the palette, optionally with error diffusion
+func quantize(img image.Image, palette color.Palette, dither bool) *image.Paletted {
+	bounds := img.Bounds()
+	paletted := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette)
+	if dither {
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), img, bounds.Min)
+	} else {
+		draw.Draw(paletted, paletted.Bounds(), img, bounds.Min, draw.Src)
+	}
+	return paletted
+}
+
+// medianCutPalette builds a palette of at most n colors by repeatedly
+// splitting the box of colors with the widest channel range at its median
+func medianCutPalette(img *image.RGBA, n int) color.Palette {
+	// Sample a bounded number of pixels so large images stay fast
+	step := max(1, len(img.Pix)/4/(1<<18))
+	var pixels [][3]uint8
+	for i := 0; i < len(img.Pix); i += 4 * step {
+		pixels = append(pixels, [3]uint8{img.Pix[i], img.Pix[i+1], img.Pix[i+2]})
+	}
+
+	// widest returns the channel with the largest range in a box and that range
+	widest := func(box [][3]uint8) (int, int) {
+		channel, spread := 0, -1
+		for c := 0; c < 3; c++ {
+			lo, hi := 255, 0
+			for _, p := range box {
+				lo, hi = min(lo, int(p[c])), max(hi, int(p[c]))
+			}
+			if hi-lo > spread {
+				channel, spread = c, hi-lo
+			}
+		}
+		return channel, spread
+	}
+
+	boxes := [][][3]uint8{pixels}
+	for len(boxes) < n {
+		split, channel, spread := -1, 0, 0
+		for i, box := range boxes {
+			if c, s := widest(box); len(box) > 1 && s > spread {
+				split, channel, spread = i, c, s
+			}
+		}
+		if split < 0 {
+			// Every box holds a single color
+			break
+		}
+		box := boxes[split]
+		sort.Slice(box, func(i, j int) bool { return box[i][channel] < box[j][channel] })
+		boxes[split] = box[:len(box)/2]
+		boxes = append(boxes, box[len(box)/2:])
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var sum [3]int
+		for _, p := range box {
+			for c := 0; c < 3; c++ {
+				sum[c] += int(p[c])
+			}
+		}
+		n := max(len(box), 1)
+		palette = append(palette, color.RGBA{R: uint8(sum[0] / n), G: uint8(sum[1] / n), B: uint8(sum[2] / n), A: 255})
+	}
+	return palette
+}
@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_convert.jpg")
+	if err := generateSingleTestImage(testInputPath, 60, 40); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	tests := []struct {
+		opts      ConvertOptions
+		colorType uint8
+		bitDepth  uint8
+		model     string
+	}{
+		{ConvertOptions{ColorType: ColorTypeGray, Bits: 1, Dither: true}, pngColorGray, 1, "*image.Gray"},
+		{ConvertOptions{ColorType: ColorTypeGray, Bits: 4}, pngColorGray, 4, "*image.Gray"},
+		{ConvertOptions{ColorType: ColorTypeGray}, pngColorGray, 8, "*image.Gray"},
+		{ConvertOptions{ColorType: ColorTypeGray16}, pngColorGray, 16, "*image.Gray16"},
+		{ConvertOptions{ColorType: ColorTypeRGB}, pngColorRGB, 8, "*image.RGBA"},
+		{ConvertOptions{ColorType: ColorTypeRGB, Bits: 16}, pngColorRGB, 16, "*image.RGBA64"},
+		{ConvertOptions{ColorType: ColorTypeRGBA}, pngColorRGBA, 8, "*image.NRGBA"},
+		{ConvertOptions{ColorType: ColorTypeRGBA, Bits: 16}, pngColorRGBA, 16, "*image.NRGBA64"},
+		{ConvertOptions{ColorType: ColorTypePalette, Bits: 2}, pngColorPalette, 2, "*image.Paletted"},
+		{ConvertOptions{ColorType: ColorTypePalette, Colors: 16, Dither: true}, pngColorPalette, 8, "*image.Paletted"},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("%s-%d", tt.opts.ColorType, tt.bitDepth)
+		t.Run(name, func(t *testing.T) {
+			testOutputPath := filepath.Join(testDir, "test_output_convert_"+name+".png")
+			if err := ConvertImage(testInputPath, testOutputPath, tt.opts); err != nil {
+				t.Fatalf("Failed to convert image: %v", err)
+			}
+
+			data, err := os.ReadFile(testOutputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			// IHDR follows the signature, chunk length and chunk type
+			if data[24] != tt.bitDepth || data[25] != tt.colorType {
+				t.Errorf("Expected bit depth %d and color type %d, got %d and %d", tt.bitDepth, tt.colorType, data[24], data[25])
+			}
+
+			file, err := os.Open(testOutputPath)
+			if err != nil {
+				t.Fatalf("Failed to open output: %v", err)
+			}
+			defer file.Close()
+			img, err := png.Decode(file)
+			if err != nil {
+				t.Fatalf("Failed to decode output: %v", err)
+			}
+			if model := fmt.Sprintf("%T", img); model != tt.model {
+				t.Errorf("Expected %s, got %s", tt.model, model)
+			}
+			if img.Bounds() != image.Rect(0, 0, 60, 40) {
+				t.Errorf("Unexpected bounds %v", img.Bounds())
+			}
+			if p, ok := img.(*image.Paletted); ok && len(p.Palette) > 1<<tt.bitDepth {
+				t.Errorf("Palette of %d colors does not fit in %d bits", len(p.Palette), tt.bitDepth)
+			}
+		})
+	}
+}
+
+func TestConvertImageInvalid(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_convert.jpg")
+	if err := generateSingleTestImage(testInputPath, 20, 20); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	for _, opts := range []ConvertOptions{
+		{ColorType: "cmyk"},
+		{ColorType: ColorTypeRGB, Bits: 4},
+		{ColorType: ColorTypeGray16, Bits: 8},
+		{ColorType: ColorTypePalette, Bits: 2, Colors: 8},
+	} {
+		if err := ConvertImage(testInputPath, filepath.Join(testDir, "out.png"), opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+	if err := ConvertImage(testInputPath, filepath.Join(testDir, "out.jpg"), ConvertOptions{ColorType: ColorTypeGray}); err == nil {
+		t.Errorf("Expected an error for a non-PNG output")
+	}
+}
+
+func TestConvertImageGrayValues(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_convert.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_convert.png")
+	if err := generateSingleTestImage(testInputPath, 30, 30); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	if err := ConvertImage(testInputPath, testOutputPath, ConvertOptions{ColorType: ColorTypeGray}); err != nil {
+		t.Fatalf("Failed to convert image: %v", err)
+	}
+
+	input, err := loadImage(testInputPath)
+	if err != nil {
+		t.Fatalf("Failed to load input: %v", err)
+	}
+	output, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load output: %v", err)
+	}
+	want, got := toGray(input), toGray(output)
+	for i := range want.Pix {
+		if d := int(want.Pix[i]) - int(got.Pix[i]); d < -1 || d > 1 {
+			t.Fatalf("Pixel %d: expected %d, got %d", i, want.Pix[i], got.Pix[i])
+		}
+	}
+}
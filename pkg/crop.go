@@ -0,0 +1,137 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// CropImage cuts the rectangle rect out of the input image, as Crop.
+// It takes the paths of the input and output files and the rectangle, from
+// the top left corner of the image.
+// Returns an error if the rectangle is outside the image or the operation
+// fails.
+func CropImage(inputPath string, outputPath string, rect image.Rectangle) error {
+	return defaultProcessor.CropImage(inputPath, outputPath, rect)
+}
+
+// CropImage is the package function CropImage with the configuration and logger of p
+func (p *Processor) CropImage(inputPath string, outputPath string, rect image.Rectangle) error {
+	p.logger().Info("cropping image",
+		"input", inputPath,
+		"output", outputPath,
+		"rect", rect)
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	cropped, err := Crop(img, rect)
+	if err != nil {
+		return err
+	}
+	return p.saveJPEG(outputPath, cropped)
+}
+
+// CropImageReader cuts the rectangle rect out of the image read from r and
+// writes it to w as JPEG, like CropImage.
+// Returns an error if the rectangle is outside the image or the operation
+// fails.
+func CropImageReader(r io.Reader, w io.Writer, rect image.Rectangle) error {
+	img, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	cropped, err := Crop(img, rect)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, cropped)
+}
+
+// CropImageGravity cuts a width x height rectangle out of the input image,
+// placed by the gravity, as CropGravity.
+// Returns an error if a size is negative or the operation fails.
+func CropImageGravity(inputPath string, outputPath string, g Gravity, width, height int) error {
+	return defaultProcessor.CropImageGravity(inputPath, outputPath, g, width, height)
+}
+
+// CropImageGravity is the package function CropImageGravity with the configuration and logger of p
+func (p *Processor) CropImageGravity(inputPath string, outputPath string, g Gravity, width, height int) error {
+	p.logger().Info("cropping image",
+		"input", inputPath,
+		"output", outputPath,
+		"gravity", g,
+		"width", width,
+		"height", height)
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	cropped, err := CropGravity(img, g, width, height)
+	if err != nil {
+		return err
+	}
+	return p.saveJPEG(outputPath, cropped)
+}
+
+// Crop returns the part of the image inside rect, from the top left corner
+// of the image, moved to the origin. The pixels are copied as they are,
+// without resampling, and grays and 16-bit images keep their type. A
+// rectangle overhanging the image is cut down to the part inside it.
+// Returns an error if the rectangle does not overlap the image.
+func Crop(img image.Image, rect image.Rectangle) (image.Image, error) {
+	bounds := img.Bounds()
+	r := rect.Add(bounds.Min).Intersect(bounds)
+	if r.Empty() {
+		return nil, &ErrProcessing{Op: "crop", Err: fmt.Errorf("rectangle %v is outside the %dx%d image", rect, bounds.Dx(), bounds.Dy())}
+	}
+
+	var dst draw.Image
+	size := image.Rectangle{Max: r.Size()}
+	switch img.(type) {
+	case *image.Gray:
+		dst = image.NewGray(size)
+	case *image.Gray16:
+		dst = image.NewGray16(size)
+	case *image.RGBA64, *image.NRGBA64:
+		dst = image.NewRGBA64(size)
+	default:
+		dst = image.NewRGBA(size)
+	}
+	draw.Copy(dst, image.Point{}, img, r, draw.Src, nil)
+	return dst, nil
+}
+
+// CropCenter cuts a width x height rectangle out of the middle of the image,
+// see CropGravity
+func CropCenter(img image.Image, width, height int) (image.Image, error) {
+	return CropGravity(img, GravityCenter, width, height)
+}
+
+// CropGravity cuts a width x height rectangle out of the image, placed by
+// the gravity: GravityNorth keeps the top of the image, centered across it.
+// A width or height of zero, or one larger than the image, keeps the whole
+// width or height, so the result is never larger than the image.
+// Returns an error if a size is negative.
+func CropGravity(img image.Image, g Gravity, width, height int) (image.Image, error) {
+	if width < 0 || height < 0 {
+		return nil, &ErrProcessing{Op: "crop", Err: fmt.Errorf("size must not be negative, got %dx%d", width, height)}
+	}
+	return Crop(img, gravityCropRect(img.Bounds().Size(), g, width, height))
+}
+
+// gravityCropRect returns the rectangle CropGravity cuts out of an image of
+// the given size
+func gravityCropRect(size image.Point, g Gravity, width, height int) image.Rectangle {
+	if width == 0 || width > size.X {
+		width = size.X
+	}
+	if height == 0 || height > size.Y {
+		height = size.Y
+	}
+	return g.Place(image.Rectangle{Max: size}, image.Pt(width, height), 0)
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCrop(t *testing.T) {
+	// Every pixel holds its coordinates, so the cut out part is recognizable
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), 0, 0xff})
+		}
+	}
+	origin := func(t *testing.T, got image.Image) image.Point {
+		t.Helper()
+		r, g, _, _ := got.At(0, 0).RGBA()
+		return image.Pt(int(r>>8), int(g>>8))
+	}
+
+	tests := []struct {
+		name   string
+		crop   func(image.Image) (image.Image, error)
+		size   image.Point
+		origin image.Point
+	}{
+		{"rect", func(img image.Image) (image.Image, error) { return Crop(img, image.Rect(5, 6, 15, 26)) }, image.Pt(10, 20), image.Pt(5, 6)},
+		{"overhanging", func(img image.Image) (image.Image, error) { return Crop(img, image.Rect(30, 20, 60, 60)) }, image.Pt(10, 10), image.Pt(30, 20)},
+		{"center", func(img image.Image) (image.Image, error) { return CropCenter(img, 20, 10) }, image.Pt(20, 10), image.Pt(10, 10)},
+		{"north", func(img image.Image) (image.Image, error) { return CropGravity(img, GravityNorth, 20, 10) }, image.Pt(20, 10), image.Pt(10, 0)},
+		{"south-east", func(img image.Image) (image.Image, error) { return CropGravity(img, GravitySouthEast, 20, 10) }, image.Pt(20, 10), image.Pt(20, 20)},
+		{"full height", func(img image.Image) (image.Image, error) { return CropGravity(img, GravityEast, 8, 0) }, image.Pt(8, 30), image.Pt(32, 0)},
+		{"larger", func(img image.Image) (image.Image, error) { return CropCenter(img, 100, 100) }, image.Pt(40, 30), image.Pt(0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.crop(img)
+			if err != nil {
+				t.Fatalf("Crop failed: %v", err)
+			}
+			if want := (image.Rectangle{Max: tt.size}); got.Bounds() != want {
+				t.Errorf("Expected %v, got %v", want, got.Bounds())
+			}
+			if o := origin(t, got); o != tt.origin {
+				t.Errorf("Expected the pixel at %v first, got %v", tt.origin, o)
+			}
+		})
+	}
+
+	// Sub-images are cut from their own top left corner, grays stay gray
+	sub := toGray(img).SubImage(image.Rect(10, 10, 40, 30))
+	got, err := Crop(sub, image.Rect(0, 0, 5, 5))
+	if err != nil {
+		t.Fatalf("Crop failed on a sub-image: %v", err)
+	}
+	if _, ok := got.(*image.Gray); !ok {
+		t.Errorf("Expected a gray image, got %T", got)
+	}
+	if want := toGray(img).GrayAt(10, 10); got.(*image.Gray).GrayAt(0, 0) != want {
+		t.Errorf("Expected the corner of the sub-image, got %v", got.At(0, 0))
+	}
+
+	if _, err := Crop(img, image.Rect(50, 50, 60, 60)); err == nil {
+		t.Error("Expected an error for a rectangle outside the image")
+	}
+	if _, err := CropGravity(img, GravityCenter, -1, 10); err == nil {
+		t.Error("Expected an error for a negative size")
+	}
+
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	input := writeTestImage(t, testDir, "test_input.png", img, encodePNGBuffer)
+	output := filepath.Join(testDir, "test_output.jpg")
+	if err := CropImage(input, output, image.Rect(0, 0, 16, 8)); err != nil {
+		t.Fatalf("CropImage failed: %v", err)
+	}
+	if got := decodeTestFile(t, output).Bounds(); got != image.Rect(0, 0, 16, 8) {
+		t.Errorf("Expected a 16x8 output, got %v", got)
+	}
+	if err := CropImageGravity(input, output, GravitySouth, 24, 12); err != nil {
+		t.Fatalf("CropImageGravity failed: %v", err)
+	}
+	if got := decodeTestFile(t, output).Bounds(); got != image.Rect(0, 0, 24, 12) {
+		t.Errorf("Expected a 24x12 output, got %v", got)
+	}
+	h, err := NewImageHandle(img).Crop(image.Rect(0, 0, 20, 20)).CropGravity(GravityCenter, 10, 10).Image()
+	if err != nil || h.Bounds() != image.Rect(0, 0, 10, 10) || origin(t, h) != image.Pt(5, 5) {
+		t.Errorf("Expected the handle to crop twice, got %v", err)
+	}
+}
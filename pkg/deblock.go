@@ -0,0 +1,127 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+)
+
+// jpegBlockSize is the DCT block size used by JPEG for luma
+const jpegBlockSize = 8
+
+// DeblockImage reduces JPEG blocking and ringing artifacts in the input image.
+// Small steps across the 8x8 block grid (16x16 for the usually subsampled chroma)
+// are smoothed away when both sides of the boundary are flat, and the remaining
+// ringing around edges is reduced with an edge-preserving sigma filter.
+// Real edges, which produce large steps, are left untouched.
+// It takes the paths of the input and output files and the strength (1 to 5).
+// Returns an error if the operation fails.
+func DeblockImage(inputPath string, outputPath string, strength int) error {
+	slog.Info("deblocking image",
+		"input", inputPath,
+		"strength", strength)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	return saveJPEG(outputPath, Deblock(img, strength))
+}
+
+// DeblockImageReader reduces the JPEG artifacts of the image read from r like
+// DeblockImage and writes it to w as JPEG.
+// Returns an error if the operation fails.
+func DeblockImageReader(r io.Reader, w io.Writer, strength int) error {
+	img, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, Deblock(img, strength))
+}
+
+// Deblock reduces the JPEG blocking and ringing artifacts of the image with
+// the given strength (1 to 5), like DeblockImage.
+func Deblock(img image.Image, strength int) image.Image {
+	strength = min(max(strength, 1), 5)
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	out := image.NewYCbCr(image.Rect(0, 0, w, h), image.YCbCrSubsampleRatio444)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			i := y*w + x
+			out.Y[i], out.Cb[i], out.Cr[i] = yy, cb, cr
+		}
+	}
+
+	deblockPlane(out.Y, w, h, jpegBlockSize, strength)
+	deblockPlane(out.Cb, w, h, jpegBlockSize*2, strength)
+	deblockPlane(out.Cr, w, h, jpegBlockSize*2, strength)
+	out.Y = deringPlane(out.Y, w, h, strength*3)
+	return out
+}
+
+// deblockPlane smooths small steps across the block grid of a single plane in place
+func deblockPlane(plane []uint8, w, h, blockSize, strength int) {
+	// alpha bounds the step across the boundary, beta the variation on either side
+	alpha := 4 * strength
+	beta := strength + 1
+
+	filter := func(p1, p0, q0, q1 *uint8) {
+		a, b, c, d := int(*p1), int(*p0), int(*q0), int(*q1)
+		if abs(b-c) >= alpha || abs(a-b) >= beta || abs(d-c) >= beta {
+			return
+		}
+		*p0 = uint8((a + 2*b + c + 2) / 4)
+		*q0 = uint8((b + 2*c + d + 2) / 4)
+	}
+
+	// Vertical boundaries
+	for y := 0; y < h; y++ {
+		row := plane[y*w : (y+1)*w]
+		for x := blockSize; x+1 < w; x += blockSize {
+			filter(&row[x-2], &row[x-1], &row[x], &row[x+1])
+		}
+	}
+	// Horizontal boundaries
+	for y := blockSize; y+1 < h; y += blockSize {
+		for x := 0; x < w; x++ {
+			filter(&plane[(y-2)*w+x], &plane[(y-1)*w+x], &plane[y*w+x], &plane[(y+1)*w+x])
+		}
+	}
+}
+
+// deringPlane applies a 3x3 sigma filter: each pixel becomes the mean of the
+// neighbours within tolerance of it, which flattens ringing without blurring edges
+func deringPlane(plane []uint8, w, h, tolerance int) []uint8 {
+	out := make([]uint8, len(plane))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			center := int(plane[y*w+x])
+			sum, count := 0, 0
+			for dy := -1; dy <= 1; dy++ {
+				sy := min(max(y+dy, 0), h-1)
+				for dx := -1; dx <= 1; dx++ {
+					sx := min(max(x+dx, 0), w-1)
+					v := int(plane[sy*w+sx])
+					if abs(v-center) <= tolerance {
+						sum += v
+						count++
+					}
+				}
+			}
+			out[y*w+x] = uint8((sum + count/2) / count)
+		}
+	}
+	return out
+}
+
+// abs returns the absolute value of an int
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeblockPlane(t *testing.T) {
+	// Two flat 8x8 blocks side by side with a small step between them
+	w, h := 16, 8
+	plane := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < 8 {
+				plane[y*w+x] = 100
+			} else {
+				plane[y*w+x] = 106
+			}
+		}
+	}
+
+	deblockPlane(plane, w, h, 8, 2)
+	if step := int(plane[8]) - int(plane[7]); step >= 6 {
+		t.Errorf("Expected the block step to shrink, got %d", step)
+	}
+
+	// A strong edge must be preserved
+	for y := 0; y < h; y++ {
+		for x := 8; x < w; x++ {
+			plane[y*w+x] = 220
+		}
+	}
+	before := plane[7]
+	deblockPlane(plane, w, h, 8, 2)
+	if plane[7] != before || plane[8] != 220 {
+		t.Errorf("Expected a strong edge to be left untouched")
+	}
+}
+
+func TestDeblockImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_deblock.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_deblock.jpg")
+	if err := generateSingleTestImage(testInputPath, 100, 100); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	if err := DeblockImage(testInputPath, testOutputPath, 2); err != nil {
+		t.Fatalf("Failed to deblock image: %v", err)
+	}
+	if _, err := os.Stat(testOutputPath); os.IsNotExist(err) {
+		t.Errorf("Output file was not created")
+	}
+}
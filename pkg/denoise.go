@@ -0,0 +1,398 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+)
+
+// DenoiseOptions controls DenoiseImageWithOptions
+type DenoiseOptions struct {
+	// Radius of the median filter window; 1 gives the 3x3 filter used by DenoiseImage
+	Radius int
+	// Auto estimates the noise level of each image and picks the radius from it,
+	// ignoring Radius (and LumaRadius/ChromaRadius)
+	Auto bool
+	// Separate filters luma and chroma independently in YCbCr using LumaRadius
+	// and ChromaRadius instead of filtering the RGB channels with Radius.
+	// Chroma noise can be removed much more aggressively than luma noise
+	// without visibly softening detail.
+	Separate     bool
+	LumaRadius   int
+	ChromaRadius int
+	// Progress, when set, receives the rows filtered, with the luma and the
+	// two chroma planes as three passes in separate mode
+	Progress ProgressFunc
+}
+
+// DenoiseResult describes what DenoiseImageWithOptions did
+type DenoiseResult struct {
+	// NoiseSigma is the estimated standard deviation of the noise, on a 0-255
+	// scale; it is only estimated in auto mode and zero otherwise
+	NoiseSigma float64 `json:"noise_sigma"`
+	// Radius is the median filter radius that was applied (0 means the image was left as is)
+	Radius int `json:"radius"`
+	// LumaRadius and ChromaRadius are the radii applied in separate mode
+	LumaRadius   int `json:"luma_radius,omitempty"`
+	ChromaRadius int `json:"chroma_radius,omitempty"`
+}
+
+// DenoiseImageWithOptions applies a median filter to the input image.
+// In auto mode the noise level is estimated first and the filter strength is
+// chosen from it, so one setting works for both clean and very noisy shots.
+// It takes the paths of the input and output files and the options.
+// Returns the estimated noise and applied radius, or an error if the operation fails.
+func DenoiseImageWithOptions(inputPath string, outputPath string, opts DenoiseOptions) (*DenoiseResult, error) {
+	return defaultProcessor.DenoiseImageWithOptions(inputPath, outputPath, opts)
+}
+
+// DenoiseImageWithOptions is the package function DenoiseImageWithOptions with the configuration and logger of p
+func (p *Processor) DenoiseImageWithOptions(inputPath string, outputPath string, opts DenoiseOptions) (*DenoiseResult, error) {
+	return p.DenoiseImageContext(context.Background(), inputPath, outputPath, opts)
+}
+
+// DenoiseImageContext denoises the input image like DenoiseImageWithOptions.
+// A large radius on a large image is slow; when ctx is cancelled the filter
+// stops early and ctx's error is returned without writing the output.
+func DenoiseImageContext(ctx context.Context, inputPath string, outputPath string, opts DenoiseOptions) (*DenoiseResult, error) {
+	return defaultProcessor.DenoiseImageContext(ctx, inputPath, outputPath, opts)
+}
+
+// DenoiseImageContext is the package function DenoiseImageContext with the configuration and logger of p
+func (p *Processor) DenoiseImageContext(ctx context.Context, inputPath string, outputPath string, opts DenoiseOptions) (*DenoiseResult, error) {
+	return p.denoiseImageFile(ctx, inputPath, outputPath, opts, p.Config().JpegQuality)
+}
+
+// DenoiseImageWith applies a median filter to the input image like
+// DenoiseImage, with the window set by WithKernelSize and the quality set by
+// WithQuality, reporting the rows done to the function set by WithProgress.
+// Returns an error if an option is invalid or the operation fails.
+func DenoiseImageWith(inputPath string, outputPath string, opts ...Option) error {
+	return defaultProcessor.DenoiseImageWith(inputPath, outputPath, opts...)
+}
+
+// DenoiseImageWith is the package function DenoiseImageWith with the configuration and logger of p
+func (p *Processor) DenoiseImageWith(inputPath string, outputPath string, opts ...Option) error {
+	s, err := newSettings("denoise", opts)
+	if err != nil {
+		return err
+	}
+	_, err = p.denoiseImageFile(withBuffers(context.Background(), s.buffers), inputPath, outputPath, DenoiseOptions{Radius: s.radius(1), Progress: s.progress}, s.jpegQuality(p.Config().JpegQuality))
+	return s.recordFile(outputPath, err)
+}
+
+// denoiseImageFile does the work of DenoiseImageContext, saving the result
+// with the given JPEG quality
+func (p *Processor) denoiseImageFile(ctx context.Context, inputPath string, outputPath string, opts DenoiseOptions, quality int) (*DenoiseResult, error) {
+	p.logger().Info("denoising image",
+		"input", inputPath,
+		"radius", opts.Radius,
+		"auto", opts.Auto)
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	// The result is discarded once saved, so its buffer goes back to a pool
+	pool := buffersFrom(ctx)
+	if pool == nil {
+		pool = buffers
+		ctx = withBuffers(ctx, pool)
+	}
+	denoised, result, err := denoiseImage(ctx, img, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer pool.Put(denoised)
+	if err := p.saveJPEGQuality(outputPath, denoised, quality); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DenoiseImageReaderWithOptions denoises the image read from r like
+// DenoiseImageWithOptions and writes it to w as JPEG.
+// Returns the estimated noise and applied radius, or an error if the operation fails.
+func DenoiseImageReaderWithOptions(r io.Reader, w io.Writer, opts DenoiseOptions) (*DenoiseResult, error) {
+	return defaultProcessor.DenoiseImageReaderWithOptions(r, w, opts)
+}
+
+// DenoiseImageReaderWithOptions is the package function DenoiseImageReaderWithOptions with the configuration and logger of p
+func (p *Processor) DenoiseImageReaderWithOptions(r io.Reader, w io.Writer, opts DenoiseOptions) (*DenoiseResult, error) {
+	return p.denoiseImageStream(context.Background(), r, w, opts, p.Config().JpegQuality)
+}
+
+// DenoiseImageReaderWith denoises the image read from r like DenoiseImageWith
+// and writes it to w as JPEG.
+// Returns an error if an option is invalid or the operation fails.
+func DenoiseImageReaderWith(r io.Reader, w io.Writer, opts ...Option) error {
+	return defaultProcessor.DenoiseImageReaderWith(r, w, opts...)
+}
+
+// DenoiseImageReaderWith is the package function DenoiseImageReaderWith with the configuration and logger of p
+func (p *Processor) DenoiseImageReaderWith(r io.Reader, w io.Writer, opts ...Option) error {
+	s, err := newSettings("denoise", opts)
+	if err != nil {
+		return err
+	}
+	w = s.countOutput(w)
+	_, err = p.denoiseImageStream(withBuffers(context.Background(), s.buffers), r, w, DenoiseOptions{Radius: s.radius(1), Progress: s.progress}, s.jpegQuality(p.Config().JpegQuality))
+	return s.recordOutput(w, err)
+}
+
+// denoiseImageStream does the work of DenoiseImageReaderWithOptions,
+// encoding the result with the given JPEG quality and giving its buffer to
+// the pool of ctx, or the package's own
+func (p *Processor) denoiseImageStream(ctx context.Context, r io.Reader, w io.Writer, opts DenoiseOptions, quality int) (*DenoiseResult, error) {
+	img, err := p.decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	pool := buffersFrom(ctx)
+	if pool == nil {
+		pool = buffers
+	}
+	denoised, result, err := denoiseImage(withBuffers(ctx, pool), img, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer pool.Put(denoised)
+	if err := encodeJPEGQuality(w, denoised, quality); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DenoiseWith median-filters the image like Denoise, with the window set by
+// WithKernelSize.
+// Returns an error if an option is invalid.
+func DenoiseWith(img image.Image, opts ...Option) (image.Image, error) {
+	s, err := newSettings("denoise", opts)
+	if err != nil {
+		return nil, err
+	}
+	// The background context is never cancelled
+	denoised, _, err := denoiseImage(withBuffers(context.Background(), s.buffers), img, DenoiseOptions{Radius: s.radius(1), Progress: s.progress})
+	if err != nil {
+		return nil, err
+	}
+	return denoised, nil
+}
+
+// DenoiseWithOptions median-filters the image like DenoiseImageWithOptions,
+// choosing the radius from the estimated noise in auto mode.
+// Returns the denoised image and the estimated noise and applied radius, or
+// an error if a radius is negative.
+func DenoiseWithOptions(img image.Image, opts DenoiseOptions) (image.Image, *DenoiseResult, error) {
+	// The background context is never cancelled
+	return denoiseImage(context.Background(), img, opts)
+}
+
+// denoiseImage median-filters the image like DenoiseWithOptions, checking
+// ctx for cancellation between rows.
+func denoiseImage(ctx context.Context, img image.Image, opts DenoiseOptions) (image.Image, *DenoiseResult, error) {
+	if opts.Radius < 0 || opts.LumaRadius < 0 || opts.ChromaRadius < 0 {
+		return nil, nil, &ErrProcessing{Op: "denoise", Err: fmt.Errorf("radius must not be negative, got %d (luma %d, chroma %d)", opts.Radius, opts.LumaRadius, opts.ChromaRadius)}
+	}
+	if opts.Progress != nil {
+		ctx = withProgress(ctx, opts.Progress)
+	}
+	result := &DenoiseResult{Radius: opts.Radius}
+	if opts.Separate {
+		result.Radius = 0
+		result.LumaRadius = opts.LumaRadius
+		result.ChromaRadius = opts.ChromaRadius
+	}
+	if opts.Auto {
+		gray := grayInto(buffers.newGray(img.Bounds()), img)
+		result.NoiseSigma = estimateNoiseSigma(gray)
+		buffers.Put(gray)
+		result.Radius = radiusForNoise(result.NoiseSigma)
+		if opts.Separate {
+			result.LumaRadius = result.Radius
+			result.ChromaRadius = result.Radius + 1
+			result.Radius = 0
+		}
+		slog.Info("estimated noise",
+			"sigma", result.NoiseSigma,
+			"radius", result.Radius,
+			"luma_radius", result.LumaRadius,
+			"chroma_radius", result.ChromaRadius)
+	}
+
+	if opts.Separate {
+		denoised, err := denoiseYCbCr(ctx, img, result.LumaRadius, result.ChromaRadius)
+		if err != nil {
+			return nil, nil, err
+		}
+		return denoised, result, nil
+	}
+	// Apply median filter for denoising
+	bounds := img.Bounds()
+	rgba := buffersFrom(ctx).newRGBA(bounds)
+	progress := progressFrom(ctx)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		progress.report(y-bounds.Min.Y, bounds.Dy())
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			rgba.Set(x, y, medianFilter(img, x, y, result.Radius))
+		}
+	}
+	progress.report(bounds.Dy(), bounds.Dy())
+	return rgba, result, nil
+}
+
+// denoiseYCbCr median-filters the luma and chroma planes of the image with separate radii
+func denoiseYCbCr(ctx context.Context, img image.Image, lumaRadius, chromaRadius int) (*image.YCbCr, error) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	out := image.NewYCbCr(image.Rect(0, 0, w, h), image.YCbCrSubsampleRatio444)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			i := y*w + x
+			out.Y[i], out.Cb[i], out.Cr[i] = yy, cb, cr
+		}
+	}
+
+	var err error
+	progress := progressFrom(ctx)
+	if out.Y, err = medianPlane(withProgress(ctx, progress.phase(0, 3)), out.Y, w, h, lumaRadius); err != nil {
+		return nil, err
+	}
+	if out.Cb, err = medianPlane(withProgress(ctx, progress.phase(1, 3)), out.Cb, w, h, chromaRadius); err != nil {
+		return nil, err
+	}
+	if out.Cr, err = medianPlane(withProgress(ctx, progress.phase(2, 3)), out.Cr, w, h, chromaRadius); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// medianPlane median-filters a single 8-bit plane, clamping the window at the border.
+// Returns ctx's error when ctx is cancelled.
+func medianPlane(ctx context.Context, plane []uint8, w, h, radius int) ([]uint8, error) {
+	progress := progressFrom(ctx)
+	if radius <= 0 {
+		progress.report(1, 1)
+		return plane, nil
+	}
+	out := make([]uint8, len(plane))
+	var histogram [256]int
+	half := (2*radius + 1) * (2*radius + 1) / 2
+	for y := 0; y < h; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		progress.report(y, h)
+		for x := 0; x < w; x++ {
+			histogram = [256]int{}
+			for dy := -radius; dy <= radius; dy++ {
+				sy := min(max(y+dy, 0), h-1)
+				for dx := -radius; dx <= radius; dx++ {
+					sx := min(max(x+dx, 0), w-1)
+					histogram[plane[sy*w+sx]]++
+				}
+			}
+			count := 0
+			for v := 0; v < 256; v++ {
+				count += histogram[v]
+				if count > half {
+					out[y*w+x] = uint8(v)
+					break
+				}
+			}
+		}
+	}
+	progress.report(h, h)
+	return out, nil
+}
+
+// EstimateNoise estimates the standard deviation of the noise in the input image.
+// It takes the path of the input file.
+// Returns the noise sigma on a 0-255 scale, or an error if the operation fails.
+func EstimateNoise(inputPath string) (float64, error) {
+	return defaultProcessor.EstimateNoise(inputPath)
+}
+
+// EstimateNoise is the package function EstimateNoise with the configuration and logger of p
+func (p *Processor) EstimateNoise(inputPath string) (float64, error) {
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return 0, err
+	}
+	return estimateNoiseSigma(toGray(img)), nil
+}
+
+// EstimateNoiseReader estimates the noise in the image read from r like EstimateNoise.
+// Returns the noise sigma on a 0-255 scale, or an error if the operation fails.
+func EstimateNoiseReader(r io.Reader) (float64, error) {
+	return defaultProcessor.EstimateNoiseReader(r)
+}
+
+// EstimateNoiseReader is the package function EstimateNoiseReader with the configuration and logger of p
+func (p *Processor) EstimateNoiseReader(r io.Reader) (float64, error) {
+	img, err := p.decodeImage(r)
+	if err != nil {
+		return 0, err
+	}
+	return estimateNoiseSigma(toGray(img)), nil
+}
+
+// maxLaplacianResidual is the largest absolute response of the Laplacian
+// kernel of estimateNoiseSigma to 8-bit samples
+const maxLaplacianResidual = 16 * 255
+
+// estimateNoiseSigma estimates the noise level from the median absolute
+// deviation of a Laplacian high-pass residual, which is dominated by noise
+// rather than by image structure. The residuals are integers, so their median
+// is taken from a histogram instead of sorting them.
+func estimateNoiseSigma(gray *image.Gray) float64 {
+	bounds := gray.Bounds()
+	if bounds.Dx() < 3 || bounds.Dy() < 3 {
+		return 0
+	}
+
+	var histogram [maxLaplacianResidual + 1]int
+	at := func(x, y int) int { return int(gray.GrayAt(x, y).Y) }
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+			r := at(x-1, y-1) - 2*at(x, y-1) + at(x+1, y-1) -
+				2*at(x-1, y) + 4*at(x, y) - 2*at(x+1, y) +
+				at(x-1, y+1) - 2*at(x, y+1) + at(x+1, y+1)
+			histogram[max(r, -r)]++
+		}
+	}
+	half := (bounds.Dx() - 2) * (bounds.Dy() - 2) / 2
+	mad, count := 0.0, 0
+	for v, n := range histogram {
+		count += n
+		if count > half {
+			mad = float64(v)
+			break
+		}
+	}
+
+	// 0.6745 converts the MAD of a Gaussian into its sigma, and 6 is the
+	// L2 norm of the Laplacian kernel above
+	return mad / 0.6745 / 6
+}
+
+// radiusForNoise maps an estimated noise sigma to a median filter radius
+func radiusForNoise(sigma float64) int {
+	switch {
+	case sigma < 1.5:
+		return 0
+	case sigma < 8:
+		return 1
+	case sigma < 20:
+		return 2
+	}
+	return 3
+}
@@ -0,0 +1,100 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEstimateNoiseSigma(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, sigma := range []float64{0, 5, 15} {
+		gray := image.NewGray(image.Rect(0, 0, 128, 128))
+		for i := range gray.Pix {
+			v := 128 + rng.NormFloat64()*sigma
+			gray.Pix[i] = uint8(min(max(v, 0), 255))
+		}
+
+		estimated := estimateNoiseSigma(gray)
+		if estimated < sigma*0.7-0.5 || estimated > sigma*1.3+0.5 {
+			t.Errorf("Expected noise sigma of about %v, estimated %v", sigma, estimated)
+		}
+	}
+}
+
+func TestDenoiseImageWithOptionsAuto(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	if err := GenerateTestImage(testDir, 100, 100); err != nil {
+		t.Fatalf("Failed to generate test images: %v", err)
+	}
+
+	testInputPath := filepath.Join(testDir, "noise_test.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_denoise.jpg")
+
+	result, err := DenoiseImageWithOptions(testInputPath, testOutputPath, DenoiseOptions{Auto: true})
+	if err != nil {
+		t.Fatalf("Failed to denoise image: %v", err)
+	}
+	if result.Radius != 3 {
+		t.Errorf("Expected the strongest filter for a pure noise image, got radius %d (sigma %v)", result.Radius, result.NoiseSigma)
+	}
+}
+
+func TestDenoiseImageNegativeRadius(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_radius.jpg")
+	if err := generateSingleTestImage(testInputPath, 40, 30); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	for _, opts := range []DenoiseOptions{
+		{Radius: -1},
+		{Separate: true, LumaRadius: -1, ChromaRadius: 2},
+		{Separate: true, LumaRadius: 1, ChromaRadius: -2},
+	} {
+		_, err := DenoiseImageWithOptions(testInputPath, filepath.Join(testDir, "test_output_radius.jpg"), opts)
+		var procErr *ErrProcessing
+		if !errors.As(err, &procErr) || procErr.Op != "denoise" {
+			t.Errorf("Expected a denoise error for %+v, got %v", opts, err)
+		}
+		if img, _, err := DenoiseWithOptions(image.NewGray(image.Rect(0, 0, 8, 8)), opts); img != nil || err == nil {
+			t.Errorf("Expected DenoiseWithOptions to fail for %+v", opts)
+		}
+		input, err := os.Open(testInputPath)
+		if err != nil {
+			t.Fatalf("Failed to open test image: %v", err)
+		}
+		_, err = DenoiseImageReaderWithOptions(input, io.Discard, opts)
+		input.Close()
+		if !errors.As(err, &procErr) || procErr.Op != "denoise" {
+			t.Errorf("Expected DenoiseImageReaderWithOptions to fail for %+v, got %v", opts, err)
+		}
+	}
+}
+
+func TestDenoiseYCbCr(t *testing.T) {
+	// Gray image with colored speckles: chroma filtering alone should remove the color
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = 128, 128, 128, 255
+	}
+	img.Set(10, 10, color.RGBA{R: 255, G: 0, B: 0, A: 255})
+
+	out, err := denoiseYCbCr(context.Background(), img, 0, 1)
+	if err != nil {
+		t.Fatalf("Failed to denoise: %v", err)
+	}
+	r, g, b, _ := out.At(10, 10).RGBA()
+	if r>>8 > g>>8+20 || b>>8 > g>>8+20 {
+		t.Errorf("Expected the color speckle to be neutralized, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+}
@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeterministic(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	original := currentConfig()
+	defer SetConfig(original)
+	c := *original
+	c.Deterministic = true
+	SetConfig(&c)
+
+	// Generated noise is the same on every run
+	var noise [2][]byte
+	for i := range noise {
+		dir := filepath.Join(testDir, string(rune('a'+i)))
+		if err := GenerateTestImage(dir, 32, 32); err != nil {
+			t.Fatalf("GenerateTestImage failed: %v", err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "noise_test.jpg"))
+		if err != nil {
+			t.Fatalf("Failed to read the noise image: %v", err)
+		}
+		noise[i] = data
+	}
+	if !bytes.Equal(noise[0], noise[1]) {
+		t.Error("Noise images of two deterministic runs differ")
+	}
+
+	// Rows are visited in order, so a sum across rows never races
+	img := kernelTestImages(40, 30)["gray"]
+	var rows []int
+	ForEachRowParallel(img, func(y int, row []uint8) {
+		rows = append(rows, y)
+	})
+	for i, y := range rows {
+		if y != i {
+			t.Fatalf("Expected rows in order, got %v", rows)
+		}
+	}
+	if len(rows) != 30 {
+		t.Errorf("Expected 30 rows, got %d", len(rows))
+	}
+
+	// Operations give the same bytes on every run
+	input := writeTestImage(t, testDir, "test_input.png", kernelTestImages(64, 48)["rgba"], encodePNGBuffer)
+	var outputs [2][]byte
+	for i := range outputs {
+		output := filepath.Join(testDir, "test_output.jpg")
+		if err := Transform(input, output, RotateOp(17), ScaleOp(0.7)); err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatalf("Failed to read the output: %v", err)
+		}
+		outputs[i] = data
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Error("Outputs of two deterministic runs differ")
+	}
+}
+
+func TestDeterministicProcessor(t *testing.T) {
+	// The configuration of the processor running the operation applies,
+	// whatever the default one says
+	c := *currentConfig()
+	c.Deterministic = true
+	p := New(&c, nil)
+
+	img := kernelTestImages(40, 30)["gray"]
+	var rows []int
+	p.ForEachRowParallel(img, func(y int, row []uint8) {
+		rows = append(rows, y)
+	})
+	if len(rows) != 30 {
+		t.Fatalf("Expected 30 rows, got %d", len(rows))
+	}
+	for i, y := range rows {
+		if y != i {
+			t.Fatalf("Expected rows in order, got %v", rows)
+		}
+	}
+}
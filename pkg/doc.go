@@ -0,0 +1,30 @@
+// Package processor implements the image operations of go-image-processor.
+//
+// # Concurrency
+//
+// All exported functions are safe for concurrent use from multiple goroutines.
+// Operations keep their working state local to each call; the only shared
+// state is read-only data such as lookup tables and presets, a cache of the
+// tables computed from parameters, which is guarded by a mutex, and the
+// configuration, which is read and replaced atomically (see SetConfig).
+//
+// The package functions log through the default slog logger and never
+// replace it, so applications configure logging with slog.SetDefault. A
+// Processor created with New logs to its own logger and uses its own
+// configuration instead of config.yaml. Test image
+// generation draws from the locked global source of golang.org/x/exp/rand.
+//
+// # Reproducibility
+//
+// With Deterministic set in the configuration, an operation gives
+// bit-identical outputs for the same inputs on every run: test images are
+// generated from a fixed seed and rows are processed in order on one
+// goroutine, so nothing depends on scheduling. The work the package spreads
+// over goroutines otherwise never combines results across rows or files, so
+// its outputs are already the same; the setting matters for callbacks given
+// to ForEachRowParallel that accumulate, and for generated images. Results
+// are identical across machines running the same binary. Builds for
+// different targets may differ in the last bit of some pixels, since the
+// compiler may fuse floating-point multiplies and adds on some of them, such
+// as arm64, ppc64le, s390x and amd64 with GOAMD64=v3.
+package processor
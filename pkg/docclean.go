@@ -0,0 +1,206 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"sort"
+
+	"github.com/nfnt/resize"
+)
+
+// Document cleanup presets accepted by DocCleanImage
+const (
+	DocCleanDocument   = "document"
+	DocCleanWhiteboard = "whiteboard"
+)
+
+// backgroundSampleSize is the longest side of the downscaled image on which
+// the background illumination is estimated
+const backgroundSampleSize = 256
+
+// DocCleanOptions are the parameters of the document cleanup
+type DocCleanOptions struct {
+	// Saturation scales the chroma; above 1 makes marker and ink colors more vivid
+	Saturation float64
+	// Sharpen is the unsharp mask amount; zero disables sharpening
+	Sharpen float64
+	// BlackPoint is the fraction of pixels mapped to black after whitening
+	BlackPoint float64
+}
+
+// docCleanPresets are the options used for each preset
+var docCleanPresets = map[string]DocCleanOptions{
+	DocCleanDocument:   {Saturation: 1.2, Sharpen: 0.6, BlackPoint: 0.02},
+	DocCleanWhiteboard: {Saturation: 1.8, Sharpen: 0.8, BlackPoint: 0.005},
+}
+
+// DocCleanImage whitens the background of a photographed document or whiteboard.
+// Uneven lighting is flattened by dividing by an estimate of the background,
+// which also brings the paper to white, then the marker colors are made more
+// vivid, the black point is stretched and the result is mildly sharpened.
+// It takes the paths of the input and output files and the preset
+// (document or whiteboard).
+// Returns an error if the operation fails.
+func DocCleanImage(inputPath string, outputPath string, preset string) error {
+	slog.Info("cleaning document",
+		"input", inputPath,
+		"preset", preset)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	out, err := DocClean(img, preset)
+	if err != nil {
+		return err
+	}
+	return saveJPEG(outputPath, out)
+}
+
+// DocCleanImageReader cleans the document read from r like DocCleanImage and
+// writes it to w as JPEG.
+// Returns an error if the operation fails.
+func DocCleanImageReader(r io.Reader, w io.Writer, preset string) error {
+	img, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	out, err := DocClean(img, preset)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, out)
+}
+
+// DocClean whitens the background of a photographed document or whiteboard
+// with the steps of the preset (document or whiteboard), like DocCleanImage.
+// Returns an error if the preset is unknown.
+func DocClean(img image.Image, preset string) (image.Image, error) {
+	opts, ok := docCleanPresets[preset]
+	if !ok {
+		return nil, &ErrProcessing{Op: "docclean", Err: fmt.Errorf("unknown preset: %s", preset)}
+	}
+
+	out := flattenIllumination(toRGBA(img))
+	adjustSaturation(out, opts.Saturation)
+	stretchBlackPoint(out, opts.BlackPoint)
+	if opts.Sharpen > 0 {
+		unsharpMask(out, 1, opts.Sharpen)
+	}
+	return out, nil
+}
+
+// flattenIllumination divides every channel by an estimate of the paper
+// color at each point, so the background becomes uniformly white
+func flattenIllumination(img *image.RGBA) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Estimate the background on a small copy: a max filter removes the
+	// strokes, which are darker than the paper, and a blur smooths the result
+	scale := float64(backgroundSampleSize) / float64(max(w, h))
+	sw, sh := max(1, int(float64(w)*min(scale, 1))), max(1, int(float64(h)*min(scale, 1)))
+	small := toRGBA(resize.Resize(uint(sw), uint(sh), img, resize.Bilinear))
+	radius := max(2, max(sw, sh)/32)
+	background := maxFilter(small, radius)
+	blurRegion(background, background.Bounds(), radius)
+	full := toRGBA(resize.Resize(uint(w), uint(h), background, resize.Bilinear))
+
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			src := img.RGBAAt(bounds.Min.X+x, bounds.Min.Y+y)
+			bg := full.RGBAAt(x, y)
+			divide := func(v, b uint8) uint8 {
+				return uint8(min(float64(v)*255/float64(max(b, 1)), 255))
+			}
+			out.SetRGBA(x, y, color.RGBA{R: divide(src.R, bg.R), G: divide(src.G, bg.G), B: divide(src.B, bg.B), A: 255})
+		}
+	}
+	return out
+}
+
+// maxFilter returns the per-channel maximum over the square window of the
+// given radius around every pixel
+func maxFilter(img *image.RGBA, radius int) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	horizontal := image.NewRGBA(image.Rect(0, 0, w, h))
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	// The square window is separable into a horizontal and a vertical pass
+	for pass, dst := range []*image.RGBA{horizontal, out} {
+		src := img
+		if pass == 1 {
+			src = horizontal
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				var m [4]uint8
+				for d := -radius; d <= radius; d++ {
+					sx, sy := x, y
+					if pass == 0 {
+						sx = min(max(x+d, 0), w-1)
+					} else {
+						sy = min(max(y+d, 0), h-1)
+					}
+					i := src.PixOffset(src.Bounds().Min.X+sx, src.Bounds().Min.Y+sy)
+					for c := 0; c < 4; c++ {
+						m[c] = max(m[c], src.Pix[i+c])
+					}
+				}
+				copy(dst.Pix[dst.PixOffset(x, y):], m[:])
+			}
+		}
+	}
+	return out
+}
+
+// adjustSaturation scales the chroma of every pixel in place
+func adjustSaturation(img *image.RGBA, factor float64) {
+	scale := saturationTable(factor)
+	for i := 0; i < len(img.Pix); i += 4 {
+		yy, cb, cr := color.RGBToYCbCr(img.Pix[i], img.Pix[i+1], img.Pix[i+2])
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2] = color.YCbCrToRGB(yy, scale[cb], scale[cr])
+	}
+}
+
+// stretchBlackPoint maps the darkest fraction of pixels to black and
+// stretches the rest of the range linearly, keeping white at white
+func stretchBlackPoint(img *image.RGBA, fraction float64) {
+	var lumas []int
+	for i := 0; i < len(img.Pix); i += 4 {
+		lumas = append(lumas, int(color.GrayModel.Convert(color.RGBA{R: img.Pix[i], G: img.Pix[i+1], B: img.Pix[i+2], A: 255}).(color.Gray).Y))
+	}
+	if len(lumas) == 0 {
+		return
+	}
+	sort.Ints(lumas)
+	black := lumas[int(float64(len(lumas)-1)*fraction)]
+	if black >= 254 {
+		return
+	}
+	stretch := blackPointTable(uint8(black))
+	for i := 0; i < len(img.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			img.Pix[i+c] = stretch[img.Pix[i+c]]
+		}
+	}
+}
+
+// unsharpMask sharpens the image in place by adding amount times the
+// difference between the image and a blurred copy of it
+func unsharpMask(img *image.RGBA, radius int, amount float64) {
+	blurred := image.NewRGBA(img.Bounds())
+	copy(blurred.Pix, img.Pix)
+	blurRegion(blurred, blurred.Bounds(), radius)
+	for i := 0; i < len(img.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			v := float64(img.Pix[i+c]) + amount*(float64(img.Pix[i+c])-float64(blurred.Pix[i+c]))
+			img.Pix[i+c] = uint8(min(max(v, 0), 255) + 0.5)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// generateUnevenWhiteboard draws a black and a red stroke on paper lit
+// unevenly from left (dim) to right (bright)
+func generateUnevenWhiteboard(outputPath string) error {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			light := 0.6 + 0.35*float64(x)/199
+			c := color.RGBA{R: 250, G: 245, B: 235, A: 255}
+			switch {
+			case y >= 30 && y < 34:
+				c = color.RGBA{R: 20, G: 20, B: 20, A: 255}
+			case y >= 60 && y < 64:
+				c = color.RGBA{R: 200, G: 60, B: 60, A: 255}
+			}
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(float64(c.R) * light),
+				G: uint8(float64(c.G) * light),
+				B: uint8(float64(c.B) * light),
+				A: 255,
+			})
+		}
+	}
+	return saveJPEG(outputPath, img)
+}
+
+func TestDocCleanImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_docclean.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_docclean.jpg")
+	if err := generateUnevenWhiteboard(testInputPath); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	if err := DocCleanImage(testInputPath, testOutputPath, DocCleanWhiteboard); err != nil {
+		t.Fatalf("Failed to clean document: %v", err)
+	}
+
+	img, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load output image: %v", err)
+	}
+	rgba := toRGBA(img)
+
+	// The paper is white on both the dim and the bright side
+	for _, x := range []int{10, 190} {
+		if c := rgba.RGBAAt(x, 10); c.R < 240 || c.G < 240 || c.B < 240 {
+			t.Errorf("Expected white paper at x=%d, got %v", x, c)
+		}
+	}
+	if c := rgba.RGBAAt(100, 32); c.R > 60 || c.G > 60 || c.B > 60 {
+		t.Errorf("Expected the black stroke to stay black, got %v", c)
+	}
+	if c := rgba.RGBAAt(100, 62); int(c.R)-int(c.G) < 140 {
+		t.Errorf("Expected a vivid red stroke, got %v", c)
+	}
+
+	if err := DocCleanImage(testInputPath, testOutputPath, "receipt"); err == nil {
+		t.Errorf("Expected an error for an unknown preset")
+	}
+}
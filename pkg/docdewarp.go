@@ -0,0 +1,509 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// docDetectSize is the longest side the image is reduced to for finding the
+// page, which is plenty for its outline and keeps the search fast
+const docDetectSize = 512
+
+// docMinArea is the smallest fraction of the image a detected page may cover
+const docMinArea = 0.2
+
+// docMaxHull is the most hull points searched for the largest quadrilateral
+const docMaxHull = 200
+
+// errNoDocument is returned when no page stands out from the background
+var errNoDocument = errors.New("no document found")
+
+// Quad is a quadrilateral given by its corners clockwise from the top left:
+// top left, top right, bottom right and bottom left, from the top left corner
+// of the image
+type Quad [4]image.Point
+
+// ParseQuad parses the corners of a quadrilateral written as
+// "x1,y1,x2,y2,x3,y3,x4,y4", clockwise from the top left
+func ParseQuad(s string) (Quad, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 8 {
+		return Quad{}, fmt.Errorf("invalid corners %q: expected x1,y1,x2,y2,x3,y3,x4,y4", s)
+	}
+	var q Quad
+	for i := range q {
+		x, errX := strconv.Atoi(strings.TrimSpace(fields[2*i]))
+		y, errY := strconv.Atoi(strings.TrimSpace(fields[2*i+1]))
+		if errX != nil || errY != nil {
+			return Quad{}, fmt.Errorf("invalid corners %q", s)
+		}
+		q[i] = image.Pt(x, y)
+	}
+	return q, nil
+}
+
+// String returns the corners in the notation ParseQuad accepts
+func (q Quad) String() string {
+	parts := make([]string, 0, 8)
+	for _, p := range q {
+		parts = append(parts, strconv.Itoa(p.X), strconv.Itoa(p.Y))
+	}
+	return strings.Join(parts, ",")
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (q Quad) MarshalText() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (q *Quad) UnmarshalText(text []byte) error {
+	parsed, err := ParseQuad(string(text))
+	if err != nil {
+		return err
+	}
+	*q = parsed
+	return nil
+}
+
+// convex reports whether the corners make a convex quadrilateral turning
+// clockwise, without three of them on a line
+func (q Quad) convex() bool {
+	for i := range q {
+		a, b, c := q[i], q[(i+1)%4], q[(i+2)%4]
+		if (b.X-a.X)*(c.Y-b.Y)-(b.Y-a.Y)*(c.X-b.X) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// DocDewarpOptions controls DocDewarp
+type DocDewarpOptions struct {
+	// Corners are the corners of the page; nil finds them with
+	// DetectDocument
+	Corners *Quad
+}
+
+// DocDewarpResult describes the page DocDewarp straightened
+type DocDewarpResult struct {
+	// Corners are the corners of the page in the input
+	Corners Quad `json:"corners"`
+	// Detected reports whether the corners were found by DetectDocument
+	Detected bool `json:"detected"`
+	// Width and Height are the size of the straightened page
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// DocDewarpImage finds the page in a photo of a document and straightens it,
+// as DocDewarp.
+// It takes the paths of the input and output files and the options.
+// Returns the corners of the page and the size of the output, or an error if
+// no page is found or the operation fails.
+func DocDewarpImage(inputPath string, outputPath string, opts DocDewarpOptions) (*DocDewarpResult, error) {
+	slog.Info("dewarping document",
+		"input", inputPath,
+		"output", outputPath,
+		"corners", opts.Corners != nil)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	page, result, err := DocDewarp(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveJPEG(outputPath, page); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DocDewarpImageReader straightens the page in the image read from r and
+// writes it to w as JPEG, like DocDewarpImage.
+// Returns the corners of the page and the size of the output, or an error if
+// no page is found or the operation fails.
+func DocDewarpImageReader(r io.Reader, w io.Writer, opts DocDewarpOptions) (*DocDewarpResult, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	page, result, err := DocDewarp(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := encodeJPEG(w, page); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DocDewarp crops a photographed page out of its background and undoes the
+// keystone of the camera in one go: the corners of the page are found with
+// DetectDocument, unless opts gives them, and PerspectiveCorrect maps them to
+// the corners of an upright rectangle.
+// Returns the straightened page and its corners, or an error if no page is
+// found or the corners are degenerate.
+func DocDewarp(img image.Image, opts DocDewarpOptions) (image.Image, *DocDewarpResult, error) {
+	result := &DocDewarpResult{}
+	if opts.Corners != nil {
+		result.Corners = *opts.Corners
+	} else {
+		corners, err := DetectDocument(img)
+		if err != nil {
+			return nil, nil, err
+		}
+		result.Corners, result.Detected = corners, true
+	}
+	page, err := PerspectiveCorrect(img, result.Corners)
+	if err != nil {
+		return nil, nil, err
+	}
+	result.Width, result.Height = page.Bounds().Dx(), page.Bounds().Dy()
+	return page, result, nil
+}
+
+// DetectDocument finds the corners of a page photographed against a darker
+// background. The image is reduced and split into light and dark with Otsu's
+// threshold; the largest light region, with the text and holes inside it
+// filled, is the page. The corners are those of the largest quadrilateral
+// inscribed in the convex hull of its outline, which ignores the rounded or
+// dog-eared corners and the fingers holding the page that a plain bounding
+// box would follow.
+// Returns the corners clockwise from the top left, or an error if no region
+// covers a fifth of the image.
+func DetectDocument(img image.Image) (Quad, error) {
+	bounds := img.Bounds()
+	scale := min(1, float64(docDetectSize)/float64(max(bounds.Dx(), bounds.Dy())))
+	small := image.NewGray(image.Rect(0, 0, max(int(float64(bounds.Dx())*scale), 1), max(int(float64(bounds.Dy())*scale), 1)))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, bounds, draw.Src, nil)
+	w, h := small.Bounds().Dx(), small.Bounds().Dy()
+
+	histogram := make([]int, 256)
+	for _, v := range small.Pix {
+		histogram[v]++
+	}
+	threshold := otsuThreshold(histogram, w*h)
+	page := largestRegion(small.Pix, w, h, func(v uint8) bool { return v > threshold })
+	fillHoles(page, w, h)
+
+	var outline [][2]float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !page[y*w+x] {
+				continue
+			}
+			if x == 0 || y == 0 || x == w-1 || y == h-1 || !page[y*w+x-1] || !page[y*w+x+1] || !page[(y-1)*w+x] || !page[(y+1)*w+x] {
+				// The outer corners of the pixel, so the hull covers it
+				outline = append(outline, [2]float64{float64(x), float64(y)}, [2]float64{float64(x + 1), float64(y + 1)},
+					[2]float64{float64(x + 1), float64(y)}, [2]float64{float64(x), float64(y + 1)})
+			}
+		}
+	}
+	hull := convexHull(outline)
+	if len(hull) > docMaxHull {
+		sampled := make([][2]float64, docMaxHull)
+		for i := range sampled {
+			sampled[i] = hull[i*len(hull)/docMaxHull]
+		}
+		hull = sampled
+	}
+	quad, area := largestQuad(hull)
+	if area < docMinArea*float64(w*h) {
+		return Quad{}, &ErrProcessing{Op: "docdewarp", Err: errNoDocument}
+	}
+
+	// Back to the full image, clockwise from the corner nearest the top left
+	var corners Quad
+	start := 0
+	for i, p := range quad {
+		if p[0]+p[1] < quad[start][0]+quad[start][1] {
+			start = i
+		}
+	}
+	for i := range corners {
+		p := quad[(start+i)%4]
+		corners[i] = image.Pt(int(math.Round(p[0]/scale)), int(math.Round(p[1]/scale)))
+	}
+	return corners, nil
+}
+
+// largestRegion returns the largest 4-connected region of the pixels for
+// which in is true
+func largestRegion(pix []uint8, w, h int, in func(v uint8) bool) []bool {
+	labels := make([]int32, w*h)
+	best, bestSize := int32(0), 0
+	next := int32(0)
+	var stack []int
+	for start := range pix {
+		if labels[start] != 0 || !in(pix[start]) {
+			continue
+		}
+		next++
+		labels[start] = next
+		stack = append(stack[:0], start)
+		size := 0
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			size++
+			x, y := i%w, i/w
+			for _, n := range [4]int{indexIf(x > 0, i-1), indexIf(x < w-1, i+1), indexIf(y > 0, i-w), indexIf(y < h-1, i+w)} {
+				if n >= 0 && labels[n] == 0 && in(pix[n]) {
+					labels[n] = next
+					stack = append(stack, n)
+				}
+			}
+		}
+		if size > bestSize {
+			best, bestSize = next, size
+		}
+	}
+	region := make([]bool, w*h)
+	for i, label := range labels {
+		region[i] = best != 0 && label == best
+	}
+	return region
+}
+
+// fillHoles adds to region the pixels it encloses: those that cannot be
+// reached from the edge of the image without crossing it
+func fillHoles(region []bool, w, h int) {
+	outside := make([]bool, w*h)
+	var stack []int
+	push := func(i int) {
+		if i >= 0 && !region[i] && !outside[i] {
+			outside[i] = true
+			stack = append(stack, i)
+		}
+	}
+	for x := 0; x < w; x++ {
+		push(x)
+		push((h-1)*w + x)
+	}
+	for y := 0; y < h; y++ {
+		push(y * w)
+		push(y*w + w - 1)
+	}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		x, y := i%w, i/w
+		push(indexIf(x > 0, i-1))
+		push(indexIf(x < w-1, i+1))
+		push(indexIf(y > 0, i-w))
+		push(indexIf(y < h-1, i+w))
+	}
+	for i := range region {
+		if !outside[i] {
+			region[i] = true
+		}
+	}
+}
+
+// convexHull returns the convex hull of the points with Andrew's monotone
+// chain, without collinear points, in order
+func convexHull(points [][2]float64) [][2]float64 {
+	if len(points) < 3 {
+		return points
+	}
+	points = append([][2]float64(nil), points...)
+	sort.Slice(points, func(i, j int) bool {
+		if points[i][0] != points[j][0] {
+			return points[i][0] < points[j][0]
+		}
+		return points[i][1] < points[j][1]
+	})
+	cross := func(o, a, b [2]float64) float64 {
+		return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+	}
+	hull := make([][2]float64, 0, 2*len(points))
+	for _, p := range points {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(points) - 2; i >= 0; i-- {
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], points[i]) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, points[i])
+	}
+	return hull[:len(hull)-1]
+}
+
+// largestQuad returns the quadrilateral of largest area with its corners
+// among the points of a convex polygon, in the order of the polygon, and its
+// area. For every diagonal the best corner on either side is found apart.
+func largestQuad(hull [][2]float64) ([4][2]float64, float64) {
+	n := len(hull)
+	var best [4][2]float64
+	bestArea := 0.0
+	if n < 4 {
+		return best, 0
+	}
+	triangle := func(a, b, c [2]float64) float64 {
+		return math.Abs((b[0]-a[0])*(c[1]-a[1])-(b[1]-a[1])*(c[0]-a[0])) / 2
+	}
+	for i := 0; i < n; i++ {
+		for k := i + 2; k < n; k++ {
+			left, right := 0.0, 0.0
+			j, l := -1, -1
+			for m := i + 1; m < k; m++ {
+				if a := triangle(hull[i], hull[m], hull[k]); a > left {
+					left, j = a, m
+				}
+			}
+			for m := k + 1; m < n+i; m++ {
+				if a := triangle(hull[i], hull[k], hull[m%n]); a > right {
+					right, l = a, m%n
+				}
+			}
+			if j >= 0 && l >= 0 && left+right > bestArea {
+				bestArea = left + right
+				best = [4][2]float64{hull[i], hull[j], hull[k], hull[l]}
+			}
+		}
+	}
+	return best, bestArea
+}
+
+// PerspectiveCorrect maps the quadrilateral of the image with the given
+// corners onto an upright rectangle, undoing the keystone of a photo taken
+// at an angle. The rectangle is as wide as the longer of the top and bottom
+// edges and as high as the longer of the left and right ones; pixels are
+// interpolated bilinearly, and those the corners reach outside the image are
+// white. Grays stay gray.
+// Returns the rectangle, or an error if the corners do not make a convex
+// quadrilateral in clockwise order.
+func PerspectiveCorrect(img image.Image, corners Quad) (image.Image, error) {
+	if !corners.convex() {
+		return nil, &ErrProcessing{Op: "perspective", Err: fmt.Errorf("corners %v do not make a convex quadrilateral clockwise from the top left", corners)}
+	}
+	length := func(a, b image.Point) float64 {
+		return math.Hypot(float64(b.X-a.X), float64(b.Y-a.Y))
+	}
+	w := int(math.Round(max(length(corners[0], corners[1]), length(corners[3], corners[2]))))
+	h := int(math.Round(max(length(corners[0], corners[3]), length(corners[1], corners[2]))))
+	var src [4][2]float64
+	for i, c := range corners {
+		src[i] = [2]float64{float64(c.X), float64(c.Y)}
+	}
+	m, err := homography([4][2]float64{{0, 0}, {float64(w), 0}, {float64(w), float64(h)}, {0, float64(h)}}, src)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "perspective", Err: fmt.Errorf("corners %v: %w", corners, err)}
+	}
+
+	rgba := toRGBA(img)
+	sw, sh := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Pixel centers map to pixel centers
+			fx, fy := float64(x)+0.5, float64(y)+0.5
+			d := m[6]*fx + m[7]*fy + 1
+			u := (m[0]*fx+m[1]*fy+m[2])/d - 0.5
+			v := (m[3]*fx+m[4]*fy+m[5])/d - 0.5
+			if u < -0.5 || v < -0.5 || u > float64(sw)-0.5 || v > float64(sh)-0.5 {
+				out.SetRGBA(x, y, white)
+				continue
+			}
+			out.SetRGBA(x, y, bilinearRGBA(rgba, u, v))
+		}
+	}
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		return toGray(out), nil
+	}
+	return out, nil
+}
+
+// bilinearRGBA interpolates rgba at (u, v), clamping to its edges
+func bilinearRGBA(rgba *image.RGBA, u, v float64) color.RGBA {
+	w, h := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	x0, y0 := int(math.Floor(u)), int(math.Floor(v))
+	fx, fy := u-float64(x0), v-float64(y0)
+	x1, y1 := min(max(x0+1, 0), w-1), min(max(y0+1, 0), h-1)
+	x0, y0 = min(max(x0, 0), w-1), min(max(y0, 0), h-1)
+	a, b := rgba.PixOffset(x0, y0), rgba.PixOffset(x1, y0)
+	c, d := rgba.PixOffset(x0, y1), rgba.PixOffset(x1, y1)
+	var px [4]uint8
+	for i := range px {
+		top := float64(rgba.Pix[a+i])*(1-fx) + float64(rgba.Pix[b+i])*fx
+		bottom := float64(rgba.Pix[c+i])*(1-fx) + float64(rgba.Pix[d+i])*fx
+		px[i] = uint8(math.Round(top*(1-fy) + bottom*fy))
+	}
+	return color.RGBA{px[0], px[1], px[2], px[3]}
+}
+
+// homography returns the projective map taking the four points from to the
+// four points to, as the first eight entries of its 3x3 matrix with the
+// last one 1
+func homography(from, to [4][2]float64) ([8]float64, error) {
+	// Two equations per pair of points
+	a := make([][]float64, 8)
+	b := make([]float64, 8)
+	for i := 0; i < 4; i++ {
+		x, y := from[i][0], from[i][1]
+		u, v := to[i][0], to[i][1]
+		a[2*i], b[2*i] = []float64{x, y, 1, 0, 0, 0, -x * u, -y * u}, u
+		a[2*i+1], b[2*i+1] = []float64{0, 0, 0, x, y, 1, -x * v, -y * v}, v
+	}
+	solution, err := solveLinear(a, b)
+	if err != nil {
+		return [8]float64{}, errors.New("the points are degenerate")
+	}
+	var m [8]float64
+	copy(m[:], solution)
+	return m, nil
+}
+
+// solveLinear solves the square system a x = b by Gaussian elimination with
+// partial pivoting, overwriting a and b.
+// Returns an error if the system is singular.
+func solveLinear(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-9 {
+			return nil, errors.New("singular system")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for row := 0; row < n; row++ {
+			if row == col {
+				continue
+			}
+			f := a[row][col] / a[col][col]
+			for k := col; k < n; k++ {
+				a[row][k] -= f * a[col][k]
+			}
+			b[row] -= f * b[col]
+		}
+	}
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = b[i] / a[i][i]
+	}
+	return x, nil
+}
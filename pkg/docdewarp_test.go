@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// photographedPage returns a photo of a 200x280 page of text bars taken at
+// an angle, on a dark grainy desk, and the function drawing the page
+func photographedPage(t *testing.T, corners Quad) (*image.RGBA, func(u, v float64) bool) {
+	t.Helper()
+	ink := func(u, v float64) bool {
+		return u >= 20 && u < 180 && v >= 20 && v < 260 && int(v)%20 < 8 && int(u)%30 < 24
+	}
+	var quad [4][2]float64
+	for i, c := range corners {
+		quad[i] = [2]float64{float64(c.X), float64(c.Y)}
+	}
+	m, err := homography(quad, [4][2]float64{{0, 0}, {200, 0}, {200, 280}, {0, 280}})
+	if err != nil {
+		t.Fatalf("homography failed: %v", err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			fx, fy := float64(x)+0.5, float64(y)+0.5
+			d := m[6]*fx + m[7]*fy + 1
+			u, v := (m[0]*fx+m[1]*fy+m[2])/d, (m[3]*fx+m[4]*fy+m[5])/d
+			desk := uint8(50 + rng.Intn(20))
+			c := color.RGBA{desk, desk, desk + 10, 0xff}
+			if u >= 0 && v >= 0 && u < 200 && v < 280 {
+				c = color.RGBA{240, 235, 225, 0xff}
+				if ink(u, v) {
+					c = color.RGBA{30, 30, 30, 0xff}
+				}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img, ink
+}
+
+func TestDocDewarp(t *testing.T) {
+	corners := Quad{{90, 20}, {300, 40}, {330, 285}, {60, 270}}
+	photo, ink := photographedPage(t, corners)
+
+	detected, err := DetectDocument(photo)
+	if err != nil {
+		t.Fatalf("DetectDocument failed: %v", err)
+	}
+	for i := range corners {
+		if d := detected[i].Sub(corners[i]); d.X < -3 || d.X > 3 || d.Y < -3 || d.Y > 3 {
+			t.Errorf("Expected corner %d near %v, got %v", i, corners[i], detected[i])
+		}
+	}
+
+	page, result, err := DocDewarp(photo, DocDewarpOptions{})
+	if err != nil {
+		t.Fatalf("DocDewarp failed: %v", err)
+	}
+	if !result.Detected || result.Width != page.Bounds().Dx() || result.Height != page.Bounds().Dy() {
+		t.Errorf("Unexpected result %+v for a %v page", result, page.Bounds())
+	}
+	// The rectangle is the page scaled, so the bars are back in rows
+	wrong, total := 0, 0
+	scaleX, scaleY := 200/float64(result.Width), 280/float64(result.Height)
+	for y := 0; y < result.Height; y++ {
+		for x := 0; x < result.Width; x++ {
+			u, v := (float64(x)+0.5)*scaleX, (float64(y)+0.5)*scaleY
+			// Pixels on the edges of the bars are mixed
+			if ink(u-2, v) != ink(u+2, v) || ink(u, v-2) != ink(u, v+2) {
+				continue
+			}
+			r, _, _, _ := page.At(x, y).RGBA()
+			if (r>>8 < 128) != ink(u, v) {
+				wrong++
+			}
+			total++
+		}
+	}
+	if wrong > total/50 {
+		t.Errorf("Expected the page to be straightened, %d of %d pixels differ", wrong, total)
+	}
+
+	// Given corners are used as they are
+	given := Quad{{0, 0}, {100, 0}, {100, 50}, {0, 50}}
+	crop, result, err := DocDewarp(photo, DocDewarpOptions{Corners: &given})
+	if err != nil || result.Detected || crop.Bounds() != image.Rect(0, 0, 100, 50) {
+		t.Errorf("Expected a 100x50 crop of the given corners, got %v, %+v, %v", crop.Bounds(), result, err)
+	}
+
+	desk := image.NewGray(image.Rect(0, 0, 100, 100))
+	if _, err := DetectDocument(desk); err == nil {
+		t.Error("Expected an error without a page")
+	}
+	for _, q := range []Quad{{{0, 0}, {50, 50}, {100, 100}, {0, 100}}, {{0, 0}, {0, 100}, {100, 100}, {100, 0}}} {
+		if _, err := PerspectiveCorrect(photo, q); err == nil {
+			t.Errorf("Expected an error for the corners %v", q)
+		}
+	}
+
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	input := writeTestImage(t, testDir, "test_input.png", photo, encodePNGBuffer)
+	output := filepath.Join(testDir, "test_output.jpg")
+	result, err = DocDewarpImage(input, output, DocDewarpOptions{})
+	if err != nil {
+		t.Fatalf("DocDewarpImage failed: %v", err)
+	}
+	if got := decodeTestFile(t, output).Bounds(); got != image.Rect(0, 0, result.Width, result.Height) {
+		t.Errorf("Expected a %dx%d output, got %v", result.Width, result.Height, got)
+	}
+}
+
+func TestParseQuad(t *testing.T) {
+	q, err := ParseQuad("1,2, 3,4,5,6,7,8")
+	if err != nil || q != (Quad{{1, 2}, {3, 4}, {5, 6}, {7, 8}}) {
+		t.Errorf("Unexpected %v, %v", q, err)
+	}
+	if text, _ := q.MarshalText(); string(text) != "1,2,3,4,5,6,7,8" {
+		t.Errorf("Unexpected text %q", text)
+	}
+	for _, s := range []string{"", "1,2,3,4", "1,2,3,4,5,6,7,x"} {
+		if _, err := ParseQuad(s); err == nil {
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultDPI is assumed for physical sizes when neither the caller nor the
+// source file specifies a resolution
+const defaultDPI = 72
+
+// Length units accepted by ParseLength
+const (
+	UnitPixel      = "px"
+	UnitMillimeter = "mm"
+	UnitCentimeter = "cm"
+	UnitInch       = "in"
+)
+
+// Length is an image dimension in pixels or in a physical unit
+type Length struct {
+	Value float64
+	Unit  string
+}
+
+// ParseLength parses a dimension such as "800", "800px", "210mm", "21cm" or "8.5in".
+// A number without a unit is taken as pixels.
+func ParseLength(s string) (Length, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	unit := UnitPixel
+	for _, u := range []string{UnitPixel, UnitMillimeter, UnitCentimeter, UnitInch} {
+		if strings.HasSuffix(s, u) {
+			unit = u
+			s = strings.TrimSuffix(s, u)
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || value <= 0 {
+		return Length{}, fmt.Errorf("invalid length %q", s+unit)
+	}
+	return Length{Value: value, Unit: unit}, nil
+}
+
+// IsPhysical reports whether the length is in a physical unit and needs a DPI to convert
+func (l Length) IsPhysical() bool {
+	return l.Unit == UnitMillimeter || l.Unit == UnitCentimeter || l.Unit == UnitInch
+}
+
+// Pixels converts the length to pixels at the given resolution
+func (l Length) Pixels(dpi float64) uint {
+	inches := l.Value
+	switch l.Unit {
+	case UnitMillimeter:
+		inches = l.Value / 25.4
+	case UnitCentimeter:
+		inches = l.Value / 2.54
+	case UnitInch:
+	default:
+		return uint(l.Value + 0.5)
+	}
+	return uint(inches*dpi + 0.5)
+}
+
+// String returns the length as ParseLength accepts it, without a unit for pixels
+func (l Length) String() string {
+	s := strconv.FormatFloat(l.Value, 'f', -1, 64)
+	if l.Unit != UnitPixel {
+		s += l.Unit
+	}
+	return s
+}
+
+// readDPI returns the horizontal resolution recorded in a JPEG (JFIF or EXIF)
+// or PNG (pHYs) file, or zero when the file does not record one
+func readDPI(path string) float64 {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	return decodeDPI(file)
+}
+
+// decodeDPI returns the horizontal resolution recorded in an encoded JPEG or
+// PNG image, or zero when it does not record one
+func decodeDPI(rs io.ReadSeeker) float64 {
+	r := bufio.NewReader(rs)
+	magic, err := r.Peek(8)
+	if err != nil {
+		return 0
+	}
+	if bytes.Equal(magic, []byte("\x89PNG\r\n\x1a\n")) {
+		return readPNGDPI(r)
+	}
+	if dpi := readJFIFDPI(r); dpi > 0 {
+		return dpi
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return 0
+	}
+	if info, err := decodeExif(rs); err == nil {
+		return info.DPI
+	}
+	return 0
+}
+
+// readJFIFDPI returns the density of the JFIF APP0 segment of a JPEG stream
+func readJFIFDPI(r *bufio.Reader) float64 {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || header != [2]byte{0xff, 0xd8} {
+		return 0
+	}
+	var marker [4]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil || marker[0] != 0xff || marker[1] != 0xe0 {
+		return 0
+	}
+	length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+	if length < 12 {
+		return 0
+	}
+	segment := make([]byte, length)
+	if _, err := io.ReadFull(r, segment); err != nil || string(segment[:5]) != "JFIF\x00" {
+		return 0
+	}
+	density := float64(binary.BigEndian.Uint16(segment[8:10]))
+	switch segment[7] {
+	case 1:
+		return density
+	case 2:
+		return density * 2.54
+	}
+	// Unit 0 only records the aspect ratio
+	return 0
+}
+
+// readPNGDPI returns the resolution of the pHYs chunk of a PNG stream
+func readPNGDPI(r *bufio.Reader) float64 {
+	if _, err := r.Discard(8); err != nil {
+		return 0
+	}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return 0
+		}
+		length := int(binary.BigEndian.Uint32(header[:4]))
+		switch string(header[4:8]) {
+		case "pHYs":
+			var data [9]byte
+			if length != 9 {
+				return 0
+			}
+			if _, err := io.ReadFull(r, data[:]); err != nil {
+				return 0
+			}
+			// Unit 1 is pixels per meter
+			if data[8] != 1 {
+				return 0
+			}
+			return float64(binary.BigEndian.Uint32(data[:4])) * 0.0254
+		case "IDAT", "IEND":
+			// pHYs must come before the image data
+			return 0
+		}
+		if _, err := r.Discard(length + 4); err != nil {
+			return 0
+		}
+	}
+}
+
+// saveJPEGWithDPI saves the image as JPEG with the given quality and records
+// the resolution in a JFIF APP0 segment. A non-positive dpi saves without
+// resolution metadata.
+func (p *Processor) saveJPEGWithDPI(outputPath string, img image.Image, dpi float64, quality int) error {
+	if dpi <= 0 {
+		return p.saveJPEGQuality(outputPath, img, quality)
+	}
+
+	out, err := p.createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := encodeJPEGWithDPI(out, img, dpi, quality); err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+// encodeJPEGWithDPI writes the image to w as JPEG like saveJPEGWithDPI
+func encodeJPEGWithDPI(w io.Writer, img image.Image, dpi float64, quality int) error {
+	if dpi <= 0 {
+		return encodeJPEGQuality(w, img, quality)
+	}
+
+	density := uint16(min(dpi+0.5, 65535))
+	app0 := []byte{
+		0xff, 0xe0, 0x00, 0x10,
+		'J', 'F', 'I', 'F', 0x00,
+		0x01, 0x02, // version 1.2
+		0x01, // density in dots per inch
+		byte(density >> 8), byte(density),
+		byte(density >> 8), byte(density),
+		0x00, 0x00, // no thumbnail
+	}
+
+	slog.Info("recording resolution", "dpi", float64(density))
+	return encodeJPEGQuality(&densityWriter{w: w, app0: app0}, img, quality)
+}
+
+// densityWriter passes a JPEG through to w, inserting app0 after the start
+// of image marker, its first two bytes, so the encoded image is never held
+// whole
+type densityWriter struct {
+	w    io.Writer
+	app0 []byte
+	// n counts the bytes of the marker passed through
+	n int
+}
+
+func (d *densityWriter) Write(p []byte) (int, error) {
+	written := 0
+	if d.app0 != nil {
+		k := min(2-d.n, len(p))
+		if _, err := d.w.Write(p[:k]); err != nil {
+			return 0, err
+		}
+		d.n += k
+		written, p = k, p[k:]
+		if d.n < 2 {
+			return written, nil
+		}
+		if _, err := d.w.Write(d.app0); err != nil {
+			return written, err
+		}
+		d.app0 = nil
+	}
+	n, err := d.w.Write(p)
+	return written + n, err
+}
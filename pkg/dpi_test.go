@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLength(t *testing.T) {
+	tests := []struct {
+		input  string
+		length Length
+		pixels uint
+	}{
+		{"800", Length{800, UnitPixel}, 800},
+		{"800px", Length{800, UnitPixel}, 800},
+		{"210mm", Length{210, UnitMillimeter}, 2480},
+		{"2.54cm", Length{2.54, UnitCentimeter}, 300},
+		{"8.5in", Length{8.5, UnitInch}, 2550},
+	}
+	for _, tt := range tests {
+		length, err := ParseLength(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.input, err)
+		}
+		if length != tt.length {
+			t.Errorf("ParseLength(%q) = %+v, want %+v", tt.input, length, tt.length)
+		}
+		if px := length.Pixels(300); px != tt.pixels {
+			t.Errorf("%q at 300 DPI = %d pixels, want %d", tt.input, px, tt.pixels)
+		}
+	}
+	for _, input := range []string{"", "mm", "-5in", "10ft"} {
+		if _, err := ParseLength(input); err == nil {
+			t.Errorf("ParseLength(%q) should fail", input)
+		}
+	}
+}
+
+func TestResizeImageWithDPI(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_dpi.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_dpi.jpg")
+	if err := generateSingleTestImage(testInputPath, 100, 50); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	if dpi := readDPI(testInputPath); dpi != 0 {
+		t.Errorf("Expected no recorded resolution, got %v", dpi)
+	}
+
+	// 1 inch at 150 DPI
+	result, err := ResizeImageWithOptions(testInputPath, testOutputPath, ResizeOptions{
+		PrintWidth: Length{Value: 25.4, Unit: UnitMillimeter},
+		DPI:        150,
+	})
+	if err != nil {
+		t.Fatalf("Failed to resize image: %v", err)
+	}
+	if result.Width != 150 || result.Height != 75 {
+		t.Errorf("Expected 150x75, got %dx%d", result.Width, result.Height)
+	}
+	if dpi := readDPI(testOutputPath); dpi != 150 {
+		t.Errorf("Expected 150 DPI in the output, got %v", dpi)
+	}
+	img, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load resized image: %v", err)
+	}
+	if img.Bounds().Dx() != 150 || img.Bounds().Dy() != 75 {
+		t.Errorf("Output is %v, expected 150x75", img.Bounds())
+	}
+
+	// The recorded resolution is used when none is given
+	secondOutputPath := filepath.Join(testDir, "test_output_dpi_2.jpg")
+	result, err = ResizeImageWithOptions(testOutputPath, secondOutputPath, ResizeOptions{
+		PrintWidth: Length{Value: 2, Unit: UnitInch},
+	})
+	if err != nil {
+		t.Fatalf("Failed to resize image: %v", err)
+	}
+	if result.Width != 300 || result.DPI != 150 {
+		t.Errorf("Expected 300 pixels wide at 150 DPI, got %+v", result)
+	}
+}
@@ -0,0 +1,296 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+)
+
+// defaultBodyFontSize is the size in points assumed for the body text of a
+// page, common to letters, reports and books
+const defaultBodyFontSize = 11
+
+// Proportions of body text to its size: the distance between baselines of
+// single-spaced text, and the height of the lowercase letters
+const (
+	bodyLineSpacing = 1.2
+	bodyXHeight     = 0.5
+)
+
+// minDPILines is the fewest text lines EstimateDPI measures a page from;
+// fewer do not tell text from a photo or a gradient
+const minDPILines = 3
+
+// standardDPIs are the resolutions scanners and cameras are set to, which
+// EstimateDPI snaps to
+var standardDPIs = []float64{72, 75, 96, 100, 120, 150, 200, 240, 300, 400, 600, 800, 1200}
+
+// DPIEstimateOptions controls EstimateDPI
+type DPIEstimateOptions struct {
+	// FontSize is the size in points assumed for the body text of the page;
+	// zero is 11
+	FontSize float64
+}
+
+// DPIEstimate is the resolution EstimateDPI read from the text of a page
+type DPIEstimate struct {
+	// DPI is the standard resolution nearest to Estimate, or Estimate
+	// rounded when none is within a tenth of it
+	DPI float64 `json:"dpi"`
+	// Estimate is the resolution the measurements give
+	Estimate float64 `json:"estimate"`
+	// LinePitch is the distance between the baselines of the lines in pixels
+	LinePitch float64 `json:"line_pitch"`
+	// XHeight is the median height of the lowercase letters in pixels
+	XHeight float64 `json:"x_height"`
+	// Lines is the number of text lines measured
+	Lines int `json:"lines"`
+	// Agreement is the ratio of the smaller to the larger of the resolutions
+	// given by the line pitch and by the x-height, 1 when they agree fully
+	Agreement float64 `json:"agreement"`
+	// Recorded is the resolution in the metadata of the input; zero when it
+	// records none
+	Recorded float64 `json:"recorded,omitempty"`
+}
+
+// EstimateDPIImage estimates the resolution of a scanned page from its text,
+// as EstimateDPI, and writes the page with the resolution recorded in its
+// metadata, so that later operations size it correctly in inches and
+// millimeters.
+// It takes the paths of the input and output files and the options.
+// Returns the estimate, or an error if the page has no text to measure or
+// the operation fails.
+func EstimateDPIImage(inputPath string, outputPath string, opts DPIEstimateOptions) (*DPIEstimate, error) {
+	return defaultProcessor.EstimateDPIImage(inputPath, outputPath, opts)
+}
+
+// EstimateDPIImage is the package function EstimateDPIImage with the configuration and logger of p
+func (p *Processor) EstimateDPIImage(inputPath string, outputPath string, opts DPIEstimateOptions) (*DPIEstimate, error) {
+	p.logger().Info("estimating resolution",
+		"input", inputPath,
+		"output", outputPath)
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	estimate, err := EstimateDPI(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	estimate.Recorded = readDPI(inputPath)
+	if err := p.saveJPEGWithDPI(outputPath, img, estimate.DPI, p.Config().JpegQuality); err != nil {
+		return nil, err
+	}
+	return estimate, nil
+}
+
+// EstimateDPIImageReader estimates the resolution of the page read from r and
+// writes it to w as JPEG with the resolution recorded, like EstimateDPIImage.
+// Returns the estimate, or an error if the page has no text to measure or
+// the operation fails.
+func EstimateDPIImageReader(r io.Reader, w io.Writer, opts DPIEstimateOptions) (*DPIEstimate, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "read", Err: err}
+	}
+	img, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	estimate, err := EstimateDPI(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	estimate.Recorded = decodeDPI(bytes.NewReader(data))
+	if err := encodeJPEGWithDPI(w, img, estimate.DPI, currentConfig().JpegQuality); err != nil {
+		return nil, err
+	}
+	return estimate, nil
+}
+
+// EstimateDPI estimates the resolution a page was scanned at from the size
+// of its text, for scans whose metadata is missing or wrong. The text is
+// separated from the paper with Otsu's threshold and projected onto the
+// vertical axis: the period of the projection is the distance between the
+// lines, and the dense core of every line is the height of its lowercase
+// letters. Body text of opts.FontSize points has its lines about 1.2 times
+// the size apart and lowercase letters about half the size high, which turns
+// both measurements into resolutions; their geometric mean is snapped to the
+// nearest standard resolution. The page should be upright and straight, as
+// AutoRotate leaves it, and mostly body text.
+// Returns the estimate, or an error if the font size is invalid or the page
+// has no text to measure.
+func EstimateDPI(img image.Image, opts DPIEstimateOptions) (*DPIEstimate, error) {
+	fontSize := opts.FontSize
+	if fontSize == 0 {
+		fontSize = defaultBodyFontSize
+	}
+	if fontSize < 0 {
+		return nil, &ErrProcessing{Op: "estimatedpi", Err: fmt.Errorf("font size must be positive, got %g", fontSize)}
+	}
+
+	profile := textProfile(toGray(img))
+	xHeights := lineXHeights(profile)
+	if len(xHeights) < minDPILines {
+		return nil, &ErrProcessing{Op: "estimatedpi", Err: fmt.Errorf("found %d text lines, at least %d are needed", len(xHeights), minDPILines)}
+	}
+	sort.Float64s(xHeights)
+	estimate := &DPIEstimate{
+		XHeight: xHeights[len(xHeights)/2],
+		Lines:   len(xHeights),
+	}
+	estimate.LinePitch = profilePeriod(profile, int(estimate.XHeight*1.5))
+	if estimate.LinePitch == 0 {
+		return nil, &ErrProcessing{Op: "estimatedpi", Err: fmt.Errorf("the text lines are not evenly spaced")}
+	}
+	xDPI := estimate.XHeight * 72 / (bodyXHeight * fontSize)
+	pitchDPI := estimate.LinePitch * 72 / (bodyLineSpacing * fontSize)
+	estimate.Estimate = math.Sqrt(xDPI * pitchDPI)
+	estimate.Agreement = min(xDPI, pitchDPI) / max(xDPI, pitchDPI)
+	estimate.DPI = snapDPI(estimate.Estimate)
+	return estimate, nil
+}
+
+// textProfile returns the number of text pixels in every row of the page,
+// text being what is darker than Otsu's threshold
+func textProfile(gray *image.Gray) []float64 {
+	bounds := gray.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	histogram := make([]int, 256)
+	for y := 0; y < h; y++ {
+		for _, v := range gray.Pix[y*gray.Stride : y*gray.Stride+w] {
+			histogram[v]++
+		}
+	}
+	threshold := otsuThreshold(histogram, w*h)
+	profile := make([]float64, h)
+	for y := 0; y < h; y++ {
+		for _, v := range gray.Pix[y*gray.Stride : y*gray.Stride+w] {
+			if v < threshold {
+				profile[y]++
+			}
+		}
+	}
+	// Ink covering most of a row is a rule, a border or the scanner bed,
+	// not text
+	for y, n := range profile {
+		if n > float64(w)*0.6 {
+			profile[y] = 0
+		}
+	}
+	return profile
+}
+
+// lineXHeights splits the profile into lines, runs of rows holding text, and
+// returns the height of the dense core of each: the longest run of rows at
+// half the peak of the line or more, which the ascenders and descenders
+// stay out of
+func lineXHeights(profile []float64) []float64 {
+	peak := 0.0
+	for _, n := range profile {
+		peak = max(peak, n)
+	}
+	floor := max(peak*0.02, 1)
+
+	var heights []float64
+	for start := 0; start < len(profile); {
+		if profile[start] < floor {
+			start++
+			continue
+		}
+		end := start
+		linePeak := 0.0
+		for end < len(profile) && profile[end] >= floor {
+			linePeak = max(linePeak, profile[end])
+			end++
+		}
+		core, run := 0, 0
+		for _, n := range profile[start:end] {
+			if n >= linePeak/2 {
+				run++
+				core = max(core, run)
+			} else {
+				run = 0
+			}
+		}
+		// Specks of dirt are not lines
+		if end-start >= 3 && core >= 2 {
+			heights = append(heights, float64(core))
+		}
+		start = end
+	}
+	return heights
+}
+
+// profilePeriod returns the period of the profile, found as the strongest
+// peak of its autocorrelation at a lag of minLag or more, refined between
+// rows; zero when it has none. The shortest lag nearly as strong as the
+// strongest is taken, since multiples of the period correlate as well.
+func profilePeriod(profile []float64, minLag int) float64 {
+	n := len(profile)
+	var mean float64
+	for _, v := range profile {
+		mean += v
+	}
+	mean /= float64(n)
+	centered := make([]float64, n)
+	var energy float64
+	for i, v := range profile {
+		centered[i] = v - mean
+		energy += centered[i] * centered[i]
+	}
+	maxLag := n / 2
+	minLag = max(minLag, 2)
+	if energy == 0 || maxLag <= minLag+1 {
+		return 0
+	}
+
+	ac := make([]float64, maxLag+1)
+	for lag := minLag - 1; lag <= maxLag; lag++ {
+		var sum float64
+		for i := 0; i+lag < n; i++ {
+			sum += centered[i] * centered[i+lag]
+		}
+		// Normalized by the overlap, so that long lags are not penalized
+		ac[lag] = sum / energy * float64(n) / float64(n-lag)
+	}
+	var peaks []int
+	best := 0.0
+	for lag := minLag; lag < maxLag; lag++ {
+		if ac[lag] > ac[lag-1] && ac[lag] >= ac[lag+1] && ac[lag] > 0.2 {
+			peaks = append(peaks, lag)
+			best = max(best, ac[lag])
+		}
+	}
+	for _, lag := range peaks {
+		if ac[lag] >= best*0.8 {
+			// The parabola through the peak and its neighbors
+			a, b, c := ac[lag-1], ac[lag], ac[lag+1]
+			offset := 0.0
+			if d := a - 2*b + c; d != 0 {
+				offset = (a - c) / (2 * d)
+			}
+			return float64(lag) + offset
+		}
+	}
+	return 0
+}
+
+// snapDPI returns the standard resolution nearest to dpi when it is within a
+// tenth of it, and dpi rounded otherwise
+func snapDPI(dpi float64) float64 {
+	nearest := standardDPIs[0]
+	for _, standard := range standardDPIs {
+		if math.Abs(standard-dpi) < math.Abs(nearest-dpi) {
+			nearest = standard
+		}
+	}
+	if math.Abs(nearest-dpi) <= nearest*0.1 {
+		return nearest
+	}
+	return math.Round(dpi)
+}
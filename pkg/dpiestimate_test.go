@@ -0,0 +1,100 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// textPage renders single-spaced lines of 11 point text as a page scanned at
+// dpi would show them
+func textPage(t *testing.T, dpi float64) *image.Gray {
+	t.Helper()
+	f, err := goRegular()
+	if err != nil {
+		t.Fatalf("Failed to load the font: %v", err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: 11, DPI: dpi, Hinting: font.HintingFull})
+	if err != nil {
+		t.Fatalf("Failed to create the face: %v", err)
+	}
+	defer face.Close()
+
+	px := 11 * dpi / 72
+	page := image.NewGray(image.Rect(0, 0, int(px*40), int(px*25)))
+	draw.Draw(page, page.Bounds(), image.White, image.Point{}, draw.Src)
+	d := font.Drawer{Dst: page, Src: image.Black, Face: face}
+	for line := 0; line < 18; line++ {
+		d.Dot = fixed.P(int(px*2), int(px*3+float64(line)*px*1.2))
+		d.DrawString("the quick brown fox jumps over the lazy dog, and then some more")
+	}
+	return page
+}
+
+func TestEstimateDPI(t *testing.T) {
+	for _, dpi := range []float64{150, 300} {
+		estimate, err := EstimateDPI(textPage(t, dpi), DPIEstimateOptions{})
+		if err != nil {
+			t.Fatalf("EstimateDPI failed at %g DPI: %v", dpi, err)
+		}
+		if estimate.DPI != dpi || estimate.Lines != 18 {
+			t.Errorf("Expected %g DPI from 18 lines, got %+v", dpi, estimate)
+		}
+		if pitch := 11 * dpi / 72 * 1.2; estimate.LinePitch < pitch-1 || estimate.LinePitch > pitch+1 {
+			t.Errorf("Expected a line pitch of %.1f, got %.1f", pitch, estimate.LinePitch)
+		}
+		if estimate.Agreement < 0.8 {
+			t.Errorf("Expected the measurements to agree, got %g", estimate.Agreement)
+		}
+	}
+
+	// A larger font size assumed gives a lower resolution
+	estimate, err := EstimateDPI(textPage(t, 300), DPIEstimateOptions{FontSize: 22})
+	if err != nil || estimate.DPI != 150 {
+		t.Errorf("Expected 150 DPI for text assumed twice as large, got %+v, %v", estimate, err)
+	}
+
+	blank := image.NewGray(image.Rect(0, 0, 200, 200))
+	draw.Draw(blank, blank.Bounds(), image.White, image.Point{}, draw.Src)
+	if _, err := EstimateDPI(blank, DPIEstimateOptions{}); err == nil {
+		t.Error("Expected an error for a blank page")
+	}
+	if _, err := EstimateDPI(textPage(t, 150), DPIEstimateOptions{FontSize: -1}); err == nil {
+		t.Error("Expected an error for a negative font size")
+	}
+
+	// The estimate is recorded in the output
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	input := writeTestImage(t, testDir, "test_input.png", textPage(t, 200), encodePNGBuffer)
+	output := filepath.Join(testDir, "test_output.jpg")
+	estimate, err = EstimateDPIImage(input, output, DPIEstimateOptions{})
+	if err != nil {
+		t.Fatalf("EstimateDPIImage failed: %v", err)
+	}
+	if got := readDPI(output); got != 200 || estimate.Recorded != 0 {
+		t.Errorf("Expected 200 DPI recorded and none in the input, got %g and %g", got, estimate.Recorded)
+	}
+
+	var buf bytes.Buffer
+	data, _ := os.ReadFile(output)
+	estimate, err = EstimateDPIImageReader(bytes.NewReader(data), &buf, DPIEstimateOptions{})
+	if err != nil || estimate.Recorded != 200 || decodeDPI(bytes.NewReader(buf.Bytes())) != 200 {
+		t.Errorf("Expected the recorded resolution to be read and written again, got %+v, %v", estimate, err)
+	}
+}
+
+func TestSnapDPI(t *testing.T) {
+	for dpi, want := range map[float64]float64{296: 300, 318: 300, 150.4: 150, 500: 500, 72.5: 72} {
+		if got := snapDPI(dpi); got != want {
+			t.Errorf("snapDPI(%g) = %g, want %g", dpi, got, want)
+		}
+	}
+}
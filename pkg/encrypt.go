@@ -0,0 +1,221 @@
+package processor
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// EncryptedExt is the extension given to encrypted outputs
+const EncryptedExt = ".enc"
+
+// encryptedMagic starts every encrypted file: a name and a format version.
+// It is authenticated along with the data.
+var encryptedMagic = []byte("GIPENC\x00\x01")
+
+// ErrDecrypt is returned when data cannot be decrypted: it is not an
+// encrypted file, it was encrypted with another key or it was altered
+var ErrDecrypt = errors.New("cannot decrypt: wrong key or corrupted data")
+
+// Encryption encrypts outputs at rest with AES-GCM, so images of sensitive
+// documents can be handed between processing stages without being readable
+// on the disks and shares in between. An encrypted file is the format
+// marker, a random 12-byte nonce and the sealed data; GCM authenticates it,
+// so a wrong key or an altered file fails to decrypt instead of giving
+// garbage.
+type Encryption struct {
+	aead cipher.AEAD
+}
+
+// NewEncryption returns the Encryption of an AES key of 16, 24 or 32 bytes,
+// for AES-128, AES-192 or AES-256
+func NewEncryption(key []byte) (*Encryption, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "encrypt", Err: err}
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "encrypt", Err: err}
+	}
+	return &Encryption{aead: aead}, nil
+}
+
+// LoadEncryption reads a key from source, as LoadEncryptionKey does, and
+// returns its Encryption
+func LoadEncryption(source string) (*Encryption, error) {
+	key, err := LoadEncryptionKey(source)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncryption(key)
+}
+
+// LoadEncryptionKey reads an AES key, so keys are never written on the command
+// line or in config.yaml. source is one of
+//
+//	env:NAME       the environment variable NAME
+//	file:PATH      the file PATH
+//	cmd:COMMAND    the output of COMMAND, run without a shell
+//
+// The key is given in hex or base64; a file or command may also give its raw
+// bytes. A command fetches the key from a key management service, for
+// instance by decrypting a data key with the CLI of the service.
+func LoadEncryptionKey(source string) ([]byte, error) {
+	kind, arg, _ := strings.Cut(source, ":")
+	var data []byte
+	raw := true
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(arg)
+		if !ok {
+			return nil, &ErrProcessing{Op: "encryption key", Err: fmt.Errorf("environment variable %s is not set", arg)}
+		}
+		data, raw = []byte(value), false
+	case "file":
+		var err error
+		if data, err = os.ReadFile(arg); err != nil {
+			return nil, &ErrInvalidInput{Path: arg, Err: err}
+		}
+	case "cmd":
+		args := strings.Fields(arg)
+		if len(args) == 0 {
+			return nil, &ErrProcessing{Op: "encryption key", Err: errors.New("no command given")}
+		}
+		var stderr bytes.Buffer
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = &stderr
+		var err error
+		if data, err = cmd.Output(); err != nil {
+			return nil, &ErrProcessing{Op: "encryption key", Err: fmt.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))}
+		}
+	default:
+		return nil, &ErrProcessing{Op: "encryption key", Err: fmt.Errorf("unknown key source %q, expected env:, file: or cmd:", source)}
+	}
+	key, err := decodeKey(data, raw)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "encryption key", Err: err}
+	}
+	return key, nil
+}
+
+// decodeKey decodes a key of 16, 24 or 32 bytes given in hex or base64, or as
+// it is when raw is set
+func decodeKey(data []byte, raw bool) ([]byte, error) {
+	validSize := func(key []byte) bool { return len(key) == 16 || len(key) == 24 || len(key) == 32 }
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && validSize(key) {
+		return key, nil
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if key, err := enc.DecodeString(text); err == nil && validSize(key) {
+			return key, nil
+		}
+	}
+	if raw && validSize(data) {
+		return data, nil
+	}
+	return nil, errors.New("the key must be 16, 24 or 32 bytes, in hex or base64")
+}
+
+// IsEncrypted reports whether data starts like a file written by Encryption
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// Encrypt seals data with a new random nonce
+func (e *Encryption) Encrypt(data []byte) ([]byte, error) {
+	out := make([]byte, len(encryptedMagic)+e.aead.NonceSize(), len(encryptedMagic)+e.aead.NonceSize()+len(data)+e.aead.Overhead())
+	copy(out, encryptedMagic)
+	nonce := out[len(encryptedMagic):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, &ErrProcessing{Op: "encrypt", Err: err}
+	}
+	return e.aead.Seal(out, nonce, data, encryptedMagic), nil
+}
+
+// Decrypt opens data sealed by Encrypt. Returns ErrDecrypt if data is not
+// encrypted, the key differs or the data was altered.
+func (e *Encryption) Decrypt(data []byte) ([]byte, error) {
+	header := len(encryptedMagic) + e.aead.NonceSize()
+	if !IsEncrypted(data) || len(data) < header+e.aead.Overhead() {
+		return nil, &ErrProcessing{Op: "decrypt", Err: ErrDecrypt}
+	}
+	plain, err := e.aead.Open(nil, data[len(encryptedMagic):header], data[header:], encryptedMagic)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "decrypt", Err: ErrDecrypt}
+	}
+	return plain, nil
+}
+
+// EncryptFile encrypts the file at inputPath into outputPath, which may be
+// the same file. The output appears complete or not at all.
+func (e *Encryption) EncryptFile(inputPath, outputPath string) error {
+	return e.convertFile(inputPath, outputPath, e.Encrypt)
+}
+
+// DecryptFile decrypts the file at inputPath, written by EncryptFile or an
+// encrypted batch run or server, into outputPath
+func (e *Encryption) DecryptFile(inputPath, outputPath string) error {
+	return e.convertFile(inputPath, outputPath, e.Decrypt)
+}
+
+// convertFile writes convert of the contents of inputPath to outputPath
+func (e *Encryption) convertFile(inputPath, outputPath string, convert func([]byte) ([]byte, error)) error {
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return &ErrInvalidInput{Path: inputPath, Err: err}
+	}
+	return e.writeFile(outputPath, data, convert)
+}
+
+// writeFile writes convert of data to outputPath
+func (e *Encryption) writeFile(outputPath string, data []byte, convert func([]byte) ([]byte, error)) error {
+	converted, err := convert(data)
+	if err != nil {
+		return err
+	}
+	out, err := createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := out.Write(converted); err != nil {
+		return &ErrProcessing{Op: "write", Err: err}
+	}
+	return out.Commit()
+}
+
+// Operation returns an operation that runs op and encrypts its output. The
+// output path is given with EncryptedExt, as in "scan.jpg.enc". op writes to
+// a hidden name with the extension before it, so it sees the extension of the
+// format it writes, but that output is kept in memory and sealed straight into
+// the encrypted file: the plain image is never written to disk.
+func (e *Encryption) Operation(op Operation) Operation {
+	return func(inputPath, outputPath string) error {
+		name := strings.TrimSuffix(filepath.Base(outputPath), EncryptedExt)
+		if name == filepath.Base(outputPath) {
+			return &ErrInvalidOutput{Path: outputPath, Err: fmt.Errorf("an encrypted output needs the extension %s", EncryptedExt)}
+		}
+		ext := filepath.Ext(name)
+		plainPath := filepath.Join(filepath.Dir(outputPath), hiddenName(strings.TrimSuffix(name, ext),
+			".plain-"+strconv.Itoa(os.Getpid())+"-"+strconv.FormatUint(tempSeq.Add(1), 10)+ext))
+		plain, err := captureOutput(plainPath, func() error {
+			return op(inputPath, plainPath)
+		})
+		if err != nil {
+			return err
+		}
+		return e.writeFile(outputPath, plain, e.Encrypt)
+	}
+}
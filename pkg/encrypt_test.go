@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	key := bytes.Repeat([]byte{0x42}, 32)
+	e, err := NewEncryption(key)
+	if err != nil {
+		t.Fatalf("NewEncryption failed: %v", err)
+	}
+	if _, err := NewEncryption(key[:20]); err == nil {
+		t.Error("Expected an error for a 20-byte key")
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		data := []byte("scanned contract")
+		sealed, err := e.Encrypt(data)
+		if err != nil {
+			t.Fatalf("Encrypt failed: %v", err)
+		}
+		if !IsEncrypted(sealed) || bytes.Contains(sealed, data) {
+			t.Error("Expected the marker and no plaintext in the sealed data")
+		}
+		again, _ := e.Encrypt(data)
+		if bytes.Equal(sealed, again) {
+			t.Error("Expected a new nonce for every encryption")
+		}
+		plain, err := e.Decrypt(sealed)
+		if err != nil || !bytes.Equal(plain, data) {
+			t.Fatalf("Expected %q back, got %q, %v", data, plain, err)
+		}
+
+		sealed[len(sealed)-1] ^= 1
+		if _, err := e.Decrypt(sealed); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("Expected ErrDecrypt for altered data, got %v", err)
+		}
+		other, _ := NewEncryption(bytes.Repeat([]byte{0x43}, 32))
+		if _, err := other.Decrypt(again); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("Expected ErrDecrypt for another key, got %v", err)
+		}
+		if _, err := e.Decrypt(data); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("Expected ErrDecrypt for unencrypted data, got %v", err)
+		}
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		t.Setenv("TEST_IMAGE_KEY", hex.EncodeToString(key))
+		got, err := LoadEncryptionKey("env:TEST_IMAGE_KEY")
+		if err != nil || !bytes.Equal(got, key) {
+			t.Errorf("Expected the hex key from the environment, got %x, %v", got, err)
+		}
+		keyFile := filepath.Join(testDir, "key")
+		if err := os.WriteFile(keyFile, key[:16], 0o600); err != nil {
+			t.Fatalf("Failed to write the key: %v", err)
+		}
+		if got, err := LoadEncryptionKey("file:" + keyFile); err != nil || !bytes.Equal(got, key[:16]) {
+			t.Errorf("Expected the raw key from the file, got %x, %v", got, err)
+		}
+		for _, source := range []string{"env:TEST_IMAGE_KEY_MISSING", "file:" + keyFile + ".missing", "cmd:", "plain", "env:HOME"} {
+			if _, err := LoadEncryptionKey(source); err == nil {
+				t.Errorf("Expected an error for %q", source)
+			}
+		}
+	})
+
+	t.Run("operation", func(t *testing.T) {
+		input := writeTestImage(t, testDir, "test_input.png", kernelTestImages(40, 30)["rgba"], encodePNGBuffer)
+		output := filepath.Join(testDir, "out", "test_output.jpg"+EncryptedExt)
+		if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
+			t.Fatalf("Failed to create the output directory: %v", err)
+		}
+		op := e.Operation(func(inputPath, outputPath string) error {
+			if filepath.Ext(outputPath) != ".jpg" {
+				t.Errorf("Expected the operation to write a .jpg, got %s", outputPath)
+			}
+			if err := ResizeImage(inputPath, outputPath, 20, 15); err != nil {
+				return err
+			}
+			// The plain output is kept in memory, never on disk
+			if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+				t.Errorf("Expected no plain file at %s, got %v", outputPath, err)
+			}
+			return nil
+		})
+		if err := op(input, output); err != nil {
+			t.Fatalf("Encrypted operation failed: %v", err)
+		}
+		entries, _ := os.ReadDir(filepath.Dir(output))
+		if len(entries) != 1 {
+			t.Errorf("Expected only the encrypted output, got %d files", len(entries))
+		}
+		decrypted := filepath.Join(testDir, "decrypted.jpg")
+		if err := e.DecryptFile(output, decrypted); err != nil {
+			t.Fatalf("DecryptFile failed: %v", err)
+		}
+		if got := decodeTestFile(t, decrypted).Bounds(); got != image.Rect(0, 0, 20, 15) {
+			t.Errorf("Expected a 20x15 image, got %v", got)
+		}
+		if err := op(input, filepath.Join(testDir, "plain.jpg")); err == nil {
+			t.Error("Expected an error for an output without the encrypted extension")
+		}
+	})
+
+	t.Run("server", func(t *testing.T) {
+		input, err := os.ReadFile(writeTestImage(t, testDir, "test_input_server.png", kernelTestImages(40, 30)["rgba"], encodePNGBuffer))
+		if err != nil {
+			t.Fatalf("Failed to read the input: %v", err)
+		}
+		server := httptest.NewServer(NewServer(ServerOptions{Encryption: e}))
+		defer server.Close()
+		resp, err := http.Post(server.URL+"/rotate?angle=90", "image/png", bytes.NewReader(input))
+		if err != nil {
+			t.Fatalf("Failed to post image: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/octet-stream" {
+			t.Fatalf("Expected an encrypted response, got %s %s", resp.Status, resp.Header.Get("Content-Type"))
+		}
+		plain, err := e.Decrypt(body)
+		if err != nil {
+			t.Fatalf("Failed to decrypt the response: %v", err)
+		}
+		img, _, err := image.Decode(bytes.NewReader(plain))
+		if err != nil || img.Bounds().Dx() != 30 {
+			t.Errorf("Expected a 30 pixel wide JPEG, got %v", err)
+		}
+	})
+}
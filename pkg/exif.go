@@ -0,0 +1,273 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// EXIF tags read by this package
+const (
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagExposureTime     = 0x829a
+	exifTagDateTimeOriginal = 0x9003
+	exifTagExposureBias     = 0x9204
+	exifTagThumbnailOffset  = 0x0201
+	exifTagThumbnailLength  = 0x0202
+	exifTagXResolution      = 0x011a
+	exifTagResolutionUnit   = 0x0128
+)
+
+// exifTimeLayout is the format of EXIF date/time values
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// errNoExif is returned when a file carries no EXIF block
+var errNoExif = errors.New("no EXIF data")
+
+// exifInfo holds the subset of EXIF metadata used by the processor
+type exifInfo struct {
+	Orientation  int
+	DateTime     time.Time
+	ExposureTime float64
+	ExposureBias float64
+	// ThumbnailOffset is the offset of the embedded JPEG thumbnail within
+	// the file; zero when there is none
+	ThumbnailOffset int64
+	ThumbnailLength int64
+	// DPI is the horizontal resolution in dots per inch; zero when not recorded
+	DPI float64
+}
+
+// readExif reads the EXIF metadata of a JPEG file without decoding the image
+func readExif(path string) (*exifInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, &ErrInvalidInput{Path: path, Err: err}
+	}
+	defer file.Close()
+	return decodeExif(file)
+}
+
+// decodeExif reads the EXIF metadata from the start of a JPEG stream
+func decodeExif(r io.Reader) (*exifInfo, error) {
+	tiff, tiffOffset, err := findExifSegment(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	return parseExif(tiff, tiffOffset)
+}
+
+// findExifSegment scans the JPEG markers for the APP1 Exif segment and returns
+// its TIFF payload together with the payload's offset in the file
+func findExifSegment(r *bufio.Reader) ([]byte, int64, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || header != [2]byte{0xff, 0xd8} {
+		return nil, 0, errNoExif
+	}
+	offset := int64(2)
+
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return nil, 0, errNoExif
+		}
+		if marker[0] != 0xff {
+			return nil, 0, errNoExif
+		}
+		// Start of scan: metadata segments all come before image data
+		if marker[1] == 0xda || marker[1] == 0xd9 {
+			return nil, 0, errNoExif
+		}
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return nil, 0, errNoExif
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, 0, errNoExif
+		}
+		if marker[1] == 0xe1 && strings.HasPrefix(string(segment), "Exif\x00\x00") {
+			return segment[6:], offset + 4 + 6, nil
+		}
+		offset += 4 + int64(length)
+	}
+}
+
+// parseExif decodes the TIFF structure of an EXIF block
+func parseExif(tiff []byte, tiffOffset int64) (*exifInfo, error) {
+	if len(tiff) < 8 {
+		return nil, errNoExif
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errNoExif
+	}
+
+	info := &exifInfo{Orientation: 1}
+	ifd0 := order.Uint32(tiff[4:8])
+	tags, next := readIFD(tiff, order, ifd0)
+
+	if v, ok := tags[exifTagOrientation]; ok {
+		info.Orientation = int(v.uint(order))
+	}
+	if v, ok := tags[exifTagDateTime]; ok {
+		info.DateTime = v.time()
+	}
+	if v, ok := tags[exifTagXResolution]; ok {
+		info.DPI = v.rational(order)
+		// ResolutionUnit defaults to inches; 3 means centimeters
+		if unit, ok := tags[exifTagResolutionUnit]; ok && unit.uint(order) == 3 {
+			info.DPI *= 2.54
+		}
+	}
+	if v, ok := tags[exifTagExifIFD]; ok {
+		exifTags, _ := readIFD(tiff, order, v.uint(order))
+		if v, ok := exifTags[exifTagDateTimeOriginal]; ok {
+			if t := v.time(); !t.IsZero() {
+				info.DateTime = t
+			}
+		}
+		if v, ok := exifTags[exifTagExposureTime]; ok {
+			info.ExposureTime = v.rational(order)
+		}
+		if v, ok := exifTags[exifTagExposureBias]; ok {
+			info.ExposureBias = v.rational(order)
+		}
+	}
+
+	// IFD1 describes the embedded thumbnail
+	if next != 0 {
+		thumbTags, _ := readIFD(tiff, order, next)
+		offset, hasOffset := thumbTags[exifTagThumbnailOffset]
+		length, hasLength := thumbTags[exifTagThumbnailLength]
+		if hasOffset && hasLength {
+			info.ThumbnailOffset = tiffOffset + int64(offset.uint(order))
+			info.ThumbnailLength = int64(length.uint(order))
+		}
+	}
+
+	return info, nil
+}
+
+// exifValue is the raw value of an IFD entry
+type exifValue struct {
+	typ  uint16
+	data []byte
+}
+
+// readIFD reads the entries of the IFD at offset and returns them with the offset of the next IFD
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) (map[uint16]exifValue, uint32) {
+	tags := make(map[uint16]exifValue)
+	if int(offset)+2 > len(tiff) {
+		return tags, 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	pos := int(offset) + 2
+	for i := 0; i < count && pos+12 <= len(tiff); i++ {
+		entry := tiff[pos : pos+12]
+		tag := order.Uint16(entry[0:2])
+		typ := order.Uint16(entry[2:4])
+		n := int(order.Uint32(entry[4:8]))
+		size := n * exifTypeSize(typ)
+		data := entry[8:12]
+		if size > 4 {
+			valueOffset := int(order.Uint32(entry[8:12]))
+			if valueOffset < 0 || valueOffset+size > len(tiff) {
+				pos += 12
+				continue
+			}
+			data = tiff[valueOffset : valueOffset+size]
+		} else if size >= 0 {
+			data = data[:size]
+		}
+		tags[tag] = exifValue{typ: typ, data: data}
+		pos += 12
+	}
+
+	var next uint32
+	if pos+4 <= len(tiff) {
+		next = order.Uint32(tiff[pos:])
+	}
+	return tags, next
+}
+
+// exifTypeSize returns the size in bytes of one value of an EXIF type
+func exifTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7:
+		return 1
+	case 3, 8:
+		return 2
+	case 4, 9, 11:
+		return 4
+	case 5, 10, 12:
+		return 8
+	}
+	return 0
+}
+
+// uint returns the first value of a SHORT or LONG entry
+func (v exifValue) uint(order binary.ByteOrder) uint32 {
+	switch {
+	case v.typ == 3 && len(v.data) >= 2:
+		return uint32(order.Uint16(v.data))
+	case v.typ == 4 && len(v.data) >= 4:
+		return order.Uint32(v.data)
+	}
+	return 0
+}
+
+// uints returns the values of a SHORT or LONG entry
+func (v exifValue) uints(order binary.ByteOrder) []uint32 {
+	var values []uint32
+	switch v.typ {
+	case 3:
+		for i := 0; i+2 <= len(v.data); i += 2 {
+			values = append(values, uint32(order.Uint16(v.data[i:])))
+		}
+	case 4:
+		for i := 0; i+4 <= len(v.data); i += 4 {
+			values = append(values, order.Uint32(v.data[i:]))
+		}
+	}
+	return values
+}
+
+// rational returns the first value of a RATIONAL or SRATIONAL entry
+func (v exifValue) rational(order binary.ByteOrder) float64 {
+	if len(v.data) < 8 {
+		return 0
+	}
+	if v.typ == 10 {
+		num, den := int32(order.Uint32(v.data[0:4])), int32(order.Uint32(v.data[4:8]))
+		if den == 0 {
+			return 0
+		}
+		return float64(num) / float64(den)
+	}
+	num, den := order.Uint32(v.data[0:4]), order.Uint32(v.data[4:8])
+	if den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
+
+// time parses an ASCII date/time entry
+func (v exifValue) time() time.Time {
+	t, err := time.Parse(exifTimeLayout, strings.TrimRight(string(v.data), "\x00 "))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
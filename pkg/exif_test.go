@@ -0,0 +1,201 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"testing"
+	"time"
+)
+
+// testExifEntry is an IFD entry written by buildExifTIFF
+type testExifEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// serializeTestIFD lays out an IFD at offset with its out-of-line values following it
+func serializeTestIFD(entries []testExifEntry, offset, next uint32) []byte {
+	order := binary.LittleEndian
+	dataStart := offset + 2 + 12*uint32(len(entries)) + 4
+	var head, extra []byte
+	head = order.AppendUint16(head, uint16(len(entries)))
+	for _, e := range entries {
+		head = order.AppendUint16(head, e.tag)
+		head = order.AppendUint16(head, e.typ)
+		head = order.AppendUint32(head, e.count)
+		if len(e.data) <= 4 {
+			value := make([]byte, 4)
+			copy(value, e.data)
+			head = append(head, value...)
+			continue
+		}
+		head = order.AppendUint32(head, dataStart+uint32(len(extra)))
+		extra = append(extra, e.data...)
+		if len(extra)%2 == 1 {
+			extra = append(extra, 0)
+		}
+	}
+	head = order.AppendUint32(head, next)
+	return append(head, extra...)
+}
+
+// buildExifTIFF builds a little-endian EXIF TIFF block with IFD0, an optional
+// Exif sub-IFD and an optional thumbnail in IFD1
+func buildExifTIFF(ifd0, exifIFD []testExifEntry, thumbnail []byte) []byte {
+	order := binary.LittleEndian
+	if exifIFD != nil {
+		ifd0 = append(ifd0, testExifEntry{tag: exifTagExifIFD, typ: 4, count: 1, data: make([]byte, 4)})
+	}
+	size0 := uint32(len(serializeTestIFD(ifd0, 8, 0)))
+	exifOffset := 8 + size0
+	var exifBytes []byte
+	if exifIFD != nil {
+		order.PutUint32(ifd0[len(ifd0)-1].data, exifOffset)
+		exifBytes = serializeTestIFD(exifIFD, exifOffset, 0)
+	}
+	ifd1Offset := exifOffset + uint32(len(exifBytes))
+
+	var ifd1Bytes []byte
+	next := uint32(0)
+	if thumbnail != nil {
+		next = ifd1Offset
+		ifd1 := []testExifEntry{
+			{tag: exifTagThumbnailOffset, typ: 4, count: 1, data: make([]byte, 4)},
+			{tag: exifTagThumbnailLength, typ: 4, count: 1, data: order.AppendUint32(nil, uint32(len(thumbnail)))},
+		}
+		size1 := uint32(len(serializeTestIFD(ifd1, ifd1Offset, 0)))
+		order.PutUint32(ifd1[0].data, ifd1Offset+size1)
+		ifd1Bytes = append(serializeTestIFD(ifd1, ifd1Offset, 0), thumbnail...)
+	}
+
+	tiff := []byte{'I', 'I', 42, 0}
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = append(tiff, serializeTestIFD(ifd0, 8, next)...)
+	tiff = append(tiff, exifBytes...)
+	return append(tiff, ifd1Bytes...)
+}
+
+// writeJPEGWithExif encodes img as JPEG and inserts an APP1 Exif segment holding tiff
+func writeJPEGWithExif(path string, img image.Image, tiff []byte) error {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		return err
+	}
+	encoded := buf.Bytes()
+
+	segment := []byte{0xff, 0xe1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(2+6+len(tiff)))
+	segment = append(segment, "Exif\x00\x00"...)
+	segment = append(segment, tiff...)
+
+	out := append([]byte{}, encoded[:2]...)
+	out = append(out, segment...)
+	out = append(out, encoded[2:]...)
+	return os.WriteFile(path, out, 0644)
+}
+
+// testExifTime encodes a time as an EXIF ASCII value
+func testExifTime(t time.Time) testExifEntry {
+	value := append([]byte(t.Format(exifTimeLayout)), 0)
+	return testExifEntry{tag: exifTagDateTimeOriginal, typ: 2, count: uint32(len(value)), data: value}
+}
+
+// testExifBias encodes an exposure bias in EV as an SRATIONAL value
+func testExifBias(ev int32) testExifEntry {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(ev*3))
+	data = binary.LittleEndian.AppendUint32(data, 3)
+	return testExifEntry{tag: exifTagExposureBias, typ: 10, count: 1, data: data}
+}
+
+func TestReadExif(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	taken := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	tiff := buildExifTIFF(
+		[]testExifEntry{{tag: exifTagOrientation, typ: 3, count: 1, data: []byte{6, 0}}},
+		[]testExifEntry{testExifTime(taken), testExifBias(-1)},
+		nil,
+	)
+	path := testDir + "/exif.jpg"
+	if err := writeJPEGWithExif(path, image.NewRGBA(image.Rect(0, 0, 16, 16)), tiff); err != nil {
+		t.Fatalf("Failed to write test image: %v", err)
+	}
+
+	info, err := readExif(path)
+	if err != nil {
+		t.Fatalf("Failed to read EXIF: %v", err)
+	}
+	if info.Orientation != 6 {
+		t.Errorf("Expected orientation 6, got %d", info.Orientation)
+	}
+	if !info.DateTime.Equal(taken) {
+		t.Errorf("Expected capture time %v, got %v", taken, info.DateTime)
+	}
+	if info.ExposureBias != -1 {
+		t.Errorf("Expected exposure bias -1, got %v", info.ExposureBias)
+	}
+}
+
+func TestExtractExifThumbnail(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	var thumb bytes.Buffer
+	if err := jpeg.Encode(&thumb, image.NewRGBA(image.Rect(0, 0, 32, 24)), nil); err != nil {
+		t.Fatalf("Failed to encode thumbnail: %v", err)
+	}
+	tiff := buildExifTIFF(
+		[]testExifEntry{{tag: exifTagOrientation, typ: 3, count: 1, data: []byte{6, 0}}},
+		nil,
+		thumb.Bytes(),
+	)
+	path := testDir + "/thumb.jpg"
+	if err := writeJPEGWithExif(path, image.NewRGBA(image.Rect(0, 0, 320, 240)), tiff); err != nil {
+		t.Fatalf("Failed to write test image: %v", err)
+	}
+
+	outputPath := testDir + "/extracted.jpg"
+	result, err := ExtractExifThumbnail(path, outputPath)
+	if err != nil {
+		t.Fatalf("ExtractExifThumbnail failed: %v", err)
+	}
+	if result.Width != 32 || result.Height != 24 || result.Orientation != 6 {
+		t.Errorf("Unexpected thumbnail %+v", result)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read thumbnail: %v", err)
+	}
+	if !bytes.Equal(data, thumb.Bytes()) {
+		t.Error("Extracted thumbnail differs from the embedded one")
+	}
+
+	// A file without EXIF has no thumbnail
+	plain := testDir + "/plain.jpg"
+	if err := generateSingleTestImage(plain, 20, 20); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	if _, err := ExtractExifThumbnail(plain, testDir+"/none.jpg"); err == nil {
+		t.Error("Expected an error for a file without a thumbnail")
+	}
+
+	// A length beyond the EXIF segment is rejected before anything is allocated
+	entry := bytes.Index(tiff, []byte{0x02, 0x02, 4, 0, 1, 0, 0, 0})
+	if entry < 0 {
+		t.Fatal("Thumbnail length entry not found")
+	}
+	binary.LittleEndian.PutUint32(tiff[entry+8:], 1<<30)
+	forged := testDir + "/forged.jpg"
+	if err := writeJPEGWithExif(forged, image.NewRGBA(image.Rect(0, 0, 320, 240)), tiff); err != nil {
+		t.Fatalf("Failed to write test image: %v", err)
+	}
+	if _, err := ExtractExifThumbnail(forged, testDir+"/forged-thumb.jpg"); err == nil {
+		t.Error("Expected an error for a thumbnail longer than its segment")
+	}
+}
@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// exifThumbHeaderSize is how much of a TIFF-based raw file is read to find its
+// directories; raw formats keep IFD0 and IFD1 near the start of the file
+const exifThumbHeaderSize = 256 << 10
+
+// maxExifThumbnail bounds the size of an embedded thumbnail, which has to fit
+// in the 64 KiB APP1 segment of a JPEG
+const maxExifThumbnail = 64 << 10
+
+// errNoThumbnail is returned when a file carries no embedded thumbnail
+var errNoThumbnail = errors.New("no embedded EXIF thumbnail")
+
+// ExifThumbnail describes an extracted EXIF thumbnail
+type ExifThumbnail struct {
+	Width  int   `json:"width"`
+	Height int   `json:"height"`
+	Bytes  int64 `json:"bytes"`
+	// Orientation is the EXIF orientation of the source, which also applies
+	// to the thumbnail
+	Orientation int `json:"orientation"`
+}
+
+// ExtractExifThumbnail copies the JPEG thumbnail embedded in the EXIF data of
+// the input to the output without decoding the full image, which makes it a
+// cheap way to preview large archives. JPEG files are supported, as are
+// TIFF-based raw files that describe the thumbnail in IFD1, as NEF and CR2
+// files do. The thumbnail is copied byte for byte and is not rotated.
+// It takes the paths of the input and output files.
+// Returns the size of the thumbnail, or an error if the input has none.
+func ExtractExifThumbnail(inputPath string, outputPath string) (*ExifThumbnail, error) {
+	slog.Info("extracting EXIF thumbnail", "input", inputPath)
+
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil, &ErrInvalidInput{Path: inputPath, Err: err}
+	}
+	defer file.Close()
+
+	data, thumb, err := exifThumbnailData(file)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := createOutput(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	if _, err := out.Write(data); err != nil {
+		return nil, &ErrProcessing{Op: "write", Err: err}
+	}
+	if err := out.Commit(); err != nil {
+		return nil, err
+	}
+
+	slog.Info("thumbnail extracted",
+		"width", thumb.Width,
+		"height", thumb.Height)
+	return thumb, nil
+}
+
+// ExtractExifThumbnailReader copies the JPEG thumbnail embedded in the EXIF
+// data of the image read from r to w, like ExtractExifThumbnail.
+// Returns the size of the thumbnail, or an error if the input has none.
+func ExtractExifThumbnailReader(r io.Reader, w io.Writer) (*ExifThumbnail, error) {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "read", Err: err}
+	}
+	data, thumb, err := exifThumbnailData(bytes.NewReader(input))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, &ErrProcessing{Op: "write", Err: err}
+	}
+	return thumb, nil
+}
+
+// exifThumbnailData returns the bytes of the JPEG thumbnail embedded in the
+// image and its description. The length in the tags is not trusted: the
+// thumbnail must lie within the data holding it and be at most 64 KiB.
+func exifThumbnailData(rs io.ReadSeeker) ([]byte, *ExifThumbnail, error) {
+	info, end, err := readThumbnailExif(rs)
+	if err != nil || info.ThumbnailLength <= 0 {
+		return nil, nil, &ErrProcessing{Op: "exifthumb", Err: errNoThumbnail}
+	}
+	if info.ThumbnailOffset < 0 || info.ThumbnailLength > maxExifThumbnail || info.ThumbnailLength > end-info.ThumbnailOffset {
+		return nil, nil, &ErrProcessing{Op: "exifthumb", Err: fmt.Errorf("thumbnail of %d bytes at offset %d does not fit in its %d bytes of data", info.ThumbnailLength, info.ThumbnailOffset, end)}
+	}
+
+	data := make([]byte, info.ThumbnailLength)
+	if _, err := rs.Seek(info.ThumbnailOffset, io.SeekStart); err != nil {
+		return nil, nil, &ErrProcessing{Op: "exifthumb", Err: err}
+	}
+	if _, err := io.ReadFull(rs, data); err != nil {
+		return nil, nil, &ErrProcessing{Op: "exifthumb", Err: err}
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, &ErrProcessing{Op: "exifthumb", Err: errNoThumbnail}
+	}
+	return data, &ExifThumbnail{
+		Width:       config.Width,
+		Height:      config.Height,
+		Bytes:       info.ThumbnailLength,
+		Orientation: info.Orientation,
+	}, nil
+}
+
+// readThumbnailExif reads the EXIF metadata of a JPEG file, or of a raw file
+// that is itself a TIFF structure, and returns the offset where the data the
+// thumbnail may lie in ends: the end of the EXIF segment of a JPEG, or of a
+// raw file
+func readThumbnailExif(file io.ReadSeeker) (*exifInfo, int64, error) {
+	header := make([]byte, exifThumbHeaderSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, 0, errNoExif
+	}
+	header = header[:n]
+
+	if bytes.HasPrefix(header, []byte("II*\x00")) || bytes.HasPrefix(header, []byte("MM\x00*")) {
+		size, err := file.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, err
+		}
+		info, err := parseExif(header, 0)
+		return info, size, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	tiff, tiffOffset, err := findExifSegment(bufio.NewReader(file))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := parseExif(tiff, tiffOffset)
+	return info, tiffOffset + int64(len(tiff)), err
+}
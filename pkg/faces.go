@@ -0,0 +1,283 @@
+package processor
+
+import (
+	_ "embed"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"log/slog"
+	"sort"
+
+	pigo "github.com/esimov/pigo/core"
+	"github.com/nfnt/resize"
+)
+
+// facefinderCascade is the pigo frontal face cascade (MIT licensed, see cascade/LICENSE)
+//
+//go:embed cascade/facefinder
+var facefinderCascade []byte
+
+// minFaceScore is the detection score below which a face candidate is discarded
+const minFaceScore = 5.0
+
+// errNoFaces is returned when an operation needs a face and none was found
+var errNoFaces = errors.New("no faces detected")
+
+// Face is a detected face
+type Face struct {
+	Box
+	// Score is the detector confidence; higher is more certain
+	Score float64 `json:"score"`
+}
+
+// DetectFaces finds frontal faces in the input image.
+// It takes the path of the input file.
+// Returns the faces ordered from largest to smallest, or an error if the operation fails.
+func DetectFaces(inputPath string) ([]Face, error) {
+	slog.Info("detecting faces", "input", inputPath)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	faces, err := detectFaces(img)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("detected faces", "count", len(faces))
+	return faces, nil
+}
+
+// DetectFacesReader finds frontal faces in the image read from r like DetectFaces.
+// Returns the faces ordered from largest to smallest, or an error if the operation fails.
+func DetectFacesReader(r io.Reader) ([]Face, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	return detectFaces(img)
+}
+
+// BlurFacesImage blurs every detected face so people cannot be recognized.
+// It takes the paths of the input and output files.
+// Returns the blurred faces, or an error if the operation fails.
+func BlurFacesImage(inputPath string, outputPath string) ([]Face, error) {
+	slog.Info("blurring faces",
+		"input", inputPath,
+		"output", outputPath)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	out, faces, err := BlurFaces(img)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveJPEG(outputPath, out); err != nil {
+		return nil, err
+	}
+	return faces, nil
+}
+
+// BlurFacesImageReader blurs the faces in the image read from r like
+// BlurFacesImage and writes it to w as JPEG.
+// Returns the blurred faces, or an error if the operation fails.
+func BlurFacesImageReader(r io.Reader, w io.Writer) ([]Face, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	out, faces, err := BlurFaces(img)
+	if err != nil {
+		return nil, err
+	}
+	if err := encodeJPEG(w, out); err != nil {
+		return nil, err
+	}
+	return faces, nil
+}
+
+// BlurFaces returns a copy of the image with every detected face blurred,
+// like BlurFacesImage.
+// Returns the blurred image and faces, or an error if the detection fails.
+func BlurFaces(img image.Image) (image.Image, []Face, error) {
+	faces, err := detectFaces(img)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := toRGBA(img)
+	for _, face := range faces {
+		r := face.Rect()
+		// A radius proportional to the face size hides features at any scale
+		blurRegion(out, r, max(2, r.Dx()/8))
+	}
+
+	slog.Info("blurred faces", "count", len(faces))
+	return out, faces, nil
+}
+
+// FaceCropImage crops the image to a square around the largest face, for avatars.
+// The margin is the space kept around the face as a fraction of its size,
+// and a positive size resizes the crop to size x size.
+// It takes the paths of the input and output files, the margin and the size.
+// Returns the face that was cropped, or an error if the operation fails.
+func FaceCropImage(inputPath string, outputPath string, margin float64, size uint) (*Face, error) {
+	slog.Info("cropping to face",
+		"input", inputPath,
+		"margin", margin,
+		"size", size)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	out, face, err := FaceCrop(img, margin, size)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveJPEG(outputPath, out); err != nil {
+		return nil, err
+	}
+	return face, nil
+}
+
+// FaceCropImageReader crops the image read from r around its largest face
+// like FaceCropImage and writes it to w as JPEG.
+// Returns the face that was cropped, or an error if the operation fails.
+func FaceCropImageReader(r io.Reader, w io.Writer, margin float64, size uint) (*Face, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	out, face, err := FaceCrop(img, margin, size)
+	if err != nil {
+		return nil, err
+	}
+	if err := encodeJPEG(w, out); err != nil {
+		return nil, err
+	}
+	return face, nil
+}
+
+// FaceCrop crops the image to a square around the largest face, like
+// FaceCropImage. The margin is a fraction of the face size, and a positive
+// size resizes the crop to size x size.
+// Returns the crop and the face, or an error if no face was found.
+func FaceCrop(img image.Image, margin float64, size uint) (image.Image, *Face, error) {
+	faces, err := detectFaces(img)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(faces) == 0 {
+		return nil, nil, &ErrProcessing{Op: "facecrop", Err: errNoFaces}
+	}
+
+	rgba := toRGBA(img)
+	crop := faceCropRect(faces[0].Rect(), rgba.Bounds(), margin)
+	var out image.Image = rgba.SubImage(crop)
+	if size > 0 {
+		out = resize.Resize(size, size, out, resize.Lanczos3)
+	}
+	return out, &faces[0], nil
+}
+
+// detectFaces runs the pigo face cascade over the image
+func detectFaces(img image.Image) ([]Face, error) {
+	classifier, err := pigo.NewPigo().Unpack(facefinderCascade)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "face detection", Err: err}
+	}
+
+	gray := toGray(img)
+	w, h := gray.Bounds().Dx(), gray.Bounds().Dy()
+	params := pigo.CascadeParams{
+		MinSize:     max(20, min(w, h)/20),
+		MaxSize:     min(w, h),
+		ShiftFactor: 0.1,
+		ScaleFactor: 1.1,
+		ImageParams: pigo.ImageParams{
+			Pixels: gray.Pix,
+			Rows:   h,
+			Cols:   w,
+			Dim:    gray.Stride,
+		},
+	}
+	detections := classifier.ClusterDetections(classifier.RunCascade(params, 0), 0.2)
+
+	var faces []Face
+	for _, d := range detections {
+		if d.Q < minFaceScore {
+			continue
+		}
+		r := image.Rect(d.Col-d.Scale/2, d.Row-d.Scale/2, d.Col+d.Scale/2, d.Row+d.Scale/2).Intersect(image.Rect(0, 0, w, h))
+		faces = append(faces, Face{Box: boxFromRect(r), Score: float64(d.Q)})
+	}
+	sort.Slice(faces, func(i, j int) bool {
+		return faces[i].Width*faces[i].Height > faces[j].Width*faces[j].Height
+	})
+	return faces, nil
+}
+
+// faceCropRect returns the square around face, grown by margin on each side
+// and shifted or shrunk to stay within bounds
+func faceCropRect(face, bounds image.Rectangle, margin float64) image.Rectangle {
+	side := int(float64(max(face.Dx(), face.Dy())) * (1 + 2*margin))
+	side = min(side, bounds.Dx(), bounds.Dy())
+	center := image.Pt((face.Min.X+face.Max.X)/2, (face.Min.Y+face.Max.Y)/2)
+
+	x0 := min(max(center.X-side/2, bounds.Min.X), bounds.Max.X-side)
+	y0 := min(max(center.Y-side/2, bounds.Min.Y), bounds.Max.Y-side)
+	return image.Rect(x0, y0, x0+side, y0+side)
+}
+
+// blurRegion applies three passes of a box blur of the given radius to r,
+// which approximates a Gaussian blur
+func blurRegion(img *image.RGBA, r image.Rectangle, radius int) {
+	r = r.Intersect(img.Bounds())
+	if r.Empty() {
+		return
+	}
+	region := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(region, region.Bounds(), img, r.Min, draw.Src)
+
+	w, h := r.Dx(), r.Dy()
+	tmp := make([]uint8, len(region.Pix))
+	for pass := 0; pass < 3; pass++ {
+		boxBlurPass(region.Pix, tmp, w, h, radius, 4, w*4)
+		boxBlurPass(tmp, region.Pix, h, w, radius, w*4, 4)
+	}
+	draw.Draw(img, r, region, image.Point{}, draw.Src)
+}
+
+// boxBlurPass blurs src into dst along one axis. Lines are n samples long,
+// step bytes apart, and consecutive lines start stride bytes apart.
+// The edges are clamped.
+func boxBlurPass(src, dst []uint8, n, lines, radius, step, stride int) {
+	window := 2*radius + 1
+	for line := 0; line < lines; line++ {
+		base := line * stride
+		for c := 0; c < 4; c++ {
+			// Samples outside the line repeat the first or last one
+			first, last := int(src[base+c]), int(src[base+(n-1)*step+c])
+			sum := 0
+			for i := -radius; i <= radius; i++ {
+				sum += int(src[base+min(max(i, 0), n-1)*step+c])
+			}
+			for i, p := 0, base+c; i < n; i, p = i+1, p+step {
+				dst[p] = uint8((sum + window/2) / window)
+				in, out := last, first
+				if i+radius+1 < n {
+					in = int(src[p+(radius+1)*step])
+				}
+				if i >= radius {
+					out = int(src[p-radius*step])
+				}
+				sum += in - out
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFaceCropRect(t *testing.T) {
+	bounds := image.Rect(0, 0, 200, 100)
+
+	crop := faceCropRect(image.Rect(80, 30, 120, 70), bounds, 0.25)
+	if crop != image.Rect(70, 20, 130, 80) {
+		t.Errorf("Expected a square 60px crop around the face, got %v", crop)
+	}
+
+	// Near the border the crop is shifted and shrunk to stay inside the image
+	crop = faceCropRect(image.Rect(0, 0, 60, 60), bounds, 0.5)
+	if crop != image.Rect(0, 0, 100, 100) {
+		t.Errorf("Expected the crop to stay inside the image, got %v", crop)
+	}
+}
+
+func TestBlurRegion(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			if (x/2+y/2)%2 == 0 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	blurRegion(img, image.Rect(10, 10, 30, 30), 4)
+
+	// The fine checkerboard is smoothed to gray inside the region...
+	if c := img.RGBAAt(20, 20); c.R < 64 || c.R > 192 {
+		t.Errorf("Expected a blurred gray inside the region, got %v", c)
+	}
+	// ...and left untouched outside it
+	if c := img.RGBAAt(0, 0); c.R != 255 {
+		t.Errorf("Expected pixels outside the region to be unchanged, got %v", c)
+	}
+}
+
+func TestBlurFacesImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_faces.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_faces.jpg")
+	if err := generateSingleTestImage(testInputPath, 100, 100); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	faces, err := BlurFacesImage(testInputPath, testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to blur faces: %v", err)
+	}
+	if len(faces) != 0 {
+		t.Errorf("Expected no faces in a test pattern, got %+v", faces)
+	}
+	if _, err := os.Stat(testOutputPath); os.IsNotExist(err) {
+		t.Errorf("Output file was not created")
+	}
+
+	if _, err := FaceCropImage(testInputPath, testOutputPath, 0.3, 64); err == nil {
+		t.Errorf("Expected an error when cropping an image without faces")
+	}
+}
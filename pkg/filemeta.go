@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// SymlinkPolicy selects how batch runs treat inputs that are symbolic links
+type SymlinkPolicy string
+
+const (
+	// SymlinkFollow processes the file a link points to
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkSkip leaves links untouched and reports them as skipped
+	SymlinkSkip SymlinkPolicy = "skip"
+)
+
+// ParseSymlinkPolicy converts a policy name to a SymlinkPolicy.
+// An empty name selects SymlinkFollow.
+func ParseSymlinkPolicy(name string) (SymlinkPolicy, error) {
+	switch SymlinkPolicy(name) {
+	case "", SymlinkFollow:
+		return SymlinkFollow, nil
+	case SymlinkSkip:
+		return SymlinkSkip, nil
+	}
+	return "", fmt.Errorf("invalid symlink policy %q (want follow or skip)", name)
+}
+
+// isSymlink reports whether path itself is a symbolic link
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// preserveFileInfo copies the owner, permissions and modification time of
+// src to dst, as selected in opts. Links are followed, so a linked input
+// passes on the metadata of the file it points to.
+func preserveFileInfo(src, dst string, opts BatchOptions) error {
+	if !opts.PreserveOwner && !opts.PreserveMode && !opts.PreserveTimes {
+		return nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return &ErrInvalidInput{Path: src, Err: err}
+	}
+
+	// Ownership goes first: changing it may clear the setuid and setgid bits
+	if opts.PreserveOwner {
+		if uid, gid, ok := fileOwner(info); ok {
+			if err := os.Chown(dst, uid, gid); err != nil {
+				return &ErrProcessing{Op: "preserve owner", Err: err}
+			}
+		}
+	}
+	if opts.PreserveMode {
+		if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+			return &ErrProcessing{Op: "preserve mode", Err: err}
+		}
+	}
+	if opts.PreserveTimes {
+		// A zero access time leaves it unchanged
+		if err := os.Chtimes(dst, time.Time{}, info.ModTime()); err != nil {
+			return &ErrProcessing{Op: "preserve times", Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package processor
+
+import "os"
+
+// fileOwner reports that file ownership is not available on this platform
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
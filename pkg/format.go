@@ -0,0 +1,193 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Image formats recognized by DetectFormat
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+	FormatBMP  = "bmp"
+	FormatTIFF = "tiff"
+	FormatWebP = "webp"
+)
+
+// formatExtensions lists the file extensions of each format, preferred first
+var formatExtensions = map[string][]string{
+	FormatJPEG: {".jpg", ".jpeg", ".jpe"},
+	FormatPNG:  {".png"},
+	FormatGIF:  {".gif"},
+	FormatBMP:  {".bmp"},
+	FormatTIFF: {".tif", ".tiff"},
+	FormatWebP: {".webp"},
+}
+
+// sniffFormat identifies an image format from the first bytes of a file.
+// Returns an empty string when the data is not a recognized image.
+func sniffFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return FormatJPEG
+	case bytes.HasPrefix(header, []byte(pngSignature)):
+		return FormatPNG
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return FormatGIF
+	case bytes.HasPrefix(header, []byte("BM")):
+		return FormatBMP
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		return FormatTIFF
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return FormatWebP
+	}
+	return ""
+}
+
+// extensionFormat returns the format a file extension stands for, or an
+// empty string for extensions that are not image formats
+func extensionFormat(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	for format, extensions := range formatExtensions {
+		for _, e := range extensions {
+			if e == ext {
+				return format
+			}
+		}
+	}
+	return ""
+}
+
+// DetectFormat identifies the format of an image file from its magic bytes,
+// regardless of its extension.
+// Returns an empty string when the file is not a recognized image.
+func DetectFormat(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", &ErrInvalidInput{Path: path, Err: err}
+	}
+	defer file.Close()
+
+	header := make([]byte, 12)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", &ErrProcessing{Op: "detect format", Err: err}
+	}
+	return sniffFormat(header[:n]), nil
+}
+
+// warnExtensionMismatch logs a warning when data in one format is about to be
+// written under the extension of another, such as JPEG data to a .png path
+func warnExtensionMismatch(logger *slog.Logger, path string, header []byte) {
+	format, want := sniffFormat(header), extensionFormat(path)
+	if format != "" && want != "" && format != want {
+		logger.Warn("output extension does not match its format",
+			"path", path,
+			"format", format,
+			"extension", filepath.Ext(path))
+	}
+}
+
+// FixExtensionOptions controls FixExtension
+type FixExtensionOptions struct {
+	// Reencode converts the data to the format of the extension instead of renaming the file
+	Reencode bool
+	// DryRun reports mismatches without changing any files
+	DryRun bool
+}
+
+// ExtensionFix describes the format check of one file
+type ExtensionFix struct {
+	Path      string `json:"path"`
+	Format    string `json:"format"`
+	Extension string `json:"extension"`
+	Mismatch  bool   `json:"mismatch"`
+	// NewPath is the path of the renamed file, when the file was renamed
+	NewPath   string `json:"new_path,omitempty"`
+	Reencoded bool   `json:"reencoded,omitempty"`
+}
+
+// FixExtension checks that the extension of an image file matches the format
+// of its data. A mismatched file is renamed to the extension of its format,
+// or with Reencode, converted to the format its extension names.
+// Re-encoding supports JPEG and PNG targets.
+// It takes the path of the file and the options.
+// Returns the result of the check and an error if the operation fails.
+func FixExtension(path string, opts FixExtensionOptions) (*ExtensionFix, error) {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		return nil, &ErrUnsupportedFormat{Format: filepath.Ext(path)}
+	}
+	want := extensionFormat(path)
+	fix := &ExtensionFix{
+		Path:      path,
+		Format:    format,
+		Extension: filepath.Ext(path),
+		Mismatch:  format != want,
+	}
+	if !fix.Mismatch || opts.DryRun {
+		return fix, nil
+	}
+
+	if opts.Reencode {
+		if want != FormatJPEG && want != FormatPNG {
+			return nil, &ErrUnsupportedFormat{Format: fix.Extension}
+		}
+		img, err := loadImage(path)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("re-encoding file to match its extension",
+			"path", path,
+			"from", format,
+			"to", want)
+		if want == FormatJPEG {
+			err = saveJPEG(path, img)
+		} else {
+			err = savePNG(path, img)
+		}
+		if err != nil {
+			return nil, err
+		}
+		fix.Reencoded = true
+		return fix, nil
+	}
+
+	newPath := strings.TrimSuffix(path, fix.Extension) + formatExtensions[format][0]
+	if _, err := os.Lstat(newPath); err == nil {
+		return nil, &ErrInvalidOutput{Path: newPath, Err: fs.ErrExist}
+	}
+	slog.Info("renaming file to match its format",
+		"path", path,
+		"new_path", newPath)
+	if err := os.Rename(path, newPath); err != nil {
+		return nil, &ErrInvalidOutput{Path: newPath, Err: err}
+	}
+	fix.NewPath = newPath
+	return fix, nil
+}
+
+// savePNG saves an image as PNG
+func savePNG(outputPath string, img image.Image) error {
+	out, err := createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := png.Encode(out, img); err != nil {
+		return &ErrProcessing{Op: "encode", Err: err}
+	}
+	return out.Commit()
+}
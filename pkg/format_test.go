@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixExtension(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// JPEG data saved under a .png name
+	mislabeled := filepath.Join(testDir, "photo.png")
+	if err := generateSingleTestImage(mislabeled, 40, 30); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	format, err := DetectFormat(mislabeled)
+	if err != nil {
+		t.Fatalf("DetectFormat failed: %v", err)
+	}
+	if format != FormatJPEG {
+		t.Fatalf("Expected %s, got %q", FormatJPEG, format)
+	}
+
+	fix, err := FixExtension(mislabeled, FixExtensionOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("FixExtension failed: %v", err)
+	}
+	if !fix.Mismatch || fix.NewPath != "" {
+		t.Errorf("Expected an unchanged mismatch in dry run, got %+v", fix)
+	}
+
+	fix, err = FixExtension(mislabeled, FixExtensionOptions{})
+	if err != nil {
+		t.Fatalf("FixExtension failed: %v", err)
+	}
+	want := filepath.Join(testDir, "photo.jpg")
+	if fix.NewPath != want {
+		t.Errorf("Expected rename to %s, got %+v", want, fix)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Errorf("Renamed file missing: %v", err)
+	}
+
+	// Re-encoding keeps the name and converts the data
+	reencoded := filepath.Join(testDir, "scan.png")
+	if err := generateSingleTestImage(reencoded, 40, 30); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	if _, err := FixExtension(reencoded, FixExtensionOptions{Reencode: true}); err != nil {
+		t.Fatalf("FixExtension failed: %v", err)
+	}
+	if format, _ := DetectFormat(reencoded); format != FormatPNG {
+		t.Errorf("Expected %s after re-encoding, got %q", FormatPNG, format)
+	}
+}
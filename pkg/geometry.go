@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Geometry is a size, scale, offset or aspect ratio in the compact notation
+// shared by the commands that take one:
+//
+//	800x600     width and height
+//	800x, x600  width or height only
+//	50%         scale
+//	+10+20      offset from the top left corner, combinable with a size
+//	16:9        aspect ratio
+//
+// Widths and heights may carry a unit (210mmx297mm).
+type Geometry struct {
+	// Width and Height are zero when not given
+	Width, Height Length
+	// Scale is the factor of a percentage geometry, zero otherwise
+	Scale float64
+	// Offset is the offset of the rectangle, valid when HasOffset is set
+	Offset    image.Point
+	HasOffset bool
+	// AspectWidth and AspectHeight are the terms of an aspect ratio, zero otherwise
+	AspectWidth, AspectHeight float64
+}
+
+// ParseGeometry parses a geometry such as "800x600", "x600", "50%", "16:9"
+// or "300x200+10+20"
+func ParseGeometry(s string) (Geometry, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	invalid := fmt.Errorf("invalid geometry %q", s)
+	var g Geometry
+
+	// The offset is the trailing +x+y, where either sign may be a minus
+	if i := strings.IndexAny(s, "+-"); i >= 0 {
+		offset := s[i:]
+		j := strings.IndexAny(offset[1:], "+-")
+		if j < 0 {
+			return Geometry{}, invalid
+		}
+		x, errX := strconv.Atoi(offset[:j+1])
+		y, errY := strconv.Atoi(offset[j+1:])
+		if errX != nil || errY != nil {
+			return Geometry{}, invalid
+		}
+		g.Offset, g.HasOffset = image.Pt(x, y), true
+		s = s[:i]
+	}
+	if s == "" {
+		if !g.HasOffset {
+			return Geometry{}, invalid
+		}
+		return g, nil
+	}
+
+	if w, h, ok := strings.Cut(s, ":"); ok {
+		aw, errW := strconv.ParseFloat(w, 64)
+		ah, errH := strconv.ParseFloat(h, 64)
+		if errW != nil || errH != nil || aw <= 0 || ah <= 0 || g.HasOffset {
+			return Geometry{}, invalid
+		}
+		g.AspectWidth, g.AspectHeight = aw, ah
+		return g, nil
+	}
+	if strings.HasSuffix(s, "%") {
+		scale, err := ParseScale(s)
+		if err != nil {
+			return Geometry{}, invalid
+		}
+		g.Scale = scale
+		return g, nil
+	}
+
+	w, h, hasX := cutGeometrySize(s)
+	if w == "" && h == "" {
+		return Geometry{}, invalid
+	}
+	for _, dim := range []struct {
+		value  string
+		length *Length
+	}{{w, &g.Width}, {h, &g.Height}} {
+		if dim.value == "" {
+			continue
+		}
+		length, err := ParseLength(dim.value)
+		if err != nil {
+			return Geometry{}, invalid
+		}
+		*dim.length = length
+	}
+	if !hasX && g.Height.Value != 0 {
+		return Geometry{}, invalid
+	}
+	return g, nil
+}
+
+// cutGeometrySize splits "WxH" at the x separating the width from the
+// height, skipping the x of a px unit
+func cutGeometrySize(s string) (width, height string, found bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == 'x' && (i == 0 || s[i-1] != 'p') {
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// IsSize reports whether the geometry gives a width or a height
+func (g Geometry) IsSize() bool {
+	return g.Width.Value > 0 || g.Height.Value > 0
+}
+
+// IsAspect reports whether the geometry is an aspect ratio
+func (g Geometry) IsAspect() bool {
+	return g.AspectWidth > 0 && g.AspectHeight > 0
+}
+
+// Rect returns the rectangle of a geometry with a pixel size and an optional
+// offset, such as "300x200+10+20"
+func (g Geometry) Rect() (image.Rectangle, error) {
+	if g.Width.Value <= 0 || g.Height.Value <= 0 || g.Width.IsPhysical() || g.Height.IsPhysical() {
+		return image.Rectangle{}, fmt.Errorf("geometry %s needs a width and a height in pixels", g)
+	}
+	size := image.Pt(int(g.Width.Pixels(0)), int(g.Height.Pixels(0)))
+	return image.Rectangle{Min: g.Offset, Max: g.Offset.Add(size)}, nil
+}
+
+// String returns the geometry in the notation ParseGeometry accepts
+func (g Geometry) String() string {
+	var s string
+	switch {
+	case g.IsAspect():
+		s = strconv.FormatFloat(g.AspectWidth, 'f', -1, 64) + ":" + strconv.FormatFloat(g.AspectHeight, 'f', -1, 64)
+	case g.Scale > 0:
+		s = strconv.FormatFloat(g.Scale*100, 'f', -1, 64) + "%"
+	case g.IsSize():
+		if g.Width.Value > 0 {
+			s = g.Width.String()
+		}
+		s += "x"
+		if g.Height.Value > 0 {
+			s += g.Height.String()
+		}
+	}
+	if g.HasOffset {
+		s += fmt.Sprintf("%+d%+d", g.Offset.X, g.Offset.Y)
+	}
+	return s
+}
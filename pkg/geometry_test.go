@@ -0,0 +1,52 @@
+package processor
+
+import (
+	"image"
+	"testing"
+)
+
+func TestParseGeometry(t *testing.T) {
+	px := func(v float64) Length { return Length{Value: v, Unit: UnitPixel} }
+	tests := map[string]Geometry{
+		"800x600":       {Width: px(800), Height: px(600)},
+		"800x":          {Width: px(800)},
+		"800":           {Width: px(800)},
+		"x600":          {Height: px(600)},
+		"800pxx600px":   {Width: px(800), Height: px(600)},
+		"210mmx297mm":   {Width: Length{210, UnitMillimeter}, Height: Length{297, UnitMillimeter}},
+		"50%":           {Scale: 0.5},
+		"16:9":          {AspectWidth: 16, AspectHeight: 9},
+		"+10+20":        {Offset: image.Pt(10, 20), HasOffset: true},
+		"300x200-5+7":   {Width: px(300), Height: px(200), Offset: image.Pt(-5, 7), HasOffset: true},
+		" 300X200+0+0 ": {Width: px(300), Height: px(200), HasOffset: true},
+	}
+	for s, want := range tests {
+		got, err := ParseGeometry(s)
+		if err != nil {
+			t.Errorf("ParseGeometry(%q) failed: %v", s, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseGeometry(%q): expected %+v, got %+v", s, want, got)
+		}
+		// String must round-trip
+		again, err := ParseGeometry(got.String())
+		if err != nil || again != got {
+			t.Errorf("ParseGeometry(%q).String() = %q does not round-trip: %+v, %v", s, got.String(), again, err)
+		}
+	}
+	for _, s := range []string{"", "x", "abc", "800x600+10", "16:0", "16:9+1+1", "-5%", "800y600", "0x600"} {
+		if _, err := ParseGeometry(s); err == nil {
+			t.Errorf("ParseGeometry(%q): expected an error", s)
+		}
+	}
+
+	g, _ := ParseGeometry("300x200+10+20")
+	if r, err := g.Rect(); err != nil || r != image.Rect(10, 20, 310, 220) {
+		t.Errorf("Expected rectangle (10,20)-(310,220), got %v, %v", r, err)
+	}
+	g, _ = ParseGeometry("800x")
+	if _, err := g.Rect(); err == nil {
+		t.Errorf("Expected an error for a rectangle without a height")
+	}
+}
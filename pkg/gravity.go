@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Gravity is the anchor that places a rectangle inside a larger one, used by
+// every operation that positions or cuts out part of an image. X and Y are the
+// position within the free space, from 0 (left or top) to 1 (right or bottom),
+// so that the nine compass gravities keep the rectangle against the matching
+// edges and percentages place it anywhere in between.
+type Gravity struct {
+	X, Y float64
+}
+
+// Named gravities
+var (
+	GravityNorthWest = Gravity{0, 0}
+	GravityNorth     = Gravity{0.5, 0}
+	GravityNorthEast = Gravity{1, 0}
+	GravityWest      = Gravity{0, 0.5}
+	GravityCenter    = Gravity{0.5, 0.5}
+	GravityEast      = Gravity{1, 0.5}
+	GravitySouthWest = Gravity{0, 1}
+	GravitySouth     = Gravity{0.5, 1}
+	GravitySouthEast = Gravity{1, 1}
+)
+
+// gravityNames maps the names accepted by ParseGravity to gravities; the
+// compass names come first and are the ones String returns
+var gravityNames = []struct {
+	name    string
+	gravity Gravity
+}{
+	{"north-west", GravityNorthWest},
+	{"north", GravityNorth},
+	{"north-east", GravityNorthEast},
+	{"west", GravityWest},
+	{"center", GravityCenter},
+	{"east", GravityEast},
+	{"south-west", GravitySouthWest},
+	{"south", GravitySouth},
+	{"south-east", GravitySouthEast},
+	{"top-left", GravityNorthWest},
+	{"top", GravityNorth},
+	{"top-right", GravityNorthEast},
+	{"left", GravityWest},
+	{"centre", GravityCenter},
+	{"right", GravityEast},
+	{"bottom-left", GravitySouthWest},
+	{"bottom", GravitySouth},
+	{"bottom-right", GravitySouthEast},
+}
+
+// ParseGravity parses a gravity: a compass name such as "north-east" or
+// "center", the equivalent "top-right" style name, or the position within
+// the free space as percentages, such as "25%,75%"
+func ParseGravity(s string) (Gravity, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	key := strings.ReplaceAll(strings.ReplaceAll(name, "_", "-"), " ", "-")
+	for _, g := range gravityNames {
+		if g.name == key || strings.ReplaceAll(g.name, "-", "") == key {
+			return g.gravity, nil
+		}
+	}
+
+	x, y, ok := strings.Cut(name, ",")
+	if !ok {
+		return Gravity{}, fmt.Errorf("invalid gravity %q", s)
+	}
+	var g Gravity
+	for i, part := range []string{x, y} {
+		part, ok := strings.CutSuffix(strings.TrimSpace(part), "%")
+		if !ok {
+			return Gravity{}, fmt.Errorf("invalid gravity %q (want percentages such as 25%%,75%%)", s)
+		}
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 || v > 100 {
+			return Gravity{}, fmt.Errorf("invalid gravity %q (percentages must be 0-100)", s)
+		}
+		if i == 0 {
+			g.X = v / 100
+		} else {
+			g.Y = v / 100
+		}
+	}
+	return g, nil
+}
+
+// String returns the compass name of the gravity, or its percentages
+func (g Gravity) String() string {
+	for _, n := range gravityNames {
+		if n.gravity == g {
+			return n.name
+		}
+	}
+	return strconv.FormatFloat(g.X*100, 'f', -1, 64) + "%," + strconv.FormatFloat(g.Y*100, 'f', -1, 64) + "%"
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (g Gravity) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (g *Gravity) UnmarshalText(text []byte) error {
+	parsed, err := ParseGravity(string(text))
+	if err != nil {
+		return err
+	}
+	*g = parsed
+	return nil
+}
+
+// Place returns where a rectangle of the given size goes inside bounds, keeping
+// margin pixels from the edges. A rectangle larger than the space overhangs
+// the edges in the same proportion, so callers cutting out a region should
+// intersect the result with bounds.
+func (g Gravity) Place(bounds image.Rectangle, size image.Point, margin int) image.Rectangle {
+	free := bounds.Size().Sub(size).Sub(image.Pt(2*margin, 2*margin))
+	origin := bounds.Min.Add(image.Pt(margin, margin)).Add(image.Pt(
+		int(math.Floor(g.X*float64(free.X))),
+		int(math.Floor(g.Y*float64(free.Y))),
+	))
+	return image.Rectangle{Min: origin, Max: origin.Add(size)}
+}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"encoding/json"
+	"image"
+	"testing"
+)
+
+func TestParseGravity(t *testing.T) {
+	tests := map[string]Gravity{
+		"north-east":  GravityNorthEast,
+		"NorthEast":   GravityNorthEast,
+		"top-right":   GravityNorthEast,
+		"center":      GravityCenter,
+		"south_west":  GravitySouthWest,
+		"bottom":      GravitySouth,
+		"25%,75%":     {0.25, 0.75},
+		" 0% , 100% ": GravitySouthWest,
+	}
+	for s, want := range tests {
+		got, err := ParseGravity(s)
+		if err != nil {
+			t.Errorf("ParseGravity(%q) failed: %v", s, err)
+		} else if got != want {
+			t.Errorf("ParseGravity(%q): expected %v, got %v", s, want, got)
+		}
+	}
+	for _, s := range []string{"", "up", "25,75", "25%", "-5%,10%", "50%,150%"} {
+		if _, err := ParseGravity(s); err == nil {
+			t.Errorf("ParseGravity(%q): expected an error", s)
+		}
+	}
+
+	if s := GravityNorthWest.String(); s != "north-west" {
+		t.Errorf("Expected north-west, got %s", s)
+	}
+	if s := (Gravity{0.25, 0.5}).String(); s != "25%,50%" {
+		t.Errorf("Expected 25%%,50%%, got %s", s)
+	}
+	data, err := json.Marshal(struct{ G Gravity }{Gravity{0.3, 1}})
+	if err != nil {
+		t.Fatalf("Failed to marshal gravity: %v", err)
+	}
+	var decoded struct{ G Gravity }
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.G != (Gravity{0.3, 1}) {
+		t.Errorf("Gravity did not survive JSON: %s, %v, %v", data, decoded.G, err)
+	}
+}
+
+func TestGravityPlace(t *testing.T) {
+	bounds := image.Rect(10, 20, 110, 80)
+	size := image.Pt(20, 10)
+	tests := map[Gravity]image.Rectangle{
+		GravityNorthWest: image.Rect(15, 25, 35, 35),
+		GravityNorth:     image.Rect(50, 25, 70, 35),
+		GravitySouthEast: image.Rect(85, 65, 105, 75),
+		GravityCenter:    image.Rect(50, 45, 70, 55),
+		{0.25, 0.5}:      image.Rect(32, 45, 52, 55),
+	}
+	for g, want := range tests {
+		if got := g.Place(bounds, size, 5); got != want {
+			t.Errorf("%v: expected %v, got %v", g, want, got)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+// PhotoGroup is a set of photos taken in quick succession of the same scene.
+// Kind is "bracket" when the exposures differ, "burst" when they don't and
+// "single" for a photo that belongs to no group.
+type PhotoGroup struct {
+	Kind  string    `json:"kind"`
+	Start time.Time `json:"start"`
+	Files []string  `json:"files"`
+}
+
+// groupCandidate is a photo with the metadata used for grouping
+type groupCandidate struct {
+	path     string
+	taken    time.Time
+	exposure float64
+	bias     float64
+	hash     uint64
+}
+
+// GroupPhotos clusters photos into exposure brackets and bursts.
+// Photos are ordered by their EXIF capture time (falling back to the file
+// modification time), and consecutive photos are grouped when they were taken
+// at most maxGap apart and their perceptual hashes differ by at most maxDistance bits.
+// It takes the input file paths, the maximum time gap and the maximum hash distance.
+// Returns the groups in capture order, or an error if the operation fails.
+func GroupPhotos(inputPaths []string, maxGap time.Duration, maxDistance int) ([]PhotoGroup, error) {
+	slog.Info("grouping photos",
+		"count", len(inputPaths),
+		"max_gap", maxGap,
+		"max_distance", maxDistance)
+
+	var candidates []groupCandidate
+	for _, path := range inputPaths {
+		img, err := loadImage(path)
+		if err != nil {
+			return nil, err
+		}
+		candidate := groupCandidate{path: path, hash: differenceHash(img, img.Bounds())}
+
+		if info, err := readExif(path); err == nil {
+			candidate.taken = info.DateTime
+			candidate.exposure = info.ExposureTime
+			candidate.bias = info.ExposureBias
+		}
+		if candidate.taken.IsZero() {
+			stat, err := os.Stat(path)
+			if err != nil {
+				return nil, &ErrInvalidInput{Path: path, Err: err}
+			}
+			candidate.taken = stat.ModTime()
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].taken.Before(candidates[j].taken)
+	})
+
+	var groups []PhotoGroup
+	var current []groupCandidate
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		group := PhotoGroup{Kind: "single", Start: current[0].taken}
+		if len(current) > 1 {
+			group.Kind = "burst"
+		}
+		for _, c := range current {
+			group.Files = append(group.Files, c.path)
+			if c.exposure != current[0].exposure || c.bias != current[0].bias {
+				group.Kind = "bracket"
+			}
+		}
+		groups = append(groups, group)
+		current = nil
+	}
+
+	for _, c := range candidates {
+		if len(current) > 0 {
+			last := current[len(current)-1]
+			if c.taken.Sub(last.taken) > maxGap || HashDistance(c.hash, last.hash) > maxDistance {
+				flush()
+			}
+		}
+		current = append(current, c)
+	}
+	flush()
+
+	return groups, nil
+}
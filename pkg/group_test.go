@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGroupPhotos(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	scene := func(brightness float64, flip bool) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				v := float64((x*5)^(y*3)) * brightness
+				if flip {
+					v = float64((y*7)^(x*2)) * brightness
+				}
+				img.Set(x, y, color.Gray{Y: uint8(v)})
+			}
+		}
+		return img
+	}
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	shots := []struct {
+		img    image.Image
+		offset time.Duration
+		bias   int32
+	}{
+		{scene(1, false), 0, 0},
+		{scene(0.8, false), time.Second, -1},
+		{scene(1, false), 2 * time.Second, 1},
+		{scene(1, true), time.Hour, 0},
+	}
+
+	var paths []string
+	for i, shot := range shots {
+		path := filepath.Join(testDir, fmt.Sprintf("shot_%d.jpg", i))
+		tiff := buildExifTIFF(nil, []testExifEntry{testExifTime(start.Add(shot.offset)), testExifBias(shot.bias)}, nil)
+		if err := writeJPEGWithExif(path, shot.img, tiff); err != nil {
+			t.Fatalf("Failed to write test image: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	groups, err := GroupPhotos(paths, 2*time.Second, 20)
+	if err != nil {
+		t.Fatalf("Failed to group photos: %v", err)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d: %+v", len(groups), groups)
+	}
+	if groups[0].Kind != "bracket" || len(groups[0].Files) != 3 {
+		t.Errorf("Expected a bracket of 3 photos, got %s of %d", groups[0].Kind, len(groups[0].Files))
+	}
+	if groups[1].Kind != "single" {
+		t.Errorf("Expected the last photo to be single, got %s", groups[1].Kind)
+	}
+}
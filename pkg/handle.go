@@ -0,0 +1,203 @@
+package processor
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"io"
+)
+
+// ImageHandle is an image for quick scripts: operations are chained on it
+// and the result is encoded once, when it is saved.
+//
+//	h, _ := processor.Open("in.jpg")
+//	err := h.Resize(800, 600).Rotate(15).Save("out.png")
+//
+// The methods adding operations return the handle and never fail: the
+// operations run when the image is needed, by Image, Save or Encode, and
+// the first error, from Open or an operation, is returned from there. Once
+// an operation has failed the ones after it are skipped.
+//
+// A handle is not safe for concurrent use.
+type ImageHandle struct {
+	img image.Image
+	err error
+	// pending are the operations not run yet
+	pending *Pipeline
+	quality int
+	proc    *Processor
+}
+
+// Open decodes the image at path into a handle, with the default Processor.
+// The error is also kept in the handle and returned by Save, so it may be
+// ignored when chaining.
+func Open(path string) (*ImageHandle, error) {
+	return defaultProcessor.Open(path)
+}
+
+// Open is the package function Open with the configuration and logger of p
+func (p *Processor) Open(path string) (*ImageHandle, error) {
+	h := p.NewImageHandle(nil)
+	h.img, h.err = p.loadImage(path)
+	return h, h.err
+}
+
+// NewImageHandle returns a handle on an image already in memory, saved with
+// the default Processor
+func NewImageHandle(img image.Image) *ImageHandle {
+	return defaultProcessor.NewImageHandle(img)
+}
+
+// NewImageHandle returns a handle on img, saved with the configuration and
+// logger of p
+func (p *Processor) NewImageHandle(img image.Image) *ImageHandle {
+	return &ImageHandle{img: img, pending: p.NewPipeline(), proc: p}
+}
+
+// Then adds an operation running fn, described by desc in errors
+func (h *ImageHandle) Then(desc string, fn func(img image.Image) (image.Image, error)) *ImageHandle {
+	h.pending.Then(desc, fn)
+	return h
+}
+
+// Resize resizes the image, see Resize
+func (h *ImageHandle) Resize(width, height uint) *ImageHandle {
+	h.pending.Resize(width, height)
+	return h
+}
+
+// Rotate rotates the image by angle degrees, see Rotate
+func (h *ImageHandle) Rotate(angle float64) *ImageHandle {
+	h.pending.Rotate(angle)
+	return h
+}
+
+// AutoRotate straightens the image, see AutoRotate
+func (h *ImageHandle) AutoRotate() *ImageHandle {
+	h.pending.AutoRotate()
+	return h
+}
+
+// Transform applies geometric operations in one pass, see Transform
+func (h *ImageHandle) Transform(ops ...Op) *ImageHandle {
+	h.pending.Transform(ops...)
+	return h
+}
+
+// Crop cuts rect out of the image, see Crop
+func (h *ImageHandle) Crop(rect image.Rectangle) *ImageHandle {
+	h.pending.Crop(rect)
+	return h
+}
+
+// CropGravity cuts a width x height rectangle placed by the gravity out of
+// the image, see CropGravity
+func (h *ImageHandle) CropGravity(g Gravity, width, height int) *ImageHandle {
+	h.pending.CropGravity(g, width, height)
+	return h
+}
+
+// Denoise removes noise from the image, see Denoise
+func (h *ImageHandle) Denoise() *ImageHandle {
+	h.pending.Denoise()
+	return h
+}
+
+// Binarize turns the image black and white, see Binarize
+func (h *ImageHandle) Binarize() *ImageHandle {
+	h.pending.Binarize()
+	return h
+}
+
+// Edges detects the edges of the image, see Edges
+func (h *ImageHandle) Edges() *ImageHandle {
+	h.pending.Edges()
+	return h
+}
+
+// Apply runs the steps of p on the image
+func (h *ImageHandle) Apply(p *Pipeline) *ImageHandle {
+	h.pending.ThenContext("pipeline", p.ApplyContext)
+	return h
+}
+
+// Quality sets the JPEG quality of Save and Encode, 1-100. Without it the
+// configured quality is used.
+func (h *ImageHandle) Quality(quality int) *ImageHandle {
+	h.quality = quality
+	return h
+}
+
+// Err runs the pending operations and returns the first error, if any
+func (h *ImageHandle) Err() error {
+	_, err := h.Image()
+	return err
+}
+
+// Image runs the pending operations and returns the image
+func (h *ImageHandle) Image() (image.Image, error) {
+	return h.ImageContext(context.Background())
+}
+
+// ImageContext is Image stopping with ctx's error when ctx is cancelled
+func (h *ImageHandle) ImageContext(ctx context.Context) (image.Image, error) {
+	if h.err == nil && len(h.pending.steps) > 0 {
+		h.img, h.err = h.pending.ApplyContext(ctx, h.img)
+	}
+	// Operations added later run on the current image, or are skipped
+	h.pending = h.proc.NewPipeline()
+	if h.err != nil {
+		return nil, h.err
+	}
+	return h.img, nil
+}
+
+// Save runs the pending operations and writes the image to path: as PNG
+// when the path ends in .png and as JPEG otherwise. The handle stays usable,
+// so further operations can be chained and saved to another file.
+// Returns the first error of Open or the operations, or the error of
+// encoding.
+func (h *ImageHandle) Save(path string) error {
+	return h.SaveContext(context.Background(), path)
+}
+
+// SaveContext is Save stopping with ctx's error, without writing the
+// output, when ctx is cancelled
+func (h *ImageHandle) SaveContext(ctx context.Context, path string) error {
+	img, err := h.ImageContext(ctx)
+	if err != nil {
+		return err
+	}
+	h.proc.logger().Info("saving image", "output", path)
+
+	out, err := h.proc.createOutput(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if extensionFormat(path) == FormatPNG {
+		if err := png.Encode(out, img); err != nil {
+			return &ErrProcessing{Op: "encode", Err: err}
+		}
+	} else if err := encodeJPEGQuality(out, img, h.outputQuality()); err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+// Encode runs the pending operations and writes the image to w as JPEG
+func (h *ImageHandle) Encode(w io.Writer) error {
+	img, err := h.Image()
+	if err != nil {
+		return err
+	}
+	return encodeJPEGQuality(w, img, h.outputQuality())
+}
+
+// outputQuality is the JPEG quality set with Quality, or the configured one
+func (h *ImageHandle) outputQuality() int {
+	if h.quality > 0 {
+		return h.quality
+	}
+	return h.proc.Config().JpegQuality
+}
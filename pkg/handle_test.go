@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImageHandle(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	input := writeTestImage(t, testDir, "test_input.png", kernelTestImages(40, 30)["rgba"], encodePNGBuffer)
+
+	t.Run("chain", func(t *testing.T) {
+		h, err := Open(input)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		output := filepath.Join(testDir, "test_output.png")
+		if err := h.Resize(20, 15).Rotate(90).Binarize().Save(output); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatalf("Failed to read the output: %v", err)
+		}
+		if !bytes.HasPrefix(data, []byte("\x89PNG")) {
+			t.Error("Expected a PNG for a .png output")
+		}
+		want := image.Rect(0, 0, 15, 20)
+		if got := decodeTestFile(t, output).Bounds(); got != want {
+			t.Errorf("Expected a %v image, got %v", want, got)
+		}
+
+		// The handle goes on from the saved image
+		jpegOutput := filepath.Join(testDir, "test_output.jpg")
+		if err := h.Edges().Quality(80).Save(jpegOutput); err != nil {
+			t.Fatalf("Second Save failed: %v", err)
+		}
+		if got := decodeTestFile(t, jpegOutput).Bounds(); got != want {
+			t.Errorf("Expected a %v image, got %v", want, got)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		h, err := Open(filepath.Join(testDir, "missing.jpg"))
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound from Open, got %v", err)
+		}
+		output := filepath.Join(testDir, "test_output_missing.jpg")
+		if err := h.Resize(10, 10).Save(output); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected the error of Open from Save, got %v", err)
+		}
+		if _, err := os.Stat(output); err == nil {
+			t.Error("Expected no output after an error")
+		}
+
+		calls := 0
+		h = NewImageHandle(kernelTestImages(8, 8)["gray"]).
+			Then("fail", func(image.Image) (image.Image, error) { return nil, errors.New("boom") }).
+			Then("count", func(img image.Image) (image.Image, error) { calls++; return img, nil })
+		if err := h.Encode(&bytes.Buffer{}); err == nil {
+			t.Error("Expected the error of the failed operation")
+		}
+		h.Then("count", func(img image.Image) (image.Image, error) { calls++; return img, nil })
+		if err := h.Err(); err == nil || calls != 0 {
+			t.Errorf("Expected the error to stay and later operations to be skipped, got %v after %d calls", err, calls)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// Health reports the state of a long-running process, such as a worker, to
+// load balancers and orchestrators: /healthz answers as long as the process
+// runs, and /readyz only while it takes new work. The zero value is alive but
+// not ready.
+type Health struct {
+	ready    atomic.Bool
+	draining atomic.Bool
+	inFlight atomic.Int64
+	// memory and memoryPeak are the bytes charged to the memory accounts of
+	// the requests in progress, now and at most
+	memory     atomic.Int64
+	memoryPeak atomic.Int64
+}
+
+// HealthStatus is the body of the health endpoints
+type HealthStatus struct {
+	// Status is "ok" for /healthz, and "ready", "starting" or "draining" for /readyz
+	Status   string `json:"status"`
+	InFlight int64  `json:"in_flight"`
+	// MemoryInUse and MemoryPeak are the bytes of images held by the requests
+	// in progress and the most they have held at once, as counted by their
+	// MemoryAccount
+	MemoryInUse int64 `json:"memory_in_use"`
+	MemoryPeak  int64 `json:"memory_peak"`
+}
+
+// SetReady marks the process as ready to take work, or not
+func (h *Health) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// Drain marks the process as shutting down: it finishes the work in progress
+// but takes no more, and /readyz fails so traffic is routed elsewhere
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Ready reports whether the process takes new work
+func (h *Health) Ready() bool {
+	return h.ready.Load() && !h.draining.Load()
+}
+
+// addMemory records n bytes charged, or released when negative, by a request
+func (h *Health) addMemory(n int64) {
+	inUse := h.memory.Add(n)
+	for peak := h.memoryPeak.Load(); inUse > peak; peak = h.memoryPeak.Load() {
+		if h.memoryPeak.CompareAndSwap(peak, inUse) {
+			break
+		}
+	}
+}
+
+// Handler serves /healthz and /readyz
+func (h *Health) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		h.write(w, http.StatusOK, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case h.draining.Load():
+			h.write(w, http.StatusServiceUnavailable, "draining")
+		case !h.ready.Load():
+			h.write(w, http.StatusServiceUnavailable, "starting")
+		default:
+			h.write(w, http.StatusOK, "ready")
+		}
+	})
+	return mux
+}
+
+// write sends a status as JSON
+func (h *Health) write(w http.ResponseWriter, code int, status string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(HealthStatus{
+		Status:      status,
+		InFlight:    h.inFlight.Load(),
+		MemoryInUse: h.memory.Load(),
+		MemoryPeak:  h.memoryPeak.Load(),
+	})
+}
@@ -0,0 +1,33 @@
+package processor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	health := &Health{}
+	handler := health.Handler()
+	check := func(path string, wantCode int, wantStatus string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var status HealthStatus
+		if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+			t.Fatalf("Failed to decode %s: %v", path, err)
+		}
+		if rec.Code != wantCode || status.Status != wantStatus {
+			t.Errorf("%s: expected %d %s, got %d %s", path, wantCode, wantStatus, rec.Code, status.Status)
+		}
+	}
+
+	check("/healthz", http.StatusOK, "ok")
+	check("/readyz", http.StatusServiceUnavailable, "starting")
+	health.SetReady(true)
+	check("/readyz", http.StatusOK, "ready")
+	health.Drain()
+	check("/readyz", http.StatusServiceUnavailable, "draining")
+	check("/healthz", http.StatusOK, "ok")
+}
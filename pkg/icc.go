@@ -0,0 +1,226 @@
+package processor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// errUnsupportedProfile is returned for ICC profiles whose conversion to
+// sRGB is not implemented; their images fall back to the uncalibrated
+// conversion
+var errUnsupportedProfile = errors.New("unsupported ICC profile")
+
+// iccCMYK converts CMYK colors to sRGB through the lookup table of a CMYK
+// ICC profile: input curves, a multidimensional table interpolated between
+// its grid points and output curves give a color in the profile connection
+// space, Lab or XYZ relative to D50, which is adapted to D65 and encoded as
+// sRGB. It supports the lut8 and lut16 tables of version 2 profiles, which
+// print profiles such as SWOP, GRACoL and FOGRA are written with.
+type iccCMYK struct {
+	// grid is the number of grid points along each input
+	grid int
+	// inputs maps every 8-bit input sample to its position in the grid
+	inputs [4][256]float64
+	// table holds the 3 outputs of every grid point, from 0 to 1, with the
+	// last input varying fastest
+	table []float64
+	// outputs are the output curves, sampled evenly from 0 to 1
+	outputs [3][]float64
+	// lab is set when the connection space is Lab rather than XYZ
+	lab bool
+	// lut8 is set for 8-bit tables, whose Lab encoding differs
+	lut8 bool
+}
+
+// parseICCCMYK reads the perceptual (A2B0) table of a CMYK profile, or the
+// colorimetric one (A2B1) when there is none
+func parseICCCMYK(profile []byte) (*iccCMYK, error) {
+	if len(profile) < 132 {
+		return nil, fmt.Errorf("%w: truncated header", errUnsupportedProfile)
+	}
+	if space := string(profile[16:20]); space != "CMYK" {
+		return nil, fmt.Errorf("%w: color space %q", errUnsupportedProfile, space)
+	}
+	pcs := string(profile[20:24])
+	if pcs != "Lab " && pcs != "XYZ " {
+		return nil, fmt.Errorf("%w: connection space %q", errUnsupportedProfile, pcs)
+	}
+
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < count && 132+12*(i+1) <= len(profile); i++ {
+		entry := profile[132+12*i:]
+		offset, size := binary.BigEndian.Uint32(entry[4:]), binary.BigEndian.Uint32(entry[8:])
+		if uint64(offset)+uint64(size) <= uint64(len(profile)) {
+			tags[string(entry[:4])] = profile[offset : offset+size]
+		}
+	}
+	lut, ok := tags["A2B0"]
+	if !ok {
+		if lut, ok = tags["A2B1"]; !ok {
+			return nil, fmt.Errorf("%w: no A2B table", errUnsupportedProfile)
+		}
+	}
+	t, err := parseICCLut(lut)
+	if err != nil {
+		return nil, err
+	}
+	t.lab = pcs == "Lab "
+	return t, nil
+}
+
+// parseICCLut reads an mft1 (lut8) or mft2 (lut16) table from 4 inputs to 3
+// outputs
+func parseICCLut(lut []byte) (*iccCMYK, error) {
+	if len(lut) < 48 {
+		return nil, fmt.Errorf("%w: truncated table", errUnsupportedProfile)
+	}
+	kind := string(lut[:4])
+	if kind != "mft1" && kind != "mft2" {
+		return nil, fmt.Errorf("%w: table type %q", errUnsupportedProfile, kind)
+	}
+	if lut[8] != 4 || lut[9] != 3 || lut[10] < 2 {
+		return nil, fmt.Errorf("%w: %d inputs, %d outputs and %d grid points", errUnsupportedProfile, lut[8], lut[9], lut[10])
+	}
+	t := &iccCMYK{grid: int(lut[10]), lut8: kind == "mft1"}
+
+	// The samples of an mft1 are bytes and its curves have 256 entries; an
+	// mft2 gives the number of entries of its curves
+	sample, inEntries, outEntries, pos := 1, 256, 256, 48
+	if !t.lut8 {
+		if len(lut) < 52 {
+			return nil, fmt.Errorf("%w: truncated table", errUnsupportedProfile)
+		}
+		sample, pos = 2, 52
+		inEntries, outEntries = int(binary.BigEndian.Uint16(lut[48:])), int(binary.BigEndian.Uint16(lut[50:]))
+		if inEntries < 2 || outEntries < 2 {
+			return nil, fmt.Errorf("%w: curves of %d and %d entries", errUnsupportedProfile, inEntries, outEntries)
+		}
+	}
+	points := t.grid * t.grid * t.grid * t.grid
+	if len(lut) < pos+sample*(4*inEntries+3*points+3*outEntries) {
+		return nil, fmt.Errorf("%w: truncated table", errUnsupportedProfile)
+	}
+	read := func(n int) []float64 {
+		values := make([]float64, n)
+		for i := range values {
+			if sample == 1 {
+				values[i] = float64(lut[pos+i]) / 0xff
+			} else {
+				values[i] = float64(binary.BigEndian.Uint16(lut[pos+2*i:])) / 0xffff
+			}
+		}
+		pos += sample * n
+		return values
+	}
+
+	for c := range t.inputs {
+		curve := read(inEntries)
+		for v := range t.inputs[c] {
+			t.inputs[c][v] = sampleCurve(curve, float64(v)/0xff) * float64(t.grid-1)
+		}
+	}
+	t.table = read(3 * points)
+	for c := range t.outputs {
+		t.outputs[c] = read(outEntries)
+	}
+	return t, nil
+}
+
+// sampleCurve interpolates a curve sampled evenly from 0 to 1 at x
+func sampleCurve(curve []float64, x float64) float64 {
+	pos := min(max(x, 0), 1) * float64(len(curve)-1)
+	i := min(int(pos), len(curve)-2)
+	f := pos - float64(i)
+	return curve[i]*(1-f) + curve[i+1]*f
+}
+
+// rgb converts a CMYK color, with 0 for no ink, to 8-bit sRGB
+func (t *iccCMYK) rgb(c, m, y, k uint8) (uint8, uint8, uint8) {
+	// The grid cell holding the color and the position in it along each input
+	var base [4]int
+	var frac [4]float64
+	for i, v := range [4]uint8{c, m, y, k} {
+		pos := t.inputs[i][v]
+		base[i] = min(int(pos), t.grid-2)
+		frac[i] = pos - float64(base[i])
+	}
+
+	// Interpolate linearly along the four inputs between the 16 corners
+	var out [3]float64
+	for corner := range 16 {
+		weight := 1.0
+		index := 0
+		for i := range 4 {
+			g := base[i]
+			if corner>>(3-i)&1 == 1 {
+				g++
+				weight *= frac[i]
+			} else {
+				weight *= 1 - frac[i]
+			}
+			index = index*t.grid + g
+		}
+		if weight == 0 {
+			continue
+		}
+		for j := range out {
+			out[j] += weight * t.table[3*index+j]
+		}
+	}
+	for j := range out {
+		out[j] = sampleCurve(t.outputs[j], out[j])
+	}
+
+	var x, yy, z float64
+	if t.lab {
+		var l, a, b float64
+		if t.lut8 {
+			l, a, b = out[0]*100, out[1]*255-128, out[2]*255-128
+		} else {
+			// The version 2 encoding, where 0xff00 is 100 and 0x8000 is 0
+			l, a, b = out[0]*0xffff/0xff00*100, out[1]*0xffff/0x100-128, out[2]*0xffff/0x100-128
+		}
+		x, yy, z = labToXYZ(l, a, b)
+	} else {
+		// 0x8000 is 1.0
+		x, yy, z = out[0]*0xffff/0x8000, out[1]*0xffff/0x8000, out[2]*0xffff/0x8000
+	}
+	return xyzD50ToSRGB(x, yy, z)
+}
+
+// labToXYZ converts CIELAB relative to the D50 white point of the profile
+// connection space to XYZ
+func labToXYZ(l, a, b float64) (float64, float64, float64) {
+	finv := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+	}
+	fy := (l + 16) / 116
+	return 0.9642 * finv(fy+a/500), finv(fy), 0.8249 * finv(fy-b/200)
+}
+
+// xyzD50ToSRGB converts XYZ relative to D50 to 8-bit sRGB, adapting the
+// white point to D65 with the Bradford transform
+func xyzD50ToSRGB(x, y, z float64) (uint8, uint8, uint8) {
+	r := 3.1338561*x - 1.6168667*y - 0.4906146*z
+	g := -0.9787684*x + 1.9161415*y + 0.0334540*z
+	b := 0.0719453*x - 0.2289914*y + 1.4052427*z
+	return srgbEncode(r), srgbEncode(g), srgbEncode(b)
+}
+
+// srgbEncode applies the sRGB transfer function to a linear component and
+// scales it to 8 bits
+func srgbEncode(v float64) uint8 {
+	v = min(max(v, 0), 1)
+	if v <= 0.0031308 {
+		v *= 12.92
+	} else {
+		v = 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	return uint8(v*0xff + 0.5)
+}
@@ -0,0 +1,342 @@
+package processor
+
+import (
+	"container/heap"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"math"
+)
+
+// defaultInpaintRadius is the radius of the neighborhood a filled pixel is
+// taken from
+const defaultInpaintRadius = 5
+
+// inpaintMinChroma is the spread between the strongest and the weakest
+// channel from which InpaintOptions.Detect takes a pixel for colored ink:
+// paper and black or gray print stay well below it, red stamps and blue pen
+// well above
+const inpaintMinChroma = 80
+
+// InpaintOptions selects the parts of the image Inpaint fills in. The
+// regions, the mask and the detected marks add up; at least one of them
+// must select something for the image to change.
+type InpaintOptions struct {
+	// Regions are the rectangles to fill, from the top left corner of the
+	// image
+	Regions []Box
+	// Mask is an image of the size of the input whose light pixels, gray
+	// level 128 and above, are filled
+	Mask image.Image
+	// Detect adds the strongly colored marks, such as red stamps and blue
+	// handwriting on a black and white document, with a pixel of margin
+	Detect bool
+	// Radius is the radius in pixels of the neighborhood every filled pixel
+	// is taken from; zero is defaultInpaintRadius
+	Radius int
+}
+
+// InpaintResult describes what Inpaint filled
+type InpaintResult struct {
+	// Pixels is the number of pixels filled
+	Pixels int `json:"pixels"`
+	// Coverage is the fraction of the image filled
+	Coverage float64 `json:"coverage"`
+}
+
+// InpaintImage fills parts of the input image from their surroundings, as
+// Inpaint.
+// It takes the paths of the input and output files and the options.
+// Returns what was filled, or an error if the operation fails.
+func InpaintImage(inputPath string, outputPath string, opts InpaintOptions) (*InpaintResult, error) {
+	slog.Info("inpainting image",
+		"input", inputPath,
+		"output", outputPath,
+		"regions", len(opts.Regions),
+		"mask", opts.Mask != nil,
+		"detect", opts.Detect)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	out, result, err := Inpaint(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveJPEG(outputPath, out); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// InpaintImageReader fills parts of the image read from r and writes it to w
+// as JPEG, like InpaintImage.
+// Returns what was filled, or an error if the operation fails.
+func InpaintImageReader(r io.Reader, w io.Writer, opts InpaintOptions) (*InpaintResult, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	out, result, err := Inpaint(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := encodeJPEG(w, out); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Inpaint returns a copy of the image with the parts selected by opts filled
+// in from the content around them, to remove stamps, handwriting, staples or
+// personal data from scanned documents without leaving a black box behind.
+// The pixels are filled from the edge of every part inwards, in the manner
+// of Telea's fast marching method: each one is a weighted average of the
+// pixels already known within the radius, favoring the close ones and those
+// along the direction the fill advances, so lines and gradients running into
+// a part continue across it. Grays stay gray.
+// Returns the filled image and what was filled, or an error if an option is
+// invalid or nothing is left to fill from.
+func Inpaint(img image.Image, opts InpaintOptions) (image.Image, *InpaintResult, error) {
+	radius := opts.Radius
+	if radius == 0 {
+		radius = defaultInpaintRadius
+	}
+	if radius < 1 {
+		return nil, nil, &ErrProcessing{Op: "inpaint", Err: fmt.Errorf("radius must be positive, got %d", radius)}
+	}
+
+	rgba := toRGBA(img)
+	mask, err := inpaintMask(rgba, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	count := 0
+	for _, m := range mask {
+		if m {
+			count++
+		}
+	}
+	size := rgba.Bounds().Size()
+	if count == size.X*size.Y && count > 0 {
+		return nil, nil, &ErrProcessing{Op: "inpaint", Err: fmt.Errorf("the regions cover the whole image, leaving nothing to fill them from")}
+	}
+	if count > 0 {
+		fillMarching(rgba, mask, radius)
+	}
+
+	result := &InpaintResult{Pixels: count}
+	if size.X*size.Y > 0 {
+		result.Coverage = float64(count) / float64(size.X*size.Y)
+	}
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		return toGray(rgba), result, nil
+	}
+	return rgba, result, nil
+}
+
+// inpaintMask returns the pixels of rgba selected by opts
+func inpaintMask(rgba *image.RGBA, opts InpaintOptions) ([]bool, error) {
+	bounds := rgba.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	mask := make([]bool, w*h)
+
+	for _, region := range opts.Regions {
+		r := region.Rect().Intersect(bounds)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				mask[y*w+x] = true
+			}
+		}
+	}
+
+	if opts.Mask != nil {
+		gray := toGray(opts.Mask)
+		if gray.Bounds().Size() != bounds.Size() {
+			return nil, &ErrProcessing{Op: "inpaint", Err: fmt.Errorf("the %dx%d mask does not match the %dx%d image",
+				gray.Bounds().Dx(), gray.Bounds().Dy(), w, h)}
+		}
+		for y := 0; y < h; y++ {
+			row := gray.Pix[y*gray.Stride : y*gray.Stride+w]
+			for x, v := range row {
+				if v >= 128 {
+					mask[y*w+x] = true
+				}
+			}
+		}
+	}
+
+	if opts.Detect {
+		marks := make([]bool, w*h)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				i := rgba.PixOffset(x, y)
+				r, g, b := int(rgba.Pix[i]), int(rgba.Pix[i+1]), int(rgba.Pix[i+2])
+				if max(r, g, b)-min(r, g, b) >= inpaintMinChroma {
+					marks[y*w+x] = true
+				}
+			}
+		}
+		// The antialiased rims of the marks are less colored than their
+		// middle but would leave a halo
+		for i, m := range dilateMask(marks, w, h) {
+			if m {
+				mask[i] = true
+			}
+		}
+	}
+	return mask, nil
+}
+
+// fillMarching fills the pixels of rgba in mask from the outside in, in the
+// order of their distance to the known pixels
+func fillMarching(rgba *image.RGBA, mask []bool, radius int) {
+	bounds := rgba.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dist := make([]float64, w*h)
+	done := make([]bool, w*h)
+	queue := &marchQueue{}
+
+	// Known pixels are at distance zero; those touching the mask start the
+	// march
+	for i, m := range mask {
+		if m {
+			dist[i] = math.Inf(1)
+			continue
+		}
+		done[i] = true
+		x, y := i%w, i/w
+		for _, d := range neighbors8 {
+			nx, ny := x+d.X, y+d.Y
+			if nx >= 0 && ny >= 0 && nx < w && ny < h && mask[ny*w+nx] {
+				heap.Push(queue, marchItem{index: i})
+				break
+			}
+		}
+	}
+
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(marchItem)
+		i := item.index
+		if mask[i] {
+			if done[i] {
+				continue
+			}
+			done[i] = true
+			fillPixel(rgba, dist, done, i, radius)
+		}
+		x, y := i%w, i/w
+		for _, d := range neighbors8 {
+			nx, ny := x+d.X, y+d.Y
+			if nx < 0 || ny < 0 || nx >= w || ny >= h {
+				continue
+			}
+			n := ny*w + nx
+			if done[n] {
+				continue
+			}
+			step := 1.0
+			if d.X != 0 && d.Y != 0 {
+				step = math.Sqrt2
+			}
+			if t := dist[i] + step; t < dist[n] {
+				dist[n] = t
+				heap.Push(queue, marchItem{index: n, dist: t})
+			}
+		}
+	}
+}
+
+// fillPixel sets pixel i of rgba to the weighted average of the known pixels
+// within the radius: closer ones, those nearer the edge of the region and
+// those along the gradient of the distance weigh more
+func fillPixel(rgba *image.RGBA, dist []float64, done []bool, i, radius int) {
+	bounds := rgba.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	x, y := i%w, i/w
+
+	// The direction the fill advances in, from the distances around the pixel
+	gradient := func(a, b int, ok func(int) bool) float64 {
+		switch {
+		case ok(a) && ok(b):
+			return (dist[b] - dist[a]) / 2
+		case ok(b):
+			return dist[b] - dist[i]
+		case ok(a):
+			return dist[i] - dist[a]
+		}
+		return 0
+	}
+	finite := func(n int) bool { return n >= 0 && !math.IsInf(dist[n], 1) }
+	gx := gradient(indexIf(x > 0, i-1), indexIf(x < w-1, i+1), finite)
+	gy := gradient(indexIf(y > 0, i-w), indexIf(y < h-1, i+w), finite)
+	if norm := math.Hypot(gx, gy); norm > 0 {
+		gx, gy = gx/norm, gy/norm
+	}
+
+	var sums [4]float64
+	var total float64
+	for qy := max(y-radius, 0); qy <= min(y+radius, h-1); qy++ {
+		for qx := max(x-radius, 0); qx <= min(x+radius, w-1); qx++ {
+			q := qy*w + qx
+			if q == i || !done[q] {
+				continue
+			}
+			rx, ry := float64(x-qx), float64(y-qy)
+			d2 := rx*rx + ry*ry
+			if d2 > float64(radius*radius) {
+				continue
+			}
+			length := math.Sqrt(d2)
+			direction := math.Abs(rx*gx+ry*gy)/length + 1e-6
+			level := 1 / (1 + math.Abs(dist[q]-dist[i]))
+			weight := direction * level / d2
+			o := rgba.PixOffset(qx, qy)
+			for c := range sums {
+				sums[c] += weight * float64(rgba.Pix[o+c])
+			}
+			total += weight
+		}
+	}
+	if total == 0 {
+		return
+	}
+	o := rgba.PixOffset(x, y)
+	for c := range sums {
+		rgba.Pix[o+c] = uint8(min(max(math.Round(sums[c]/total), 0), 255))
+	}
+}
+
+// indexIf returns i when ok and -1 otherwise
+func indexIf(ok bool, i int) int {
+	if ok {
+		return i
+	}
+	return -1
+}
+
+// neighbors8 are the offsets of the eight neighbors of a pixel
+var neighbors8 = [8]image.Point{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}}
+
+// marchItem is a pixel waiting in the fast march with its tentative distance
+type marchItem struct {
+	index int
+	dist  float64
+}
+
+// marchQueue is a min-heap of pixels by distance, for container/heap
+type marchQueue []marchItem
+
+func (q marchQueue) Len() int           { return len(q) }
+func (q marchQueue) Less(i, j int) bool { return q[i].dist < q[j].dist }
+func (q marchQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *marchQueue) Push(x any)        { *q = append(*q, x.(marchItem)) }
+func (q *marchQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,93 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInpaint(t *testing.T) {
+	// A smooth page with a red stamp in the middle
+	page := image.NewRGBA(image.Rect(0, 0, 80, 60))
+	stamp := image.Rect(30, 20, 50, 40)
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 80; x++ {
+			c := color.RGBA{uint8(150 + x), uint8(150 + y), 180, 0xff}
+			if (image.Point{x, y}).In(stamp) {
+				c = color.RGBA{210, 30, 40, 0xff}
+			}
+			page.SetRGBA(x, y, c)
+		}
+	}
+	meanError := func(t *testing.T, img image.Image) float64 {
+		t.Helper()
+		var sum float64
+		for y := stamp.Min.Y; y < stamp.Max.Y; y++ {
+			for x := stamp.Min.X; x < stamp.Max.X; x++ {
+				r, g, _, _ := img.At(x, y).RGBA()
+				sum += float64(absDiff(uint8(r>>8), uint8(150+x))) + float64(absDiff(uint8(g>>8), uint8(150+y)))
+			}
+		}
+		return sum / float64(2*stamp.Dx()*stamp.Dy())
+	}
+
+	mask := image.NewGray(page.Bounds())
+	for y := stamp.Min.Y; y < stamp.Max.Y; y++ {
+		for x := stamp.Min.X; x < stamp.Max.X; x++ {
+			mask.SetGray(x, y, color.Gray{0xff})
+		}
+	}
+	for name, opts := range map[string]InpaintOptions{
+		"region": {Regions: []Box{{X: 30, Y: 20, Width: 20, Height: 20}}},
+		"mask":   {Mask: mask},
+		"detect": {Detect: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			filled, result, err := Inpaint(page, opts)
+			if err != nil {
+				t.Fatalf("Inpaint failed: %v", err)
+			}
+			if result.Pixels < 400 || result.Pixels > 22*22 {
+				t.Errorf("Expected the 400 pixels of the stamp to be filled, got %d", result.Pixels)
+			}
+			if e := meanError(t, filled); e > 6 {
+				t.Errorf("Expected the stamp to be filled with the gradient around it, mean error %.1f", e)
+			}
+			if page.RGBAAt(40, 30).R != 210 {
+				t.Error("Expected the input to be left untouched")
+			}
+		})
+	}
+
+	// Grays stay gray, nothing selected leaves the image as it is
+	gray, result, err := Inpaint(toGray(page), InpaintOptions{Detect: true})
+	if err != nil {
+		t.Fatalf("Inpaint failed on a gray image: %v", err)
+	}
+	if _, ok := gray.(*image.Gray); !ok || result.Pixels != 0 {
+		t.Errorf("Expected a gray image with nothing colored to fill, got %T and %d pixels", gray, result.Pixels)
+	}
+
+	for name, opts := range map[string]InpaintOptions{
+		"radius":     {Radius: -1},
+		"mask size":  {Mask: image.NewGray(image.Rect(0, 0, 10, 10))},
+		"everything": {Regions: []Box{{Width: 80, Height: 60}}},
+	} {
+		if _, _, err := Inpaint(page, opts); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	input := writeTestImage(t, testDir, "test_input.png", page, encodePNGBuffer)
+	output := filepath.Join(testDir, "test_output.jpg")
+	if _, err := InpaintImage(input, output, InpaintOptions{Detect: true}); err != nil {
+		t.Fatalf("InpaintImage failed: %v", err)
+	}
+	if r, g, b, _ := decodeTestFile(t, output).At(40, 30).RGBA(); r>>8 < 170 || g>>8 < 160 || b>>8 < 160 {
+		t.Errorf("Expected the stamp to be gone, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+}
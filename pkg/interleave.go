@@ -0,0 +1,148 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// InterleaveOptions controls InterleaveScans
+type InterleaveOptions struct {
+	// BackInOrder takes the back sides as running from the first sheet to the
+	// last (2, 4, 6). By default they run from the last sheet to the first
+	// (6, 4, 2), as a simplex scanner returns them when the stack is turned
+	// over and fed again.
+	BackInOrder bool
+	// RotateBack turns the back sides by 180 degrees, for stacks turned over
+	// along their short edge, whose back sides come out upside down
+	RotateBack bool
+	// DryRun only works out the page order without writing anything
+	DryRun bool
+}
+
+// InterleavedPage is a page of a document put together by InterleaveScans
+type InterleavedPage struct {
+	// Page is the page number, from 1
+	Page int `json:"page"`
+	// Side is "front" or "back"
+	Side   string `json:"side"`
+	Source string `json:"source"`
+	Output string `json:"output,omitempty"`
+	// Rotated is true when the page was turned by RotateBack
+	Rotated bool `json:"rotated,omitempty"`
+}
+
+// InterleavePages puts the front and back sides of a duplex scan into page
+// order: front 1, back 1, front 2, back 2 and so on. The back sides are taken
+// in reverse unless backInOrder is set. There must be one back side per
+// sheet, or one fewer when the back of the last sheet was left out, so a
+// missing or extra scan is reported instead of shifting every following page
+// onto the wrong sheet.
+// Returns an error if the numbers of sides do not match.
+func InterleavePages(fronts, backs []string, backInOrder bool) ([]InterleavedPage, error) {
+	if len(fronts) == 0 || (len(backs) != len(fronts) && len(backs) != len(fronts)-1) {
+		return nil, &ErrProcessing{Op: "interleave", Err: fmt.Errorf("%d front sides need %d or %d back sides, got %d",
+			len(fronts), len(fronts), max(len(fronts)-1, 0), len(backs))}
+	}
+	pages := make([]InterleavedPage, 0, len(fronts)+len(backs))
+	for i, front := range fronts {
+		pages = append(pages, InterleavedPage{Page: len(pages) + 1, Side: "front", Source: front})
+		if i == len(backs) {
+			continue
+		}
+		back := backs[i]
+		if !backInOrder {
+			back = backs[len(backs)-1-i]
+		}
+		pages = append(pages, InterleavedPage{Page: len(pages) + 1, Side: "back", Source: back})
+	}
+	return pages, nil
+}
+
+// InterleaveScans puts the front and back sides of a duplex scan into page
+// order like InterleavePages and writes the pages to outputDir as page-001,
+// page-002 and so on, with the extensions of their sources, ready to be
+// processed or assembled in order. Pages are copied as they are, except back
+// sides turned by RotateBack, which are re-encoded in their own format with
+// their resolution kept.
+// Returns the pages in order, or an error if the numbers of sides do not
+// match or the operation fails.
+func InterleaveScans(fronts, backs []string, outputDir string, opts InterleaveOptions) ([]InterleavedPage, error) {
+	return defaultProcessor.InterleaveScans(fronts, backs, outputDir, opts)
+}
+
+// InterleaveScans is the package function InterleaveScans with the configuration and logger of p
+func (p *Processor) InterleaveScans(fronts, backs []string, outputDir string, opts InterleaveOptions) ([]InterleavedPage, error) {
+	p.logger().Info("interleaving duplex scan",
+		"fronts", len(fronts),
+		"backs", len(backs),
+		"back_in_order", opts.BackInOrder,
+		"rotate_back", opts.RotateBack)
+
+	pages, err := InterleavePages(fronts, backs, opts.BackInOrder)
+	if err != nil {
+		return nil, err
+	}
+	digits := max(3, len(strconv.Itoa(len(pages))))
+	for i := range pages {
+		page := &pages[i]
+		page.Output = filepath.Join(outputDir, fmt.Sprintf("page-%0*d%s", digits, page.Page, strings.ToLower(filepath.Ext(page.Source))))
+		page.Rotated = opts.RotateBack && page.Side == "back"
+	}
+	if opts.DryRun {
+		return pages, nil
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, &ErrInvalidOutput{Path: outputDir, Err: err}
+	}
+	for _, page := range pages {
+		if page.Rotated {
+			err = p.saveTurned(page.Source, page.Output)
+		} else {
+			err = p.copyFile(page.Source, page.Output)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+// saveTurned saves the image at inputPath turned by 180 degrees to
+// outputPath, as PNG when its extension is .png and as JPEG otherwise. The
+// EXIF orientation is applied first, since the encoders drop the tag.
+func (p *Processor) saveTurned(inputPath, outputPath string) error {
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	if info, err := readExif(inputPath); err == nil && info.Orientation > 1 {
+		img = applyOrientation(img, info.Orientation)
+	}
+	turned := applyOrientation(img, 3)
+	dpi := readDPI(inputPath)
+	if extensionFormat(outputPath) != FormatPNG {
+		return p.saveJPEGWithDPI(outputPath, turned, dpi, p.Config().JpegQuality)
+	}
+
+	out, err := p.createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	rgba := turned.(*image.RGBA)
+	hdr := pngHeader{width: rgba.Rect.Dx(), height: rgba.Rect.Dy(), colorType: pngColorRGBA, bitDepth: 8, dpi: dpi}
+	err = encodePNG(out, hdr, func(x, y int, samples []uint16) {
+		c := color.NRGBAModel.Convert(rgba.RGBAAt(x, y)).(color.NRGBA)
+		samples[0], samples[1], samples[2], samples[3] = uint16(c.R), uint16(c.G), uint16(c.B), uint16(c.A)
+	})
+	if err != nil {
+		return &ErrProcessing{Op: "encode", Err: err}
+	}
+	return out.Commit()
+}
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInterleavePages(t *testing.T) {
+	sources := func(pages []InterleavedPage) []string {
+		var got []string
+		for _, page := range pages {
+			got = append(got, page.Source)
+		}
+		return got
+	}
+	for _, tt := range []struct {
+		name         string
+		fronts       []string
+		backs        []string
+		backInOrder  bool
+		want         []string
+		wantMismatch bool
+	}{
+		{"reversed backs", []string{"1", "3", "5"}, []string{"6", "4", "2"}, false, []string{"1", "2", "3", "4", "5", "6"}, false},
+		{"backs in order", []string{"1", "3", "5"}, []string{"2", "4", "6"}, true, []string{"1", "2", "3", "4", "5", "6"}, false},
+		{"last back left out", []string{"1", "3", "5"}, []string{"4", "2"}, false, []string{"1", "2", "3", "4", "5"}, false},
+		{"back missing", []string{"1", "3", "5"}, []string{"2"}, false, nil, true},
+		{"extra back", []string{"1"}, []string{"2", "4"}, false, nil, true},
+		{"no fronts", nil, nil, false, nil, true},
+	} {
+		pages, err := InterleavePages(tt.fronts, tt.backs, tt.backInOrder)
+		if tt.wantMismatch {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", tt.name, sources(pages))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: failed to interleave: %v", tt.name, err)
+		}
+		got := sources(pages)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+		for i := range got {
+			side := "front"
+			if i%2 == 1 {
+				side = "back"
+			}
+			if got[i] != tt.want[i] || pages[i].Page != i+1 || pages[i].Side != side {
+				t.Fatalf("%s: expected %v, got %+v", tt.name, tt.want, pages)
+			}
+		}
+	}
+}
+
+func TestInterleaveScans(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// Each side is marked by a red pixel in its top left corner
+	marked := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	marked.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	front := writeTestImage(t, testDir, "front_1.png", marked, encodePNGBuffer)
+	back := writeTestImage(t, testDir, "back_1.png", marked, encodePNGBuffer)
+	outputDir := filepath.Join(testDir, "pages")
+
+	pages, err := InterleaveScans([]string{front}, []string{back}, outputDir, InterleaveOptions{DryRun: true, RotateBack: true})
+	if err != nil {
+		t.Fatalf("Failed to plan the pages: %v", err)
+	}
+	if pages[1].Output != filepath.Join(outputDir, "page-002.png") || !pages[1].Rotated || pages[0].Rotated {
+		t.Errorf("Expected the back side as a turned page-002.png, got %+v", pages)
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Errorf("Expected a dry run to write nothing, got %v", err)
+	}
+
+	if _, err := InterleaveScans([]string{front}, []string{back}, outputDir, InterleaveOptions{RotateBack: true}); err != nil {
+		t.Fatalf("Failed to interleave: %v", err)
+	}
+	red := color.RGBA{255, 0, 0, 255}
+	for _, tt := range []struct {
+		name string
+		at   image.Point
+	}{
+		{"page-001.png", image.Pt(0, 0)},
+		{"page-002.png", image.Pt(39, 29)},
+	} {
+		img := toRGBA(decodeTestFile(t, filepath.Join(outputDir, tt.name)))
+		if got := img.RGBAAt(tt.at.X, tt.at.Y); got != red {
+			t.Errorf("%s: expected the mark at %v, got %v", tt.name, tt.at, got)
+		}
+	}
+}
@@ -0,0 +1,591 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/nfnt/resize"
+)
+
+// jpegPreviewScale is the reduction of a DC preview: one pixel per 8x8 block
+const jpegPreviewScale = 8
+
+// errPreviewUnsupported is returned for JPEG variants the DC decoder does not
+// handle, such as arithmetic coding or CMYK; callers fall back to a full decode
+var errPreviewUnsupported = errors.New("unsupported JPEG variant for DC preview")
+
+// errInvalidHuffman is returned for a Huffman table whose code counts do not
+// describe a valid prefix code
+var errInvalidHuffman = errors.New("invalid JPEG Huffman table")
+
+// jpegHuffman is a Huffman table in the canonical form of the JPEG standard
+type jpegHuffman struct {
+	// lookup maps the next 9 bits to the code length << 8 | value, or zero
+	// for codes longer than 9 bits
+	lookup  [1 << 9]uint16
+	maxCode [17]int32
+	valPtr  [17]int32
+	values  []uint8
+}
+
+// jpegPreviewComponent is a color component with the DC coefficients of its blocks
+type jpegPreviewComponent struct {
+	id       uint8
+	h, v     int
+	quant    uint8
+	dcTable  uint8
+	acTable  uint8
+	blocksW  int
+	blocksH  int
+	dc       []int32
+	pred     int32
+	complete bool
+}
+
+// jpegPreviewDecoder reads only the DC coefficients of a JPEG stream
+type jpegPreviewDecoder struct {
+	data          []byte
+	pos           int
+	bits          uint32
+	nbits         int
+	width, height int
+	hMax, vMax    int
+	progressive   bool
+	components    []*jpegPreviewComponent
+	quant         [4]uint16
+	dcTables      [4]*jpegHuffman
+	acTables      [4]*jpegHuffman
+	restart       int
+}
+
+// DecodeJPEGPreview decodes a low-resolution preview of a JPEG image, one
+// pixel per 8x8 block, from the DC coefficients alone. The inverse DCT is
+// skipped entirely and progressive images stop after their first DC scan, so
+// the preview is available long before a full decode would finish.
+// Images the fast path does not support, and other formats, are fully decoded
+// and scaled down instead.
+// It takes the reader of the encoded image.
+// Returns the preview image, or an error if the data cannot be decoded.
+func DecodeJPEGPreview(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "decode", Err: err}
+	}
+
+	d := &jpegPreviewDecoder{data: data}
+	img, err := d.decode()
+	if err == nil {
+		return img, nil
+	}
+	slog.Info("DC preview not available, decoding the full image", "reason", err)
+
+	full, err := decodeImageData(data, "")
+	if err != nil {
+		return nil, err
+	}
+	bounds := full.Bounds()
+	w := uint(max(1, (bounds.Dx()+jpegPreviewScale-1)/jpegPreviewScale))
+	h := uint(max(1, (bounds.Dy()+jpegPreviewScale-1)/jpegPreviewScale))
+	return resize.Resize(w, h, full, resize.Bilinear), nil
+}
+
+// FastPreviewImage writes a 1/8 scale preview of the input, decoded from the
+// JPEG DC coefficients when possible.
+// It takes the paths of the input and output files.
+// Returns an error if the operation fails.
+func FastPreviewImage(inputPath string, outputPath string) error {
+	slog.Info("creating fast preview", "input", inputPath)
+
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return &ErrInvalidInput{Path: inputPath, Err: err}
+	}
+	defer file.Close()
+
+	img, err := DecodeJPEGPreview(file)
+	if err != nil {
+		return err
+	}
+	return saveJPEG(outputPath, img)
+}
+
+// FastPreviewImageReader writes a 1/8 scale preview of the image read from r
+// to w as JPEG, like FastPreviewImage.
+// Returns an error if the operation fails.
+func FastPreviewImageReader(r io.Reader, w io.Writer) error {
+	img, err := DecodeJPEGPreview(r)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, img)
+}
+
+// loadPreviewSource loads the input for a preview at most width pixels wide.
+// JPEG files large enough that their DC preview still covers the width are
+// decoded at 1/8 scale; everything else is decoded in full.
+func loadPreviewSource(inputPath string, width int) (image.Image, error) {
+	data, release, err := readInput(inputPath)
+	if err != nil {
+		return nil, &ErrInvalidInput{Path: inputPath, Err: err}
+	}
+	defer release()
+	if config, err := jpeg.DecodeConfig(bytes.NewReader(data)); err == nil &&
+		(config.Width+jpegPreviewScale-1)/jpegPreviewScale >= width {
+		d := &jpegPreviewDecoder{data: data}
+		if img, err := d.decode(); err == nil {
+			return img, nil
+		}
+	}
+	return loadImage(inputPath)
+}
+
+// decode parses the markers and entropy-coded scans up to the point where
+// every component has its DC coefficients
+func (d *jpegPreviewDecoder) decode() (image.Image, error) {
+	if len(d.data) < 2 || d.data[0] != 0xff || d.data[1] != 0xd8 {
+		return nil, errPreviewUnsupported
+	}
+	d.pos = 2
+
+	for {
+		marker, err := d.nextMarker()
+		if err != nil {
+			return nil, err
+		}
+		if marker == 0xd9 {
+			break
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			continue
+		}
+		if d.pos+2 > len(d.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		length := int(d.data[d.pos])<<8 | int(d.data[d.pos+1])
+		if length < 2 || d.pos+length > len(d.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		segment := d.data[d.pos+2 : d.pos+length]
+		d.pos += length
+
+		switch marker {
+		case 0xc0, 0xc1, 0xc2:
+			d.progressive = marker == 0xc2
+			if err := d.parseFrame(segment); err != nil {
+				return nil, err
+			}
+		case 0xc3, 0xc5, 0xc6, 0xc7, 0xc9, 0xca, 0xcb, 0xcd, 0xce, 0xcf:
+			return nil, errPreviewUnsupported
+		case 0xc4:
+			if err := d.parseHuffman(segment); err != nil {
+				return nil, err
+			}
+		case 0xdb:
+			if err := d.parseQuant(segment); err != nil {
+				return nil, err
+			}
+		case 0xdd:
+			if len(segment) < 2 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			d.restart = int(segment[0])<<8 | int(segment[1])
+		case 0xda:
+			if err := d.parseScan(segment); err != nil {
+				return nil, err
+			}
+			if d.allComplete() {
+				return d.image(), nil
+			}
+		}
+	}
+	if len(d.components) == 0 || !d.allComplete() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return d.image(), nil
+}
+
+// nextMarker skips to the next marker and returns its code
+func (d *jpegPreviewDecoder) nextMarker() (byte, error) {
+	for d.pos+1 < len(d.data) {
+		if d.data[d.pos] != 0xff {
+			d.pos++
+			continue
+		}
+		marker := d.data[d.pos+1]
+		if marker == 0xff {
+			d.pos++
+			continue
+		}
+		d.pos += 2
+		if marker == 0x00 {
+			continue
+		}
+		return marker, nil
+	}
+	return 0, io.ErrUnexpectedEOF
+}
+
+func (d *jpegPreviewDecoder) parseFrame(segment []byte) error {
+	if len(segment) < 6 || segment[0] != 8 {
+		return errPreviewUnsupported
+	}
+	d.height = int(segment[1])<<8 | int(segment[2])
+	d.width = int(segment[3])<<8 | int(segment[4])
+	n := int(segment[5])
+	if d.width == 0 || d.height == 0 || (n != 1 && n != 3) || len(segment) < 6+3*n {
+		return errPreviewUnsupported
+	}
+
+	d.hMax, d.vMax = 1, 1
+	d.components = nil
+	for i := 0; i < n; i++ {
+		c := segment[6+3*i:]
+		comp := &jpegPreviewComponent{id: c[0], h: int(c[1] >> 4), v: int(c[1] & 15), quant: c[2] & 3}
+		if comp.h < 1 || comp.h > 4 || comp.v < 1 || comp.v > 4 {
+			return errPreviewUnsupported
+		}
+		d.hMax, d.vMax = max(d.hMax, comp.h), max(d.vMax, comp.v)
+		d.components = append(d.components, comp)
+	}
+	mcusX := (d.width + 8*d.hMax - 1) / (8 * d.hMax)
+	mcusY := (d.height + 8*d.vMax - 1) / (8 * d.vMax)
+	for _, comp := range d.components {
+		comp.blocksW, comp.blocksH = mcusX*comp.h, mcusY*comp.v
+		comp.dc = make([]int32, comp.blocksW*comp.blocksH)
+	}
+	return nil
+}
+
+func (d *jpegPreviewDecoder) parseQuant(segment []byte) error {
+	for len(segment) > 0 {
+		precision, id := segment[0]>>4, segment[0]&3
+		size := 64
+		if precision != 0 {
+			size = 128
+		}
+		if len(segment) < 1+size {
+			return io.ErrUnexpectedEOF
+		}
+		if precision == 0 {
+			d.quant[id] = uint16(segment[1])
+		} else {
+			d.quant[id] = uint16(segment[1])<<8 | uint16(segment[2])
+		}
+		segment = segment[1+size:]
+	}
+	return nil
+}
+
+func (d *jpegPreviewDecoder) parseHuffman(segment []byte) error {
+	for len(segment) > 0 {
+		if len(segment) < 17 {
+			return io.ErrUnexpectedEOF
+		}
+		class, id := segment[0]>>4, segment[0]&3
+		var counts [16]int
+		total := 0
+		for i := range counts {
+			counts[i] = int(segment[1+i])
+			total += counts[i]
+		}
+		if len(segment) < 17+total {
+			return io.ErrUnexpectedEOF
+		}
+		table, err := newJPEGHuffman(counts, segment[17:17+total])
+		if err != nil {
+			return err
+		}
+		if class == 0 {
+			d.dcTables[id] = table
+		} else {
+			d.acTables[id] = table
+		}
+		segment = segment[17+total:]
+	}
+	return nil
+}
+
+// newJPEGHuffman builds the decoding tables from the code counts per length and the values.
+// Returns an error if the counts do not match the values or oversubscribe the code space.
+func newJPEGHuffman(counts [16]int, values []uint8) (*jpegHuffman, error) {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 || total > 256 || total != len(values) {
+		return nil, errInvalidHuffman
+	}
+	t := &jpegHuffman{values: append([]uint8(nil), values...)}
+	code, k := int32(0), int32(0)
+	for length := 1; length <= 16; length++ {
+		n := int32(counts[length-1])
+		t.valPtr[length] = k - code
+		if code+n > 1<<length {
+			return nil, errInvalidHuffman
+		}
+		for i := int32(0); i < n; i++ {
+			if length <= 9 {
+				shift := 9 - length
+				for fill := int32(0); fill < 1<<shift; fill++ {
+					t.lookup[(code<<shift)|fill] = uint16(length)<<8 | uint16(values[k])
+				}
+			}
+			code++
+			k++
+		}
+		t.maxCode[length] = code - 1
+		if n == 0 {
+			t.maxCode[length] = -1
+		}
+		code <<= 1
+	}
+	return t, nil
+}
+
+// parseScan decodes the DC coefficients of a scan, or skips a scan that adds nothing to the preview
+func (d *jpegPreviewDecoder) parseScan(segment []byte) error {
+	if len(d.components) == 0 || len(segment) < 1 {
+		return errPreviewUnsupported
+	}
+	n := int(segment[0])
+	if len(segment) < 1+2*n+3 {
+		return io.ErrUnexpectedEOF
+	}
+	var scan []*jpegPreviewComponent
+	for i := 0; i < n; i++ {
+		id, tables := segment[1+2*i], segment[2+2*i]
+		for _, comp := range d.components {
+			if comp.id == id {
+				comp.dcTable, comp.acTable = tables>>4&3, tables&3
+				scan = append(scan, comp)
+			}
+		}
+	}
+	if len(scan) != n {
+		return errPreviewUnsupported
+	}
+	ss, se := segment[1+2*n], segment[2+2*n]
+	ah, al := segment[3+2*n]>>4, segment[3+2*n]&15
+
+	// Progressive AC scans and DC refinements only sharpen the preview
+	if d.progressive && (ss != 0 || ah != 0) {
+		return nil
+	}
+	if d.progressive {
+		se = 0
+	}
+	for _, comp := range scan {
+		if d.dcTables[comp.dcTable] == nil || (se > 0 && d.acTables[comp.acTable] == nil) {
+			return errPreviewUnsupported
+		}
+		comp.pred = 0
+	}
+
+	d.bits, d.nbits = 0, 0
+	decodeBlock := func(comp *jpegPreviewComponent, bx, by int) error {
+		t, err := d.decodeHuffman(d.dcTables[comp.dcTable])
+		if err != nil {
+			return err
+		}
+		diff, err := d.receiveExtend(int(t))
+		if err != nil {
+			return err
+		}
+		comp.pred += diff
+		if bx < comp.blocksW && by < comp.blocksH {
+			comp.dc[by*comp.blocksW+bx] = comp.pred << al
+		}
+		// The AC coefficients still have to be read to find the next block
+		for k := 1; k <= int(se); k++ {
+			rs, err := d.decodeHuffman(d.acTables[comp.acTable])
+			if err != nil {
+				return err
+			}
+			r, s := int(rs>>4), int(rs&15)
+			if s == 0 {
+				if r != 15 {
+					break
+				}
+				k += 15
+				continue
+			}
+			k += r
+			if _, err := d.receive(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var units, unitsX int
+	if len(scan) == 1 {
+		comp := scan[0]
+		compW := (d.width*comp.h + d.hMax - 1) / d.hMax
+		compH := (d.height*comp.v + d.vMax - 1) / d.vMax
+		unitsX = (compW + 7) / 8
+		units = unitsX * ((compH + 7) / 8)
+	} else {
+		unitsX = (d.width + 8*d.hMax - 1) / (8 * d.hMax)
+		units = unitsX * ((d.height + 8*d.vMax - 1) / (8 * d.vMax))
+	}
+	for unit := 0; unit < units; unit++ {
+		if d.restart > 0 && unit > 0 && unit%d.restart == 0 {
+			d.resync()
+			for _, comp := range scan {
+				comp.pred = 0
+			}
+		}
+		ux, uy := unit%unitsX, unit/unitsX
+		if len(scan) == 1 {
+			if err := decodeBlock(scan[0], ux, uy); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, comp := range scan {
+			for y := 0; y < comp.v; y++ {
+				for x := 0; x < comp.h; x++ {
+					if err := decodeBlock(comp, ux*comp.h+x, uy*comp.v+y); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	for _, comp := range scan {
+		comp.complete = true
+	}
+	return nil
+}
+
+// resync discards buffered bits and skips the restart marker that ends an interval
+func (d *jpegPreviewDecoder) resync() {
+	d.bits, d.nbits = 0, 0
+	for d.pos+1 < len(d.data) {
+		if d.data[d.pos] == 0xff && d.data[d.pos+1] >= 0xd0 && d.data[d.pos+1] <= 0xd7 {
+			d.pos += 2
+			return
+		}
+		d.pos++
+	}
+}
+
+// fill loads entropy-coded bytes into the bit buffer, removing stuffed zero
+// bytes. At a marker it feeds zeros, as the standard requires.
+func (d *jpegPreviewDecoder) fill() {
+	for d.nbits <= 24 {
+		var b byte
+		if d.pos < len(d.data) {
+			b = d.data[d.pos]
+			if b == 0xff {
+				if d.pos+1 < len(d.data) && d.data[d.pos+1] == 0x00 {
+					d.pos += 2
+				} else {
+					b = 0
+				}
+			} else {
+				d.pos++
+			}
+		}
+		d.bits |= uint32(b) << (24 - d.nbits)
+		d.nbits += 8
+	}
+}
+
+func (d *jpegPreviewDecoder) decodeHuffman(t *jpegHuffman) (uint8, error) {
+	d.fill()
+	if entry := t.lookup[d.bits>>23]; entry != 0 {
+		length := int(entry >> 8)
+		d.bits <<= length
+		d.nbits -= length
+		return uint8(entry), nil
+	}
+	code := int32(d.bits >> 23)
+	for length := 10; length <= 16; length++ {
+		code = int32(d.bits >> (32 - length))
+		if code <= t.maxCode[length] {
+			index := code + t.valPtr[length]
+			if index < 0 || int(index) >= len(t.values) {
+				break
+			}
+			d.bits <<= length
+			d.nbits -= length
+			return t.values[index], nil
+		}
+	}
+	return 0, fmt.Errorf("invalid Huffman code")
+}
+
+// receive reads n raw bits
+func (d *jpegPreviewDecoder) receive(n int) (int32, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if n > 16 {
+		return 0, fmt.Errorf("invalid coefficient size %d", n)
+	}
+	d.fill()
+	v := int32(d.bits >> (32 - n))
+	d.bits <<= n
+	d.nbits -= n
+	return v, nil
+}
+
+// receiveExtend reads an n-bit magnitude and converts it to a signed value
+func (d *jpegPreviewDecoder) receiveExtend(n int) (int32, error) {
+	v, err := d.receive(n)
+	if err != nil || n == 0 {
+		return v, err
+	}
+	if v < 1<<(n-1) {
+		v -= 1<<n - 1
+	}
+	return v, nil
+}
+
+func (d *jpegPreviewDecoder) allComplete() bool {
+	for _, comp := range d.components {
+		if !comp.complete {
+			return false
+		}
+	}
+	return len(d.components) > 0
+}
+
+// image assembles the block averages into the preview. A DC coefficient is
+// eight times the mean of its block, level-shifted by 128.
+func (d *jpegPreviewDecoder) image() image.Image {
+	w := (d.width + jpegPreviewScale - 1) / jpegPreviewScale
+	h := (d.height + jpegPreviewScale - 1) / jpegPreviewScale
+	sample := func(comp *jpegPreviewComponent, x, y int) uint8 {
+		bx := min(x*comp.h/d.hMax, comp.blocksW-1)
+		by := min(y*comp.v/d.vMax, comp.blocksH-1)
+		v := comp.dc[by*comp.blocksW+bx]*int32(d.quant[comp.quant])/8 + 128
+		return uint8(max(0, min(255, v)))
+	}
+
+	if len(d.components) == 1 {
+		img := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.SetGray(x, y, color.Gray{Y: sample(d.components[0], x, y)})
+			}
+		}
+		return img
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b := color.YCbCrToRGB(sample(d.components[0], x, y), sample(d.components[1], x, y), sample(d.components[2], x, y))
+			img.SetRGBA(x, y, color.RGBA{R: r, G: g, B: b, A: 255})
+		}
+	}
+	return img
+}
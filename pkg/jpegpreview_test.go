@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeJPEGPreview(t *testing.T) {
+	// A gradient smooth enough that chroma subsampling barely shifts the block means
+	src := image.NewRGBA(image.Rect(0, 0, 203, 117))
+	for y := 0; y < 117; y++ {
+		for x := 0; x < 203; x++ {
+			src.SetRGBA(x, y, color.RGBA{R: uint8(64 + x/4), G: uint8(64 + y/2), B: uint8(160 - x/4), A: 255})
+		}
+	}
+	gray := toGray(src)
+
+	for _, tc := range []struct {
+		name string
+		img  image.Image
+	}{
+		{"color", src},
+		{"gray", gray},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, tc.img, &jpeg.Options{Quality: 90}); err != nil {
+				t.Fatalf("Failed to encode test image: %v", err)
+			}
+			full, err := jpeg.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("Failed to decode test image: %v", err)
+			}
+
+			d := &jpegPreviewDecoder{data: buf.Bytes()}
+			preview, err := d.decode()
+			if err != nil {
+				t.Fatalf("Failed to decode DC preview: %v", err)
+			}
+			if preview.Bounds().Dx() != 26 || preview.Bounds().Dy() != 15 {
+				t.Fatalf("Expected a 26x15 preview, got %v", preview.Bounds())
+			}
+
+			// Every preview pixel is the mean of the matching full-size block
+			for by := 0; by < 14; by++ {
+				for bx := 0; bx < 25; bx++ {
+					var sum [3]int
+					for y := by * 8; y < by*8+8; y++ {
+						for x := bx * 8; x < bx*8+8; x++ {
+							r, g, b, _ := full.At(x, y).RGBA()
+							sum[0] += int(r >> 8)
+							sum[1] += int(g >> 8)
+							sum[2] += int(b >> 8)
+						}
+					}
+					r, g, b, _ := preview.At(bx, by).RGBA()
+					for i, v := range []uint32{r, g, b} {
+						if diff := int(v>>8) - sum[i]/64; diff < -6 || diff > 6 {
+							t.Fatalf("Block (%d,%d) channel %d: expected about %d, got %d", bx, by, i, sum[i]/64, v>>8)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFastPreviewImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_fastpreview.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_fastpreview.jpg")
+	if err := generateSingleTestImage(testInputPath, 640, 480); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	if err := FastPreviewImage(testInputPath, testOutputPath); err != nil {
+		t.Fatalf("Failed to create fast preview: %v", err)
+	}
+	preview, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load preview: %v", err)
+	}
+	if preview.Bounds().Dx() != 80 || preview.Bounds().Dy() != 60 {
+		t.Errorf("Expected an 80x60 preview, got %v", preview.Bounds())
+	}
+
+	// Other formats are decoded in full and scaled down
+	pngPath := filepath.Join(testDir, "test_input_fastpreview.png")
+	if err := savePNG(pngPath, preview); err != nil {
+		t.Fatalf("Failed to save PNG: %v", err)
+	}
+	if err := FastPreviewImage(pngPath, testOutputPath); err != nil {
+		t.Fatalf("Failed to create fast preview of a PNG: %v", err)
+	}
+	small, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load preview: %v", err)
+	}
+	if small.Bounds().Dx() != 10 || small.Bounds().Dy() != 8 {
+		t.Errorf("Expected a 10x8 preview, got %v", small.Bounds())
+	}
+}
+
+func TestParseHuffmanOversubscribed(t *testing.T) {
+	// Three codes of length one do not fit the code space
+	segment := []byte{0x00, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3}
+	d := &jpegPreviewDecoder{}
+	if err := d.parseHuffman(segment); err == nil {
+		t.Errorf("Expected an error for an oversubscribed Huffman table")
+	}
+
+	// A nine-bit code after the one-bit codes filled the space used to index past the lookup table
+	segment = []byte{0x10, 2, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3}
+	if err := d.parseHuffman(segment); err == nil {
+		t.Errorf("Expected an error for a Huffman code beyond the code space")
+	}
+}
@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// The inner loops in this file work on the pixel slices of the standard image
+// types, one row at a time. Each row is resliced to its exact length up front
+// so the compiler can drop the bounds checks and keep the loops tight; images
+// of other types go through the generic At/Set path.
+
+// toGrayGeneric converts any image to grayscale through the color model
+func toGrayGeneric(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	grayImg := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			grayImg.Set(x, y, color.GrayModel.Convert(img.At(x, y)))
+		}
+	}
+	return grayImg
+}
+
+// grayFromRGBARow converts a row of RGBA pixels to gray levels with the
+// weights and rounding of color.GrayModel
+func grayFromRGBARow(dst, src []uint8) {
+	src = src[:len(dst)*4]
+	for i := range dst {
+		s := src[i*4 : i*4+3 : i*4+3]
+		r, g, b := uint32(s[0])*0x101, uint32(s[1])*0x101, uint32(s[2])*0x101
+		dst[i] = uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+	}
+}
+
+// grayFromYCbCr converts a YCbCr image to grayscale, matching color.GrayModel
+func grayFromYCbCr(dst *image.Gray, src *image.YCbCr) {
+	bounds := src.Bounds()
+	w := bounds.Dx()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := dst.Pix[dst.PixOffset(bounds.Min.X, y):][:w]
+		for i := range row {
+			x := bounds.Min.X + i
+			yi, ci := src.YOffset(x, y), src.COffset(x, y)
+			r, g, b, _ := color.YCbCr{Y: src.Y[yi], Cb: src.Cb[ci], Cr: src.Cr[ci]}.RGBA()
+			row[i] = uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+		}
+	}
+}
+
+// sobelRow computes the Sobel gradients of the interior pixels of a row from
+// the rows above, at and below it. Pixel i of the outputs belongs to column i+1.
+func sobelRow(above, row, below []uint8, gx, gy []int32) {
+	n := len(gx)
+	above, row, below = above[:n+2], row[:n+2], below[:n+2]
+	gy = gy[:n]
+	for i := range gx {
+		a0, a1, a2 := int32(above[i]), int32(above[i+1]), int32(above[i+2])
+		r0, r2 := int32(row[i]), int32(row[i+2])
+		b0, b1, b2 := int32(below[i]), int32(below[i+1]), int32(below[i+2])
+		gx[i] = a2 - a0 + 2*(r2-r0) + b2 - b0
+		gy[i] = b0 - a0 + 2*(b1-a1) + b2 - a2
+	}
+}
+
+// sobelGray runs the Sobel operator over a grayscale image, calling emit with
+// the zero-based index and the gradients of every interior row. Gradient i of
+// a row belongs to column i+1.
+func sobelGray(gray *image.Gray, emit func(y int, gx, gy []int32)) {
+	bounds := gray.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w < 3 || h < 3 {
+		return
+	}
+	gx := make([]int32, w-2)
+	gy := make([]int32, w-2)
+	row := func(y int) []uint8 {
+		return gray.Pix[gray.PixOffset(bounds.Min.X, bounds.Min.Y+y):][:w]
+	}
+	for y := 1; y < h-1; y++ {
+		sobelRow(row(y-1), row(y), row(y+1), gx, gy)
+		emit(y, gx, gy)
+	}
+}
+
+// sobelMagnitude returns the clamped Sobel gradient magnitude of a grayscale
+// image with the same bounds; the border pixels are zero
+func sobelMagnitude(gray *image.Gray) *image.Gray {
+	bounds := gray.Bounds()
+	edges := image.NewGray(bounds)
+	sobelGray(gray, func(y int, gx, gy []int32) {
+		row := edges.Pix[y*edges.Stride+1:][:len(gx)]
+		gy = gy[:len(gx)]
+		for i, dx := range gx {
+			magnitude := math.Sqrt(float64(dx*dx + gy[i]*gy[i]))
+			row[i] = uint8(math.Min(magnitude, 255))
+		}
+	})
+	return edges
+}
+
+// toRGBAGeneric copies any image into a zero-origin RGBA image through the color model
+func toRGBAGeneric(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			rgba.Set(x, y, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return rgba
+}
+
+// drawRGBA copies the standard image types into a zero-origin RGBA image
+// with the specialized loops of image/draw
+func drawRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
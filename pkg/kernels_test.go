@@ -0,0 +1,192 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// kernelTestImages returns random images of the types with specialized loops,
+// some of them with a non-zero origin
+func kernelTestImages(w, h int) map[string]image.Image {
+	rng := rand.New(rand.NewSource(1))
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		a := uint8(rng.Intn(256))
+		rgba.Pix[i+3] = a
+		for c := 0; c < 3; c++ {
+			rgba.Pix[i+c] = uint8(rng.Intn(int(a) + 1))
+		}
+	}
+	nrgba := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rng.Read(nrgba.Pix)
+	gray := image.NewGray(image.Rect(0, 0, w, h))
+	rng.Read(gray.Pix)
+	// 16-bit images, as decoded from 16-bit PNGs
+	rgba64 := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			a := uint16(rng.Intn(0x10000))
+			rgba64.SetRGBA64(x, y, color.RGBA64{uint16(rng.Intn(int(a) + 1)), uint16(rng.Intn(int(a) + 1)), uint16(rng.Intn(int(a) + 1)), a})
+		}
+	}
+	nrgba64 := image.NewNRGBA64(image.Rect(0, 0, w, h))
+	rng.Read(nrgba64.Pix)
+	gray16 := image.NewGray16(image.Rect(0, 0, w, h))
+	rng.Read(gray16.Pix)
+	images := map[string]image.Image{
+		"rgba":       rgba,
+		"nrgba":      nrgba,
+		"gray":       gray,
+		"rgba-sub":   rgba.SubImage(image.Rect(3, 5, w-2, h-1)),
+		"gray-sub":   gray.SubImage(image.Rect(1, 2, w-3, h)),
+		"rgba64":     rgba64,
+		"nrgba64":    nrgba64,
+		"gray16":     gray16,
+		"gray16-sub": gray16.SubImage(image.Rect(2, 1, w, h-3)),
+	}
+	for _, ratio := range []image.YCbCrSubsampleRatio{image.YCbCrSubsampleRatio420, image.YCbCrSubsampleRatio444} {
+		ycbcr := image.NewYCbCr(image.Rect(0, 0, w, h), ratio)
+		rng.Read(ycbcr.Y)
+		rng.Read(ycbcr.Cb)
+		rng.Read(ycbcr.Cr)
+		images["ycbcr-"+ratio.String()] = ycbcr
+		images["ycbcr-sub-"+ratio.String()] = ycbcr.SubImage(image.Rect(1, 3, w-1, h-2))
+	}
+	return images
+}
+
+func TestKernelsMatchGenericPath(t *testing.T) {
+	for name, img := range kernelTestImages(37, 29) {
+		t.Run(name, func(t *testing.T) {
+			fast, generic := toGray(img), toGrayGeneric(img)
+			if fast.Bounds() != generic.Bounds() || !bytes.Equal(fast.Pix, generic.Pix) {
+				t.Errorf("toGray differs from the generic conversion")
+			}
+
+			fastRGBA, genericRGBA := toRGBA(img), toRGBAGeneric(img)
+			if fastRGBA.Bounds() != genericRGBA.Bounds() || !bytes.Equal(fastRGBA.Pix, genericRGBA.Pix) {
+				t.Errorf("toRGBA differs from the generic conversion")
+			}
+
+			edges := detectEdges(img)
+			bounds := generic.Bounds()
+			for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+				for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+					at := func(dx, dy int) float64 { return float64(generic.GrayAt(x+dx, y+dy).Y) }
+					gx := -at(-1, -1) + at(1, -1) - 2*at(-1, 0) + 2*at(1, 0) - at(-1, 1) + at(1, 1)
+					gy := -at(-1, -1) - 2*at(0, -1) - at(1, -1) + at(-1, 1) + 2*at(0, 1) + at(1, 1)
+					want := uint8(math.Min(math.Sqrt(gx*gx+gy*gy), 255))
+					if got := edges.GrayAt(x, y).Y; got != want {
+						t.Fatalf("Sobel magnitude at (%d,%d): expected %d, got %d", x, y, want, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBoxBlurPass(t *testing.T) {
+	w, h, radius := 23, 11, 4
+	src := make([]uint8, w*h*4)
+	rand.New(rand.NewSource(2)).Read(src)
+
+	got := make([]uint8, len(src))
+	boxBlurPass(src, got, w, h, radius, 4, w*4)
+
+	window := 2*radius + 1
+	for line := 0; line < h; line++ {
+		for c := 0; c < 4; c++ {
+			for i := 0; i < w; i++ {
+				sum := 0
+				for k := i - radius; k <= i+radius; k++ {
+					sum += int(src[line*w*4+min(max(k, 0), w-1)*4+c])
+				}
+				if want := uint8((sum + window/2) / window); got[line*w*4+i*4+c] != want {
+					t.Fatalf("Pixel %d of line %d, channel %d: expected %d, got %d", i, line, c, want, got[line*w*4+i*4+c])
+				}
+			}
+		}
+	}
+}
+
+func benchmarkImage() *image.YCbCr {
+	img := image.NewYCbCr(image.Rect(0, 0, 1920, 1080), image.YCbCrSubsampleRatio420)
+	rng := rand.New(rand.NewSource(3))
+	rng.Read(img.Y)
+	rng.Read(img.Cb)
+	rng.Read(img.Cr)
+	return img
+}
+
+func BenchmarkToGray(b *testing.B) {
+	img := benchmarkImage()
+	rgba := toRGBA(img)
+	b.Run("ycbcr", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			toGray(img)
+		}
+	})
+	b.Run("ycbcr-generic", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			toGrayGeneric(img)
+		}
+	})
+	b.Run("rgba", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			toGray(rgba)
+		}
+	})
+	b.Run("rgba-generic", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			toGrayGeneric(rgba)
+		}
+	})
+}
+
+func BenchmarkToRGBA(b *testing.B) {
+	img := benchmarkImage()
+	b.Run("ycbcr", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			toRGBA(img)
+		}
+	})
+	b.Run("ycbcr-generic", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			toRGBAGeneric(img)
+		}
+	})
+}
+
+func BenchmarkSobel(b *testing.B) {
+	gray := toGray(benchmarkImage())
+	b.Run("rows", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sobelMagnitude(gray)
+		}
+	})
+	b.Run("generic", func(b *testing.B) {
+		bounds := gray.Bounds()
+		for i := 0; i < b.N; i++ {
+			edges := image.NewGray(bounds)
+			for y := 1; y < bounds.Dy()-1; y++ {
+				for x := 1; x < bounds.Dx()-1; x++ {
+					at := func(dx, dy int) float64 { return float64(gray.GrayAt(x+dx, y+dy).Y) }
+					gx := -at(-1, -1) + at(1, -1) - 2*at(-1, 0) + 2*at(1, 0) - at(-1, 1) + at(1, 1)
+					gy := -at(-1, -1) - 2*at(0, -1) - at(1, -1) + at(-1, 1) + 2*at(0, 1) + at(1, 1)
+					edges.Set(x, y, color.Gray{Y: uint8(math.Min(math.Sqrt(gx*gx+gy*gy), 255))})
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkBlurRegion(b *testing.B) {
+	rgba := toRGBA(benchmarkImage())
+	for i := 0; i < b.N; i++ {
+		blurRegion(rgba, image.Rect(400, 200, 1400, 900), 12)
+	}
+}
@@ -0,0 +1,196 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sync/atomic"
+)
+
+// errMemoryBudget is returned when an operation would go over its budget
+var errMemoryBudget = errors.New("memory budget exceeded")
+
+// MemoryAccount counts the bytes of the images an operation allocates, arena
+// style: every decoded image and every result of a pipeline step is charged
+// when it is made and nothing is given back until the operation ends, so the
+// total bounds what the operation holds at any time. The scratch buffers
+// inside a step are not counted, so the figure is a lower bound of what the
+// process needs, suited to sizing instances and refusing oversized requests.
+//
+// An account is passed to an operation in its context with
+// WithMemoryAccount. It is safe for concurrent use.
+type MemoryAccount struct {
+	budget    int64
+	allocated atomic.Int64
+	// health, when set, is told of the charges so it can report the memory
+	// of the requests in progress
+	health *Health
+}
+
+// NewMemoryAccount creates an account allowing budget bytes; zero or less
+// only counts
+func NewMemoryAccount(budget int64) *MemoryAccount {
+	return &MemoryAccount{budget: budget}
+}
+
+// Budget returns the bytes the account allows, zero for no limit
+func (a *MemoryAccount) Budget() int64 {
+	return max(a.budget, 0)
+}
+
+// Allocated returns the bytes charged so far
+func (a *MemoryAccount) Allocated() int64 {
+	return a.allocated.Load()
+}
+
+// Charge adds n bytes to the account.
+// Returns an error, without charging them, if they would exceed the budget.
+func (a *MemoryAccount) Charge(n int64) error {
+	for {
+		allocated := a.allocated.Load()
+		if err := a.check(allocated, n); err != nil {
+			return err
+		}
+		if a.allocated.CompareAndSwap(allocated, allocated+n) {
+			if a.health != nil {
+				a.health.addMemory(n)
+			}
+			return nil
+		}
+	}
+}
+
+// check returns an error if n more bytes on top of allocated would exceed
+// the budget
+func (a *MemoryAccount) check(allocated, n int64) error {
+	if a.budget > 0 && n > a.budget-allocated {
+		return &ErrProcessing{Op: "memory", Err: fmt.Errorf("%w: %d bytes allocated, %d more needed, budget %d", errMemoryBudget, allocated, n, a.budget)}
+	}
+	return nil
+}
+
+// memoryKey is the context key of the MemoryAccount of an operation
+type memoryKey struct{}
+
+// WithMemoryAccount returns a context charging the operations run with it,
+// such as Pipeline.ApplyContext, RunContext and RunReaderContext, to the
+// account a
+func WithMemoryAccount(ctx context.Context, a *MemoryAccount) context.Context {
+	return context.WithValue(ctx, memoryKey{}, a)
+}
+
+// memoryFrom returns the MemoryAccount carried by ctx, or nil
+func memoryFrom(ctx context.Context) *MemoryAccount {
+	a, _ := ctx.Value(memoryKey{}).(*MemoryAccount)
+	return a
+}
+
+// chargeImage charges the pixels of img to the account of ctx, if any
+func chargeImage(ctx context.Context, img image.Image) error {
+	if a := memoryFrom(ctx); a != nil {
+		return a.Charge(imageBytes(img))
+	}
+	return nil
+}
+
+// pixelBytes returns the size of a width x height image at 4 bytes a pixel,
+// saturating instead of overflowing for huge sizes
+func pixelBytes(width, height int) int64 {
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	if int64(width) > math.MaxInt64/4/int64(height) {
+		return math.MaxInt64
+	}
+	return 4 * int64(width) * int64(height)
+}
+
+// resizeBytes returns the bytes ResizeWithOptions allocates for img: the
+// scaled image, and the box it is cropped or padded to when that differs.
+// Invalid options count as nothing, the step itself reports them.
+func resizeBytes(img image.Image, opts ResizeOptions) int64 {
+	result, scaled, err := resizeTarget(img.Bounds().Size(), opts.DPI, opts)
+	if err != nil {
+		return 0
+	}
+	n := int64(0)
+	if !result.Skipped {
+		n = pixelBytes(scaled.X, scaled.Y)
+	}
+	if box := image.Pt(result.Width, result.Height); box != scaled {
+		n = min(n, math.MaxInt64-pixelBytes(box.X, box.Y)) + pixelBytes(box.X, box.Y)
+	}
+	return n
+}
+
+// decodeImageContext decodes data like decodeImageData and charges the
+// result to the account of ctx. The size announced by the image's header is
+// checked first, so an image over the budget is refused before it is decoded.
+func (p *Processor) decodeImageContext(ctx context.Context, data []byte, name string) (image.Image, error) {
+	if a := memoryFrom(ctx); a != nil {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			if err := a.check(a.Allocated(), int64(cfg.Width)*int64(cfg.Height)*bytesPerPixel(cfg.ColorModel)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	img, err := p.decodeImageData(data, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := chargeImage(ctx, img); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// imageBytes returns the size of the pixel buffers of an image; images of
+// other types are counted at 4 bytes a pixel
+func imageBytes(img image.Image) int64 {
+	switch m := img.(type) {
+	case *image.RGBA:
+		return int64(len(m.Pix))
+	case *image.NRGBA:
+		return int64(len(m.Pix))
+	case *image.RGBA64:
+		return int64(len(m.Pix))
+	case *image.NRGBA64:
+		return int64(len(m.Pix))
+	case *image.Gray:
+		return int64(len(m.Pix))
+	case *image.Gray16:
+		return int64(len(m.Pix))
+	case *image.Paletted:
+		return int64(len(m.Pix))
+	case *image.CMYK:
+		return int64(len(m.Pix))
+	case *image.YCbCr:
+		return int64(len(m.Y) + len(m.Cb) + len(m.Cr))
+	case *image.NYCbCrA:
+		return int64(len(m.Y) + len(m.Cb) + len(m.Cr) + len(m.A))
+	}
+	b := img.Bounds()
+	return int64(b.Dx()) * int64(b.Dy()) * 4
+}
+
+// bytesPerPixel returns the least number of bytes a decoder allocates per
+// pixel for a color model; YCbCr counts its luma only, as the chroma depends
+// on the subsampling
+func bytesPerPixel(model color.Model) int64 {
+	switch model {
+	case color.GrayModel, color.AlphaModel, color.YCbCrModel:
+		return 1
+	case color.Gray16Model, color.Alpha16Model:
+		return 2
+	case color.RGBA64Model, color.NRGBA64Model:
+		return 8
+	}
+	if _, ok := model.(color.Palette); ok {
+		return 1
+	}
+	return 4
+}
@@ -0,0 +1,54 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestMemoryAccount(t *testing.T) {
+	account := NewMemoryAccount(1000)
+	if err := account.Charge(600); err != nil {
+		t.Fatalf("Failed to charge within the budget: %v", err)
+	}
+	var procErr *ErrProcessing
+	if err := account.Charge(500); !errors.As(err, &procErr) || procErr.Op != "memory" || account.Allocated() != 600 {
+		t.Errorf("Expected the charge over the budget refused, got %v with %d allocated", err, account.Allocated())
+	}
+
+	// A pipeline charges its input and the result of each step
+	src := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	account = NewMemoryAccount(0)
+	ctx := WithMemoryAccount(context.Background(), account)
+	if _, err := NewPipeline().Resize(50, 25).Binarize().ApplyContext(ctx, src); err != nil {
+		t.Fatalf("Failed to run the pipeline: %v", err)
+	}
+	if got, want := account.Allocated(), int64(50*25*4+50*25); got < want {
+		t.Errorf("Expected at least %d bytes charged, got %d", want, got)
+	}
+
+	account = NewMemoryAccount(50 * 25 * 4)
+	ctx = WithMemoryAccount(context.Background(), account)
+	if _, err := NewPipeline().Resize(50, 25).Binarize().ApplyContext(ctx, src); !errors.As(err, &procErr) || procErr.Op != "memory" {
+		t.Errorf("Expected the second step over the budget, got %v", err)
+	}
+
+	// A step whose result would go over the budget is refused before it runs
+	account = NewMemoryAccount(1 << 20)
+	ctx = WithMemoryAccount(context.Background(), account)
+	ran := false
+	p := NewPipeline().Then("big", func(img image.Image) (image.Image, error) {
+		ran = true
+		return img, nil
+	}).withEstimate(func(image.Image) int64 { return 1 << 30 })
+	if _, err := p.ApplyContext(ctx, src); !errors.As(err, &procErr) || procErr.Op != "memory" || ran {
+		t.Errorf("Expected the step refused before running, got %v", err)
+	}
+	if _, err := NewPipeline().Resize(8000, 8000).ApplyContext(ctx, src); !errors.As(err, &procErr) || procErr.Op != "memory" {
+		t.Errorf("Expected the resize over the budget refused, got %v", err)
+	}
+	if got := pixelBytes(1<<40, 1<<40); got <= 0 {
+		t.Errorf("Expected a huge size to saturate, got %d", got)
+	}
+}
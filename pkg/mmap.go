@@ -0,0 +1,36 @@
+package processor
+
+import (
+	"errors"
+	"os"
+)
+
+// errMmapUnsupported is returned by mapFile on platforms without memory mapping
+var errMmapUnsupported = errors.New("memory mapping is not supported on this platform")
+
+// readInput returns the contents of an input file and a function that releases
+// them. When Mmap is enabled the file is memory-mapped, so the pages are read
+// on demand and shared with the page cache instead of being copied onto the
+// heap; the data must not be used after release. Files that cannot be mapped
+// are read into memory instead.
+func (p *Processor) readInput(path string) (data []byte, release func(), err error) {
+	if p.Config().Mmap {
+		data, release, err := mapFile(path)
+		if err == nil {
+			return data, release, nil
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, err
+		}
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() {}, nil
+}
+
+// readInput is Processor.readInput on the default Processor
+func readInput(path string) (data []byte, release func(), err error) {
+	return defaultProcessor.readInput(path)
+}
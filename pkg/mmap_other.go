@@ -0,0 +1,8 @@
+//go:build !unix
+
+package processor
+
+// mapFile reports that memory mapping is not available on this platform
+func mapFile(path string) ([]byte, func(), error) {
+	return nil, nil, errMmapUnsupported
+}
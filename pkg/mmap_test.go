@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMmapInput(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	inputPath := filepath.Join(testDir, "input.jpg")
+	if err := generateSingleTestImage(inputPath, 64, 48); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	want, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read test image: %v", err)
+	}
+
+	original := currentConfig()
+	defer SetConfig(original)
+	c := *original
+	c.Mmap = true
+	SetConfig(&c)
+
+	data, release, err := readInput(inputPath)
+	if err != nil {
+		t.Fatalf("readInput failed: %v", err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("Mapped data differs from the file contents")
+	}
+	release()
+
+	if _, _, err := readInput(filepath.Join(testDir, "missing.jpg")); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+
+	// Empty files cannot be mapped and fall back to a plain read
+	emptyPath := filepath.Join(testDir, "empty.jpg")
+	if err := os.WriteFile(emptyPath, nil, 0o644); err != nil {
+		t.Fatalf("Failed to create empty file: %v", err)
+	}
+	if data, release, err := readInput(emptyPath); err != nil || len(data) != 0 {
+		t.Errorf("Expected an empty read, got %d bytes, error %v", len(data), err)
+	} else {
+		release()
+	}
+
+	outputPath := filepath.Join(testDir, "output.jpg")
+	if err := BinarizeImage(inputPath, outputPath); err != nil {
+		t.Fatalf("BinarizeImage failed with mapped input: %v", err)
+	}
+	img, err := loadImage(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to load output: %v", err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 48 {
+		t.Errorf("Expected a 64x48 output, got %v", img.Bounds())
+	}
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package processor
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps a file read-only into memory
+func mapFile(path string) ([]byte, func(), error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The mapping stays valid after the file is closed
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := info.Size()
+	if size <= 0 || !info.Mode().IsRegular() || int64(int(size)) != size {
+		return nil, nil, errMmapUnsupported
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() { syscall.Munmap(data) }, nil
+}
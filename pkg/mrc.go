@@ -0,0 +1,422 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Defaults of MRCOptions
+const (
+	defaultMRCDPI             = 300
+	defaultMRCBackgroundScale = 3
+	defaultMRCForegroundScale = 6
+	defaultMRCQuality         = 50
+)
+
+// mrcMaxTextLevel is the highest gray level, in the page with its lighting
+// flattened, that can count as text, so that the threshold of a blank page
+// does not pick out the grain of the paper
+const mrcMaxTextLevel = 160
+
+// MRCOptions controls the layers of WriteMRCPDF
+type MRCOptions struct {
+	// DPI is the resolution of the scans, which sets the size of the pages;
+	// zero is 300
+	DPI float64
+	// BackgroundScale is the factor by which the background layer is
+	// reduced; zero is 3
+	BackgroundScale int
+	// ForegroundScale is the factor by which the layer giving the text its
+	// colors is reduced; zero is 6
+	ForegroundScale int
+	// Quality is the JPEG quality of the background and foreground layers,
+	// 1-100; zero is 50
+	Quality int
+	// Threshold is the gray level at or below which a pixel is text, after
+	// the lighting is flattened; zero finds it with Otsu's method
+	Threshold uint8
+}
+
+// MRCPage describes a page written by WriteMRCPDF
+type MRCPage struct {
+	// Text is the fraction of the pixels in the text mask
+	Text float64 `json:"text"`
+	// Mask, Background and Foreground are the compressed sizes of the layers
+	// in bytes
+	Mask       int `json:"mask"`
+	Background int `json:"background"`
+	Foreground int `json:"foreground"`
+}
+
+// MRCResult describes the PDF written by WriteMRCPDF
+type MRCResult struct {
+	Pages []MRCPage `json:"pages"`
+	// Size is the size of the PDF in bytes
+	Size int64 `json:"size"`
+}
+
+// MRCPDF writes scanned pages to a PDF in mixed raster content layers, one
+// page per input, as WriteMRCPDF.
+// It takes the paths of the inputs, the path of the PDF and the options.
+// Returns the sizes of the layers, or an error if the operation fails.
+func MRCPDF(inputPaths []string, outputPath string, opts MRCOptions) (*MRCResult, error) {
+	slog.Info("writing MRC PDF",
+		"inputs", len(inputPaths),
+		"output", outputPath)
+
+	images, err := loadImages(inputPaths)
+	if err != nil {
+		return nil, err
+	}
+	out, err := createOutput(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	result, err := WriteMRCPDF(out, images, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result, out.Commit()
+}
+
+// WriteMRCPDF writes scanned pages to w as a PDF of mixed raster content:
+// every page is split into a full-resolution binary mask of the text, a
+// background layer with the text removed and a foreground layer holding the
+// colors of the text. The mask keeps the text sharp and compresses well with
+// Flate, while the two color layers are smooth and compress well as JPEGs at
+// a fraction of the resolution, so archives of scanned documents take much
+// less room than with a JPEG of every page. Viewers paint the background,
+// then the foreground through the mask.
+// Returns the sizes of the layers, or an error if an option is invalid or
+// writing fails.
+func WriteMRCPDF(w io.Writer, images []image.Image, opts MRCOptions) (*MRCResult, error) {
+	opts, err := mrcDefaults(opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, &ErrProcessing{Op: "mrc", Err: fmt.Errorf("no pages")}
+	}
+
+	pdf := newPDFWriter(w)
+	pdf.header()
+	// Objects 1 and 2 are the catalog and the page tree; every page takes
+	// five objects: the page, its contents and the three layers
+	pageIDs := make([]string, len(images))
+	for i := range images {
+		pageIDs[i] = fmt.Sprintf("%d 0 R", 3+5*i)
+	}
+	pdf.object(1, "<< /Type /Catalog /Pages 2 0 R >>", nil)
+	pdf.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(pageIDs, " "), len(images)), nil)
+
+	result := &MRCResult{}
+	for i, img := range images {
+		layers, err := splitMRC(img, opts)
+		if err != nil {
+			return nil, err
+		}
+		result.Pages = append(result.Pages, layers.page)
+
+		id := 3 + 5*i
+		bounds := img.Bounds()
+		width, height := float64(bounds.Dx())*72/opts.DPI, float64(bounds.Dy())*72/opts.DPI
+		pdf.object(id, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Contents %d 0 R /Resources << /XObject << /Bg %d 0 R /Fg %d 0 R >> >> >>",
+			width, height, id+1, id+2, id+3), nil)
+		contents := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Bg Do Q\nq %.2f 0 0 %.2f 0 0 cm /Fg Do Q\n", width, height, width, height)
+		pdf.object(id+1, fmt.Sprintf("<< /Length %d >>", len(contents)), []byte(contents))
+		pdf.object(id+2, pdfImage(layers.background, ""), layers.background.data)
+		pdf.object(id+3, pdfImage(layers.foreground, fmt.Sprintf(" /Mask %d 0 R", id+4)), layers.foreground.data)
+		pdf.object(id+4, fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ImageMask true /BitsPerComponent 1 /Decode [1 0] /Filter /FlateDecode /Length %d >>",
+			bounds.Dx(), bounds.Dy(), len(layers.mask)), layers.mask)
+	}
+	pdf.trailer(1)
+	if pdf.err != nil {
+		return nil, &ErrProcessing{Op: "write", Err: pdf.err}
+	}
+	result.Size = pdf.offset
+	return result, nil
+}
+
+// mrcDefaults fills in the defaults of opts and checks them
+func mrcDefaults(opts MRCOptions) (MRCOptions, error) {
+	if opts.DPI == 0 {
+		opts.DPI = defaultMRCDPI
+	}
+	if opts.BackgroundScale == 0 {
+		opts.BackgroundScale = defaultMRCBackgroundScale
+	}
+	if opts.ForegroundScale == 0 {
+		opts.ForegroundScale = defaultMRCForegroundScale
+	}
+	if opts.Quality == 0 {
+		opts.Quality = defaultMRCQuality
+	}
+	switch {
+	case opts.DPI < 0:
+		return opts, &ErrProcessing{Op: "mrc", Err: fmt.Errorf("DPI must be positive, got %g", opts.DPI)}
+	case opts.BackgroundScale < 1 || opts.ForegroundScale < 1:
+		return opts, &ErrProcessing{Op: "mrc", Err: fmt.Errorf("layer scales must be positive, got %d and %d", opts.BackgroundScale, opts.ForegroundScale)}
+	case opts.Quality < 1 || opts.Quality > 100:
+		return opts, &ErrProcessing{Op: "mrc", Err: fmt.Errorf("quality must be between 1 and 100, got %d", opts.Quality)}
+	}
+	return opts, nil
+}
+
+// mrcLayer is a color layer encoded as JPEG
+type mrcLayer struct {
+	width, height int
+	gray          bool
+	data          []byte
+}
+
+// mrcLayers are the layers of a page
+type mrcLayers struct {
+	mask                   []byte
+	background, foreground mrcLayer
+	page                   MRCPage
+}
+
+// splitMRC segments the page into its text mask and color layers
+func splitMRC(img image.Image, opts MRCOptions) (*mrcLayers, error) {
+	rgba := toRGBA(img)
+	bounds := rgba.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	_, gray := img.(*image.Gray)
+	if _, ok := img.(*image.Gray16); ok {
+		gray = true
+	}
+
+	text, count := textMask(rgba, opts.Threshold)
+
+	// The background is sampled away from the text, whose antialiased
+	// edges would otherwise darken it around every letter
+	near := dilateMask(text, w, h)
+	background, err := encodeMRCLayer(rgba, opts.BackgroundScale, gray, opts.Quality, func(i int) bool { return !near[i] }, color.RGBA{0xff, 0xff, 0xff, 0xff})
+	if err != nil {
+		return nil, err
+	}
+	foreground, err := encodeMRCLayer(rgba, opts.ForegroundScale, gray, opts.Quality, func(i int) bool { return text[i] }, color.RGBA{0, 0, 0, 0xff})
+	if err != nil {
+		return nil, err
+	}
+
+	// The mask has one bit per pixel, rows padded to whole bytes
+	stride := (w + 7) / 8
+	bits := make([]byte, stride*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if text[y*w+x] {
+				bits[y*stride+x/8] |= 0x80 >> (x % 8)
+			}
+		}
+	}
+	var mask bytes.Buffer
+	zw, _ := zlib.NewWriterLevel(&mask, zlib.BestCompression)
+	if _, err := zw.Write(bits); err != nil {
+		return nil, &ErrProcessing{Op: "encode", Err: err}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, &ErrProcessing{Op: "encode", Err: err}
+	}
+
+	layers := &mrcLayers{mask: mask.Bytes(), background: background, foreground: foreground}
+	layers.page = MRCPage{Mask: mask.Len(), Background: len(background.data), Foreground: len(foreground.data)}
+	if w*h > 0 {
+		layers.page.Text = float64(count) / float64(w*h)
+	}
+	return layers, nil
+}
+
+// textMask returns the pixels of rgba that are text, dark against the paper
+// once uneven lighting is removed: at or below threshold, or below Otsu's
+// threshold capped at mrcMaxTextLevel when it is zero. Returns the number of
+// text pixels as well.
+func textMask(rgba *image.RGBA, threshold uint8) ([]bool, int) {
+	flat := toGray(flattenIllumination(rgba))
+	level := int(threshold)
+	if level == 0 {
+		histogram := make([]int, 256)
+		for _, v := range flat.Pix {
+			histogram[v]++
+		}
+		level = min(int(otsuThreshold(histogram, len(flat.Pix))), mrcMaxTextLevel)
+	}
+	text := make([]bool, len(flat.Pix))
+	count := 0
+	for i, v := range flat.Pix {
+		if int(v) <= level {
+			text[i] = true
+			count++
+		}
+	}
+	return text, count
+}
+
+// dilateMask returns the mask grown by one pixel in every direction
+func dilateMask(mask []bool, w, h int) []bool {
+	grown := make([]bool, len(mask))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !mask[y*w+x] {
+				continue
+			}
+			for ny := max(y-1, 0); ny <= min(y+1, h-1); ny++ {
+				for nx := max(x-1, 0); nx <= min(x+1, w-1); nx++ {
+					grown[ny*w+nx] = true
+				}
+			}
+		}
+	}
+	return grown
+}
+
+// encodeMRCLayer reduces rgba by scale, averaging in each cell the pixels
+// for which use is true, and encodes the result as JPEG. Cells without such
+// pixels take the colors of their neighbors, which keeps the layer smooth
+// and cheap to compress, or fill when the whole layer is empty.
+func encodeMRCLayer(rgba *image.RGBA, scale int, gray bool, quality int, use func(i int) bool, fill color.RGBA) (mrcLayer, error) {
+	bounds := rgba.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	lw, lh := max((w+scale-1)/scale, 1), max((h+scale-1)/scale, 1)
+	sums := make([][3]int, lw*lh)
+	counts := make([]int, lw*lh)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !use(y*w + x) {
+				continue
+			}
+			cell := (y/scale)*lw + x/scale
+			i := rgba.PixOffset(x, y)
+			for c := 0; c < 3; c++ {
+				sums[cell][c] += int(rgba.Pix[i+c])
+			}
+			counts[cell]++
+		}
+	}
+
+	layer := image.NewRGBA(image.Rect(0, 0, lw, lh))
+	known := make([]bool, lw*lh)
+	var queue []int
+	for cell, n := range counts {
+		if n == 0 {
+			continue
+		}
+		i := cell * 4
+		for c := 0; c < 3; c++ {
+			layer.Pix[i+c] = uint8((sums[cell][c] + n/2) / n)
+		}
+		layer.Pix[i+3] = 0xff
+		known[cell] = true
+		queue = append(queue, cell)
+	}
+	if len(queue) == 0 {
+		for cell := range known {
+			layer.SetRGBA(cell%lw, cell/lw, fill)
+		}
+	}
+
+	// Spread the known colors outwards, one ring of cells at a time
+	for len(queue) > 0 {
+		var next []int
+		for _, cell := range queue {
+			x, y := cell%lw, cell/lw
+			for _, d := range [4][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+				nx, ny := x+d[0], y+d[1]
+				if nx < 0 || ny < 0 || nx >= lw || ny >= lh || known[ny*lw+nx] {
+					continue
+				}
+				known[ny*lw+nx] = true
+				layer.SetRGBA(nx, ny, layer.RGBAAt(x, y))
+				next = append(next, ny*lw+nx)
+			}
+		}
+		queue = next
+	}
+
+	var out image.Image = layer
+	if gray {
+		out = toGray(layer)
+	}
+	var buf bytes.Buffer
+	if err := encodeJPEGQuality(&buf, out, quality); err != nil {
+		return mrcLayer{}, err
+	}
+	return mrcLayer{width: lw, height: lh, gray: gray, data: buf.Bytes()}, nil
+}
+
+// pdfImage returns the dictionary of a JPEG image XObject, with extra
+// entries
+func pdfImage(layer mrcLayer, extra string) string {
+	colorSpace := "/DeviceRGB"
+	if layer.gray {
+		colorSpace = "/DeviceGray"
+	}
+	return fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode /Length %d%s >>",
+		layer.width, layer.height, colorSpace, len(layer.data), extra)
+}
+
+// pdfWriter writes the objects of a PDF and its cross-reference table.
+// Objects are numbered from 1 and written in order; the first error stops
+// the writing and is kept in err.
+type pdfWriter struct {
+	w       io.Writer
+	offset  int64
+	offsets []int64
+	err     error
+}
+
+// newPDFWriter returns a writer of a PDF to w
+func newPDFWriter(w io.Writer) *pdfWriter {
+	return &pdfWriter{w: w}
+}
+
+// write writes b unless an earlier write failed
+func (p *pdfWriter) write(b []byte) {
+	if p.err != nil {
+		return
+	}
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	p.err = err
+}
+
+// header writes the version and a comment of binary bytes, which tells
+// transfer programs the file is not text
+func (p *pdfWriter) header() {
+	p.write([]byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n"))
+}
+
+// object writes object id with the dictionary dict and, if not nil, the
+// stream data
+func (p *pdfWriter) object(id int, dict string, data []byte) {
+	for len(p.offsets) < id {
+		p.offsets = append(p.offsets, 0)
+	}
+	p.offsets[id-1] = p.offset
+	p.write(fmt.Appendf(nil, "%d 0 obj\n%s\n", id, dict))
+	if data != nil {
+		p.write([]byte("stream\n"))
+		p.write(data)
+		p.write([]byte("\nendstream\n"))
+	}
+	p.write([]byte("endobj\n"))
+}
+
+// trailer writes the cross-reference table and the trailer naming the
+// catalog root
+func (p *pdfWriter) trailer(root int) {
+	start := p.offset
+	xref := fmt.Appendf(nil, "xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, offset := range p.offsets {
+		xref = fmt.Appendf(xref, "%010d 00000 n \n", offset)
+	}
+	p.write(xref)
+	p.write(fmt.Appendf(nil, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets)+1, root, start))
+}
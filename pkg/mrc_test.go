@@ -0,0 +1,129 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// mrcTestPage is a scanned page: grainy paper lit unevenly, with rows of dark
+// blue letters drawn as bars
+func mrcTestPage(w, h int) (*image.RGBA, []bool) {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	text := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			paper := uint8(235 - x*20/w + rng.Intn(8))
+			c := color.RGBA{paper, paper, paper - 10, 0xff}
+			if y%30 >= 10 && y%30 < 22 && x%12 >= 4 && x%12 < 7 && x > 20 && x < w-20 {
+				c = color.RGBA{20, 30, 90, 0xff}
+				text[y*w+x] = true
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img, text
+}
+
+func TestWriteMRCPDF(t *testing.T) {
+	page, text := mrcTestPage(600, 300)
+	var buf bytes.Buffer
+	result, err := WriteMRCPDF(&buf, []image.Image{page, toGray(page)}, MRCOptions{})
+	if err != nil {
+		t.Fatalf("WriteMRCPDF failed: %v", err)
+	}
+	data := buf.Bytes()
+	if result.Size != int64(len(data)) || len(result.Pages) != 2 {
+		t.Errorf("Expected %d bytes and 2 pages, got %+v", len(data), result)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("Expected a PDF header and end marker")
+	}
+
+	// The cross-reference table points at every object
+	start, err := strconv.Atoi(string(regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(data)[1]))
+	if err != nil || !bytes.HasPrefix(data[start:], []byte("xref\n")) {
+		t.Fatalf("Expected startxref to point at the table, got %d", start)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[start:], -1)
+	if len(entries) != 12 {
+		t.Fatalf("Expected 12 objects, got %d", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Errorf("Object %d is not at offset %d", i+1, offset)
+		}
+	}
+	if !bytes.Contains(data, []byte("/MediaBox [0 0 144.00 72.00]")) {
+		t.Error("Expected a page of 2x1 inches at 300 DPI")
+	}
+	if !bytes.Contains(data, []byte("/ColorSpace /DeviceGray")) {
+		t.Error("Expected gray layers for the gray page")
+	}
+
+	// The mask holds the letters
+	masks := regexp.MustCompile(`(?s)/ImageMask true.*?/Length (\d+) >>\nstream\n`).FindSubmatchIndex(data)
+	length, _ := strconv.Atoi(string(data[masks[2]:masks[3]]))
+	zr, err := zlib.NewReader(bytes.NewReader(data[masks[1] : masks[1]+length]))
+	if err != nil {
+		t.Fatalf("Failed to inflate the mask: %v", err)
+	}
+	bits, _ := io.ReadAll(zr)
+	if len(bits) != 75*300 {
+		t.Fatalf("Expected 75 bytes by 300 rows, got %d bytes", len(bits))
+	}
+	wrong := 0
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 600; x++ {
+			if (bits[y*75+x/8]&(0x80>>(x%8)) != 0) != text[y*600+x] {
+				wrong++
+			}
+		}
+	}
+	if wrong > 0 {
+		t.Errorf("Expected the mask to match the letters, %d pixels differ", wrong)
+	}
+	if result.Pages[0].Text < 0.05 || result.Pages[0].Text > 0.15 {
+		t.Errorf("Expected about a tenth of the page as text, got %g", result.Pages[0].Text)
+	}
+
+	// Smaller than a JPEG of the page
+	var plain bytes.Buffer
+	if err := encodeJPEGQuality(&plain, page, 85); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if size := result.Pages[0].Mask + result.Pages[0].Background + result.Pages[0].Foreground; size*2 > plain.Len() {
+		t.Errorf("Expected the layers to take less than half of the %d bytes of a JPEG, got %d", plain.Len(), size)
+	}
+
+	for _, opts := range []MRCOptions{{Quality: 101}, {BackgroundScale: -1}, {DPI: -300}} {
+		if _, err := WriteMRCPDF(io.Discard, []image.Image{page}, opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+	if _, err := WriteMRCPDF(io.Discard, nil, MRCOptions{}); err == nil {
+		t.Error("Expected an error without pages")
+	}
+
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	input := writeTestImage(t, testDir, "test_input.png", page, encodePNGBuffer)
+	output := filepath.Join(testDir, "test_output.pdf")
+	if _, err := MRCPDF([]string{input, input}, output, MRCOptions{DPI: 150}); err != nil {
+		t.Fatalf("MRCPDF failed: %v", err)
+	}
+	if data, err := os.ReadFile(output); err != nil || !bytes.Contains(data, []byte("/Count 2")) {
+		t.Errorf("Expected a PDF of two pages, got %v", err)
+	}
+}
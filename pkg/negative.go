@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"sort"
+)
+
+// defaultFilmBorder is the fraction of each side sampled for the film base color
+const defaultFilmBorder = 0.03
+
+// negativeClip is the fraction of pixels clipped at each end of every channel
+// when stretching the inverted image
+const negativeClip = 0.005
+
+// NegativeOptions controls InvertNegativeImage
+type NegativeOptions struct {
+	// Base is the color of the unexposed film base (the orange mask). When its
+	// alpha is zero the base is measured from the film border.
+	Base color.RGBA
+	// Border is the fraction of each side of the scan sampled for the base
+	// color; zero uses defaultFilmBorder
+	Border float64
+}
+
+// NegativeResult describes what InvertNegativeImage did
+type NegativeResult struct {
+	// Base is the film base color that was removed, as #rrggbb
+	Base string `json:"base"`
+}
+
+// InvertNegativeImage turns a color negative film scan into a positive.
+// Each channel is divided by the film base color, which removes the orange
+// mask, then inverted and stretched to the full range.
+// It takes the paths of the input and output files and the options.
+// Returns the film base color, or an error if the operation fails.
+func InvertNegativeImage(inputPath string, outputPath string, opts NegativeOptions) (*NegativeResult, error) {
+	slog.Info("inverting negative",
+		"input", inputPath,
+		"output", outputPath)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	out, result := InvertNegative(img, opts)
+	if err := saveJPEG(outputPath, out); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// InvertNegativeImageReader turns the negative read from r into a positive
+// like InvertNegativeImage and writes it to w as JPEG.
+// Returns the film base color, or an error if the operation fails.
+func InvertNegativeImageReader(r io.Reader, w io.Writer, opts NegativeOptions) (*NegativeResult, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	out, result := InvertNegative(img, opts)
+	if err := encodeJPEG(w, out); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// InvertNegative turns a color negative film scan into a positive, like
+// InvertNegativeImage.
+// Returns the positive and the film base color that was removed.
+func InvertNegative(img image.Image, opts NegativeOptions) (image.Image, *NegativeResult) {
+	rgba := toRGBA(img)
+
+	base := opts.Base
+	if base.A == 0 {
+		border := opts.Border
+		if border <= 0 {
+			border = defaultFilmBorder
+		}
+		base = filmBaseColor(rgba, border)
+	}
+	slog.Info("film base color", "base", hexColor(base))
+
+	// Transmission relative to the base, inverted: the base becomes black
+	inverted := make([][]float64, 3)
+	baseChannels := [3]float64{float64(max(base.R, 1)), float64(max(base.G, 1)), float64(max(base.B, 1))}
+	for c := range inverted {
+		inverted[c] = make([]float64, len(rgba.Pix)/4)
+		for i := range inverted[c] {
+			t := float64(rgba.Pix[i*4+c]) / baseChannels[c]
+			inverted[c][i] = 1 - min(t, 1)
+		}
+	}
+
+	// Stretching each channel on its own also balances the color
+	out := image.NewRGBA(rgba.Bounds())
+	for c, values := range inverted {
+		low, high := percentileRange(values, negativeClip)
+		scale := 255.0
+		if high > low {
+			scale = 255 / (high - low)
+		}
+		for i, v := range values {
+			out.Pix[i*4+c] = uint8(min(max((v-low)*scale, 0), 255) + 0.5)
+		}
+	}
+	for i := 3; i < len(out.Pix); i += 4 {
+		out.Pix[i] = 255
+	}
+
+	return out, &NegativeResult{Base: hexColor(base)}
+}
+
+// filmBaseColor returns the per-channel median of a strip along the edges of
+// the scan, where the unexposed film border is
+func filmBaseColor(img *image.RGBA, border float64) color.RGBA {
+	bounds := img.Bounds()
+	bx := max(1, int(float64(bounds.Dx())*border))
+	by := max(1, int(float64(bounds.Dy())*border))
+	inner := image.Rect(bounds.Min.X+bx, bounds.Min.Y+by, bounds.Max.X-bx, bounds.Max.Y-by)
+
+	var channels [3][]int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if image.Pt(x, y).In(inner) {
+				continue
+			}
+			c := img.RGBAAt(x, y)
+			channels[0] = append(channels[0], int(c.R))
+			channels[1] = append(channels[1], int(c.G))
+			channels[2] = append(channels[2], int(c.B))
+		}
+	}
+
+	var median [3]uint8
+	for i, values := range channels {
+		sort.Ints(values)
+		median[i] = uint8(values[len(values)/2])
+	}
+	return color.RGBA{R: median[0], G: median[1], B: median[2], A: 255}
+}
+
+// percentileRange returns the values below which the clip and 1-clip
+// fractions of values lie
+func percentileRange(values []float64, clip float64) (float64, float64) {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	last := len(sorted) - 1
+	return sorted[int(float64(last)*clip)], sorted[int(float64(last)*(1-clip))]
+}
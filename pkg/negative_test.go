@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// generateNegative renders a positive with a white, a red and a blue patch as
+// a color negative on an orange film base with an unexposed border
+func generateNegative(outputPath string, base color.RGBA) error {
+	img := image.NewRGBA(image.Rect(0, 0, 120, 80))
+	negative := func(p color.RGBA) color.RGBA {
+		channel := func(b, v uint8) uint8 {
+			return uint8(float64(b) * (1 - float64(v)/255))
+		}
+		return color.RGBA{R: channel(base.R, p.R), G: channel(base.G, p.G), B: channel(base.B, p.B), A: 255}
+	}
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			positive := color.RGBA{A: 255}
+			if x >= 10 && x < 110 && y >= 10 && y < 70 {
+				switch {
+				case x < 43:
+					positive = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+				case x < 76:
+					positive = color.RGBA{R: 220, G: 40, B: 40, A: 255}
+				default:
+					positive = color.RGBA{R: 40, G: 40, B: 220, A: 255}
+				}
+			}
+			img.SetRGBA(x, y, negative(positive))
+		}
+	}
+	return saveJPEG(outputPath, img)
+}
+
+func TestInvertNegativeImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_negative.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_negative.jpg")
+	orange := color.RGBA{R: 230, G: 150, B: 90, A: 255}
+	if err := generateNegative(testInputPath, orange); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	result, err := InvertNegativeImage(testInputPath, testOutputPath, NegativeOptions{})
+	if err != nil {
+		t.Fatalf("Failed to invert negative: %v", err)
+	}
+	base, err := ParseHexColor(result.Base)
+	if err != nil {
+		t.Fatalf("Failed to parse base color %q: %v", result.Base, err)
+	}
+	if colorDistance(base, orange) > 10 {
+		t.Errorf("Expected film base near %v, got %s", orange, result.Base)
+	}
+
+	img, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load output image: %v", err)
+	}
+	rgba := toRGBA(img)
+	if c := rgba.RGBAAt(2, 2); c.R > 30 || c.G > 30 || c.B > 30 {
+		t.Errorf("Expected the film border to become black, got %v", c)
+	}
+	if c := rgba.RGBAAt(25, 40); c.R < 220 || c.G < 220 || c.B < 220 {
+		t.Errorf("Expected the white patch to be white without an orange cast, got %v", c)
+	}
+	if c := rgba.RGBAAt(60, 40); c.R < c.G+100 || c.R < c.B+100 {
+		t.Errorf("Expected the red patch to be red, got %v", c)
+	}
+	if c := rgba.RGBAAt(95, 40); c.B < c.R+100 || c.B < c.G+100 {
+		t.Errorf("Expected the blue patch to be blue, got %v", c)
+	}
+}
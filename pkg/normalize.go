@@ -0,0 +1,334 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultNormalizeName is the output name template used when none is given
+	DefaultNormalizeName = "{name}"
+	// defaultNormalizeMaxSkew is the largest skew corrected by default, in
+	// degrees; larger angles are more likely misdetections than skewed feeds
+	defaultNormalizeMaxSkew = 10.0
+	// normalizeMinSkew is the smallest skew worth resampling the page for
+	normalizeMinSkew = 0.1
+	// trimFuzz is the difference per channel from the border color below
+	// which a pixel belongs to the border
+	trimFuzz = 32
+	// trimMinShare is the share of a row or column that must differ from the
+	// border color for it to hold content, so specks of dust are trimmed away
+	trimMinShare = 0.005
+)
+
+// NormalizeOptions are the target of NormalizeImage. The zero value turns
+// pages upright, deskews and trims them and keeps their color and resolution.
+type NormalizeOptions struct {
+	// NoDeskew and NoTrim leave out the skew correction and the trimming
+	NoDeskew bool
+	NoTrim   bool
+	// MaxSkew is the largest skew corrected, in degrees; zero uses 10
+	MaxSkew float64
+	// ColorType and Bits write the output as a PNG of this color type and bit
+	// depth, as ConvertImage does; an empty ColorType writes a color JPEG
+	ColorType string
+	Bits      int
+	// DPI resamples the page to this resolution, keeping its physical size
+	// when the source records its resolution, and records it in the output.
+	// Zero keeps the resolution of the source.
+	DPI float64
+	// Name is the template of the output names of NormalizeImages, without
+	// extension: {name} is the name of the input without extension, {index}
+	// its position from 1, zero-padded, and {date} the day it was taken,
+	// from EXIF or the modification time. Empty uses DefaultNormalizeName.
+	Name string
+}
+
+// NormalizeResult describes what NormalizeImage did to a page
+type NormalizeResult struct {
+	// Orientation is the EXIF orientation applied; zero when there was none
+	Orientation int `json:"orientation,omitempty"`
+	// Skew is the skew corrected, in degrees; zero when none was
+	Skew   float64 `json:"skew"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	// DPI is the resolution recorded in the output; zero when unknown
+	DPI float64 `json:"dpi,omitempty"`
+}
+
+// NormalizeImage makes a scanned page uniform with the rest of a batch: it
+// turns it upright by its EXIF orientation, corrects its skew, trims the
+// scanner bed and any other uniform border around it, resamples it to the
+// resolution of opts and writes it in the color type and bit depth of opts.
+// Corners left empty by the skew correction are filled with white.
+// It takes the paths of the input and output files and the options.
+// Returns what was done to the page, or an error if the options are invalid
+// or the operation fails.
+func NormalizeImage(inputPath string, outputPath string, opts NormalizeOptions) (*NormalizeResult, error) {
+	return defaultProcessor.NormalizeImage(inputPath, outputPath, opts)
+}
+
+// NormalizeImage is the package function NormalizeImage with the configuration and logger of p
+func (p *Processor) NormalizeImage(inputPath string, outputPath string, opts NormalizeOptions) (*NormalizeResult, error) {
+	p.logger().Info("normalizing image",
+		"input", inputPath,
+		"color_type", opts.ColorType,
+		"bits", opts.Bits,
+		"dpi", opts.DPI)
+
+	var hdr pngHeader
+	if opts.ColorType != "" {
+		var err error
+		if hdr, err = convertHeader(ConvertOptions{ColorType: opts.ColorType, Bits: opts.Bits}); err != nil {
+			return nil, err
+		}
+	}
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &NormalizeResult{}
+	if info, err := readExif(inputPath); err == nil && info.Orientation > 1 {
+		img = applyOrientation(img, info.Orientation)
+		result.Orientation = info.Orientation
+	}
+	if !opts.NoDeskew {
+		img, result.Skew, err = deskew(img, opts.MaxSkew)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !opts.NoTrim {
+		img = trimBorders(toRGBA(img))
+	}
+	page := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(page, page.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(page, page.Bounds(), img, img.Bounds().Min, draw.Over)
+	img = page
+
+	dpi := readDPI(inputPath)
+	if opts.DPI > 0 {
+		if dpi > 0 && math.Abs(opts.DPI-dpi) > 0.5 {
+			img, _, _ = ResizeWithOptions(img, ResizeOptions{Scale: opts.DPI / dpi})
+		}
+		dpi = opts.DPI
+	}
+	result.Width, result.Height, result.DPI = img.Bounds().Dx(), img.Bounds().Dy(), dpi
+
+	if opts.ColorType == "" {
+		if err := p.saveJPEGWithDPI(outputPath, img, dpi, p.Config().JpegQuality); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	out, err := p.createOutput(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	hdr.dpi = dpi
+	if err := writeConverted(out, img, hdr, ConvertOptions{ColorType: opts.ColorType, Bits: opts.Bits}); err != nil {
+		return nil, err
+	}
+	if err := out.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// NormalizeImages normalizes every input like NormalizeImage in parallel,
+// writing the pages to outputDir with the names given by the template of
+// opts, with the extension .png when opts converts to a color type and .jpg
+// otherwise. The names are worked out before any page is written, so a
+// template giving two pages the same name is an error rather than an
+// overwritten page. The pages are processed as ProcessBatch processes files.
+// It takes the context, the input file paths, the output directory, the
+// options and the options of the batch.
+// Returns a report of every page, in input order, and the error of ctx if it
+// was cancelled, or an error if the template is invalid or the output
+// directory cannot be created.
+func NormalizeImages(ctx context.Context, inputPaths []string, outputDir string, opts NormalizeOptions, batch BatchOptions) (*BatchReport, error) {
+	return defaultProcessor.NormalizeImages(ctx, inputPaths, outputDir, opts, batch)
+}
+
+// NormalizeImages is the package function NormalizeImages with the configuration and logger of p
+func (p *Processor) NormalizeImages(ctx context.Context, inputPaths []string, outputDir string, opts NormalizeOptions, batch BatchOptions) (*BatchReport, error) {
+	names, err := NormalizeNames(inputPaths, opts.Name)
+	if err != nil {
+		return nil, err
+	}
+	ext := ".jpg"
+	if opts.ColorType != "" {
+		ext = ".png"
+	}
+	outputs := make(map[string]string, len(inputPaths))
+	for i, path := range inputPaths {
+		outputs[path] = filepath.Join(outputDir, names[i]+ext)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, &ErrInvalidOutput{Path: outputDir, Err: err}
+	}
+	report := runBatch(ctx, inputPaths, batch, func(inputPath string) (string, error) {
+		_, err := p.NormalizeImage(inputPath, outputs[inputPath], opts)
+		return outputs[inputPath], err
+	})
+	return report, ctx.Err()
+}
+
+// NormalizeNames returns the output names, without extension, that the
+// template gives the inputs, as described for NormalizeOptions.Name.
+// Returns an error if the template has an unknown placeholder or gives two
+// inputs the same name.
+func NormalizeNames(inputPaths []string, template string) ([]string, error) {
+	if template == "" {
+		template = DefaultNormalizeName
+	}
+	digits := max(3, len(strconv.Itoa(len(inputPaths))))
+	names := make([]string, len(inputPaths))
+	seen := make(map[string]string, len(inputPaths))
+	for i, path := range inputPaths {
+		base := filepath.Base(path)
+		fields := []string{
+			"{name}", strings.TrimSuffix(base, filepath.Ext(base)),
+			"{index}", fmt.Sprintf("%0*d", digits, i+1),
+		}
+		if strings.Contains(template, "{date}") {
+			fields = append(fields, "{date}", takenDate(path))
+		}
+		name := strings.NewReplacer(fields...).Replace(template)
+		if start := strings.IndexByte(name, '{'); start >= 0 && strings.IndexByte(name[start:], '}') > 0 {
+			return nil, &ErrProcessing{Op: "normalize", Err: fmt.Errorf("unknown placeholder in name template %q (want {name}, {index} or {date})", template)}
+		}
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return nil, &ErrProcessing{Op: "normalize", Err: fmt.Errorf("name template %q gives %s the invalid name %q", template, path, name)}
+		}
+		if other, ok := seen[name]; ok {
+			return nil, &ErrProcessing{Op: "normalize", Err: fmt.Errorf("name template %q gives both %s and %s the name %s", template, other, path, name)}
+		}
+		seen[name] = path
+		names[i] = name
+	}
+	return names, nil
+}
+
+// takenDate returns the day the image at path was taken, from EXIF or else
+// the modification time of the file, as 2006-01-02
+func takenDate(path string) string {
+	if info, err := readExif(path); err == nil && !info.DateTime.IsZero() {
+		return info.DateTime.Format("2006-01-02")
+	}
+	if stat, err := os.Stat(path); err == nil {
+		return stat.ModTime().Format("2006-01-02")
+	}
+	return "unknown"
+}
+
+// deskew corrects the skew of the image found with the Hough transform,
+// unless it is negligible or above maxSkew degrees (zero uses the default).
+// Returns the image and the skew corrected.
+func deskew(img image.Image, maxSkew float64) (image.Image, float64, error) {
+	if maxSkew <= 0 {
+		maxSkew = defaultNormalizeMaxSkew
+	}
+	angle, _, err := detectSkewAngle(context.Background(), detectEdges(img))
+	if err != nil {
+		return nil, 0, err
+	}
+	if math.Abs(angle) < normalizeMinSkew || math.Abs(angle) > maxSkew {
+		return img, 0, nil
+	}
+	// The background context is never cancelled
+	rotated, _ := rotateContext(context.Background(), img, -angle)
+	return rotated, angle, nil
+}
+
+// trimBorders cuts the uniform border around the content of the image away,
+// taking the median color of the outermost pixels as the border color.
+// Transparent pixels, such as the corners left by a rotation, count as
+// border too. An image without content is returned as it is.
+func trimBorders(img *image.RGBA) image.Image {
+	b := img.Bounds()
+	border := borderColor(img)
+	content := func(x, y int) bool {
+		c := img.RGBAAt(x, y)
+		if c.A < 128 {
+			return false
+		}
+		diff := func(u, v uint8) bool { return max(u, v)-min(u, v) > trimFuzz }
+		return diff(c.R, border.R) || diff(c.G, border.G) || diff(c.B, border.B)
+	}
+
+	rows := make([]int, b.Dy())
+	cols := make([]int, b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if content(x, y) {
+				rows[y-b.Min.Y]++
+				cols[x-b.Min.X]++
+			}
+		}
+	}
+	first, last := spanAbove(rows, max(1, int(trimMinShare*float64(b.Dx()))))
+	left, right := spanAbove(cols, max(1, int(trimMinShare*float64(b.Dy()))))
+	if first > last || left > right {
+		return img
+	}
+	return img.SubImage(image.Rect(b.Min.X+left, b.Min.Y+first, b.Min.X+right+1, b.Min.Y+last+1))
+}
+
+// spanAbove returns the first and last indexes of counts reaching least, or
+// first greater than last when none does
+func spanAbove(counts []int, least int) (first, last int) {
+	first, last = len(counts), -1
+	for i, n := range counts {
+		if n >= least {
+			first, last = i, i
+			break
+		}
+	}
+	for i := len(counts) - 1; i > first; i-- {
+		if counts[i] >= least {
+			last = i
+			break
+		}
+	}
+	return first, last
+}
+
+// borderColor returns the per-channel median of the opaque pixels along the
+// edges of the image, or white when there are none
+func borderColor(img *image.RGBA) color.RGBA {
+	b := img.Bounds()
+	var rs, gs, bs []uint8
+	add := func(x, y int) {
+		if c := img.RGBAAt(x, y); c.A >= 128 {
+			rs, gs, bs = append(rs, c.R), append(gs, c.G), append(bs, c.B)
+		}
+	}
+	for x := b.Min.X; x < b.Max.X; x++ {
+		add(x, b.Min.Y)
+		add(x, b.Max.Y-1)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		add(b.Min.X, y)
+		add(b.Max.X-1, y)
+	}
+	if len(rs) == 0 {
+		return color.RGBA{255, 255, 255, 255}
+	}
+	median := func(v []uint8) uint8 {
+		slices.Sort(v)
+		return v[len(v)/2]
+	}
+	return color.RGBA{median(rs), median(gs), median(bs), 255}
+}
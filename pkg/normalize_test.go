@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// skewedScan draws a 200x260 page with lines of text, turned by angle
+// degrees on a dark scanner bed
+func skewedScan(angle float64) image.Image {
+	bed := color.RGBA{50, 50, 55, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 320, 380))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bed), image.Point{}, draw.Src)
+	page := image.Rect(60, 60, 260, 320)
+	draw.Draw(img, page, image.White, image.Point{}, draw.Src)
+	for y := page.Min.Y + 20; y < page.Max.Y-20; y += 12 {
+		draw.Draw(img, image.Rect(page.Min.X+20, y, page.Max.X-20, y+3), image.Black, image.Point{}, draw.Src)
+	}
+	rotated, _ := rotateContext(context.Background(), img, angle)
+	scan := image.NewRGBA(rotated.Bounds())
+	draw.Draw(scan, scan.Bounds(), image.NewUniform(bed), image.Point{}, draw.Src)
+	draw.Draw(scan, scan.Bounds(), rotated, image.Point{}, draw.Over)
+	return scan
+}
+
+func TestNormalizeImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	inputPath := writeTestImage(t, testDir, "test_input_normalize.jpg", skewedScan(4), func(buf *bytes.Buffer, img image.Image) error {
+		return encodeJPEGWithDPI(buf, img, 300, 95)
+	})
+
+	outputPath := filepath.Join(testDir, "test_output_normalize.png")
+	result, err := NormalizeImage(inputPath, outputPath, NormalizeOptions{ColorType: ColorTypeGray, Bits: 1, DPI: 150})
+	if err != nil {
+		t.Fatalf("Failed to normalize: %v", err)
+	}
+	if math.Abs(math.Abs(result.Skew)-4) > 1 {
+		t.Errorf("Expected a skew of about 4 degrees, got %+v", result)
+	}
+	// The page is cut out of the bed and halved by the resolution
+	if math.Abs(float64(result.Width)-100) > 6 || math.Abs(float64(result.Height)-130) > 6 || result.DPI != 150 {
+		t.Errorf("Expected a page of about 100x130 at 150 dpi, got %+v", result)
+	}
+	out := decodeTestFile(t, outputPath)
+	if out.Bounds().Dx() != result.Width || out.Bounds().Dy() != result.Height {
+		t.Errorf("Expected the output to be %dx%d, got %v", result.Width, result.Height, out.Bounds())
+	}
+	if dpi := readDPI(outputPath); math.Abs(dpi-150) > 1 {
+		t.Errorf("Expected 150 dpi recorded, got %g", dpi)
+	}
+	if _, ok := out.(*image.Gray); !ok {
+		t.Errorf("Expected a gray output, got %T", out)
+	}
+
+	if _, err := NormalizeImage(inputPath, outputPath, NormalizeOptions{ColorType: ColorTypeRGB, Bits: 4}); err == nil {
+		t.Error("Expected an error for an invalid bit depth")
+	}
+}
+
+func TestNormalizeNames(t *testing.T) {
+	inputs := []string{"scans/b.jpg", "scans/a.png", "other/b.tif"}
+	for _, tt := range []struct {
+		template string
+		want     []string
+		wantErr  bool
+	}{
+		// The default template {name} gives both b files the same name
+		{"", nil, true},
+		{"page-{index}", []string{"page-001", "page-002", "page-003"}, false},
+		{"{index}_{name}", []string{"001_b", "002_a", "003_b"}, false},
+		{"{name}-{width}", nil, true},
+		{"sub/{index}", nil, true},
+	} {
+		got, err := NormalizeNames(inputs, tt.template)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tt.template, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v and %v", tt.template, tt.want, got, err)
+		}
+	}
+}
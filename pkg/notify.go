@@ -0,0 +1,184 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nfnt/resize"
+	"github.com/okamyuji/go-image-processor/config"
+)
+
+// notifyFailureLimit is how many failures a summary lists by name
+const notifyFailureLimit = 10
+
+// notifyThumbnailSize is the longest side of the thumbnails attached to emails
+const notifyThumbnailSize = 160
+
+// BatchSummary formats a batch report as a short plain-text summary: the
+// counts, the total time and the first failures
+func BatchSummary(report *BatchReport) string {
+	var b strings.Builder
+	operation := report.Operation
+	if operation == "" {
+		operation = "batch"
+	}
+	total := report.Succeeded + report.Skipped + report.Cancelled + len(report.Failures)
+	fmt.Fprintf(&b, "%s: %d files in %s\n", operation, total, time.Duration(report.DurationMS*float64(time.Millisecond)).Round(time.Millisecond))
+	fmt.Fprintf(&b, "%d succeeded, %d skipped, %d failed\n", report.Succeeded, report.Skipped, len(report.Failures))
+	for i, failure := range report.Failures {
+		if i == notifyFailureLimit {
+			fmt.Fprintf(&b, "... and %d more failures\n", len(report.Failures)-i)
+			break
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", failure.File, failure.Error)
+	}
+	return b.String()
+}
+
+// NotifyBatch sends the summary of a batch run to the configured email and
+// Slack notifiers. Runs shorter than the configured minimum duration are not
+// reported. Failed deliveries are logged and returned together.
+func NotifyBatch(report *BatchReport) error {
+	notify := currentConfig().Notify
+	if notify.Email == nil && notify.Slack == nil {
+		return nil
+	}
+	if time.Duration(report.DurationMS*float64(time.Millisecond)) < notify.MinDuration {
+		return nil
+	}
+
+	subject := fmt.Sprintf("Batch finished: %d succeeded, %d failed", report.Succeeded, len(report.Failures))
+	text := BatchSummary(report)
+	var errs []error
+	if notify.Email != nil {
+		count := notify.Thumbnails
+		if count == 0 {
+			count = 4
+		}
+		if err := sendEmail(*notify.Email, subject, text, batchThumbnails(report, count)); err != nil {
+			slog.Warn("email notification failed", "error", err)
+			errs = append(errs, err)
+		}
+	}
+	if notify.Slack != nil {
+		if err := sendSlack(*notify.Slack, subject+"\n"+text); err != nil {
+			slog.Warn("Slack notification failed", "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// batchThumbnails encodes JPEG thumbnails of the first successful outputs.
+// Outputs that cannot be read locally, such as uploads, are passed over.
+func batchThumbnails(report *BatchReport, count int) [][]byte {
+	var thumbs [][]byte
+	for _, file := range report.Files {
+		if len(thumbs) >= count {
+			break
+		}
+		if file.Status != "ok" || file.Output == "" {
+			continue
+		}
+		if _, err := os.Stat(file.Output); err != nil {
+			continue
+		}
+		img, err := loadImage(file.Output)
+		if err != nil {
+			continue
+		}
+		var buf bytes.Buffer
+		thumb := resize.Thumbnail(notifyThumbnailSize, notifyThumbnailSize, img, resize.Bilinear)
+		if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80}); err == nil {
+			thumbs = append(thumbs, buf.Bytes())
+		}
+	}
+	return thumbs
+}
+
+// buildEmail composes a multipart message with the summary as text and the
+// thumbnails as JPEG attachments
+func buildEmail(from string, to []string, subject, text string, thumbnails [][]byte) []byte {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	part, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	part.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n")))
+	for i, thumb := range thumbnails {
+		part, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"image/jpeg"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf(`attachment; filename="thumbnail-%d.jpg"`, i+1)},
+		})
+		encoded := base64.StdEncoding.EncodeToString(thumb)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+	mw.Close()
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes()
+}
+
+// sendEmail sends a summary through SMTP, authenticating when a username is set
+func sendEmail(n config.EmailNotifier, subject, text string, thumbnails [][]byte) error {
+	if n.Host == "" || n.From == "" || len(n.To) == 0 {
+		return &ErrProcessing{Op: "notify", Err: errors.New("email notifier needs host, from and to")}
+	}
+	port := n.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+	addr := n.Host + ":" + strconv.Itoa(port)
+	if err := smtp.SendMail(addr, auth, n.From, n.To, buildEmail(n.From, n.To, subject, text, thumbnails)); err != nil {
+		return &ErrProcessing{Op: "notify", Err: err}
+	}
+	slog.Info("email notification sent", "to", len(n.To))
+	return nil
+}
+
+// sendSlack posts a summary to a Slack incoming webhook
+func sendSlack(n config.SlackNotifier, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return &ErrProcessing{Op: "notify", Err: err}
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(n.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return &ErrProcessing{Op: "notify", Err: err}
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &ErrProcessing{Op: "notify", Err: fmt.Errorf("slack responded %s", resp.Status)}
+	}
+	slog.Info("Slack notification sent")
+	return nil
+}
@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/okamyuji/go-image-processor/config"
+)
+
+func TestBatchSummary(t *testing.T) {
+	report := &BatchReport{Operation: "binarize", DurationMS: 83000, Succeeded: 40, Skipped: 1}
+	for i := 0; i < 12; i++ {
+		report.Failures = append(report.Failures, BatchFailure{File: "scan.jpg", Error: "broken"})
+	}
+	summary := BatchSummary(report)
+	for _, want := range []string{"binarize: 53 files in 1m23s", "40 succeeded, 1 skipped, 12 failed", "scan.jpg: broken", "and 2 more failures"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("Summary %q lacks %q", summary, want)
+		}
+	}
+}
+
+func TestBuildEmail(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	outputPath := filepath.Join(testDir, "test_output_notify.jpg")
+	if err := generateSingleTestImage(outputPath, 640, 480); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	report := &BatchReport{Succeeded: 2, Files: []BatchFileResult{
+		{File: "a.jpg", Output: filepath.Join(testDir, "missing.jpg"), Status: "ok"},
+		{File: "b.jpg", Output: outputPath, Status: "ok"},
+	}}
+	thumbs := batchThumbnails(report, 4)
+	if len(thumbs) != 1 {
+		t.Fatalf("Expected one thumbnail, got %d", len(thumbs))
+	}
+
+	raw := buildEmail("scans@example.com", []string{"a@example.com", "b@example.com"}, "Batch finished", "2 succeeded\n", thumbs)
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse email: %v", err)
+	}
+	if msg.Header.Get("To") != "a@example.com, b@example.com" {
+		t.Errorf("Unexpected recipients %q", msg.Header.Get("To"))
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Failed to parse content type: %v", err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read part: %v", err)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+	if len(types) != 2 || types[1] != "image/jpeg" {
+		t.Errorf("Expected a text part and a thumbnail, got %v", types)
+	}
+}
+
+func TestNotifyBatchSlack(t *testing.T) {
+	var text string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		text = body["text"]
+	}))
+	defer server.Close()
+
+	original := currentConfig()
+	defer SetConfig(original)
+	c := *original
+	c.Notify = config.Notify{Slack: &config.SlackNotifier{WebhookURL: server.URL}}
+	SetConfig(&c)
+
+	if err := NotifyBatch(&BatchReport{Operation: "docclean", Succeeded: 3}); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+	if !strings.Contains(text, "3 succeeded, 0 failed") || !strings.Contains(text, "docclean: 3 files") {
+		t.Errorf("Unexpected Slack message %q", text)
+	}
+
+	// Short runs are not reported
+	text = ""
+	c.Notify.MinDuration = 1e9
+	SetConfig(&c)
+	if err := NotifyBatch(&BatchReport{Succeeded: 3}); err != nil || text != "" {
+		t.Errorf("Expected no message for a short run, got %q (%v)", text, err)
+	}
+}
@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"context"
+	"image"
+	"io"
+)
+
+// The interfaces below are implemented by *Processor, one per operation, so
+// that services built on the package can take the operations they use as a
+// dependency and replace them with fakes in their own tests, without doing
+// any pixel work:
+//
+//	type Thumbnailer struct {
+//		Images processor.Resizer
+//	}
+//
+// A fake only needs the methods the code under test calls: embedding the
+// interface in the fake's struct satisfies the rest, which panic if called.
+
+// Resizer resizes images, like ResizeImage and its variants
+type Resizer interface {
+	ResizeImage(inputPath string, outputPath string, width, height uint) error
+	ResizeImageWith(inputPath string, outputPath string, width, height uint, opts ...Option) error
+	ResizeImageWithOptions(inputPath string, outputPath string, opts ResizeOptions) (*ResizeResult, error)
+	ResizeImageContext(ctx context.Context, inputPath string, outputPath string, opts ResizeOptions) (*ResizeResult, error)
+	ResizeImageReader(r io.Reader, w io.Writer, width, height uint) error
+	ResizeImageReaderWith(r io.Reader, w io.Writer, width, height uint, opts ...Option) error
+	ResizeImageReaderWithOptions(r io.Reader, w io.Writer, opts ResizeOptions) (*ResizeResult, error)
+	PreviewResize(inputPath string, width, height uint, opts ...Option) (image.Image, error)
+}
+
+// Rotator rotates images by a given angle, like RotateImage and its variants
+type Rotator interface {
+	RotateImage(inputPath string, outputPath string, angle float64) error
+	RotateImageContext(ctx context.Context, inputPath string, outputPath string, angle float64) error
+	RotateImageWith(inputPath string, outputPath string, angle float64, opts ...Option) error
+	RotateImageReader(r io.Reader, w io.Writer, angle float64) error
+	RotateImageReaderWith(r io.Reader, w io.Writer, angle float64, opts ...Option) error
+	PreviewRotate(inputPath string, angle float64, opts ...Option) (image.Image, error)
+}
+
+// AutoRotator straightens and turns images upright, like AutoRotateImage and
+// its variants
+type AutoRotator interface {
+	AutoRotateImage(inputPath string, outputPath string) error
+	AutoRotateImageContext(ctx context.Context, inputPath string, outputPath string, opts AutoRotateOptions) (*AutoRotateResult, error)
+	AutoRotateImageWithOptions(inputPath string, outputPath string, opts AutoRotateOptions) (*AutoRotateResult, error)
+	AutoRotateImageReader(r io.Reader, w io.Writer) error
+	AutoRotateImageReaderWithOptions(r io.Reader, w io.Writer, opts AutoRotateOptions) (*AutoRotateResult, error)
+	PreviewAutoRotate(ctx context.Context, inputPath string, opts AutoRotateOptions) (image.Image, *AutoRotateResult, error)
+}
+
+// Denoiser removes noise from images and estimates it, like DenoiseImage,
+// EstimateNoise and their variants
+type Denoiser interface {
+	DenoiseImage(inputPath string, outputPath string) error
+	DenoiseImageContext(ctx context.Context, inputPath string, outputPath string, opts DenoiseOptions) (*DenoiseResult, error)
+	DenoiseImageWith(inputPath string, outputPath string, opts ...Option) error
+	DenoiseImageWithOptions(inputPath string, outputPath string, opts DenoiseOptions) (*DenoiseResult, error)
+	DenoiseImageReader(r io.Reader, w io.Writer) error
+	DenoiseImageReaderWith(r io.Reader, w io.Writer, opts ...Option) error
+	DenoiseImageReaderWithOptions(r io.Reader, w io.Writer, opts DenoiseOptions) (*DenoiseResult, error)
+	PreviewDenoise(inputPath string, opts ...Option) (image.Image, error)
+	EstimateNoise(inputPath string) (float64, error)
+	EstimateNoiseReader(r io.Reader) (float64, error)
+}
+
+// Binarizer converts images to black and white, like BinarizeImage and its
+// variants
+type Binarizer interface {
+	BinarizeImage(inputPath string, outputPath string) error
+	BinarizeImageWith(inputPath string, outputPath string, opts ...Option) error
+	BinarizeImageContext(ctx context.Context, inputPath string, outputPath string, opts ...Option) error
+	BinarizeImageReader(r io.Reader, w io.Writer) error
+	BinarizeImageReaderWith(r io.Reader, w io.Writer, opts ...Option) error
+	PreviewBinarize(inputPath string, opts ...Option) (image.Image, error)
+}
+
+// EdgeDetector detects edges in images, like DetectEdges and its variants
+type EdgeDetector interface {
+	DetectEdges(inputPath string, outputPath string) error
+	DetectEdgesWith(inputPath string, outputPath string, opts ...Option) error
+	DetectEdgesContext(ctx context.Context, inputPath string, outputPath string, opts ...Option) error
+	DetectEdgesReader(r io.Reader, w io.Writer) error
+	DetectEdgesReaderWith(r io.Reader, w io.Writer, opts ...Option) error
+	PreviewDetectEdges(inputPath string, opts ...Option) (image.Image, error)
+}
+
+// Concatenator combines images, like ConcatenateImagesVertically,
+// ConcatenateImagesHorizontally and their variants
+type Concatenator interface {
+	ConcatenateImagesVertically(inputPaths []string, outputPath string) error
+	ConcatenateImagesVerticallyWith(inputPaths []string, outputPath string, opts ...Option) error
+	ConcatenateImagesVerticallyContext(ctx context.Context, inputPaths []string, outputPath string, opts ...Option) error
+	ConcatenateImagesVerticallyReader(inputs []io.Reader, w io.Writer) error
+	ConcatenateImagesVerticallyStream(inputPaths []string, outputPath string, opts ...Option) error
+	ConcatenateImagesVerticallyPNG(inputPaths []string, w io.Writer, opts ...Option) error
+	ConcatenateImagesHorizontally(inputPaths []string, outputPath string) error
+	ConcatenateImagesHorizontallyWith(inputPaths []string, outputPath string, opts ...Option) error
+	ConcatenateImagesHorizontallyContext(ctx context.Context, inputPaths []string, outputPath string, opts ...Option) error
+	ConcatenateImagesHorizontallyReader(inputs []io.Reader, w io.Writer) error
+}
+
+// ImageOperator is every operation of a Processor on image files and
+// streams, for code that takes the processor as a whole
+type ImageOperator interface {
+	Resizer
+	Rotator
+	AutoRotator
+	Denoiser
+	Binarizer
+	EdgeDetector
+	Concatenator
+}
+
+// Processor implements every operation interface
+var _ ImageOperator = (*Processor)(nil)
@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeResizer records the images it is asked to resize instead of resizing
+// them; the embedded Resizer covers the methods it does not override
+type fakeResizer struct {
+	Resizer
+	resized []string
+	err     error
+}
+
+func (f *fakeResizer) ResizeImage(inputPath string, outputPath string, width, height uint) error {
+	f.resized = append(f.resized, inputPath)
+	return f.err
+}
+
+// resizeAll stands for a caller's code depending on a Resizer
+func resizeAll(r Resizer, inputPaths []string, outputDir string) error {
+	for _, path := range inputPaths {
+		if err := r.ResizeImage(path, filepath.Join(outputDir, filepath.Base(path)), 100, 100); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestOperatorInterfaces(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	fake := &fakeResizer{}
+	if err := resizeAll(fake, []string{"a.jpg", "b.jpg"}, testDir); err != nil || len(fake.resized) != 2 {
+		t.Errorf("Expected both images passed to the fake, got %v and %v", fake.resized, err)
+	}
+	fake = &fakeResizer{err: &ErrInvalidInput{Path: "a.jpg"}}
+	var invalid *ErrInvalidInput
+	if err := resizeAll(fake, []string{"a.jpg", "b.jpg"}, testDir); !errors.As(err, &invalid) || len(fake.resized) != 1 {
+		t.Errorf("Expected the fake's error after one image, got %v and %v", fake.resized, err)
+	}
+
+	// The same code runs against a real Processor
+	inputPath := filepath.Join(testDir, "test_input_operator.jpg")
+	if err := generateSingleTestImage(inputPath, 120, 80); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	outputDir := filepath.Join(testDir, "out")
+	if err := os.Mkdir(outputDir, 0o755); err != nil {
+		t.Fatalf("Failed to create the output directory: %v", err)
+	}
+	var op ImageOperator = New(nil, nil)
+	if err := resizeAll(op, []string{inputPath}, outputDir); err != nil {
+		t.Fatalf("Failed to resize with a Processor: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "test_input_operator.jpg")); err != nil {
+		t.Errorf("Expected the resized image, got %v", err)
+	}
+}
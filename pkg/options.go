@@ -0,0 +1,160 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nfnt/resize"
+)
+
+// Option tunes an operation. Options are accepted by the functions with the
+// suffix With, such as BinarizeImageWith and ResizeWith, which otherwise
+// behave like the functions without it:
+//
+//	err := processor.BinarizeImageWith("in.jpg", "out.jpg", processor.WithThreshold(100), processor.WithQuality(90))
+//
+// An option that does not apply to an operation is ignored.
+type Option func(*settings)
+
+// settings are the values of the options given to an operation
+type settings struct {
+	// threshold is a fixed threshold; negative lets the operation choose
+	threshold int
+	// kernelSize is the width of the filter window; zero is the default
+	kernelSize int
+	// quality is the JPEG quality; zero is the default
+	quality       int
+	interpolation Interpolation
+	resizeMode    ResizeMode
+	progress      ProgressFunc
+	captions      *CaptionOptions
+	tiled         bool
+	result        *Result
+	buffers       *BufferPool
+	// start is when the operation began, for the elapsed time of the result
+	start time.Time
+}
+
+// WithThreshold sets the gray level separating black from white: Binarize
+// uses it instead of the one found with Otsu's method, and Edges turns
+// gradients at or above it white and the rest black.
+func WithThreshold(threshold uint8) Option {
+	return func(s *settings) {
+		s.threshold = int(threshold)
+	}
+}
+
+// WithKernelSize sets the width in pixels of the filter window, an odd
+// number: 5 gives the 5x5 median filter for Denoise. The default is 3.
+func WithKernelSize(size int) Option {
+	return func(s *settings) {
+		s.kernelSize = size
+	}
+}
+
+// WithQuality sets the JPEG quality of the output, 1-100
+func WithQuality(quality int) Option {
+	return func(s *settings) {
+		s.quality = quality
+	}
+}
+
+// WithInterpolation sets the resampling filter used for resizing. The
+// default is Lanczos3.
+func WithInterpolation(interpolation Interpolation) Option {
+	return func(s *settings) {
+		s.interpolation = interpolation
+	}
+}
+
+// newSettings applies the options of the operation op and checks them
+func newSettings(op string, opts []Option) (*settings, error) {
+	s := &settings{threshold: -1, start: time.Now()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	switch {
+	case s.kernelSize < 0 || (s.kernelSize > 0 && s.kernelSize%2 == 0):
+		return nil, &ErrProcessing{Op: op, Err: fmt.Errorf("kernel size must be a positive odd number, got %d", s.kernelSize)}
+	case s.quality < 0 || s.quality > 100:
+		return nil, &ErrProcessing{Op: op, Err: fmt.Errorf("quality must be between 1 and 100, got %d", s.quality)}
+	case s.interpolation < 0 || int(s.interpolation) >= len(interpolations):
+		return nil, &ErrProcessing{Op: op, Err: fmt.Errorf("unknown interpolation %d", s.interpolation)}
+	}
+	return s, nil
+}
+
+// jpegQuality is the quality set with WithQuality, or def
+func (s *settings) jpegQuality(def int) int {
+	if s.quality > 0 {
+		return s.quality
+	}
+	return def
+}
+
+// radius is the radius of the filter window set with WithKernelSize, or def
+func (s *settings) radius(def int) int {
+	if s.kernelSize > 0 {
+		return s.kernelSize / 2
+	}
+	return def
+}
+
+// Interpolation is a resampling filter for resizing, from the fastest and
+// blockiest to the slowest and sharpest
+type Interpolation int
+
+// Interpolations accepted by WithInterpolation and ResizeOptions
+const (
+	Lanczos3 Interpolation = iota
+	NearestNeighbor
+	Bilinear
+	Bicubic
+	MitchellNetravali
+	Lanczos2
+)
+
+// interpolations are the names and filters of the interpolations, with the
+// kernels of the filters and their number of taps for the tiled resampler
+var interpolations = []struct {
+	name   string
+	filter resize.InterpolationFunction
+	taps   int
+	kernel func(float64) float64
+}{
+	Lanczos3:          {"lanczos3", resize.Lanczos3, 6, lanczos3Kernel},
+	NearestNeighbor:   {"nearest", resize.NearestNeighbor, 2, nearestKernel},
+	Bilinear:          {"bilinear", resize.Bilinear, 2, linearKernel},
+	Bicubic:           {"bicubic", resize.Bicubic, 4, cubicKernel},
+	MitchellNetravali: {"mitchell", resize.MitchellNetravali, 4, mitchellKernel},
+	Lanczos2:          {"lanczos2", resize.Lanczos2, 4, lanczos2Kernel},
+}
+
+// ParseInterpolation parses the name of an interpolation: nearest, bilinear,
+// bicubic, mitchell, lanczos2 or lanczos3, in any case.
+// Returns an error for other names.
+func ParseInterpolation(s string) (Interpolation, error) {
+	for i, interpolation := range interpolations {
+		if strings.EqualFold(s, interpolation.name) {
+			return Interpolation(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown interpolation %q", s)
+}
+
+// String returns the name of the interpolation, as ParseInterpolation accepts it
+func (i Interpolation) String() string {
+	if i < 0 || int(i) >= len(interpolations) {
+		return fmt.Sprintf("Interpolation(%d)", int(i))
+	}
+	return interpolations[i].name
+}
+
+// filter is the resize filter of the interpolation
+func (i Interpolation) filter() resize.InterpolationFunction {
+	if i < 0 || int(i) >= len(interpolations) {
+		return resize.Lanczos3
+	}
+	return interpolations[i].filter
+}
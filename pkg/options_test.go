@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	gradient := image.NewGray(image.Rect(0, 0, 256, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 256; x++ {
+			gradient.SetGray(x, y, color.Gray{uint8(x)})
+		}
+	}
+
+	// A fixed threshold replaces Otsu's
+	binarized, err := BinarizeWith(gradient, WithThreshold(200))
+	if err != nil {
+		t.Fatalf("Failed to binarize: %v", err)
+	}
+	if got := toGray(binarized); got.GrayAt(200, 0).Y != 0 || got.GrayAt(201, 0).Y != 255 {
+		t.Errorf("Expected the threshold at 200, got %d and %d", got.GrayAt(200, 0).Y, got.GrayAt(201, 0).Y)
+	}
+	if !bytes.Equal(toGray(Binarize(gradient)).Pix, toGray(mustApply(t, func() (image.Image, error) { return BinarizeWith(gradient) })).Pix) {
+		t.Error("Expected BinarizeWith without options to match Binarize")
+	}
+
+	// Thresholded edges are black and white
+	edges, err := EdgesWith(gradient, WithThreshold(1))
+	if err != nil {
+		t.Fatalf("Failed to detect edges: %v", err)
+	}
+	for _, v := range toGray(edges).Pix {
+		if v != 0 && v != 255 {
+			t.Fatalf("Expected black and white edges, got gray %d", v)
+		}
+	}
+
+	// A larger kernel removes larger specks
+	speckled := image.NewGray(image.Rect(0, 0, 9, 9))
+	for y := 3; y < 6; y++ {
+		for x := 3; x < 6; x++ {
+			speckled.SetGray(x, y, color.Gray{255})
+		}
+	}
+	small := toGray(mustApply(t, func() (image.Image, error) { return DenoiseWith(speckled, WithKernelSize(3)) }))
+	large := toGray(mustApply(t, func() (image.Image, error) { return DenoiseWith(speckled, WithKernelSize(5)) }))
+	if small.GrayAt(4, 4).Y == 0 || large.GrayAt(4, 4).Y != 0 {
+		t.Errorf("Expected a 3x3 speck to survive a 3x3 filter only, got %d and %d", small.GrayAt(4, 4).Y, large.GrayAt(4, 4).Y)
+	}
+
+	// Interpolation changes the resampling: nearest neighbor keeps fine
+	// stripes black and white where Lanczos averages them
+	stripes := image.NewGray(image.Rect(0, 0, 64, 4))
+	for i := range stripes.Pix {
+		if i%2 == 0 {
+			stripes.Pix[i] = 255
+		}
+	}
+	nearest := toGray(mustApply(t, func() (image.Image, error) { return ResizeWith(stripes, 16, 0, WithInterpolation(NearestNeighbor)) }))
+	lanczos := toGray(mustApply(t, func() (image.Image, error) { return ResizeWith(stripes, 16, 0) }))
+	if bytes.Equal(nearest.Pix, lanczos.Pix) {
+		t.Error("Expected nearest neighbor and Lanczos resizing to differ")
+	}
+
+	for _, opt := range []Option{WithKernelSize(4), WithKernelSize(-1), WithQuality(101), WithInterpolation(Interpolation(99))} {
+		_, err := DenoiseWith(speckled, opt)
+		var procErr *ErrProcessing
+		if !errors.As(err, &procErr) || procErr.Op != "denoise" {
+			t.Errorf("Expected an invalid option to fail, got %v", err)
+		}
+	}
+}
+
+func TestOptionsQuality(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	inputPath := filepath.Join(testDir, "test_input_options.jpg")
+	if err := generateSingleTestImage(inputPath, 120, 80); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	sizes := map[int]int64{}
+	for _, quality := range []int{10, 95} {
+		outputPath := filepath.Join(testDir, "test_output_options.jpg")
+		if err := RotateImageWith(inputPath, outputPath, 10, WithQuality(quality)); err != nil {
+			t.Fatalf("Failed to rotate: %v", err)
+		}
+		info, err := os.Stat(outputPath)
+		if err != nil {
+			t.Fatalf("Failed to stat output: %v", err)
+		}
+		sizes[quality] = info.Size()
+	}
+	if sizes[10] >= sizes[95] {
+		t.Errorf("Expected quality 10 to be smaller than quality 95, got %v", sizes)
+	}
+}
+
+func TestParseInterpolation(t *testing.T) {
+	for _, interpolation := range []Interpolation{NearestNeighbor, Bilinear, Bicubic, MitchellNetravali, Lanczos2, Lanczos3} {
+		parsed, err := ParseInterpolation(interpolation.String())
+		if err != nil || parsed != interpolation {
+			t.Errorf("ParseInterpolation(%q) = %v, %v", interpolation.String(), parsed, err)
+		}
+	}
+	if parsed, err := ParseInterpolation("Bicubic"); err != nil || parsed != Bicubic {
+		t.Errorf("Expected names to be case-insensitive, got %v, %v", parsed, err)
+	}
+	if _, err := ParseInterpolation("sinc"); err == nil {
+		t.Error("Expected an unknown interpolation to fail")
+	}
+}
+
+// mustApply returns the image fn returns, failing the test on an error
+func mustApply(t *testing.T, fn func() (image.Image, error)) image.Image {
+	t.Helper()
+	img, err := fn()
+	if err != nil {
+		t.Fatalf("Failed to process image: %v", err)
+	}
+	return img
+}
@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"image"
+	"log/slog"
+	"math"
+)
+
+// orientationMargin is how much more sky-like a side must be than the top
+// before the content heuristic turns the image
+const orientationMargin = 0.2
+
+// applyOrientation returns the image transformed so that it displays upright
+// for the given EXIF orientation value (1 to 8)
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	outW, outH := w, h
+	if orientation >= 5 {
+		outW, outH = h, w
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, outW, outH))
+	for y := 0; y < outH; y++ {
+		for x := 0; x < outW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // needs 90 degrees clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // needs 90 degrees counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			out.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return out
+}
+
+// orientationForTurns returns the EXIF orientation value that rotates an image
+// clockwise by the given number of quarter turns
+func orientationForTurns(turns int) int {
+	switch ((turns % 4) + 4) % 4 {
+	case 1:
+		return 6
+	case 2:
+		return 3
+	case 3:
+		return 8
+	}
+	return 1
+}
+
+// detectUprightTurns estimates how many clockwise quarter turns make a photo
+// upright. Each side of the image is scored by how "sky"-like it is (bright,
+// bluish and with few edges); when a side other than the top clearly wins,
+// the image is turned so that side ends up on top. Returns 0 when unsure.
+func detectUprightTurns(img image.Image) int {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	step := int(math.Max(1, math.Max(float64(w), float64(h))/200))
+	sw, sh := w/step, h/step
+	if sw < 8 || sh < 8 {
+		return 0
+	}
+
+	luma := make([]float64, sw*sh)
+	blue := make([]float64, sw*sh)
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x*step, bounds.Min.Y+y*step).RGBA()
+			rf, gf, bf := float64(r>>8), float64(g>>8), float64(b>>8)
+			luma[y*sw+x] = (0.299*rf + 0.587*gf + 0.114*bf) / 255
+			blue[y*sw+x] = math.Max(0, bf-(rf+gf)/2) / 255
+		}
+	}
+
+	// score averages the sky-likeness of the rectangle [x0,x1)x[y0,y1)
+	score := func(x0, y0, x1, y1 int) float64 {
+		var brightness, blueness, edges, n float64
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				i := y*sw + x
+				brightness += luma[i]
+				blueness += blue[i]
+				if x+1 < sw && y+1 < sh {
+					gradient := math.Abs(luma[i+1]-luma[i]) + math.Abs(luma[i+sw]-luma[i])
+					if gradient > 0.12 {
+						edges++
+					}
+				}
+				n++
+			}
+		}
+		return (brightness/n)*(1-edges/n) + blueness/n
+	}
+
+	// Scores for top, right, bottom, left; index k needs (4-k)%4 clockwise turns
+	sides := []float64{
+		score(0, 0, sw, sh/4),
+		score(sw*3/4, 0, sw, sh),
+		score(0, sh*3/4, sw, sh),
+		score(0, 0, sw/4, sh),
+	}
+
+	best := 0
+	for k, s := range sides {
+		if s > sides[best] {
+			best = k
+		}
+	}
+	slog.Debug("orientation scores",
+		"top", sides[0],
+		"right", sides[1],
+		"bottom", sides[2],
+		"left", sides[3])
+
+	if best == 0 || sides[best]-sides[0] < orientationMargin {
+		return 0
+	}
+	return (4 - best) % 4
+}
+
+// uprightImage turns the image upright using its EXIF orientation, falling back
+// to the content heuristic when the source has no orientation tag and content
+// is set. The EXIF metadata may be nil.
+func uprightImage(img image.Image, exif *exifInfo, content bool) image.Image {
+	if exif != nil && exif.Orientation > 1 {
+		slog.Info("applying EXIF orientation", "orientation", exif.Orientation)
+		return applyOrientation(img, exif.Orientation)
+	}
+	if !content {
+		return img
+	}
+
+	if turns := detectUprightTurns(img); turns != 0 {
+		slog.Info("turning image upright from content", "degrees", turns*90)
+		return applyOrientation(img, orientationForTurns(turns))
+	}
+	return img
+}
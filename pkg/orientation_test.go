@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyOrientation(t *testing.T) {
+	// 3x2 image with a marker in the top-left corner
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.White)
+
+	tests := []struct {
+		orientation int
+		w, h        int
+		marker      image.Point
+	}{
+		{1, 3, 2, image.Pt(0, 0)},
+		{3, 3, 2, image.Pt(2, 1)},
+		{6, 2, 3, image.Pt(1, 0)},
+		{8, 2, 3, image.Pt(0, 2)},
+	}
+	for _, tt := range tests {
+		out := applyOrientation(img, tt.orientation)
+		if out.Bounds().Dx() != tt.w || out.Bounds().Dy() != tt.h {
+			t.Errorf("Orientation %d: expected %dx%d, got %v", tt.orientation, tt.w, tt.h, out.Bounds())
+			continue
+		}
+		if r, _, _, _ := out.At(tt.marker.X, tt.marker.Y).RGBA(); r != 0xffff {
+			t.Errorf("Orientation %d: expected marker at %v", tt.orientation, tt.marker)
+		}
+	}
+}
+
+func TestDetectUprightTurns(t *testing.T) {
+	// A landscape turned on its side: bright blue sky on the left, busy ground on the right
+	img := image.NewRGBA(image.Rect(0, 0, 200, 120))
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 200; x++ {
+			if x < 80 {
+				img.Set(x, y, color.RGBA{R: 150, G: 190, B: 250, A: 255})
+			} else if (x/3+y/3)%2 == 0 {
+				img.Set(x, y, color.RGBA{R: 40, G: 90, B: 30, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{R: 120, G: 100, B: 60, A: 255})
+			}
+		}
+	}
+
+	if turns := detectUprightTurns(img); turns != 1 {
+		t.Errorf("Expected 1 clockwise quarter turn, got %d", turns)
+	}
+	if turns := detectUprightTurns(applyOrientation(img, 6)); turns != 0 {
+		t.Errorf("Expected an upright image to stay, got %d turns", turns)
+	}
+
+	// The heuristic only runs when asked for
+	if b := AutoRotate(img).Bounds(); b.Dx() < b.Dy() {
+		t.Errorf("Expected AutoRotate to leave the image sideways, got %v", b)
+	}
+	turned, _, err := AutoRotateWithOptions(img, AutoRotateOptions{Content: true})
+	if err != nil {
+		t.Fatalf("Failed to auto-rotate image: %v", err)
+	}
+	if b := turned.Bounds(); b.Dx() > b.Dy() {
+		t.Errorf("Expected the content heuristic to turn the image upright, got %v", b)
+	}
+}
+
+func TestAutoRotateImageUprightDocument(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// A letter page with lines of text in its top half and a blank bottom half
+	page := image.NewRGBA(image.Rect(0, 0, 170, 220))
+	draw.Draw(page, page.Bounds(), image.White, image.Point{}, draw.Src)
+	for y := 20; y < 110; y += 8 {
+		for x := 15; x < 155; x++ {
+			if (x/4)%3 != 0 {
+				page.Set(x, y, color.Black)
+				page.Set(x, y+1, color.Black)
+			}
+		}
+	}
+	inputPath := filepath.Join(testDir, "test_input_letter.png")
+	outputPath := filepath.Join(testDir, "test_output_letter.jpg")
+	if err := savePNG(inputPath, page); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+
+	if err := AutoRotateImage(inputPath, outputPath); err != nil {
+		t.Fatalf("Failed to auto-rotate image: %v", err)
+	}
+	out, err := loadImage(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to load output: %v", err)
+	}
+	h := out.Bounds().Dy()
+	if h <= out.Bounds().Dx() {
+		t.Fatalf("Expected the page to stay portrait, got %v", out.Bounds())
+	}
+	if top, bottom := meanLuma(out, 0, h/2), meanLuma(out, h/2, h); top >= bottom {
+		t.Errorf("Expected the text to stay in the top half, got mean luma %v on top and %v at the bottom", top, bottom)
+	}
+}
+
+// meanLuma averages the gray level of the rows [y0,y1) of img
+func meanLuma(img image.Image, y0, y1 int) float64 {
+	bounds := img.Bounds()
+	var sum float64
+	for y := bounds.Min.Y + y0; y < bounds.Min.Y+y1; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			sum += float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+		}
+	}
+	return sum / float64((y1-y0)*bounds.Dx())
+}
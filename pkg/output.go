@@ -0,0 +1,202 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// tempSeq makes temporary output names unique within the process
+var tempSeq atomic.Uint64
+
+// outputFile is an output being written to a temporary file. The destination
+// path only ever holds a complete file: Commit renames the temporary file into
+// place, and Close without Commit discards it.
+type outputFile struct {
+	file      *os.File
+	path      string
+	committed bool
+	// memory, when set, receives the data instead of a file, for an output
+	// captured with captureOutput; data collects it until Commit
+	memory *memoryOutput
+	data   bytes.Buffer
+	// proc is the Processor whose configuration and logger apply
+	proc *Processor
+}
+
+// memoryOutput is the data of an output kept in memory
+type memoryOutput struct {
+	data      []byte
+	committed bool
+}
+
+// memoryOutputs are the outputs captured with captureOutput, by path
+var memoryOutputs sync.Map
+
+// captureOutput runs fn keeping the output written to path in memory: the
+// data fn writes there through createOutput never reaches the disk.
+// Returns the data, or an error if fn fails or writes nothing to path.
+func captureOutput(path string, fn func() error) ([]byte, error) {
+	memory := &memoryOutput{}
+	memoryOutputs.Store(path, memory)
+	defer memoryOutputs.Delete(path)
+	if err := fn(); err != nil {
+		return nil, err
+	}
+	if !memory.committed {
+		return nil, &ErrInvalidOutput{Path: path, Err: errors.New("the operation wrote no output")}
+	}
+	return memory.data, nil
+}
+
+// createOutput starts writing the file at path. The temporary file is created
+// in the configured TempDir, or next to the destination when none is set.
+func (p *Processor) createOutput(path string) (*outputFile, error) {
+	if memory, ok := memoryOutputs.Load(path); ok {
+		return &outputFile{path: path, memory: memory.(*memoryOutput), proc: p}, nil
+	}
+	dir := p.Config().TempDir
+	if dir == "" {
+		dir = filepath.Dir(path)
+	}
+	f, err := createTemp(dir, path)
+	if err != nil {
+		return nil, &ErrInvalidOutput{Path: path, Err: err}
+	}
+	return &outputFile{file: f, path: path, proc: p}, nil
+}
+
+// createOutput is Processor.createOutput on the default Processor
+func createOutput(path string) (*outputFile, error) {
+	return defaultProcessor.createOutput(path)
+}
+
+// Write writes to the temporary file, or to memory for a captured output
+func (o *outputFile) Write(b []byte) (int, error) {
+	if o.memory != nil {
+		return o.data.Write(b)
+	}
+	return o.file.Write(b)
+}
+
+// Chmod changes the mode of the temporary file; a captured output has none
+func (o *outputFile) Chmod(mode os.FileMode) error {
+	if o.memory != nil {
+		return nil
+	}
+	return o.file.Chmod(mode)
+}
+
+// Commit flushes the temporary file, syncing it to disk when Fsync is enabled,
+// and renames it to the destination path. A warning is logged when the
+// extension of the destination names a different format than the data.
+func (o *outputFile) Commit() error {
+	if o.memory != nil {
+		warnExtensionMismatch(o.proc.logger(), o.path, o.data.Bytes()[:min(o.data.Len(), 12)])
+		o.memory.data, o.memory.committed = o.data.Bytes(), true
+		o.committed = true
+		return nil
+	}
+	header := make([]byte, 12)
+	n, _ := o.file.ReadAt(header, 0)
+	warnExtensionMismatch(o.proc.logger(), o.path, header[:n])
+
+	fsync := o.proc.Config().Fsync
+	if fsync {
+		if err := o.file.Sync(); err != nil {
+			return &ErrProcessing{Op: "write", Err: err}
+		}
+	}
+	if err := o.file.Close(); err != nil {
+		return &ErrProcessing{Op: "write", Err: err}
+	}
+	if err := os.Rename(o.file.Name(), o.path); err != nil {
+		if !errors.Is(err, syscall.EXDEV) {
+			return &ErrInvalidOutput{Path: o.path, Err: err}
+		}
+		// The temporary directory is on another filesystem, so stage a copy
+		// next to the destination where the rename is atomic.
+		if err := moveAcrossDevices(o.file.Name(), o.path, fsync); err != nil {
+			return err
+		}
+	}
+	o.committed = true
+	if fsync {
+		syncDir(filepath.Dir(o.path))
+	}
+	return nil
+}
+
+// Close discards the temporary file unless the output was committed
+func (o *outputFile) Close() error {
+	if o.committed || o.memory != nil {
+		return nil
+	}
+	o.file.Close()
+	return os.Remove(o.file.Name())
+}
+
+// moveAcrossDevices copies src into a temporary file in the destination
+// directory, renames it over dst and removes src
+func moveAcrossDevices(src, dst string, fsync bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return &ErrProcessing{Op: "write", Err: err}
+	}
+	defer in.Close()
+
+	out, err := createTemp(filepath.Dir(dst), dst)
+	if err != nil {
+		return &ErrInvalidOutput{Path: dst, Err: err}
+	}
+	defer os.Remove(out.Name())
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return &ErrProcessing{Op: "write", Err: err}
+	}
+	if fsync {
+		if err := out.Sync(); err != nil {
+			out.Close()
+			return &ErrProcessing{Op: "write", Err: err}
+		}
+	}
+	if err := out.Close(); err != nil {
+		return &ErrProcessing{Op: "write", Err: err}
+	}
+	if err := os.Rename(out.Name(), dst); err != nil {
+		return &ErrInvalidOutput{Path: dst, Err: err}
+	}
+	os.Remove(src)
+	return nil
+}
+
+// createTemp creates a hidden temporary file for path in dir. Unlike
+// os.CreateTemp it uses the same permissions as os.Create, so the committed
+// output gets the mode the user's umask asks for.
+func createTemp(dir, path string) (*os.File, error) {
+	for {
+		name := filepath.Join(dir, hiddenName(filepath.Base(path), ".tmp-"+
+			strconv.Itoa(os.Getpid())+"-"+strconv.FormatUint(tempSeq.Add(1), 10)))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if !errors.Is(err, os.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+// syncDir flushes a directory entry so a completed rename survives a crash.
+// Not every platform supports syncing directories, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
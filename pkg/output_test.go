@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicOutput(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	inputPath := filepath.Join(testDir, "input.jpg")
+	if err := generateSingleTestImage(inputPath, 64, 48); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	tmpDir := filepath.Join(testDir, "tmp")
+	if err := os.Mkdir(tmpDir, 0o755); err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	original := currentConfig()
+	defer SetConfig(original)
+	c := *original
+	c.TempDir = tmpDir
+	c.Fsync = true
+	SetConfig(&c)
+
+	outputPath := filepath.Join(testDir, "output.jpg")
+	if err := BinarizeImage(inputPath, outputPath); err != nil {
+		t.Fatalf("BinarizeImage failed: %v", err)
+	}
+	if _, err := os.Stat(outputPath); err != nil {
+		t.Fatalf("Output was not renamed into place: %v", err)
+	}
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read temp directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Temporary files left behind: %d", len(entries))
+	}
+
+	// An abandoned output must not replace the existing file
+	before, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	out, err := createOutput(outputPath)
+	if err != nil {
+		t.Fatalf("createOutput failed: %v", err)
+	}
+	if _, err := out.Write([]byte("truncated")); err != nil {
+		t.Fatalf("Failed to write output: %v", err)
+	}
+	out.Close()
+	after, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if string(after) != string(before) {
+		t.Error("Abandoned output replaced the existing file")
+	}
+	if _, err := os.Stat(out.file.Name()); !os.IsNotExist(err) {
+		t.Errorf("Abandoned temporary file was not removed: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// PadImage adds borders of the given widths in pixels to the sides of the
+// input image, as Pad.
+// It takes the paths of the input and output files, the widths of the top,
+// right, bottom and left borders and their color.
+// Returns an error if a width is negative or the operation fails.
+func PadImage(inputPath string, outputPath string, top, right, bottom, left int, bg color.Color) error {
+	return defaultProcessor.PadImage(inputPath, outputPath, top, right, bottom, left, bg)
+}
+
+// PadImage is the package function PadImage with the configuration and logger of p
+func (p *Processor) PadImage(inputPath string, outputPath string, top, right, bottom, left int, bg color.Color) error {
+	p.logger().Info("padding image",
+		"input", inputPath,
+		"output", outputPath,
+		"top", top,
+		"right", right,
+		"bottom", bottom,
+		"left", left)
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	padded, err := Pad(img, top, right, bottom, left, bg)
+	if err != nil {
+		return err
+	}
+	return p.saveJPEG(outputPath, padded)
+}
+
+// PadImageReader adds borders to the image read from r and writes it to w as
+// JPEG, like PadImage.
+// Returns an error if a width is negative or the operation fails.
+func PadImageReader(r io.Reader, w io.Writer, top, right, bottom, left int, bg color.Color) error {
+	img, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	padded, err := Pad(img, top, right, bottom, left, bg)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, padded)
+}
+
+// ExtendImage extends the canvas of the input image to an aspect ratio, as
+// ExtendToAspect.
+// It takes the paths of the input and output files, the terms of the aspect
+// ratio, such as 16 and 9, the gravity placing the image and the color of
+// the added area.
+// Returns an error if the aspect ratio is invalid or the operation fails.
+func ExtendImage(inputPath string, outputPath string, aspectWidth, aspectHeight float64, g Gravity, bg color.Color) error {
+	return defaultProcessor.ExtendImage(inputPath, outputPath, aspectWidth, aspectHeight, g, bg)
+}
+
+// ExtendImage is the package function ExtendImage with the configuration and logger of p
+func (p *Processor) ExtendImage(inputPath string, outputPath string, aspectWidth, aspectHeight float64, g Gravity, bg color.Color) error {
+	p.logger().Info("extending image",
+		"input", inputPath,
+		"output", outputPath,
+		"aspect", fmt.Sprintf("%g:%g", aspectWidth, aspectHeight),
+		"gravity", g)
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	extended, err := ExtendToAspect(img, aspectWidth, aspectHeight, g, bg)
+	if err != nil {
+		return err
+	}
+	return p.saveJPEG(outputPath, extended)
+}
+
+// Pad returns the image with borders of the given widths in pixels added to
+// its top, right, bottom and left sides, filled with bg; a nil bg is white.
+// Transparent parts of the image show the background, and 16-bit images keep
+// their depth. Borders give images a frame or a gap before concatenation.
+// Returns an error if a width is negative or the padded image would exceed
+// 2^28 pixels.
+func Pad(img image.Image, top, right, bottom, left int, bg color.Color) (image.Image, error) {
+	if top < 0 || right < 0 || bottom < 0 || left < 0 {
+		return nil, &ErrProcessing{Op: "pad", Err: fmt.Errorf("borders must not be negative, got %d,%d,%d,%d", top, right, bottom, left)}
+	}
+	// Bounding each border first keeps the sums below from overflowing
+	bounds := img.Bounds()
+	if max(top, right, bottom, left) > maxOutputPixels ||
+		int64(left+bounds.Dx()+right)*int64(top+bounds.Dy()+bottom) > maxOutputPixels {
+		return nil, &ErrProcessing{Op: "pad", Err: fmt.Errorf("borders %d,%d,%d,%d make the image larger than %d pixels", top, right, bottom, left, maxOutputPixels)}
+	}
+	if bg == nil {
+		bg = color.White
+	}
+	size := image.Rect(0, 0, left+bounds.Dx()+right, top+bounds.Dy()+bottom)
+	var dst draw.Image
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		dst = image.NewRGBA64(size)
+	default:
+		dst = image.NewRGBA(size)
+	}
+	draw.Draw(dst, size, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Copy(dst, image.Pt(left, top), img, bounds, draw.Over, nil)
+	return dst, nil
+}
+
+// ExtendToAspect pads the image to the aspect ratio aspectWidth:aspectHeight,
+// the way a film is letterboxed: the canvas grows in width or in height, never
+// both, and the gravity places the image in it, so that images of different
+// shapes line up when they are concatenated or tiled. An image already at the
+// aspect ratio is returned as a copy. A nil bg is white.
+// Returns an error if a term of the aspect ratio is not positive and finite,
+// or the canvas would exceed 2^28 pixels.
+func ExtendToAspect(img image.Image, aspectWidth, aspectHeight float64, g Gravity, bg color.Color) (image.Image, error) {
+	if !(aspectWidth > 0) || !(aspectHeight > 0) || math.IsInf(aspectWidth, 0) || math.IsInf(aspectHeight, 0) {
+		return nil, &ErrProcessing{Op: "extend", Err: fmt.Errorf("aspect ratio must be positive, got %g:%g", aspectWidth, aspectHeight)}
+	}
+	size := img.Bounds().Size()
+	canvas := aspectCanvas(size, aspectWidth, aspectHeight)
+	at := g.Place(image.Rectangle{Max: canvas}, size, 0)
+	return Pad(img, at.Min.Y, canvas.X-at.Max.X, canvas.Y-at.Max.Y, at.Min.X, bg)
+}
+
+// aspectCanvas returns the size of the canvas ExtendToAspect pads an image of
+// the given size to. A side is clamped just past maxOutputPixels, which Pad
+// rejects, so that extreme ratios do not overflow.
+func aspectCanvas(size image.Point, aspectWidth, aspectHeight float64) image.Point {
+	canvas := size
+	ratio := aspectWidth / aspectHeight
+	if float64(size.X) < float64(size.Y)*ratio {
+		canvas.X = int(min(math.Round(float64(size.Y)*ratio), maxOutputPixels+1))
+	} else {
+		canvas.Y = int(min(math.Round(float64(size.X)/ratio), maxOutputPixels+1))
+	}
+	return image.Pt(max(canvas.X, size.X), max(canvas.Y, size.Y))
+}
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPad(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for i := range img.Pix {
+		img.Pix[i] = 0x40
+	}
+	black := color.RGBA{0, 0, 0, 0xff}
+
+	padded, err := Pad(img, 1, 2, 3, 4, black)
+	if err != nil {
+		t.Fatalf("Pad failed: %v", err)
+	}
+	if want := image.Rect(0, 0, 46, 24); padded.Bounds() != want {
+		t.Errorf("Expected %v, got %v", want, padded.Bounds())
+	}
+	for _, pt := range []image.Point{{0, 0}, {3, 5}, {45, 10}, {20, 23}, {20, 0}} {
+		if got := color.RGBAModel.Convert(padded.At(pt.X, pt.Y)); got != black {
+			t.Errorf("Expected the border at %v, got %v", pt, got)
+		}
+	}
+	if r, _, _, _ := padded.At(4, 1).RGBA(); r>>8 != 0x40 {
+		t.Errorf("Expected the image at the top left corner inside the borders, got %d", r>>8)
+	}
+	white, _ := Pad(img, 1, 0, 0, 0, nil)
+	if got := color.RGBAModel.Convert(white.At(0, 0)); got != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("Expected a white border by default, got %v", got)
+	}
+	if deep, _ := Pad(image.NewGray16(image.Rect(0, 0, 4, 4)), 1, 1, 1, 1, nil); deep.ColorModel() != color.RGBA64Model {
+		t.Errorf("Expected a 16-bit image to stay 16-bit, got %T", deep)
+	}
+	if _, err := Pad(img, 0, -1, 0, 0, nil); err == nil {
+		t.Error("Expected an error for a negative border")
+	}
+	for _, border := range []int{1 << 20, math.MaxInt} {
+		if _, err := Pad(img, border, border, border, border, nil); err == nil {
+			t.Errorf("Expected an error for %d pixel borders", border)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		aw, ah float64
+		g      Gravity
+		size   image.Point
+		at     image.Point
+	}{
+		{"square center", 1, 1, GravityCenter, image.Pt(40, 40), image.Pt(0, 10)},
+		{"square north", 1, 1, GravityNorth, image.Pt(40, 40), image.Pt(0, 0)},
+		{"wide east", 4, 1, GravityEast, image.Pt(80, 20), image.Pt(40, 0)},
+		{"same", 2, 1, GravityCenter, image.Pt(40, 20), image.Pt(0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extended, err := ExtendToAspect(img, tt.aw, tt.ah, tt.g, black)
+			if err != nil {
+				t.Fatalf("ExtendToAspect failed: %v", err)
+			}
+			if want := (image.Rectangle{Max: tt.size}); extended.Bounds() != want {
+				t.Errorf("Expected %v, got %v", want, extended.Bounds())
+			}
+			if r, _, _, _ := extended.At(tt.at.X, tt.at.Y).RGBA(); r>>8 != 0x40 {
+				t.Errorf("Expected the image to start at %v", tt.at)
+			}
+		})
+	}
+	for _, aspect := range [][2]float64{{0, 1}, {math.Inf(1), 1}, {1e300, 1}} {
+		if _, err := ExtendToAspect(img, aspect[0], aspect[1], GravityCenter, nil); err == nil {
+			t.Errorf("Expected an error for the aspect ratio %g:%g", aspect[0], aspect[1])
+		}
+	}
+
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	input := writeTestImage(t, testDir, "test_input.png", img, encodePNGBuffer)
+	output := filepath.Join(testDir, "test_output.jpg")
+	if err := PadImage(input, output, 5, 5, 5, 5, black); err != nil {
+		t.Fatalf("PadImage failed: %v", err)
+	}
+	if got := decodeTestFile(t, output).Bounds(); got != image.Rect(0, 0, 50, 30) {
+		t.Errorf("Expected a 50x30 output, got %v", got)
+	}
+	if err := ExtendImage(input, output, 16, 9, GravityCenter, nil); err != nil {
+		t.Fatalf("ExtendImage failed: %v", err)
+	}
+	if got := decodeTestFile(t, output).Bounds(); got != image.Rect(0, 0, 40, 23) {
+		t.Errorf("Expected a 40x23 output, got %v", got)
+	}
+}
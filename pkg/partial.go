@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// errNotTruncated is returned by decodeTruncated for data it cannot recover
+var errNotTruncated = errors.New("not a recoverable truncated image")
+
+// pngEnd is the IEND chunk that ends every complete PNG
+var pngEnd = []byte("IEND\xaeB`\x82")
+
+// maxTruncatedPixels bounds the size of a truncated PNG that is rebuilt, so a
+// forged header cannot make the decoder allocate an unbounded buffer
+const maxTruncatedPixels = 1 << 26
+
+// decodeTruncated decodes what is available of a partially downloaded image.
+// A progressive JPEG is cut after its last complete scan, giving a lower
+// quality version of the whole picture. The missing rows of a PNG are filled
+// with zeros; for an interlaced PNG the complete early passes still cover the
+// whole picture at a lower resolution.
+func decodeTruncated(data []byte) (image.Image, error) {
+	switch {
+	case bytes.HasSuffix(data, []byte{0xff, 0xd9}), bytes.HasSuffix(data, pngEnd):
+		// The file is complete, so the decoding error is not due to truncation
+		return nil, errNotTruncated
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return decodeTruncatedJPEG(data)
+	case bytes.HasPrefix(data, []byte(pngSignature)):
+		return decodeTruncatedPNG(data)
+	}
+	return nil, errNotTruncated
+}
+
+// decodeTruncatedJPEG drops the incomplete last scan and terminates the stream
+func decodeTruncatedJPEG(data []byte) (image.Image, error) {
+	// Walk back over start-of-scan markers until the scans before one decode
+	end := len(data)
+	for {
+		sos := bytes.LastIndex(data[:end], []byte{0xff, 0xda})
+		if sos < 0 {
+			return nil, errNotTruncated
+		}
+		repaired := append(append([]byte(nil), data[:sos]...), 0xff, 0xd9)
+		if img, err := jpeg.Decode(bytes.NewReader(repaired)); err == nil {
+			return img, nil
+		}
+		end = sos
+	}
+}
+
+// decodeTruncatedPNG rebuilds a complete PNG from the chunks that arrived,
+// padding the image data with zeros
+func decodeTruncatedPNG(data []byte) (image.Image, error) {
+	pos := len(pngSignature)
+	var ihdr []byte
+	var chunks [][2][]byte
+	var idat bytes.Buffer
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		name := data[pos+4 : pos+8]
+		end := min(pos+8+length, len(data))
+		body := data[pos+8 : end]
+		switch string(name) {
+		case "IHDR":
+			ihdr = body
+		case "IDAT":
+			idat.Write(body)
+		case "PLTE", "tRNS":
+			chunks = append(chunks, [2][]byte{name, body})
+		}
+		pos = end + 4
+	}
+	if len(ihdr) != 13 {
+		return nil, errNotTruncated
+	}
+	size, ok := pngRawSize(ihdr)
+	if !ok {
+		return nil, errNotTruncated
+	}
+
+	// Inflate as much as possible; the stream ends early. Data beyond what the
+	// header describes is dropped and missing data is padded with zeros.
+	var raw bytes.Buffer
+	if zr, err := zlib.NewReader(&idat); err == nil {
+		_, _ = io.CopyN(&raw, zr, int64(size))
+	}
+	if raw.Len() < size {
+		raw.Write(make([]byte, size-raw.Len()))
+	}
+
+	var out bytes.Buffer
+	out.WriteString(pngSignature)
+	writeChunk := func(name string, body []byte) {
+		var header [8]byte
+		binary.BigEndian.PutUint32(header[:4], uint32(len(body)))
+		copy(header[4:], name)
+		out.Write(header[:])
+		out.Write(body)
+		var crc [4]byte
+		binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(append([]byte(name), body...)))
+		out.Write(crc[:])
+	}
+	writeChunk("IHDR", ihdr)
+	for _, chunk := range chunks {
+		writeChunk(string(chunk[0]), chunk[1])
+	}
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(raw.Bytes()[:size])
+	zw.Close()
+	writeChunk("IDAT", compressed.Bytes())
+	writeChunk("IEND", nil)
+
+	return png.Decode(&out)
+}
+
+// pngRawSize returns the size of the inflated image data described by an IHDR,
+// including the filter byte of every row of every pass. It reports false for
+// an invalid bit depth or for dimensions beyond maxTruncatedPixels.
+func pngRawSize(ihdr []byte) (int, bool) {
+	width := uint64(binary.BigEndian.Uint32(ihdr[0:4]))
+	height := uint64(binary.BigEndian.Uint32(ihdr[4:8]))
+	if width == 0 || height == 0 || width > maxTruncatedPixels/height {
+		return 0, false
+	}
+	switch ihdr[8] {
+	case 1, 2, 4, 8, 16:
+	default:
+		return 0, false
+	}
+	hdr := pngHeader{
+		width:     int(width),
+		height:    int(height),
+		bitDepth:  ihdr[8],
+		colorType: ihdr[9],
+		interlace: ihdr[12] == 1,
+	}
+	passes := noInterlacePass
+	if hdr.interlace {
+		passes = adam7Passes
+	}
+	bitsPerPixel := hdr.channels() * int(hdr.bitDepth)
+	size := 0
+	for _, pass := range passes {
+		width := (hdr.width - pass.x0 + pass.dx - 1) / pass.dx
+		height := (hdr.height - pass.y0 + pass.dy - 1) / pass.dy
+		if width > 0 && height > 0 {
+			size += height * (1 + (width*bitsPerPixel+7)/8)
+		}
+	}
+	return size, true
+}
@@ -0,0 +1,150 @@
+package processor
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertImageInterlaced(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_interlace.jpg")
+	plainPath := filepath.Join(testDir, "test_output_plain.png")
+	interlacedPath := filepath.Join(testDir, "test_output_interlaced.png")
+	if err := generateSingleTestImage(testInputPath, 37, 23); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	for _, colorType := range []string{ColorTypeGray, ColorTypeRGB} {
+		if err := ConvertImage(testInputPath, plainPath, ConvertOptions{ColorType: colorType}); err != nil {
+			t.Fatalf("Failed to convert image: %v", err)
+		}
+		if err := ConvertImage(testInputPath, interlacedPath, ConvertOptions{ColorType: colorType, Interlace: true}); err != nil {
+			t.Fatalf("Failed to convert interlaced image: %v", err)
+		}
+
+		data, err := os.ReadFile(interlacedPath)
+		if err != nil {
+			t.Fatalf("Failed to read output: %v", err)
+		}
+		if data[28] != 1 {
+			t.Errorf("Expected the interlace method to be Adam7, got %d", data[28])
+		}
+
+		plain, err := loadImage(plainPath)
+		if err != nil {
+			t.Fatalf("Failed to load plain PNG: %v", err)
+		}
+		interlaced, err := loadImage(interlacedPath)
+		if err != nil {
+			t.Fatalf("Failed to load interlaced PNG: %v", err)
+		}
+		a, b := toRGBA(plain), toRGBA(interlaced)
+		for i := range a.Pix {
+			if a.Pix[i] != b.Pix[i] {
+				t.Fatalf("%s: interlaced pixels differ from plain pixels at byte %d", colorType, i)
+			}
+		}
+	}
+}
+
+func TestLoadTruncatedPNG(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_truncated.jpg")
+	fullPath := filepath.Join(testDir, "test_full.png")
+	truncatedPath := filepath.Join(testDir, "test_truncated.png")
+	if err := generateSingleTestImage(testInputPath, 64, 64); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	if err := ConvertImage(testInputPath, fullPath, ConvertOptions{ColorType: ColorTypeRGB, Interlace: true}); err != nil {
+		t.Fatalf("Failed to convert image: %v", err)
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		t.Fatalf("Failed to read PNG: %v", err)
+	}
+	if err := os.WriteFile(truncatedPath, data[:len(data)*3/4], 0644); err != nil {
+		t.Fatalf("Failed to write truncated PNG: %v", err)
+	}
+
+	img, err := loadImage(truncatedPath)
+	if err != nil {
+		t.Fatalf("Failed to load truncated PNG: %v", err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 64 {
+		t.Errorf("Expected a 64x64 image, got %v", img.Bounds())
+	}
+
+	// The first Adam7 pass has fully arrived, so its pixels are intact
+	full, err := loadImage(fullPath)
+	if err != nil {
+		t.Fatalf("Failed to load full PNG: %v", err)
+	}
+	if toRGBA(full).RGBAAt(8, 8) != toRGBA(img).RGBAAt(8, 8) {
+		t.Errorf("Expected the first pass pixels to survive truncation")
+	}
+}
+
+func TestLoadTruncatedBaselineJPEG(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// A baseline JPEG has a single scan, so nothing can be recovered
+	testInputPath := filepath.Join(testDir, "test_input_truncated.jpg")
+	if err := generateSingleTestImage(testInputPath, 64, 64); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	data, err := os.ReadFile(testInputPath)
+	if err != nil {
+		t.Fatalf("Failed to read JPEG: %v", err)
+	}
+	if err := os.WriteFile(testInputPath, data[:len(data)/2], 0644); err != nil {
+		t.Fatalf("Failed to write truncated JPEG: %v", err)
+	}
+	if _, err := loadImage(testInputPath); err == nil {
+		t.Errorf("Expected an error for a truncated baseline JPEG")
+	}
+}
+
+func TestDecodeTruncatedPNGForgedHeader(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_forged.jpg")
+	fullPath := filepath.Join(testDir, "test_forged.png")
+	if err := generateSingleTestImage(testInputPath, 64, 64); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	if err := ConvertImage(testInputPath, fullPath, ConvertOptions{ColorType: ColorTypeRGB}); err != nil {
+		t.Fatalf("Failed to convert image: %v", err)
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		t.Fatalf("Failed to read PNG: %v", err)
+	}
+	truncated := data[:len(data)*3/4]
+
+	// A header smaller than the image data keeps only the rows it describes
+	short := append([]byte(nil), truncated...)
+	binary.BigEndian.PutUint32(short[20:24], 1)
+	img, err := decodeTruncated(short)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG with a short header: %v", err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 1 {
+		t.Errorf("Expected a 64x1 image, got %v", img.Bounds())
+	}
+
+	// A huge header is rejected instead of allocated
+	huge := append([]byte(nil), truncated...)
+	binary.BigEndian.PutUint32(huge[16:20], 0x7fffffff)
+	binary.BigEndian.PutUint32(huge[20:24], 0x7fffffff)
+	if _, err := decodeTruncated(huge); err == nil {
+		t.Errorf("Expected an error for a PNG header beyond the pixel limit")
+	}
+}
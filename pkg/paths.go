@@ -0,0 +1,46 @@
+package processor
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxNameBytes is the longest file name most filesystems accept: 255 bytes
+// on ext4 and APFS, 255 UTF-16 units on NTFS. Counting UTF-8 bytes is the
+// stricter of the two, so a name within it fits everywhere.
+const maxNameBytes = 255
+
+// hiddenName returns the name of a hidden working file for the file base: a
+// dot, the base name and suffix. Long base names, such as Japanese names that
+// take three bytes per character, are shortened at a character boundary so
+// the name stays within maxNameBytes.
+func hiddenName(base, suffix string) string {
+	limit := maxNameBytes - 1 - len(suffix)
+	if len(base) > limit {
+		base = base[:limit]
+		for len(base) > 0 && !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+	}
+	return "." + base + suffix
+}
+
+// fileURI returns the file URI of an absolute path, with non-ASCII characters
+// percent-encoded as UTF-8: file:///home/user/a.jpg, and on Windows
+// file:///C:/Users/a.jpg for a drive and file://server/share/a.jpg for a UNC
+// path.
+func fileURI(path string) string {
+	slashed := filepath.ToSlash(path)
+	u := &url.URL{Scheme: "file", Path: slashed}
+	if volume := filepath.VolumeName(path); len(volume) > 2 && os.IsPathSeparator(volume[0]) {
+		host, _, _ := strings.Cut(strings.TrimLeft(filepath.ToSlash(volume), "/"), "/")
+		u.Host = host
+		u.Path = strings.TrimPrefix(slashed, "//"+host)
+	} else if !strings.HasPrefix(slashed, "/") {
+		u.Path = "/" + slashed
+	}
+	return u.String()
+}
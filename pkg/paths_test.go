@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHiddenName(t *testing.T) {
+	if got := hiddenName("写真.jpg", ".part"); got != ".写真.jpg.part" {
+		t.Errorf("hiddenName() = %q, want %q", got, ".写真.jpg.part")
+	}
+
+	// 84 Japanese characters take 252 bytes, close to the limit on their own
+	long := strings.Repeat("日", 80) + ".jpg"
+	got := hiddenName(long, ".tmp-12345-1")
+	if len(got) > maxNameBytes {
+		t.Errorf("Expected at most %d bytes, got %d", maxNameBytes, len(got))
+	}
+	if !utf8.ValidString(got) || !strings.HasSuffix(got, ".tmp-12345-1") {
+		t.Errorf("Expected a valid name ending in the suffix, got %q", got)
+	}
+}
+
+func TestUnicodePaths(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	dir := filepath.Join(testDir, "画像", "スキャン")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	inputPath := filepath.Join(dir, "入力.jpg")
+	if err := generateSingleTestImage(inputPath, 120, 80); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	// The temporary output next to a name this long would exceed the limit
+	outputPath := filepath.Join(dir, strings.Repeat("出", 80)+".jpg")
+	if err := ResizeImage(inputPath, outputPath, 60, 40); err != nil {
+		t.Fatalf("Failed to resize into a long Japanese name: %v", err)
+	}
+	names, err := LocalStorage{}.List(dir)
+	if err != nil {
+		t.Fatalf("Failed to list directory: %v", err)
+	}
+	if len(names) != 2 {
+		t.Errorf("Expected the input and output only, got %q", names)
+	}
+	if err := BinarizeImage(outputPath, filepath.Join(dir, "二値化.jpg")); err != nil {
+		t.Errorf("Failed to read a long Japanese name: %v", err)
+	}
+}
+
+func TestFileURI(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix paths")
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/home/user/a.jpg", "file:///home/user/a.jpg"},
+		{"/home/user/写真 1.jpg", "file:///home/user/%E5%86%99%E7%9C%9F%201.jpg"},
+	}
+	for _, tt := range tests {
+		if got := fileURI(tt.path); got != tt.want {
+			t.Errorf("fileURI(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileURIWindows(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{`C:\Users\user\a.jpg`, "file:///C:/Users/user/a.jpg"},
+		{`C:\Users\user\写真.jpg`, "file:///C:/Users/user/%E5%86%99%E7%9C%9F.jpg"},
+		{`\\server\share\scans\a.jpg`, "file://server/share/scans/a.jpg"},
+	}
+	for _, tt := range tests {
+		if got := fileURI(tt.path); got != tt.want {
+			t.Errorf("fileURI(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLongPathsWindows(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// Nested directories longer than MAX_PATH (260 UTF-16 characters)
+	dir := testDir
+	for len(dir) < 300 {
+		dir = filepath.Join(dir, strings.Repeat("d", 50))
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	inputPath := filepath.Join(dir, "input.jpg")
+	if err := generateSingleTestImage(inputPath, 120, 80); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	if err := ResizeImage(inputPath, filepath.Join(dir, "output.jpg"), 60, 40); err != nil {
+		t.Errorf("Failed to process a long path: %v", err)
+	}
+}
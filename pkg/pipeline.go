@@ -0,0 +1,403 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Pipeline is a sequence of operations applied to an image in memory. The
+// image is decoded once, passed from step to step and encoded once at the
+// end, so chaining does not lose quality to repeated JPEG encoding:
+//
+//	p := processor.NewPipeline().Resize(800, 600).Rotate(90).Binarize()
+//	err := p.Run("input.jpg", "output.jpg")
+//
+// The methods that add steps return the pipeline for chaining. Steps only
+// run when Apply, Run or RunReader is called, so a pipeline can be built once
+// and run on many images. A pipeline must not be changed while it runs.
+//
+// ApplyContext, RunContext and RunReaderContext stop when their context is
+// cancelled: between steps, and within the rows of the slow steps
+// (AutoRotate, Rotate and Denoise). They charge the decoded image and the
+// result of every step to the MemoryAccount of the context, if any, and fail
+// once it is over its budget. Steps that change the size of the image, such
+// as Resize, Pad and ExtendToAspect, are checked against the budget before
+// they run, so an oversized result is refused before it is allocated.
+type Pipeline struct {
+	steps   []pipelineStep
+	quality int
+	// proc loads, saves and logs for Run and RunReader
+	proc *Processor
+}
+
+// pipelineStep is an operation of a pipeline with a description of it
+type pipelineStep struct {
+	desc  string
+	apply func(ctx context.Context, img image.Image) (image.Image, error)
+	// estimate, when set, returns the bytes of the result of the step on img
+	// before it runs
+	estimate func(img image.Image) int64
+}
+
+// NewPipeline creates a pipeline without steps, run with the default
+// Processor
+func NewPipeline() *Pipeline {
+	return defaultProcessor.NewPipeline()
+}
+
+// NewPipeline creates a pipeline without steps, loading, saving and logging
+// with the configuration and logger of p when it runs
+func (p *Processor) NewPipeline() *Pipeline {
+	return &Pipeline{proc: p}
+}
+
+// Then adds a step running fn, described by desc in Steps and errors. It
+// lets other image.Image functions take part in the pipeline.
+func (p *Pipeline) Then(desc string, fn func(img image.Image) (image.Image, error)) *Pipeline {
+	return p.ThenContext(desc, func(_ context.Context, img image.Image) (image.Image, error) {
+		return fn(img)
+	})
+}
+
+// ThenContext is Then for a function that takes the context the pipeline
+// runs with, so that it can stop when the context is cancelled.
+func (p *Pipeline) ThenContext(desc string, fn func(ctx context.Context, img image.Image) (image.Image, error)) *Pipeline {
+	p.steps = append(p.steps, pipelineStep{desc: desc, apply: fn})
+	return p
+}
+
+// withEstimate sets the function estimating the size of the result of the
+// last step added
+func (p *Pipeline) withEstimate(estimate func(img image.Image) int64) *Pipeline {
+	p.steps[len(p.steps)-1].estimate = estimate
+	return p
+}
+
+// then adds a step for an operation that cannot fail
+func (p *Pipeline) then(desc string, fn func(img image.Image) image.Image) *Pipeline {
+	return p.Then(desc, func(img image.Image) (image.Image, error) { return fn(img), nil })
+}
+
+// Resize adds a resize step, see Resize
+func (p *Pipeline) Resize(width, height uint) *Pipeline {
+	return p.Then(fmt.Sprintf("resize %d %d", width, height), func(img image.Image) (image.Image, error) {
+		return Resize(img, width, height)
+	}).withEstimate(func(img image.Image) int64 {
+		return resizeBytes(img, ResizeOptions{Width: width, Height: height})
+	})
+}
+
+// ResizeWithOptions adds a resize step, see ResizeWithOptions
+func (p *Pipeline) ResizeWithOptions(opts ResizeOptions) *Pipeline {
+	return p.Then("resize", func(img image.Image) (image.Image, error) {
+		resized, _, err := ResizeWithOptions(img, opts)
+		return resized, err
+	}).withEstimate(func(img image.Image) int64 {
+		return resizeBytes(img, opts)
+	})
+}
+
+// Rotate adds a step rotating by angle degrees, see Rotate
+func (p *Pipeline) Rotate(angle float64) *Pipeline {
+	return p.ThenContext(fmt.Sprintf("rotate %g", angle), func(ctx context.Context, img image.Image) (image.Image, error) {
+		return rotateContext(ctx, img, angle)
+	})
+}
+
+// AutoRotate adds a step straightening the image, see AutoRotate
+func (p *Pipeline) AutoRotate() *Pipeline {
+	return p.ThenContext("autorotate", func(ctx context.Context, img image.Image) (image.Image, error) {
+		corrected, _, err := autoRotateImage(ctx, img, nil, AutoRotateOptions{})
+		return corrected, err
+	})
+}
+
+// Crop adds a step cutting out rect, see Crop
+func (p *Pipeline) Crop(rect image.Rectangle) *Pipeline {
+	return p.Then(fmt.Sprintf("crop %v", rect), func(img image.Image) (image.Image, error) {
+		return Crop(img, rect)
+	})
+}
+
+// Thumbnail adds a step making a size x size gallery thumbnail, see
+// SquareThumbnail
+func (p *Pipeline) Thumbnail(size int) *Pipeline {
+	return p.Then(fmt.Sprintf("thumbnail %d", size), func(img image.Image) (image.Image, error) {
+		return SquareThumbnail(img, size)
+	}).withEstimate(func(image.Image) int64 {
+		return pixelBytes(size, size)
+	})
+}
+
+// CropGravity adds a step cutting out a width x height rectangle placed by
+// the gravity, see CropGravity
+func (p *Pipeline) CropGravity(g Gravity, width, height int) *Pipeline {
+	return p.Then(fmt.Sprintf("crop %dx%d %v", width, height, g), func(img image.Image) (image.Image, error) {
+		return CropGravity(img, g, width, height)
+	})
+}
+
+// Pad adds a step adding borders, see Pad
+func (p *Pipeline) Pad(top, right, bottom, left int, bg color.Color) *Pipeline {
+	return p.Then(fmt.Sprintf("pad %d,%d,%d,%d", top, right, bottom, left), func(img image.Image) (image.Image, error) {
+		return Pad(img, top, right, bottom, left, bg)
+	}).withEstimate(func(img image.Image) int64 {
+		size := img.Bounds().Size()
+		return pixelBytes(left+size.X+right, top+size.Y+bottom)
+	})
+}
+
+// ExtendToAspect adds a step padding the image to an aspect ratio, see
+// ExtendToAspect
+func (p *Pipeline) ExtendToAspect(aspectWidth, aspectHeight float64, g Gravity, bg color.Color) *Pipeline {
+	return p.Then(fmt.Sprintf("extend %g:%g %v", aspectWidth, aspectHeight, g), func(img image.Image) (image.Image, error) {
+		return ExtendToAspect(img, aspectWidth, aspectHeight, g, bg)
+	}).withEstimate(func(img image.Image) int64 {
+		canvas := aspectCanvas(img.Bounds().Size(), aspectWidth, aspectHeight)
+		return pixelBytes(canvas.X, canvas.Y)
+	})
+}
+
+// Denoise adds a denoise step, see Denoise
+func (p *Pipeline) Denoise() *Pipeline {
+	return p.DenoiseWithOptions(DenoiseOptions{Radius: 1})
+}
+
+// DenoiseWithOptions adds a denoise step, see DenoiseWithOptions
+func (p *Pipeline) DenoiseWithOptions(opts DenoiseOptions) *Pipeline {
+	return p.ThenContext("denoise", func(ctx context.Context, img image.Image) (image.Image, error) {
+		denoised, _, err := denoiseImage(ctx, img, opts)
+		return denoised, err
+	})
+}
+
+// Binarize adds a binarize step, see Binarize
+func (p *Pipeline) Binarize() *Pipeline {
+	return p.ThenContext("binarize", func(ctx context.Context, img image.Image) (image.Image, error) {
+		return binarizeContext(ctx, img, -1, nil)
+	})
+}
+
+// Edges adds an edge detection step, see Edges
+func (p *Pipeline) Edges() *Pipeline {
+	return p.ThenContext("edges", func(ctx context.Context, img image.Image) (image.Image, error) {
+		return edgesContext(ctx, img, -1, nil)
+	})
+}
+
+// Skeletonize adds a skeletonize step, see Skeletonize
+func (p *Pipeline) Skeletonize() *Pipeline {
+	return p.then("skeleton", Skeletonize)
+}
+
+// Deblock adds a deblocking step, see Deblock
+func (p *Pipeline) Deblock(strength int) *Pipeline {
+	return p.then(fmt.Sprintf("deblock %d", strength), func(img image.Image) image.Image {
+		return Deblock(img, strength)
+	})
+}
+
+// DocClean adds a document cleanup step, see DocClean
+func (p *Pipeline) DocClean(preset string) *Pipeline {
+	return p.Then("docclean "+preset, func(img image.Image) (image.Image, error) {
+		return DocClean(img, preset)
+	})
+}
+
+// MultiOtsu adds a segmentation step into levels gray levels, see MultiOtsu
+func (p *Pipeline) MultiOtsu(levels int) *Pipeline {
+	return p.Then(fmt.Sprintf("segment %d", levels), func(img image.Image) (image.Image, error) {
+		segmented, _, err := MultiOtsu(img, levels)
+		return segmented, err
+	})
+}
+
+// Halftone adds a halftone step, see Halftone
+func (p *Pipeline) Halftone(pitch, angle float64) *Pipeline {
+	return p.Then(fmt.Sprintf("halftone %g %g", pitch, angle), func(img image.Image) (image.Image, error) {
+		return Halftone(img, pitch, angle)
+	})
+}
+
+// Comic adds a comic rendering step, see Comic
+func (p *Pipeline) Comic(levels int, edgeThreshold float64) *Pipeline {
+	return p.Then(fmt.Sprintf("comic %d %g", levels, edgeThreshold), func(img image.Image) (image.Image, error) {
+		return Comic(img, levels, edgeThreshold)
+	})
+}
+
+// SimulateDeficiency adds a color blindness simulation step, see
+// SimulateDeficiency
+func (p *Pipeline) SimulateDeficiency(deficiency string) *Pipeline {
+	return p.Then("colorblind "+deficiency, func(img image.Image) (image.Image, error) {
+		return SimulateDeficiency(img, deficiency)
+	})
+}
+
+// InvertNegative adds a film negative inversion step, see InvertNegative
+func (p *Pipeline) InvertNegative(opts NegativeOptions) *Pipeline {
+	return p.then("negative", func(img image.Image) image.Image {
+		positive, _ := InvertNegative(img, opts)
+		return positive
+	})
+}
+
+// BlurFaces adds a face blurring step, see BlurFaces
+func (p *Pipeline) BlurFaces() *Pipeline {
+	return p.Then("blurfaces", func(img image.Image) (image.Image, error) {
+		blurred, _, err := BlurFaces(img)
+		return blurred, err
+	})
+}
+
+// Watermark adds a step placing mark on the image, see Watermark
+func (p *Pipeline) Watermark(mark image.Image, opts WatermarkOptions) *Pipeline {
+	return p.Then("watermark", func(img image.Image) (image.Image, error) {
+		marked, _, err := Watermark(img, mark, opts)
+		return marked, err
+	})
+}
+
+// DocDewarp adds a step straightening a photographed page, see DocDewarp
+func (p *Pipeline) DocDewarp(opts DocDewarpOptions) *Pipeline {
+	return p.Then("docdewarp", func(img image.Image) (image.Image, error) {
+		page, _, err := DocDewarp(img, opts)
+		return page, err
+	})
+}
+
+// BookDewarp adds a step flattening the curled page of an open book, see
+// BookDewarp
+func (p *Pipeline) BookDewarp(opts BookDewarpOptions) *Pipeline {
+	return p.Then("bookdewarp", func(img image.Image) (image.Image, error) {
+		page, _, err := BookDewarp(img, opts)
+		return page, err
+	})
+}
+
+// Inpaint adds a step filling parts of the image from their surroundings,
+// see Inpaint
+func (p *Pipeline) Inpaint(opts InpaintOptions) *Pipeline {
+	return p.Then("inpaint", func(img image.Image) (image.Image, error) {
+		filled, _, err := Inpaint(img, opts)
+		return filled, err
+	})
+}
+
+// WasmFilter adds a WebAssembly filter step, see WasmFilter
+func (p *Pipeline) WasmFilter(opts WasmOptions) *Pipeline {
+	return p.Then("wasm "+opts.Module, func(img image.Image) (image.Image, error) {
+		return WasmFilter(img, opts)
+	})
+}
+
+// Quality sets the JPEG quality of the result, 1-100. Without it the
+// configured quality is used.
+func (p *Pipeline) Quality(quality int) *Pipeline {
+	p.quality = quality
+	return p
+}
+
+// Steps describes the steps of the pipeline, in the order they run
+func (p *Pipeline) Steps() []string {
+	steps := make([]string, len(p.steps))
+	for i, step := range p.steps {
+		steps[i] = step.desc
+	}
+	return steps
+}
+
+// Apply runs the steps on img and returns the result. It stops at the first
+// step that fails.
+func (p *Pipeline) Apply(img image.Image) (image.Image, error) {
+	return p.ApplyContext(context.Background(), img)
+}
+
+// ApplyContext runs the steps on img like Apply, and stops with ctx's error
+// when ctx is cancelled.
+func (p *Pipeline) ApplyContext(ctx context.Context, img image.Image) (image.Image, error) {
+	for i, step := range p.steps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if a := memoryFrom(ctx); a != nil && step.estimate != nil {
+			if err := a.check(a.Allocated(), step.estimate(img)); err != nil {
+				return nil, err
+			}
+		}
+		result, err := step.apply(ctx, img)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, &ErrProcessing{Op: "pipeline", Err: fmt.Errorf("step %d, %s: %w", i+1, step.desc, err)}
+		}
+		if err := chargeImage(ctx, result); err != nil {
+			return nil, err
+		}
+		img = result
+	}
+	return img, nil
+}
+
+// Run decodes the input, runs the steps and writes the result as JPEG.
+// It takes the paths of the input and output files.
+// Returns an error if decoding, a step or encoding fails.
+func (p *Pipeline) Run(inputPath string, outputPath string) error {
+	return p.RunContext(context.Background(), inputPath, outputPath)
+}
+
+// RunContext runs the pipeline on the input file like Run, and stops with
+// ctx's error, without writing the output, when ctx is cancelled.
+func (p *Pipeline) RunContext(ctx context.Context, inputPath string, outputPath string) error {
+	p.proc.logger().Info("running pipeline", "input", inputPath, "output", outputPath, "steps", len(p.steps))
+
+	data, release, err := p.proc.readInput(inputPath)
+	if err != nil {
+		return &ErrInvalidInput{Path: inputPath, Err: err}
+	}
+	defer release()
+	img, err := p.proc.decodeImageContext(ctx, data, inputPath)
+	if err != nil {
+		return err
+	}
+	result, err := p.ApplyContext(ctx, img)
+	if err != nil {
+		return err
+	}
+	return p.proc.saveJPEGQuality(outputPath, result, p.outputQuality())
+}
+
+// RunReader is Run reading the image from r and writing the result to w
+func (p *Pipeline) RunReader(r io.Reader, w io.Writer) error {
+	return p.RunReaderContext(context.Background(), r, w)
+}
+
+// RunReaderContext is RunContext reading the image from r and writing the
+// result to w
+func (p *Pipeline) RunReaderContext(ctx context.Context, r io.Reader, w io.Writer) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return &ErrProcessing{Op: "read", Err: err}
+	}
+	img, err := p.proc.decodeImageContext(ctx, data, "")
+	if err != nil {
+		return err
+	}
+	result, err := p.ApplyContext(ctx, img)
+	if err != nil {
+		return err
+	}
+	return encodeJPEGQuality(w, result, p.outputQuality())
+}
+
+// outputQuality is the JPEG quality set with Quality, or the configured one
+func (p *Pipeline) outputQuality() int {
+	if p.quality > 0 {
+		return p.quality
+	}
+	return p.proc.Config().JpegQuality
+}
@@ -0,0 +1,124 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 100; x < 200; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+
+	p := NewPipeline().Resize(100, 0).Rotate(90).Binarize()
+	if got, want := p.Steps(), []string{"resize 100 0", "rotate 90", "binarize"}; !slices.Equal(got, want) {
+		t.Errorf("Steps() = %q, want %q", got, want)
+	}
+	got, err := p.Apply(img)
+	if err != nil {
+		t.Fatalf("Failed to apply pipeline: %v", err)
+	}
+
+	resized, err := Resize(img, 100, 0)
+	if err != nil {
+		t.Fatalf("Failed to resize: %v", err)
+	}
+	want := Binarize(Rotate(resized, 90))
+	if got.Bounds() != want.Bounds() || !bytes.Equal(toGray(got).Pix, toGray(want).Pix) {
+		t.Error("Pipeline result differs from calling the functions in turn")
+	}
+
+	// A failing step stops the pipeline and is named in the error
+	calls := 0
+	_, err = NewPipeline().MultiOtsu(1).Then("count", func(img image.Image) (image.Image, error) {
+		calls++
+		return img, nil
+	}).Apply(img)
+	var procErr *ErrProcessing
+	if !errors.As(err, &procErr) || procErr.Op != "pipeline" {
+		t.Errorf("Expected a pipeline error, got %v", err)
+	}
+	if calls != 0 {
+		t.Error("Expected the steps after a failure not to run")
+	}
+}
+
+func TestPipelineContext(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	p := NewPipeline().ThenContext("cancel", func(ctx context.Context, img image.Image) (image.Image, error) {
+		cancel()
+		return img, nil
+	}).Then("count", func(img image.Image) (image.Image, error) {
+		calls++
+		return img, nil
+	})
+	if _, err := p.ApplyContext(ctx, img); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the pipeline to be cancelled, got %v", err)
+	}
+	if calls != 0 {
+		t.Error("Expected the steps after cancellation not to run")
+	}
+
+	// The slow steps stop within their rows
+	for _, p := range []*Pipeline{
+		NewPipeline().Denoise(), NewPipeline().Rotate(30), NewPipeline().AutoRotate(),
+		NewPipeline().Binarize(), NewPipeline().Edges(), NewPipeline().Transform(RotateOp(30)),
+	} {
+		if _, err := p.steps[0].apply(ctx, img); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected %s to be cancelled, got %v", p.steps[0].desc, err)
+		}
+	}
+}
+
+func TestPipelineRun(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	inputPath := filepath.Join(testDir, "test_input_pipeline.jpg")
+	if err := generateSingleTestImage(inputPath, 120, 80); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	outputPath := filepath.Join(testDir, "test_output_pipeline.jpg")
+
+	p := NewPipeline().Resize(60, 40).Rotate(90).Quality(80)
+	if err := p.Run(inputPath, outputPath); err != nil {
+		t.Fatalf("Failed to run pipeline: %v", err)
+	}
+	result, err := loadImage(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to load output: %v", err)
+	}
+	if b := result.Bounds(); b.Dx() != 40 || b.Dy() != 60 {
+		t.Errorf("Expected 40x60, got %v", b)
+	}
+
+	input, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read input: %v", err)
+	}
+	want, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	var got bytes.Buffer
+	if err := p.RunReader(bytes.NewReader(input), &got); err != nil {
+		t.Fatalf("Failed to run pipeline on a reader: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Error("RunReader output differs from Run output")
+	}
+}
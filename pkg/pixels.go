@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ForEachPixel calls fn with the coordinates and color of every pixel of img,
+// row by row from the top. The color is the pixel's RGBA method scaled to 8
+// bits, so it is premultiplied by alpha. The standard image types are read
+// a row at a time from their pixel slices instead of through At, so analysis
+// code and plugins get the fast paths without writing their own loops.
+func ForEachPixel(img image.Image, fn func(x, y int, c color.RGBA)) {
+	bounds := img.Bounds()
+	buf := make([]uint8, bounds.Dx()*4)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := rgbaRow(img, bounds.Min.X, bounds.Max.X, y, buf)
+		for i := 0; i < len(row); i += 4 {
+			fn(bounds.Min.X+i/4, y, color.RGBA{row[i], row[i+1], row[i+2], row[i+3]})
+		}
+	}
+}
+
+// ForEachRowParallel calls fn with every row of img, spread over GOMAXPROCS
+// goroutines in no particular order, or in order on the calling goroutine when
+// the configuration of the default Processor is deterministic. row holds the pixels of the row from the
+// left edge of the bounds as 8-bit premultiplied RGBA, 4 bytes per pixel, like
+// ForEachPixel.
+//
+// For an *image.RGBA, row is the image's own pixels, so fn can change the
+// image in place; for the other types it is a converted copy that is only
+// valid until fn returns. fn runs concurrently and must not write to state
+// shared between rows without synchronization.
+func ForEachRowParallel(img image.Image, fn func(y int, row []uint8)) {
+	defaultProcessor.ForEachRowParallel(img, fn)
+}
+
+// ForEachRowParallel is the package function ForEachRowParallel with the configuration of p
+func (p *Processor) ForEachRowParallel(img image.Image, fn func(y int, row []uint8)) {
+	bounds := img.Bounds()
+	parallelRows(p.Config().Deterministic, bounds.Min.Y, bounds.Max.Y, func() func(y int) {
+		buf := make([]uint8, bounds.Dx()*4)
+		return func(y int) {
+			fn(y, rgbaRow(img, bounds.Min.X, bounds.Max.X, y, buf))
+		}
+	})
+}
+
+// parallelRows hands out the rows minY to maxY-1 to GOMAXPROCS goroutines.
+// Each goroutine calls worker once for the function it runs on its rows, so
+// the function can keep buffers of its own. When deterministic is set, from
+// the configuration of the Processor running the operation, the rows run in
+// order on the calling goroutine, so functions that accumulate across rows
+// always add in the same order.
+func parallelRows(deterministic bool, minY, maxY int, worker func() func(y int)) {
+	if deterministic {
+		row := worker()
+		for y := minY; y < maxY; y++ {
+			row(y)
+		}
+		return
+	}
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), maxY-minY); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			row := worker()
+			for {
+				y := minY + int(next.Add(1)) - 1
+				if y >= maxY {
+					return
+				}
+				row(y)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// ToRGBA copies img into a new *image.RGBA anchored at the origin, with the
+// fast conversions of the standard image types, for filters that change the
+// pixels in place with ForEachRowParallel
+func ToRGBA(img image.Image) *image.RGBA {
+	return toRGBA(img)
+}
+
+// rgbaRow returns the pixels x0 to x1 of row y of img as 8-bit premultiplied
+// RGBA, identical to the colors' RGBA methods shifted right by 8. Rows of an
+// *image.RGBA are returned without copying; the others are converted into
+// buf, which must hold (x1-x0)*4 bytes. The 16-bit types keep the high byte
+// of their samples.
+func rgbaRow(img image.Image, x0, x1, y int, buf []uint8) []uint8 {
+	n := (x1 - x0) * 4
+	switch src := img.(type) {
+	case *image.RGBA:
+		return src.Pix[src.PixOffset(x0, y):][:n:n]
+	case *image.Gray:
+		row := src.Pix[src.PixOffset(x0, y):][: x1-x0 : x1-x0]
+		dst := buf[:n]
+		for i, g := range row {
+			d := dst[i*4 : i*4+4 : i*4+4]
+			d[0], d[1], d[2], d[3] = g, g, g, 0xff
+		}
+		return dst
+	case *image.NRGBA:
+		row := src.Pix[src.PixOffset(x0, y):][:n:n]
+		dst := buf[:n]
+		for i := 0; i < n; i += 4 {
+			s := row[i : i+4 : i+4]
+			r, g, b, a := color.NRGBA{s[0], s[1], s[2], s[3]}.RGBA()
+			dst[i], dst[i+1], dst[i+2], dst[i+3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(a>>8)
+		}
+		return dst
+	case *image.YCbCr:
+		dst := buf[:n]
+		for i := 0; i < n; i += 4 {
+			x := x0 + i/4
+			yi, ci := src.YOffset(x, y), src.COffset(x, y)
+			dst[i], dst[i+1], dst[i+2] = color.YCbCrToRGB(src.Y[yi], src.Cb[ci], src.Cr[ci])
+			dst[i+3] = 0xff
+		}
+		return dst
+	case *image.RGBA64:
+		row := src.Pix[src.PixOffset(x0, y):][: 2*n : 2*n]
+		dst := buf[:n]
+		for i := range dst {
+			// The high byte of each big-endian sample
+			dst[i] = row[2*i]
+		}
+		return dst
+	case *image.NRGBA64:
+		row := src.Pix[src.PixOffset(x0, y):][: 2*n : 2*n]
+		dst := buf[:n]
+		for i := 0; i < n; i += 4 {
+			s := row[2*i : 2*i+8 : 2*i+8]
+			r, g, b, a := color.NRGBA64{
+				uint16(s[0])<<8 | uint16(s[1]), uint16(s[2])<<8 | uint16(s[3]),
+				uint16(s[4])<<8 | uint16(s[5]), uint16(s[6])<<8 | uint16(s[7]),
+			}.RGBA()
+			dst[i], dst[i+1], dst[i+2], dst[i+3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(a>>8)
+		}
+		return dst
+	case *image.Gray16:
+		row := src.Pix[src.PixOffset(x0, y):][: 2*(x1-x0) : 2*(x1-x0)]
+		dst := buf[:n]
+		for i := 0; i < x1-x0; i++ {
+			g := row[2*i]
+			d := dst[i*4 : i*4+4 : i*4+4]
+			d[0], d[1], d[2], d[3] = g, g, g, 0xff
+		}
+		return dst
+	}
+	dst := buf[:n]
+	for i := 0; i < n; i += 4 {
+		r, g, b, a := img.At(x0+i/4, y).RGBA()
+		dst[i], dst[i+1], dst[i+2], dst[i+3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(a>>8)
+	}
+	return dst
+}
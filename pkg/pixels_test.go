@@ -0,0 +1,88 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"sync/atomic"
+	"testing"
+)
+
+func TestForEachPixel(t *testing.T) {
+	for name, img := range kernelTestImages(37, 29) {
+		t.Run(name, func(t *testing.T) {
+			bounds := img.Bounds()
+			count := 0
+			ForEachPixel(img, func(x, y int, c color.RGBA) {
+				count++
+				r, g, b, a := img.At(x, y).RGBA()
+				if want := (color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}); c != want {
+					t.Fatalf("Pixel %d,%d: expected %v, got %v", x, y, want, c)
+				}
+			})
+			if count != bounds.Dx()*bounds.Dy() {
+				t.Errorf("Expected %d pixels, got %d", bounds.Dx()*bounds.Dy(), count)
+			}
+
+			var rows, sum atomic.Int64
+			ForEachRowParallel(img, func(y int, row []uint8) {
+				rows.Add(1)
+				var s int64
+				for i := 0; i < len(row); i += 4 {
+					s += int64(row[i])
+				}
+				sum.Add(s)
+			})
+			var want int64
+			ForEachPixel(img, func(x, y int, c color.RGBA) { want += int64(c.R) })
+			if rows.Load() != int64(bounds.Dy()) || sum.Load() != want {
+				t.Errorf("Expected %d rows summing to %d, got %d and %d", bounds.Dy(), want, rows.Load(), sum.Load())
+			}
+		})
+	}
+
+	// Rows of an RGBA image are its own pixels
+	img := ToRGBA(image.NewGray(image.Rect(2, 3, 12, 9)))
+	ForEachRowParallel(img, func(y int, row []uint8) {
+		for i := range row {
+			row[i] = 0xff
+		}
+	})
+	if c := img.RGBAAt(9, 5); img.Bounds() != image.Rect(0, 0, 10, 6) || c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("Expected the image changed in place, got %v in %v", c, img.Bounds())
+	}
+}
+
+func BenchmarkForEachPixel(b *testing.B) {
+	// Decoded images come as image.Image, whose At is a dynamic call
+	var img image.Image = toRGBA(benchmarkImage())
+	bounds := img.Bounds()
+	b.Run("rgba", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var sum uint32
+			ForEachPixel(img, func(x, y int, c color.RGBA) { sum += uint32(c.R) })
+		}
+	})
+	b.Run("rgba-parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var sum atomic.Uint32
+			ForEachRowParallel(img, func(y int, row []uint8) {
+				var s uint32
+				for i := 0; i < len(row); i += 4 {
+					s += uint32(row[i])
+				}
+				sum.Add(s)
+			})
+		}
+	})
+	b.Run("rgba-generic", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var sum uint32
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					r, _, _, _ := img.At(x, y).RGBA()
+					sum += r >> 8
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PluginPrefix starts the names of plugin executables: a
+// go-image-processor-<name> executable on the PATH is run for the <name>
+// command
+const PluginPrefix = "go-image-processor-"
+
+// PluginProtocolEnv is set to the protocol version in the environment of
+// plugins run with an image, so a plugin can tell it is talking to the CLI
+const PluginProtocolEnv = "GO_IMAGE_PROCESSOR_PLUGIN"
+
+// pluginProtocol is the version of the plugin handshake. Each side sends one
+// frame: a header line "GIP/1 <format> <length>" followed by length bytes of
+// data. The CLI sends the input image; the plugin answers with the output
+// image, or with the format "error" and a message.
+const pluginProtocol = "GIP/1"
+
+// FindPlugin returns the path of the executable implementing a command.
+// Returns an error if no plugin of that name is on the PATH.
+func FindPlugin(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid plugin name %q", name)
+	}
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ListPlugins returns the names of the plugins on the PATH, sorted
+func ListPlugins() []string {
+	var names []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), PluginPrefix)
+			if !ok || entry.IsDir() {
+				continue
+			}
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			if _, err := FindPlugin(name); err == nil && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// RunPlugin runs a plugin executable on an image. The plugin gets the
+// arguments on its command line and the input image on stdin, and writes the
+// output image to stdout; its stderr is passed through. An answer in another
+// format than the extension of the output names is converted to it when that
+// is PNG or JPEG.
+// It takes the path of the plugin, its arguments and the paths of the input and output files.
+// Returns an error if the plugin fails or breaks the protocol.
+func RunPlugin(pluginPath string, args []string, inputPath string, outputPath string) error {
+	slog.Info("running plugin", "plugin", filepath.Base(pluginPath), "input", inputPath)
+
+	data, release, err := readInput(inputPath)
+	if err != nil {
+		return err
+	}
+	defer release()
+	format := sniffFormat(data)
+	if format == "" {
+		return &ErrUnsupportedFormat{Format: filepath.Ext(inputPath)}
+	}
+
+	cmd := exec.Command(pluginPath, args...)
+	cmd.Env = append(os.Environ(), PluginProtocolEnv+"=1")
+	cmd.Stderr = os.Stderr
+	var request bytes.Buffer
+	if err := WritePluginFrame(&request, format, data); err != nil {
+		return &ErrProcessing{Op: "plugin", Err: err}
+	}
+	cmd.Stdin = &request
+	var response bytes.Buffer
+	cmd.Stdout = &response
+	runErr := cmd.Run()
+
+	outFormat, outData, err := ReadPluginFrame(&response)
+	switch {
+	case err == nil && outFormat == "error":
+		return &ErrProcessing{Op: "plugin", Err: errors.New(string(outData))}
+	case runErr != nil:
+		return &ErrProcessing{Op: "plugin", Err: runErr}
+	case err != nil:
+		return &ErrProcessing{Op: "plugin", Err: fmt.Errorf("invalid response: %w", err)}
+	}
+	if got := sniffFormat(outData); got != outFormat {
+		return &ErrProcessing{Op: "plugin", Err: fmt.Errorf("invalid response: %s data sent as %s", got, outFormat)}
+	}
+	switch want := extensionFormat(outputPath); {
+	case want == "" || want == outFormat:
+	case want == FormatPNG || want == FormatJPEG:
+		img, err := decodeImageData(outData, outputPath)
+		if err != nil {
+			return err
+		}
+		slog.Info("converting plugin output", "format", outFormat, "output_format", want)
+		if want == FormatPNG {
+			return savePNG(outputPath, img)
+		}
+		return saveJPEG(outputPath, img)
+	default:
+		return &ErrProcessing{Op: "plugin", Err: fmt.Errorf("plugin answered with %s, which cannot be converted to the %s of %s", outFormat, want, filepath.Base(outputPath))}
+	}
+
+	out, err := createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := out.Write(outData); err != nil {
+		return &ErrProcessing{Op: "write", Err: err}
+	}
+	return out.Commit()
+}
+
+// WritePluginFrame writes one frame of the plugin protocol
+func WritePluginFrame(w io.Writer, format string, data []byte) error {
+	if _, err := fmt.Fprintf(w, "%s %s %d\n", pluginProtocol, format, len(data)); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// ReadPluginFrame reads one frame of the plugin protocol. The data is read as
+// it arrives rather than allocated from the length in the header, so a bogus
+// length fails on the missing data instead of exhausting memory.
+// Returns the format, such as "jpeg" or "png", and the data.
+func ReadPluginFrame(r io.Reader) (string, []byte, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return "", nil, fmt.Errorf("reading frame header: %w", err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 || fields[0] != pluginProtocol {
+		return "", nil, fmt.Errorf("invalid frame header %q", strings.TrimSpace(header))
+	}
+	length, err := strconv.Atoi(fields[2])
+	if err != nil || length < 0 {
+		return "", nil, fmt.Errorf("invalid frame length %q", fields[2])
+	}
+	var data bytes.Buffer
+	if _, err := io.CopyN(&data, br, int64(length)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", nil, fmt.Errorf("reading frame data: %w", err)
+	}
+	return fields[1], data.Bytes(), nil
+}
+
+// ServePlugin implements the plugin side of the protocol for plugins written
+// in Go: it reads the input image from stdin, calls process with it and the
+// command-line arguments, and writes the result to stdout in the format of the
+// input. Errors are reported to the CLI, which prints them.
+// Returns an error if stdin or stdout fail.
+func ServePlugin(process func(img image.Image, args []string) (image.Image, error)) error {
+	format, data, err := ReadPluginFrame(os.Stdin)
+	if err != nil {
+		return err
+	}
+	out, err := servePluginImage(format, data, process)
+	if err != nil {
+		return WritePluginFrame(os.Stdout, "error", []byte(err.Error()))
+	}
+	return WritePluginFrame(os.Stdout, format, out)
+}
+
+// servePluginImage decodes, processes and encodes the image of a request
+func servePluginImage(format string, data []byte, process func(img image.Image, args []string) (image.Image, error)) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	result, err := process(img, os.Args[1:])
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if format == FormatPNG {
+		err = png.Encode(&buf, result)
+	} else {
+		err = jpeg.Encode(&buf, result, &jpeg.Options{Quality: currentConfig().JpegQuality})
+	}
+	return buf.Bytes(), err
+}
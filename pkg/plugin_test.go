@@ -0,0 +1,117 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestPluginFrames(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePluginFrame(&buf, "png", []byte("data\nwith newline")); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+	format, data, err := ReadPluginFrame(&buf)
+	if err != nil || format != "png" || string(data) != "data\nwith newline" {
+		t.Errorf("Unexpected frame %q %q (%v)", format, data, err)
+	}
+
+	for _, frame := range []string{"", "GIP/2 png 1\nx", "GIP/1 png\n", "GIP/1 png -1\n", "GIP/1 png 10\nshort", "GIP/1 png 9223372036854775807\n"} {
+		if _, _, err := ReadPluginFrame(bytes.NewReader([]byte(frame))); err == nil {
+			t.Errorf("Frame %q should be rejected", frame)
+		}
+	}
+}
+
+func TestServePluginImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 4, 2))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+	out, err := servePluginImage(FormatPNG, buf.Bytes(), func(img image.Image, args []string) (image.Image, error) {
+		result := image.NewGray(img.Bounds())
+		for i := range result.Pix {
+			result.Pix[i] = 255
+		}
+		return result, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to process image: %v", err)
+	}
+	result, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("Expected PNG output: %v", err)
+	}
+	if c := color.GrayModel.Convert(result.At(3, 1)).(color.Gray); c.Y != 255 {
+		t.Errorf("Expected the processed image, got %v", c)
+	}
+}
+
+func TestRunPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script plugins need a Unix shell")
+	}
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// The echo plugin answers with the frame it was sent
+	plugins := map[string]string{
+		"echo":  "#!/bin/sh\ncat\n",
+		"fail":  "#!/bin/sh\nprintf 'GIP/1 error 4\\nboom'\n",
+		"crash": "#!/bin/sh\nexit 3\n",
+	}
+	for name, script := range plugins {
+		if err := os.WriteFile(filepath.Join(testDir, PluginPrefix+name), []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write plugin: %v", err)
+		}
+	}
+	t.Setenv("PATH", testDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	if got := ListPlugins(); !slices.Equal(got, []string{"crash", "echo", "fail"}) {
+		t.Errorf("Unexpected plugins %v", got)
+	}
+	if _, err := FindPlugin("missing"); err == nil {
+		t.Error("FindPlugin should fail for a missing plugin")
+	}
+
+	testInputPath := filepath.Join(testDir, "test_input_plugin.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_plugin.jpg")
+	if err := generateSingleTestImage(testInputPath, 32, 16); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	echo, _ := FindPlugin("echo")
+	if err := RunPlugin(echo, []string{"-strength", "2"}, testInputPath, testOutputPath); err != nil {
+		t.Fatalf("Failed to run plugin: %v", err)
+	}
+	want, _ := os.ReadFile(testInputPath)
+	got, _ := os.ReadFile(testOutputPath)
+	if !bytes.Equal(want, got) {
+		t.Error("Expected the echo plugin to return the input")
+	}
+
+	// An answer in another format than the output's extension is converted
+	pngOutputPath := filepath.Join(testDir, "test_output_plugin.png")
+	if err := RunPlugin(echo, nil, testInputPath, pngOutputPath); err != nil {
+		t.Fatalf("Failed to run plugin: %v", err)
+	}
+	if format, _ := DetectFormat(pngOutputPath); format != FormatPNG {
+		t.Errorf("Expected a PNG output, got %q", format)
+	}
+
+	for _, name := range []string{"fail", "crash"} {
+		path, _ := FindPlugin(name)
+		if err := RunPlugin(path, nil, testInputPath, filepath.Join(testDir, name+".jpg")); err == nil {
+			t.Errorf("Expected the %s plugin to fail", name)
+		}
+		if _, err := os.Stat(filepath.Join(testDir, name+".jpg")); !os.IsNotExist(err) {
+			t.Errorf("The %s plugin should not leave an output", name)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package processor
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image/color"
+	"io"
+)
+
+// PNG color types
+const (
+	pngColorGray      = 0
+	pngColorRGB       = 2
+	pngColorPalette   = 3
+	pngColorGrayAlpha = 4
+	pngColorRGBA      = 6
+)
+
+// pngSignature starts every PNG file
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// pngHeader describes the pixel format written by encodePNG. The standard
+// library encoder picks the format itself, which is not enough when the
+// output must have an exact color type and bit depth.
+type pngHeader struct {
+	width, height int
+	colorType     uint8
+	bitDepth      uint8
+	// palette is written as the PLTE chunk for pngColorPalette
+	palette color.Palette
+	// interlace writes the pixels in the seven Adam7 passes, so a partially
+	// downloaded file already shows the whole image at a lower resolution
+	interlace bool
+	// dpi, when positive, is recorded in a pHYs chunk
+	dpi float64
+}
+
+// noInterlacePass covers the whole image in a single pass
+var noInterlacePass = []struct{ x0, y0, dx, dy int }{{0, 0, 1, 1}}
+
+// adam7Passes are the start offsets and strides of the Adam7 passes
+var adam7Passes = []struct{ x0, y0, dx, dy int }{
+	{0, 0, 8, 8},
+	{4, 0, 8, 8},
+	{0, 4, 4, 8},
+	{2, 0, 4, 4},
+	{0, 2, 2, 4},
+	{1, 0, 2, 2},
+	{0, 1, 1, 2},
+}
+
+// channels returns the number of samples per pixel
+func (h pngHeader) channels() int {
+	switch h.colorType {
+	case pngColorRGB:
+		return 3
+	case pngColorGrayAlpha:
+		return 2
+	case pngColorRGBA:
+		return 4
+	}
+	return 1
+}
+
+// encodePNG writes a PNG with the exact format of hdr. The sample function
+// fills in the samples of the pixel at (x, y), already scaled to the bit depth.
+func encodePNG(w io.Writer, hdr pngHeader, sample func(x, y int, samples []uint16)) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(pngSignature); err != nil {
+		return err
+	}
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:4], uint32(hdr.width))
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(hdr.height))
+	ihdr[8] = hdr.bitDepth
+	ihdr[9] = hdr.colorType
+	if hdr.interlace {
+		ihdr[12] = 1
+	}
+	if err := writePNGChunk(bw, "IHDR", ihdr); err != nil {
+		return err
+	}
+
+	if hdr.dpi > 0 {
+		// pHYs counts pixels per meter
+		ppm := uint32(hdr.dpi/0.0254 + 0.5)
+		phys := make([]byte, 9)
+		binary.BigEndian.PutUint32(phys[0:4], ppm)
+		binary.BigEndian.PutUint32(phys[4:8], ppm)
+		phys[8] = 1
+		if err := writePNGChunk(bw, "pHYs", phys); err != nil {
+			return err
+		}
+	}
+
+	if hdr.colorType == pngColorPalette {
+		plte := make([]byte, 0, 3*len(hdr.palette))
+		trns := make([]byte, 0, len(hdr.palette))
+		opaque := 0
+		for i, c := range hdr.palette {
+			n := color.NRGBAModel.Convert(c).(color.NRGBA)
+			plte = append(plte, n.R, n.G, n.B)
+			trns = append(trns, n.A)
+			if n.A != 255 {
+				opaque = i + 1
+			}
+		}
+		if err := writePNGChunk(bw, "PLTE", plte); err != nil {
+			return err
+		}
+		// tRNS lists the alpha of the entries up to the last translucent one
+		if opaque > 0 {
+			if err := writePNGChunk(bw, "tRNS", trns[:opaque]); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The compressed rows go out in IDAT chunks as they are produced, so
+	// neither the pixels nor the compressed data of the whole image are held
+	// in memory
+	idat := bufio.NewWriterSize(idatWriter{bw}, idatChunkSize)
+	zw := zlib.NewWriter(idat)
+	if err := writePNGRows(zw, hdr, sample); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := idat.Flush(); err != nil {
+		return err
+	}
+	if err := writePNGChunk(bw, "IEND", nil); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// idatChunkSize is the largest IDAT chunk written by encodePNG
+const idatChunkSize = 64 << 10
+
+// idatWriter writes each write as an IDAT chunk. A PNG decoder joins the data
+// of consecutive IDAT chunks into a single zlib stream.
+type idatWriter struct {
+	w io.Writer
+}
+
+func (w idatWriter) Write(p []byte) (int, error) {
+	if err := writePNGChunk(w.w, "IDAT", p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writePNGRows packs and filters every scanline of the image, pass by pass
+// when interlaced
+func writePNGRows(w io.Writer, hdr pngHeader, sample func(x, y int, samples []uint16)) error {
+	passes := adam7Passes
+	if !hdr.interlace {
+		passes = noInterlacePass
+	}
+	for _, pass := range passes {
+		// Each pass is a reduced image of its own; empty passes are skipped
+		width := (hdr.width - pass.x0 + pass.dx - 1) / pass.dx
+		height := (hdr.height - pass.y0 + pass.dy - 1) / pass.dy
+		if width <= 0 || height <= 0 {
+			continue
+		}
+		err := writePNGPass(w, hdr, width, height, func(x, y int, samples []uint16) {
+			sample(pass.x0+x*pass.dx, pass.y0+y*pass.dy, samples)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePNGPass packs and filters the scanlines of a width x height image
+func writePNGPass(w io.Writer, hdr pngHeader, width, height int, sample func(x, y int, samples []uint16)) error {
+	channels := hdr.channels()
+	bitsPerPixel := channels * int(hdr.bitDepth)
+	rowBytes := (width*bitsPerPixel + 7) / 8
+	// Filters work on whole bytes, and on whole pixels when a pixel is wider than a byte
+	bpp := max(1, bitsPerPixel/8)
+
+	previous := make([]byte, rowBytes)
+	current := make([]byte, rowBytes)
+	samples := make([]uint16, channels)
+	filtered := make([][]byte, 5)
+	for i := range filtered {
+		filtered[i] = make([]byte, rowBytes+1)
+	}
+
+	for y := 0; y < height; y++ {
+		clear(current)
+		bit := 0
+		for x := 0; x < width; x++ {
+			sample(x, y, samples)
+			for _, s := range samples {
+				switch hdr.bitDepth {
+				case 16:
+					binary.BigEndian.PutUint16(current[bit/8:], s)
+				case 8:
+					current[bit/8] = uint8(s)
+				default:
+					// Sub-byte samples are packed starting at the most significant bit
+					current[bit/8] |= uint8(s) << (8 - int(hdr.bitDepth) - bit%8)
+				}
+				bit += int(hdr.bitDepth)
+			}
+		}
+
+		if _, err := w.Write(filterPNGRow(filtered, current, previous, bpp)); err != nil {
+			return err
+		}
+		previous, current = current, previous
+	}
+	return nil
+}
+
+// filterPNGRow applies each PNG filter to the row and returns the filtered row
+// (prefixed with its filter type) with the smallest sum of absolute values,
+// the heuristic recommended by the PNG specification
+func filterPNGRow(filtered [][]byte, row, previous []byte, bpp int) []byte {
+	best, bestScore := 0, -1
+	for filter := range filtered {
+		out := filtered[filter]
+		out[0] = byte(filter)
+		score := 0
+		for i, v := range row {
+			var a, b, c byte
+			if i >= bpp {
+				a, c = row[i-bpp], previous[i-bpp]
+			}
+			b = previous[i]
+			switch filter {
+			case 0:
+				out[i+1] = v
+			case 1:
+				out[i+1] = v - a
+			case 2:
+				out[i+1] = v - b
+			case 3:
+				out[i+1] = v - byte((int(a)+int(b))/2)
+			case 4:
+				out[i+1] = v - paeth(a, b, c)
+			}
+			score += abs(int(int8(out[i+1])))
+		}
+		if bestScore < 0 || score < bestScore {
+			best, bestScore = filter, score
+		}
+	}
+	return filtered[best]
+}
+
+// paeth is the Paeth predictor of the PNG specification
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+// writePNGChunk writes a chunk with its length and CRC
+func writePNGChunk(w io.Writer, name string, data []byte) error {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], name)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+	for _, part := range [][]byte{header[:], data, footer[:]} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package processor
+
+import (
+	"context"
+	"image"
+	"sync"
+)
+
+// BufferPool recycles the pixel buffers of images, so a service running the
+// same operations on many images of similar sizes does not allocate fresh
+// buffers for every one and keep the garbage collector busy. The operations
+// take their grayscale and RGBA results from a pool given with WithBuffers;
+// once the caller is done with a result, Put hands its buffer back for the
+// next call. A buffer too small for a request is dropped and a new one
+// allocated, so the pool settles on the largest size in use.
+//
+// A BufferPool is safe for concurrent use. The package keeps a pool of its
+// own for intermediate images and for the results that the file and Reader
+// variants encode and discard.
+type BufferPool struct {
+	gray sync.Pool
+	rgba sync.Pool
+}
+
+// NewBufferPool returns an empty pool
+func NewBufferPool() *BufferPool {
+	return &BufferPool{}
+}
+
+// buffers is the pool of the package
+var buffers = NewBufferPool()
+
+// Put returns the buffer of an *image.Gray or *image.RGBA taken from a pool
+// or allocated by the caller; other images are ignored. img must not be used
+// afterwards, as the next operation overwrites its pixels.
+func (p *BufferPool) Put(img image.Image) {
+	if p == nil {
+		return
+	}
+	switch img := img.(type) {
+	case *image.Gray:
+		p.gray.Put(&img.Pix)
+	case *image.RGBA:
+		p.rgba.Put(&img.Pix)
+	}
+}
+
+// newGray returns a black *image.Gray with the bounds r, with a buffer from
+// the pool; a nil pool allocates it
+func (p *BufferPool) newGray(r image.Rectangle) *image.Gray {
+	if p == nil {
+		return image.NewGray(r)
+	}
+	return &image.Gray{Pix: p.take(&p.gray, r.Dx()*r.Dy()), Stride: r.Dx(), Rect: r}
+}
+
+// newRGBA returns a transparent *image.RGBA with the bounds r, with a buffer
+// from the pool; a nil pool allocates it
+func (p *BufferPool) newRGBA(r image.Rectangle) *image.RGBA {
+	if p == nil {
+		return image.NewRGBA(r)
+	}
+	return &image.RGBA{Pix: p.take(&p.rgba, 4*r.Dx()*r.Dy()), Stride: 4 * r.Dx(), Rect: r}
+}
+
+// take returns a cleared buffer of n bytes from pool
+func (p *BufferPool) take(pool *sync.Pool, n int) []uint8 {
+	if v, ok := pool.Get().(*[]uint8); ok && cap(*v) >= n {
+		buf := (*v)[:n]
+		clear(buf)
+		return buf
+	}
+	return make([]uint8, n)
+}
+
+// WithBuffers takes the results of Rotate, Denoise, Binarize and Edges from
+// pool, which the caller gives them back to with Put once it is done with
+// them. The file and Reader variants, which discard their results once
+// encoded, return them to pool themselves.
+func WithBuffers(pool *BufferPool) Option {
+	return func(s *settings) {
+		s.buffers = pool
+	}
+}
+
+// scratch is the pool for results that are encoded and then discarded: the
+// pool given with WithBuffers, or the package's own
+func (s *settings) scratch() *BufferPool {
+	if s.buffers != nil {
+		return s.buffers
+	}
+	return buffers
+}
+
+// buffersKey is the context key of the pool of an operation
+type buffersKey struct{}
+
+// withBuffers returns a context whose operations take their results from pool
+func withBuffers(ctx context.Context, pool *BufferPool) context.Context {
+	if pool == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, buffersKey{}, pool)
+}
+
+// buffersFrom returns the pool of ctx, or nil, which allocates
+func buffersFrom(ctx context.Context) *BufferPool {
+	pool, _ := ctx.Value(buffersKey{}).(*BufferPool)
+	return pool
+}
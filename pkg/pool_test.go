@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	img := kernelTestImages(40, 30)["rgba"]
+
+	t.Run("same results", func(t *testing.T) {
+		pool := NewBufferPool()
+		for i := 0; i < 2; i++ {
+			got, err := BinarizeWith(img, WithBuffers(pool), WithThreshold(100))
+			if err != nil {
+				t.Fatalf("BinarizeWith failed: %v", err)
+			}
+			if want := binarize(img, 100, nil); !bytes.Equal(got.(*image.Gray).Pix, want.(*image.Gray).Pix) {
+				t.Errorf("Run %d: binarized pixels differ from an unpooled run", i)
+			}
+			pool.Put(got)
+
+			got, err = RotateWith(img, 30, WithBuffers(pool))
+			if err != nil {
+				t.Fatalf("RotateWith failed: %v", err)
+			}
+			if want := Rotate(img, 30); !bytes.Equal(got.(*image.RGBA).Pix, want.(*image.RGBA).Pix) {
+				t.Errorf("Run %d: rotated pixels differ from an unpooled run", i)
+			}
+			pool.Put(got)
+		}
+	})
+
+	t.Run("reuse", func(t *testing.T) {
+		pool := NewBufferPool()
+		first := pool.newGray(image.Rect(0, 0, 40, 30))
+		first.Pix[0] = 0xff
+		pool.Put(first)
+		second := pool.newGray(image.Rect(0, 0, 20, 10))
+		if len(second.Pix) != 200 || second.Pix[0] != 0 {
+			t.Errorf("Expected a cleared 200-byte buffer, got %d bytes starting with %d", len(second.Pix), second.Pix[0])
+		}
+		if large := pool.newRGBA(image.Rect(0, 0, 80, 60)); len(large.Pix) != 4*80*60 {
+			t.Errorf("Expected a new buffer for a larger image, got %d bytes", len(large.Pix))
+		}
+		pool.Put(image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+		var none *BufferPool
+		none.Put(first)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		pool := NewBufferPool()
+		want := edges(img, -1, nil).(*image.Gray)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					got, _ := EdgesWith(img, WithBuffers(pool))
+					if !bytes.Equal(got.(*image.Gray).Pix, want.Pix) {
+						t.Error("Edges of a pooled run differ")
+						return
+					}
+					pool.Put(got)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("files", func(t *testing.T) {
+		testDir := setupTestDir(t)
+		defer os.RemoveAll(testDir)
+		input := writeTestImage(t, testDir, "test_input.png", img, encodePNGBuffer)
+		pool := NewBufferPool()
+		for _, angle := range []float64{90, 45} {
+			output := filepath.Join(testDir, "test_output.jpg")
+			if err := RotateImageWith(input, output, angle, WithBuffers(pool)); err != nil {
+				t.Fatalf("RotateImageWith failed: %v", err)
+			}
+			if err := DenoiseImageWith(input, output, WithBuffers(pool)); err != nil {
+				t.Fatalf("DenoiseImageWith failed: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package processor
+
+import (
+	"context"
+	"image"
+)
+
+// PreviewResize resizes the input image like ResizeImageWith and returns the
+// result instead of writing it, so a GUI can show it or a test can check its
+// pixels without a temporary file. WithQuality and WithTiled have no effect.
+// Returns an error if an option is invalid or the operation fails.
+func PreviewResize(inputPath string, width, height uint, opts ...Option) (image.Image, error) {
+	return defaultProcessor.PreviewResize(inputPath, width, height, opts...)
+}
+
+// PreviewResize is the package function PreviewResize with the configuration and logger of p
+func (p *Processor) PreviewResize(inputPath string, width, height uint, opts ...Option) (image.Image, error) {
+	s, err := newSettings("resize", opts)
+	if err != nil {
+		return nil, err
+	}
+	ro := s.resizeOptions(width, height)
+	p.logger().Info("previewing resize", "input", inputPath, "width", width, "height", height)
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	srcDPI := ro.DPI
+	if srcDPI <= 0 {
+		srcDPI = readDPI(inputPath)
+	}
+	resized, _, err := resizeImage(img, srcDPI, ro)
+	if err != nil {
+		return nil, err
+	}
+	return resized, nil
+}
+
+// PreviewRotate rotates the input image like RotateImageWith and returns the
+// result instead of writing it.
+// Returns an error if an option is invalid or the operation fails.
+func PreviewRotate(inputPath string, angle float64, opts ...Option) (image.Image, error) {
+	return defaultProcessor.PreviewRotate(inputPath, angle, opts...)
+}
+
+// PreviewRotate is the package function PreviewRotate with the configuration and logger of p
+func (p *Processor) PreviewRotate(inputPath string, angle float64, opts ...Option) (image.Image, error) {
+	s, err := newSettings("rotate", opts)
+	if err != nil {
+		return nil, err
+	}
+	p.logger().Info("previewing rotation", "input", inputPath, "angle", angle)
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	return rotateContext(withBuffers(withProgress(context.Background(), s.progress), s.buffers), img, angle)
+}
+
+// PreviewAutoRotate corrects the skew of the input image like
+// AutoRotateImageContext and returns the result instead of writing it, with
+// the detected angle.
+// Returns an error if the operation fails or ctx is cancelled.
+func PreviewAutoRotate(ctx context.Context, inputPath string, opts AutoRotateOptions) (image.Image, *AutoRotateResult, error) {
+	return defaultProcessor.PreviewAutoRotate(ctx, inputPath, opts)
+}
+
+// PreviewAutoRotate is the package function PreviewAutoRotate with the configuration and logger of p
+func (p *Processor) PreviewAutoRotate(ctx context.Context, inputPath string, opts AutoRotateOptions) (image.Image, *AutoRotateResult, error) {
+	p.logger().Info("previewing auto-rotation", "input", inputPath)
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	exif, _ := readExif(inputPath)
+	return autoRotateImage(ctx, img, exif, opts)
+}
+
+// PreviewDenoise median-filters the input image like DenoiseImageWith and
+// returns the result instead of writing it.
+// Returns an error if an option is invalid or the operation fails.
+func PreviewDenoise(inputPath string, opts ...Option) (image.Image, error) {
+	return defaultProcessor.PreviewDenoise(inputPath, opts...)
+}
+
+// PreviewDenoise is the package function PreviewDenoise with the configuration and logger of p
+func (p *Processor) PreviewDenoise(inputPath string, opts ...Option) (image.Image, error) {
+	s, err := newSettings("denoise", opts)
+	if err != nil {
+		return nil, err
+	}
+	p.logger().Info("previewing denoise", "input", inputPath)
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	denoised, _, err := denoiseImage(context.Background(), img, DenoiseOptions{Radius: s.radius(1), Progress: s.progress})
+	if err != nil {
+		return nil, err
+	}
+	return denoised, nil
+}
+
+// PreviewBinarize binarizes the input image like BinarizeImageWith and
+// returns the result instead of writing it.
+// Returns an error if an option is invalid or the operation fails.
+func PreviewBinarize(inputPath string, opts ...Option) (image.Image, error) {
+	return defaultProcessor.PreviewBinarize(inputPath, opts...)
+}
+
+// PreviewBinarize is the package function PreviewBinarize with the configuration and logger of p
+func (p *Processor) PreviewBinarize(inputPath string, opts ...Option) (image.Image, error) {
+	s, err := newSettings("binarize", opts)
+	if err != nil {
+		return nil, err
+	}
+	p.logger().Info("previewing binarization", "input", inputPath)
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	return binarize(img, s.threshold, s.buffers), nil
+}
+
+// PreviewDetectEdges applies edge detection to the input image like
+// DetectEdgesWith and returns the result instead of writing it.
+// Returns an error if an option is invalid or the operation fails.
+func PreviewDetectEdges(inputPath string, opts ...Option) (image.Image, error) {
+	return defaultProcessor.PreviewDetectEdges(inputPath, opts...)
+}
+
+// PreviewDetectEdges is the package function PreviewDetectEdges with the configuration and logger of p
+func (p *Processor) PreviewDetectEdges(inputPath string, opts ...Option) (image.Image, error) {
+	s, err := newSettings("edges", opts)
+	if err != nil {
+		return nil, err
+	}
+	p.logger().Info("previewing edge detection", "input", inputPath)
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	return edges(img, s.threshold, s.buffers), nil
+}
+
+// Preview runs the pipeline on the input file like Run and returns the result
+// instead of encoding and writing it
+func (p *Pipeline) Preview(inputPath string) (image.Image, error) {
+	return p.PreviewContext(context.Background(), inputPath)
+}
+
+// PreviewContext is Preview stopping with ctx's error when ctx is cancelled
+func (p *Pipeline) PreviewContext(ctx context.Context, inputPath string) (image.Image, error) {
+	p.proc.logger().Info("previewing pipeline", "input", inputPath, "steps", len(p.steps))
+
+	data, release, err := p.proc.readInput(inputPath)
+	if err != nil {
+		return nil, &ErrInvalidInput{Path: inputPath, Err: err}
+	}
+	defer release()
+	img, err := p.proc.decodeImageContext(ctx, data, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	return p.ApplyContext(ctx, img)
+}
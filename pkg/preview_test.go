@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"os"
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	src := kernelTestImages(120, 80)["rgba"]
+	input := writeTestImage(t, testDir, "test_input.png", src, encodePNGBuffer)
+	img := decodeTestFile(t, input)
+
+	t.Run("resize", func(t *testing.T) {
+		got, err := PreviewResize(input, 60, 0)
+		if err != nil {
+			t.Fatalf("PreviewResize failed: %v", err)
+		}
+		if got.Bounds() != image.Rect(0, 0, 60, 40) {
+			t.Errorf("Expected a 60x40 image, got %v", got.Bounds())
+		}
+	})
+
+	t.Run("binarize", func(t *testing.T) {
+		got, err := PreviewBinarize(input, WithThreshold(100))
+		if err != nil {
+			t.Fatalf("PreviewBinarize failed: %v", err)
+		}
+		if want := binarize(img, 100, nil); !bytes.Equal(toGray(got).Pix, toGray(want).Pix) {
+			t.Error("Preview differs from binarizing the decoded image")
+		}
+	})
+
+	t.Run("pipeline", func(t *testing.T) {
+		p := NewPipeline().Rotate(90).Edges()
+		got, err := p.Preview(input)
+		if err != nil {
+			t.Fatalf("Preview failed: %v", err)
+		}
+		want, err := p.Apply(img)
+		if err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		if got.Bounds() != want.Bounds() || !bytes.Equal(toGray(got).Pix, toGray(want).Pix) {
+			t.Error("Preview differs from applying the pipeline to the decoded image")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := p.PreviewContext(ctx, input); err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := PreviewDenoise(input, WithKernelSize(4)); err == nil {
+			t.Error("Expected an error for an even kernel size")
+		}
+		if _, err := PreviewRotate(input+".missing", 90); err == nil {
+			t.Error("Expected an error for a missing input")
+		}
+	})
+
+	// Nothing but the input is written
+	entries, err := os.ReadDir(testDir)
+	if err != nil {
+		t.Fatalf("Failed to read the test directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the input in the test directory, got %d files", len(entries))
+	}
+}
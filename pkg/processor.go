@@ -1,135 +1,175 @@
 package processor
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/jpeg"
+	"io"
+	"io/fs"
 	"log/slog"
 	"math"
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
 
-	"github.com/nfnt/resize"
 	"golang.org/x/exp/rand"
 
 	"github.com/okamyuji/go-image-processor/config"
 )
 
-var cfg *config.Config
+// Processor performs the image operations with its own configuration and
+// logger, so applications and tests can run differently configured
+// processors side by side without touching package state:
+//
+//	p := processor.New(cfg, logger)
+//	err := p.ResizeImage("in.jpg", "out.jpg", 800, 600)
+//
+// The package functions, such as ResizeImage, use the Processor returned by
+// Default. Operations on decoded images, such as Resize, need neither
+// configuration nor logger and are only package functions.
+type Processor struct {
+	cfg     atomic.Pointer[config.Config]
+	cfgOnce sync.Once
+	// log is the logger; nil logs through the default slog logger
+	log *slog.Logger
+}
+
+// New returns a Processor using cfg and logging to logger. A nil cfg uses
+// the default values of config.Default, and a nil logger logs through the
+// default slog logger at the time of each call. Unlike the package functions,
+// New never reads config.yaml.
+func New(cfg *config.Config, logger *slog.Logger) *Processor {
+	if cfg == nil {
+		cfg = config.Default()
+	}
+	p := &Processor{log: logger}
+	p.SetConfig(cfg)
+	return p
+}
+
+// defaultProcessor is the Processor of the package functions. Its
+// configuration is loaded from config.yaml on first use.
+var defaultProcessor = &Processor{}
+
+// Default returns the Processor used by the package functions. It loads its
+// configuration from config.yaml on first use unless SetConfig is called
+// first, and logs through the default slog logger.
+func Default() *Processor {
+	return defaultProcessor
+}
+
+// SetConfig replaces the configuration used by the package functions.
+// It is safe to call while operations are running; operations already
+// in progress may use either configuration.
+func SetConfig(c *config.Config) {
+	defaultProcessor.SetConfig(c)
+}
+
+// SetConfig replaces the configuration of p, like the package function
+// SetConfig does for the default Processor.
+func (p *Processor) SetConfig(c *config.Config) {
+	p.cfgOnce.Do(func() {})
+	p.cfg.Store(c)
+}
+
+// Config returns the configuration of p
+func (p *Processor) Config() *config.Config {
+	p.cfgOnce.Do(func() {
+		p.cfg.Store(config.GetConfig())
+	})
+	return p.cfg.Load()
+}
+
+// logger returns the logger of p
+func (p *Processor) logger() *slog.Logger {
+	if p.log != nil {
+		return p.log
+	}
+	return slog.Default()
+}
 
-func init() {
-	cfg = config.GetConfig()
-	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
-	slog.SetDefault(logger)
+// currentConfig returns the configuration of the default Processor
+func currentConfig() *config.Config {
+	return defaultProcessor.Config()
 }
 
 // ResizeImage resizes the input image to the specified width and height.
 // It takes the paths of the input and output files, and the desired width and height.
 // Returns an error if the operation fails.
 func ResizeImage(inputPath string, outputPath string, width, height uint) error {
-	slog.Info("resizing image",
-		"input", inputPath,
-		"width", width,
-		"height", height)
-
-	// Open the input file
-	file, err := os.Open(inputPath)
-	if err != nil {
-		return &ErrInvalidInput{Path: inputPath}
-	}
-	defer file.Close()
-
-	// Decode the image
-	img, _, err := image.Decode(file)
-	if err != nil {
-		return &ErrProcessing{Op: "decode", Err: err}
-	}
+	return defaultProcessor.ResizeImage(inputPath, outputPath, width, height)
+}
 
-	// Calculate new dimensions while maintaining aspect ratio
-	bounds := img.Bounds()
-	origWidth := float64(bounds.Dx())
-	origHeight := float64(bounds.Dy())
-	ratio := origWidth / origHeight
-
-	var newWidth, newHeight uint
-	if float64(width)/float64(height) > ratio {
-		// Height is the limiting factor
-		newHeight = height
-		newWidth = uint(float64(height) * ratio)
-	} else {
-		// Width is the limiting factor
-		newWidth = width
-		newHeight = uint(float64(width) / ratio)
-	}
-
-	// Resize the image
-	resizedImg := resize.Resize(newWidth, newHeight, img, resize.Lanczos3)
-
-	// Create the output file
-	out, err := os.Create(outputPath)
-	if err != nil {
-		return &ErrInvalidOutput{Path: outputPath}
-	}
-	defer out.Close()
+// ResizeImage is the package function ResizeImage with the configuration and logger of p
+func (p *Processor) ResizeImage(inputPath string, outputPath string, width, height uint) error {
+	_, err := p.ResizeImageWithOptions(inputPath, outputPath, ResizeOptions{Width: width, Height: height})
+	return err
+}
 
-	// Encode and save the resized image
-	if err := jpeg.Encode(out, resizedImg, &jpeg.Options{Quality: cfg.JpegQuality}); err != nil {
-		return &ErrProcessing{Op: "encode", Err: err}
-	}
+// ResizeImageReader resizes the image read from r like ResizeImage and
+// writes it to w as JPEG.
+// Returns an error if the operation fails.
+func ResizeImageReader(r io.Reader, w io.Writer, width, height uint) error {
+	return defaultProcessor.ResizeImageReader(r, w, width, height)
+}
 
-	return nil
+// ResizeImageReader is the package function ResizeImageReader with the configuration and logger of p
+func (p *Processor) ResizeImageReader(r io.Reader, w io.Writer, width, height uint) error {
+	_, err := p.ResizeImageReaderWithOptions(r, w, ResizeOptions{Width: width, Height: height})
+	return err
 }
 
 // DenoiseImage applies a simple denoising filter to the input image.
 // It takes the paths of the input and output files.
 // Returns an error if the operation fails.
 func DenoiseImage(inputPath string, outputPath string) error {
-	slog.Info("denoising image", "input", inputPath)
-
-	// Open the input file
-	file, err := os.Open(inputPath)
-	if err != nil {
-		return &ErrInvalidInput{Path: inputPath}
-	}
-	defer file.Close()
-
-	// Decode the image
-	img, _, err := image.Decode(file)
-	if err != nil {
-		return &ErrProcessing{Op: "decode", Err: err}
-	}
+	return defaultProcessor.DenoiseImage(inputPath, outputPath)
+}
 
-	// Apply median filter for denoising
-	bounds := img.Bounds()
-	denoised := image.NewRGBA(bounds)
+// DenoiseImage is the package function DenoiseImage with the configuration and logger of p
+func (p *Processor) DenoiseImage(inputPath string, outputPath string) error {
+	_, err := p.DenoiseImageWithOptions(inputPath, outputPath, DenoiseOptions{Radius: 1})
+	return err
+}
 
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			denoised.Set(x, y, medianFilter(img, x, y))
-		}
-	}
+// Denoise applies a median filter of radius 1 to the image, like DenoiseImage.
+func Denoise(img image.Image) image.Image {
+	// A radius of 1 is valid
+	denoised, _, _ := DenoiseWithOptions(img, DenoiseOptions{Radius: 1})
+	return denoised
+}
 
-	// Create the output file
-	out, err := os.Create(outputPath)
-	if err != nil {
-		return &ErrInvalidOutput{Path: outputPath}
-	}
-	defer out.Close()
+// DenoiseImageReader denoises the image read from r like DenoiseImage and
+// writes it to w as JPEG.
+// Returns an error if the operation fails.
+func DenoiseImageReader(r io.Reader, w io.Writer) error {
+	return defaultProcessor.DenoiseImageReader(r, w)
+}
 
-	// Encode and save the denoised image
-	return jpeg.Encode(out, denoised, nil)
+// DenoiseImageReader is the package function DenoiseImageReader with the configuration and logger of p
+func (p *Processor) DenoiseImageReader(r io.Reader, w io.Writer) error {
+	_, err := p.DenoiseImageReaderWithOptions(r, w, DenoiseOptions{Radius: 1})
+	return err
 }
 
-func medianFilter(img image.Image, x, y int) color.Color {
+// medianFilter returns the per-channel median of the (2*radius+1)^2 window
+// around (x, y), clamping the window at the image border
+func medianFilter(img image.Image, x, y, radius int) color.Color {
+	bounds := img.Bounds()
 	var r, g, b []int
-	for dy := -1; dy <= 1; dy++ {
-		for dx := -1; dx <= 1; dx++ {
-			c := img.At(x+dx, y+dy)
-			r1, g1, b1, _ := c.RGBA()
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			sx := min(max(x+dx, bounds.Min.X), bounds.Max.X-1)
+			sy := min(max(y+dy, bounds.Min.Y), bounds.Max.Y-1)
+			r1, g1, b1, _ := img.At(sx, sy).RGBA()
 			r = append(r, int(r1>>8))
 			g = append(g, int(g1>>8))
 			b = append(b, int(b1>>8))
@@ -138,74 +178,110 @@ func medianFilter(img image.Image, x, y int) color.Color {
 	sort.Ints(r)
 	sort.Ints(g)
 	sort.Ints(b)
-	return color.RGBA{uint8(r[4]), uint8(g[4]), uint8(b[4]), 255}
+	mid := len(r) / 2
+	return color.RGBA{uint8(r[mid]), uint8(g[mid]), uint8(b[mid]), 255}
 }
 
 // RotateImage rotates the input image by the specified angle in degrees.
 // It takes the paths of the input and output files, and the rotation angle.
 // Returns an error if the operation fails.
 func RotateImage(inputPath string, outputPath string, angle float64) error {
-	slog.Info("rotating image",
+	return defaultProcessor.RotateImage(inputPath, outputPath, angle)
+}
+
+// RotateImage is the package function RotateImage with the configuration and logger of p
+func (p *Processor) RotateImage(inputPath string, outputPath string, angle float64) error {
+	return p.RotateImageContext(context.Background(), inputPath, outputPath, angle)
+}
+
+// RotateImageContext rotates the input image like RotateImage, stopping early
+// with ctx's error when ctx is cancelled.
+func RotateImageContext(ctx context.Context, inputPath string, outputPath string, angle float64) error {
+	return defaultProcessor.RotateImageContext(ctx, inputPath, outputPath, angle)
+}
+
+// RotateImageContext is the package function RotateImageContext with the configuration and logger of p
+func (p *Processor) RotateImageContext(ctx context.Context, inputPath string, outputPath string, angle float64) error {
+	return p.rotateImageFile(ctx, inputPath, outputPath, angle, jpeg.DefaultQuality)
+}
+
+// RotateImageWith rotates the input image like RotateImage, saving it with
+// the quality set by WithQuality and reporting the rows done to the function
+// set by WithProgress.
+// Returns an error if an option is invalid or the operation fails.
+func RotateImageWith(inputPath string, outputPath string, angle float64, opts ...Option) error {
+	return defaultProcessor.RotateImageWith(inputPath, outputPath, angle, opts...)
+}
+
+// RotateImageWith is the package function RotateImageWith with the configuration and logger of p
+func (p *Processor) RotateImageWith(inputPath string, outputPath string, angle float64, opts ...Option) error {
+	s, err := newSettings("rotate", opts)
+	if err != nil {
+		return err
+	}
+	ctx := withBuffers(withProgress(context.Background(), s.progress), s.buffers)
+	return s.recordFile(outputPath, p.rotateImageFile(ctx, inputPath, outputPath, angle, s.jpegQuality(jpeg.DefaultQuality)))
+}
+
+// rotateImageFile does the work of RotateImageContext, saving the result
+// with the given JPEG quality
+func (p *Processor) rotateImageFile(ctx context.Context, inputPath string, outputPath string, angle float64, quality int) error {
+	p.logger().Info("rotating image",
 		"input", inputPath,
 		"angle", angle)
 
-	// Open the input file
-	file, err := os.Open(inputPath)
+	img, err := p.loadImage(inputPath)
 	if err != nil {
-		return &ErrInvalidInput{Path: inputPath}
+		return err
 	}
-	defer file.Close()
-
-	// Decode the image
-	img, _, err := image.Decode(file)
+	// The result is discarded once saved, so its buffer goes back to a pool
+	pool := buffersFrom(ctx)
+	if pool == nil {
+		pool = buffers
+		ctx = withBuffers(ctx, pool)
+	}
+	rotated, err := rotateContext(ctx, img, angle)
 	if err != nil {
-		return &ErrProcessing{Op: "decode", Err: err}
+		return err
 	}
+	defer pool.Put(rotated)
+	return p.saveJPEGQuality(outputPath, rotated, quality)
+}
 
-	// Convert angle to radians
-	radians := angle * (math.Pi / 180)
-
-	// Calculate new image size
-	bounds := img.Bounds()
-	w, h := bounds.Max.X, bounds.Max.Y
-	newW, newH := rotatedSize(w, h, radians)
-
-	// Create a new image with the rotated size
-	rotated := image.NewRGBA(image.Rect(0, 0, newW, newH))
-
-	// Rotate the image
-	centerX, centerY := float64(w)/2, float64(h)/2
-	newCenterX, newCenterY := float64(newW)/2, float64(newH)/2
-
-	for y := 0; y < newH; y++ {
-		for x := 0; x < newW; x++ {
-			// Translate to origin
-			xr := float64(x) - newCenterX
-			yr := float64(y) - newCenterY
+// RotateImageReader rotates the image read from r like RotateImage and
+// writes it to w as JPEG.
+// Returns an error if the operation fails.
+func RotateImageReader(r io.Reader, w io.Writer, angle float64) error {
+	return defaultProcessor.RotateImageReader(r, w, angle)
+}
 
-			// Rotate
-			xr, yr = rotatePoint(xr, yr, -radians)
+// RotateImageReader is the package function RotateImageReader with the configuration and logger of p
+func (p *Processor) RotateImageReader(r io.Reader, w io.Writer, angle float64) error {
+	return p.RotateImageReaderWith(r, w, angle)
+}
 
-			// Translate back
-			xr += centerX
-			yr += centerY
+// RotateImageReaderWith rotates the image read from r like RotateImageWith
+// and writes it to w as JPEG.
+// Returns an error if an option is invalid or the operation fails.
+func RotateImageReaderWith(r io.Reader, w io.Writer, angle float64, opts ...Option) error {
+	return defaultProcessor.RotateImageReaderWith(r, w, angle, opts...)
+}
 
-			// If the point is within the original image, copy the color
-			if xr >= 0 && xr < float64(w) && yr >= 0 && yr < float64(h) {
-				rotated.Set(x, y, img.At(int(xr), int(yr)))
-			}
-		}
+// RotateImageReaderWith is the package function RotateImageReaderWith with the configuration and logger of p
+func (p *Processor) RotateImageReaderWith(r io.Reader, w io.Writer, angle float64, opts ...Option) error {
+	s, err := newSettings("rotate", opts)
+	if err != nil {
+		return err
 	}
-
-	// Create the output file
-	out, err := os.Create(outputPath)
+	img, err := p.decodeImage(r)
 	if err != nil {
-		return &ErrInvalidOutput{Path: outputPath}
+		return err
 	}
-	defer out.Close()
-
-	// Encode and save the rotated image
-	return jpeg.Encode(out, rotated, nil)
+	// The background context is never cancelled
+	rotated, _ := rotateContext(withBuffers(withProgress(context.Background(), s.progress), s.scratch()), img, angle)
+	defer s.scratch().Put(rotated)
+	w = s.countOutput(w)
+	return s.recordOutput(w, encodeJPEGQuality(w, rotated, s.jpegQuality(jpeg.DefaultQuality)))
 }
 
 func rotatedSize(w, h int, angle float64) (int, int) {
@@ -224,59 +300,150 @@ func rotatePoint(x, y float64, angle float64) (float64, float64) {
 // It takes the paths of the input and output files.
 // Returns an error if the operation fails.
 func BinarizeImage(inputPath string, outputPath string) error {
-	slog.Info("binarizing image", "input", inputPath)
+	return defaultProcessor.BinarizeImage(inputPath, outputPath)
+}
+
+// BinarizeImage is the package function BinarizeImage with the configuration and logger of p
+func (p *Processor) BinarizeImage(inputPath string, outputPath string) error {
+	return p.BinarizeImageWith(inputPath, outputPath)
+}
 
-	// Open the input file
-	file, err := os.Open(inputPath)
+// BinarizeImageWith binarizes the input image like BinarizeImage, at the
+// threshold set by WithThreshold and with the quality set by WithQuality,
+// a few rows at a time with WithTiled.
+// Returns an error if an option is invalid or the operation fails.
+func BinarizeImageWith(inputPath string, outputPath string, opts ...Option) error {
+	return defaultProcessor.BinarizeImageWith(inputPath, outputPath, opts...)
+}
+
+// BinarizeImageWith is the package function BinarizeImageWith with the configuration and logger of p
+func (p *Processor) BinarizeImageWith(inputPath string, outputPath string, opts ...Option) error {
+	return p.BinarizeImageContext(context.Background(), inputPath, outputPath, opts...)
+}
+
+// BinarizeImageContext binarizes the input image like BinarizeImageWith,
+// stopping early with ctx's error when ctx is cancelled.
+func BinarizeImageContext(ctx context.Context, inputPath string, outputPath string, opts ...Option) error {
+	return defaultProcessor.BinarizeImageContext(ctx, inputPath, outputPath, opts...)
+}
+
+// BinarizeImageContext is the package function BinarizeImageContext with the configuration and logger of p
+func (p *Processor) BinarizeImageContext(ctx context.Context, inputPath string, outputPath string, opts ...Option) error {
+	s, err := newSettings("binarize", opts)
 	if err != nil {
-		return &ErrInvalidInput{Path: inputPath}
+		return err
 	}
-	defer file.Close()
+	p.logger().Info("binarizing image", "input", inputPath, "tiled", s.tiled)
 
-	// Decode the image
-	img, _, err := image.Decode(file)
+	if s.tiled {
+		return s.recordFile(outputPath, p.binarizeTiled(ctx, inputPath, outputPath, s))
+	}
+	img, err := p.loadImage(inputPath)
 	if err != nil {
-		return &ErrProcessing{Op: "decode", Err: err}
+		return err
+	}
+	binarized, err := binarizeContext(ctx, img, s.threshold, s.scratch())
+	if err != nil {
+		return err
 	}
+	defer s.scratch().Put(binarized)
+	return s.recordFile(outputPath, p.saveJPEGQuality(outputPath, binarized, s.jpegQuality(jpeg.DefaultQuality)))
+}
 
+// BinarizeImageReader binarizes the image read from r like BinarizeImage and
+// writes it to w as JPEG.
+// Returns an error if the operation fails.
+func BinarizeImageReader(r io.Reader, w io.Writer) error {
+	return defaultProcessor.BinarizeImageReader(r, w)
+}
+
+// BinarizeImageReader is the package function BinarizeImageReader with the configuration and logger of p
+func (p *Processor) BinarizeImageReader(r io.Reader, w io.Writer) error {
+	return p.BinarizeImageReaderWith(r, w)
+}
+
+// BinarizeImageReaderWith binarizes the image read from r like
+// BinarizeImageWith and writes it to w as JPEG.
+// Returns an error if an option is invalid or the operation fails.
+func BinarizeImageReaderWith(r io.Reader, w io.Writer, opts ...Option) error {
+	return defaultProcessor.BinarizeImageReaderWith(r, w, opts...)
+}
+
+// BinarizeImageReaderWith is the package function BinarizeImageReaderWith with the configuration and logger of p
+func (p *Processor) BinarizeImageReaderWith(r io.Reader, w io.Writer, opts ...Option) error {
+	s, err := newSettings("binarize", opts)
+	if err != nil {
+		return err
+	}
+	img, err := p.decodeImage(r)
+	if err != nil {
+		return err
+	}
+	w = s.countOutput(w)
+	binarized := binarize(img, s.threshold, s.scratch())
+	defer s.scratch().Put(binarized)
+	return s.recordOutput(w, encodeJPEGQuality(w, binarized, s.jpegQuality(jpeg.DefaultQuality)))
+}
+
+// Binarize converts the image to black and white at the threshold found with
+// Otsu's method.
+func Binarize(img image.Image) image.Image {
+	return binarize(img, -1, nil)
+}
+
+// BinarizeWith converts the image to black and white like Binarize, at the
+// threshold set by WithThreshold.
+// Returns an error if an option is invalid.
+func BinarizeWith(img image.Image, opts ...Option) (image.Image, error) {
+	s, err := newSettings("binarize", opts)
+	if err != nil {
+		return nil, err
+	}
+	return binarize(img, s.threshold, s.buffers), nil
+}
+
+// binarize converts the image to black and white: pixels brighter than the
+// threshold turn white. A negative threshold is found with Otsu's method.
+// The result is taken from pool.
+func binarize(img image.Image, threshold int, pool *BufferPool) image.Image {
+	// The background context is never cancelled
+	binarized, _ := binarizeContext(context.Background(), img, threshold, pool)
+	return binarized
+}
+
+// binarizeContext binarizes the image like binarize, checking ctx for
+// cancellation between rows.
+func binarizeContext(ctx context.Context, img image.Image, threshold int, pool *BufferPool) (image.Image, error) {
 	// Convert to grayscale and calculate histogram
 	bounds := img.Bounds()
-	grayImg := image.NewGray(bounds)
+	grayImg := grayInto(buffers.newGray(bounds), img)
+	defer buffers.Put(grayImg)
 	histogram := make([]int, 256)
-
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			oldColor := img.At(x, y)
-			grayColor := color.GrayModel.Convert(oldColor).(color.Gray)
-			grayImg.Set(x, y, grayColor)
-			histogram[grayColor.Y]++
-		}
+	for _, v := range grayImg.Pix {
+		histogram[v]++
 	}
 
 	// Calculate Otsu's threshold
-	threshold := otsuThreshold(histogram, bounds.Dx()*bounds.Dy())
+	if threshold < 0 {
+		threshold = int(otsuThreshold(histogram, bounds.Dx()*bounds.Dy()))
+	}
 
 	// Apply threshold
-	binarized := image.NewGray(bounds)
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			if grayImg.GrayAt(x, y).Y > threshold {
-				binarized.Set(x, y, color.White)
-			} else {
-				binarized.Set(x, y, color.Black)
+	binarized := pool.newGray(bounds)
+	w := bounds.Dx()
+	for y := 0; y < bounds.Dy(); y++ {
+		if err := ctx.Err(); err != nil {
+			pool.Put(binarized)
+			return nil, err
+		}
+		row := binarized.Pix[y*binarized.Stride:][:w]
+		for i, v := range grayImg.Pix[y*grayImg.Stride:][:w] {
+			if int(v) > threshold {
+				row[i] = 0xff
 			}
 		}
 	}
-
-	// Create the output file
-	out, err := os.Create(outputPath)
-	if err != nil {
-		return &ErrInvalidOutput{Path: outputPath}
-	}
-	defer out.Close()
-
-	// Encode and save the binarized image
-	return jpeg.Encode(out, binarized, nil)
+	return binarized, nil
 }
 
 func otsuThreshold(histogram []int, total int) uint8 {
@@ -311,154 +478,225 @@ func otsuThreshold(histogram []int, total int) uint8 {
 }
 
 // ConcatenateImagesVertically combines multiple images vertically into a single image.
+// The inputs are decoded and resized concurrently, one per CPU at a time,
+// so only a few full-size images are held in memory however many there are.
 // It takes a slice of input file paths and the output file path.
 // Returns an error if the operation fails.
 func ConcatenateImagesVertically(inputPaths []string, outputPath string) error {
-	slog.Info("concatenating images vertically",
-		"count", len(inputPaths),
-		"output", outputPath)
+	return defaultProcessor.ConcatenateImagesVertically(inputPaths, outputPath)
+}
 
-	var images []image.Image
-	var totalHeight int
-	maxWidth := 0
+// ConcatenateImagesVertically is the package function ConcatenateImagesVertically with the configuration and logger of p
+func (p *Processor) ConcatenateImagesVertically(inputPaths []string, outputPath string) error {
+	return p.ConcatenateImagesVerticallyWith(inputPaths, outputPath)
+}
 
-	// Open and decode all input images
-	for _, path := range inputPaths {
-		file, err := os.Open(path)
-		if err != nil {
-			return &ErrInvalidInput{Path: path}
-		}
-		defer file.Close()
+// ConcatenateImagesVerticallyWith combines the images like
+// ConcatenateImagesVertically, saving the result with the quality set by
+// WithQuality, reporting the images done to the function set by
+// WithProgress and labeling the images as set by WithCaptions.
+// Returns an error if an option is invalid or the operation fails.
+func ConcatenateImagesVerticallyWith(inputPaths []string, outputPath string, opts ...Option) error {
+	return defaultProcessor.ConcatenateImagesVerticallyWith(inputPaths, outputPath, opts...)
+}
 
-		img, _, err := image.Decode(file)
-		if err != nil {
-			return &ErrProcessing{Op: "decode", Err: err}
-		}
+// ConcatenateImagesVerticallyWith is the package function ConcatenateImagesVerticallyWith with the configuration and logger of p
+func (p *Processor) ConcatenateImagesVerticallyWith(inputPaths []string, outputPath string, opts ...Option) error {
+	return p.ConcatenateImagesVerticallyContext(context.Background(), inputPaths, outputPath, opts...)
+}
 
-		images = append(images, img)
-		bounds := img.Bounds()
+// ConcatenateImagesVerticallyContext combines the images like
+// ConcatenateImagesVerticallyWith, stopping early with ctx's error when ctx is
+// cancelled: the images not yet started are skipped and no output is written.
+func ConcatenateImagesVerticallyContext(ctx context.Context, inputPaths []string, outputPath string, opts ...Option) error {
+	return defaultProcessor.ConcatenateImagesVerticallyContext(ctx, inputPaths, outputPath, opts...)
+}
 
-		// Find the maximum width
-		if bounds.Dx() > maxWidth {
-			maxWidth = bounds.Dx()
-		}
+// ConcatenateImagesVerticallyContext is the package function ConcatenateImagesVerticallyContext with the configuration and logger of p
+func (p *Processor) ConcatenateImagesVerticallyContext(ctx context.Context, inputPaths []string, outputPath string, opts ...Option) error {
+	s, err := newSettings("concatenate", opts)
+	if err != nil {
+		return err
 	}
+	p.logger().Info("concatenating images vertically",
+		"count", len(inputPaths),
+		"output", outputPath)
 
-	// Resize images to match the maximum width while maintaining aspect ratios
-	var resizedImages []image.Image
-	totalHeight = 0
-	for _, img := range images {
-		bounds := img.Bounds()
-		ratio := float64(bounds.Dx()) / float64(bounds.Dy())
-		newHeight := int(float64(maxWidth) / ratio)
-
-		resized := resize.Resize(uint(maxWidth), uint(newHeight), img, resize.Lanczos3)
-		resizedImages = append(resizedImages, resized)
-		totalHeight += newHeight
+	sources, err := p.fileSources(inputPaths)
+	if err != nil {
+		return err
 	}
-
-	// Create a new image with the maximum width and total height
-	concatenated := image.NewRGBA(image.Rect(0, 0, maxWidth, totalHeight))
-
-	// Draw each resized image onto the concatenated image
-	y := 0
-	for _, img := range resizedImages {
-		bounds := img.Bounds()
-		draw.Draw(concatenated, image.Rect(0, y, maxWidth, y+bounds.Dy()), img, bounds.Min, draw.Src)
-		y += bounds.Dy()
+	captions, err := s.captioner(sources, inputPaths, true)
+	if err != nil {
+		return err
 	}
-
-	// Create the output file
-	out, err := os.Create(outputPath)
+	concatenated, err := concatenateContext(ctx, sources, true, captions, s.progress)
 	if err != nil {
-		return &ErrInvalidOutput{Path: outputPath}
+		return err
 	}
-	defer out.Close()
+	return s.recordFile(outputPath, p.saveJPEGQuality(outputPath, concatenated, s.jpegQuality(p.Config().JpegQuality)))
+}
 
-	// Encode and save the concatenated image
-	if err := jpeg.Encode(out, concatenated, &jpeg.Options{Quality: cfg.JpegQuality}); err != nil {
-		return &ErrProcessing{Op: "encode", Err: err}
+// ConcatenateImagesVerticallyReader combines the images read from the readers
+// like ConcatenateImagesVertically and writes the result to w as JPEG.
+// Returns an error if the operation fails.
+func ConcatenateImagesVerticallyReader(inputs []io.Reader, w io.Writer) error {
+	return defaultProcessor.ConcatenateImagesVerticallyReader(inputs, w)
+}
+
+// ConcatenateImagesVerticallyReader is the package function ConcatenateImagesVerticallyReader with the configuration and logger of p
+func (p *Processor) ConcatenateImagesVerticallyReader(inputs []io.Reader, w io.Writer) error {
+	sources, err := p.readerSources(inputs)
+	if err != nil {
+		return err
 	}
+	concatenated, err := concatenate(sources, true, nil, nil)
+	if err != nil {
+		return err
+	}
+	return p.encodeJPEG(w, concatenated)
+}
 
-	return nil
+// ConcatenateVertically scales the images to the width of the widest one,
+// keeping their aspect ratios, and stacks them from top to bottom.
+func ConcatenateVertically(images []image.Image) image.Image {
+	// Decoded images cannot fail to decode
+	concatenated, _ := concatenate(imageSources(images), true, nil, nil)
+	return concatenated
 }
 
 // ConcatenateImagesHorizontally combines multiple images horizontally into a single image.
+// The inputs are decoded and resized concurrently, one per CPU at a time,
+// so only a few full-size images are held in memory however many there are.
 // It takes a slice of input file paths and the output file path.
 // Returns an error if the operation fails.
 func ConcatenateImagesHorizontally(inputPaths []string, outputPath string) error {
-	slog.Info("concatenate image horizontally", "input", inputPaths)
+	return defaultProcessor.ConcatenateImagesHorizontally(inputPaths, outputPath)
+}
 
-	var images []image.Image
-	var totalWidth int
-	maxHeight := 0
+// ConcatenateImagesHorizontally is the package function ConcatenateImagesHorizontally with the configuration and logger of p
+func (p *Processor) ConcatenateImagesHorizontally(inputPaths []string, outputPath string) error {
+	return p.ConcatenateImagesHorizontallyWith(inputPaths, outputPath)
+}
 
-	// Open and decode all input images
-	for _, path := range inputPaths {
-		file, err := os.Open(path)
-		if err != nil {
-			return &ErrInvalidInput{Path: path}
-		}
-		defer file.Close()
+// ConcatenateImagesHorizontallyWith combines the images like
+// ConcatenateImagesHorizontally, saving the result with the quality set by
+// WithQuality, reporting the images done to the function set by
+// WithProgress and labeling the images as set by WithCaptions.
+// Returns an error if an option is invalid or the operation fails.
+func ConcatenateImagesHorizontallyWith(inputPaths []string, outputPath string, opts ...Option) error {
+	return defaultProcessor.ConcatenateImagesHorizontallyWith(inputPaths, outputPath, opts...)
+}
 
-		img, _, err := image.Decode(file)
-		if err != nil {
-			return &ErrProcessing{Op: "decode", Err: err}
-		}
+// ConcatenateImagesHorizontallyWith is the package function ConcatenateImagesHorizontallyWith with the configuration and logger of p
+func (p *Processor) ConcatenateImagesHorizontallyWith(inputPaths []string, outputPath string, opts ...Option) error {
+	return p.ConcatenateImagesHorizontallyContext(context.Background(), inputPaths, outputPath, opts...)
+}
 
-		images = append(images, img)
-		bounds := img.Bounds()
+// ConcatenateImagesHorizontallyContext combines the images like
+// ConcatenateImagesHorizontallyWith, stopping early with ctx's error when ctx is
+// cancelled: the images not yet started are skipped and no output is written.
+func ConcatenateImagesHorizontallyContext(ctx context.Context, inputPaths []string, outputPath string, opts ...Option) error {
+	return defaultProcessor.ConcatenateImagesHorizontallyContext(ctx, inputPaths, outputPath, opts...)
+}
 
-		// Find the maximum height
-		if bounds.Dy() > maxHeight {
-			maxHeight = bounds.Dy()
-		}
+// ConcatenateImagesHorizontallyContext is the package function ConcatenateImagesHorizontallyContext with the configuration and logger of p
+func (p *Processor) ConcatenateImagesHorizontallyContext(ctx context.Context, inputPaths []string, outputPath string, opts ...Option) error {
+	s, err := newSettings("concatenate", opts)
+	if err != nil {
+		return err
 	}
+	p.logger().Info("concatenate image horizontally", "input", inputPaths)
 
-	// Resize images to match the maximum height while maintaining aspect ratios
-	var resizedImages []image.Image
-	totalWidth = 0
-	for _, img := range images {
-		bounds := img.Bounds()
-		ratio := float64(bounds.Dx()) / float64(bounds.Dy())
-		newWidth := int(float64(maxHeight) * ratio)
-
-		resized := resize.Resize(uint(newWidth), uint(maxHeight), img, resize.Lanczos3)
-		resizedImages = append(resizedImages, resized)
-		totalWidth += newWidth
+	sources, err := p.fileSources(inputPaths)
+	if err != nil {
+		return err
+	}
+	captions, err := s.captioner(sources, inputPaths, false)
+	if err != nil {
+		return err
+	}
+	concatenated, err := concatenateContext(ctx, sources, false, captions, s.progress)
+	if err != nil {
+		return err
 	}
+	return s.recordFile(outputPath, p.saveJPEGQuality(outputPath, concatenated, s.jpegQuality(p.Config().JpegQuality)))
+}
 
-	// Create a new image with the total width and maximum height
-	concatenated := image.NewRGBA(image.Rect(0, 0, totalWidth, maxHeight))
+// ConcatenateImagesHorizontallyReader combines the images read from the
+// readers like ConcatenateImagesHorizontally and writes the result to w as JPEG.
+// Returns an error if the operation fails.
+func ConcatenateImagesHorizontallyReader(inputs []io.Reader, w io.Writer) error {
+	return defaultProcessor.ConcatenateImagesHorizontallyReader(inputs, w)
+}
 
-	// Draw each resized image onto the concatenated image
-	x := 0
-	for _, img := range resizedImages {
-		bounds := img.Bounds()
-		draw.Draw(concatenated, image.Rect(x, 0, x+bounds.Dx(), maxHeight), img, bounds.Min, draw.Src)
-		x += bounds.Dx()
+// ConcatenateImagesHorizontallyReader is the package function ConcatenateImagesHorizontallyReader with the configuration and logger of p
+func (p *Processor) ConcatenateImagesHorizontallyReader(inputs []io.Reader, w io.Writer) error {
+	sources, err := p.readerSources(inputs)
+	if err != nil {
+		return err
 	}
-
-	// Create the output file
-	out, err := os.Create(outputPath)
+	concatenated, err := concatenate(sources, false, nil, nil)
 	if err != nil {
-		return &ErrInvalidOutput{Path: outputPath}
+		return err
 	}
-	defer out.Close()
+	return p.encodeJPEG(w, concatenated)
+}
 
-	// Encode and save the concatenated image
-	if err := jpeg.Encode(out, concatenated, &jpeg.Options{Quality: cfg.JpegQuality}); err != nil {
-		return &ErrProcessing{Op: "encode", Err: err}
+// ConcatenateHorizontally scales the images to the height of the tallest one,
+// keeping their aspect ratios, and puts them side by side from left to right.
+func ConcatenateHorizontally(images []image.Image) image.Image {
+	// Decoded images cannot fail to decode
+	concatenated, _ := concatenate(imageSources(images), false, nil, nil)
+	return concatenated
+}
+
+// loadImages loads the images at the given paths, in order
+func (p *Processor) loadImages(paths []string) ([]image.Image, error) {
+	images := make([]image.Image, 0, len(paths))
+	for _, path := range paths {
+		img, err := p.loadImage(path)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
 	}
+	return images, nil
+}
 
-	return nil
+// loadImages is Processor.loadImages on the default Processor
+func loadImages(paths []string) ([]image.Image, error) {
+	return defaultProcessor.loadImages(paths)
+}
+
+// decodeImages decodes an image from each reader, in order
+func (p *Processor) decodeImages(inputs []io.Reader) ([]image.Image, error) {
+	images := make([]image.Image, 0, len(inputs))
+	for _, r := range inputs {
+		img, err := p.decodeImage(r)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// decodeImages is Processor.decodeImages on the default Processor
+func decodeImages(inputs []io.Reader) ([]image.Image, error) {
+	return defaultProcessor.decodeImages(inputs)
 }
 
 // GenerateTestImage creates various test images suitable for image processing tests.
 // It takes the output directory path and base dimensions.
 // Returns an error if any operation fails.
 func GenerateTestImage(outputDir string, width, height int) error {
-	slog.Info("generating test images",
+	return defaultProcessor.GenerateTestImage(outputDir, width, height)
+}
+
+// GenerateTestImage is the package function GenerateTestImage with the configuration and logger of p
+func (p *Processor) GenerateTestImage(outputDir string, width, height int) error {
+	p.logger().Info("generating test images",
 		"output_dir", outputDir,
 		"base_width", width,
 		"base_height", height,
@@ -467,33 +705,33 @@ func GenerateTestImage(outputDir string, width, height int) error {
 
 	// Create output directory if it doesn't exist
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return &ErrInvalidOutput{Path: outputDir}
+		return &ErrInvalidOutput{Path: outputDir, Err: err}
 	}
 
 	// Generate random noise image (for denoising test)
-	if err := generateNoiseImage(filepath.Join(outputDir, "noise_test.jpg"), width, height); err != nil {
+	if err := p.generateNoiseImage(filepath.Join(outputDir, "noise_test.jpg"), width, height); err != nil {
 		return err
 	}
 
 	// Generate gradient image (for edge detection test)
-	if err := generateGradientImage(filepath.Join(outputDir, "gradient_test.jpg"), width, height); err != nil {
+	if err := p.generateGradientImage(filepath.Join(outputDir, "gradient_test.jpg"), width, height); err != nil {
 		return err
 	}
 
 	// Generate binary pattern image (for binarization test)
-	if err := generateBinaryPatternImage(filepath.Join(outputDir, "binary_test.jpg"), width, height); err != nil {
+	if err := p.generateBinaryPatternImage(filepath.Join(outputDir, "binary_test.jpg"), width, height); err != nil {
 		return err
 	}
 
 	// Generate rotation test image
-	if err := generateRotationTestImage(filepath.Join(outputDir, "rotation_test.jpg"), width, height); err != nil {
+	if err := p.generateRotationTestImage(filepath.Join(outputDir, "rotation_test.jpg"), width, height); err != nil {
 		return err
 	}
 
 	// Generate aspect ratio test images (for concatenation tests)
 	sizes := [][2]int{{width, height}, {width / 2, height}, {width, height / 2}}
 	for i, size := range sizes {
-		if err := generatePatternImage(
+		if err := p.generatePatternImage(
 			filepath.Join(outputDir, fmt.Sprintf("concat_test_%d.jpg", i+1)),
 			size[0], size[1], i); err != nil {
 			return err
@@ -506,8 +744,8 @@ func GenerateTestImage(outputDir string, width, height int) error {
 	for i, angle := range angles {
 		skewPath := filepath.Join(outputDir, fmt.Sprintf("skew_test_%d.jpg", i+1))
 
-		if err := generateSkewTestImage(skewPath, width, height, angle); err != nil {
-			slog.Error("failed to generate skew test image",
+		if err := p.generateSkewTestImage(skewPath, width, height, angle); err != nil {
+			p.logger().Error("failed to generate skew test image",
 				"error", err,
 				"path", skewPath,
 				"angle", angle)
@@ -516,7 +754,7 @@ func GenerateTestImage(outputDir string, width, height int) error {
 
 		// 生成後の確認
 		if _, err := os.Stat(skewPath); os.IsNotExist(err) {
-			slog.Error("skew test image was not created",
+			p.logger().Error("skew test image was not created",
 				"path", skewPath)
 			return fmt.Errorf("failed to create skew test image: %s", skewPath)
 		}
@@ -525,24 +763,32 @@ func GenerateTestImage(outputDir string, width, height int) error {
 	return nil
 }
 
+// deterministicSeed seeds the noise of generated test images when the
+// configuration is deterministic
+const deterministicSeed = 1
+
 // generateNoiseImage creates an image with random noise
-func generateNoiseImage(outputPath string, width, height int) error {
+func (p *Processor) generateNoiseImage(outputPath string, width, height int) error {
+	intn := rand.Intn
+	if p.Config().Deterministic {
+		intn = rand.New(rand.NewSource(deterministicSeed)).Intn
+	}
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
 			img.Set(x, y, color.RGBA{
-				R: uint8(rand.Intn(256)),
-				G: uint8(rand.Intn(256)),
-				B: uint8(rand.Intn(256)),
+				R: uint8(intn(256)),
+				G: uint8(intn(256)),
+				B: uint8(intn(256)),
 				A: 255,
 			})
 		}
 	}
-	return saveJPEG(outputPath, img)
+	return p.saveJPEG(outputPath, img)
 }
 
 // generateGradientImage creates an image with gradients for edge detection testing
-func generateGradientImage(outputPath string, width, height int) error {
+func (p *Processor) generateGradientImage(outputPath string, width, height int) error {
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
@@ -556,11 +802,11 @@ func generateGradientImage(outputPath string, width, height int) error {
 			}
 		}
 	}
-	return saveJPEG(outputPath, img)
+	return p.saveJPEG(outputPath, img)
 }
 
 // generateBinaryPatternImage creates an image with clear black and white patterns
-func generateBinaryPatternImage(outputPath string, width, height int) error {
+func (p *Processor) generateBinaryPatternImage(outputPath string, width, height int) error {
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
 	blockSize := 20
 	for y := 0; y < height; y++ {
@@ -574,11 +820,11 @@ func generateBinaryPatternImage(outputPath string, width, height int) error {
 			}
 		}
 	}
-	return saveJPEG(outputPath, img)
+	return p.saveJPEG(outputPath, img)
 }
 
 // generateRotationTestImage creates an image with patterns that make rotation visible
-func generateRotationTestImage(outputPath string, width, height int) error {
+func (p *Processor) generateRotationTestImage(outputPath string, width, height int) error {
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
 	// Draw background
 	for y := 0; y < height; y++ {
@@ -593,11 +839,11 @@ func generateRotationTestImage(outputPath string, width, height int) error {
 	drawArrow(img, width/2, height/2, -width/4, 0)  // Left
 	drawArrow(img, width/2, height/2, 0, -height/4) // Up
 
-	return saveJPEG(outputPath, img)
+	return p.saveJPEG(outputPath, img)
 }
 
 // generatePatternImage creates an image with a distinct pattern and index number
-func generatePatternImage(outputPath string, width, height int, index int) error {
+func (p *Processor) generatePatternImage(outputPath string, width, height int, index int) error {
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
 
 	// Create a unique color based on index
@@ -616,7 +862,7 @@ func generatePatternImage(outputPath string, width, height int, index int) error
 		}
 	}
 
-	return saveJPEG(outputPath, img)
+	return p.saveJPEG(outputPath, img)
 }
 
 // drawArrow draws an arrow on the image
@@ -653,8 +899,8 @@ func drawArrow(img *image.RGBA, x, y, dx, dy int) {
 }
 
 // generateSkewTestImage creates a test image with text-like patterns and grid lines
-func generateSkewTestImage(outputPath string, width, height int, angleInDegrees float64) error {
-	slog.Info("generating skew test image",
+func (p *Processor) generateSkewTestImage(outputPath string, width, height int, angleInDegrees float64) error {
+	p.logger().Info("generating skew test image",
 		"path", outputPath,
 		"width", width,
 		"height", height,
@@ -681,7 +927,7 @@ func generateSkewTestImage(outputPath string, width, height int, angleInDegrees
 	}
 
 	// Apply rotation
-	rotated := rotateImage(img, angleInDegrees)
+	rotated := Rotate(img, angleInDegrees)
 
 	// Check if output directory exists
 	dir := filepath.Dir(outputPath)
@@ -690,60 +936,388 @@ func generateSkewTestImage(outputPath string, width, height int, angleInDegrees
 	}
 
 	// Save to file
-	return saveJPEG(outputPath, rotated)
+	return p.saveJPEG(outputPath, rotated)
 }
 
 // saveJPEG saves an image as JPEG
+func (p *Processor) saveJPEG(outputPath string, img image.Image) error {
+	return p.saveJPEGQuality(outputPath, img, p.Config().JpegQuality)
+}
+
+// saveJPEG is Processor.saveJPEG on the default Processor
 func saveJPEG(outputPath string, img image.Image) error {
-	out, err := os.Create(outputPath)
+	return defaultProcessor.saveJPEG(outputPath, img)
+}
+
+// saveJPEGQuality encodes the image as JPEG with the given quality, 1-100
+func (p *Processor) saveJPEGQuality(outputPath string, img image.Image, quality int) error {
+	out, err := p.createOutput(outputPath)
 	if err != nil {
-		return &ErrInvalidOutput{Path: outputPath}
+		return err
 	}
 	defer out.Close()
 
-	return jpeg.Encode(out, img, &jpeg.Options{Quality: cfg.JpegQuality})
+	if err := encodeJPEGQuality(out, img, quality); err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+// saveJPEGQuality is Processor.saveJPEGQuality on the default Processor
+func saveJPEGQuality(outputPath string, img image.Image, quality int) error {
+	return defaultProcessor.saveJPEGQuality(outputPath, img, quality)
 }
 
-// AutoRotateImage automatically detects and corrects image skew
-func AutoRotateImage(inputPath string, outputPath string) error {
-	// 1. Load the input image
-	file, err := os.Open(inputPath)
+// loadImage opens and decodes the image at the given path.
+// Truncated files, such as partial downloads, are decoded as far as possible.
+func (p *Processor) loadImage(inputPath string) (image.Image, error) {
+	data, release, err := p.readInput(inputPath)
 	if err != nil {
-		return &ErrInvalidInput{Path: inputPath}
+		return nil, &ErrInvalidInput{Path: inputPath, Err: err}
 	}
-	defer file.Close()
+	// The decoders copy the pixels, so the input can be released afterwards
+	defer release()
+	return p.decodeImageData(data, inputPath)
+}
+
+// loadImage is Processor.loadImage on the default Processor
+func loadImage(inputPath string) (image.Image, error) {
+	return defaultProcessor.loadImage(inputPath)
+}
 
-	img, _, err := image.Decode(file)
+// decodeImage reads and decodes an image from r. Like loadImage it decodes
+// truncated data as far as possible, so r is read to the end first.
+func (p *Processor) decodeImage(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
-		return &ErrProcessing{Op: "decode", Err: err}
+		return nil, &ErrProcessing{Op: "read", Err: err}
 	}
+	return p.decodeImageData(data, "")
+}
 
-	// 2. Detect edges using Sobel operator
-	edges := detectEdges(img)
+// decodeImage is Processor.decodeImage on the default Processor
+func decodeImage(r io.Reader) (image.Image, error) {
+	return defaultProcessor.decodeImage(r)
+}
 
-	// 3. Detect lines using Hough transform and calculate skew angle
-	angle := detectSkewAngle(edges)
+// decodeImageData decodes an encoded image, falling back to the available
+// part of truncated data. CMYK images are converted to RGB, so the
+// operations see the colors they print as. The name is only used for logging.
+func (p *Processor) decodeImageData(data []byte, name string) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil && jpegComponents(data) == 4 {
+		img, err = decodeCMYKJPEG(data, err)
+	}
+	if err != nil {
+		partial, partialErr := decodeTruncated(data)
+		if partialErr == nil {
+			p.logger().Warn("input is truncated, decoded the available part", "path", name)
+			img, err = partial, nil
+		}
+	}
+	if err != nil {
+		return nil, &ErrProcessing{Op: "decode", Err: err}
+	}
+	if cmyk, ok := img.(*image.CMYK); ok {
+		return cmykToRGBA(cmyk, jpegICCProfile(data), p.Config().Deterministic), nil
+	}
+	return img, nil
+}
+
+// decodeImageData is Processor.decodeImageData on the default Processor
+func decodeImageData(data []byte, name string) (image.Image, error) {
+	return defaultProcessor.decodeImageData(data, name)
+}
+
+// encodeJPEG writes the image to w as JPEG with the configured quality
+func (p *Processor) encodeJPEG(w io.Writer, img image.Image) error {
+	return encodeJPEGQuality(w, img, p.Config().JpegQuality)
+}
 
-	// 4. Rotate image by the detected angle
-	rotated := rotateImage(img, -angle) // Apply counter-rotation for correction
+// encodeJPEG is Processor.encodeJPEG on the default Processor
+func encodeJPEG(w io.Writer, img image.Image) error {
+	return defaultProcessor.encodeJPEG(w, img)
+}
 
-	// 5. Create output file
-	out, err := os.Create(outputPath)
+// encodeJPEGQuality writes the image to w as JPEG with the given quality, 1-100.
+// JPEG has 8 bits per sample, and image/jpeg only writes grayscale for
+// *image.Gray, so 16-bit grays are narrowed first instead of becoming color.
+func encodeJPEGQuality(w io.Writer, img image.Image, quality int) error {
+	if gray, ok := img.(*image.Gray16); ok {
+		img = toGray(gray)
+	}
+	if err := jpeg.Encode(w, img, &jpeg.Options{Quality: quality}); err != nil {
+		return &ErrProcessing{Op: "encode", Err: err}
+	}
+	return nil
+}
+
+// toGray converts the image to an 8-bit grayscale image
+func toGray(img image.Image) *image.Gray {
+	return grayInto(image.NewGray(img.Bounds()), img)
+}
+
+// grayInto converts the image to grayscale in grayImg, which has its bounds
+func grayInto(grayImg *image.Gray, img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	w := bounds.Dx()
+	switch src := img.(type) {
+	case *image.Gray:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			copy(grayImg.Pix[grayImg.PixOffset(bounds.Min.X, y):][:w], src.Pix[src.PixOffset(bounds.Min.X, y):])
+		}
+		return grayImg
+	case *image.RGBA:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			grayFromRGBARow(grayImg.Pix[grayImg.PixOffset(bounds.Min.X, y):][:w], src.Pix[src.PixOffset(bounds.Min.X, y):])
+		}
+		return grayImg
+	case *image.YCbCr:
+		grayFromYCbCr(grayImg, src)
+		return grayImg
+	case *image.Gray16:
+		// color.GrayModel keeps the high byte of a 16-bit gray
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			row := grayImg.Pix[grayImg.PixOffset(bounds.Min.X, y):][:w]
+			s := src.Pix[src.PixOffset(bounds.Min.X, y):]
+			for i := range row {
+				row[i] = s[2*i]
+			}
+		}
+		return grayImg
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			grayImg.Set(x, y, color.GrayModel.Convert(img.At(x, y)))
+		}
+	}
+	return grayImg
+}
+
+// Box is an axis-aligned rectangle in pixel coordinates, used for reporting
+// detected regions as JSON.
+type Box struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// boxFromRect converts an image.Rectangle into a Box
+func boxFromRect(r image.Rectangle) Box {
+	return Box{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// Rect returns the box as an image.Rectangle
+func (b Box) Rect() image.Rectangle {
+	return image.Rect(b.X, b.Y, b.X+b.Width, b.Y+b.Height)
+}
+
+// AutoRotateOptions controls when AutoRotateImageWithOptions applies the detected correction
+type AutoRotateOptions struct {
+	// Method selects the skew estimator: SkewMethodHough (the default) or SkewMethodProjection
+	Method string
+	// MaxAngle skips the rotation when the detected skew exceeds it, in degrees (0 means no limit)
+	MaxAngle float64
+	// MinConfidence skips the rotation when the detection confidence is below it (0 to 1)
+	MinConfidence float64
+	// Content turns photos without an EXIF orientation upright from where
+	// their bright, smooth sky is. It is off by default: document scans have
+	// no sky, and a page with a blank bottom half would be turned upside down.
+	Content bool
+	// Progress, when set, receives the progress of the skew detection and
+	// of the rotation, as two passes
+	Progress ProgressFunc
+}
+
+// AutoRotateResult describes the skew found by AutoRotateImageWithOptions
+type AutoRotateResult struct {
+	// Angle is the detected skew in degrees, in the range [-45, 45)
+	Angle float64 `json:"angle"`
+	// Confidence is how clearly the strongest line direction stands out (0 to 1)
+	Confidence float64 `json:"confidence"`
+	// Rotated reports whether the correction was applied
+	Rotated bool `json:"rotated"`
+}
+
+// AutoRotateImage automatically detects and corrects image skew.
+// Photos are first turned upright by quarter turns using their EXIF
+// orientation; AutoRotateOptions.Content adds a sky/edge distribution
+// heuristic for photos without one.
+func AutoRotateImage(inputPath string, outputPath string) error {
+	return defaultProcessor.AutoRotateImage(inputPath, outputPath)
+}
+
+// AutoRotateImage is the package function AutoRotateImage with the configuration and logger of p
+func (p *Processor) AutoRotateImage(inputPath string, outputPath string) error {
+	_, err := p.AutoRotateImageWithOptions(inputPath, outputPath, AutoRotateOptions{})
+	return err
+}
+
+// AutoRotateImageWithOptions automatically detects and corrects image skew like
+// AutoRotateImage, but leaves the skew uncorrected when the detection is larger
+// than opts.MaxAngle or less confident than opts.MinConfidence.
+// It takes the paths of the input and output files and the options.
+// Returns the detected angle and confidence, or an error if the operation fails.
+func AutoRotateImageWithOptions(inputPath string, outputPath string, opts AutoRotateOptions) (*AutoRotateResult, error) {
+	return defaultProcessor.AutoRotateImageWithOptions(inputPath, outputPath, opts)
+}
+
+// AutoRotateImageWithOptions is the package function AutoRotateImageWithOptions with the configuration and logger of p
+func (p *Processor) AutoRotateImageWithOptions(inputPath string, outputPath string, opts AutoRotateOptions) (*AutoRotateResult, error) {
+	return p.AutoRotateImageContext(context.Background(), inputPath, outputPath, opts)
+}
+
+// AutoRotateImageContext corrects the skew of the input image like
+// AutoRotateImageWithOptions. Skew detection on a large scan can take
+// minutes; when ctx is cancelled the operation stops early and returns ctx's
+// error without writing the output.
+func AutoRotateImageContext(ctx context.Context, inputPath string, outputPath string, opts AutoRotateOptions) (*AutoRotateResult, error) {
+	return defaultProcessor.AutoRotateImageContext(ctx, inputPath, outputPath, opts)
+}
+
+// AutoRotateImageContext is the package function AutoRotateImageContext with the configuration and logger of p
+func (p *Processor) AutoRotateImageContext(ctx context.Context, inputPath string, outputPath string, opts AutoRotateOptions) (*AutoRotateResult, error) {
+	p.logger().Info("auto-rotating image", "input", inputPath)
+
+	// 1. Load the input image
+	img, err := p.loadImage(inputPath)
 	if err != nil {
-		return &ErrInvalidOutput{Path: outputPath}
+		return nil, err
+	}
+	exif, _ := readExif(inputPath)
+	corrected, result, err := autoRotateImage(ctx, img, exif, opts)
+	if err != nil {
+		return nil, err
 	}
-	defer out.Close()
 
-	// 6. Save the corrected image
-	if err := jpeg.Encode(out, rotated, &jpeg.Options{Quality: cfg.JpegQuality}); err != nil {
-		return &ErrProcessing{Op: "encode", Err: err}
+	// 5. Save the corrected image
+	if err := p.saveJPEG(outputPath, corrected); err != nil {
+		return nil, err
 	}
+	return result, nil
+}
 
-	return nil
+// AutoRotateImageReader corrects the skew of the image read from r like
+// AutoRotateImage and writes it to w as JPEG.
+// Returns an error if the operation fails.
+func AutoRotateImageReader(r io.Reader, w io.Writer) error {
+	return defaultProcessor.AutoRotateImageReader(r, w)
+}
+
+// AutoRotateImageReader is the package function AutoRotateImageReader with the configuration and logger of p
+func (p *Processor) AutoRotateImageReader(r io.Reader, w io.Writer) error {
+	_, err := p.AutoRotateImageReaderWithOptions(r, w, AutoRotateOptions{})
+	return err
 }
 
-// detectSkewAngle detects the skew angle of the image using Hough transform
-func detectSkewAngle(edges *image.Gray) float64 {
+// AutoRotateImageReaderWithOptions corrects the skew of the image read from r
+// like AutoRotateImageWithOptions and writes it to w as JPEG.
+// Returns the detected angle and confidence, or an error if the operation fails.
+func AutoRotateImageReaderWithOptions(r io.Reader, w io.Writer, opts AutoRotateOptions) (*AutoRotateResult, error) {
+	return defaultProcessor.AutoRotateImageReaderWithOptions(r, w, opts)
+}
+
+// AutoRotateImageReaderWithOptions is the package function AutoRotateImageReaderWithOptions with the configuration and logger of p
+func (p *Processor) AutoRotateImageReaderWithOptions(r io.Reader, w io.Writer, opts AutoRotateOptions) (*AutoRotateResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "read", Err: err}
+	}
+	img, err := p.decodeImageData(data, "")
+	if err != nil {
+		return nil, err
+	}
+	exif, _ := decodeExif(bytes.NewReader(data))
+	corrected, result, err := autoRotateImage(context.Background(), img, exif, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.encodeJPEG(w, corrected); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AutoRotate corrects the skew of the image like AutoRotateImage. A decoded
+// image has no EXIF orientation, so it is not turned by quarter turns; use
+// AutoRotateWithOptions with Content set for the content heuristic.
+func AutoRotate(img image.Image) image.Image {
+	// The default method cannot fail
+	corrected, _, _ := autoRotateImage(context.Background(), img, nil, AutoRotateOptions{})
+	return corrected
+}
+
+// AutoRotateWithOptions corrects the skew of the image like
+// AutoRotateImageWithOptions.
+// Returns the corrected image and the detected angle and confidence, or an
+// error if the method is unknown.
+func AutoRotateWithOptions(img image.Image, opts AutoRotateOptions) (image.Image, *AutoRotateResult, error) {
+	return autoRotateImage(context.Background(), img, nil, opts)
+}
+
+// autoRotateImage turns the image upright and corrects its skew. The EXIF
+// metadata of the source may be nil. Returns ctx's error when ctx is
+// cancelled.
+func autoRotateImage(ctx context.Context, img image.Image, exif *exifInfo, opts AutoRotateOptions) (image.Image, *AutoRotateResult, error) {
+	// Turn sideways or upside-down photos upright before measuring skew
+	img = uprightImage(img, exif, opts.Content)
+	progress := opts.Progress
+	if progress == nil {
+		progress = progressFrom(ctx)
+	}
+	detectCtx := withProgress(ctx, progress.phase(0, 2))
+
+	// 2-3. Estimate the skew angle
+	var angle, confidence float64
+	var err error
+	switch opts.Method {
+	case "", SkewMethodHough:
+		// Detect edges using Sobel operator, then lines using Hough transform
+		angle, confidence, err = detectSkewAngle(detectCtx, detectEdges(img))
+	case SkewMethodProjection:
+		angle, confidence, err = detectSkewProjection(detectCtx, img)
+	default:
+		return nil, nil, &ErrProcessing{Op: "autorotate", Err: fmt.Errorf("unknown skew detection method: %s", opts.Method)}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	result := &AutoRotateResult{Angle: angle, Confidence: confidence}
+
+	// 4. Rotate image by the detected angle unless the detection is unreliable
+	switch {
+	case opts.MaxAngle > 0 && math.Abs(angle) > opts.MaxAngle:
+		slog.Info("skipping rotation, angle above limit",
+			"angle", angle,
+			"confidence", confidence,
+			"max_angle", opts.MaxAngle)
+		progress.report(1, 1)
+		return img, result, nil
+	case confidence < opts.MinConfidence:
+		slog.Info("skipping rotation, confidence below limit",
+			"angle", angle,
+			"confidence", confidence,
+			"min_confidence", opts.MinConfidence)
+		progress.report(1, 1)
+		return img, result, nil
+	}
+	slog.Info("correcting skew",
+		"method", opts.Method,
+		"angle", angle,
+		"confidence", confidence)
+	rotated, err := rotateContext(withProgress(ctx, progress.phase(1, 2)), img, -angle) // Apply counter-rotation for correction
+	if err != nil {
+		return nil, nil, err
+	}
+	result.Rotated = true
+	return rotated, result, nil
+}
+
+// detectSkewAngle detects the skew angle of the image using Hough transform.
+// Returns the angle in degrees and a confidence between 0 and 1, or ctx's
+// error when ctx is cancelled.
+func detectSkewAngle(ctx context.Context, edges *image.Gray) (float64, float64, error) {
 	bounds := edges.Bounds()
 	width, height := bounds.Dx(), bounds.Dy()
 
@@ -756,7 +1330,12 @@ func detectSkewAngle(edges *image.Gray) float64 {
 	}
 
 	// Apply Hough transform to edge points
+	progress := progressFrom(ctx)
 	for y := 0; y < height; y++ {
+		if err := ctx.Err(); err != nil {
+			return 0, 0, err
+		}
+		progress.report(y, height)
 		for x := 0; x < width; x++ {
 			if edges.GrayAt(x, y).Y > 127 {
 				for theta := 0; theta < angleRange; theta++ {
@@ -770,28 +1349,72 @@ func detectSkewAngle(edges *image.Gray) float64 {
 			}
 		}
 	}
+	progress.report(height, height)
 
-	// Find the angle of the strongest line
+	// Find the strongest line for every angle
+	peaks := make([]int, angleRange)
 	maxVotes := 0
-	dominantAngle := 0.0
+	dominantTheta := 0
 	for theta := 0; theta < angleRange; theta++ {
 		for rho := 0; rho < rhoRange*2; rho++ {
-			if accumulator[theta][rho] > maxVotes {
-				maxVotes = accumulator[theta][rho]
-				dominantAngle = float64(theta)
+			if accumulator[theta][rho] > peaks[theta] {
+				peaks[theta] = accumulator[theta][rho]
 			}
 		}
+		if peaks[theta] > maxVotes {
+			maxVotes = peaks[theta]
+			dominantTheta = theta
+		}
+	}
+	if maxVotes == 0 {
+		return 0, 0, nil
+	}
+
+	// Confidence compares the winner with the best line in any other direction.
+	// Perpendicular lines agree on the skew, so directions are compared modulo 90 degrees.
+	runnerUp := 0
+	for theta := 0; theta < angleRange; theta++ {
+		distance := math.Mod(math.Abs(float64(theta-dominantTheta)), 90)
+		distance = math.Min(distance, 90-distance)
+		if distance > 2 && peaks[theta] > runnerUp {
+			runnerUp = peaks[theta]
+		}
+	}
+	confidence := 1 - float64(runnerUp)/float64(maxVotes)
+
+	// A horizontal line has theta 90 and a vertical one theta 0, so the skew
+	// is the offset from the nearest of the two, in the range [-45, 45)
+	skew := math.Mod(float64(dominantTheta-90)+45, 90)
+	if skew < 0 {
+		skew += 90
 	}
+	return skew - 45, confidence, nil
+}
 
-	// Return the skew angle relative to 90 degrees
-	if dominantAngle > 90 {
-		dominantAngle -= 180
+// Rotate rotates the image by the specified angle in degrees. The result is
+// enlarged to hold the whole rotated image, and the corners are transparent.
+func Rotate(img image.Image, angle float64) image.Image {
+	// The background context is never cancelled
+	rotated, _ := rotateContext(context.Background(), img, angle)
+	return rotated
+}
+
+// RotateWith rotates the image like Rotate, taking the result from the pool
+// given with WithBuffers.
+// Returns an error if an option is invalid.
+func RotateWith(img image.Image, angle float64, opts ...Option) (image.Image, error) {
+	s, err := newSettings("rotate", opts)
+	if err != nil {
+		return nil, err
 	}
-	return dominantAngle
+	// The background context is never cancelled
+	rotated, _ := rotateContext(withBuffers(withProgress(context.Background(), s.progress), s.buffers), img, angle)
+	return rotated, nil
 }
 
-// rotateImage rotates the image by the specified angle in degrees
-func rotateImage(img image.Image, angle float64) image.Image {
+// rotateContext rotates the image like Rotate, checking ctx for cancellation
+// between rows.
+func rotateContext(ctx context.Context, img image.Image, angle float64) (image.Image, error) {
 	// Convert angle to radians
 	radians := angle * math.Pi / 180
 
@@ -801,13 +1424,18 @@ func rotateImage(img image.Image, angle float64) image.Image {
 	newW, newH := rotatedSize(w, h, radians)
 
 	// Create a new image with the rotated size
-	rotated := image.NewRGBA(image.Rect(0, 0, newW, newH))
+	rotated := buffersFrom(ctx).newRGBA(image.Rect(0, 0, newW, newH))
 
 	// Rotate the image
 	centerX, centerY := float64(w)/2, float64(h)/2
 	newCenterX, newCenterY := float64(newW)/2, float64(newH)/2
 
+	progress := progressFrom(ctx)
 	for y := 0; y < newH; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		progress.report(y, newH)
 		for x := 0; x < newW; x++ {
 			// Translate to origin
 			xr := float64(x) - newCenterX
@@ -826,47 +1454,14 @@ func rotateImage(img image.Image, angle float64) image.Image {
 			}
 		}
 	}
+	progress.report(newH, newH)
 
-	return rotated
+	return rotated, nil
 }
 
 // detectEdges converts the image to grayscale and applies Sobel edge detection
 func detectEdges(img image.Image) *image.Gray {
-	bounds := img.Bounds()
-	grayImg := image.NewGray(bounds)
-
-	// Convert to grayscale
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			grayImg.Set(x, y, color.GrayModel.Convert(img.At(x, y)))
-		}
-	}
-
-	// Apply Sobel operator
-	edges := image.NewGray(bounds)
-	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
-		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
-			// Sobel kernels
-			gx := float64(-1)*float64(grayImg.GrayAt(x-1, y-1).Y) +
-				float64(1)*float64(grayImg.GrayAt(x+1, y-1).Y) +
-				float64(-2)*float64(grayImg.GrayAt(x-1, y).Y) +
-				float64(2)*float64(grayImg.GrayAt(x+1, y).Y) +
-				float64(-1)*float64(grayImg.GrayAt(x-1, y+1).Y) +
-				float64(1)*float64(grayImg.GrayAt(x+1, y+1).Y)
-
-			gy := float64(-1)*float64(grayImg.GrayAt(x-1, y-1).Y) +
-				float64(1)*float64(grayImg.GrayAt(x-1, y+1).Y) +
-				float64(-2)*float64(grayImg.GrayAt(x, y-1).Y) +
-				float64(2)*float64(grayImg.GrayAt(x, y+1).Y) +
-				float64(-1)*float64(grayImg.GrayAt(x+1, y-1).Y) +
-				float64(1)*float64(grayImg.GrayAt(x+1, y+1).Y)
-
-			magnitude := math.Sqrt(gx*gx + gy*gy)
-			edges.Set(x, y, color.Gray{Y: uint8(math.Min(magnitude, 255))})
-		}
-	}
-
-	return edges
+	return sobelMagnitude(toGray(img))
 }
 
 func BenchmarkResizeImage(b *testing.B) {
@@ -933,35 +1528,132 @@ func BenchmarkConcatenateImagesHorizontally(b *testing.B) {
 // It takes the paths of the input and output files.
 // Returns an error if the operation fails.
 func DetectEdges(inputPath string, outputPath string) error {
-	slog.Info("concatenating images horizontally",
-		"count", len(inputPath),
-		"output", outputPath)
+	return defaultProcessor.DetectEdges(inputPath, outputPath)
+}
+
+// DetectEdges is the package function DetectEdges with the configuration and logger of p
+func (p *Processor) DetectEdges(inputPath string, outputPath string) error {
+	return p.DetectEdgesWith(inputPath, outputPath)
+}
+
+// DetectEdgesWith applies Sobel edge detection to the input image like
+// DetectEdges, keeping only the edges at or above the threshold set by
+// WithThreshold and saving with the quality set by WithQuality, a few rows at
+// a time with WithTiled.
+// Returns an error if an option is invalid or the operation fails.
+func DetectEdgesWith(inputPath string, outputPath string, opts ...Option) error {
+	return defaultProcessor.DetectEdgesWith(inputPath, outputPath, opts...)
+}
+
+// DetectEdgesWith is the package function DetectEdgesWith with the configuration and logger of p
+func (p *Processor) DetectEdgesWith(inputPath string, outputPath string, opts ...Option) error {
+	return p.DetectEdgesContext(context.Background(), inputPath, outputPath, opts...)
+}
+
+// DetectEdgesContext applies Sobel edge detection to the input image like
+// DetectEdgesWith, stopping early with ctx's error when ctx is cancelled.
+func DetectEdgesContext(ctx context.Context, inputPath string, outputPath string, opts ...Option) error {
+	return defaultProcessor.DetectEdgesContext(ctx, inputPath, outputPath, opts...)
+}
+
+// DetectEdgesContext is the package function DetectEdgesContext with the configuration and logger of p
+func (p *Processor) DetectEdgesContext(ctx context.Context, inputPath string, outputPath string, opts ...Option) error {
+	s, err := newSettings("edges", opts)
+	if err != nil {
+		return err
+	}
+	p.logger().Info("detecting edges", "input", inputPath, "tiled", s.tiled)
 
-	// Open the input file
-	file, err := os.Open(inputPath)
+	if s.tiled {
+		return s.recordFile(outputPath, p.edgesTiled(ctx, inputPath, outputPath, s))
+	}
+	img, err := p.loadImage(inputPath)
 	if err != nil {
-		return &ErrInvalidInput{Path: inputPath}
+		return err
+	}
+	edgeImg, err := edgesContext(ctx, img, s.threshold, s.scratch())
+	if err != nil {
+		return err
 	}
-	defer file.Close()
+	defer s.scratch().Put(edgeImg)
+	return s.recordFile(outputPath, p.saveJPEGQuality(outputPath, edgeImg, s.jpegQuality(jpeg.DefaultQuality)))
+}
+
+// DetectEdgesReader applies Sobel edge detection to the image read from r
+// like DetectEdges and writes the result to w as JPEG.
+// Returns an error if the operation fails.
+func DetectEdgesReader(r io.Reader, w io.Writer) error {
+	return defaultProcessor.DetectEdgesReader(r, w)
+}
 
-	// Decode the image
-	img, _, err := image.Decode(file)
+// DetectEdgesReader is the package function DetectEdgesReader with the configuration and logger of p
+func (p *Processor) DetectEdgesReader(r io.Reader, w io.Writer) error {
+	return p.DetectEdgesReaderWith(r, w)
+}
+
+// DetectEdgesReaderWith applies Sobel edge detection to the image read from r
+// like DetectEdgesWith and writes the result to w as JPEG.
+// Returns an error if an option is invalid or the operation fails.
+func DetectEdgesReaderWith(r io.Reader, w io.Writer, opts ...Option) error {
+	return defaultProcessor.DetectEdgesReaderWith(r, w, opts...)
+}
+
+// DetectEdgesReaderWith is the package function DetectEdgesReaderWith with the configuration and logger of p
+func (p *Processor) DetectEdgesReaderWith(r io.Reader, w io.Writer, opts ...Option) error {
+	s, err := newSettings("edges", opts)
+	if err != nil {
+		return err
+	}
+	img, err := p.decodeImage(r)
+	if err != nil {
+		return err
+	}
+	w = s.countOutput(w)
+	edgeImg := edges(img, s.threshold, s.scratch())
+	defer s.scratch().Put(edgeImg)
+	return s.recordOutput(w, encodeJPEGQuality(w, edgeImg, s.jpegQuality(jpeg.DefaultQuality)))
+}
+
+// Edges returns the Sobel gradient magnitude of the image in gray, leaving
+// the one pixel border black.
+func Edges(img image.Image) image.Image {
+	return edges(img, -1, nil)
+}
+
+// EdgesWith detects edges like Edges, turning gradients at or above the
+// threshold set by WithThreshold white and the rest black.
+// Returns an error if an option is invalid.
+func EdgesWith(img image.Image, opts ...Option) (image.Image, error) {
+	s, err := newSettings("edges", opts)
 	if err != nil {
-		return &ErrProcessing{Op: "decode", Err: err}
+		return nil, err
 	}
+	return edges(img, s.threshold, s.buffers), nil
+}
+
+// edges returns the Sobel gradient magnitude of the image, or black and
+// white edges when threshold is not negative. The result is taken from pool.
+func edges(img image.Image, threshold int, pool *BufferPool) image.Image {
+	// The background context is never cancelled
+	edgeImg, _ := edgesContext(context.Background(), img, threshold, pool)
+	return edgeImg
+}
 
+// edgesContext detects edges like edges, checking ctx for cancellation
+// between rows.
+func edgesContext(ctx context.Context, img image.Image, threshold int, pool *BufferPool) (image.Image, error) {
 	// Convert to grayscale
 	bounds := img.Bounds()
-	grayImg := image.NewGray(bounds)
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			grayImg.Set(x, y, color.GrayModel.Convert(img.At(x, y)))
-		}
-	}
+	grayImg := grayInto(buffers.newGray(bounds), img)
+	defer buffers.Put(grayImg)
 
 	// Apply Sobel operator
-	edgeImg := image.NewGray(bounds)
+	edgeImg := pool.newGray(bounds)
 	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		if err := ctx.Err(); err != nil {
+			pool.Put(edgeImg)
+			return nil, err
+		}
 		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
 			// Sobel kernels
 			gx := -1*int(grayImg.GrayAt(x-1, y-1).Y) + 1*int(grayImg.GrayAt(x+1, y-1).Y) +
@@ -972,44 +1664,81 @@ func DetectEdges(inputPath string, outputPath string) error {
 				-2*int(grayImg.GrayAt(x, y-1).Y) + 2*int(grayImg.GrayAt(x, y+1).Y) +
 				-1*int(grayImg.GrayAt(x+1, y-1).Y) + 1*int(grayImg.GrayAt(x+1, y+1).Y)
 
-			magnitude := uint8(math.Sqrt(float64(gx*gx + gy*gy)))
-			edgeImg.Set(x, y, color.Gray{magnitude})
+			edgeImg.Set(x, y, color.Gray{edgeLevel(gx, gy, threshold)})
 		}
 	}
+	return edgeImg, nil
+}
 
-	// Create the output file
-	out, err := os.Create(outputPath)
-	if err != nil {
-		return &ErrInvalidOutput{Path: outputPath}
-	}
-	defer out.Close()
-
-	// Encode and save the edge-detected image
-	if err := jpeg.Encode(out, edgeImg, nil); err != nil {
-		return &ErrProcessing{Op: "encode", Err: err}
+// edgeLevel is the gray level of the Sobel gradient (gx, gy): its magnitude,
+// or white or black against the threshold when it is not negative
+func edgeLevel(gx, gy, threshold int) uint8 {
+	magnitude := uint8(math.Sqrt(float64(gx*gx + gy*gy)))
+	if threshold >= 0 {
+		if int(magnitude) >= threshold {
+			return 255
+		}
+		return 0
 	}
-
-	return nil
+	return magnitude
 }
 
+// Sentinel errors for errors.Is. The error types below wrap their cause, so
+// a missing input is told from an unreadable one with
+// errors.Is(err, ErrNotFound) whichever operation reported it.
+var (
+	// ErrNotFound is matched by errors for files that do not exist. It is
+	// fs.ErrNotExist, so os errors match it too.
+	ErrNotFound = fs.ErrNotExist
+	// ErrPermission is matched by errors for files that may not be read or
+	// written. It is fs.ErrPermission.
+	ErrPermission = fs.ErrPermission
+	// ErrUnsupported is matched by ErrUnsupportedFormat
+	ErrUnsupported = errors.New("unsupported image format")
+)
+
 // ErrInvalidInput represents an error when the input file is invalid or cannot be opened.
+// Err is the cause, such as the error of os.Open, if any.
 type ErrInvalidInput struct {
 	Path string
+	Err  error
 }
 
 func (e *ErrInvalidInput) Error() string {
+	if e.Path == "" && e.Err != nil {
+		// Invalid parameters of an in-memory image have no file to name
+		return fmt.Sprintf("invalid input: %v", e.Err)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("invalid input file: %s: %v", e.Path, e.Err)
+	}
 	return fmt.Sprintf("invalid input file: %s", e.Path)
 }
 
+// Unwrap returns the cause of the error
+func (e *ErrInvalidInput) Unwrap() error {
+	return e.Err
+}
+
 // ErrInvalidOutput represents an error when the output file cannot be created or written to.
+// Err is the cause, such as the error of os.Create, if any.
 type ErrInvalidOutput struct {
 	Path string
+	Err  error
 }
 
 func (e *ErrInvalidOutput) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("invalid output file: %s: %v", e.Path, e.Err)
+	}
 	return fmt.Sprintf("invalid output file: %s", e.Path)
 }
 
+// Unwrap returns the cause of the error
+func (e *ErrInvalidOutput) Unwrap() error {
+	return e.Err
+}
+
 // ErrProcessing represents a general error during image processing.
 type ErrProcessing struct {
 	Op  string
@@ -1020,6 +1749,11 @@ func (e *ErrProcessing) Error() string {
 	return fmt.Sprintf("error during %s: %v", e.Op, e.Err)
 }
 
+// Unwrap returns the cause of the error
+func (e *ErrProcessing) Unwrap() error {
+	return e.Err
+}
+
 // ErrUnsupportedFormat represents an error when the image format is not supported.
 type ErrUnsupportedFormat struct {
 	Format string
@@ -1028,3 +1762,8 @@ type ErrUnsupportedFormat struct {
 func (e *ErrUnsupportedFormat) Error() string {
 	return fmt.Sprintf("unsupported image format: %s", e.Format)
 }
+
+// Is reports whether target is ErrUnsupported
+func (e *ErrUnsupportedFormat) Is(target error) bool {
+	return target == ErrUnsupported
+}
@@ -1,15 +1,25 @@
 package processor
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"log/slog"
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/okamyuji/go-image-processor/config"
 )
 
 func setupTestDir(t *testing.T) string {
@@ -239,6 +249,137 @@ func TestConcatenateImagesVertically(t *testing.T) {
 	}
 }
 
+func TestConcatenateImagesConcurrently(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// Solid images of different colors and sizes, so each strip can be told
+	// apart in the result
+	var paths []string
+	var readers []io.Reader
+	for i := 0; i < 12; i++ {
+		img := image.NewRGBA(image.Rect(0, 0, 40+i*10, 30+(i%3)*15))
+		draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{uint8(i * 20), 255 - uint8(i*20), 128, 255}}, image.Point{}, draw.Src)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatalf("Failed to encode test image: %v", err)
+		}
+		path := filepath.Join(testDir, fmt.Sprintf("test_concat_%d.png", i))
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("Failed to write test image: %v", err)
+		}
+		paths = append(paths, path)
+		readers = append(readers, bytes.NewReader(buf.Bytes()))
+	}
+
+	var out bytes.Buffer
+	if err := ConcatenateImagesVerticallyReader(readers, &out); err != nil {
+		t.Fatalf("Failed to concatenate images: %v", err)
+	}
+	sources, err := Default().fileSources(paths)
+	if err != nil {
+		t.Fatalf("Failed to read sources: %v", err)
+	}
+	concatenated, err := concatenate(sources, true, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to concatenate images: %v", err)
+	}
+	for i, r := range concatLayout(sources, true) {
+		center := image.Pt((r.Min.X+r.Max.X)/2, (r.Min.Y+r.Max.Y)/2)
+		want := color.RGBA{uint8(i * 20), 255 - uint8(i*20), 128, 255}
+		if got := concatenated.RGBAAt(center.X, center.Y); got != want {
+			t.Errorf("Strip %d: expected %v, got %v", i, want, got)
+		}
+	}
+	decoded, _, err := image.Decode(&out)
+	if err != nil {
+		t.Fatalf("Failed to decode output: %v", err)
+	}
+	if decoded.Bounds() != concatenated.Bounds() {
+		t.Errorf("Expected the reader variant to give %v, got %v", concatenated.Bounds(), decoded.Bounds())
+	}
+
+	// A missing input fails the whole concatenation
+	missing := filepath.Join(testDir, "missing.png")
+	err = ConcatenateImagesHorizontally(append(paths, missing), filepath.Join(testDir, "out.jpg"))
+	var inputErr *ErrInvalidInput
+	if !errors.As(err, &inputErr) || inputErr.Path != missing {
+		t.Errorf("Expected an invalid input error for %s, got %v", missing, err)
+	}
+}
+
+func TestConcatenateImagesVerticallyStream(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	var paths []string
+	for i := 0; i < 12; i++ {
+		img := image.NewRGBA(image.Rect(0, 0, 40+i*10, 30+(i%3)*15))
+		for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+				img.SetRGBA(x, y, color.RGBA{uint8(i * 20), uint8(x * 4), uint8(y * 4), 255})
+			}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatalf("Failed to encode test image: %v", err)
+		}
+		path := filepath.Join(testDir, fmt.Sprintf("test_stream_%d.png", i))
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("Failed to write test image: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	var calls [][2]int
+	outputPath := filepath.Join(testDir, "stream.png")
+	if err := ConcatenateImagesVerticallyStream(paths, outputPath, WithProgress(progressRecorder(&calls))); err != nil {
+		t.Fatalf("Failed to stream the concatenation: %v", err)
+	}
+	checkProgress(t, "stream", calls)
+	streamed, err := loadImage(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to load the output: %v", err)
+	}
+
+	// The streamed PNG has the pixels of the canvas drawn by concatenate
+	sources, err := Default().fileSources(paths)
+	if err != nil {
+		t.Fatalf("Failed to read sources: %v", err)
+	}
+	concatenated, err := concatenate(sources, true, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to concatenate images: %v", err)
+	}
+	if streamed.Bounds() != concatenated.Bounds() {
+		t.Fatalf("Expected %v, got %v", concatenated.Bounds(), streamed.Bounds())
+	}
+	if got := toRGBA(streamed); !bytes.Equal(got.Pix, concatenated.Pix) {
+		t.Error("Expected the streamed output to match the concatenated canvas")
+	}
+
+	// An input that fails to decode after its header leaves no output
+	// behind. The file is complete, so it is not decoded as a truncated one.
+	data, err := os.ReadFile(paths[5])
+	if err != nil {
+		t.Fatalf("Failed to read test image: %v", err)
+	}
+	data[50] ^= 0xff
+	corrupt := filepath.Join(testDir, "corrupt.png")
+	if err := os.WriteFile(corrupt, data, 0o644); err != nil {
+		t.Fatalf("Failed to write test image: %v", err)
+	}
+	failedPath := filepath.Join(testDir, "failed.png")
+	err = ConcatenateImagesVerticallyStream(append(paths, corrupt), failedPath)
+	var procErr *ErrProcessing
+	if !errors.As(err, &procErr) {
+		t.Errorf("Expected a processing error, got %v", err)
+	}
+	if _, err := os.Stat(failedPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no output after a failure, got %v", err)
+	}
+}
+
 func TestAutoRotateImage(t *testing.T) {
 	testDir := setupTestDir(t)
 	defer os.RemoveAll(testDir)
@@ -295,7 +436,7 @@ func generateSkewedTestImage(outputPath string, width, height int, angleInDegree
 	}
 
 	// Apply rotation
-	rotated := rotateImage(img, angleInDegrees)
+	rotated := Rotate(img, angleInDegrees)
 
 	// Save to file
 	out, err := os.Create(outputPath)
@@ -313,7 +454,7 @@ func TestGenerateSkewTestImage(t *testing.T) {
 
 	// Generate skewed test image
 	testPath := filepath.Join(testDir, "skew_test.jpg")
-	err := generateSkewTestImage(testPath, 200, 200, 15.0)
+	err := Default().generateSkewTestImage(testPath, 200, 200, 15.0)
 	if err != nil {
 		t.Fatalf("Failed to generate skew test image: %v", err)
 	}
@@ -362,3 +503,211 @@ func TestGenerateTestImage(t *testing.T) {
 		}
 	}
 }
+
+func TestDetectSkewAngle(t *testing.T) {
+	for _, angle := range []float64{5.0, 15.0, -10.0} {
+		img := image.NewRGBA(image.Rect(0, 0, 200, 200))
+		draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+		for y := 50; y < 200; y += 50 {
+			for x := 0; x < 200; x++ {
+				img.Set(x, y, color.Black)
+			}
+		}
+
+		detected, confidence, err := detectSkewAngle(context.Background(), detectEdges(Rotate(img, angle)))
+		if err != nil {
+			t.Fatalf("Failed to detect skew: %v", err)
+		}
+		if math.Abs(detected-angle) > 1.5 {
+			t.Errorf("Expected skew of about %v degrees, got %v", angle, detected)
+		}
+		if confidence <= 0 || confidence > 1 {
+			t.Errorf("Expected confidence in (0, 1], got %v", confidence)
+		}
+	}
+}
+
+func TestAutoRotateImageWithOptions(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_skew.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_auto_rotate.jpg")
+
+	if err := generateSkewedTestImage(testInputPath, 100, 100, 15.0); err != nil {
+		t.Fatalf("Failed to generate skewed test image: %v", err)
+	}
+
+	result, err := AutoRotateImageWithOptions(testInputPath, testOutputPath, AutoRotateOptions{MaxAngle: 5})
+	if err != nil {
+		t.Fatalf("Failed to auto-rotate image: %v", err)
+	}
+	if result.Rotated {
+		t.Errorf("Expected rotation of %v degrees to be skipped by the 5 degree limit", result.Angle)
+	}
+
+	result, err = AutoRotateImageWithOptions(testInputPath, testOutputPath, AutoRotateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to auto-rotate image: %v", err)
+	}
+	if !result.Rotated || math.Abs(result.Angle-15) > 2 {
+		t.Errorf("Expected a rotation of about 15 degrees, got %+v", result)
+	}
+}
+
+func TestAutoRotateImageContext(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_skew.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_auto_rotate_cancelled.jpg")
+
+	if err := generateSkewedTestImage(testInputPath, 100, 100, 15.0); err != nil {
+		t.Fatalf("Failed to generate skewed test image: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, method := range []string{SkewMethodHough, SkewMethodProjection} {
+		_, err := AutoRotateImageContext(ctx, testInputPath, testOutputPath, AutoRotateOptions{Method: method})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected %s detection to be cancelled, got %v", method, err)
+		}
+	}
+	if _, err := DenoiseImageContext(ctx, testInputPath, testOutputPath, DenoiseOptions{Separate: true, LumaRadius: 1, ChromaRadius: 2}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected denoising to be cancelled, got %v", err)
+	}
+	if err := RotateImageContext(ctx, testInputPath, testOutputPath, 30); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected rotation to be cancelled, got %v", err)
+	}
+	for _, opts := range [][]Option{nil, {WithTiled()}} {
+		if err := BinarizeImageContext(ctx, testInputPath, testOutputPath, opts...); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected binarization to be cancelled, got %v", err)
+		}
+		if err := DetectEdgesContext(ctx, testInputPath, testOutputPath, opts...); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected edge detection to be cancelled, got %v", err)
+		}
+	}
+	for _, tiled := range []bool{false, true} {
+		if _, err := ResizeImageContext(ctx, testInputPath, testOutputPath, ResizeOptions{Width: 50, Tiled: tiled}); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected resizing to be cancelled, got %v", err)
+		}
+	}
+	inputs := []string{testInputPath, testInputPath}
+	if err := ConcatenateImagesVerticallyContext(ctx, inputs, testOutputPath); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected vertical concatenation to be cancelled, got %v", err)
+	}
+	if err := ConcatenateImagesHorizontallyContext(ctx, inputs, testOutputPath); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected horizontal concatenation to be cancelled, got %v", err)
+	}
+	if err := TransformContext(ctx, testInputPath, testOutputPath, RotateOp(30)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the transform to be cancelled, got %v", err)
+	}
+	if _, err := os.Stat(testOutputPath); !os.IsNotExist(err) {
+		t.Error("Expected no output from a cancelled operation")
+	}
+}
+
+func TestImageFunctionsChain(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 100; x < 200; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+
+	resized, err := Resize(img, 100, 0)
+	if err != nil {
+		t.Fatalf("Failed to resize: %v", err)
+	}
+	if b := resized.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("Expected 100x50, got %v", b)
+	}
+	rotated := Rotate(resized, 90)
+	if b := rotated.Bounds(); b.Dx() != 50 || b.Dy() != 100 {
+		t.Errorf("Expected 50x100 after rotating, got %v", b)
+	}
+	binarized := Binarize(rotated)
+	for _, v := range toGray(binarized).Pix {
+		if v != 0 && v != 255 {
+			t.Fatalf("Expected only black and white, got %d", v)
+		}
+	}
+
+	if _, err := Resize(img, 0, 0); err == nil {
+		t.Error("Expected an error without a size")
+	}
+	if _, _, err := MultiOtsu(img, 1); err == nil {
+		t.Error("Expected an error for a single level")
+	}
+}
+
+func TestNew(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	inputPath := filepath.Join(testDir, "test_input_new.jpg")
+	if err := generateSingleTestImage(inputPath, 120, 80); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	// Each Processor logs to its own logger and saves with its own quality
+	sizes := map[int]int64{}
+	for _, quality := range []int{10, 95} {
+		var logs bytes.Buffer
+		p := New(&config.Config{JpegQuality: quality}, slog.New(slog.NewTextHandler(&logs, nil)))
+		outputPath := filepath.Join(testDir, fmt.Sprintf("test_output_new_%d.jpg", quality))
+		if err := p.ResizeImage(inputPath, outputPath, 60, 40); err != nil {
+			t.Fatalf("Failed to resize: %v", err)
+		}
+		if !strings.Contains(logs.String(), "resizing image") {
+			t.Errorf("Expected the operation to log to the Processor's logger, got %q", logs.String())
+		}
+		info, err := os.Stat(outputPath)
+		if err != nil {
+			t.Fatalf("Failed to stat output: %v", err)
+		}
+		sizes[quality] = info.Size()
+	}
+	if sizes[10] >= sizes[95] {
+		t.Errorf("Expected quality 10 to be smaller than quality 95, got %v", sizes)
+	}
+
+	// Without a configuration the defaults apply, without reading config.yaml
+	if got := New(nil, nil).Config().JpegQuality; got != config.Default().JpegQuality {
+		t.Errorf("Expected the default quality, got %d", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// A missing input is told from other failures
+	missing := filepath.Join(testDir, "missing.jpg")
+	err := ResizeImage(missing, filepath.Join(testDir, "out.jpg"), 10, 10)
+	var inputErr *ErrInvalidInput
+	if !errors.As(err, &inputErr) || inputErr.Path != missing {
+		t.Fatalf("Expected an invalid input error for %s, got %v", missing, err)
+	}
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrPermission) {
+		t.Errorf("Expected the error to match ErrNotFound only, got %v", err)
+	}
+	if !strings.Contains(err.Error(), missing) || errors.Unwrap(err) == nil {
+		t.Errorf("Expected the error to name the file and wrap the cause, got %v", err)
+	}
+
+	// The cause is kept through wrapping
+	wrapped := &ErrProcessing{Op: "batch", Err: &ErrInvalidOutput{Path: "out", Err: fs.ErrPermission}}
+	if !errors.Is(wrapped, ErrPermission) {
+		t.Errorf("Expected a wrapped permission error to match ErrPermission")
+	}
+	if !errors.Is(fmt.Errorf("converting: %w", &ErrUnsupportedFormat{Format: ".xyz"}), ErrUnsupported) {
+		t.Errorf("Expected an unsupported format to match ErrUnsupported")
+	}
+
+	// Without a cause the message is unchanged
+	if got := (&ErrInvalidInput{Path: "a.jpg"}).Error(); got != "invalid input file: a.jpg" {
+		t.Errorf("Unexpected message %q", got)
+	}
+}
@@ -0,0 +1,66 @@
+package processor
+
+import "context"
+
+// ProgressFunc receives the progress of a long operation: done units of work,
+// such as rows of pixels or images, out of total. It is called about once per
+// percent and once more when the work is complete, never concurrently, from
+// the goroutine running the operation, so it should return quickly:
+//
+//	err := processor.RotateImageWith("in.jpg", "out.jpg", 12, processor.WithProgress(func(done, total int) {
+//		fmt.Printf("\r%3d%%", done*100/total)
+//	}))
+//
+// Operations with several passes, such as AutoRotate, report each pass in
+// turn with the total of the pass times the number of passes, so done/total
+// grows steadily from 0 to 1 while total may change between passes.
+type ProgressFunc func(done, total int)
+
+// WithProgress sets a function receiving the progress of the operation.
+// Rotation, denoising and concatenation report it.
+func WithProgress(fn ProgressFunc) Option {
+	return func(s *settings) {
+		s.progress = fn
+	}
+}
+
+// report calls fn when done reaches another whole percent of total, so at
+// most about a hundred times however large total is. A nil fn does nothing.
+func (fn ProgressFunc) report(done, total int) {
+	if fn == nil || total <= 0 {
+		return
+	}
+	if done == total || done*100/total != (done-1)*100/total {
+		fn(done, total)
+	}
+}
+
+// phase returns a ProgressFunc reporting the progress of pass i of n equal
+// passes of an operation to fn. A nil fn gives nil.
+func (fn ProgressFunc) phase(i, n int) ProgressFunc {
+	if fn == nil {
+		return nil
+	}
+	return func(done, total int) {
+		fn(i*total+done, n*total)
+	}
+}
+
+// progressKey is the context key of the ProgressFunc of an operation. The
+// passes of the operations already take its context for cancellation, so the
+// ProgressFunc travels with it rather than through every signature.
+type progressKey struct{}
+
+// withProgress returns a context carrying fn to the passes of an operation
+func withProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	if fn == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// progressFrom returns the ProgressFunc carried by ctx, or nil
+func progressFrom(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return fn
+}
@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// progressRecorder returns a ProgressFunc recording its calls
+func progressRecorder(calls *[][2]int) ProgressFunc {
+	return func(done, total int) {
+		*calls = append(*calls, [2]int{done, total})
+	}
+}
+
+// checkProgress checks that the fraction done never decreases and ends at 1
+func checkProgress(t *testing.T, name string, calls [][2]int) {
+	t.Helper()
+	if len(calls) == 0 {
+		t.Fatalf("%s: expected progress to be reported", name)
+	}
+	last := 0.0
+	for _, c := range calls {
+		fraction := float64(c[0]) / float64(c[1])
+		if fraction < last || fraction > 1 {
+			t.Fatalf("%s: expected a growing fraction, got %v", name, calls)
+		}
+		last = fraction
+	}
+	if end := calls[len(calls)-1]; end[0] != end[1] {
+		t.Errorf("%s: expected progress to end complete, got %v", name, end)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	inputPath := filepath.Join(testDir, "test_input_progress.jpg")
+	if err := generateSingleTestImage(inputPath, 300, 200); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	outputPath := filepath.Join(testDir, "test_output_progress.jpg")
+
+	var calls [][2]int
+	if err := RotateImageWith(inputPath, outputPath, 10, WithProgress(progressRecorder(&calls))); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	checkProgress(t, "rotate", calls)
+	if len(calls) > 110 {
+		t.Errorf("Expected about one call per percent, got %d", len(calls))
+	}
+
+	calls = nil
+	if _, err := AutoRotateImageWithOptions(inputPath, outputPath, AutoRotateOptions{Progress: progressRecorder(&calls)}); err != nil {
+		t.Fatalf("Failed to auto-rotate: %v", err)
+	}
+	checkProgress(t, "autorotate", calls)
+
+	calls = nil
+	if err := DenoiseImageWith(inputPath, outputPath, WithProgress(progressRecorder(&calls))); err != nil {
+		t.Fatalf("Failed to denoise: %v", err)
+	}
+	checkProgress(t, "denoise", calls)
+
+	calls = nil
+	if err := ConcatenateImagesVerticallyWith([]string{inputPath, inputPath, inputPath}, outputPath, WithProgress(progressRecorder(&calls))); err != nil {
+		t.Fatalf("Failed to concatenate: %v", err)
+	}
+	checkProgress(t, "concatenate", calls)
+	if end := calls[len(calls)-1]; end[1] != 3 {
+		t.Errorf("Expected the progress of 3 images, got %v", end)
+	}
+}
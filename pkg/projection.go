@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"context"
+	"image"
+	"math"
+	"sort"
+)
+
+// Skew detection methods accepted by AutoRotateOptions.Method
+const (
+	SkewMethodHough      = "hough"
+	SkewMethodProjection = "projection"
+)
+
+// projectionMaxPoints caps the number of ink pixels sampled by the projection-profile estimator
+const projectionMaxPoints = 200000
+
+// detectSkewProjection estimates the skew of a text page by rotating the ink's
+// row histogram over candidate angles and keeping the angle whose histogram has
+// the highest variance, i.e. where text lines and gaps separate most sharply.
+// Returns the angle in degrees, in the range [-45, 45], and a confidence between 0 and 1,
+// or ctx's error when ctx is cancelled.
+func detectSkewProjection(ctx context.Context, img image.Image) (float64, float64, error) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	mask := otsuInkMask(toGray(img))
+
+	var xs, ys []float64
+	inkCount := 0
+	for _, ink := range mask {
+		if ink {
+			inkCount++
+		}
+	}
+	if inkCount == 0 {
+		return 0, 0, nil
+	}
+	stride := inkCount/projectionMaxPoints + 1
+	k := 0
+	for i, ink := range mask {
+		if !ink {
+			continue
+		}
+		if k%stride == 0 {
+			xs = append(xs, float64(i%w)-float64(w)/2)
+			ys = append(ys, float64(i/w)-float64(h)/2)
+		}
+		k++
+	}
+
+	diagonal := int(math.Hypot(float64(w), float64(h))) + 2
+	bins := make([]float64, diagonal)
+	score := func(angle float64) float64 {
+		for i := range bins {
+			bins[i] = 0
+		}
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		for i := range xs {
+			// Row of the point once the page is rotated back by angle
+			row := int(-xs[i]*sin+ys[i]*cos) + diagonal/2
+			if row >= 0 && row < diagonal {
+				bins[row]++
+			}
+		}
+		var sum float64
+		for _, v := range bins {
+			sum += v * v
+		}
+		return sum
+	}
+
+	// Coarse search in whole degrees, then refine around the best candidate
+	var coarse []float64
+	bestAngle, bestScore := 0.0, -1.0
+	progress := progressFrom(ctx)
+	for angle := -45.0; angle <= 45; angle++ {
+		if err := ctx.Err(); err != nil {
+			return 0, 0, err
+		}
+		s := score(angle)
+		coarse = append(coarse, s)
+		if s > bestScore {
+			bestAngle, bestScore = angle, s
+		}
+		progress.report(len(coarse), 91)
+	}
+	center := bestAngle
+	for angle := center - 1; angle <= center+1; angle += 0.1 {
+		if s := score(angle); s > bestScore {
+			bestAngle, bestScore = angle, s
+		}
+	}
+
+	// Confidence measures how far the best candidate rises above a typical one
+	sort.Float64s(coarse)
+	median := coarse[len(coarse)/2]
+	confidence := 0.0
+	if bestScore > 0 {
+		confidence = (bestScore - median) / bestScore
+	}
+	return math.Round(bestAngle*10) / 10, confidence, nil
+}
@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// generateTextPage draws a page of short "text" dashes arranged in lines
+func generateTextPage() *image.RGBA {
+	page := image.NewRGBA(image.Rect(0, 0, 240, 240))
+	draw.Draw(page, page.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	for y := 30; y < 210; y += 16 {
+		for x := 30; x < 210; x++ {
+			if (x/9)%3 != 2 {
+				for dy := 0; dy < 5; dy++ {
+					page.Set(x, y+dy, color.Black)
+				}
+			}
+		}
+	}
+	return page
+}
+
+func TestDetectSkewProjection(t *testing.T) {
+	page := generateTextPage()
+	for _, angle := range []float64{0, 3.5, -8} {
+		detected, confidence, err := detectSkewProjection(context.Background(), Rotate(page, angle))
+		if err != nil {
+			t.Fatalf("Failed to detect skew: %v", err)
+		}
+		if math.Abs(detected-angle) > 0.5 {
+			t.Errorf("Expected skew of about %v degrees, got %v", angle, detected)
+		}
+		if confidence <= 0 {
+			t.Errorf("Expected positive confidence for a %v degree page, got %v", angle, confidence)
+		}
+	}
+}
+
+func TestAutoRotateImageProjectionMethod(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_skew.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_auto_rotate.jpg")
+	if err := saveJPEG(testInputPath, Rotate(generateTextPage(), 10.0)); err != nil {
+		t.Fatalf("Failed to generate skewed test image: %v", err)
+	}
+
+	result, err := AutoRotateImageWithOptions(testInputPath, testOutputPath, AutoRotateOptions{Method: SkewMethodProjection})
+	if err != nil {
+		t.Fatalf("Failed to auto-rotate image: %v", err)
+	}
+	if math.Abs(result.Angle-10) > 1 {
+		t.Errorf("Expected a skew of about 10 degrees, got %v", result.Angle)
+	}
+
+	if _, err := AutoRotateImageWithOptions(testInputPath, testOutputPath, AutoRotateOptions{Method: "unknown"}); err == nil {
+		t.Error("Expected an error for an unknown method")
+	}
+}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"context"
+	"errors"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaQueue is a Kafka topic consumed by a consumer group. Offsets are
+// committed as requests finish, so requests a dead worker had not finished are
+// delivered again to another member of the group. With several requests in
+// parallel a commit also covers earlier requests still in progress; run one
+// request per process where every request must survive a crash.
+type kafkaQueue struct {
+	reader *kafka.Reader
+	writer *kafka.Writer
+}
+
+// newKafkaQueue joins the consumer group of a topic
+func newKafkaQueue(brokers []string, topic, results, group string) *kafkaQueue {
+	q := &kafkaQueue{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			Topic:   topic,
+			GroupID: group,
+		}),
+	}
+	if results != "" {
+		q.writer = &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        results,
+			RequiredAcks: kafka.RequireAll,
+		}
+	}
+	return q
+}
+
+// Receive fetches the next request without committing it
+func (q *kafkaQueue) Receive(ctx context.Context) (*Message, error) {
+	msg, err := q.reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Body: msg.Value, Ack: func() error {
+		return q.reader.CommitMessages(context.Background(), msg)
+	}}, nil
+}
+
+// Publish sends a completion event and waits for all replicas to store it
+func (q *kafkaQueue) Publish(ctx context.Context, body []byte) error {
+	if q.writer == nil {
+		return nil
+	}
+	return q.writer.WriteMessages(ctx, kafka.Message{Value: body})
+}
+
+// Close leaves the consumer group and flushes pending events
+func (q *kafkaQueue) Close() error {
+	err := q.reader.Close()
+	if q.writer != nil {
+		err = errors.Join(err, q.writer.Close())
+	}
+	return err
+}
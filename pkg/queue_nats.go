@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsQueue is a NATS subject consumed by a queue group. Core NATS does not
+// redeliver messages, so requests in progress when a worker dies are lost.
+type natsQueue struct {
+	conn    *nats.Conn
+	sub     *nats.Subscription
+	results string
+}
+
+// dialNATS connects to the server of a nats:// URL and joins the queue group
+func dialNATS(u *url.URL, subject, results, group string) (*natsQueue, error) {
+	server := url.URL{Scheme: "nats", Host: u.Host, User: u.User}
+	conn, err := nats.Connect(server.String(), nats.Name("go-image-processor"))
+	if err != nil {
+		return nil, &ErrProcessing{Op: "nats", Err: err}
+	}
+	sub, err := conn.QueueSubscribeSync(subject, group)
+	if err != nil {
+		conn.Close()
+		return nil, &ErrProcessing{Op: "nats", Err: err}
+	}
+	return &natsQueue{conn: conn, sub: sub, results: results}, nil
+}
+
+// Receive waits for the next request
+func (q *natsQueue) Receive(ctx context.Context) (*Message, error) {
+	msg, err := q.sub.NextMsgWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Body: msg.Data, Ack: func() error { return nil }}, nil
+}
+
+// Publish sends a completion event and waits for the server to take it
+func (q *natsQueue) Publish(ctx context.Context, body []byte) error {
+	if q.results == "" {
+		return nil
+	}
+	if err := q.conn.Publish(q.results, body); err != nil {
+		return err
+	}
+	return q.conn.FlushWithContext(ctx)
+}
+
+// Close leaves the queue group, letting the server hand pending requests to
+// other workers, and disconnects
+func (q *natsQueue) Close() error {
+	q.sub.Unsubscribe()
+	return q.conn.Drain()
+}
@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReaderVariantsMatchFiles(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_reader.jpg")
+	if err := generateSingleTestImage(testInputPath, 120, 80); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	input, err := os.ReadFile(testInputPath)
+	if err != nil {
+		t.Fatalf("Failed to read test image: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		ext    string
+		file   func(inputPath, outputPath string) error
+		stream func(r io.Reader, w io.Writer) error
+	}{
+		{
+			name: "resize",
+			file: func(in, out string) error { return ResizeImage(in, out, 60, 40) },
+			stream: func(r io.Reader, w io.Writer) error {
+				return ResizeImageReader(r, w, 60, 40)
+			},
+		},
+		{
+			name:   "rotate",
+			file:   func(in, out string) error { return RotateImage(in, out, 30) },
+			stream: func(r io.Reader, w io.Writer) error { return RotateImageReader(r, w, 30) },
+		},
+		{name: "binarize", file: BinarizeImage, stream: BinarizeImageReader},
+		{name: "edges", file: DetectEdges, stream: DetectEdgesReader},
+		{name: "denoise", file: DenoiseImage, stream: DenoiseImageReader},
+		{name: "skeleton", file: SkeletonizeImage, stream: SkeletonizeImageReader},
+		{name: "trace", ext: ".svg", file: TraceImage, stream: TraceImageReader},
+		{
+			name: "convert",
+			ext:  ".png",
+			file: func(in, out string) error {
+				return ConvertImage(in, out, ConvertOptions{ColorType: ColorTypeGray, Bits: 2})
+			},
+			stream: func(r io.Reader, w io.Writer) error {
+				return ConvertImageReader(r, w, ConvertOptions{ColorType: ColorTypeGray, Bits: 2})
+			},
+		},
+		{
+			name: "halftone",
+			file: func(in, out string) error { return HalftoneImage(in, out, 6, 45) },
+			stream: func(r io.Reader, w io.Writer) error {
+				return HalftoneImageReader(r, w, 6, 45)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ext := tt.ext
+			if ext == "" {
+				ext = ".jpg"
+			}
+			outputPath := filepath.Join(testDir, "test_output_"+tt.name+ext)
+			if err := tt.file(testInputPath, outputPath); err != nil {
+				t.Fatalf("Failed to process file: %v", err)
+			}
+			want, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+
+			var got bytes.Buffer
+			if err := tt.stream(bytes.NewReader(input), &got); err != nil {
+				t.Fatalf("Failed to process stream: %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("Stream output differs from file output (%d and %d bytes)", got.Len(), len(want))
+			}
+		})
+	}
+}
+
+func TestReaderVariantsErrors(t *testing.T) {
+	var out bytes.Buffer
+	if err := ResizeImageReader(bytes.NewReader([]byte("not an image")), &out, 10, 10); err == nil {
+		t.Error("Expected an error for undecodable input")
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected nothing written on error, got %d bytes", out.Len())
+	}
+	if err := ConcatenateImagesVerticallyReader([]io.Reader{bytes.NewReader(nil)}, &out); err == nil {
+		t.Error("Expected an error for empty input")
+	}
+}
@@ -0,0 +1,1119 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Recipe is a parsed processing recipe. A recipe lists the steps to apply to
+// an image, one per line, and can compute values and choose steps from the
+// properties of the image being processed:
+//
+//	# Shrink large photos, clean up documents
+//	let limit = 4000
+//	if width > limit or height > limit then fit limit limit
+//	if format == "png" then
+//	    binarize
+//	else if class == "document" then
+//	    docclean
+//	else
+//	    denoise
+//	end
+//	# Lower the JPEG quality until the file fits
+//	tune q from 95 to 40 by 5 until filesize < 500000 then quality q
+//
+// repeat runs a step on its own result until a condition holds, at most ten
+// times unless a max is given, and nothing at all if the condition already
+// holds. tune tries a step on the current image with each value of a variable
+// in turn and keeps the first result that meets the condition, or the last one.
+//
+// A script block computes variables with Starlark, for logic the expressions
+// cannot express; the numbers, strings and booleans it assigns can be used by
+// the lines that follow:
+//
+//	script
+//	    q = 90 if megapixels < 2 else max(60, int(95 - 3 * megapixels))
+//	end
+//	quality q
+//
+// Conditions can use width, height, megapixels, aspect, format, class, noise
+// (the estimated noise sigma) and filesize (in bytes), which always describe
+// the result of the steps run so far, numbers, strings
+// in double quotes, variables set with let, the arithmetic operators + - * /,
+// the comparisons == != < <= > >= and the keywords and, or and not.
+// Everything after # is a comment.
+type Recipe struct {
+	statements []recipeStatement
+}
+
+// RecipeResult describes what a recipe did to an image
+type RecipeResult struct {
+	// Steps lists the steps that ran, in order, with their arguments
+	Steps []string `json:"steps"`
+}
+
+// recipeBuiltins are the image properties available to recipe expressions
+var recipeBuiltins = map[string]bool{
+	"width":      true,
+	"height":     true,
+	"megapixels": true,
+	"aspect":     true,
+	"format":     true,
+	"class":      true,
+	"noise":      true,
+	"filesize":   true,
+}
+
+const (
+	// recipeRepeatLimit is how often repeat runs a step when no max is given
+	recipeRepeatLimit = 10
+	// recipeRepeatMax bounds the max a repeat may be given
+	recipeRepeatMax = 1000
+	// recipeTuneLimit bounds the number of values tune tries
+	recipeTuneLimit = 1000
+)
+
+// recipeStep is an operation a recipe can run, with the number of arguments
+// it accepts, maxArgs -1 meaning any number, and whether they are strings
+// rather than numbers
+type recipeStep struct {
+	minArgs, maxArgs int
+	text             bool
+	run              func(ctx context.Context, inputPath, outputPath string, args []recipeValue) error
+}
+
+// lookupStep returns the step a recipe runs for name: a built-in step, or an
+// operation registered with Register
+func lookupStep(name string) (recipeStep, bool) {
+	if step, ok := recipeSteps[name]; ok {
+		return step, true
+	}
+	return registeredStep(name)
+}
+
+// recipeSteps are the operations available to recipes
+var recipeSteps = map[string]recipeStep{
+	"resize": {2, 2, false, func(ctx context.Context, in, out string, args []recipeValue) error {
+		_, err := ResizeImageContext(ctx, in, out, ResizeOptions{Width: uint(args[0].num), Height: uint(args[1].num)})
+		return err
+	}},
+	"fit": {2, 2, false, func(ctx context.Context, in, out string, args []recipeValue) error {
+		_, err := ResizeImageContext(ctx, in, out, ResizeOptions{Width: uint(args[0].num), Height: uint(args[1].num), NoUpscale: true})
+		return err
+	}},
+	"scale": {1, 1, false, func(ctx context.Context, in, out string, args []recipeValue) error {
+		_, err := ResizeImageContext(ctx, in, out, ResizeOptions{Scale: args[0].num})
+		return err
+	}},
+	"rotate": {1, 1, false, func(ctx context.Context, in, out string, args []recipeValue) error {
+		return RotateImageContext(ctx, in, out, args[0].num)
+	}},
+	"autorotate": {0, 0, false, func(ctx context.Context, in, out string, args []recipeValue) error {
+		_, err := AutoRotateImageContext(ctx, in, out, AutoRotateOptions{})
+		return err
+	}},
+	"denoise": {0, 1, false, func(ctx context.Context, in, out string, args []recipeValue) error {
+		opts := DenoiseOptions{Radius: 1}
+		if len(args) > 0 {
+			opts.Radius = int(args[0].num)
+		}
+		_, err := DenoiseImageContext(ctx, in, out, opts)
+		return err
+	}},
+	"binarize": {0, 0, false, func(ctx context.Context, in, out string, args []recipeValue) error {
+		return BinarizeImageContext(ctx, in, out)
+	}},
+	"edges": {0, 0, false, func(ctx context.Context, in, out string, args []recipeValue) error {
+		return DetectEdgesContext(ctx, in, out)
+	}},
+	"skeleton": {0, 0, false, func(ctx context.Context, in, out string, args []recipeValue) error {
+		return SkeletonizeImage(in, out)
+	}},
+	"deblock": {0, 1, false, func(ctx context.Context, in, out string, args []recipeValue) error {
+		strength := 2
+		if len(args) > 0 {
+			strength = int(args[0].num)
+		}
+		return DeblockImage(in, out, strength)
+	}},
+	"docclean": {0, 1, true, func(ctx context.Context, in, out string, args []recipeValue) error {
+		preset := DocCleanDocument
+		if len(args) > 0 {
+			preset = args[0].String()
+		}
+		return DocCleanImage(in, out, preset)
+	}},
+	"blurfaces": {0, 0, false, func(ctx context.Context, in, out string, args []recipeValue) error {
+		_, err := BlurFacesImage(in, out)
+		return err
+	}},
+	"quality": {1, 1, false, func(ctx context.Context, in, out string, args []recipeValue) error {
+		img, err := loadImage(in)
+		if err != nil {
+			return err
+		}
+		return saveJPEGQuality(out, img, int(args[0].num))
+	}},
+	"convert": {1, 2, true, func(ctx context.Context, in, out string, args []recipeValue) error {
+		opts := ConvertOptions{ColorType: args[0].String()}
+		if len(args) > 1 {
+			opts.Bits = int(args[1].num)
+		}
+		return ConvertImage(in, out, opts)
+	}},
+	"wasm": {1, 9, true, func(ctx context.Context, in, out string, args []recipeValue) error {
+		opts := WasmOptions{Module: args[0].String()}
+		for _, a := range args[1:] {
+			if a.isStr {
+				return fmt.Errorf("wasm parameters must be numbers, got %q", a.str)
+			}
+			opts.Params = append(opts.Params, a.num)
+		}
+		return WasmFilterImage(in, out, opts)
+	}},
+}
+
+// ParseRecipe parses the text of a recipe.
+// It takes the recipe source.
+// Returns the recipe, or an error naming the line that could not be parsed.
+func ParseRecipe(source string) (*Recipe, error) {
+	p := &recipeParser{lines: strings.Split(source, "\n")}
+	statements, terminator, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if terminator != "" {
+		return nil, fmt.Errorf("recipe line %d: %q without if", p.pos, terminator)
+	}
+	return &Recipe{statements: statements}, nil
+}
+
+// RecipeOptions controls RunWithOptions
+type RecipeOptions struct {
+	// MaxQuality caps the JPEG quality of quality steps; zero leaves it alone
+	MaxQuality int
+	// Progress, when set, receives the progress of each rotate, autorotate
+	// and denoise step in turn, from 0 to its total
+	Progress ProgressFunc
+}
+
+// Operations returns the names of the steps the recipe can run, in order of
+// first appearance, including those in branches that may not be taken
+func (r *Recipe) Operations() []string {
+	var names []string
+	var walk func(statements []recipeStatement)
+	walk = func(statements []recipeStatement) {
+		for _, s := range statements {
+			if s.kind == recipeRun && !slices.Contains(names, s.name) {
+				names = append(names, s.name)
+			}
+			walk(s.then)
+			walk(s.otherwise)
+		}
+	}
+	walk(r.statements)
+	return names
+}
+
+// Run applies the recipe to the input and writes the result to the output.
+// Intermediate results are written to a temporary directory; when no step
+// runs, the input is copied unchanged.
+// It takes the paths of the input and output files.
+// Returns the steps that ran, or an error if a step or expression fails.
+func (r *Recipe) Run(inputPath string, outputPath string) (*RecipeResult, error) {
+	return r.RunWithOptions(inputPath, outputPath, RecipeOptions{})
+}
+
+// RunWithOptions is Run with limits on what the steps may do
+func (r *Recipe) RunWithOptions(inputPath string, outputPath string, opts RecipeOptions) (*RecipeResult, error) {
+	return r.RunContext(context.Background(), inputPath, outputPath, opts)
+}
+
+// RunContext is RunWithOptions stopping with ctx's error when ctx is
+// cancelled: before each step, and within the rows of the slow steps
+// (autorotate, rotate and denoise). The output is not written then.
+func (r *Recipe) RunContext(ctx context.Context, inputPath string, outputPath string, opts RecipeOptions) (*RecipeResult, error) {
+	slog.Info("running recipe", "input", inputPath)
+
+	dir := currentConfig().TempDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	workDir, err := os.MkdirTemp(dir, "recipe-*")
+	if err != nil {
+		return nil, &ErrProcessing{Op: "recipe", Err: err}
+	}
+	defer os.RemoveAll(workDir)
+
+	env := &recipeEnv{
+		ctx:        withProgress(ctx, opts.Progress),
+		path:       inputPath,
+		workDir:    workDir,
+		vars:       map[string]recipeValue{},
+		props:      map[string]recipeValue{},
+		maxQuality: opts.MaxQuality,
+	}
+	result := &RecipeResult{Steps: []string{}}
+	if err := env.run(r.statements, result); err != nil {
+		return nil, err
+	}
+	if err := copyFile(env.path, outputPath); err != nil {
+		return nil, err
+	}
+	slog.Info("recipe finished", "steps", len(result.Steps))
+	return result, nil
+}
+
+// Statement kinds
+const (
+	recipeLet = iota
+	recipeIf
+	recipeRun
+	recipeRepeat
+	recipeTune
+	recipeScript
+)
+
+// recipeStatement is a let, an if, a step, a repeat, a tune or a script
+type recipeStatement struct {
+	kind int
+	line int
+	// name is the variable of a let or a tune, the operation of a step or
+	// the source of a script
+	name string
+	// expr is the value of a let or the condition of an if, a repeat or a tune
+	expr recipeExpr
+	// then and otherwise are the branches of an if; then holds the step of
+	// a repeat or a tune
+	then, otherwise []recipeStatement
+	// args are the arguments of a step
+	args []recipeExpr
+	// from, to and by are the range of a tune; to is the max of a repeat
+	from, to, by recipeExpr
+}
+
+// recipeEnv is the state of a running recipe
+type recipeEnv struct {
+	// ctx cancels the recipe between and within steps
+	ctx context.Context
+	// path is the current image: the input, or the output of the last step
+	path    string
+	workDir string
+	vars    map[string]recipeValue
+	// props caches the built-in properties of the current image
+	props map[string]recipeValue
+	// outputs counts the files written to workDir
+	outputs int
+	// maxQuality caps quality steps when positive
+	maxQuality int
+}
+
+func (e *recipeEnv) run(statements []recipeStatement, result *RecipeResult) error {
+	for _, s := range statements {
+		switch s.kind {
+		case recipeLet:
+			v, err := s.expr.eval(e)
+			if err != nil {
+				return recipeError(s.line, err)
+			}
+			e.vars[s.name] = v
+		case recipeIf:
+			v, err := s.expr.eval(e)
+			if err != nil {
+				return recipeError(s.line, err)
+			}
+			branch := s.otherwise
+			if v.truth() {
+				branch = s.then
+			}
+			if err := e.run(branch, result); err != nil {
+				return err
+			}
+		case recipeRun:
+			output, step, err := e.apply(s)
+			if err != nil {
+				return err
+			}
+			e.advance(output)
+			result.Steps = append(result.Steps, step)
+		case recipeRepeat:
+			if err := e.repeat(s, result); err != nil {
+				return err
+			}
+		case recipeTune:
+			if err := e.tune(s, result); err != nil {
+				return err
+			}
+		case recipeScript:
+			if err := e.script(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// apply runs a step on the current image and returns the path of its output
+// and the step as text, without making the output current
+func (e *recipeEnv) apply(s recipeStatement) (string, string, error) {
+	args := make([]recipeValue, len(s.args))
+	words := []string{s.name}
+	for i, a := range s.args {
+		v, err := a.eval(e)
+		if err != nil {
+			return "", "", recipeError(s.line, err)
+		}
+		if step, _ := lookupStep(s.name); v.isStr && !step.text {
+			return "", "", recipeError(s.line, fmt.Errorf("%s needs numbers, got %q", s.name, v.str))
+		}
+		args[i] = v
+		words = append(words, v.String())
+	}
+	if s.name == "quality" && e.maxQuality > 0 && args[0].num > float64(e.maxQuality) {
+		args[0].num = float64(e.maxQuality)
+		words[1] = args[0].String()
+	}
+	if err := e.ctx.Err(); err != nil {
+		return "", "", err
+	}
+	e.outputs++
+	output := filepath.Join(e.workDir, "step-"+strconv.Itoa(e.outputs))
+	step := strings.Join(words, " ")
+	slog.Info("running recipe step", "line", s.line, "step", step)
+	op, _ := lookupStep(s.name)
+	if err := op.run(e.ctx, e.path, output, args); err != nil {
+		return "", "", err
+	}
+	return output, step, nil
+}
+
+// advance makes path the current image
+func (e *recipeEnv) advance(path string) {
+	e.path = path
+	clear(e.props)
+}
+
+// condition evaluates the condition of a statement
+func (e *recipeEnv) condition(s recipeStatement) (bool, error) {
+	v, err := s.expr.eval(e)
+	if err != nil {
+		return false, recipeError(s.line, err)
+	}
+	return v.truth(), nil
+}
+
+func (e *recipeEnv) repeat(s recipeStatement, result *RecipeResult) error {
+	limit := recipeRepeatLimit
+	if s.to != nil {
+		v, err := s.to.eval(e)
+		if err != nil || v.isStr || !(v.num >= 0) || v.num > recipeRepeatMax {
+			return recipeError(s.line, fmt.Errorf("max must be a number from 0 to %d", recipeRepeatMax))
+		}
+		limit = int(v.num)
+	}
+	for i := 0; ; i++ {
+		done, err := e.condition(s)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		if i == limit {
+			slog.Warn("repeat stopped before its condition held", "line", s.line, "runs", limit)
+			return nil
+		}
+		output, step, err := e.apply(s.then[0])
+		if err != nil {
+			return err
+		}
+		e.advance(output)
+		result.Steps = append(result.Steps, step)
+	}
+}
+
+func (e *recipeEnv) tune(s recipeStatement, result *RecipeResult) error {
+	var bounds [3]float64
+	for i, x := range []recipeExpr{s.from, s.to, s.by} {
+		if x == nil {
+			bounds[i] = 1
+			continue
+		}
+		v, err := x.eval(e)
+		if err != nil {
+			return recipeError(s.line, err)
+		}
+		if v.isStr {
+			return recipeError(s.line, fmt.Errorf("tune needs numbers, got %q", v.str))
+		}
+		if math.IsNaN(v.num) || math.IsInf(v.num, 0) {
+			return recipeError(s.line, fmt.Errorf("tune needs finite numbers, got %g", v.num))
+		}
+		bounds[i] = v.num
+	}
+	from, to, by := bounds[0], bounds[1], math.Abs(bounds[2])
+	if by == 0 || math.Abs(to-from)/by > recipeTuneLimit {
+		return recipeError(s.line, fmt.Errorf("tune would try more than %d values", recipeTuneLimit))
+	}
+	if to < from {
+		by = -by
+	}
+
+	// The count also ends the loop when the step is lost in the precision
+	// of large values
+	start := e.path
+	for i, v := 0, from; ; i, v = i+1, v+by {
+		last := i == recipeTuneLimit || (by > 0 && v+by > to) || (by < 0 && v+by < to)
+		e.vars[s.name] = recipeValue{num: v}
+		output, step, err := e.apply(s.then[0])
+		if err != nil {
+			return err
+		}
+		e.advance(output)
+		done, err := e.condition(s)
+		if err != nil {
+			return err
+		}
+		if done || last {
+			if !done {
+				slog.Warn("no value met the tune condition, keeping the last", "line", s.line, s.name, v)
+			}
+			result.Steps = append(result.Steps, step)
+			return nil
+		}
+		e.advance(start)
+	}
+}
+
+// lookup returns the value of a variable or built-in property
+func (e *recipeEnv) lookup(name string) (recipeValue, error) {
+	if v, ok := e.vars[name]; ok {
+		return v, nil
+	}
+	if !recipeBuiltins[name] {
+		return recipeValue{}, fmt.Errorf("unknown variable %q", name)
+	}
+	if v, ok := e.props[name]; ok {
+		return v, nil
+	}
+
+	switch name {
+	case "filesize":
+		info, err := os.Stat(e.path)
+		if err != nil {
+			return recipeValue{}, &ErrInvalidInput{Path: e.path, Err: err}
+		}
+		e.props[name] = recipeValue{num: float64(info.Size())}
+		return e.props[name], nil
+	case "noise":
+		sigma, err := EstimateNoise(e.path)
+		if err != nil {
+			return recipeValue{}, err
+		}
+		e.props[name] = recipeValue{num: sigma}
+		return e.props[name], nil
+	}
+	if name == "class" {
+		c, err := ClassifyImage(e.path)
+		if err != nil {
+			return recipeValue{}, err
+		}
+		e.props["class"] = recipeValue{str: c.Class, isStr: true}
+		return e.props["class"], nil
+	}
+
+	file, err := os.Open(e.path)
+	if err != nil {
+		return recipeValue{}, &ErrInvalidInput{Path: e.path, Err: err}
+	}
+	defer file.Close()
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return recipeValue{}, &ErrProcessing{Op: "decode", Err: err}
+	}
+	format, err := DetectFormat(e.path)
+	if err != nil {
+		return recipeValue{}, err
+	}
+	w, h := float64(config.Width), float64(config.Height)
+	e.props["width"] = recipeValue{num: w}
+	e.props["height"] = recipeValue{num: h}
+	e.props["megapixels"] = recipeValue{num: w * h / 1e6}
+	e.props["aspect"] = recipeValue{num: w / max(h, 1)}
+	e.props["format"] = recipeValue{str: format, isStr: true}
+	return e.props[name], nil
+}
+
+func recipeError(line int, err error) error {
+	if _, ok := err.(*ErrProcessing); ok {
+		return err
+	}
+	return &ErrProcessing{Op: "recipe", Err: fmt.Errorf("line %d: %w", line, err)}
+}
+
+// recipeValue is a number or a string. Comparisons and logical operators
+// produce the numbers 1 and 0.
+type recipeValue struct {
+	num   float64
+	str   string
+	isStr bool
+}
+
+func (v recipeValue) String() string {
+	if v.isStr {
+		return v.str
+	}
+	return strconv.FormatFloat(v.num, 'f', -1, 64)
+}
+
+func (v recipeValue) truth() bool {
+	if v.isStr {
+		return v.str != ""
+	}
+	return v.num != 0
+}
+
+func recipeBool(b bool) recipeValue {
+	if b {
+		return recipeValue{num: 1}
+	}
+	return recipeValue{}
+}
+
+// recipeExpr is a node of a parsed expression
+type recipeExpr interface {
+	eval(e *recipeEnv) (recipeValue, error)
+}
+
+type recipeLiteral recipeValue
+
+func (l recipeLiteral) eval(*recipeEnv) (recipeValue, error) {
+	return recipeValue(l), nil
+}
+
+type recipeVariable string
+
+func (name recipeVariable) eval(e *recipeEnv) (recipeValue, error) {
+	return e.lookup(string(name))
+}
+
+type recipeUnary struct {
+	op string
+	x  recipeExpr
+}
+
+func (u recipeUnary) eval(e *recipeEnv) (recipeValue, error) {
+	x, err := u.x.eval(e)
+	if err != nil {
+		return x, err
+	}
+	if u.op == "not" {
+		return recipeBool(!x.truth()), nil
+	}
+	if x.isStr {
+		return x, fmt.Errorf("cannot negate string %q", x.str)
+	}
+	return recipeValue{num: -x.num}, nil
+}
+
+type recipeBinary struct {
+	op   string
+	x, y recipeExpr
+}
+
+func (b recipeBinary) eval(e *recipeEnv) (recipeValue, error) {
+	x, err := b.x.eval(e)
+	if err != nil {
+		return x, err
+	}
+	// and and or only evaluate the right side when it decides the result,
+	// so that expensive properties such as class are looked up only when needed
+	switch b.op {
+	case "and":
+		if !x.truth() {
+			return recipeBool(false), nil
+		}
+	case "or":
+		if x.truth() {
+			return recipeBool(true), nil
+		}
+	}
+	y, err := b.y.eval(e)
+	if err != nil {
+		return y, err
+	}
+
+	switch b.op {
+	case "and", "or":
+		return recipeBool(y.truth()), nil
+	case "==":
+		return recipeBool(x == y), nil
+	case "!=":
+		return recipeBool(x != y), nil
+	}
+	if x.isStr || y.isStr {
+		if b.op == "+" && x.isStr && y.isStr {
+			return recipeValue{str: x.str + y.str, isStr: true}, nil
+		}
+		return recipeValue{}, fmt.Errorf("operator %s needs numbers, got %q and %q", b.op, x.String(), y.String())
+	}
+	switch b.op {
+	case "<":
+		return recipeBool(x.num < y.num), nil
+	case "<=":
+		return recipeBool(x.num <= y.num), nil
+	case ">":
+		return recipeBool(x.num > y.num), nil
+	case ">=":
+		return recipeBool(x.num >= y.num), nil
+	case "+":
+		return recipeValue{num: x.num + y.num}, nil
+	case "-":
+		return recipeValue{num: x.num - y.num}, nil
+	case "*":
+		return recipeValue{num: x.num * y.num}, nil
+	case "/":
+		if y.num == 0 {
+			return recipeValue{}, fmt.Errorf("division by zero")
+		}
+		return recipeValue{num: x.num / y.num}, nil
+	}
+	return recipeValue{}, fmt.Errorf("unknown operator %s", b.op)
+}
+
+// Token kinds
+const (
+	recipeNumber = iota + 1
+	recipeString
+	recipeIdent
+	recipeOperator
+)
+
+type recipeToken struct {
+	kind int
+	text string
+	num  float64
+}
+
+// tokenizeRecipe splits a line into tokens, dropping any comment
+func tokenizeRecipe(line string) ([]recipeToken, error) {
+	var tokens []recipeToken
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			return tokens, nil
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(line) && (line[j] >= '0' && line[j] <= '9' || line[j] == '.') {
+				j++
+			}
+			num, err := strconv.ParseFloat(line[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", line[i:j])
+			}
+			tokens = append(tokens, recipeToken{kind: recipeNumber, text: line[i:j], num: num})
+			i = j
+		case c == '"':
+			j := strings.IndexByte(line[i+1:], '"')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, recipeToken{kind: recipeString, text: line[i+1 : i+1+j]})
+			i += j + 2
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(line) && (line[j] == '_' || line[j] >= 'a' && line[j] <= 'z' || line[j] >= 'A' && line[j] <= 'Z' || line[j] >= '0' && line[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, recipeToken{kind: recipeIdent, text: line[i:j]})
+			i = j
+		case strings.Contains("=!<>", string(c)) && i+1 < len(line) && line[i+1] == '=':
+			tokens = append(tokens, recipeToken{kind: recipeOperator, text: line[i : i+2]})
+			i += 2
+		case strings.Contains("<>+-*/()=", string(c)):
+			tokens = append(tokens, recipeToken{kind: recipeOperator, text: string(c)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// recipeKeywords cannot be used as variable names
+var recipeKeywords = map[string]bool{
+	"let": true, "if": true, "then": true, "else": true, "end": true,
+	"and": true, "or": true, "not": true, "true": true, "false": true,
+	"repeat": true, "until": true, "max": true, "tune": true, "from": true,
+	"to": true, "by": true, "script": true,
+}
+
+// recipeParser parses a recipe line by line
+type recipeParser struct {
+	lines []string
+	// pos is the number of the line being parsed, counting from 1
+	pos int
+	// tokens are the unparsed tokens of the current line
+	tokens []recipeToken
+}
+
+func (p *recipeParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("recipe line %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// block parses statements up to the end of the recipe or up to an else or
+// end line, which it returns as the terminator with the rest of its tokens
+// left in p.tokens
+func (p *recipeParser) block() ([]recipeStatement, string, error) {
+	statements := []recipeStatement{}
+	for p.pos < len(p.lines) {
+		p.pos++
+		tokens, err := tokenizeRecipe(p.lines[p.pos-1])
+		if err != nil {
+			return nil, "", p.errorf("%v", err)
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		p.tokens = tokens
+		if first := p.next(); first.kind == recipeIdent && (first.text == "else" || first.text == "end") {
+			return statements, first.text, nil
+		}
+		p.tokens = tokens
+
+		s, err := p.statement()
+		if err != nil {
+			return nil, "", err
+		}
+		statements = append(statements, s)
+	}
+	return statements, "", nil
+}
+
+// statement parses the statement starting at the current token
+func (p *recipeParser) statement() (recipeStatement, error) {
+	line := p.pos
+	first := p.next()
+	if first.kind != recipeIdent {
+		return recipeStatement{}, p.errorf("expected a step, let or if, got %q", first.text)
+	}
+
+	switch first.text {
+	case "let":
+		name := p.next()
+		if name.kind != recipeIdent || recipeKeywords[name.text] {
+			return recipeStatement{}, p.errorf("expected a variable name after let")
+		}
+		if recipeBuiltins[name.text] {
+			return recipeStatement{}, p.errorf("cannot assign to built-in %s", name.text)
+		}
+		if eq := p.next(); eq.text != "=" {
+			return recipeStatement{}, p.errorf("expected = after let %s", name.text)
+		}
+		expr, err := p.expr()
+		if err != nil {
+			return recipeStatement{}, err
+		}
+		if len(p.tokens) > 0 {
+			return recipeStatement{}, p.errorf("unexpected %q", p.tokens[0].text)
+		}
+		return recipeStatement{kind: recipeLet, line: line, name: name.text, expr: expr}, nil
+	case "if":
+		return p.ifStatement(line, false)
+	case "repeat":
+		return p.repeatStatement(line)
+	case "tune":
+		return p.tuneStatement(line)
+	case "script":
+		return p.scriptStatement(line)
+	}
+
+	s, err := p.step(line, first.text)
+	if err != nil {
+		return recipeStatement{}, err
+	}
+	if len(p.tokens) > 0 {
+		return recipeStatement{}, p.errorf("unexpected %q", p.tokens[0].text)
+	}
+	return s, nil
+}
+
+// step parses the arguments of a step, up to the end of the line or a keyword
+func (p *recipeParser) step(line int, name string) (recipeStatement, error) {
+	step, ok := lookupStep(name)
+	if !ok {
+		return recipeStatement{}, p.errorf("unknown step %q", name)
+	}
+	var args []recipeExpr
+	for len(p.tokens) > 0 && !(p.peek().kind == recipeIdent && recipeKeywords[p.peek().text]) {
+		arg, err := p.unary()
+		if err != nil {
+			return recipeStatement{}, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) < step.minArgs || (step.maxArgs >= 0 && len(args) > step.maxArgs) {
+		if step.minArgs == step.maxArgs {
+			return recipeStatement{}, p.errorf("%s takes %d arguments, got %d", name, step.minArgs, len(args))
+		}
+		return recipeStatement{}, p.errorf("%s takes %d to %d arguments, got %d", name, step.minArgs, step.maxArgs, len(args))
+	}
+	return recipeStatement{kind: recipeRun, line: line, name: name, args: args}, nil
+}
+
+// keyword consumes the keyword word, reporting whether it was there
+func (p *recipeParser) keyword(word string) bool {
+	if t := p.peek(); t.kind == recipeIdent && t.text == word {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// repeatStatement parses "repeat step until condition [max n]"
+func (p *recipeParser) repeatStatement(line int) (recipeStatement, error) {
+	name := p.next()
+	if name.kind != recipeIdent {
+		return recipeStatement{}, p.errorf("expected a step after repeat")
+	}
+	step, err := p.step(line, name.text)
+	if err != nil {
+		return recipeStatement{}, err
+	}
+	if !p.keyword("until") {
+		return recipeStatement{}, p.errorf("expected until after the step")
+	}
+	s := recipeStatement{kind: recipeRepeat, line: line, then: []recipeStatement{step}}
+	if s.expr, err = p.expr(); err != nil {
+		return recipeStatement{}, err
+	}
+	if p.keyword("max") {
+		if s.to, err = p.expr(); err != nil {
+			return recipeStatement{}, err
+		}
+	}
+	if len(p.tokens) > 0 {
+		return recipeStatement{}, p.errorf("unexpected %q", p.tokens[0].text)
+	}
+	return s, nil
+}
+
+// tuneStatement parses "tune var from a to b [by step] until condition then step"
+func (p *recipeParser) tuneStatement(line int) (recipeStatement, error) {
+	name := p.next()
+	if name.kind != recipeIdent || recipeKeywords[name.text] || recipeBuiltins[name.text] {
+		return recipeStatement{}, p.errorf("expected a variable name after tune")
+	}
+	s := recipeStatement{kind: recipeTune, line: line, name: name.text}
+	var err error
+	if !p.keyword("from") {
+		return recipeStatement{}, p.errorf("expected from after tune %s", name.text)
+	}
+	if s.from, err = p.expr(); err != nil {
+		return recipeStatement{}, err
+	}
+	if !p.keyword("to") {
+		return recipeStatement{}, p.errorf("expected to after the first value")
+	}
+	if s.to, err = p.expr(); err != nil {
+		return recipeStatement{}, err
+	}
+	if p.keyword("by") {
+		if s.by, err = p.expr(); err != nil {
+			return recipeStatement{}, err
+		}
+	}
+	if !p.keyword("until") {
+		return recipeStatement{}, p.errorf("expected until after the range")
+	}
+	if s.expr, err = p.expr(); err != nil {
+		return recipeStatement{}, err
+	}
+	if !p.keyword("then") {
+		return recipeStatement{}, p.errorf("expected then after the condition")
+	}
+	stepName := p.next()
+	if stepName.kind != recipeIdent {
+		return recipeStatement{}, p.errorf("expected a step after then")
+	}
+	step, err := p.step(line, stepName.text)
+	if err != nil {
+		return recipeStatement{}, err
+	}
+	if len(p.tokens) > 0 {
+		return recipeStatement{}, p.errorf("unexpected %q", p.tokens[0].text)
+	}
+	s.then = []recipeStatement{step}
+	return s, nil
+}
+
+// ifStatement parses the rest of an if, either a single line "if c then step"
+// or a block closed by end, with optional else and else if branches. The
+// branches of an else if chain share the end of the first if.
+func (p *recipeParser) ifStatement(line int, chained bool) (recipeStatement, error) {
+	cond, err := p.expr()
+	if err != nil {
+		return recipeStatement{}, err
+	}
+	if then := p.next(); then.kind != recipeIdent || then.text != "then" {
+		return recipeStatement{}, p.errorf("expected then after the condition")
+	}
+	s := recipeStatement{kind: recipeIf, line: line, expr: cond}
+
+	if len(p.tokens) > 0 {
+		if chained {
+			return recipeStatement{}, p.errorf("the steps of an else if go on the following lines")
+		}
+		step, err := p.statement()
+		if err != nil {
+			return recipeStatement{}, err
+		}
+		s.then = []recipeStatement{step}
+		return s, nil
+	}
+
+	var terminator string
+	s.then, terminator, err = p.block()
+	if err != nil {
+		return recipeStatement{}, err
+	}
+	switch {
+	case terminator == "":
+		return recipeStatement{}, fmt.Errorf("recipe line %d: if without end", line)
+	case terminator == "end":
+		if len(p.tokens) > 0 {
+			return recipeStatement{}, p.errorf("unexpected %q after end", p.tokens[0].text)
+		}
+		return s, nil
+	case len(p.tokens) > 0:
+		if next := p.next(); next.kind != recipeIdent || next.text != "if" {
+			return recipeStatement{}, p.errorf("unexpected %q after else", next.text)
+		}
+		elseIf, err := p.ifStatement(p.pos, true)
+		if err != nil {
+			return recipeStatement{}, err
+		}
+		s.otherwise = []recipeStatement{elseIf}
+		return s, nil
+	}
+
+	s.otherwise, terminator, err = p.block()
+	if err != nil {
+		return recipeStatement{}, err
+	}
+	if terminator != "end" || len(p.tokens) > 0 {
+		return recipeStatement{}, fmt.Errorf("recipe line %d: if without end", line)
+	}
+	return s, nil
+}
+
+// next consumes the current token, returning a zero token at the end of the line
+func (p *recipeParser) next() recipeToken {
+	if len(p.tokens) == 0 {
+		return recipeToken{}
+	}
+	t := p.tokens[0]
+	p.tokens = p.tokens[1:]
+	return t
+}
+
+// peek returns the current token without consuming it
+func (p *recipeParser) peek() recipeToken {
+	if len(p.tokens) == 0 {
+		return recipeToken{}
+	}
+	return p.tokens[0]
+}
+
+// expr parses an expression, from the loosest binding operator or down to
+// unary minus and not
+func (p *recipeParser) expr() (recipeExpr, error) {
+	return p.binary(0)
+}
+
+// recipePrecedence lists the binary operators from the loosest binding
+var recipePrecedence = [][]string{
+	{"or"},
+	{"and"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/"},
+}
+
+func (p *recipeParser) binary(level int) (recipeExpr, error) {
+	if level == len(recipePrecedence) {
+		return p.unary()
+	}
+	x, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op.kind != recipeOperator && op.kind != recipeIdent || !slices.Contains(recipePrecedence[level], op.text) {
+			return x, nil
+		}
+		p.next()
+		y, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = recipeBinary{op: op.text, x: x, y: y}
+	}
+}
+
+func (p *recipeParser) unary() (recipeExpr, error) {
+	if t := p.peek(); t.text == "-" && t.kind == recipeOperator || t.text == "not" && t.kind == recipeIdent {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return recipeUnary{op: t.text, x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *recipeParser) primary() (recipeExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case recipeNumber:
+		return recipeLiteral{num: t.num}, nil
+	case recipeString:
+		return recipeLiteral{str: t.text, isStr: true}, nil
+	case recipeIdent:
+		switch {
+		case t.text == "true":
+			return recipeLiteral{num: 1}, nil
+		case t.text == "false":
+			return recipeLiteral{}, nil
+		case recipeKeywords[t.text]:
+			return nil, p.errorf("unexpected %q", t.text)
+		}
+		return recipeVariable(t.text), nil
+	case recipeOperator:
+		if t.text != "(" {
+			return nil, p.errorf("unexpected %q", t.text)
+		}
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.text != ")" {
+			return nil, p.errorf("expected )")
+		}
+		return x, nil
+	}
+	return nil, p.errorf("unexpected end of line")
+}
@@ -0,0 +1,135 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// recipeScriptSteps bounds the computation of one script, so a runaway
+// script fails instead of hanging the recipe
+const recipeScriptSteps = 1_000_000
+
+// recipeScriptOptions are the Starlark dialect of recipe scripts: the
+// standard language, without while loops or recursion
+var recipeScriptOptions = &syntax.FileOptions{}
+
+// scriptStatement parses the lines of a script block up to its end line.
+// The block is Starlark rather than recipe syntax, so it is taken verbatim,
+// without its common indentation.
+func (p *recipeParser) scriptStatement(line int) (recipeStatement, error) {
+	if len(p.tokens) > 0 {
+		return recipeStatement{}, p.errorf("unexpected %q after script", p.tokens[0].text)
+	}
+	var body []string
+	for {
+		if p.pos >= len(p.lines) {
+			return recipeStatement{}, fmt.Errorf("recipe line %d: script without end", line)
+		}
+		p.pos++
+		text := strings.TrimRight(p.lines[p.pos-1], " \t\r")
+		if strings.TrimSpace(text) == "end" {
+			break
+		}
+		body = append(body, text)
+	}
+
+	source := dedent(body)
+	if _, err := recipeScriptOptions.Parse("script", source, 0); err != nil {
+		return recipeStatement{}, fmt.Errorf("recipe line %d: %w", line, err)
+	}
+	return recipeStatement{kind: recipeScript, line: line, name: source}, nil
+}
+
+// dedent removes the indentation common to all non-blank lines
+func dedent(lines []string) string {
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		n := len(l) - len(strings.TrimLeft(l, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	var b strings.Builder
+	for _, l := range lines {
+		if len(l) >= indent && indent > 0 {
+			l = l[indent:]
+		}
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// script runs a script block. The script sees the recipe variables and the
+// built-in properties it mentions; the numbers, strings and booleans it
+// assigns at the top level become recipe variables.
+func (e *recipeEnv) script(s recipeStatement) error {
+	predeclared := starlark.StringDict{}
+	for name, v := range e.vars {
+		predeclared[name] = v.starlark()
+	}
+	f, err := recipeScriptOptions.Parse("script", s.name, 0)
+	if err != nil {
+		return recipeError(s.line, err)
+	}
+	var lookupErr error
+	syntax.Walk(f, func(n syntax.Node) bool {
+		id, ok := n.(*syntax.Ident)
+		if !ok || lookupErr != nil || !recipeBuiltins[id.Name] || predeclared.Has(id.Name) {
+			return true
+		}
+		v, err := e.lookup(id.Name)
+		if err != nil {
+			lookupErr = err
+			return false
+		}
+		predeclared[id.Name] = v.starlark()
+		return true
+	})
+	if lookupErr != nil {
+		return recipeError(s.line, lookupErr)
+	}
+
+	thread := &starlark.Thread{Name: "recipe"}
+	thread.SetMaxExecutionSteps(recipeScriptSteps)
+	globals, err := starlark.ExecFileOptions(recipeScriptOptions, thread, "script", s.name, predeclared)
+	if err != nil {
+		return recipeError(s.line, err)
+	}
+	for name, value := range globals {
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		if recipeBuiltins[name] {
+			return recipeError(s.line, fmt.Errorf("cannot assign to built-in %s", name))
+		}
+		switch value := value.(type) {
+		case starlark.Bool:
+			e.vars[name] = recipeBool(bool(value))
+		case starlark.String:
+			e.vars[name] = recipeValue{str: string(value), isStr: true}
+		case starlark.Int, starlark.Float:
+			num, _ := starlark.AsFloat(value)
+			e.vars[name] = recipeValue{num: num}
+		}
+	}
+	return nil
+}
+
+// starlark converts a recipe value to a Starlark value. Whole numbers become
+// ints, so scripts can use them as counts.
+func (v recipeValue) starlark() starlark.Value {
+	if v.isStr {
+		return starlark.String(v.str)
+	}
+	if v.num == float64(int64(v.num)) {
+		return starlark.MakeInt64(int64(v.num))
+	}
+	return starlark.Float(v.num)
+}
@@ -0,0 +1,249 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseRecipe(t *testing.T) {
+	invalid := map[string]string{
+		"unknown step":      "sharpen",
+		"wrong arity":       "resize 100",
+		"missing then":      "if width > 10 resize 5 5",
+		"missing end":       "if width > 10 then\nbinarize",
+		"stray end":         "binarize\nend",
+		"builtin let":       "let width = 3",
+		"bad expression":    "let x = (1 + 2",
+		"single line chain": "if width > 1 then\nbinarize\nelse if height > 1 then denoise\nend",
+		"bad character":     "let x = 1 % 2",
+		"repeat no until":   "repeat denoise",
+		"tune no then":      "tune q from 1 to 5 until noise < 2",
+		"tune builtin":      "tune width from 1 to 5 until true then denoise",
+	}
+	for name, source := range invalid {
+		if _, err := ParseRecipe(source); err == nil {
+			t.Errorf("%s: expected a parse error for %q", name, source)
+		} else if !strings.HasPrefix(err.Error(), "recipe line ") {
+			t.Errorf("%s: expected the error to name the line, got %v", name, err)
+		}
+	}
+
+	valid := `
+# comment only
+let limit = 4000 / 2   # trailing comment
+if width > limit or height > limit then fit limit limit
+if format == "png" then
+    binarize
+else if not (class == "document") then
+    denoise 2
+else
+    docclean "whiteboard"
+end
+rotate -90
+`
+	if _, err := ParseRecipe(valid); err != nil {
+		t.Fatalf("Failed to parse recipe: %v", err)
+	}
+}
+
+func TestRecipeRun(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	jpegPath := filepath.Join(testDir, "input.jpg")
+	if err := generateSingleTestImage(jpegPath, 640, 480); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	small, err := loadImage(jpegPath)
+	if err != nil {
+		t.Fatalf("Failed to load test image: %v", err)
+	}
+	pngPath := filepath.Join(testDir, "input.png")
+	if err := savePNG(pngPath, small); err != nil {
+		t.Fatalf("Failed to save PNG: %v", err)
+	}
+
+	recipe, err := ParseRecipe(`
+let source = format
+let limit = 320
+if width > limit then
+    fit limit limit
+end
+# The properties describe the resized image now, which is always a JPEG
+if width == limit and source == "jpeg" then
+    rotate 90
+else if source == "png" then
+    binarize
+end
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse recipe: %v", err)
+	}
+
+	tests := []struct {
+		input         string
+		steps         []string
+		width, height int
+	}{
+		{jpegPath, []string{"fit 320 320", "rotate 90"}, 240, 320},
+		{pngPath, []string{"fit 320 320", "binarize"}, 320, 240},
+	}
+	for _, tt := range tests {
+		outputPath := filepath.Join(testDir, "output_"+filepath.Base(tt.input)+".jpg")
+		result, err := recipe.Run(tt.input, outputPath)
+		if err != nil {
+			t.Fatalf("Recipe failed for %s: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(result.Steps, tt.steps) {
+			t.Errorf("%s: expected steps %v, got %v", tt.input, tt.steps, result.Steps)
+		}
+		img, err := loadImage(outputPath)
+		if err != nil {
+			t.Fatalf("Failed to load output: %v", err)
+		}
+		if img.Bounds().Dx() != tt.width || img.Bounds().Dy() != tt.height {
+			t.Errorf("%s: expected %dx%d, got %v", tt.input, tt.width, tt.height, img.Bounds())
+		}
+	}
+
+	// Errors while evaluating name the line
+	broken, err := ParseRecipe("let x = 1\nif x / 0 > 1 then binarize")
+	if err != nil {
+		t.Fatalf("Failed to parse recipe: %v", err)
+	}
+	if _, err := broken.Run(jpegPath, filepath.Join(testDir, "broken.jpg")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error on line 2, got %v", err)
+	}
+}
+
+func TestRecipeLoops(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	inputPath := filepath.Join(testDir, "input.jpg")
+	if err := generateSingleTestImage(inputPath, 640, 480); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	img, err := loadImage(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to load test image: %v", err)
+	}
+	quality50 := filepath.Join(testDir, "quality50.jpg")
+	if err := saveJPEGQuality(quality50, img, 50); err != nil {
+		t.Fatalf("Failed to save JPEG: %v", err)
+	}
+	info, err := os.Stat(quality50)
+	if err != nil {
+		t.Fatalf("Failed to stat JPEG: %v", err)
+	}
+
+	tests := []struct {
+		source string
+		steps  []string
+		width  int
+	}{
+		{"repeat scale 0.5 until width <= 100", []string{"scale 0.5", "scale 0.5", "scale 0.5"}, 80},
+		{"repeat scale 0.5 until width < 10 max 2", []string{"scale 0.5", "scale 0.5"}, 160},
+		{"repeat scale 0.5 until width > 100", []string{}, 640},
+		{"tune w from 100 to 400 by 100 until width >= 300 then resize w w", []string{"resize 300 300"}, 300},
+		{"tune w from 100 to 400 by 100 until width > 1000 then resize w w", []string{"resize 400 400"}, 400},
+		{"tune q from 90 to 10 by 20 until filesize <= " + strconv.FormatInt(info.Size(), 10) + " then quality q", []string{"quality 50"}, 640},
+	}
+	for i, tt := range tests {
+		recipe, err := ParseRecipe(tt.source)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.source, err)
+		}
+		outputPath := filepath.Join(testDir, "output"+strconv.Itoa(i)+".jpg")
+		result, err := recipe.Run(inputPath, outputPath)
+		if err != nil {
+			t.Fatalf("%q failed: %v", tt.source, err)
+		}
+		if !reflect.DeepEqual(result.Steps, tt.steps) {
+			t.Errorf("%q: expected steps %v, got %v", tt.source, tt.steps, result.Steps)
+		}
+		out, err := loadImage(outputPath)
+		if err != nil {
+			t.Fatalf("Failed to load output: %v", err)
+		}
+		if out.Bounds().Dx() != tt.width {
+			t.Errorf("%q: expected width %d, got %d", tt.source, tt.width, out.Bounds().Dx())
+		}
+	}
+	// Bounds that could run forever are rejected
+	for _, source := range []string{
+		"let a = 100000000000000000000\nlet a = a * a\nlet a = a * a\nlet a = a * a\nlet a = a * a\ntune q from a to a by 1 until width < 0 then quality q",
+		"repeat scale 0.5 until width < 0 max 100000000000",
+	} {
+		recipe, err := ParseRecipe(source)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", source, err)
+		}
+		if _, err := recipe.Run(inputPath, filepath.Join(testDir, "unbounded.jpg")); err == nil {
+			t.Errorf("%q: expected an error for unbounded loop values", source)
+		}
+	}
+}
+
+func TestRecipeScript(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	inputPath := filepath.Join(testDir, "input.jpg")
+	if err := generateSingleTestImage(inputPath, 400, 200); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	invalid := map[string]string{
+		"missing end":   "script\nq = 1",
+		"bad syntax":    "script\nq = (1\nend",
+		"trailing text": "script q = 1\nend",
+	}
+	for name, source := range invalid {
+		if _, err := ParseRecipe(source); err == nil || !strings.HasPrefix(err.Error(), "recipe line ") {
+			t.Errorf("%s: expected a parse error naming the line, got %v", name, err)
+		}
+	}
+
+	recipe, err := ParseRecipe(`
+let floor = 60
+script
+    def pick(mp):
+        return 90 if mp < 0.01 else max(floor, int(95 - 300 * mp))
+    q = pick(megapixels)
+    side = width // 4
+    label = "wide" if aspect > 1.5 else "narrow"
+end
+if label == "wide" then fit side side
+quality q
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse recipe: %v", err)
+	}
+	result, err := recipe.Run(inputPath, filepath.Join(testDir, "output.jpg"))
+	if err != nil {
+		t.Fatalf("Failed to run recipe: %v", err)
+	}
+	if want := []string{"fit 100 100", "quality 71"}; !reflect.DeepEqual(result.Steps, want) {
+		t.Errorf("Expected steps %v, got %v", want, result.Steps)
+	}
+
+	failing := map[string]string{
+		"runtime error": "script\nq = 1 // 0\nend",
+		"builtin":       "script\nwidth = 1\nend",
+		"runaway":       "script\ndef spin():\n    for i in range(100000000):\n        pass\nspin()\nend",
+	}
+	for name, source := range failing {
+		recipe, err := ParseRecipe(source)
+		if err != nil {
+			t.Fatalf("%s: failed to parse recipe: %v", name, err)
+		}
+		if _, err := recipe.Run(inputPath, filepath.Join(testDir, "failed.jpg")); err == nil {
+			t.Errorf("%s: expected the script to fail", name)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RecipeDocument is a recipe written as data rather than as text: a list of
+// steps with their arguments, run in order. It can be kept as a JSON or YAML
+// file and loaded with LoadRecipe:
+//
+//	description: Clean up scanned letters
+//	steps:
+//	  - op: autorotate
+//	  - op: fit
+//	    args: [2000, 2000]
+//	  - op: docclean
+//	    args: [document]
+//	  - op: quality
+//	    args: [85]
+//
+// The steps are those of the recipe language, including operations added
+// with Register. Conditions and variables need the text form.
+type RecipeDocument struct {
+	// Description says what the recipe is for; it is not used otherwise
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Steps are the operations to run, in order
+	Steps []RecipeDocumentStep `json:"steps" yaml:"steps"`
+}
+
+// RecipeDocumentStep is one operation of a RecipeDocument
+type RecipeDocumentStep struct {
+	// Op is the name of the step, such as resize or docclean
+	Op string `json:"op" yaml:"op"`
+	// Args are the arguments of the step, numbers or strings
+	Args []any `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// Recipe checks the steps of the document and returns them as a recipe.
+// Returns an error naming the first step that is unknown or has the wrong
+// arguments.
+func (d RecipeDocument) Recipe() (*Recipe, error) {
+	statements := make([]recipeStatement, 0, len(d.Steps))
+	for i, s := range d.Steps {
+		step, ok := lookupStep(s.Op)
+		if !ok {
+			return nil, fmt.Errorf("recipe step %d: unknown step %q", i+1, s.Op)
+		}
+		if len(s.Args) < step.minArgs || (step.maxArgs >= 0 && len(s.Args) > step.maxArgs) {
+			if step.minArgs == step.maxArgs {
+				return nil, fmt.Errorf("recipe step %d: %s takes %d arguments, got %d", i+1, s.Op, step.minArgs, len(s.Args))
+			}
+			return nil, fmt.Errorf("recipe step %d: %s takes %d to %d arguments, got %d", i+1, s.Op, step.minArgs, step.maxArgs, len(s.Args))
+		}
+		args := make([]recipeExpr, len(s.Args))
+		for j, arg := range s.Args {
+			value, err := recipeDocumentValue(arg)
+			if err != nil {
+				return nil, fmt.Errorf("recipe step %d: %s: %w", i+1, s.Op, err)
+			}
+			if value.isStr && !step.text {
+				return nil, fmt.Errorf("recipe step %d: %s needs numbers, got %q", i+1, s.Op, value.str)
+			}
+			args[j] = recipeLiteral(value)
+		}
+		statements = append(statements, recipeStatement{kind: recipeRun, line: i + 1, name: s.Op, args: args})
+	}
+	return &Recipe{statements: statements}, nil
+}
+
+// recipeDocumentValue converts an argument decoded from JSON or YAML
+func recipeDocumentValue(arg any) (recipeValue, error) {
+	switch v := arg.(type) {
+	case float64:
+		return recipeValue{num: v}, nil
+	case int:
+		return recipeValue{num: float64(v)}, nil
+	case string:
+		return recipeValue{str: v, isStr: true}, nil
+	case bool:
+		return recipeBool(v), nil
+	}
+	return recipeValue{}, fmt.Errorf("argument %v is not a number or a string", arg)
+}
+
+// LoadRecipe reads a recipe file: a RecipeDocument for the extensions .json,
+// .yaml and .yml, and the text of ParseRecipe otherwise.
+// Returns an error if the file cannot be read or is not a valid recipe.
+func LoadRecipe(path string) (*Recipe, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read recipe: %w", err)
+	}
+	var doc RecipeDocument
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(source))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("recipe %s: %w", filepath.Base(path), err)
+		}
+	case ".yaml", ".yml":
+		if err := yaml.UnmarshalStrict(source, &doc); err != nil {
+			return nil, fmt.Errorf("recipe %s: %w", filepath.Base(path), err)
+		}
+	default:
+		return ParseRecipe(string(source))
+	}
+	return doc.Recipe()
+}
+
+// ProcessBatch runs the recipe on many images with ProcessBatch, writing each
+// result to outputDir under the name of its input
+func (r *Recipe) ProcessBatch(ctx context.Context, inputs []string, outputDir string, opts BatchOptions) (*BatchReport, error) {
+	return ProcessBatch(ctx, inputs, outputDir, func(inputPath, outputPath string) error {
+		_, err := r.RunContext(ctx, inputPath, outputPath, RecipeOptions{})
+		return err
+	}, opts)
+}
@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoadRecipe(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	inputPath := filepath.Join(testDir, "test_input_recipedoc.jpg")
+	if err := generateSingleTestImage(inputPath, 400, 300); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	files := map[string]string{
+		"fit.yaml": "description: Shrink\nsteps:\n  - op: fit\n    args: [200, 200]\n  - op: docclean\n    args: [document]\n",
+		"fit.json": `{"steps": [{"op": "fit", "args": [200, 200]}, {"op": "docclean", "args": ["document"]}]}`,
+		"fit.txt":  "fit 200 200\ndocclean \"document\"\n",
+	}
+	for name, source := range files {
+		path := filepath.Join(testDir, name)
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		recipe, err := LoadRecipe(path)
+		if err != nil {
+			t.Fatalf("%s: failed to load: %v", name, err)
+		}
+		result, err := recipe.Run(inputPath, filepath.Join(testDir, "test_output_"+name+".jpg"))
+		if err != nil || !slices.Equal(result.Steps, []string{"fit 200 200", "docclean document"}) {
+			t.Errorf("%s: expected fit and docclean, got %+v and %v", name, result, err)
+		}
+	}
+
+	for name, source := range map[string]string{
+		"unknown.yaml":   "steps:\n  - op: sharpen\n",
+		"count.json":     `{"steps": [{"op": "fit", "args": [200]}]}`,
+		"text.yaml":      "steps:\n  - op: rotate\n    args: [left]\n",
+		"field.json":     `{"steps": [{"op": "binarize", "params": [1]}]}`,
+		"malformed.yaml": "steps: [\n",
+	} {
+		path := filepath.Join(testDir, name)
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		if _, err := LoadRecipe(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	recipe, err := RecipeDocument{Steps: []RecipeDocumentStep{{Op: "scale", Args: []any{0.5}}}}.Recipe()
+	if err != nil {
+		t.Fatalf("Failed to build a recipe: %v", err)
+	}
+	outputDir := filepath.Join(testDir, "out")
+	report, err := recipe.ProcessBatch(context.Background(), []string{inputPath, inputPath + ".missing"}, outputDir, BatchOptions{Workers: 2})
+	if err != nil || report.Succeeded != 1 || len(report.Failures) != 1 {
+		t.Fatalf("Expected one of two images processed, got %+v and %v", report, err)
+	}
+	if out := decodeTestFile(t, filepath.Join(outputDir, "test_input_recipedoc.jpg")); out.Bounds().Dx() != 200 {
+		t.Errorf("Expected the image halved, got %v", out.Bounds())
+	}
+}
@@ -0,0 +1,136 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// OperationFunc is an operation registered with Register: it processes an
+// image with the string arguments it was given. It has the signature of the
+// function passed to ServePlugin, so a filter can be compiled in or shipped as
+// a plugin executable.
+type OperationFunc func(img image.Image, args []string) (image.Image, error)
+
+var (
+	operationsMu sync.RWMutex
+	operations   = map[string]OperationFunc{}
+)
+
+// Register makes an operation available under name to Pipeline.Custom,
+// RunOperation, recipes, batches and the CLI, which runs it as the command
+// "<name> [arguments] <input> <output>". Recipes can only name operations
+// made of letters, digits and underscores. It is meant to be called from an
+// init function:
+//
+//	func init() {
+//		processor.Register("sepia", func(img image.Image, args []string) (image.Image, error) {
+//			...
+//		})
+//	}
+//
+// Returns an error if the name is empty, contains spaces or slashes, is taken
+// by a recipe step or was already registered, or if fn is nil.
+func Register(name string, fn OperationFunc) error {
+	if name == "" || strings.ContainsAny(name, " \t/\\") {
+		return fmt.Errorf("invalid operation name %q", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("operation %q has no function", name)
+	}
+	if _, ok := recipeSteps[name]; ok {
+		return fmt.Errorf("operation %q is built in", name)
+	}
+	operationsMu.Lock()
+	defer operationsMu.Unlock()
+	if _, ok := operations[name]; ok {
+		return fmt.Errorf("operation %q is already registered", name)
+	}
+	operations[name] = fn
+	return nil
+}
+
+// LookupOperation returns the operation registered under name
+func LookupOperation(name string) (OperationFunc, bool) {
+	operationsMu.RLock()
+	defer operationsMu.RUnlock()
+	fn, ok := operations[name]
+	return fn, ok
+}
+
+// RegisteredOperations returns the names of the registered operations, sorted
+func RegisteredOperations() []string {
+	operationsMu.RLock()
+	defer operationsMu.RUnlock()
+	names := make([]string, 0, len(operations))
+	for name := range operations {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// RunOperation runs a registered operation on an image file. The output is
+// written as PNG when its extension is .png and as JPEG otherwise.
+// Returns an error if no operation of that name is registered.
+func RunOperation(name string, args []string, inputPath string, outputPath string) error {
+	return defaultProcessor.RunOperation(name, args, inputPath, outputPath)
+}
+
+// RunOperation is the package function RunOperation with the configuration
+// and logger of p
+func (p *Processor) RunOperation(name string, args []string, inputPath string, outputPath string) error {
+	fn, ok := LookupOperation(name)
+	if !ok {
+		return &ErrProcessing{Op: name, Err: errors.New("operation not registered")}
+	}
+	p.logger().Info("running operation", slog.String("operation", name), slog.String("input", inputPath), slog.String("output", outputPath))
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	result, err := fn(img, args)
+	if err != nil {
+		return &ErrProcessing{Op: name, Err: err}
+	}
+	if strings.EqualFold(filepath.Ext(outputPath), ".png") {
+		return savePNG(outputPath, result)
+	}
+	return p.saveJPEG(outputPath, result)
+}
+
+// Custom adds a step running the operation registered under name with args.
+// The operation is looked up when the step runs, so it fails then if the name
+// is not registered.
+func (p *Pipeline) Custom(name string, args ...string) *Pipeline {
+	desc := strings.Join(append([]string{name}, args...), " ")
+	return p.Then(desc, func(img image.Image) (image.Image, error) {
+		fn, ok := LookupOperation(name)
+		if !ok {
+			return nil, errors.New("operation not registered")
+		}
+		return fn(img, args)
+	})
+}
+
+// registeredStep is the recipe step running a registered operation, whose
+// arguments are passed as text
+func registeredStep(name string) (recipeStep, bool) {
+	if _, ok := LookupOperation(name); !ok {
+		return recipeStep{}, false
+	}
+	return recipeStep{0, -1, true, func(_ context.Context, in, out string, args []recipeValue) error {
+		words := make([]string, len(args))
+		for i, a := range args {
+			words[i] = a.String()
+		}
+		return RunOperation(name, words, in, out)
+	}}, true
+}
@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// testBrighten adds its argument, 10 by default, to every channel
+func testBrighten(img image.Image, args []string) (image.Image, error) {
+	amount := 10
+	if len(args) > 0 {
+		var err error
+		if amount, err = strconv.Atoi(args[0]); err != nil {
+			return nil, err
+		}
+	}
+	b := img.Bounds()
+	out := image.NewGray(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			g := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+			out.SetGray(x, y, color.Gray{uint8(min(int(g.Y)+amount, 255))})
+		}
+	}
+	return out, nil
+}
+
+func TestRegister(t *testing.T) {
+	if err := Register("test_brighten", testBrighten); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	for _, name := range []string{"test_brighten", "resize", "", "my filter", "a/b"} {
+		if err := Register(name, testBrighten); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+	if err := Register("test_nil", nil); err == nil {
+		t.Error("Expected an error for a nil function")
+	}
+	if !slices.Contains(RegisteredOperations(), "test_brighten") {
+		t.Errorf("Expected test_brighten listed, got %v", RegisteredOperations())
+	}
+
+	src := image.NewGray(image.Rect(0, 0, 4, 4))
+	out, err := NewPipeline().Custom("test_brighten", "30").Custom("test_brighten").Apply(src)
+	if err != nil {
+		t.Fatalf("Failed to run the pipeline: %v", err)
+	}
+	if got := out.(*image.Gray).GrayAt(1, 1).Y; got != 40 {
+		t.Errorf("Expected 40 after both steps, got %d", got)
+	}
+	if _, err := NewPipeline().Custom("test_missing").Apply(src); err == nil {
+		t.Error("Expected an error for an unregistered operation")
+	}
+
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	inputPath := filepath.Join(testDir, "test_input_registry.png")
+	if err := savePNG(inputPath, src); err != nil {
+		t.Fatalf("Failed to save the input: %v", err)
+	}
+	outputPath := filepath.Join(testDir, "test_output_registry.png")
+	if err := RunOperation("test_brighten", []string{"100"}, inputPath, outputPath); err != nil {
+		t.Fatalf("Failed to run the operation: %v", err)
+	}
+	if got := decodeTestFile(t, outputPath).(*image.Gray).GrayAt(0, 0).Y; got != 100 {
+		t.Errorf("Expected 100, got %d", got)
+	}
+
+	recipe, err := ParseRecipe("test_brighten 50\n")
+	if err != nil {
+		t.Fatalf("Failed to parse a recipe with the operation: %v", err)
+	}
+	result, err := recipe.Run(inputPath, filepath.Join(testDir, "test_output_registry.jpg"))
+	if err != nil || !slices.Equal(result.Steps, []string{"test_brighten 50"}) {
+		t.Errorf("Expected the recipe to run the operation, got %+v and %v", result, err)
+	}
+}
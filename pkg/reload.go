@@ -0,0 +1,120 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/okamyuji/go-image-processor/config"
+)
+
+// defaultWatchInterval is how often WatchConfig checks the files by default
+const defaultWatchInterval = 2 * time.Second
+
+// WatchOptions controls WatchConfig
+type WatchOptions struct {
+	// Interval is how often the files are checked; zero uses two seconds
+	Interval time.Duration
+	// Adjust, when set, is applied to every loaded configuration before it is
+	// validated, for example to keep command-line overrides
+	Adjust func(*config.Config)
+}
+
+// ReloadConfig loads a config file, validates it together with the recipes
+// of its tenant presets and the files they refer to, and makes it the active
+// configuration for subsequent operations. Operations already running keep
+// the configuration they started with.
+// It takes the path of the config file and an optional function adjusting it.
+// Returns an error, keeping the active configuration, if the file cannot be
+// loaded or is invalid.
+func ReloadConfig(path string, adjust func(*config.Config)) error {
+	c, err := config.LoadConfig(path)
+	if err != nil {
+		return &ErrProcessing{Op: "config", Err: err}
+	}
+	if adjust != nil {
+		adjust(c)
+	}
+	if err := validateConfig(c); err != nil {
+		return &ErrProcessing{Op: "config", Err: err}
+	}
+	SetConfig(c)
+	slog.Info("configuration loaded", "path", path)
+	return nil
+}
+
+// validateConfig checks a configuration, including what only this package
+// can check: that presets are valid recipes and watermarks exist
+func validateConfig(c *config.Config) error {
+	errs := []error{c.Validate()}
+	for _, t := range c.Tenants {
+		for name, source := range t.Presets {
+			if _, err := ParseRecipe(source); err != nil {
+				errs = append(errs, fmt.Errorf("tenant %s: preset %s: %w", t.Name, name, err))
+			}
+		}
+		if t.Watermark != nil && t.Watermark.Image != "" {
+			if _, err := os.Stat(t.Watermark.Image); err != nil {
+				errs = append(errs, fmt.Errorf("tenant %s: watermark: %w", t.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WatchConfig reloads the config file whenever it or one of its preset files
+// changes, until the context ends. Invalid versions are logged and skipped,
+// so the last good configuration stays active until the files are fixed.
+// The files are polled, which also notices editors that replace them.
+func WatchConfig(ctx context.Context, path string, opts WatchOptions) {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	slog.Info("watching configuration", "path", path, "interval", interval)
+
+	last := configFingerprint(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := configFingerprint(path)
+		if current == last {
+			continue
+		}
+		last = current
+		if err := ReloadConfig(path, opts.Adjust); err != nil {
+			slog.Error("configuration rejected, keeping the previous one", "path", path, "error", err)
+		}
+	}
+}
+
+// configFingerprint summarizes the size and modification time of a config
+// file and of the preset files it names
+func configFingerprint(path string) string {
+	paths := []string{path}
+	if c, err := config.LoadConfig(path); err == nil {
+		presets := c.PresetPaths(filepath.Dir(path))
+		slices.Sort(presets)
+		paths = append(paths, presets...)
+	}
+	var b strings.Builder
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", p, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(&b, "%s:missing;", p)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/okamyuji/go-image-processor/config"
+)
+
+func TestReloadConfig(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	original := currentConfig()
+	defer SetConfig(original)
+
+	configPath := filepath.Join(testDir, "config.yaml")
+	presetPath := filepath.Join(testDir, "web.recipe")
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	write(presetPath, "fit 100 100\n")
+	write(configPath, "jpeg_quality: 80\ntenants:\n  - name: web\n    api_key: k1\n    preset_files:\n      web: web.recipe\n")
+
+	if err := ReloadConfig(configPath, func(c *config.Config) { c.TempDir = testDir }); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	c := currentConfig()
+	if c.JpegQuality != 80 || c.TempDir != testDir || c.Tenants[0].Presets["web"] != "fit 100 100\n" {
+		t.Fatalf("Unexpected config %+v", c)
+	}
+
+	// Invalid versions are rejected and the last good one is kept
+	write(configPath, "jpeg_quality: 180\n")
+	if err := ReloadConfig(configPath, nil); err == nil {
+		t.Error("A quality of 180 should be rejected")
+	}
+	write(configPath, "tenants:\n  - name: web\n    api_key: k1\n    preset_files:\n      web: web.recipe\n")
+	write(presetPath, "sharpen 3\n")
+	if err := ReloadConfig(configPath, nil); err == nil {
+		t.Error("A preset with an unknown step should be rejected")
+	}
+	write(configPath, "tenants: [")
+	if err := ReloadConfig(configPath, nil); err == nil {
+		t.Error("Malformed YAML should be rejected")
+	}
+	if currentConfig().JpegQuality != 80 {
+		t.Errorf("Expected the last good config to stay active, got quality %d", currentConfig().JpegQuality)
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	original := currentConfig()
+	defer SetConfig(original)
+
+	configPath := filepath.Join(testDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte("jpeg_quality: 70\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchConfig(ctx, configPath, WatchOptions{Interval: 10 * time.Millisecond})
+	time.Sleep(30 * time.Millisecond)
+
+	if err := os.WriteFile(configPath, []byte("jpeg_quality: 65\ndefault_width: 640\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for currentConfig().JpegQuality != 65 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c := currentConfig(); c.JpegQuality != 65 || c.DefaultWidth != 640 {
+		t.Errorf("Expected the changed config to be applied, got %+v", c)
+	}
+}
@@ -0,0 +1,133 @@
+package processor
+
+import "math"
+
+// resampling holds the filter weights resampling a line of n samples to m, as
+// github.com/nfnt/resize computes them: output i is the weighted sum of the
+// length inputs from start[i], clamped to the ends of the line. The tiled
+// resize applies it to rows and columns one at a time, where the resize
+// package needs the whole image.
+type resampling struct {
+	start  []int
+	coeffs []float64
+	length int
+}
+
+// newResampling computes the weights resampling n samples to m with the
+// kernel of the interpolation
+func newResampling(n, m int, interpolation Interpolation) resampling {
+	if interpolation < 0 || int(interpolation) >= len(interpolations) {
+		interpolation = Lanczos3
+	}
+	taps, kernel := interpolations[interpolation].taps, interpolations[interpolation].kernel
+	scale := float64(n) / float64(m)
+	// Shrinking widens the kernel so every input contributes
+	length := taps * max(int(math.Ceil(scale)), 1)
+	factor := math.Min(1/scale, 1)
+
+	r := resampling{start: make([]int, m), coeffs: make([]float64, m*length), length: length}
+	for i := range m {
+		center := scale*(float64(i)+0.5) - 0.5
+		r.start[i] = int(center) - length/2 + 1
+		center -= float64(r.start[i])
+		for k := range length {
+			r.coeffs[i*length+k] = kernel((center - float64(k)) * factor)
+		}
+	}
+	return r
+}
+
+// span returns the first and last inputs of output i within a line of n
+// samples
+func (r resampling) span(i, n int) (first, last int) {
+	return max(r.start[i], 0), min(r.start[i]+r.length-1, n-1)
+}
+
+// apply resamples a row of premultiplied RGBA pixels, four samples each,
+// into dst. The samples are clamped to 16 bits, as the resize package clamps
+// them between its passes.
+func (r resampling) apply(dst []float64, src []uint16) {
+	last := len(src)/4 - 1
+	for i, start := range r.start {
+		var acc [4]float64
+		sum := 0.0
+		for k, c := range r.coeffs[i*r.length : (i+1)*r.length] {
+			if c == 0 {
+				continue
+			}
+			x := 4 * min(max(start+k, 0), last)
+			for s := range acc {
+				acc[s] += c * float64(src[x+s])
+			}
+			sum += c
+		}
+		if sum == 0 {
+			sum = 1
+		}
+		for s := range acc {
+			dst[4*i+s] = min(max(acc[s]/sum, 0), 0xffff)
+		}
+	}
+}
+
+// The kernels of the interpolations, as the resize package defines them
+
+func nearestKernel(x float64) float64 {
+	if x >= -0.5 && x < 0.5 {
+		return 1
+	}
+	return 0
+}
+
+func linearKernel(x float64) float64 {
+	x = math.Abs(x)
+	if x <= 1 {
+		return 1 - x
+	}
+	return 0
+}
+
+func cubicKernel(x float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x <= 1:
+		return x*x*(1.5*x-2.5) + 1
+	case x <= 2:
+		return x*(x*(2.5-0.5*x)-4) + 2
+	}
+	return 0
+}
+
+func mitchellKernel(x float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x <= 1:
+		return (7*x*x*x - 12*x*x + 16.0/3) / 6
+	case x <= 2:
+		return (-7.0/3*x*x*x + 12*x*x - 20*x + 32.0/3) / 6
+	}
+	return 0
+}
+
+func lanczos2Kernel(x float64) float64 {
+	if x > -2 && x < 2 {
+		return sinc(x) * sinc(x/2)
+	}
+	return 0
+}
+
+func lanczos3Kernel(x float64) float64 {
+	if x > -3 && x < 3 {
+		return sinc(x) * sinc(x/3)
+	}
+	return 0
+}
+
+// sinc is the normalized sinc function
+func sinc(x float64) float64 {
+	x = math.Abs(x) * math.Pi
+	if x < 1e-4 {
+		return 1
+	}
+	return math.Sin(x) / x
+}
@@ -0,0 +1,457 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+	"golang.org/x/image/draw"
+)
+
+// ResizeMode decides how an image is brought to a width x height box
+type ResizeMode int
+
+// Resize modes accepted by WithResizeMode and ResizeOptions
+const (
+	// ResizeFit fits the image inside the box, keeping its aspect ratio, so
+	// one side may come out shorter than asked
+	ResizeFit ResizeMode = iota
+	// ResizeFill covers the box, keeping the aspect ratio, and crops what
+	// overhangs it, so the output is exactly width x height
+	ResizeFill
+	// ResizeStretch scales each side to the box, ignoring the aspect ratio
+	ResizeStretch
+	// ResizePad fits the image inside the box and pads it to exactly
+	// width x height with a background color
+	ResizePad
+)
+
+// resizeModeNames are the names of the resize modes, in order
+var resizeModeNames = []string{"fit", "fill", "stretch", "pad"}
+
+// ParseResizeMode parses the name of a resize mode: fit, fill, stretch or
+// pad, in any case. exact is accepted for stretch.
+// Returns an error for other names.
+func ParseResizeMode(s string) (ResizeMode, error) {
+	if strings.EqualFold(s, "exact") {
+		return ResizeStretch, nil
+	}
+	for i, name := range resizeModeNames {
+		if strings.EqualFold(s, name) {
+			return ResizeMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown resize mode %q", s)
+}
+
+// String returns the name of the mode, as ParseResizeMode accepts it
+func (m ResizeMode) String() string {
+	if m < 0 || int(m) >= len(resizeModeNames) {
+		return fmt.Sprintf("ResizeMode(%d)", int(m))
+	}
+	return resizeModeNames[m]
+}
+
+// WithResizeMode sets how ResizeImageWith and ResizeWith bring the image to
+// the width x height they are given. The default is ResizeFit.
+func WithResizeMode(mode ResizeMode) Option {
+	return func(s *settings) {
+		s.resizeMode = mode
+	}
+}
+
+// ResizeOptions controls ResizeImageWithOptions
+type ResizeOptions struct {
+	// Width and Height are the box the image is brought to as Mode says.
+	// When only one is set the other follows from the aspect ratio.
+	Width  uint
+	Height uint
+	// Mode is how the image is brought to the box; the zero value is
+	// ResizeFit. The other modes need both Width and Height.
+	Mode ResizeMode
+	// Gravity places the image in the box for ResizePad, and the part kept
+	// for ResizeFill; nil centers it
+	Gravity *Gravity
+	// Background fills the padding of ResizePad; zero uses white
+	Background color.NRGBA
+	// PrintWidth and PrintHeight give the target size in physical units and
+	// override Width and Height when set. They are converted to pixels at DPI.
+	PrintWidth  Length
+	PrintHeight Length
+	// DPI is the print resolution, recorded in the output. Zero keeps the
+	// resolution of the source, falling back to 72 for physical sizes.
+	DPI float64
+	// Scale, when positive, resizes by a factor of the source size
+	// (0.5 halves it) and takes precedence over Width and Height
+	Scale float64
+	// NoUpscale keeps images that are already smaller than the target at their
+	// original size, so small inputs are never blown up
+	NoUpscale bool
+	// OnlyEnlarge keeps images that are already larger than the target at their
+	// original size, so only small inputs are resized
+	OnlyEnlarge bool
+	// Interpolation is the resampling filter; the zero value is Lanczos3
+	Interpolation Interpolation
+	// Tiled resizes a file a few rows at a time instead of decoding it whole,
+	// as WithTiled describes. It has no effect on readers and decoded images.
+	Tiled bool
+}
+
+// ResizeResult describes what ResizeImageWithOptions did
+type ResizeResult struct {
+	// Width and Height are the size of the output, with the padding of
+	// ResizePad and without what ResizeFill cropped
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Skipped is true when NoUpscale or OnlyEnlarge kept the original size
+	Skipped bool `json:"skipped"`
+	// DPI is the resolution recorded in the output; zero when unknown
+	DPI float64 `json:"dpi,omitempty"`
+}
+
+// ResizeImageWithOptions resizes the input image as opts.Mode says, by
+// default keeping its aspect ratio.
+// It takes the paths of the input and output files and the options.
+// Returns the output size, or an error if the operation fails.
+func ResizeImageWithOptions(inputPath string, outputPath string, opts ResizeOptions) (*ResizeResult, error) {
+	return defaultProcessor.ResizeImageWithOptions(inputPath, outputPath, opts)
+}
+
+// ResizeImageWithOptions is the package function ResizeImageWithOptions with the configuration and logger of p
+func (p *Processor) ResizeImageWithOptions(inputPath string, outputPath string, opts ResizeOptions) (*ResizeResult, error) {
+	return p.ResizeImageContext(context.Background(), inputPath, outputPath, opts)
+}
+
+// ResizeImageContext resizes the input image like ResizeImageWithOptions.
+// When ctx is cancelled it stops early and ctx's error is returned without
+// writing the output: between rows with Tiled, and otherwise before and after
+// the resize, which the resize package does in one call.
+func ResizeImageContext(ctx context.Context, inputPath string, outputPath string, opts ResizeOptions) (*ResizeResult, error) {
+	return defaultProcessor.ResizeImageContext(ctx, inputPath, outputPath, opts)
+}
+
+// ResizeImageContext is the package function ResizeImageContext with the configuration and logger of p
+func (p *Processor) ResizeImageContext(ctx context.Context, inputPath string, outputPath string, opts ResizeOptions) (*ResizeResult, error) {
+	return p.resizeImageFile(ctx, inputPath, outputPath, opts, p.Config().JpegQuality, nil)
+}
+
+// resizeImageFile does the work of ResizeImageContext, saving the
+// result with the given JPEG quality. A tiled resize reports the rows written
+// to progress.
+func (p *Processor) resizeImageFile(ctx context.Context, inputPath string, outputPath string, opts ResizeOptions, quality int, progress ProgressFunc) (*ResizeResult, error) {
+	p.logger().Info("resizing image",
+		"input", inputPath,
+		"width", opts.Width,
+		"height", opts.Height,
+		"scale", opts.Scale,
+		"dpi", opts.DPI,
+		"no_upscale", opts.NoUpscale,
+		"only_enlarge", opts.OnlyEnlarge,
+		"interpolation", opts.Interpolation,
+		"tiled", opts.Tiled)
+
+	if opts.Tiled {
+		return p.resizeTiled(ctx, inputPath, outputPath, opts, quality, progress)
+	}
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	srcDPI := opts.DPI
+	if srcDPI <= 0 {
+		srcDPI = readDPI(inputPath)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	resized, result, err := resizeImage(img, srcDPI, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.saveJPEGWithDPI(outputPath, resized, result.DPI, quality); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ResizeImageReaderWithOptions resizes the image read from r like
+// ResizeImageWithOptions and writes it to w as JPEG. The resolution recorded
+// in the input is kept, as it is for files.
+// Returns the output size, or an error if the operation fails.
+func ResizeImageReaderWithOptions(r io.Reader, w io.Writer, opts ResizeOptions) (*ResizeResult, error) {
+	return defaultProcessor.ResizeImageReaderWithOptions(r, w, opts)
+}
+
+// ResizeImageReaderWithOptions is the package function ResizeImageReaderWithOptions with the configuration and logger of p
+func (p *Processor) ResizeImageReaderWithOptions(r io.Reader, w io.Writer, opts ResizeOptions) (*ResizeResult, error) {
+	return p.resizeImageStream(r, w, opts, p.Config().JpegQuality)
+}
+
+// resizeImageStream does the work of ResizeImageReaderWithOptions, encoding
+// the result with the given JPEG quality
+func (p *Processor) resizeImageStream(r io.Reader, w io.Writer, opts ResizeOptions, quality int) (*ResizeResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "read", Err: err}
+	}
+	img, err := p.decodeImageData(data, "")
+	if err != nil {
+		return nil, err
+	}
+	srcDPI := opts.DPI
+	if srcDPI <= 0 {
+		srcDPI = decodeDPI(bytes.NewReader(data))
+	}
+	resized, result, err := resizeImage(img, srcDPI, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := encodeJPEGWithDPI(w, resized, result.DPI, quality); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Resize resizes the image to fit within width x height, keeping its aspect
+// ratio. When one of them is zero it follows from the aspect ratio.
+// Returns an error if both are zero.
+func Resize(img image.Image, width, height uint) (image.Image, error) {
+	resized, _, err := ResizeWithOptions(img, ResizeOptions{Width: width, Height: height})
+	return resized, err
+}
+
+// ResizeImageWith resizes the input image like ResizeImage, tuned by the
+// options WithResizeMode, WithInterpolation, WithQuality and WithTiled.
+// Returns an error if an option is invalid or the operation fails.
+func ResizeImageWith(inputPath string, outputPath string, width, height uint, opts ...Option) error {
+	return defaultProcessor.ResizeImageWith(inputPath, outputPath, width, height, opts...)
+}
+
+// ResizeImageWith is the package function ResizeImageWith with the configuration and logger of p
+func (p *Processor) ResizeImageWith(inputPath string, outputPath string, width, height uint, opts ...Option) error {
+	s, err := newSettings("resize", opts)
+	if err != nil {
+		return err
+	}
+	_, err = p.resizeImageFile(context.Background(), inputPath, outputPath, s.resizeOptions(width, height), s.jpegQuality(p.Config().JpegQuality), s.progress)
+	return s.recordFile(outputPath, err)
+}
+
+// ResizeImageReaderWith resizes the image read from r like ResizeImageWith
+// and writes it to w as JPEG.
+// Returns an error if an option is invalid or the operation fails.
+func ResizeImageReaderWith(r io.Reader, w io.Writer, width, height uint, opts ...Option) error {
+	return defaultProcessor.ResizeImageReaderWith(r, w, width, height, opts...)
+}
+
+// ResizeImageReaderWith is the package function ResizeImageReaderWith with the configuration and logger of p
+func (p *Processor) ResizeImageReaderWith(r io.Reader, w io.Writer, width, height uint, opts ...Option) error {
+	s, err := newSettings("resize", opts)
+	if err != nil {
+		return err
+	}
+	w = s.countOutput(w)
+	_, err = p.resizeImageStream(r, w, s.resizeOptions(width, height), s.jpegQuality(p.Config().JpegQuality))
+	return s.recordOutput(w, err)
+}
+
+// ResizeWith resizes the image like Resize, in the mode set by
+// WithResizeMode and with the resampling filter set by WithInterpolation.
+// Returns an error if an option is invalid or both sizes are zero.
+func ResizeWith(img image.Image, width, height uint, opts ...Option) (image.Image, error) {
+	s, err := newSettings("resize", opts)
+	if err != nil {
+		return nil, err
+	}
+	resized, _, err := ResizeWithOptions(img, s.resizeOptions(width, height))
+	return resized, err
+}
+
+// resizeOptions are the resize options for a width x height box with the
+// mode and interpolation of s
+func (s *settings) resizeOptions(width, height uint) ResizeOptions {
+	return ResizeOptions{Width: width, Height: height, Mode: s.resizeMode, Interpolation: s.interpolation, Tiled: s.tiled}
+}
+
+// ResizeWithOptions resizes the image like ResizeImageWithOptions. A decoded
+// image carries no resolution, so physical sizes are converted at opts.DPI,
+// or at 72 dpi when it is not set.
+// Returns the resized image and its size, or an error if the options are invalid.
+func ResizeWithOptions(img image.Image, opts ResizeOptions) (image.Image, *ResizeResult, error) {
+	return resizeImage(img, opts.DPI, opts)
+}
+
+// resizeImage resizes the image as the options ask. The dpi is the resolution
+// of the source, or zero when unknown; the result carries the resolution of
+// the output.
+func resizeImage(img image.Image, dpi float64, opts ResizeOptions) (image.Image, *ResizeResult, error) {
+	result, scaled, err := resizeTarget(img.Bounds().Size(), dpi, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	resized := img
+	if !result.Skipped {
+		resized = resize.Resize(uint(scaled.X), uint(scaled.Y), img, opts.Interpolation.filter())
+	}
+	if box := image.Pt(result.Width, result.Height); box != scaled {
+		resized = placeInBox(resized, box, opts)
+	}
+	return resized, result, nil
+}
+
+// placeInBox crops the resized image to the box for ResizeFill, or pads it
+// to the box for ResizePad, where the gravity of opts puts it. 16-bit images
+// keep their depth.
+func placeInBox(img image.Image, box image.Point, opts ResizeOptions) image.Image {
+	var dst draw.Image
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		dst = image.NewRGBA64(image.Rectangle{Max: box})
+	default:
+		dst = image.NewRGBA(image.Rectangle{Max: box})
+	}
+	gravity := GravityCenter
+	if opts.Gravity != nil {
+		gravity = *opts.Gravity
+	}
+	bounds := img.Bounds()
+	if opts.Mode == ResizeFill {
+		// The box is cut out of the image
+		part := gravity.Place(bounds, box, 0)
+		draw.Copy(dst, image.Point{}, img, part, draw.Src, nil)
+		return dst
+	}
+	background := opts.Background
+	if background == (color.NRGBA{}) {
+		background = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+	}
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	at := gravity.Place(dst.Bounds(), bounds.Size(), 0)
+	draw.Copy(dst, at.Min, img, bounds, draw.Over, nil)
+	return dst
+}
+
+// maxOutputPixels bounds the images resizing and padding create, a GiB of
+// RGBA, so a huge scale or border fails instead of exhausting memory
+const maxOutputPixels = 1 << 28
+
+// resizeTarget works out the size of the output of an image of the given
+// size and resolution resized as the options ask, whether it is kept at its
+// size, and the size it is scaled to before ResizeFill crops it or
+// ResizePad pads it
+func resizeTarget(size image.Point, dpi float64, opts ResizeOptions) (*ResizeResult, image.Point, error) {
+	if opts.NoUpscale && opts.OnlyEnlarge {
+		return nil, image.Point{}, &ErrProcessing{Op: "resize", Err: fmt.Errorf("no-upscale and only-enlarge are mutually exclusive")}
+	}
+	if opts.Mode < 0 || int(opts.Mode) >= len(resizeModeNames) {
+		return nil, image.Point{}, &ErrProcessing{Op: "resize", Err: fmt.Errorf("unknown resize mode %d", opts.Mode)}
+	}
+	if opts.PrintWidth.Value > 0 || opts.PrintHeight.Value > 0 {
+		if dpi <= 0 && (opts.PrintWidth.IsPhysical() || opts.PrintHeight.IsPhysical()) {
+			slog.Warn("no resolution given or recorded, assuming default", "dpi", defaultDPI)
+			dpi = defaultDPI
+		}
+		opts.Width = opts.PrintWidth.Pixels(dpi)
+		opts.Height = opts.PrintHeight.Pixels(dpi)
+	}
+	if math.IsNaN(opts.Scale) || math.IsInf(opts.Scale, 0) {
+		return nil, image.Point{}, &ErrInvalidInput{Err: fmt.Errorf("scale %v is not finite", opts.Scale)}
+	}
+	if opts.Scale > 0 && float64(size.X)*opts.Scale*float64(size.Y)*opts.Scale > maxOutputPixels {
+		return nil, image.Point{}, &ErrInvalidInput{Err: fmt.Errorf("scale %v of a %dx%d image exceeds %d pixels", opts.Scale, size.X, size.Y, maxOutputPixels)}
+	}
+	if opts.Width > maxOutputPixels || opts.Height > maxOutputPixels {
+		return nil, image.Point{}, &ErrInvalidInput{Err: fmt.Errorf("%dx%d exceeds %d pixels", opts.Width, opts.Height, maxOutputPixels)}
+	}
+	if opts.Scale <= 0 && opts.Width == 0 && opts.Height == 0 {
+		return nil, image.Point{}, &ErrProcessing{Op: "resize", Err: fmt.Errorf("either a scale or a width or height is required")}
+	}
+	if opts.Mode != ResizeFit && (opts.Scale > 0 || opts.Width == 0 || opts.Height == 0) {
+		return nil, image.Point{}, &ErrProcessing{Op: "resize", Err: fmt.Errorf("the %s mode needs both a width and a height", opts.Mode)}
+	}
+
+	newWidth, newHeight := fitSize(size.X, size.Y, opts)
+
+	result := &ResizeResult{Width: newWidth, Height: newHeight, DPI: dpi}
+	enlarging := newWidth > size.X || newHeight > size.Y
+	shrinking := newWidth < size.X || newHeight < size.Y
+	if (opts.NoUpscale && enlarging) || (opts.OnlyEnlarge && shrinking) {
+		slog.Info("keeping original size",
+			"width", size.X,
+			"height", size.Y)
+		result.Width, result.Height, result.Skipped = size.X, size.Y, true
+	}
+	scaled := image.Pt(result.Width, result.Height)
+
+	// An image kept at its size is still cropped when it covers the box, or
+	// padded when it fits inside it
+	box := image.Pt(int(opts.Width), int(opts.Height))
+	switch {
+	case opts.Mode == ResizeFill && scaled.X >= box.X && scaled.Y >= box.Y,
+		opts.Mode == ResizePad && scaled.X <= box.X && scaled.Y <= box.Y:
+		result.Width, result.Height = box.X, box.Y
+	}
+	if int64(scaled.X)*int64(scaled.Y) > maxOutputPixels || int64(result.Width)*int64(result.Height) > maxOutputPixels {
+		return nil, image.Point{}, &ErrInvalidInput{Err: fmt.Errorf("%dx%d output exceeds %d pixels", max(scaled.X, result.Width), max(scaled.Y, result.Height), maxOutputPixels)}
+	}
+	return result, scaled, nil
+}
+
+// fitSize returns the size of a width x height image after applying the
+// scale, or bringing it to the box of opts as its mode says: stretched to
+// the box, covering it for ResizeFill or fitted into it otherwise
+func fitSize(width, height int, opts ResizeOptions) (int, int) {
+	if opts.Scale > 0 {
+		return max(1, int(float64(width)*opts.Scale+0.5)), max(1, int(float64(height)*opts.Scale+0.5))
+	}
+
+	ratio := float64(width) / float64(height)
+	switch {
+	case opts.Height == 0:
+		return int(opts.Width), max(1, int(float64(opts.Width)/ratio+0.5))
+	case opts.Width == 0:
+		return max(1, int(float64(opts.Height)*ratio+0.5)), int(opts.Height)
+	}
+	switch opts.Mode {
+	case ResizeStretch:
+		return int(opts.Width), int(opts.Height)
+	case ResizeFill:
+		if float64(opts.Width)/float64(opts.Height) > ratio {
+			// Width is the limiting factor, and the height overhangs
+			return int(opts.Width), max(int(opts.Height), int(float64(opts.Width)/ratio+0.5))
+		}
+		return max(int(opts.Width), int(float64(opts.Height)*ratio+0.5)), int(opts.Height)
+	}
+	if float64(opts.Width)/float64(opts.Height) > ratio {
+		// Height is the limiting factor
+		return max(1, int(float64(opts.Height)*ratio)), int(opts.Height)
+	}
+	// Width is the limiting factor
+	return int(opts.Width), max(1, int(float64(opts.Width)/ratio))
+}
+
+// ParseScale parses a scale factor given as a percentage ("50%") or a
+// plain factor ("0.5"); it must be positive and finite
+func ParseScale(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	percent := strings.HasSuffix(s, "%")
+	value, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || value <= 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid scale %q", s)
+	}
+	if percent {
+		value /= 100
+	}
+	return value, nil
+}
@@ -0,0 +1,151 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResizeImageWithOptions(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_resize.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_resize_options.jpg")
+	if err := generateSingleTestImage(testInputPath, 100, 100); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		opts          ResizeOptions
+		width, height int
+		skipped       bool
+	}{
+		{"scale", ResizeOptions{Scale: 0.5}, 50, 50, false},
+		{"upscale", ResizeOptions{Width: 200, Height: 200}, 200, 200, false},
+		{"no upscale", ResizeOptions{Width: 200, Height: 200, NoUpscale: true}, 100, 100, true},
+		{"no upscale shrinks", ResizeOptions{Width: 40, Height: 40, NoUpscale: true}, 40, 40, false},
+		{"only enlarge", ResizeOptions{Width: 40, Height: 40, OnlyEnlarge: true}, 100, 100, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ResizeImageWithOptions(testInputPath, testOutputPath, tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to resize image: %v", err)
+			}
+			if result.Width != tt.width || result.Height != tt.height || result.Skipped != tt.skipped {
+				t.Errorf("Expected %dx%d (skipped %v), got %+v", tt.width, tt.height, tt.skipped, result)
+			}
+			img, err := loadImage(testOutputPath)
+			if err != nil {
+				t.Fatalf("Failed to load resized image: %v", err)
+			}
+			if img.Bounds().Dx() != tt.width || img.Bounds().Dy() != tt.height {
+				t.Errorf("Output is %v, expected %dx%d", img.Bounds(), tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestParseScale(t *testing.T) {
+	for input, want := range map[string]float64{"50%": 0.5, "0.25": 0.25, "200%": 2} {
+		got, err := ParseScale(input)
+		if err != nil || got != want {
+			t.Errorf("ParseScale(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"", "abc", "-10%", "0", "NaN", "Inf", "+Inf%"} {
+		if _, err := ParseScale(input); err == nil {
+			t.Errorf("ParseScale(%q) should fail", input)
+		}
+	}
+}
+
+func TestResizeInvalidScale(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 40, 30))
+	for _, opts := range []ResizeOptions{
+		{Scale: math.NaN()},
+		{Scale: math.Inf(1)},
+		{Scale: 1e6},
+		{Width: 1 << 20, Height: 1 << 20, Mode: ResizeStretch},
+	} {
+		_, _, err := ResizeWithOptions(img, opts)
+		var inputErr *ErrInvalidInput
+		if !errors.As(err, &inputErr) {
+			t.Errorf("Expected an invalid input error for %+v, got %v", opts, err)
+		}
+	}
+}
+
+func TestResizeModes(t *testing.T) {
+	// A 200x100 image, red on the left half and blue on the right
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			c := color.RGBA{0xff, 0, 0, 0xff}
+			if x >= 100 {
+				c = color.RGBA{0, 0, 0xff, 0xff}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	east := GravityEast
+
+	tests := []struct {
+		name string
+		opts ResizeOptions
+		want image.Point
+		// at is a pixel of the output and color its expected color
+		at    image.Point
+		color color.RGBA
+	}{
+		{"fit", ResizeOptions{Width: 100, Height: 100}, image.Pt(100, 50), image.Pt(10, 10), color.RGBA{0xff, 0, 0, 0xff}},
+		{"stretch", ResizeOptions{Width: 100, Height: 100, Mode: ResizeStretch}, image.Pt(100, 100), image.Pt(90, 90), color.RGBA{0, 0, 0xff, 0xff}},
+		{"fill", ResizeOptions{Width: 100, Height: 100, Mode: ResizeFill, Gravity: &east}, image.Pt(100, 100), image.Pt(10, 50), color.RGBA{0, 0, 0xff, 0xff}},
+		{"pad", ResizeOptions{Width: 100, Height: 100, Mode: ResizePad}, image.Pt(100, 100), image.Pt(50, 10), color.RGBA{0xff, 0xff, 0xff, 0xff}},
+		{"pad black", ResizeOptions{Width: 100, Height: 100, Mode: ResizePad, Background: color.NRGBA{A: 0xff}}, image.Pt(100, 100), image.Pt(50, 90), color.RGBA{0, 0, 0, 0xff}},
+		{"pad without upscaling", ResizeOptions{Width: 400, Height: 400, Mode: ResizePad, NoUpscale: true}, image.Pt(400, 400), image.Pt(150, 200), color.RGBA{0xff, 0, 0, 0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resized, result, err := ResizeWithOptions(img, tt.opts)
+			if err != nil {
+				t.Fatalf("ResizeWithOptions failed: %v", err)
+			}
+			if got := resized.Bounds().Size(); got != tt.want || image.Pt(result.Width, result.Height) != tt.want {
+				t.Fatalf("Expected %v, got an image of %v and a result of %dx%d", tt.want, got, result.Width, result.Height)
+			}
+			r, g, b, _ := resized.At(tt.at.X, tt.at.Y).RGBA()
+			if got := (color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 0xff}); absDiff(got.R, tt.color.R) > 8 || absDiff(got.G, tt.color.G) > 8 || absDiff(got.B, tt.color.B) > 8 {
+				t.Errorf("Pixel %v: expected %v, got %v", tt.at, tt.color, got)
+			}
+		})
+	}
+
+	for _, opts := range []ResizeOptions{{Width: 100, Mode: ResizeFill}, {Scale: 0.5, Mode: ResizePad}, {Width: 10, Height: 10, Mode: ResizeMode(9)}} {
+		if _, _, err := ResizeWithOptions(img, opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+	resized, err := ResizeWith(img, 50, 80, WithResizeMode(ResizeStretch))
+	if err != nil || resized.Bounds().Size() != image.Pt(50, 80) {
+		t.Errorf("Expected a 50x80 image from WithResizeMode, got %v, %v", resized.Bounds(), err)
+	}
+
+	for _, name := range []string{"fit", "Fill", "stretch", "exact", "PAD"} {
+		if _, err := ParseResizeMode(name); err != nil {
+			t.Errorf("ParseResizeMode(%q) failed: %v", name, err)
+		}
+	}
+	if mode, _ := ParseResizeMode("pad"); mode.String() != "pad" {
+		t.Errorf("Expected pad, got %v", mode)
+	}
+	if _, err := ParseResizeMode("crop"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"os"
+	"time"
+)
+
+// Result describes the output of an operation, as filled in by WithResult
+type Result struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Format is the format of the data written, such as "jpeg" or "png",
+	// whatever the extension of the output
+	Format string `json:"format"`
+	// Bytes is the size of the output
+	Bytes int64 `json:"bytes"`
+	// Elapsed is the time the operation took, from decoding to writing
+	Elapsed time.Duration `json:"elapsed_ns"`
+}
+
+// WithResult fills in r once the operation has succeeded, so callers learn
+// the final size of an image resized to keep its aspect ratio, and what was
+// written, without decoding the output again. The dimensions are read from
+// the header of the output. It is accepted by the functions with the suffix
+// With that write a file or a writer, such as ResizeImageWith and
+// BinarizeImageReaderWith, and by ConcatenateImagesVerticallyStream and
+// ConcatenateImagesVerticallyPNG; r is left as is when the operation fails.
+func WithResult(r *Result) Option {
+	return func(s *settings) {
+		s.result = r
+	}
+}
+
+// resultHeaderSize is the most of an output kept for reading its header;
+// the encoders of the package write the dimensions within the first few
+// hundred bytes
+const resultHeaderSize = 4 << 10
+
+// recordFile fills in the result set by WithResult from the file written to
+// path, when err shows the operation succeeded, and returns err
+func (s *settings) recordFile(path string, err error) error {
+	if err != nil || s.result == nil {
+		return err
+	}
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return &ErrInvalidOutput{Path: path, Err: openErr}
+	}
+	defer file.Close()
+	info, statErr := file.Stat()
+	if statErr != nil {
+		return &ErrInvalidOutput{Path: path, Err: statErr}
+	}
+	header := make([]byte, resultHeaderSize)
+	n, _ := io.ReadFull(file, header)
+	s.fillResult(header[:n], info.Size())
+	return nil
+}
+
+// countOutput returns w, wrapped to keep track of what is written to it when
+// a result is wanted
+func (s *settings) countOutput(w io.Writer) io.Writer {
+	if s.result == nil {
+		return w
+	}
+	return &countingWriter{w: w}
+}
+
+// recordOutput fills in the result set by WithResult from the writer
+// returned by countOutput, when err shows the operation succeeded, and
+// returns err
+func (s *settings) recordOutput(w io.Writer, err error) error {
+	if cw, ok := w.(*countingWriter); ok && err == nil && s.result != nil {
+		s.fillResult(cw.header, cw.n)
+	}
+	return err
+}
+
+// fillResult fills in the result from the header and size of the output
+func (s *settings) fillResult(header []byte, size int64) {
+	*s.result = Result{
+		Format:  sniffFormat(header),
+		Bytes:   size,
+		Elapsed: time.Since(s.start),
+	}
+	if config, _, err := image.DecodeConfig(bytes.NewReader(header)); err == nil {
+		s.result.Width, s.result.Height = config.Width, config.Height
+	}
+}
+
+// countingWriter counts the bytes written to w and keeps the first of them
+type countingWriter struct {
+	w      io.Writer
+	n      int64
+	header []byte
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if keep := min(len(p), resultHeaderSize-len(c.header)); keep > 0 {
+		c.header = append(c.header, p[:keep]...)
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
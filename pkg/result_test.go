@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithResult(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	inputPath := writeTestImage(t, testDir, "test_input_result.png", tiledTestImage(200, 100), encodePNGBuffer)
+
+	for _, tt := range []struct {
+		name       string
+		output     string
+		opts       []Option
+		wantFormat string
+	}{
+		{"jpeg", "test_output_result.jpg", nil, FormatJPEG},
+		{"tiled png", "test_output_result.png", []Option{WithTiled()}, FormatPNG},
+	} {
+		outputPath := filepath.Join(testDir, tt.output)
+		var result Result
+		// The height follows from the width, keeping the aspect ratio
+		if err := ResizeImageWith(inputPath, outputPath, 50, 0, append(tt.opts, WithResult(&result))...); err != nil {
+			t.Fatalf("%s: failed to resize: %v", tt.name, err)
+		}
+		info, err := os.Stat(outputPath)
+		if err != nil {
+			t.Fatalf("%s: failed to stat the output: %v", tt.name, err)
+		}
+		if result.Width != 50 || result.Height != 25 || result.Format != tt.wantFormat || result.Bytes != info.Size() || result.Elapsed <= 0 {
+			t.Errorf("%s: expected a 50x25 %s of %d bytes, got %+v", tt.name, tt.wantFormat, info.Size(), result)
+		}
+	}
+
+	input, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read the input: %v", err)
+	}
+	var buf bytes.Buffer
+	var result Result
+	if err := BinarizeImageReaderWith(bytes.NewReader(input), &buf, WithResult(&result)); err != nil {
+		t.Fatalf("Failed to binarize: %v", err)
+	}
+	if result.Width != 200 || result.Height != 100 || result.Format != FormatJPEG || result.Bytes != int64(buf.Len()) {
+		t.Errorf("Expected a 200x100 JPEG of %d bytes, got %+v", buf.Len(), result)
+	}
+
+	// A failed operation leaves the result alone
+	result = Result{Format: "untouched"}
+	err = RotateImageWith(filepath.Join(testDir, "missing.png"), filepath.Join(testDir, "test_output_missing.jpg"), 90, WithResult(&result))
+	var invalid *ErrInvalidInput
+	if !errors.As(err, &invalid) || result.Format != "untouched" {
+		t.Errorf("Expected an invalid input and the result untouched, got %v and %+v", err, result)
+	}
+}
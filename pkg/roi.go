@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// ParseBox parses a rectangle written as x,y,width,height, such as
+// "10,20,300,200", or as a geometry, such as "300x200+10+20"
+func ParseBox(s string) (Box, error) {
+	if !strings.Contains(s, ",") {
+		g, err := ParseGeometry(s)
+		if err != nil {
+			return Box{}, fmt.Errorf("invalid region %q (want x,y,width,height or WxH+X+Y)", s)
+		}
+		r, err := g.Rect()
+		if err != nil {
+			return Box{}, fmt.Errorf("invalid region %q: %v", s, err)
+		}
+		return boxFromRect(r), nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return Box{}, fmt.Errorf("invalid region %q (want x,y,width,height)", s)
+	}
+	var values [4]int
+	for i, part := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return Box{}, fmt.Errorf("invalid region %q (want x,y,width,height)", s)
+		}
+		values[i] = v
+	}
+	if values[2] <= 0 || values[3] <= 0 {
+		return Box{}, fmt.Errorf("invalid region %q: width and height must be positive", s)
+	}
+	return Box{X: values[0], Y: values[1], Width: values[2], Height: values[3]}, nil
+}
+
+// RegionOperation processes a decoded region of an image, like Binarize or
+// Deblock, returning a result of the same size
+type RegionOperation func(img image.Image) (image.Image, error)
+
+// ApplyInRegion runs an operation on a rectangle of the input only, leaving
+// the rest of the image untouched. The region is passed to the operation as a
+// SubImage of the decoded input, in memory, and the result is drawn back in
+// place, so any operation that keeps the image size can be restricted to a
+// region without a manual crop and merge. The region is clipped to the image.
+// The output is encoded as its extension says, PNG for .png and JPEG for
+// .jpg, and otherwise in the format of the input: a PNG stays a lossless PNG
+// and anything else is saved as JPEG.
+// It takes the paths of the input and output files, the region and the operation.
+// Returns an error if the operation fails or changes the size of the region.
+func ApplyInRegion(inputPath string, outputPath string, region Box, operation RegionOperation) error {
+	slog.Info("applying operation in region",
+		"input", inputPath,
+		"region", region)
+
+	data, release, err := defaultProcessor.readInput(inputPath)
+	if err != nil {
+		return &ErrInvalidInput{Path: inputPath, Err: err}
+	}
+	defer release()
+	img, err := decodeImageData(data, inputPath)
+	if err != nil {
+		return err
+	}
+	format := extensionFormat(outputPath)
+	if format != FormatPNG && format != FormatJPEG {
+		format = sniffFormat(data)
+	}
+
+	bounds := img.Bounds()
+	rect := region.Rect().Add(bounds.Min).Intersect(bounds)
+	if rect.Empty() {
+		return &ErrProcessing{Op: "roi", Err: fmt.Errorf("region %v lies outside the %dx%d image", region, bounds.Dx(), bounds.Dy())}
+	}
+	// The result is drawn into the input when it holds any color, sharing its
+	// pixels with the sub-image; other images are copied to RGBA first
+	var result interface {
+		draw.Image
+		SubImage(r image.Rectangle) image.Image
+	}
+	switch img := img.(type) {
+	case *image.RGBA:
+		result = img
+	case *image.NRGBA:
+		result = img
+	case *image.RGBA64:
+		result = img
+	case *image.NRGBA64:
+		result = img
+	default:
+		result = toRGBA(img)
+		rect = rect.Sub(bounds.Min)
+	}
+	processed, err := operation(result.SubImage(rect))
+	if err != nil {
+		return err
+	}
+	if processed == nil || processed.Bounds().Dx() != rect.Dx() || processed.Bounds().Dy() != rect.Dy() {
+		size := image.Point{}
+		if processed != nil {
+			size = processed.Bounds().Size()
+		}
+		return &ErrProcessing{Op: "roi", Err: fmt.Errorf("operation changed the region size from %dx%d to %dx%d",
+			rect.Dx(), rect.Dy(), size.X, size.Y)}
+	}
+	draw.Draw(result, rect, processed, processed.Bounds().Min, draw.Src)
+
+	if format == FormatPNG {
+		return savePNG(outputPath, result)
+	}
+	return saveJPEG(outputPath, result)
+}
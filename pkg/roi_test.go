@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseBox(t *testing.T) {
+	box, err := ParseBox("10, 20,300,200")
+	if err != nil {
+		t.Fatalf("ParseBox failed: %v", err)
+	}
+	if box != (Box{X: 10, Y: 20, Width: 300, Height: 200}) {
+		t.Errorf("Unexpected box %+v", box)
+	}
+	for _, s := range []string{"", "1,2,3", "a,b,c,d", "0,0,0,10"} {
+		if _, err := ParseBox(s); err == nil {
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+}
+
+func TestApplyInRegion(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// A horizontal gray ramp: binarizing turns the region black and white
+	img := image.NewGray(image.Rect(0, 0, 100, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 100; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(40 + x*2)})
+		}
+	}
+	testInputPath := filepath.Join(testDir, "test_input_roi.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_roi.jpg")
+	if err := saveJPEG(testInputPath, img); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+
+	binarize := func(img image.Image) (image.Image, error) { return Binarize(img), nil }
+	region := Box{X: 20, Y: 20, Width: 60, Height: 40}
+	if err := ApplyInRegion(testInputPath, testOutputPath, region, binarize); err != nil {
+		t.Fatalf("ApplyInRegion failed: %v", err)
+	}
+	out, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load output: %v", err)
+	}
+	if out.Bounds() != img.Bounds() {
+		t.Fatalf("Expected bounds %v, got %v", img.Bounds(), out.Bounds())
+	}
+	gray := toGray(out)
+	// Outside the region the ramp is kept
+	if v := gray.GrayAt(5, 5).Y; v < 30 || v > 70 {
+		t.Errorf("Expected the ramp outside the region, got %d", v)
+	}
+	// Inside, mid-gray pixels have become black or white
+	if v := gray.GrayAt(50, 40).Y; v > 40 && v < 215 {
+		t.Errorf("Expected a binarized pixel inside the region, got %d", v)
+	}
+
+	resize := func(img image.Image) (image.Image, error) { return Resize(img, 10, 10) }
+	if err := ApplyInRegion(testInputPath, testOutputPath, region, resize); err == nil {
+		t.Error("Expected an error for an operation that changes the size")
+	}
+	if err := ApplyInRegion(testInputPath, testOutputPath, Box{X: 500, Y: 500, Width: 10, Height: 10}, binarize); err == nil {
+		t.Error("Expected an error for a region outside the image")
+	}
+}
+
+func TestApplyInRegionPNG(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 6), uint8(y * 8), 90, 255})
+		}
+	}
+	testInputPath := filepath.Join(testDir, "test_input_roi.png")
+	if err := savePNG(testInputPath, img); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+
+	// The operation sees the region of the input, not a copy at the origin
+	region := Box{X: 10, Y: 5, Width: 20, Height: 10}
+	var seen image.Rectangle
+	invert := func(img image.Image) (image.Image, error) {
+		seen = img.Bounds()
+		inverted, _ := InvertNegative(img, NegativeOptions{Base: color.RGBA{255, 255, 255, 255}})
+		return inverted, nil
+	}
+	// Without an image extension the output keeps the format of the input
+	testOutputPath := filepath.Join(testDir, "test_output_roi")
+	if err := ApplyInRegion(testInputPath, testOutputPath, region, invert); err != nil {
+		t.Fatalf("ApplyInRegion failed: %v", err)
+	}
+	if seen != region.Rect() {
+		t.Errorf("Expected the operation to get %v, got %v", region.Rect(), seen)
+	}
+	if format, err := DetectFormat(testOutputPath); err != nil || format != FormatPNG {
+		t.Fatalf("Expected a PNG output, got %q, %v", format, err)
+	}
+	out, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load output: %v", err)
+	}
+	// Outside the region the pixels are kept exactly
+	if got, want := color.NRGBAModel.Convert(out.At(2, 2)), img.At(2, 2); got != want {
+		t.Errorf("Expected %v outside the region, got %v", want, got)
+	}
+	if got := color.NRGBAModel.Convert(out.At(15, 8)); got == img.At(15, 8) {
+		t.Errorf("Expected the region to be processed, got %v", got)
+	}
+}
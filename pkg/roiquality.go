@@ -0,0 +1,327 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"math"
+)
+
+// defaultBackgroundQuality is the JPEG quality outside the regions kept sharp
+const defaultBackgroundQuality = 30
+
+// jpegLumaTable and jpegChromaTable are the quantization tables of Annex K of
+// the JPEG standard at quality 50, in natural order, which image/jpeg scales
+// for the other qualities
+var (
+	jpegLumaTable = [64]int{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	}
+	jpegChromaTable = [64]int{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	}
+)
+
+// dctCos holds the 8-point DCT basis: dctCos[u][x] = C(u)/2 cos((2x+1)uπ/16)
+var dctCos = func() (c [8][8]float64) {
+	for u := range c {
+		scale := 0.5
+		if u == 0 {
+			scale = math.Sqrt2 / 4
+		}
+		for x := range c[u] {
+			c[u][x] = scale * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return c
+}()
+
+// RegionQualityOptions controls EncodeRegionQuality
+type RegionQualityOptions struct {
+	// Regions are the rectangles kept at Quality, from the top left corner
+	// of the image
+	Regions []Box
+	// Text adds the lines found by DetectTextRegions to Regions
+	Text bool
+	// Margin is the number of pixels kept sharp around every region
+	Margin int
+	// Quality is the JPEG quality of the regions, 1-100; zero is the
+	// configured quality
+	Quality int
+	// BackgroundQuality is the quality the rest of the image is reduced to,
+	// 1-100; zero is defaultBackgroundQuality
+	BackgroundQuality int
+}
+
+// RegionQualityResult describes what EncodeRegionQuality kept sharp
+type RegionQualityResult struct {
+	// Regions are the regions kept at full quality, including detected text
+	Regions []Box `json:"regions"`
+	// Coverage is the fraction of the image kept at full quality, which is
+	// the regions rounded out to whole JPEG blocks
+	Coverage float64 `json:"coverage"`
+}
+
+// RegionQualityImage writes the input image as a JPEG that keeps some
+// regions, such as text or a region of interest, at high quality and
+// compresses the rest harder, as EncodeRegionQuality.
+// It takes the paths of the input and output files and the options.
+// Returns the regions kept sharp, or an error if the operation fails.
+func RegionQualityImage(inputPath string, outputPath string, opts RegionQualityOptions) (*RegionQualityResult, error) {
+	slog.Info("encoding with region quality",
+		"input", inputPath,
+		"output", outputPath,
+		"regions", len(opts.Regions),
+		"text", opts.Text)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	out, err := createOutput(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	result, err := EncodeRegionQuality(out, img, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result, out.Commit()
+}
+
+// RegionQualityImageReader encodes the image read from r to w like
+// RegionQualityImage.
+// Returns the regions kept sharp, or an error if the operation fails.
+func RegionQualityImageReader(r io.Reader, w io.Writer, opts RegionQualityOptions) (*RegionQualityResult, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeRegionQuality(w, img, opts)
+}
+
+// EncodeRegionQuality writes the image to w as a JPEG whose regions keep
+// opts.Quality while the rest is degraded to opts.BackgroundQuality. A
+// baseline JPEG has one set of quantization tables for the whole image, so
+// the blocks outside the regions are quantized with the tables of the lower
+// quality beforehand, the way the encoder would; their coefficients then
+// mostly round to zero in the final encoding at the high quality and cost
+// few bits. Document photos shrink without making their text unreadable.
+// Returns the regions kept sharp, or an error if a quality is out of range
+// or encoding fails.
+func EncodeRegionQuality(w io.Writer, img image.Image, opts RegionQualityOptions) (*RegionQualityResult, error) {
+	quality := opts.Quality
+	if quality == 0 {
+		quality = currentConfig().JpegQuality
+	}
+	background := opts.BackgroundQuality
+	if background == 0 {
+		background = defaultBackgroundQuality
+	}
+	switch {
+	case quality < 1 || quality > 100:
+		return nil, &ErrProcessing{Op: "roiquality", Err: fmt.Errorf("quality must be between 1 and 100, got %d", quality)}
+	case background < 1 || background > 100:
+		return nil, &ErrProcessing{Op: "roiquality", Err: fmt.Errorf("background quality must be between 1 and 100, got %d", background)}
+	case opts.Margin < 0:
+		return nil, &ErrProcessing{Op: "roiquality", Err: fmt.Errorf("margin must not be negative, got %d", opts.Margin)}
+	}
+
+	// image/jpeg writes grays as one 8x8-block component and colors with
+	// chroma subsampled 4:2:0, in 16x16 blocks
+	var out image.Image
+	var gray *image.Gray
+	var rgba *image.RGBA
+	blockSize := jpegBlockSize
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		// The copy is moved to the origin, where the regions are
+		gray = toGray(img)
+		gray.Rect = gray.Rect.Sub(gray.Rect.Min)
+		out = gray
+	default:
+		rgba = toRGBA(img)
+		blockSize = 2 * jpegBlockSize
+		out = rgba
+	}
+	size := out.Bounds().Size()
+
+	regions := append([]Box(nil), opts.Regions...)
+	if opts.Text {
+		textGray := gray
+		if textGray == nil {
+			textGray = toGray(rgba)
+		}
+		regions = append(regions, detectTextRegions(textGray).Lines...)
+	}
+
+	// A block is kept when any region, with its margin, touches it
+	cols, rows := (size.X+blockSize-1)/blockSize, (size.Y+blockSize-1)/blockSize
+	keep := make([]bool, cols*rows)
+	for _, region := range regions {
+		r := region.Rect().Inset(-opts.Margin).Intersect(out.Bounds())
+		if r.Empty() {
+			continue
+		}
+		for by := r.Min.Y / blockSize; by <= (r.Max.Y-1)/blockSize; by++ {
+			for bx := r.Min.X / blockSize; bx <= (r.Max.X-1)/blockSize; bx++ {
+				keep[by*cols+bx] = true
+			}
+		}
+	}
+	luma, chroma := scaledQuantTable(jpegLumaTable, background), scaledQuantTable(jpegChromaTable, background)
+	kept := 0
+	for by := 0; by < rows; by++ {
+		for bx := 0; bx < cols; bx++ {
+			if keep[by*cols+bx] {
+				block := image.Rect(bx*blockSize, by*blockSize, (bx+1)*blockSize, (by+1)*blockSize).Intersect(out.Bounds())
+				kept += block.Dx() * block.Dy()
+			} else if gray != nil {
+				requantizeBlock(gray.Pix, gray.Stride, size, image.Pt(bx*blockSize, by*blockSize), luma)
+			} else {
+				requantizeColorBlock(rgba, image.Pt(bx*blockSize, by*blockSize), luma, chroma)
+			}
+		}
+	}
+
+	if err := encodeJPEGQuality(w, out, quality); err != nil {
+		return nil, err
+	}
+	result := &RegionQualityResult{Regions: regions}
+	if size.X > 0 && size.Y > 0 {
+		result.Coverage = float64(kept) / float64(size.X*size.Y)
+	}
+	return result, nil
+}
+
+// requantizeColorBlock passes the 16x16 block of rgba at pt through the
+// quantization tables luma and chroma: its four luma blocks and its two
+// chroma blocks, averaged over 2x2 pixels as image/jpeg does
+func requantizeColorBlock(rgba *image.RGBA, pt image.Point, luma, chroma [64]int) {
+	block := image.Rectangle{Min: pt, Max: pt.Add(image.Pt(2*jpegBlockSize, 2*jpegBlockSize))}.Intersect(rgba.Bounds())
+	var y [256]uint8
+	var cb, cr [64]uint8
+	var cbSum, crSum, count [64]int
+	for py := block.Min.Y; py < block.Max.Y; py++ {
+		for px := block.Min.X; px < block.Max.X; px++ {
+			i := rgba.PixOffset(px, py)
+			yy, b, r := color.RGBToYCbCr(rgba.Pix[i], rgba.Pix[i+1], rgba.Pix[i+2])
+			y[(py-pt.Y)*16+px-pt.X] = yy
+			c := (py-pt.Y)/2*8 + (px-pt.X)/2
+			cbSum[c] += int(b)
+			crSum[c] += int(r)
+			count[c]++
+		}
+	}
+	for c := range count {
+		if count[c] > 0 {
+			cb[c] = uint8((cbSum[c] + count[c]/2) / count[c])
+			cr[c] = uint8((crSum[c] + count[c]/2) / count[c])
+		}
+	}
+
+	blockSize := block.Size()
+	for _, sub := range []image.Point{{0, 0}, {8, 0}, {0, 8}, {8, 8}} {
+		requantizeBlock(y[:], 16, blockSize, sub, luma)
+	}
+	chromaSize := image.Pt((blockSize.X+1)/2, (blockSize.Y+1)/2)
+	requantizeBlock(cb[:], 8, chromaSize, image.Point{}, chroma)
+	requantizeBlock(cr[:], 8, chromaSize, image.Point{}, chroma)
+
+	for py := block.Min.Y; py < block.Max.Y; py++ {
+		for px := block.Min.X; px < block.Max.X; px++ {
+			c := (py-pt.Y)/2*8 + (px-pt.X)/2
+			i := rgba.PixOffset(px, py)
+			rgba.Pix[i], rgba.Pix[i+1], rgba.Pix[i+2] = color.YCbCrToRGB(y[(py-pt.Y)*16+px-pt.X], cb[c], cr[c])
+		}
+	}
+}
+
+// requantizeBlock replaces the 8x8 block at pt of a plane of the given size
+// with its DCT quantized by table and transformed back. Pixels past the edge
+// of the plane repeat the last row and column, as the encoder pads them.
+func requantizeBlock(pix []uint8, stride int, size image.Point, pt image.Point, table [64]int) {
+	if pt.X >= size.X || pt.Y >= size.Y {
+		return
+	}
+	var f [8][8]float64
+	for y := 0; y < 8; y++ {
+		sy := min(pt.Y+y, size.Y-1)
+		for x := 0; x < 8; x++ {
+			sx := min(pt.X+x, size.X-1)
+			f[y][x] = float64(pix[sy*stride+sx]) - 128
+		}
+	}
+
+	// Rows, then columns
+	var tmp, coef [8][8]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for x := 0; x < 8; x++ {
+				s += dctCos[u][x] * f[y][x]
+			}
+			tmp[y][u] = s
+		}
+	}
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for y := 0; y < 8; y++ {
+				s += dctCos[v][y] * tmp[y][u]
+			}
+			q := float64(table[v*8+u])
+			coef[v][u] = math.Round(s/q) * q
+		}
+	}
+
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for v := 0; v < 8; v++ {
+				s += dctCos[v][y] * coef[v][u]
+			}
+			tmp[y][u] = s
+		}
+	}
+	for y := 0; y < 8 && pt.Y+y < size.Y; y++ {
+		for x := 0; x < 8 && pt.X+x < size.X; x++ {
+			var s float64
+			for u := 0; u < 8; u++ {
+				s += dctCos[u][x] * tmp[y][u]
+			}
+			pix[(pt.Y+y)*stride+pt.X+x] = uint8(min(max(math.Round(s+128), 0), 255))
+		}
+	}
+}
+
+// scaledQuantTable scales a quantization table to a JPEG quality the way
+// image/jpeg and libjpeg do
+func scaledQuantTable(base [64]int, quality int) [64]int {
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	var table [64]int
+	for i, v := range base {
+		table[i] = min(max((v*scale+50)/100, 1), 255)
+	}
+	return table
+}
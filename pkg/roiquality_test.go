@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// texturedTestImage is an opaque color gradient with grain, which costs a
+// JPEG encoder many bits at high quality
+func texturedTestImage(w, h int) *image.RGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			grain := rng.Intn(40)
+			img.SetRGBA(x, y, color.RGBA{uint8(x*200/w + grain), uint8(y*200/h + grain), uint8(100 + grain), 0xff})
+		}
+	}
+	return img
+}
+
+func TestEncodeRegionQuality(t *testing.T) {
+	img := texturedTestImage(128, 96)
+	region := Box{X: 16, Y: 16, Width: 32, Height: 32}
+
+	var plain, selective bytes.Buffer
+	if err := encodeJPEGQuality(&plain, img, 90); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	result, err := EncodeRegionQuality(&selective, img, RegionQualityOptions{Regions: []Box{region}, Quality: 90, BackgroundQuality: 20})
+	if err != nil {
+		t.Fatalf("EncodeRegionQuality failed: %v", err)
+	}
+	if selective.Len() >= plain.Len()*3/4 {
+		t.Errorf("Expected a much smaller file than %d bytes, got %d", plain.Len(), selective.Len())
+	}
+	if want := float64(32*32) / float64(128*96); result.Coverage != want {
+		t.Errorf("Expected a coverage of %g for a region on the block grid, got %g", want, result.Coverage)
+	}
+
+	// The region decodes as it does from the plain encoding, the rest does not
+	plainImg, _ := jpeg.Decode(&plain)
+	selectiveImg, err := jpeg.Decode(&selective)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	diff := func(r image.Rectangle) float64 {
+		var sum float64
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				a, _, _, _ := plainImg.At(x, y).RGBA()
+				b, _, _, _ := selectiveImg.At(x, y).RGBA()
+				sum += float64(absDiff(uint8(a>>8), uint8(b>>8)))
+			}
+		}
+		return sum / float64(r.Dx()*r.Dy())
+	}
+	if d := diff(region.Rect().Inset(4)); d > 1 {
+		t.Errorf("Expected the region to stay as sharp as the plain encoding, mean difference %.2f", d)
+	}
+	if d := diff(image.Rect(64, 48, 128, 96)); d < 3 {
+		t.Errorf("Expected the background to be compressed harder, mean difference %.2f", d)
+	}
+
+	// Grays keep a single component
+	var gray bytes.Buffer
+	if _, err := EncodeRegionQuality(&gray, toGray(img), RegionQualityOptions{Regions: []Box{region}}); err != nil {
+		t.Fatalf("EncodeRegionQuality failed on a gray image: %v", err)
+	}
+	if decoded, err := jpeg.Decode(&gray); err != nil {
+		t.Errorf("Failed to decode the gray output: %v", err)
+	} else if _, ok := decoded.(*image.Gray); !ok {
+		t.Errorf("Expected a gray JPEG, got %T", decoded)
+	}
+
+	for _, opts := range []RegionQualityOptions{{Quality: 101}, {BackgroundQuality: -1}, {Margin: -2}} {
+		if _, err := EncodeRegionQuality(&bytes.Buffer{}, img, opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	input := writeTestImage(t, testDir, "test_input.png", img, encodePNGBuffer)
+	output := filepath.Join(testDir, "test_output.jpg")
+	if _, err := RegionQualityImage(input, output, RegionQualityOptions{Regions: []Box{region}, Margin: 4}); err != nil {
+		t.Fatalf("RegionQualityImage failed: %v", err)
+	}
+	if got := decodeTestFile(t, output).Bounds(); got != img.Bounds() {
+		t.Errorf("Expected the size of the input, got %v", got)
+	}
+}
+
+func TestScaledQuantTable(t *testing.T) {
+	if got := scaledQuantTable(jpegLumaTable, 50); got != jpegLumaTable {
+		t.Error("Expected the base table at quality 50")
+	}
+	if got := scaledQuantTable(jpegLumaTable, 100); got[0] != 1 || got[63] != 1 {
+		t.Errorf("Expected ones at quality 100, got %d and %d", got[0], got[63])
+	}
+}
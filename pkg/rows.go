@@ -0,0 +1,616 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"slices"
+
+	// TIFFs that tiffRows cannot read incrementally are decoded whole
+	_ "golang.org/x/image/tiff"
+	"golang.org/x/image/tiff/lzw"
+)
+
+// rowReader yields the pixels of an image one row at a time, from top to
+// bottom, so the tiled operations hold a few rows instead of the whole image
+type rowReader interface {
+	// size is the width and height of the image
+	size() image.Point
+	// readRow reads the next row into row as premultiplied 16-bit RGBA, four
+	// samples per pixel in the order of color.RGBA64
+	readRow(row []uint16) error
+	// Close releases the input
+	Close() error
+}
+
+// errNotIncremental is returned by the incremental decoders for images they
+// cannot read row by row, which are then decoded whole
+var errNotIncremental = errors.New("not readable row by row")
+
+// openRows opens the image at path for reading row by row. Non-interlaced
+// PNGs and TIFFs stored in strips or tiles of 8 or 16-bit samples, without
+// compression or compressed with LZW or Deflate, are decoded incrementally.
+// Other images, including JPEGs, whose decoder has no incremental mode, are
+// decoded whole first.
+func (p *Processor) openRows(path string) (rowReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, &ErrInvalidInput{Path: path, Err: err}
+	}
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(f, header)
+
+	var rows rowReader
+	switch sniffFormat(header[:n]) {
+	case FormatPNG:
+		if _, err = f.Seek(0, io.SeekStart); err == nil {
+			rows, err = newPNGRows(f)
+		}
+	case FormatTIFF:
+		rows, err = newTIFFRows(f)
+	default:
+		err = errNotIncremental
+	}
+	switch {
+	case err == nil:
+		return rows, nil
+	case !errors.Is(err, errNotIncremental):
+		f.Close()
+		return nil, &ErrProcessing{Op: "decode", Err: err}
+	}
+	f.Close()
+
+	p.logger().Info("decoding the whole image, it cannot be read row by row", "input", path)
+	img, err := p.loadImage(path)
+	if err != nil {
+		return nil, err
+	}
+	return &imageRows{img: img}, nil
+}
+
+// imageRows reads the rows of a decoded image
+type imageRows struct {
+	img image.Image
+	y   int
+}
+
+func (r *imageRows) size() image.Point {
+	return r.img.Bounds().Size()
+}
+
+func (r *imageRows) readRow(row []uint16) error {
+	bounds := r.img.Bounds()
+	if r.y >= bounds.Dy() {
+		return io.ErrUnexpectedEOF
+	}
+	y := bounds.Min.Y + r.y
+	for x := 0; x < bounds.Dx(); x++ {
+		cr, cg, cb, ca := r.img.At(bounds.Min.X+x, y).RGBA()
+		row[4*x], row[4*x+1], row[4*x+2], row[4*x+3] = uint16(cr), uint16(cg), uint16(cb), uint16(ca)
+	}
+	r.y++
+	return nil
+}
+
+func (r *imageRows) Close() error {
+	return nil
+}
+
+// pngRows decodes a non-interlaced PNG one scanline at a time
+type pngRows struct {
+	f   io.Closer
+	hdr pngHeader
+	// key is the transparent color of gray and RGB images, from tRNS
+	key    []uint16
+	zr     io.ReadCloser
+	line   []byte
+	prev   []byte
+	bpp    int
+	sample []uint16
+}
+
+func newPNGRows(f *os.File) (*pngRows, error) {
+	br := bufio.NewReader(f)
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(br, signature); err != nil || string(signature) != pngSignature {
+		return nil, errors.New("not a PNG")
+	}
+
+	r := &pngRows{f: f}
+	var trns []byte
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(br, chunk[:]); err != nil {
+			return nil, fmt.Errorf("reading PNG chunks: %w", err)
+		}
+		length, name := int64(binary.BigEndian.Uint32(chunk[:4])), string(chunk[4:])
+		if name == "IDAT" {
+			// The image data is inflated as the rows are read
+			idat := &idatReader{r: br, remaining: length}
+			zr, err := zlib.NewReader(idat)
+			if err != nil {
+				return nil, fmt.Errorf("reading PNG data: %w", err)
+			}
+			r.zr = zr
+			break
+		}
+		if length > 1<<20 {
+			// Ancillary chunks are skipped unread
+			if _, err := br.Discard(int(length) + 4); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data := make([]byte, length+4)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, fmt.Errorf("reading PNG chunks: %w", err)
+		}
+		data = data[:length]
+		switch name {
+		case "IHDR":
+			if len(data) != 13 {
+				return nil, errors.New("invalid PNG header")
+			}
+			r.hdr = pngHeader{
+				width:     int(binary.BigEndian.Uint32(data[0:4])),
+				height:    int(binary.BigEndian.Uint32(data[4:8])),
+				bitDepth:  data[8],
+				colorType: data[9],
+				interlace: data[12] != 0,
+			}
+			if r.hdr.interlace {
+				return nil, errNotIncremental
+			}
+		case "PLTE":
+			for i := 0; i+2 < len(data); i += 3 {
+				r.hdr.palette = append(r.hdr.palette, color.NRGBA{data[i], data[i+1], data[i+2], 255})
+			}
+		case "tRNS":
+			trns = data
+		}
+	}
+
+	hdr := r.hdr
+	if hdr.width <= 0 || hdr.height <= 0 {
+		return nil, errors.New("invalid PNG size")
+	}
+	switch hdr.colorType {
+	case pngColorPalette:
+		// Indices beyond the palette are opaque black, as in image/png
+		for len(r.hdr.palette) < 256 {
+			r.hdr.palette = append(r.hdr.palette, color.NRGBA{A: 255})
+		}
+		for i, a := range trns[:min(len(trns), 256)] {
+			c := r.hdr.palette[i].(color.NRGBA)
+			c.A = a
+			r.hdr.palette[i] = c
+		}
+	case pngColorGray, pngColorRGB:
+		for i := 0; i+1 < len(trns) && len(r.key) < hdr.channels(); i += 2 {
+			r.key = append(r.key, binary.BigEndian.Uint16(trns[i:]))
+		}
+	}
+
+	bitsPerPixel := hdr.channels() * int(hdr.bitDepth)
+	r.line = make([]byte, 1+(hdr.width*bitsPerPixel+7)/8)
+	r.prev = make([]byte, len(r.line)-1)
+	r.bpp = max(1, bitsPerPixel/8)
+	r.sample = make([]uint16, hdr.channels())
+	return r, nil
+}
+
+func (r *pngRows) size() image.Point {
+	return image.Pt(r.hdr.width, r.hdr.height)
+}
+
+func (r *pngRows) readRow(row []uint16) error {
+	if _, err := io.ReadFull(r.zr, r.line); err != nil {
+		return fmt.Errorf("reading PNG data: %w", err)
+	}
+	cur := r.line[1:]
+	if err := unfilterPNGRow(r.line[0], cur, r.prev, r.bpp); err != nil {
+		return err
+	}
+
+	hdr := r.hdr
+	depth := int(hdr.bitDepth)
+	maxValue := uint32(1)<<depth - 1
+	bit := 0
+	for x := 0; x < hdr.width; x++ {
+		for c := range r.sample {
+			switch depth {
+			case 16:
+				r.sample[c] = binary.BigEndian.Uint16(cur[bit/8:])
+			case 8:
+				r.sample[c] = uint16(cur[bit/8])
+			default:
+				r.sample[c] = uint16(cur[bit/8]>>(8-depth-bit%8)) & uint16(maxValue)
+			}
+			bit += depth
+		}
+		px := row[4*x : 4*x+4]
+		if hdr.colorType == pngColorPalette {
+			cr, cg, cb, ca := hdr.palette[r.sample[0]].RGBA()
+			px[0], px[1], px[2], px[3] = uint16(cr), uint16(cg), uint16(cb), uint16(ca)
+			continue
+		}
+		// Scale the samples to 16 bits
+		var v [4]uint16
+		for c, s := range r.sample {
+			v[c] = uint16(uint32(s) * 0xffff / maxValue)
+		}
+		var n color.NRGBA64
+		switch hdr.colorType {
+		case pngColorGray:
+			n = color.NRGBA64{v[0], v[0], v[0], 0xffff}
+		case pngColorGrayAlpha:
+			n = color.NRGBA64{v[0], v[0], v[0], v[1]}
+		case pngColorRGB:
+			n = color.NRGBA64{v[0], v[1], v[2], 0xffff}
+		case pngColorRGBA:
+			n = color.NRGBA64{v[0], v[1], v[2], v[3]}
+		}
+		if len(r.key) == len(r.sample) && slices.Equal(r.key, r.sample) {
+			n.A = 0
+		}
+		cr, cg, cb, ca := n.RGBA()
+		px[0], px[1], px[2], px[3] = uint16(cr), uint16(cg), uint16(cb), uint16(ca)
+	}
+	copy(r.prev, cur)
+	return nil
+}
+
+func (r *pngRows) Close() error {
+	r.zr.Close()
+	return r.f.Close()
+}
+
+// unfilterPNGRow reverses the PNG filter of a scanline in place, given the
+// previous scanline, already unfiltered
+func unfilterPNGRow(filter byte, cur, prev []byte, bpp int) error {
+	switch filter {
+	case 0:
+	case 1:
+		for i := bpp; i < len(cur); i++ {
+			cur[i] += cur[i-bpp]
+		}
+	case 2:
+		for i := range cur {
+			cur[i] += prev[i]
+		}
+	case 3:
+		for i := range cur {
+			var a byte
+			if i >= bpp {
+				a = cur[i-bpp]
+			}
+			cur[i] += byte((int(a) + int(prev[i])) / 2)
+		}
+	case 4:
+		for i := range cur {
+			var a, c byte
+			if i >= bpp {
+				a, c = cur[i-bpp], prev[i-bpp]
+			}
+			cur[i] += paeth(a, prev[i], c)
+		}
+	default:
+		return fmt.Errorf("invalid PNG filter %d", filter)
+	}
+	return nil
+}
+
+// idatReader reads the data of consecutive IDAT chunks as one stream
+type idatReader struct {
+	r         *bufio.Reader
+	remaining int64
+}
+
+func (d *idatReader) Read(p []byte) (int, error) {
+	for d.remaining == 0 {
+		// Skip the CRC and continue with the next chunk if it is an IDAT
+		var chunk [12]byte
+		if _, err := io.ReadFull(d.r, chunk[:]); err != nil {
+			return 0, err
+		}
+		if string(chunk[8:]) != "IDAT" {
+			return 0, io.EOF
+		}
+		d.remaining = int64(binary.BigEndian.Uint32(chunk[4:8]))
+	}
+	if int64(len(p)) > d.remaining {
+		p = p[:d.remaining]
+	}
+	n, err := d.r.Read(p)
+	d.remaining -= int64(n)
+	return n, err
+}
+
+// TIFF tags read by tiffRows
+const (
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagPhotometric     = 262
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagStripByteCounts = 279
+	tiffTagPlanarConfig    = 284
+	tiffTagPredictor       = 317
+	tiffTagTileWidth       = 322
+	tiffTagTileLength      = 323
+	tiffTagTileOffsets     = 324
+	tiffTagTileByteCounts  = 325
+	tiffTagExtraSamples    = 338
+)
+
+// tiffRows decodes a TIFF one band of strips or tiles at a time. A strip is
+// handled as a tile as wide as the image.
+type tiffRows struct {
+	f             *os.File
+	order         binary.ByteOrder
+	width, height int
+	// tileW and tileH are the size of a strip or tile
+	tileW, tileH int
+	offsets      []uint32
+	counts       []uint32
+	compression  uint32
+	predictor    uint32
+	photometric  uint32
+	samples      int
+	depth        int
+	// alpha is 0 without alpha, 1 for premultiplied and 2 for straight alpha
+	alpha int
+	// band holds the decoded rows of the current band of tiles
+	band      []byte
+	bandStart int
+	bandRows  int
+	y         int
+}
+
+func newTIFFRows(f *os.File) (*tiffRows, error) {
+	var header [8]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if string(header[:2]) == "MM" {
+		order = binary.BigEndian
+	}
+	tags, err := readTIFFIFD(f, order, order.Uint32(header[4:8]))
+	if err != nil {
+		return nil, err
+	}
+	value := func(tag uint16, def uint32) uint32 {
+		if v, ok := tags[tag]; ok {
+			return v.uint(order)
+		}
+		return def
+	}
+
+	r := &tiffRows{
+		f:           f,
+		order:       order,
+		width:       int(value(tiffTagImageWidth, 0)),
+		height:      int(value(tiffTagImageLength, 0)),
+		compression: value(tiffTagCompression, 1),
+		predictor:   value(tiffTagPredictor, 1),
+		photometric: value(tiffTagPhotometric, 1),
+		samples:     int(value(tiffTagSamplesPerPixel, 1)),
+		depth:       int(value(tiffTagBitsPerSample, 1)),
+	}
+	if r.width <= 0 || r.height <= 0 {
+		return nil, errors.New("invalid TIFF size")
+	}
+	if v, ok := tags[tiffTagBitsPerSample]; ok {
+		// Every sample must have the same depth
+		for _, d := range v.uints(order) {
+			if int(d) != r.depth {
+				return nil, errNotIncremental
+			}
+		}
+	}
+	if _, tiled := tags[tiffTagTileOffsets]; tiled {
+		r.tileW, r.tileH = int(value(tiffTagTileWidth, 0)), int(value(tiffTagTileLength, 0))
+		r.offsets, r.counts = tags[tiffTagTileOffsets].uints(order), tags[tiffTagTileByteCounts].uints(order)
+	} else {
+		r.tileW, r.tileH = r.width, min(int(value(tiffTagRowsPerStrip, uint32(r.height))), r.height)
+		r.offsets, r.counts = tags[tiffTagStripOffsets].uints(order), tags[tiffTagStripByteCounts].uints(order)
+	}
+
+	colors := 1
+	if r.photometric == 2 {
+		colors = 3
+	}
+	switch {
+	case r.photometric > 2, r.depth != 8 && r.depth != 16,
+		r.samples < colors || r.samples > colors+1,
+		value(tiffTagPlanarConfig, 1) != 1, r.predictor != 1 && r.predictor != 2,
+		r.compression != 1 && r.compression != 5 && r.compression != 8 && r.compression != 32946,
+		r.tileW <= 0 || r.tileH <= 0:
+		return nil, errNotIncremental
+	}
+	if r.samples > colors {
+		r.alpha = int(value(tiffTagExtraSamples, 2))
+	}
+	across := (r.width + r.tileW - 1) / r.tileW
+	down := (r.height + r.tileH - 1) / r.tileH
+	if len(r.offsets) < across*down || len(r.counts) < across*down {
+		return nil, errors.New("missing TIFF strips or tiles")
+	}
+	return r, nil
+}
+
+// readTIFFIFD reads the entries of the IFD at offset from r, reading the
+// values stored elsewhere in the file on the way
+func readTIFFIFD(r io.ReaderAt, order binary.ByteOrder, offset uint32) (map[uint16]exifValue, error) {
+	var count [2]byte
+	if _, err := r.ReadAt(count[:], int64(offset)); err != nil {
+		return nil, fmt.Errorf("reading TIFF directory: %w", err)
+	}
+	entries := make([]byte, 12*int(order.Uint16(count[:])))
+	if _, err := r.ReadAt(entries, int64(offset)+2); err != nil {
+		return nil, fmt.Errorf("reading TIFF directory: %w", err)
+	}
+	tags := make(map[uint16]exifValue)
+	for pos := 0; pos < len(entries); pos += 12 {
+		entry := entries[pos : pos+12]
+		typ := order.Uint16(entry[2:4])
+		size := int64(order.Uint32(entry[4:8])) * int64(exifTypeSize(typ))
+		data := entry[8:12]
+		switch {
+		case size > 1<<26:
+			return nil, errors.New("TIFF directory entry too large")
+		case size > 4:
+			data = make([]byte, size)
+			if _, err := r.ReadAt(data, int64(order.Uint32(entry[8:12]))); err != nil {
+				return nil, fmt.Errorf("reading TIFF directory: %w", err)
+			}
+		default:
+			data = data[:size]
+		}
+		tags[order.Uint16(entry[0:2])] = exifValue{typ: typ, data: data}
+	}
+	return tags, nil
+}
+
+func (r *tiffRows) size() image.Point {
+	return image.Pt(r.width, r.height)
+}
+
+// pixelBytes is the size in bytes of a pixel
+func (r *tiffRows) pixelBytes() int {
+	return r.samples * r.depth / 8
+}
+
+// readBand decodes the band of tiles holding row y
+func (r *tiffRows) readBand(y int) error {
+	across := (r.width + r.tileW - 1) / r.tileW
+	bandIndex := y / r.tileH
+	r.bandStart = bandIndex * r.tileH
+	r.bandRows = min(r.tileH, r.height-r.bandStart)
+	stride := r.width * r.pixelBytes()
+	if len(r.band) < r.tileH*stride {
+		r.band = make([]byte, r.tileH*stride)
+	}
+
+	tileStride := r.tileW * r.pixelBytes()
+	for i := 0; i < across; i++ {
+		index := bandIndex*across + i
+		tile, err := r.readTile(r.offsets[index], r.counts[index])
+		if err != nil {
+			return err
+		}
+		// A strip may stop after the last row of the image, a tile is
+		// always complete and may extend past the edges
+		x0 := i * r.tileW * r.pixelBytes()
+		width := min(tileStride, stride-x0)
+		for row := 0; row < r.bandRows; row++ {
+			start := row * tileStride
+			if start+tileStride > len(tile) {
+				return errors.New("TIFF strip or tile too short")
+			}
+			line := tile[start : start+tileStride]
+			if r.predictor == 2 {
+				r.undoPredictor(line)
+			}
+			copy(r.band[row*stride+x0:][:width], line)
+		}
+	}
+	return nil
+}
+
+// readTile reads and decompresses a strip or tile
+func (r *tiffRows) readTile(offset, count uint32) ([]byte, error) {
+	compressed := io.NewSectionReader(r.f, int64(offset), int64(count))
+	var src io.Reader = compressed
+	switch r.compression {
+	case 5:
+		lr := lzw.NewReader(compressed, lzw.MSB, 8)
+		defer lr.Close()
+		src = lr
+	case 8, 32946:
+		zr, err := zlib.NewReader(compressed)
+		if err != nil {
+			return nil, fmt.Errorf("reading TIFF data: %w", err)
+		}
+		defer zr.Close()
+		src = zr
+	}
+	var buf bytes.Buffer
+	buf.Grow(r.tileW * r.tileH * r.pixelBytes())
+	if _, err := io.Copy(&buf, io.LimitReader(src, int64(r.tileW*r.tileH*r.pixelBytes()))); err != nil {
+		return nil, fmt.Errorf("reading TIFF data: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// undoPredictor reverses the horizontal differencing of a row of a tile
+func (r *tiffRows) undoPredictor(line []byte) {
+	if r.depth == 8 {
+		for i := r.samples; i < len(line); i++ {
+			line[i] += line[i-r.samples]
+		}
+		return
+	}
+	for i := 2 * r.samples; i+1 < len(line); i += 2 {
+		v := r.order.Uint16(line[i:]) + r.order.Uint16(line[i-2*r.samples:])
+		r.order.PutUint16(line[i:], v)
+	}
+}
+
+func (r *tiffRows) readRow(row []uint16) error {
+	if r.y >= r.height {
+		return io.ErrUnexpectedEOF
+	}
+	if r.bandRows == 0 || r.y >= r.bandStart+r.bandRows {
+		if err := r.readBand(r.y); err != nil {
+			return err
+		}
+	}
+	line := r.band[(r.y-r.bandStart)*r.width*r.pixelBytes():]
+	sample := func(i int) uint16 {
+		if r.depth == 16 {
+			return r.order.Uint16(line[2*i:])
+		}
+		return uint16(line[i]) * 0x101
+	}
+	for x := 0; x < r.width; x++ {
+		i := x * r.samples
+		var c [4]uint16
+		c[3] = 0xffff
+		if r.photometric == 2 {
+			c[0], c[1], c[2] = sample(i), sample(i+1), sample(i+2)
+		} else {
+			v := sample(i)
+			if r.photometric == 0 {
+				// WhiteIsZero
+				v = 0xffff - v
+			}
+			c[0], c[1], c[2] = v, v, v
+		}
+		if r.alpha != 0 {
+			c[3] = sample(i + r.samples - 1)
+		}
+		if r.alpha == 2 {
+			cr, cg, cb, ca := color.NRGBA64{c[0], c[1], c[2], c[3]}.RGBA()
+			c = [4]uint16{uint16(cr), uint16(cg), uint16(cb), uint16(ca)}
+		}
+		copy(row[4*x:4*x+4], c[:])
+	}
+	r.y++
+	return nil
+}
+
+func (r *tiffRows) Close() error {
+	return r.f.Close()
+}
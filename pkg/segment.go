@@ -0,0 +1,145 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+)
+
+// maxSegmentLevels is the largest number of gray levels MultiOtsuImage produces
+const maxSegmentLevels = 16
+
+// MultiOtsuImage segments the input image into the given number of gray levels
+// using multi-level Otsu thresholding.
+// It takes the paths of the input and output files and the number of levels (2 to 16).
+// Returns the computed thresholds, in ascending order, or an error if the operation fails.
+func MultiOtsuImage(inputPath string, outputPath string, levels int) ([]uint8, error) {
+	slog.Info("segmenting image",
+		"input", inputPath,
+		"levels", levels)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	segmented, thresholds, err := MultiOtsu(img, levels)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveJPEG(outputPath, segmented); err != nil {
+		return nil, err
+	}
+	return thresholds, nil
+}
+
+// MultiOtsuImageReader segments the image read from r like MultiOtsuImage and
+// writes it to w as JPEG.
+// Returns the computed thresholds, or an error if the operation fails.
+func MultiOtsuImageReader(r io.Reader, w io.Writer, levels int) ([]uint8, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	segmented, thresholds, err := MultiOtsu(img, levels)
+	if err != nil {
+		return nil, err
+	}
+	if err := encodeJPEG(w, segmented); err != nil {
+		return nil, err
+	}
+	return thresholds, nil
+}
+
+// MultiOtsu segments the image into the given number of evenly spaced gray
+// levels (2 to 16), like MultiOtsuImage.
+// Returns the segmented image and the thresholds, in ascending order, or an
+// error if the number of levels is out of range.
+func MultiOtsu(img image.Image, levels int) (image.Image, []uint8, error) {
+	if levels < 2 || levels > maxSegmentLevels {
+		return nil, nil, &ErrProcessing{Op: "segment", Err: fmt.Errorf("levels must be between 2 and %d, got %d", maxSegmentLevels, levels)}
+	}
+
+	grayImg := toGray(img)
+	histogram := make([]int, 256)
+	for _, v := range grayImg.Pix {
+		histogram[v]++
+	}
+
+	thresholds := multiOtsuThresholds(histogram, levels)
+	slog.Info("computed thresholds", "thresholds", thresholds)
+
+	// Map each class to evenly spaced output gray levels
+	lut := make([]uint8, 256)
+	class := 0
+	for v := 0; v < 256; v++ {
+		for class < len(thresholds) && v > int(thresholds[class]) {
+			class++
+		}
+		lut[v] = uint8(class * 255 / (levels - 1))
+	}
+
+	bounds := grayImg.Bounds()
+	segmented := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			segmented.SetGray(x, y, color.Gray{Y: lut[grayImg.GrayAt(x, y).Y]})
+		}
+	}
+
+	return segmented, thresholds, nil
+}
+
+// multiOtsuThresholds finds the levels-1 thresholds that maximize the
+// between-class variance of the histogram. A value equal to a threshold
+// belongs to the lower class, as in otsuThreshold.
+func multiOtsuThresholds(histogram []int, levels int) []uint8 {
+	// Prefix sums of counts and intensity-weighted counts
+	var count, sum [257]float64
+	for i := 0; i < 256; i++ {
+		count[i+1] = count[i] + float64(histogram[i])
+		sum[i+1] = sum[i] + float64(i*histogram[i])
+	}
+
+	// Maximizing between-class variance is equivalent to maximizing
+	// the sum of S^2/N over the classes
+	score := func(from, to int) float64 {
+		n := count[to] - count[from]
+		if n == 0 {
+			return 0
+		}
+		s := sum[to] - sum[from]
+		return s * s / n
+	}
+
+	// best[k][t] is the best score for splitting values [0, t) into k+1 classes
+	best := make([][]float64, levels)
+	split := make([][]int, levels)
+	for k := range best {
+		best[k] = make([]float64, 257)
+		split[k] = make([]int, 257)
+	}
+	for t := 1; t <= 256; t++ {
+		best[0][t] = score(0, t)
+	}
+	for k := 1; k < levels; k++ {
+		for t := k + 1; t <= 256; t++ {
+			best[k][t] = -1
+			for j := k; j < t; j++ {
+				if v := best[k-1][j] + score(j, t); v > best[k][t] {
+					best[k][t] = v
+					split[k][t] = j
+				}
+			}
+		}
+	}
+
+	thresholds := make([]uint8, levels-1)
+	t := 256
+	for k := levels - 1; k > 0; k-- {
+		t = split[k][t]
+		thresholds[k-1] = uint8(t - 1)
+	}
+	return thresholds
+}
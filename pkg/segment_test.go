@@ -0,0 +1,49 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMultiOtsuImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// Three flat bands at 30, 128 and 220
+	img := image.NewGray(image.Rect(0, 0, 90, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 90; x++ {
+			img.SetGray(x, y, color.Gray{Y: []uint8{30, 128, 220}[x/30]})
+		}
+	}
+	testInputPath := filepath.Join(testDir, "test_input_bands.jpg")
+	out, err := os.Create(testInputPath)
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	if err := jpeg.Encode(out, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	out.Close()
+
+	testOutputPath := filepath.Join(testDir, "test_output_segment.jpg")
+	thresholds, err := MultiOtsuImage(testInputPath, testOutputPath, 3)
+	if err != nil {
+		t.Fatalf("Failed to segment image: %v", err)
+	}
+
+	if len(thresholds) != 2 {
+		t.Fatalf("Expected 2 thresholds, got %d", len(thresholds))
+	}
+	if thresholds[0] < 30 || thresholds[0] >= 128 || thresholds[1] < 128 || thresholds[1] >= 220 {
+		t.Errorf("Thresholds %v do not separate the bands", thresholds)
+	}
+
+	if _, err := MultiOtsuImage(testInputPath, testOutputPath, 1); err == nil {
+		t.Error("Expected an error for fewer than 2 levels")
+	}
+}
@@ -0,0 +1,338 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/okamyuji/go-image-processor/config"
+)
+
+// defaultMaxUploadSize bounds uploaded images when ServerOptions does not
+const defaultMaxUploadSize = 64 << 20
+
+// maxQueryDimension bounds the widths and heights given in a query
+const maxQueryDimension = 1 << 15
+
+// ServerOptions configures the HTTP server
+type ServerOptions struct {
+	// MaxUploadSize bounds the size of an uploaded image in bytes; zero uses
+	// 64 MiB
+	MaxUploadSize int64
+	// Health, when set, is served on /healthz and /readyz and counts the
+	// requests in progress and the memory they hold
+	Health *Health
+	// MemoryBudget bounds the bytes of images a request may allocate, as
+	// counted by a MemoryAccount; zero counts without a limit
+	MemoryBudget int64
+	// Encryption, when set, encrypts every response, which is then sent as
+	// application/octet-stream
+	Encryption *Encryption
+}
+
+// serverOperations add the operation of a request to a pipeline, with the
+// parameters given in the query
+var serverOperations = map[string]func(p *Pipeline, q url.Values) error{
+	"resize": func(p *Pipeline, q url.Values) error {
+		width, err := queryUint(q, "width")
+		if err != nil {
+			return err
+		}
+		height, err := queryUint(q, "height")
+		if err != nil {
+			return err
+		}
+		if width == 0 && height == 0 {
+			return errors.New("width or height is required")
+		}
+		p.Resize(width, height)
+		return nil
+	},
+	"rotate": func(p *Pipeline, q url.Values) error {
+		if !q.Has("angle") {
+			return errors.New("angle is required")
+		}
+		angle, err := queryFloat(q, "angle", 0)
+		if err != nil {
+			return err
+		}
+		p.Rotate(angle)
+		return nil
+	},
+	"autorotate": func(p *Pipeline, q url.Values) error {
+		p.AutoRotate()
+		return nil
+	},
+	"denoise": func(p *Pipeline, q url.Values) error {
+		p.Denoise()
+		return nil
+	},
+	"binarize": func(p *Pipeline, q url.Values) error {
+		p.Binarize()
+		return nil
+	},
+	"edges": func(p *Pipeline, q url.Values) error {
+		p.Edges()
+		return nil
+	},
+	"skeleton": func(p *Pipeline, q url.Values) error {
+		p.Skeletonize()
+		return nil
+	},
+	"deblock": func(p *Pipeline, q url.Values) error {
+		strength, err := queryInt(q, "strength", 2)
+		if err != nil {
+			return err
+		}
+		p.Deblock(strength)
+		return nil
+	},
+	"docclean": func(p *Pipeline, q url.Values) error {
+		preset := q.Get("preset")
+		if preset == "" {
+			preset = DocCleanDocument
+		}
+		if _, ok := docCleanPresets[preset]; !ok {
+			return fmt.Errorf("unknown preset %q", preset)
+		}
+		p.DocClean(preset)
+		return nil
+	},
+	"halftone": func(p *Pipeline, q url.Values) error {
+		pitch, err := queryFloat(q, "pitch", 6)
+		if err != nil {
+			return err
+		}
+		angle, err := queryFloat(q, "angle", 45)
+		if err != nil {
+			return err
+		}
+		p.Halftone(pitch, angle)
+		return nil
+	},
+	"comic": func(p *Pipeline, q url.Values) error {
+		levels, err := queryInt(q, "levels", 4)
+		if err != nil {
+			return err
+		}
+		edgeThreshold, err := queryFloat(q, "edge-threshold", 200)
+		if err != nil {
+			return err
+		}
+		p.Comic(levels, edgeThreshold)
+		return nil
+	},
+	"blurfaces": func(p *Pipeline, q url.Values) error {
+		p.BlurFaces()
+		return nil
+	},
+}
+
+// ServerOperations lists the operations NewServer offers, sorted by name
+func ServerOperations() []string {
+	names := make([]string, 0, len(serverOperations))
+	for name := range serverOperations {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// NewServer returns an HTTP handler that processes images. The image is
+// posted as the request body to /<operation>, with the parameters of the
+// operation in the query, and the result is returned as JPEG:
+//
+//	curl --data-binary @input.jpg -o output.jpg 'http://localhost:8080/resize?width=800&height=600'
+//
+// The operations are resize (width, height), rotate (angle), autorotate,
+// denoise, binarize, edges, skeleton, deblock (strength), docclean (preset),
+// halftone (pitch, angle), comic (levels, edge-threshold) and blurfaces.
+// Unknown operations are answered with 404 Not Found, invalid parameters and
+// images that cannot be decoded with 400 Bad Request, images larger than
+// MaxUploadSize or needing more than MemoryBudget with 413 Request Entity Too
+// Large and failed operations with 500 Internal Server Error. Successful
+// responses give the bytes of images the request allocated in the
+// X-Memory-Allocated header. With Encryption, the JPEG is encrypted.
+//
+// When tenants are configured, every request must give the API key of one in
+// the X-API-Key header, or it is answered with 401 Unauthorized. The tenant's
+// allowed operations apply (403 Forbidden otherwise), inputs over its size
+// limit get 413, and its quality cap and watermark apply to the result.
+// Without tenants anyone who can reach the server can use it, so it should
+// only listen on localhost or behind an authenticating proxy.
+func NewServer(opts ServerOptions) http.Handler {
+	maxSize := opts.MaxUploadSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxUploadSize
+	}
+
+	mux := http.NewServeMux()
+	if opts.Health != nil {
+		mux.Handle("GET /healthz", opts.Health.Handler())
+		mux.Handle("GET /readyz", opts.Health.Handler())
+	}
+	mux.HandleFunc("POST /{operation}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("operation")
+		addOperation, ok := serverOperations[name]
+		if !ok {
+			http.Error(w, "unknown operation: "+name, http.StatusNotFound)
+			return
+		}
+		tenant, err := LookupTenant(r.Header.Get("X-API-Key"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if tenant != nil && len(tenant.Operations) > 0 && !slices.Contains(tenant.Operations, name) {
+			http.Error(w, fmt.Sprintf("operation %q is not allowed for %s", name, tenant.Name), http.StatusForbidden)
+			return
+		}
+		p := NewPipeline()
+		if err := addOperation(p, r.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+		if err != nil {
+			err = &ErrProcessing{Op: "read", Err: err}
+			http.Error(w, err.Error(), serverErrorStatus(err))
+			return
+		}
+		if tenant != nil {
+			if err := applyTenantLimits(p, tenant, data); err != nil {
+				slog.Warn("request refused", "operation", name, "tenant", tenant.Name, "remote", r.RemoteAddr, "error", err)
+				http.Error(w, err.Error(), serverErrorStatus(err))
+				return
+			}
+		}
+		account := NewMemoryAccount(opts.MemoryBudget)
+		if opts.Health != nil {
+			opts.Health.inFlight.Add(1)
+			defer opts.Health.inFlight.Add(-1)
+			account.health = opts.Health
+			defer func() { opts.Health.addMemory(-account.Allocated()) }()
+		}
+
+		var out bytes.Buffer
+		ctx := WithMemoryAccount(r.Context(), account)
+		if err := p.RunReaderContext(ctx, bytes.NewReader(data), &out); err != nil {
+			slog.Warn("request failed", "operation", name, "remote", r.RemoteAddr, "memory", account.Allocated(), "error", err)
+			http.Error(w, err.Error(), serverErrorStatus(err))
+			return
+		}
+		body, contentType := out.Bytes(), "image/jpeg"
+		if opts.Encryption != nil {
+			sealed, err := opts.Encryption.Encrypt(body)
+			if err != nil {
+				slog.Error("encrypting the response failed", "operation", name, "error", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			body, contentType = sealed, "application/octet-stream"
+		}
+		slog.Info("request processed", "operation", name, "remote", r.RemoteAddr, "bytes", len(body), "memory", account.Allocated())
+		w.Header().Set("X-Memory-Allocated", strconv.FormatInt(account.Allocated(), 10))
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	})
+	return mux
+}
+
+// serverErrorStatus is the HTTP status for an error while processing a
+// request: the client's fault when the image could not be read or decoded
+func serverErrorStatus(err error) int {
+	var procErr *ErrProcessing
+	if errors.As(err, &procErr) {
+		switch procErr.Op {
+		case "read":
+			var tooLarge *http.MaxBytesError
+			if errors.As(procErr.Err, &tooLarge) {
+				return http.StatusRequestEntityTooLarge
+			}
+			return http.StatusBadRequest
+		case "decode":
+			return http.StatusBadRequest
+		case "memory", "tenant":
+			return http.StatusRequestEntityTooLarge
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// applyTenantLimits applies the limits of a tenant to the request for the
+// image data: images over its size limit are refused before they are
+// decoded, the quality of the result is capped and its watermark is added to
+// the pipeline
+func applyTenantLimits(p *Pipeline, t *config.Tenant, data []byte) error {
+	// An image whose header cannot be read is left to the decoder to report
+	if c, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		if err := checkTenantSize(t, c); err != nil {
+			return err
+		}
+	}
+	if t.MaxQuality > 0 {
+		p.Quality(min(p.outputQuality(), t.MaxQuality))
+	}
+	if t.Watermark != nil {
+		mark, err := loadImage(t.Watermark.Image)
+		if err != nil {
+			return err
+		}
+		position := t.Watermark.Position
+		if position == "" {
+			position = WatermarkAuto
+		}
+		p.Watermark(mark, WatermarkOptions{Position: position, Scale: t.Watermark.Scale, Opacity: t.Watermark.Opacity})
+	}
+	return nil
+}
+
+// queryUint reads a non-negative integer query parameter of at most
+// maxQueryDimension, zero when absent
+func queryUint(q url.Values, name string) (uint, error) {
+	if !q.Has(name) {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(q.Get(name), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", name, q.Get(name))
+	}
+	if v > maxQueryDimension {
+		return 0, fmt.Errorf("%s %d is larger than %d", name, v, maxQueryDimension)
+	}
+	return uint(v), nil
+}
+
+// queryInt reads an integer query parameter, or returns def when absent
+func queryInt(q url.Values, name string, def int) (int, error) {
+	if !q.Has(name) {
+		return def, nil
+	}
+	v, err := strconv.Atoi(q.Get(name))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", name, q.Get(name))
+	}
+	return v, nil
+}
+
+// queryFloat reads a finite number query parameter, or returns def when
+// absent. NaN and infinities are rejected, as NaN passes every range check.
+func queryFloat(q url.Values, name string, def float64) (float64, error) {
+	if !q.Has(name) {
+		return def, nil
+	}
+	v, err := strconv.ParseFloat(q.Get(name), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid %s %q", name, q.Get(name))
+	}
+	return v, nil
+}
@@ -0,0 +1,175 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/okamyuji/go-image-processor/config"
+)
+
+func TestServer(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	inputPath := filepath.Join(testDir, "test_input_server.jpg")
+	if err := generateSingleTestImage(inputPath, 120, 80); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	input, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read test image: %v", err)
+	}
+
+	health := &Health{}
+	health.SetReady(true)
+	server := httptest.NewServer(NewServer(ServerOptions{MaxUploadSize: 1 << 20, Health: health}))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/resize?width=60&height=40", "image/jpeg", bytes.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to post image: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("Expected a JPEG, got %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	img, _, err := image.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 60 || b.Dy() != 40 {
+		t.Errorf("Expected 60x40, got %v", b)
+	}
+	// The decoded input is at least its luma plane, and the resized result 60x40 RGBA
+	if allocated, _ := strconv.ParseInt(resp.Header.Get("X-Memory-Allocated"), 10, 64); allocated < 120*80+60*40*4 {
+		t.Errorf("Expected the memory of the request reported, got %q", resp.Header.Get("X-Memory-Allocated"))
+	}
+
+	tests := []struct {
+		name string
+		path string
+		body []byte
+		want int
+	}{
+		{"unknown operation", "/sharpen", input, http.StatusNotFound},
+		{"missing parameter", "/rotate", input, http.StatusBadRequest},
+		{"invalid parameter", "/resize?width=wide", input, http.StatusBadRequest},
+		{"oversized parameter", "/resize?width=4000000000", input, http.StatusBadRequest},
+		{"NaN parameter", "/halftone?pitch=NaN", input, http.StatusBadRequest},
+		{"infinite parameter", "/rotate?angle=Inf", input, http.StatusBadRequest},
+		{"undecodable image", "/binarize", []byte("not an image"), http.StatusBadRequest},
+		{"too large", "/binarize", make([]byte, 2<<20), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(server.URL+tt.path, "image/jpeg", bytes.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to post: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, resp.StatusCode)
+			}
+		})
+	}
+
+	resp, err = http.Get(server.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("Failed to get /readyz: %v", err)
+	}
+	var status HealthStatus
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected /readyz to be ready, got %s", resp.Status)
+	}
+	if err != nil || status.MemoryInUse != 0 || status.MemoryPeak == 0 {
+		t.Errorf("Expected no memory in use after a peak, got %+v and %v", status, err)
+	}
+
+	limited := httptest.NewServer(NewServer(ServerOptions{MemoryBudget: 4096}))
+	defer limited.Close()
+	resp, err = http.Post(limited.URL+"/binarize", "image/jpeg", bytes.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to post image: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected an image over the memory budget refused, got %s", resp.Status)
+	}
+
+	limited = httptest.NewServer(NewServer(ServerOptions{MemoryBudget: 1 << 20}))
+	defer limited.Close()
+	resp, err = http.Post(limited.URL+"/resize?width=8000&height=8000", "image/jpeg", bytes.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to post image: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected a result over the memory budget refused, got %s", resp.Status)
+	}
+}
+
+func TestServerTenants(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	inputPath := filepath.Join(testDir, "test_input_server_tenant.jpg")
+	if err := generateSingleTestImage(inputPath, 120, 80); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	input, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read test image: %v", err)
+	}
+
+	original := currentConfig()
+	defer SetConfig(original)
+	c := *original
+	c.Tenants = []config.Tenant{
+		{Name: "web", APIKey: "key-web", Operations: []string{"resize"}, MaxWidth: 100},
+		{Name: "docs", APIKey: "key-docs"},
+	}
+	SetConfig(&c)
+
+	server := httptest.NewServer(NewServer(ServerOptions{}))
+	defer server.Close()
+	tests := []struct {
+		name string
+		path string
+		key  string
+		want int
+	}{
+		{"no key", "/binarize", "", http.StatusUnauthorized},
+		{"unknown key", "/binarize", "wrong", http.StatusUnauthorized},
+		{"operation not allowed", "/binarize", "key-web", http.StatusForbidden},
+		{"input over the size limit", "/resize?width=60", "key-web", http.StatusRequestEntityTooLarge},
+		{"allowed", "/binarize", "key-docs", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, server.URL+tt.path, bytes.NewReader(input))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to post: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, resp.StatusCode)
+			}
+		})
+	}
+}
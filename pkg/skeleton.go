@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"image"
+	"io"
+	"log/slog"
+)
+
+// SkeletonizeImage reduces the dark strokes of the input image to one-pixel-wide
+// lines using Zhang-Suen thinning. The image is binarized with Otsu's method first.
+// It takes the paths of the input and output files.
+// Returns an error if the operation fails.
+func SkeletonizeImage(inputPath string, outputPath string) error {
+	slog.Info("skeletonizing image", "input", inputPath)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	return saveJPEG(outputPath, Skeletonize(img))
+}
+
+// SkeletonizeImageReader thins the strokes of the image read from r like
+// SkeletonizeImage and writes the result to w as JPEG.
+// Returns an error if the operation fails.
+func SkeletonizeImageReader(r io.Reader, w io.Writer) error {
+	img, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, Skeletonize(img))
+}
+
+// Skeletonize returns the one-pixel-wide skeleton of the dark strokes of the
+// image, like SkeletonizeImage.
+func Skeletonize(img image.Image) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	mask := otsuInkMask(toGray(img))
+	zhangSuenThin(mask, w, h)
+	return maskToGray(mask, w, h)
+}
+
+// otsuInkMask binarizes the image with Otsu's method and returns a row-major
+// mask that is true for dark (ink) pixels
+func otsuInkMask(grayImg *image.Gray) []bool {
+	bounds := grayImg.Bounds()
+	histogram := make([]int, 256)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			histogram[grayImg.GrayAt(x, y).Y]++
+		}
+	}
+	threshold := otsuThreshold(histogram, bounds.Dx()*bounds.Dy())
+
+	mask := make([]bool, bounds.Dx()*bounds.Dy())
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			mask[i] = grayImg.GrayAt(x, y).Y <= threshold
+			i++
+		}
+	}
+	return mask
+}
+
+// zhangSuenThin thins the foreground of the mask in place
+func zhangSuenThin(mask []bool, w, h int) {
+	at := func(x, y int) int {
+		if x < 0 || y < 0 || x >= w || y >= h || !mask[y*w+x] {
+			return 0
+		}
+		return 1
+	}
+
+	var remove []int
+	for changed := true; changed; {
+		changed = false
+		for pass := 0; pass < 2; pass++ {
+			remove = remove[:0]
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					if !mask[y*w+x] {
+						continue
+					}
+					// Neighbours P2..P9, clockwise from north
+					p := [8]int{
+						at(x, y-1), at(x+1, y-1), at(x+1, y), at(x+1, y+1),
+						at(x, y+1), at(x-1, y+1), at(x-1, y), at(x-1, y-1),
+					}
+					neighbours, transitions := 0, 0
+					for k := 0; k < 8; k++ {
+						neighbours += p[k]
+						if p[k] == 0 && p[(k+1)%8] == 1 {
+							transitions++
+						}
+					}
+					if neighbours < 2 || neighbours > 6 || transitions != 1 {
+						continue
+					}
+					if pass == 0 && (p[0]*p[2]*p[4] != 0 || p[2]*p[4]*p[6] != 0) {
+						continue
+					}
+					if pass == 1 && (p[0]*p[2]*p[6] != 0 || p[0]*p[4]*p[6] != 0) {
+						continue
+					}
+					remove = append(remove, y*w+x)
+				}
+			}
+			for _, i := range remove {
+				mask[i] = false
+			}
+			if len(remove) > 0 {
+				changed = true
+			}
+		}
+	}
+}
+
+// maskToGray renders a mask as black ink on a white background
+func maskToGray(mask []bool, w, h int) *image.Gray {
+	gray := image.NewGray(image.Rect(0, 0, w, h))
+	for i, ink := range mask {
+		if ink {
+			gray.Pix[i] = 0
+		} else {
+			gray.Pix[i] = 255
+		}
+	}
+	return gray
+}
@@ -0,0 +1,52 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZhangSuenThin(t *testing.T) {
+	// A 5px thick horizontal bar should thin to a single-pixel line
+	w, h := 30, 11
+	mask := make([]bool, w*h)
+	for y := 3; y < 8; y++ {
+		for x := 3; x < 27; x++ {
+			mask[y*w+x] = true
+		}
+	}
+
+	zhangSuenThin(mask, w, h)
+
+	for x := 6; x < 24; x++ {
+		count := 0
+		for y := 0; y < h; y++ {
+			if mask[y*w+x] {
+				count++
+			}
+		}
+		if count != 1 {
+			t.Errorf("Column %d has %d skeleton pixels, expected 1", x, count)
+		}
+	}
+}
+
+func TestSkeletonizeImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_skeleton.jpg")
+
+	if err := generateSingleTestImage(testInputPath, 100, 100); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	if err := SkeletonizeImage(testInputPath, testOutputPath); err != nil {
+		t.Fatalf("Failed to skeletonize image: %v", err)
+	}
+
+	if _, err := os.Stat(testOutputPath); os.IsNotExist(err) {
+		t.Errorf("Skeleton image was not created")
+	}
+}
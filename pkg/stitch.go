@@ -0,0 +1,184 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+// errNoInputImages is returned when an operation that combines images is given none
+var errNoInputImages = errors.New("no input images")
+
+// minStitchOverlap is the narrowest overlap, in pixels, considered when stitching
+const minStitchOverlap = 8
+
+// minStitchCorrelation is the normalized cross-correlation below which an
+// overlap is not trusted and the images are joined without blending
+const minStitchCorrelation = 0.5
+
+// StitchImagesHorizontally combines horizontally overlapping captures into a single strip.
+// The overlap between each pair of consecutive images is found by cross-correlation
+// and the seam is blended with a linear gradient. Pairs without a reliable overlap
+// are joined edge to edge, as ConcatenateImagesHorizontally does.
+// It takes a slice of input file paths, ordered left to right, and the output file path.
+// Returns an error if the operation fails.
+func StitchImagesHorizontally(inputPaths []string, outputPath string) error {
+	slog.Info("stitching images horizontally",
+		"count", len(inputPaths),
+		"output", outputPath)
+
+	images, err := loadImages(inputPaths)
+	if err != nil {
+		return err
+	}
+	strip, err := StitchHorizontally(images)
+	if err != nil {
+		return err
+	}
+	return saveJPEG(outputPath, strip)
+}
+
+// StitchImagesHorizontallyReader stitches the images read from the readers,
+// ordered left to right, like StitchImagesHorizontally and writes the strip
+// to w as JPEG.
+// Returns an error if the operation fails.
+func StitchImagesHorizontallyReader(inputs []io.Reader, w io.Writer) error {
+	images, err := decodeImages(inputs)
+	if err != nil {
+		return err
+	}
+	strip, err := StitchHorizontally(images)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, strip)
+}
+
+// StitchHorizontally combines horizontally overlapping images, ordered left
+// to right, into a single strip like StitchImagesHorizontally.
+// Returns an error if there are no images.
+func StitchHorizontally(images []image.Image) (image.Image, error) {
+	maxHeight := 0
+	for _, img := range images {
+		maxHeight = max(maxHeight, img.Bounds().Dy())
+	}
+
+	var strip *image.RGBA
+	for i, img := range images {
+		bounds := img.Bounds()
+		ratio := float64(bounds.Dx()) / float64(bounds.Dy())
+		newWidth := int(float64(maxHeight) * ratio)
+		resized := toRGBA(resize.Resize(uint(newWidth), uint(maxHeight), img, resize.Lanczos3))
+
+		if strip == nil {
+			strip = resized
+			continue
+		}
+
+		overlap, score := findHorizontalOverlap(strip, resized)
+		slog.Info("detected overlap",
+			"index", i,
+			"overlap", overlap,
+			"correlation", score)
+		if score < minStitchCorrelation {
+			slog.Warn("no reliable overlap found, joining without blending",
+				"index", i,
+				"correlation", score)
+			overlap = 0
+		}
+		strip = blendHorizontal(strip, resized, overlap)
+	}
+
+	if strip == nil {
+		return nil, &ErrProcessing{Op: "stitch", Err: errNoInputImages}
+	}
+	return strip, nil
+}
+
+// toRGBA copies the image into an *image.RGBA anchored at the origin
+func toRGBA(img image.Image) *image.RGBA {
+	switch img.(type) {
+	case *image.RGBA, *image.NRGBA, *image.Gray, *image.YCbCr:
+		return drawRGBA(img)
+	}
+	return toRGBAGeneric(img)
+}
+
+// findHorizontalOverlap returns the number of columns by which the right edge
+// of left overlaps the left edge of right, and the normalized cross-correlation
+// of the two overlapping areas
+func findHorizontalOverlap(left, right *image.RGBA) (int, float64) {
+	lw, h := left.Bounds().Dx(), left.Bounds().Dy()
+	rw := right.Bounds().Dx()
+	maxOverlap := int(math.Min(float64(lw), float64(rw)) * 3 / 4)
+
+	// Sample a bounded number of rows and columns so large images stay fast
+	rowStep := int(math.Max(1, float64(h)/100))
+	colStep := int(math.Max(1, float64(maxOverlap)/100))
+
+	luma := func(img *image.RGBA, x, y int) float64 {
+		c := img.RGBAAt(x, y)
+		return 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+	}
+
+	bestOverlap, bestScore := 0, -1.0
+	for overlap := minStitchOverlap; overlap <= maxOverlap; overlap++ {
+		var sumA, sumB, sumAA, sumBB, sumAB, n float64
+		for y := 0; y < h; y += rowStep {
+			for x := 0; x < overlap; x += colStep {
+				a := luma(left, lw-overlap+x, y)
+				b := luma(right, x, y)
+				sumA += a
+				sumB += b
+				sumAA += a * a
+				sumBB += b * b
+				sumAB += a * b
+				n++
+			}
+		}
+		covariance := sumAB - sumA*sumB/n
+		varA := sumAA - sumA*sumA/n
+		varB := sumBB - sumB*sumB/n
+		if varA <= 0 || varB <= 0 {
+			continue
+		}
+		score := covariance / math.Sqrt(varA*varB)
+		if score > bestScore {
+			bestOverlap, bestScore = overlap, score
+		}
+	}
+	return bestOverlap, bestScore
+}
+
+// blendHorizontal joins right onto left, cross-fading the overlapping columns
+func blendHorizontal(left, right *image.RGBA, overlap int) *image.RGBA {
+	lw, h := left.Bounds().Dx(), left.Bounds().Dy()
+	rw := right.Bounds().Dx()
+	out := image.NewRGBA(image.Rect(0, 0, lw+rw-overlap, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < lw-overlap; x++ {
+			out.SetRGBA(x, y, left.RGBAAt(x, y))
+		}
+		for x := 0; x < overlap; x++ {
+			weight := (float64(x) + 0.5) / float64(overlap)
+			a := left.RGBAAt(lw-overlap+x, y)
+			b := right.RGBAAt(x, y)
+			out.SetRGBA(lw-overlap+x, y, color.RGBA{
+				R: uint8(float64(a.R)*(1-weight) + float64(b.R)*weight + 0.5),
+				G: uint8(float64(a.G)*(1-weight) + float64(b.G)*weight + 0.5),
+				B: uint8(float64(a.B)*(1-weight) + float64(b.B)*weight + 0.5),
+				A: 255,
+			})
+		}
+		for x := overlap; x < rw; x++ {
+			out.SetRGBA(lw+x-overlap, y, right.RGBAAt(x, y))
+		}
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStitchImagesHorizontally(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// A smooth, non-repeating scene split into two captures overlapping by 60 columns
+	scene := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 300; x++ {
+			v := 128 + 60*math.Sin(float64(x)/17) + 60*math.Cos(float64(x*y)/900)
+			scene.Set(x, y, color.RGBA{R: uint8(v), G: uint8(255 - v), B: uint8(x % 256), A: 255})
+		}
+	}
+
+	paths := []string{filepath.Join(testDir, "left.jpg"), filepath.Join(testDir, "right.jpg")}
+	crops := []image.Rectangle{image.Rect(0, 0, 180, 100), image.Rect(120, 0, 300, 100)}
+	for i, r := range crops {
+		out, err := os.Create(paths[i])
+		if err != nil {
+			t.Fatalf("Failed to create test image: %v", err)
+		}
+		if err := jpeg.Encode(out, scene.SubImage(r), &jpeg.Options{Quality: 95}); err != nil {
+			t.Fatalf("Failed to encode test image: %v", err)
+		}
+		out.Close()
+	}
+
+	testOutputPath := filepath.Join(testDir, "test_output_stitch.jpg")
+	if err := StitchImagesHorizontally(paths, testOutputPath); err != nil {
+		t.Fatalf("Failed to stitch images: %v", err)
+	}
+
+	img, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load stitched image: %v", err)
+	}
+	if w := img.Bounds().Dx(); w < 298 || w > 302 {
+		t.Errorf("Stitched image width incorrect. Expected about 300, got %d", w)
+	}
+}
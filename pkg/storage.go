@@ -0,0 +1,289 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Storage is a place images are read from and written to: a local directory,
+// an SFTP server or a WebDAV share. Names are the paths List returns; remote
+// backends use slash-separated paths from the server root.
+type Storage interface {
+	// List returns the names of the files directly inside dir, without
+	// subdirectories
+	List(dir string) ([]string, error)
+	// Get opens a file for reading
+	Get(name string) (io.ReadCloser, error)
+	// Put writes a file, creating its parent directories. A file that fails
+	// part way is not left behind under its name.
+	Put(name string, r io.Reader) error
+	// Close releases the connection, if any
+	Close() error
+}
+
+// OpenStorage opens the storage a location names and returns it with the path
+// of the location inside it. Locations are local paths, sftp://user@host[:port]/path
+// or dav://host[:port]/path (davs:// for HTTPS). Credentials can be given as
+// user:password in the URL; SFTP otherwise authenticates with the SSH agent or
+// the default keys in ~/.ssh and checks the server against ~/.ssh/known_hosts.
+func OpenStorage(location string) (Storage, string, error) {
+	scheme, ok := storageScheme(location)
+	if !ok {
+		return LocalStorage{}, location, nil
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid storage location %q", location)
+	}
+	dir := u.Path
+	if dir == "" {
+		dir = "/"
+	}
+
+	slog.Info("opening storage", "scheme", scheme, "host", u.Host, "path", dir)
+	switch scheme {
+	case "sftp":
+		s, err := dialSFTP(u)
+		return s, dir, err
+	case "dav", "davs", "webdav", "webdavs":
+		return newWebDAVStorage(u), dir, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported storage scheme %q", scheme)
+	}
+}
+
+// errLocationNotAllowed is returned for storage locations outside the roots
+// a request may use
+var errLocationNotAllowed = errors.New("location is outside the allowed roots")
+
+// ResolveLocation confines a storage location to roots, the local
+// directories and sftp:// or dav:// URLs of a host and directory it may name.
+// A relative local path is taken inside the first local root. Locations with
+// a ".." element are rejected, and a remote location must name the scheme,
+// host and, when the root has one, user of a root.
+// Returns the location to open, or an error if it is outside every root.
+func ResolveLocation(location string, roots []string) (string, error) {
+	notAllowed := &ErrProcessing{Op: "storage", Err: fmt.Errorf("%w: %s", errLocationNotAllowed, RedactLocation(location))}
+	if _, remote := storageScheme(location); remote {
+		u, err := url.Parse(location)
+		if err != nil || hasDotDot(u.Path, "/") {
+			return "", notAllowed
+		}
+		for _, root := range roots {
+			if _, ok := storageScheme(root); !ok {
+				continue
+			}
+			r, err := url.Parse(root)
+			if err != nil || r.Scheme != u.Scheme || !strings.EqualFold(r.Host, u.Host) {
+				continue
+			}
+			if r.User != nil && (u.User == nil || u.User.Username() != r.User.Username()) {
+				continue
+			}
+			if within(path.Clean("/"+r.Path), path.Clean("/"+u.Path), "/") {
+				return location, nil
+			}
+		}
+		return "", notAllowed
+	}
+
+	if hasDotDot(location, string(filepath.Separator)+"/") {
+		return "", notAllowed
+	}
+	resolved := ""
+	for _, root := range roots {
+		if _, remote := storageScheme(root); remote {
+			continue
+		}
+		dir, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		if resolved == "" {
+			resolved = location
+			if !filepath.IsAbs(location) {
+				resolved = filepath.Join(dir, location)
+			}
+			resolved = filepath.Clean(resolved)
+		}
+		if within(dir, resolved, string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", notAllowed
+}
+
+// hasDotDot reports whether a path has a ".." element between any of the
+// separators
+func hasDotDot(p string, separators string) bool {
+	for _, element := range strings.FieldsFunc(p, func(r rune) bool { return strings.ContainsRune(separators, r) }) {
+		if element == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether the clean path p is dir or inside it
+func within(dir, p string, separator string) bool {
+	if p == dir {
+		return true
+	}
+	return strings.HasPrefix(p, strings.TrimSuffix(dir, separator)+separator)
+}
+
+// RedactLocation hides the password of a storage URL, for logs and reports
+func RedactLocation(location string) string {
+	if _, ok := storageScheme(location); !ok {
+		return location
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	return u.Redacted()
+}
+
+// storageScheme returns the URL scheme of a storage location, or false for a
+// local path. A single letter is a Windows drive, as in C://photos, not a
+// scheme.
+func storageScheme(location string) (string, bool) {
+	scheme, _, ok := strings.Cut(location, "://")
+	if !ok || len(scheme) < 2 {
+		return "", false
+	}
+	return scheme, true
+}
+
+// IsLocalStorage reports whether s reads and writes the local filesystem
+func IsLocalStorage(s Storage) bool {
+	_, ok := s.(LocalStorage)
+	return ok
+}
+
+// LocalStorage is the local filesystem; names are ordinary file paths
+type LocalStorage struct{}
+
+// List returns the paths of the files in dir
+func (LocalStorage) List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, &ErrInvalidInput{Path: dir, Err: err}
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return names, nil
+}
+
+// Get opens a file for reading
+func (LocalStorage) Get(name string) (io.ReadCloser, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, &ErrInvalidInput{Path: name, Err: err}
+	}
+	return file, nil
+}
+
+// Put writes a file through a temporary file, so it appears complete or not at all
+func (LocalStorage) Put(name string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return &ErrInvalidOutput{Path: name, Err: err}
+	}
+	out, err := createOutput(name)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, r); err != nil {
+		return &ErrProcessing{Op: "write", Err: err}
+	}
+	return out.Commit()
+}
+
+// Close does nothing
+func (LocalStorage) Close() error {
+	return nil
+}
+
+// ProcessStored applies an operation working on local files to a file in one
+// storage, writing the result to another. Remote inputs are downloaded to the
+// configured TempDir and remote outputs uploaded when the operation succeeds,
+// so any operation can work in place on a NAS or document server; local files
+// are used directly. Missing output directories are created.
+// It takes the input storage and name, the output storage and name, and the operation.
+// Returns an error if the transfer or the operation fails.
+func ProcessStored(in Storage, inputName string, out Storage, outputName string, operation func(inputPath, outputPath string) error) error {
+	if IsLocalStorage(out) {
+		if err := os.MkdirAll(filepath.Dir(outputName), 0755); err != nil {
+			return &ErrInvalidOutput{Path: outputName, Err: err}
+		}
+		if IsLocalStorage(in) {
+			return operation(inputName, outputName)
+		}
+	}
+
+	dir := currentConfig().TempDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	workDir, err := os.MkdirTemp(dir, "storage-*")
+	if err != nil {
+		return &ErrProcessing{Op: "storage", Err: err}
+	}
+	defer os.RemoveAll(workDir)
+
+	inputPath := inputName
+	if !IsLocalStorage(in) {
+		inputPath = filepath.Join(workDir, "input"+path.Ext(inputName))
+		if err := download(in, inputName, inputPath); err != nil {
+			return err
+		}
+	}
+	outputPath := outputName
+	if !IsLocalStorage(out) {
+		// The whole name is kept, so double extensions such as .jpg.enc stay
+		outputPath = filepath.Join(workDir, path.Base(outputName))
+	}
+
+	if err := operation(inputPath, outputPath); err != nil {
+		return err
+	}
+	if IsLocalStorage(out) {
+		return nil
+	}
+	file, err := os.Open(outputPath)
+	if err != nil {
+		return &ErrInvalidOutput{Path: outputPath, Err: err}
+	}
+	defer file.Close()
+	return out.Put(outputName, file)
+}
+
+// download copies a file from storage to a local path
+func download(s Storage, name string, localPath string) error {
+	r, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	file, err := os.Create(localPath)
+	if err != nil {
+		return &ErrInvalidOutput{Path: localPath, Err: err}
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, r); err != nil {
+		return &ErrProcessing{Op: "storage", Err: fmt.Errorf("downloading %s: %w", name, err)}
+	}
+	return file.Close()
+}
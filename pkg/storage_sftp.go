@@ -0,0 +1,145 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpStorage is a directory tree on an SFTP server
+type sftpStorage struct {
+	client *sftp.Client
+	// conn is the SSH connection carrying the client, closed with it
+	conn io.Closer
+}
+
+// dialSFTP connects to the server of an sftp:// URL
+func dialSFTP(u *url.URL) (*sftpStorage, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, &ErrProcessing{Op: "sftp", Err: err}
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, &ErrProcessing{Op: "sftp", Err: fmt.Errorf("reading known hosts: %w", err)}
+	}
+
+	user := u.User.Username()
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	var auth []ssh.AuthMethod
+	if password, ok := u.User.Password(); ok {
+		auth = append(auth, ssh.Password(password))
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			defer conn.Close()
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(key); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "22")
+	}
+	conn, err := ssh.Dial("tcp", host, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+	})
+	if err != nil {
+		return nil, &ErrProcessing{Op: "sftp", Err: err}
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, &ErrProcessing{Op: "sftp", Err: err}
+	}
+	return &sftpStorage{client: client, conn: conn}, nil
+}
+
+// List returns the paths of the files in dir
+func (s *sftpStorage) List(dir string) ([]string, error) {
+	entries, err := s.client.ReadDir(dir)
+	if err != nil {
+		return nil, &ErrInvalidInput{Path: dir, Err: err}
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() {
+			names = append(names, path.Join(dir, entry.Name()))
+		}
+	}
+	return names, nil
+}
+
+// Get opens a file for reading
+func (s *sftpStorage) Get(name string) (io.ReadCloser, error) {
+	file, err := s.client.Open(name)
+	if err != nil {
+		return nil, &ErrInvalidInput{Path: name, Err: err}
+	}
+	return file, nil
+}
+
+// Put uploads to a temporary name next to the file and renames it into place
+func (s *sftpStorage) Put(name string, r io.Reader) error {
+	if err := s.client.MkdirAll(path.Dir(name)); err != nil {
+		return &ErrInvalidOutput{Path: name, Err: err}
+	}
+	temp := path.Join(path.Dir(name), hiddenName(path.Base(name), ".part"))
+	file, err := s.client.Create(temp)
+	if err != nil {
+		return &ErrInvalidOutput{Path: name, Err: err}
+	}
+	_, err = file.ReadFrom(r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.client.Remove(temp)
+		return &ErrProcessing{Op: "sftp", Err: fmt.Errorf("uploading %s: %w", name, err)}
+	}
+	if err := s.client.PosixRename(temp, name); err != nil {
+		// Servers without the posix-rename extension refuse to replace files
+		s.client.Remove(name)
+		if err := s.client.Rename(temp, name); err != nil {
+			s.client.Remove(temp)
+			return &ErrProcessing{Op: "sftp", Err: fmt.Errorf("renaming %s: %w", name, err)}
+		}
+	}
+	return nil
+}
+
+// Close ends the session and the SSH connection
+func (s *sftpStorage) Close() error {
+	err := s.client.Close()
+	if s.conn != nil {
+		err = errors.Join(err, s.conn.Close())
+	}
+	return err
+}
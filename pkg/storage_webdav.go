@@ -0,0 +1,160 @@
+package processor
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// webdavStorage is a collection tree on a WebDAV server
+type webdavStorage struct {
+	// base is the server URL without a path; names are paths on the server
+	base   url.URL
+	client *http.Client
+}
+
+// newWebDAVStorage returns the storage of a dav:// or davs:// URL
+func newWebDAVStorage(u *url.URL) *webdavStorage {
+	base := url.URL{Scheme: "http", Host: u.Host, User: u.User}
+	if strings.HasSuffix(u.Scheme, "s") {
+		base.Scheme = "https"
+	}
+	return &webdavStorage{base: base, client: http.DefaultClient}
+}
+
+// request sends a request for a path on the server, with the credentials of
+// the URL as basic authentication
+func (s *webdavStorage) request(method, name string, body io.Reader, header map[string]string) (*http.Response, error) {
+	u := s.base
+	u.User = nil
+	u.Path = name
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if s.base.User != nil {
+		password, _ := s.base.User.Password()
+		req.SetBasicAuth(s.base.User.Username(), password)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return s.client.Do(req)
+}
+
+// davMultistatus is the body of a PROPFIND response
+type davMultistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// List returns the paths of the files in a collection
+func (s *webdavStorage) List(dir string) ([]string, error) {
+	collection := strings.TrimSuffix(dir, "/") + "/"
+	body := `<?xml version="1.0" encoding="utf-8"?><propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`
+	resp, err := s.request("PROPFIND", collection, strings.NewReader(body), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return nil, &ErrProcessing{Op: "webdav", Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, &ErrInvalidInput{Path: dir, Err: webdavStatusError(resp)}
+	}
+	var status davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, &ErrProcessing{Op: "webdav", Err: err}
+	}
+
+	var names []string
+	for _, r := range status.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		isCollection := strings.HasSuffix(href.Path, "/")
+		for _, propstat := range r.Propstats {
+			isCollection = isCollection || propstat.Prop.ResourceType.Collection != nil
+		}
+		if isCollection || path.Dir(href.Path) != path.Clean(collection) {
+			continue
+		}
+		names = append(names, href.Path)
+	}
+	return names, nil
+}
+
+// Get downloads a file
+func (s *webdavStorage) Get(name string) (io.ReadCloser, error) {
+	resp, err := s.request(http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "webdav", Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &ErrInvalidInput{Path: name, Err: webdavStatusError(resp)}
+	}
+	return resp.Body, nil
+}
+
+// Put creates the missing parent collections and uploads the file in one
+// request, which the server only stores once it is complete
+func (s *webdavStorage) Put(name string, r io.Reader) error {
+	parts := strings.Split(strings.Trim(path.Dir(name), "/"), "/")
+	for i := range parts {
+		if parts[i] == "" {
+			continue
+		}
+		resp, err := s.request("MKCOL", "/"+strings.Join(parts[:i+1], "/")+"/", nil, nil)
+		if err != nil {
+			return &ErrProcessing{Op: "webdav", Err: err}
+		}
+		resp.Body.Close()
+		// 405 means the collection already exists
+		if resp.StatusCode >= 300 && resp.StatusCode != http.StatusMethodNotAllowed {
+			return &ErrInvalidOutput{Path: name, Err: webdavStatusError(resp)}
+		}
+	}
+
+	resp, err := s.request(http.MethodPut, name, r, nil)
+	if err != nil {
+		return &ErrProcessing{Op: "webdav", Err: fmt.Errorf("uploading %s: %w", name, err)}
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return &ErrProcessing{Op: "webdav", Err: fmt.Errorf("uploading %s: %w", name, webdavStatusError(resp))}
+	}
+	return nil
+}
+
+// webdavStatusError describes the failed status of a response, matching
+// ErrNotFound for 404 and 410 and ErrPermission for 401 and 403
+func webdavStatusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("%s: %w", resp.Status, ErrNotFound)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%s: %w", resp.Status, ErrPermission)
+	}
+	return errors.New(resp.Status)
+}
+
+// Close does nothing; requests do not share state
+func (s *webdavStorage) Close() error {
+	return nil
+}
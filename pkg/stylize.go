@@ -0,0 +1,151 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"math"
+)
+
+// HalftoneImage renders the image as a black and white dot screen, like
+// newspaper print. Darker areas get larger dots.
+// It takes the paths of the input and output files, the distance between
+// dot centers in pixels and the screen angle in degrees.
+// Returns an error if the operation fails.
+func HalftoneImage(inputPath string, outputPath string, pitch, angle float64) error {
+	slog.Info("rendering halftone",
+		"input", inputPath,
+		"pitch", pitch,
+		"angle", angle)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	out, err := Halftone(img, pitch, angle)
+	if err != nil {
+		return err
+	}
+	return saveJPEG(outputPath, out)
+}
+
+// HalftoneImageReader renders the image read from r as a dot screen like
+// HalftoneImage and writes it to w as JPEG.
+// Returns an error if the operation fails.
+func HalftoneImageReader(r io.Reader, w io.Writer, pitch, angle float64) error {
+	img, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	out, err := Halftone(img, pitch, angle)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, out)
+}
+
+// Halftone renders the image as a black and white dot screen with the given
+// dot pitch and screen angle, like HalftoneImage.
+// Returns an error if the pitch is below 2 pixels.
+func Halftone(img image.Image, pitch, angle float64) (image.Image, error) {
+	if pitch < 2 {
+		return nil, &ErrProcessing{Op: "halftone", Err: fmt.Errorf("dot pitch must be at least 2 pixels, got %g", pitch)}
+	}
+
+	// Average the tone over roughly one cell so each dot reflects its area
+	smooth := toRGBA(toGray(img))
+	blurRegion(smooth, smooth.Bounds(), max(1, int(pitch/2)))
+	bounds := smooth.Bounds()
+
+	out := image.NewGray(bounds)
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// Position in the rotated screen and the center of its cell
+			px, py := float64(x)+0.5, float64(y)+0.5
+			u := px*cos + py*sin
+			v := -px*sin + py*cos
+			cu := (math.Floor(u/pitch) + 0.5) * pitch
+			cv := (math.Floor(v/pitch) + 0.5) * pitch
+
+			// Sample the tone at the cell center, back in image coordinates
+			sx := int(cu*cos - cv*sin)
+			sy := int(cu*sin + cv*cos)
+			sx = min(max(sx, bounds.Min.X), bounds.Max.X-1)
+			sy = min(max(sy, bounds.Min.Y), bounds.Max.Y-1)
+			darkness := 1 - float64(smooth.RGBAAt(sx, sy).R)/255
+
+			// A dot whose area is darkness times the cell area, anti-aliased over one pixel
+			radius := pitch * math.Sqrt(darkness/math.Pi)
+			distance := math.Hypot(u-cu, v-cv)
+			coverage := min(max(radius-distance+0.5, 0), 1)
+			out.SetGray(x, y, color.Gray{Y: uint8(255 * (1 - coverage))})
+		}
+	}
+
+	return out, nil
+}
+
+// ComicImage renders the image in a comic book style: the colors are smoothed
+// and posterized to a few flat tones per channel and strong edges are inked in black.
+// It takes the paths of the input and output files, the number of tones per
+// channel and the edge strength (Sobel magnitude) above which pixels are inked.
+// Returns an error if the operation fails.
+func ComicImage(inputPath string, outputPath string, levels int, edgeThreshold float64) error {
+	slog.Info("rendering comic",
+		"input", inputPath,
+		"levels", levels,
+		"edge_threshold", edgeThreshold)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	out, err := Comic(img, levels, edgeThreshold)
+	if err != nil {
+		return err
+	}
+	return saveJPEG(outputPath, out)
+}
+
+// ComicImageReader renders the image read from r in a comic book style like
+// ComicImage and writes it to w as JPEG.
+// Returns an error if the operation fails.
+func ComicImageReader(r io.Reader, w io.Writer, levels int, edgeThreshold float64) error {
+	img, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	out, err := Comic(img, levels, edgeThreshold)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, out)
+}
+
+// Comic renders the image in a comic book style, like ComicImage.
+// Returns an error if the number of levels is out of range.
+func Comic(img image.Image, levels int, edgeThreshold float64) (image.Image, error) {
+	if levels < 2 || levels > 256 {
+		return nil, &ErrProcessing{Op: "comic", Err: fmt.Errorf("levels must be between 2 and 256, got %d", levels)}
+	}
+
+	out := toRGBA(img)
+	blurRegion(out, out.Bounds(), 1)
+	_, _, magnitude := sobelGradients(toGray(out))
+
+	tones := posterizeTable(levels)
+	for i := 0; i < len(out.Pix); i += 4 {
+		if magnitude[i/4] > edgeThreshold {
+			out.Pix[i], out.Pix[i+1], out.Pix[i+2] = 0, 0, 0
+			continue
+		}
+		for c := 0; c < 3; c++ {
+			out.Pix[i+c] = tones[out.Pix[i+c]]
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHalftoneImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_halftone.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_halftone.jpg")
+	img := image.NewGray(image.Rect(0, 0, 120, 120))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.Gray{Y: 128}}, image.Point{}, draw.Src)
+	if err := saveJPEG(testInputPath, img); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+
+	if err := HalftoneImage(testInputPath, testOutputPath, 8, 45); err != nil {
+		t.Fatalf("Failed to render halftone: %v", err)
+	}
+
+	out, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load output image: %v", err)
+	}
+	gray := toGray(out)
+	var sum float64
+	dark, light := 0, 0
+	for _, v := range gray.Pix {
+		sum += float64(v)
+		if v < 64 {
+			dark++
+		} else if v > 192 {
+			light++
+		}
+	}
+	// Mid gray becomes dots covering about half of the area
+	if mean := sum / float64(len(gray.Pix)); math.Abs(mean-128) > 20 {
+		t.Errorf("Expected the halftone to keep the mean tone near 128, got %.1f", mean)
+	}
+	if dark < len(gray.Pix)/4 || light < len(gray.Pix)/4 {
+		t.Errorf("Expected a mix of black dots and white paper, got %d dark and %d light pixels", dark, light)
+	}
+
+	if err := HalftoneImage(testInputPath, testOutputPath, 1, 0); err == nil {
+		t.Errorf("Expected an error for a pitch below 2 pixels")
+	}
+}
+
+func TestComicImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// Two flat areas separated by a sharp vertical edge
+	testInputPath := filepath.Join(testDir, "test_input_comic.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_comic.jpg")
+	img := image.NewRGBA(image.Rect(0, 0, 100, 60))
+	draw.Draw(img, image.Rect(0, 0, 50, 60), &image.Uniform{color.RGBA{R: 100, G: 100, B: 100, A: 255}}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(50, 0, 100, 60), &image.Uniform{color.RGBA{R: 240, G: 240, B: 240, A: 255}}, image.Point{}, draw.Src)
+	if err := saveJPEG(testInputPath, img); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+
+	if err := ComicImage(testInputPath, testOutputPath, 3, 150); err != nil {
+		t.Fatalf("Failed to render comic: %v", err)
+	}
+
+	out, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load output image: %v", err)
+	}
+	rgba := toRGBA(out)
+	if c := rgba.RGBAAt(50, 30); c.R > 60 {
+		t.Errorf("Expected the edge to be inked, got %v", c)
+	}
+	// With 3 levels 100 posterizes to 128 and 240 to 255
+	if c := rgba.RGBAAt(20, 30); math.Abs(float64(c.R)-128) > 10 {
+		t.Errorf("Expected the dark area to posterize to 128, got %v", c)
+	}
+	if c := rgba.RGBAAt(80, 30); c.R < 245 {
+		t.Errorf("Expected the light area to posterize to 255, got %v", c)
+	}
+}
@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"math"
+	"slices"
+	"sync"
+)
+
+// tableCache keeps tables computed from parameters, such as lookup tables and
+// filter weights, so a batch applying the same settings to many images builds
+// them once instead of once per file. The tables are shared by concurrent
+// calls and must not be modified. Once the cache holds limit tables, adding
+// one drops the least recently used.
+type tableCache[K comparable, V any] struct {
+	mu     sync.Mutex
+	limit  int
+	tables map[K]V
+	// recent holds the keys from the least to the most recently used
+	recent []K
+}
+
+// newTableCache creates a cache holding up to limit tables
+func newTableCache[K comparable, V any](limit int) *tableCache[K, V] {
+	return &tableCache[K, V]{limit: limit, tables: make(map[K]V)}
+}
+
+// get returns the table of key, building it with build when it is not cached.
+// Tables are built outside the lock, so concurrent misses on the same key
+// may build it twice; the first one stored wins.
+func (c *tableCache[K, V]) get(key K, build func() V) V {
+	if key != key {
+		// A NaN never matches itself, so its table could never be found
+		return build()
+	}
+	c.mu.Lock()
+	if table, ok := c.tables[key]; ok {
+		c.touch(key)
+		c.mu.Unlock()
+		return table
+	}
+	c.mu.Unlock()
+
+	table := build()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.tables[key]; ok {
+		c.touch(key)
+		return cached
+	}
+	if len(c.recent) >= c.limit {
+		delete(c.tables, c.recent[0])
+		c.recent = c.recent[1:]
+	}
+	c.tables[key] = table
+	c.recent = append(c.recent, key)
+	return table
+}
+
+// touch marks key as the most recently used
+func (c *tableCache[K, V]) touch(key K) {
+	if i := slices.Index(c.recent, key); i >= 0 {
+		c.recent = append(slices.Delete(c.recent, i, i+1), key)
+	}
+}
+
+// resamplingKey identifies the weights resampling n samples to m
+type resamplingKey struct {
+	n, m          int
+	interpolation Interpolation
+}
+
+var (
+	// resamplings holds filter weights; they grow with the image size, so
+	// only a few are kept
+	resamplings = newTableCache[resamplingKey, resampling](8)
+	// posterizeTables maps components to the tones of a number of levels
+	posterizeTables = newTableCache[int, *[256]uint8](64)
+	// saturationTables scales chroma components by a factor
+	saturationTables = newTableCache[float64, *[256]uint8](64)
+	// blackPointTables stretch components from a black point to white
+	blackPointTables = newTableCache[uint8, *[256]uint8](256)
+)
+
+// resamplingFor is newResampling, cached
+func resamplingFor(n, m int, interpolation Interpolation) resampling {
+	return resamplings.get(resamplingKey{n, m, interpolation}, func() resampling {
+		return newResampling(n, m, interpolation)
+	})
+}
+
+// posterizeTable maps an 8-bit component to the nearest of levels tones
+// spread evenly from 0 to 255
+func posterizeTable(levels int) *[256]uint8 {
+	return posterizeTables.get(levels, func() *[256]uint8 {
+		var table [256]uint8
+		step := 255 / float64(levels-1)
+		for v := range table {
+			table[v] = uint8(math.Round(float64(v)/step)*step + 0.5)
+		}
+		return &table
+	})
+}
+
+// saturationTable scales the distance of a chroma component from neutral by
+// factor, clamped to 8 bits
+func saturationTable(factor float64) *[256]uint8 {
+	return saturationTables.get(factor, func() *[256]uint8 {
+		var table [256]uint8
+		for v := range table {
+			table[v] = uint8(min(max(128+(float64(v)-128)*factor, 0), 255) + 0.5)
+		}
+		return &table
+	})
+}
+
+// blackPointTable maps black and below to 0 and stretches the components
+// above it linearly up to 255
+func blackPointTable(black uint8) *[256]uint8 {
+	return blackPointTables.get(black, func() *[256]uint8 {
+		var table [256]uint8
+		for v := range table {
+			s := (float64(v) - float64(black)) * 255 / (255 - float64(black))
+			table[v] = uint8(min(max(s, 0), 255) + 0.5)
+		}
+		return &table
+	})
+}
@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTableCache(t *testing.T) {
+	cache := newTableCache[int, int](2)
+	builds := 0
+	get := func(key int) int {
+		return cache.get(key, func() int {
+			builds++
+			return key * 10
+		})
+	}
+
+	if get(1) != 10 || get(1) != 10 || builds != 1 {
+		t.Errorf("Expected one build for a repeated key, got %d", builds)
+	}
+	get(2)
+	get(1)
+	// 2 is the least recently used and makes room for 3
+	get(3)
+	builds = 0
+	get(1)
+	get(3)
+	if builds != 0 {
+		t.Errorf("Expected 1 and 3 cached, got %d builds", builds)
+	}
+	if get(2); builds != 1 {
+		t.Errorf("Expected 2 dropped, got %d builds", builds)
+	}
+
+	nan := newTableCache[float64, int](2)
+	for range 3 {
+		nan.get(math.NaN(), func() int { return 0 })
+	}
+	if len(nan.tables) != 0 {
+		t.Errorf("Expected NaN keys not cached, got %d tables", len(nan.tables))
+	}
+
+	// Identical settings share their tables
+	if a, b := resamplingFor(640, 320, Lanczos3), resamplingFor(640, 320, Lanczos3); &a.start[0] != &b.start[0] {
+		t.Error("Expected the resampling weights reused")
+	}
+	if posterizeTable(4) != posterizeTable(4) {
+		t.Error("Expected the posterize table reused")
+	}
+	if tones := posterizeTable(2); tones[0] != 0 || tones[127] != 0 || tones[128] != 255 {
+		t.Errorf("Expected two tones, got %v", tones)
+	}
+}
@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/okamyuji/go-image-processor/config"
+)
+
+// errUnknownAPIKey is returned for requests whose key matches no tenant
+var errUnknownAPIKey = errors.New("unknown API key")
+
+// LookupTenant returns the tenant an API key belongs to. When no tenants are
+// configured every request is accepted and the tenant is nil.
+// Returns an error if tenants are configured and the key matches none.
+func LookupTenant(apiKey string) (*config.Tenant, error) {
+	tenants := currentConfig().Tenants
+	if len(tenants) == 0 {
+		return nil, nil
+	}
+	for i := range tenants {
+		t := &tenants[i]
+		if t.APIKey != "" && subtle.ConstantTimeCompare([]byte(t.APIKey), []byte(apiKey)) == 1 {
+			return t, nil
+		}
+	}
+	return nil, &ErrProcessing{Op: "tenant", Err: errUnknownAPIKey}
+}
+
+// resolveTenantLocation confines a location of a tenant's request to the
+// tenant's root, when it has one, and to the roots of the worker.
+// Returns the location to open, or an error if it is outside them.
+func resolveTenantLocation(t *config.Tenant, location string, roots []string) (string, error) {
+	if t != nil && t.Root != "" {
+		resolved, err := ResolveLocation(location, []string{t.Root})
+		if err != nil {
+			return "", err
+		}
+		location = resolved
+	}
+	return ResolveLocation(location, roots)
+}
+
+// tenantRecipe returns the recipe a tenant's request asks for, a preset when
+// one is named, and checks that the tenant may use all of its steps
+func tenantRecipe(t *config.Tenant, preset string, source string) (*Recipe, error) {
+	if preset != "" {
+		if t == nil {
+			return nil, &ErrProcessing{Op: "tenant", Err: errors.New("presets need a tenant")}
+		}
+		var ok bool
+		if source, ok = t.Presets[preset]; !ok {
+			return nil, &ErrProcessing{Op: "tenant", Err: fmt.Errorf("unknown preset %q", preset)}
+		}
+	}
+	recipe, err := ParseRecipe(source)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil && len(t.Operations) > 0 {
+		for _, name := range recipe.Operations() {
+			if !slices.Contains(t.Operations, name) {
+				return nil, &ErrProcessing{Op: "tenant", Err: fmt.Errorf("operation %q is not allowed for %s", name, t.Name)}
+			}
+		}
+	}
+	return recipe, nil
+}
+
+// checkTenantSize returns an error if an image of the given header is larger
+// than the limits of a tenant
+func checkTenantSize(t *config.Tenant, c image.Config) error {
+	if (t.MaxWidth > 0 && c.Width > t.MaxWidth) || (t.MaxHeight > 0 && c.Height > t.MaxHeight) {
+		return &ErrProcessing{Op: "tenant", Err: fmt.Errorf("%dx%d input exceeds the %dx%d limit of %s", c.Width, c.Height, t.MaxWidth, t.MaxHeight, t.Name)}
+	}
+	return nil
+}
+
+// runTenantRecipe runs a recipe within the limits of a tenant: inputs over
+// the size limit are rejected, quality steps are capped and the tenant's
+// watermark is stamped on the output. A nil tenant has no limits.
+// The recipe stops when ctx is cancelled.
+func runTenantRecipe(ctx context.Context, t *config.Tenant, recipe *Recipe, inputPath string, outputPath string) (*RecipeResult, error) {
+	if t == nil {
+		return recipe.RunContext(ctx, inputPath, outputPath, RecipeOptions{})
+	}
+	if t.MaxWidth > 0 || t.MaxHeight > 0 {
+		file, err := os.Open(inputPath)
+		if err != nil {
+			return nil, &ErrInvalidInput{Path: inputPath, Err: err}
+		}
+		c, _, err := image.DecodeConfig(file)
+		file.Close()
+		if err != nil {
+			return nil, &ErrInvalidInput{Path: inputPath, Err: err}
+		}
+		if err := checkTenantSize(t, c); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := RecipeOptions{MaxQuality: t.MaxQuality}
+	if t.Watermark == nil {
+		return recipe.RunContext(ctx, inputPath, outputPath, opts)
+	}
+	unmarked := filepath.Join(filepath.Dir(outputPath), hiddenName(filepath.Base(outputPath), ".unmarked"))
+	defer os.Remove(unmarked)
+	result, err := recipe.RunContext(ctx, inputPath, unmarked, opts)
+	if err != nil {
+		return nil, err
+	}
+	position := t.Watermark.Position
+	if position == "" {
+		position = WatermarkAuto
+	}
+	slog.Info("applying tenant watermark", "tenant", t.Name)
+	if _, err := WatermarkImage(unmarked, t.Watermark.Image, outputPath, WatermarkOptions{
+		Position: position,
+		Scale:    t.Watermark.Scale,
+		Opacity:  t.Watermark.Opacity,
+	}); err != nil {
+		return nil, err
+	}
+	result.Steps = append(result.Steps, "watermark")
+	return result, nil
+}
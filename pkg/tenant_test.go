@@ -0,0 +1,141 @@
+package processor
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/okamyuji/go-image-processor/config"
+)
+
+func TestRecipeOperations(t *testing.T) {
+	recipe, err := ParseRecipe("if width > 100 then fit 100 100\nrepeat denoise until noise < 2\nfit 50 50\nquality 90")
+	if err != nil {
+		t.Fatalf("Failed to parse recipe: %v", err)
+	}
+	if got := recipe.Operations(); !slices.Equal(got, []string{"fit", "denoise", "quality"}) {
+		t.Errorf("Unexpected operations %v", got)
+	}
+}
+
+func TestTenantPolicy(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_tenant.jpg")
+	if err := generateSingleTestImage(testInputPath, 200, 100); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	markPath := filepath.Join(testDir, "test_mark.png")
+	mark := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	for i := range mark.Pix {
+		mark.Pix[i] = 255
+	}
+	mark.Set(0, 0, color.Black)
+	if err := savePNG(markPath, mark); err != nil {
+		t.Fatalf("Failed to save watermark: %v", err)
+	}
+
+	original := currentConfig()
+	defer SetConfig(original)
+	c := *original
+	c.Tenants = []config.Tenant{
+		{Name: "archive", APIKey: "key-archive", Operations: []string{"fit", "quality"}, MaxQuality: 60,
+			Presets: map[string]string{"small": "fit 50 50\nquality 95"}},
+		{Name: "marketing", APIKey: "key-marketing", MaxWidth: 100,
+			Watermark: &config.TenantWatermark{Image: markPath, Position: "southeast"}},
+	}
+	SetConfig(&c)
+
+	if _, err := LookupTenant("wrong"); err == nil {
+		t.Error("An unknown key should be rejected")
+	}
+	archive, err := LookupTenant("key-archive")
+	if err != nil || archive.Name != "archive" {
+		t.Fatalf("Expected the archive tenant, got %v (%v)", archive, err)
+	}
+
+	// Presets run with the quality cap
+	recipe, err := tenantRecipe(archive, "small", "")
+	if err != nil {
+		t.Fatalf("Failed to load preset: %v", err)
+	}
+	result, err := runTenantRecipe(context.Background(), archive, recipe, testInputPath, filepath.Join(testDir, "small.jpg"))
+	if err != nil {
+		t.Fatalf("Failed to run preset: %v", err)
+	}
+	if !slices.Equal(result.Steps, []string{"fit 50 50", "quality 60"}) {
+		t.Errorf("Expected the quality to be capped, got %v", result.Steps)
+	}
+
+	if _, err := tenantRecipe(archive, "", "binarize"); err == nil {
+		t.Error("A step outside the allowed operations should be rejected")
+	}
+	if _, err := tenantRecipe(archive, "huge", ""); err == nil {
+		t.Error("An unknown preset should be rejected")
+	}
+
+	// Inputs over the size limit are rejected, smaller ones are watermarked
+	marketing, _ := LookupTenant("key-marketing")
+	recipe, _ = tenantRecipe(marketing, "", "autorotate")
+	if _, err := runTenantRecipe(context.Background(), marketing, recipe, testInputPath, filepath.Join(testDir, "big.jpg")); err == nil {
+		t.Error("An input over the size limit should be rejected")
+	}
+	smallPath := filepath.Join(testDir, "small.jpg")
+	result, err = runTenantRecipe(context.Background(), marketing, recipe, smallPath, filepath.Join(testDir, "marked.jpg"))
+	if err != nil {
+		t.Fatalf("Failed to run recipe: %v", err)
+	}
+	if result.Steps[len(result.Steps)-1] != "watermark" {
+		t.Errorf("Expected a watermark step, got %v", result.Steps)
+	}
+	if _, err := os.Stat(filepath.Join(testDir, "marked.jpg")); err != nil {
+		t.Errorf("Expected a watermarked output: %v", err)
+	}
+}
+
+func TestTenantRoot(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	for _, dir := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(testDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create tenant directory: %v", err)
+		}
+	}
+	if err := generateSingleTestImage(filepath.Join(testDir, "a", "in.jpg"), 40, 20); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	original := currentConfig()
+	defer SetConfig(original)
+	c := *original
+	c.Tenants = []config.Tenant{
+		{Name: "a", APIKey: "key-a", Root: filepath.Join(testDir, "a")},
+		{Name: "b", APIKey: "key-b", Root: filepath.Join(testDir, "b")},
+	}
+	SetConfig(&c)
+
+	roots := []string{testDir}
+	result := processRequest(context.Background(), WorkRequest{ID: "1", APIKey: "key-a", Source: "in.jpg", Output: "out.jpg", Recipe: "binarize"}, roots)
+	if result.Status != "ok" {
+		t.Fatalf("Expected a request inside the tenant root to succeed, got %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(testDir, "a", "out.jpg")); err != nil {
+		t.Errorf("Expected the output inside the tenant root: %v", err)
+	}
+
+	for _, req := range []WorkRequest{
+		{ID: "2", APIKey: "key-b", Source: filepath.Join(testDir, "a", "in.jpg"), Output: "out.jpg", Recipe: "binarize"},
+		{ID: "3", APIKey: "key-b", Source: "../a/in.jpg", Output: "out.jpg", Recipe: "binarize"},
+		{ID: "4", APIKey: "key-a", Source: "in.jpg", Output: filepath.Join(testDir, "b", "out.jpg"), Recipe: "binarize"},
+	} {
+		if result := processRequest(context.Background(), req, roots); result.Status != "error" {
+			t.Errorf("Expected request %s outside the tenant root to fail, got %+v", req.ID, result)
+		}
+	}
+}
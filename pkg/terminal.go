@@ -0,0 +1,110 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+
+	"github.com/nfnt/resize"
+)
+
+// asciiRamp lists characters from lightest to darkest coverage
+const asciiRamp = " .:-=+*#%@"
+
+// TerminalPreviewOptions controls RenderTerminalPreview
+type TerminalPreviewOptions struct {
+	// Width is the number of terminal columns to use
+	Width int
+	// ASCII renders plain characters instead of ANSI truecolor blocks, for
+	// terminals without color support
+	ASCII bool
+}
+
+// RenderTerminalPreview writes a downscaled rendering of the image for viewing in a terminal.
+// In the default mode every character cell shows two pixels with the upper half
+// block and 24-bit ANSI colors; in ASCII mode the brightness picks a character.
+// It takes the writer to render to, the path of the input file and the options.
+// Returns an error if the operation fails.
+func RenderTerminalPreview(w io.Writer, inputPath string, opts TerminalPreviewOptions) error {
+	slog.Info("rendering terminal preview",
+		"input", inputPath,
+		"width", opts.Width,
+		"ascii", opts.ASCII)
+
+	if opts.Width < 1 {
+		return &ErrProcessing{Op: "preview", Err: fmt.Errorf("width must be positive, got %d", opts.Width)}
+	}
+
+	// Large JPEG files only need their DC coefficients at terminal resolution
+	img, err := loadPreviewSource(inputPath, opts.Width)
+	if err != nil {
+		return err
+	}
+	return renderTerminalPreview(w, img, opts)
+}
+
+// RenderTerminalPreviewReader writes a rendering of the image read from r for
+// viewing in a terminal, like RenderTerminalPreview.
+// Returns an error if the operation fails.
+func RenderTerminalPreviewReader(r io.Reader, w io.Writer, opts TerminalPreviewOptions) error {
+	if opts.Width < 1 {
+		return &ErrProcessing{Op: "preview", Err: fmt.Errorf("width must be positive, got %d", opts.Width)}
+	}
+	img, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	return renderTerminalPreview(w, img, opts)
+}
+
+// renderTerminalPreview downscales the image to the terminal width and writes it
+func renderTerminalPreview(w io.Writer, img image.Image, opts TerminalPreviewOptions) error {
+	// Terminal cells are about twice as tall as they are wide
+	bounds := img.Bounds()
+	columns := min(opts.Width, bounds.Dx())
+	rows := max(1, int(float64(bounds.Dy())*float64(columns)/float64(bounds.Dx())/2+0.5))
+
+	out := bufio.NewWriter(w)
+	if opts.ASCII {
+		small := toGray(resize.Resize(uint(columns), uint(rows), img, resize.Bilinear))
+		writeASCII(out, small)
+	} else {
+		small := toRGBA(resize.Resize(uint(columns), uint(rows*2), img, resize.Bilinear))
+		writeANSIBlocks(out, small)
+	}
+	if err := out.Flush(); err != nil {
+		return &ErrProcessing{Op: "preview", Err: err}
+	}
+	return nil
+}
+
+// writeASCII writes one character per pixel, darker pixels getting denser characters
+func writeASCII(w *bufio.Writer, gray *image.Gray) {
+	bounds := gray.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			darkness := 255 - int(gray.GrayAt(x, y).Y)
+			w.WriteByte(asciiRamp[darkness*(len(asciiRamp)-1)/255])
+		}
+		w.WriteByte('\n')
+	}
+}
+
+// writeANSIBlocks writes the image two rows at a time as upper half blocks,
+// with the top pixel as the foreground and the bottom pixel as the background color
+func writeANSIBlocks(w *bufio.Writer, img *image.RGBA) {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 2 {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			top := img.RGBAAt(x, y)
+			bottom := top
+			if y+1 < bounds.Max.Y {
+				bottom = img.RGBAAt(x, y+1)
+			}
+			fmt.Fprintf(w, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀", top.R, top.G, top.B, bottom.R, bottom.G, bottom.B)
+		}
+		w.WriteString("\x1b[0m\n")
+	}
+}
@@ -0,0 +1,52 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderTerminalPreview(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// Black left half, white right half
+	testInputPath := filepath.Join(testDir, "test_input_preview.jpg")
+	img := image.NewRGBA(image.Rect(0, 0, 80, 40))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 40, 40), &image.Uniform{color.Black}, image.Point{}, draw.Src)
+	if err := saveJPEG(testInputPath, img); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+
+	var ascii bytes.Buffer
+	if err := RenderTerminalPreview(&ascii, testInputPath, TerminalPreviewOptions{Width: 20, ASCII: true}); err != nil {
+		t.Fatalf("Failed to render ASCII preview: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(ascii.String(), "\n"), "\n")
+	// 20 columns of an image twice as wide as tall, with cells twice as tall as wide
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 lines, got %d:\n%s", len(lines), ascii.String())
+	}
+	for _, line := range lines {
+		if len(line) != 20 || line[0] != '@' || line[19] != ' ' {
+			t.Errorf("Expected a dark left half and a light right half, got %q", line)
+		}
+	}
+
+	var ansi bytes.Buffer
+	if err := RenderTerminalPreview(&ansi, testInputPath, TerminalPreviewOptions{Width: 20}); err != nil {
+		t.Fatalf("Failed to render ANSI preview: %v", err)
+	}
+	if strings.Count(ansi.String(), "▀") != 100 {
+		t.Errorf("Expected 20x5 half blocks, got %d", strings.Count(ansi.String(), "▀"))
+	}
+	if !strings.Contains(ansi.String(), "\x1b[0m\n") {
+		t.Errorf("Expected every line to reset the colors")
+	}
+}
@@ -0,0 +1,415 @@
+package processor
+
+import (
+	"image"
+	"io"
+	"log/slog"
+	"math"
+	"sort"
+)
+
+// TextRegions holds the text areas found by DetectTextRegions.
+// Words are grouped into Lines; both are reported in image coordinates.
+type TextRegions struct {
+	Words []Box `json:"words"`
+	Lines []Box `json:"lines"`
+}
+
+// swtMaxStroke is the longest ray, in pixels, followed when measuring stroke width
+const swtMaxStroke = 60
+
+// swtEdgeThreshold is the minimum Sobel magnitude for a pixel to count as an edge
+const swtEdgeThreshold = 100
+
+// letterCandidate is a connected component of similar stroke widths
+type letterCandidate struct {
+	rect        image.Rectangle
+	strokeWidth float64
+}
+
+// DetectTextRegions finds text in the input image using the stroke width transform.
+// It takes the path of the input file.
+// Returns the detected word and line bounding boxes, or an error if the operation fails.
+func DetectTextRegions(inputPath string) (*TextRegions, error) {
+	slog.Info("detecting text regions", "input", inputPath)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return detectTextRegions(toGray(img)), nil
+}
+
+// DetectTextRegionsReader finds text in the image read from r like DetectTextRegions.
+// Returns the detected word and line bounding boxes, or an error if the operation fails.
+func DetectTextRegionsReader(r io.Reader) (*TextRegions, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	return detectTextRegions(toGray(img)), nil
+}
+
+// detectTextRegions runs the stroke width transform for dark-on-light and
+// light-on-dark text and groups the surviving letters into words and lines
+func detectTextRegions(gray *image.Gray) *TextRegions {
+	gx, gy, mag := sobelGradients(gray)
+	edges := thinEdges(gray.Bounds(), gx, gy, mag)
+
+	// Each polarity is grouped on its own; a line from the second pass is
+	// dropped when it mostly lies inside one already found (e.g. glyph counters)
+	var lines [][]image.Rectangle
+	for _, darkOnLight := range []bool{true, false} {
+		swt := strokeWidthTransform(gray.Bounds(), edges, gx, gy, mag, darkOnLight)
+		for _, line := range groupLetters(findLetters(gray.Bounds(), swt)) {
+			if !coveredBy(unionRects(line), lines) {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	regions := &TextRegions{Words: []Box{}, Lines: []Box{}}
+	for _, line := range lines {
+		regions.Lines = append(regions.Lines, boxFromRect(unionRects(line)))
+		for _, word := range splitWords(line) {
+			regions.Words = append(regions.Words, boxFromRect(unionRects(word)))
+		}
+	}
+	return regions
+}
+
+// sobelGradients returns the horizontal and vertical Sobel responses and their magnitude
+func sobelGradients(gray *image.Gray) (gx, gy, mag []float64) {
+	bounds := gray.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	gx = make([]float64, w*h)
+	gy = make([]float64, w*h)
+	mag = make([]float64, w*h)
+
+	sobelGray(gray, func(y int, dx, dy []int32) {
+		row := y*w + 1
+		for i := range dx {
+			gx[row+i], gy[row+i] = float64(dx[i]), float64(dy[i])
+			mag[row+i] = math.Sqrt(float64(dx[i]*dx[i] + dy[i]*dy[i]))
+		}
+	})
+	return gx, gy, mag
+}
+
+// thinEdges keeps only edge pixels that are local maxima along the gradient direction
+func thinEdges(bounds image.Rectangle, gx, gy, mag []float64) []bool {
+	w, h := bounds.Dx(), bounds.Dy()
+	edges := make([]bool, w*h)
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			if mag[i] < swtEdgeThreshold {
+				continue
+			}
+			dx := int(math.Round(gx[i] / mag[i]))
+			dy := int(math.Round(gy[i] / mag[i]))
+			if mag[i] >= mag[(y+dy)*w+x+dx] && mag[i] >= mag[(y-dy)*w+x-dx] {
+				edges[i] = true
+			}
+		}
+	}
+	return edges
+}
+
+// strokeWidthTransform assigns every pixel the width of the stroke it most likely belongs to.
+// Pixels not covered by any stroke are left at zero.
+func strokeWidthTransform(bounds image.Rectangle, edges []bool, gx, gy, mag []float64, darkOnLight bool) []float64 {
+	w, h := bounds.Dx(), bounds.Dy()
+	swt := make([]float64, w*h)
+	var rays [][]int
+
+	sign := 1.0
+	if darkOnLight {
+		// The gradient points from dark to light, so strokes lie against it
+		sign = -1.0
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			if !edges[i] {
+				continue
+			}
+			dx := sign * gx[i] / mag[i]
+			dy := sign * gy[i] / mag[i]
+
+			ray := []int{i}
+			fx, fy := float64(x)+0.5, float64(y)+0.5
+			for step := 0; step < swtMaxStroke*2; step++ {
+				fx += dx * 0.5
+				fy += dy * 0.5
+				cx, cy := int(fx), int(fy)
+				if cx < 0 || cy < 0 || cx >= w || cy >= h {
+					break
+				}
+				j := cy*w + cx
+				if j == ray[len(ray)-1] {
+					continue
+				}
+				ray = append(ray, j)
+				if !edges[j] {
+					continue
+				}
+				// Opposite edge must have a roughly opposite gradient
+				qx := sign * gx[j] / mag[j]
+				qy := sign * gy[j] / mag[j]
+				if dx*qx+dy*qy < -math.Cos(math.Pi/6) {
+					width := math.Hypot(float64(cx-x), float64(cy-y))
+					for _, p := range ray {
+						if swt[p] == 0 || width < swt[p] {
+							swt[p] = width
+						}
+					}
+					rays = append(rays, ray)
+				}
+				break
+			}
+		}
+	}
+
+	// Clamp each ray to its median so corners don't inflate the stroke width
+	for _, ray := range rays {
+		values := make([]float64, len(ray))
+		for k, p := range ray {
+			values[k] = swt[p]
+		}
+		sort.Float64s(values)
+		median := values[len(values)/2]
+		for _, p := range ray {
+			if swt[p] > median {
+				swt[p] = median
+			}
+		}
+	}
+	return swt
+}
+
+// findLetters groups pixels with similar stroke widths into components and
+// keeps only those that look like glyphs
+func findLetters(bounds image.Rectangle, swt []float64) []letterCandidate {
+	w, h := bounds.Dx(), bounds.Dy()
+	parent := make([]int, w*h)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	similar := func(a, b float64) bool {
+		return a > 0 && b > 0 && math.Max(a, b)/math.Min(a, b) <= 3.0
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			if swt[i] == 0 {
+				continue
+			}
+			if x+1 < w && similar(swt[i], swt[i+1]) {
+				parent[find(i+1)] = find(i)
+			}
+			if y+1 < h && similar(swt[i], swt[i+w]) {
+				parent[find(i+w)] = find(i)
+			}
+			if y+1 < h && x+1 < w && similar(swt[i], swt[i+w+1]) {
+				parent[find(i+w+1)] = find(i)
+			}
+			if y+1 < h && x > 0 && similar(swt[i], swt[i+w-1]) {
+				parent[find(i+w-1)] = find(i)
+			}
+		}
+	}
+
+	type component struct {
+		rect   image.Rectangle
+		widths []float64
+	}
+	// The components are kept in the order they are found, so the letters
+	// come out in the same order on every run
+	components := map[int]*component{}
+	var found []*component
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			if swt[i] == 0 {
+				continue
+			}
+			root := find(i)
+			c, ok := components[root]
+			if !ok {
+				c = &component{rect: image.Rect(x, y, x+1, y+1)}
+				components[root] = c
+				found = append(found, c)
+			}
+			c.rect = c.rect.Union(image.Rect(x, y, x+1, y+1))
+			c.widths = append(c.widths, swt[i])
+		}
+	}
+
+	var letters []letterCandidate
+	for _, c := range found {
+		cw, ch := c.rect.Dx(), c.rect.Dy()
+		if len(c.widths) < 10 || ch < 6 || ch > h*3/4 || cw > w*3/4 {
+			continue
+		}
+		aspect := float64(cw) / float64(ch)
+		if aspect < 0.05 || aspect > 10 {
+			continue
+		}
+		mean, variance := meanVariance(c.widths)
+		if variance > mean*mean {
+			continue
+		}
+		sort.Float64s(c.widths)
+		median := c.widths[len(c.widths)/2]
+		diameter := math.Hypot(float64(cw), float64(ch))
+		if diameter/median > 15 {
+			continue
+		}
+		letters = append(letters, letterCandidate{
+			rect:        c.rect.Add(bounds.Min),
+			strokeWidth: median,
+		})
+	}
+	return letters
+}
+
+// groupLetters chains letters of similar height and stroke that sit on the same baseline
+func groupLetters(letters []letterCandidate) [][]image.Rectangle {
+	n := len(letters)
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			i = parent[i]
+		}
+		return i
+	}
+
+	for i := 0; i < n; i++ {
+		a := letters[i]
+		for j := i + 1; j < n; j++ {
+			b := letters[j]
+			ha, hb := float64(a.rect.Dy()), float64(b.rect.Dy())
+			if math.Max(ha, hb)/math.Min(ha, hb) > 2 {
+				continue
+			}
+			if math.Max(a.strokeWidth, b.strokeWidth)/math.Min(a.strokeWidth, b.strokeWidth) > 2 {
+				continue
+			}
+			ca := float64(a.rect.Min.Y+a.rect.Max.Y) / 2
+			cb := float64(b.rect.Min.Y+b.rect.Max.Y) / 2
+			if math.Abs(ca-cb) > math.Max(ha, hb)/2 {
+				continue
+			}
+			gap := math.Max(float64(b.rect.Min.X-a.rect.Max.X), float64(a.rect.Min.X-b.rect.Max.X))
+			if gap > 3*math.Max(ha, hb) {
+				continue
+			}
+			parent[find(j)] = find(i)
+		}
+	}
+
+	groups := map[int][]image.Rectangle{}
+	var roots []int
+	for i, l := range letters {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], l.rect)
+	}
+
+	var lines [][]image.Rectangle
+	for _, root := range roots {
+		g := groups[root]
+		// A lone component is more likely noise than a line of text
+		if len(g) < 2 {
+			continue
+		}
+		sort.Slice(g, func(i, j int) bool { return g[i].Min.X < g[j].Min.X })
+		lines = append(lines, g)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		a, b := unionRects(lines[i]), unionRects(lines[j])
+		if a.Min.Y != b.Min.Y {
+			return a.Min.Y < b.Min.Y
+		}
+		return a.Min.X < b.Min.X
+	})
+	return lines
+}
+
+// splitWords splits a line of letters, sorted by x, at gaps wider than the letter height
+func splitWords(line []image.Rectangle) [][]image.Rectangle {
+	heights := make([]int, len(line))
+	for i, r := range line {
+		heights[i] = r.Dy()
+	}
+	sort.Ints(heights)
+	maxGap := heights[len(heights)/2] * 3 / 4
+
+	var words [][]image.Rectangle
+	current := []image.Rectangle{line[0]}
+	right := line[0].Max.X
+	for _, r := range line[1:] {
+		if r.Min.X-right > maxGap {
+			words = append(words, current)
+			current = nil
+		}
+		current = append(current, r)
+		if r.Max.X > right {
+			right = r.Max.X
+		}
+	}
+	return append(words, current)
+}
+
+// unionRects returns the smallest rectangle containing all the given rectangles
+func unionRects(rects []image.Rectangle) image.Rectangle {
+	var u image.Rectangle
+	for _, r := range rects {
+		u = u.Union(r)
+	}
+	return u
+}
+
+// coveredBy reports whether more than half of r lies inside one of the lines
+func coveredBy(r image.Rectangle, lines [][]image.Rectangle) bool {
+	area := r.Dx() * r.Dy()
+	for _, line := range lines {
+		in := r.Intersect(unionRects(line))
+		if in.Dx()*in.Dy()*2 > area {
+			return true
+		}
+	}
+	return false
+}
+
+// meanVariance returns the mean and population variance of the values
+func meanVariance(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, variance / float64(len(values))
+}
@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// generateTextLikeImage draws two "words" made of bar-shaped glyphs on a white page
+func generateTextLikeImage(outputPath string) error {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 80))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+
+	glyph := func(x0 int) {
+		// A box-shaped glyph with a 3px stroke
+		for y := 30; y < 50; y++ {
+			for x := x0; x < x0+12; x++ {
+				if x < x0+3 || x >= x0+9 || y < 33 || y >= 47 {
+					img.Set(x, y, color.Black)
+				}
+			}
+		}
+	}
+	for _, x := range []int{20, 36, 52, 110, 126, 142} {
+		glyph(x)
+	}
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return jpeg.Encode(out, img, &jpeg.Options{Quality: 95})
+}
+
+func TestDetectTextRegions(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_text.jpg")
+	if err := generateTextLikeImage(testInputPath); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	regions, err := DetectTextRegions(testInputPath)
+	if err != nil {
+		t.Fatalf("Failed to detect text regions: %v", err)
+	}
+
+	if len(regions.Lines) != 1 {
+		t.Fatalf("Expected 1 text line, got %d: %+v", len(regions.Lines), regions.Lines)
+	}
+	if len(regions.Words) != 2 {
+		t.Errorf("Expected 2 words, got %d: %+v", len(regions.Words), regions.Words)
+	}
+	line := regions.Lines[0].Rect()
+	if !line.Overlaps(image.Rect(20, 30, 154, 50)) {
+		t.Errorf("Line box %v does not cover the drawn text", line)
+	}
+}
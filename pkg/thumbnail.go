@@ -0,0 +1,474 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nfnt/resize"
+	"golang.org/x/image/draw"
+)
+
+// ThumbnailFlavors are the sizes of the freedesktop thumbnail cache, by the
+// name of their directory
+var ThumbnailFlavors = map[string]int{
+	"normal":   128,
+	"large":    256,
+	"x-large":  512,
+	"xx-large": 1024,
+}
+
+// thumbnailApp names the directory of this program's failure records
+const thumbnailApp = "go-image-processor"
+
+// thumbnailSharpen is the amount of unsharp masking SquareThumbnail applies,
+// enough to restore the edges the reduction softens without halos
+const thumbnailSharpen = 0.5
+
+// defaultThumbnailInterval is how often ThumbnailDaemon scans by default
+const defaultThumbnailInterval = 10 * time.Second
+
+// thumbnailMIMETypes are the MIME types of the formats thumbnails are made for
+var thumbnailMIMETypes = map[string]string{
+	FormatJPEG: "image/jpeg",
+	FormatPNG:  "image/png",
+}
+
+// ThumbnailDaemonOptions controls ThumbnailDaemon
+type ThumbnailDaemonOptions struct {
+	// Flavors are the cache sizes to fill; empty fills normal and large
+	Flavors []string
+	// Interval is how often the directories are scanned; zero uses ten seconds
+	Interval time.Duration
+}
+
+// WriteThumbnail writes a PNG thumbnail of an image that fits in a square of
+// the given size, following the freedesktop thumbnail specification: the
+// image is turned upright, never enlarged, and the PNG carries the URI,
+// modification time, size and MIME type of the original in Thumb:: text
+// chunks, so file managers can tell when it is stale.
+// It takes the writer, the path of the image and the size in pixels.
+// Returns an error if the image cannot be read.
+func WriteThumbnail(w io.Writer, inputPath string, size int) error {
+	if size <= 0 {
+		return &ErrProcessing{Op: "thumbnail", Err: fmt.Errorf("invalid size %d", size)}
+	}
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return &ErrInvalidInput{Path: inputPath, Err: err}
+	}
+	img, err := loadPreviewSource(inputPath, size)
+	if err != nil {
+		return err
+	}
+	if exif, err := readExif(inputPath); err == nil && exif.Orientation > 1 {
+		img = applyOrientation(img, exif.Orientation)
+	}
+
+	// The preview source may already be scaled down, so the size of the
+	// original is read from its header
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if file, err := os.Open(inputPath); err == nil {
+		if config, _, err := image.DecodeConfig(file); err == nil {
+			width, height = config.Width, config.Height
+		}
+		file.Close()
+	}
+	if b := img.Bounds(); b.Dx() > size || b.Dy() > size {
+		img = resize.Thumbnail(uint(size), uint(size), img, resize.Lanczos3)
+	}
+
+	format, _ := DetectFormat(inputPath)
+	return writeThumbnailPNG(w, img, map[string]string{
+		"Thumb::URI":           thumbnailURI(inputPath),
+		"Thumb::MTime":         strconv.FormatInt(info.ModTime().Unix(), 10),
+		"Thumb::Size":          strconv.FormatInt(info.Size(), 10),
+		"Thumb::Mimetype":      thumbnailMIMETypes[format],
+		"Thumb::Image::Width":  strconv.Itoa(width),
+		"Thumb::Image::Height": strconv.Itoa(height),
+		"Software":             thumbnailApp,
+	})
+}
+
+// ThumbnailImage writes a thumbnail of the input to a file, as WriteThumbnail.
+// It takes the paths of the input and output files and the size in pixels.
+// Returns an error if the operation fails.
+func ThumbnailImage(inputPath string, outputPath string, size int) error {
+	slog.Info("creating thumbnail",
+		"input", inputPath,
+		"output", outputPath,
+		"size", size)
+
+	out, err := createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := WriteThumbnail(out, inputPath, size); err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+// Thumbnail writes a square thumbnail of the input for a gallery, as
+// SquareThumbnail, turned upright first.
+// It takes the paths of the input and output files and the side of the
+// thumbnail in pixels.
+// Returns an error if the size is invalid or the operation fails.
+func Thumbnail(inputPath string, outputPath string, size int) error {
+	slog.Info("creating square thumbnail",
+		"input", inputPath,
+		"output", outputPath,
+		"size", size)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	if exif, err := readExif(inputPath); err == nil && exif.Orientation > 1 {
+		img = applyOrientation(img, exif.Orientation)
+	}
+	thumb, err := SquareThumbnail(img, size)
+	if err != nil {
+		return err
+	}
+	return saveJPEG(outputPath, thumb)
+}
+
+// ThumbnailReader writes a square thumbnail of the image read from r to w as
+// JPEG, like Thumbnail.
+// Returns an error if the size is invalid or the operation fails.
+func ThumbnailReader(r io.Reader, w io.Writer, size int) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return &ErrProcessing{Op: "read", Err: err}
+	}
+	img, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if exif, err := decodeExif(bytes.NewReader(data)); err == nil && exif.Orientation > 1 {
+		img = applyOrientation(img, exif.Orientation)
+	}
+	thumb, err := SquareThumbnail(img, size)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, thumb)
+}
+
+// SquareThumbnail returns a size x size thumbnail of the image, the way a
+// gallery shows it: the largest square in the middle of the image is cut out,
+// averaged over blocks of pixels down to the smallest multiple of size it
+// holds, so that fine detail does not alias, scaled the rest of the way with
+// Catmull-Rom and lightly sharpened against the softness the reduction
+// leaves. Images smaller than size are never enlarged; their square is
+// returned as it is.
+// Returns an error if the size is not positive.
+func SquareThumbnail(img image.Image, size int) (image.Image, error) {
+	if size <= 0 {
+		return nil, &ErrProcessing{Op: "thumbnail", Err: fmt.Errorf("invalid size %d", size)}
+	}
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	if side <= size {
+		return CropCenter(img, side, side)
+	}
+	// The square is trimmed to whole blocks, keeping it centered
+	factor := side / size
+	side -= side % factor
+	square, err := CropCenter(img, side, side)
+	if err != nil {
+		return nil, err
+	}
+	shrunk := boxShrink(toRGBA(square), factor)
+	thumb := shrunk
+	if shrunk.Bounds().Dx() != size {
+		thumb = image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.CatmullRom.Scale(thumb, thumb.Bounds(), shrunk, shrunk.Bounds(), draw.Src, nil)
+	}
+	unsharpMask(thumb, 1, thumbnailSharpen)
+	return thumb, nil
+}
+
+// boxShrink reduces the image by an integer factor, every pixel of the result
+// being the average of a factor x factor block
+func boxShrink(src *image.RGBA, factor int) *image.RGBA {
+	if factor <= 1 {
+		return src
+	}
+	w, h := src.Bounds().Dx()/factor, src.Bounds().Dy()/factor
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	area := factor * factor
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum [4]int
+			for dy := 0; dy < factor; dy++ {
+				row := src.PixOffset(x*factor, y*factor+dy)
+				for i, v := range src.Pix[row : row+4*factor] {
+					sum[i%4] += int(v)
+				}
+			}
+			i := dst.PixOffset(x, y)
+			for c := range sum {
+				dst.Pix[i+c] = uint8((sum[c] + area/2) / area)
+			}
+		}
+	}
+	return dst
+}
+
+// writeThumbnailPNG encodes an image as PNG with tEXt chunks after the header
+func writeThumbnailPNG(w io.Writer, img image.Image, text map[string]string) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return &ErrProcessing{Op: "encode", Err: err}
+	}
+	// The signature and the IHDR chunk take the first 33 bytes
+	data := buf.Bytes()
+	if _, err := w.Write(data[:33]); err != nil {
+		return &ErrProcessing{Op: "write", Err: err}
+	}
+	keys := make([]string, 0, len(text))
+	for key := range text {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if text[key] == "" {
+			continue
+		}
+		if err := writePNGChunk(w, "tEXt", []byte(key+"\x00"+text[key])); err != nil {
+			return &ErrProcessing{Op: "write", Err: err}
+		}
+	}
+	if _, err := w.Write(data[33:]); err != nil {
+		return &ErrProcessing{Op: "write", Err: err}
+	}
+	return nil
+}
+
+// thumbnailURI returns the file URI of a path, which names the thumbnail of
+// the file in the cache
+func thumbnailURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return fileURI(path)
+}
+
+// thumbnailCacheDir returns the root of the shared thumbnail cache
+func thumbnailCacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "thumbnails"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cache", "thumbnails"), nil
+}
+
+// ThumbnailCachePath returns where the thumbnail of a file belongs in the
+// shared thumbnail cache, in $XDG_CACHE_HOME/thumbnails/<flavor>.
+// Returns an error for unknown flavors.
+func ThumbnailCachePath(inputPath string, flavor string) (string, error) {
+	if _, ok := ThumbnailFlavors[flavor]; !ok {
+		return "", fmt.Errorf("unknown thumbnail flavor %q", flavor)
+	}
+	root, err := thumbnailCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := md5.Sum([]byte(thumbnailURI(inputPath)))
+	return filepath.Join(root, flavor, hex.EncodeToString(sum[:])+".png"), nil
+}
+
+// CacheThumbnail makes sure the shared thumbnail cache has an up-to-date
+// thumbnail of a file. Files that cannot be thumbnailed get a failure
+// record, so they are not retried until they change.
+// It takes the path of the image and the cache flavor.
+// Returns whether a thumbnail was written, or an error if the cache cannot
+// be written or the image cannot be thumbnailed.
+func CacheThumbnail(inputPath string, flavor string) (bool, error) {
+	cachePath, err := ThumbnailCachePath(inputPath, flavor)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return false, &ErrInvalidInput{Path: inputPath, Err: err}
+	}
+	failPath := filepath.Join(filepath.Dir(filepath.Dir(cachePath)), "fail", thumbnailApp, filepath.Base(cachePath))
+	if thumbnailCurrent(cachePath, info) || thumbnailCurrent(failPath, info) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o700); err != nil {
+		return false, &ErrInvalidOutput{Path: cachePath, Err: err}
+	}
+	var buf bytes.Buffer
+	thumbErr := WriteThumbnail(&buf, inputPath, ThumbnailFlavors[flavor])
+	target := cachePath
+	if thumbErr != nil {
+		// The failure record is an empty image naming the file
+		buf.Reset()
+		if err := os.MkdirAll(filepath.Dir(failPath), 0o700); err != nil {
+			return false, &ErrInvalidOutput{Path: failPath, Err: err}
+		}
+		if err := writeThumbnailPNG(&buf, image.NewNRGBA(image.Rect(0, 0, 1, 1)), map[string]string{
+			"Thumb::URI":   thumbnailURI(inputPath),
+			"Thumb::MTime": strconv.FormatInt(info.ModTime().Unix(), 10),
+		}); err != nil {
+			return false, err
+		}
+		target = failPath
+	}
+
+	out, err := createOutput(target)
+	if err != nil {
+		return false, err
+	}
+	defer out.Close()
+	if err := out.Chmod(0o600); err != nil {
+		return false, &ErrInvalidOutput{Path: target, Err: err}
+	}
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		return false, &ErrProcessing{Op: "write", Err: err}
+	}
+	if err := out.Commit(); err != nil {
+		return false, err
+	}
+	return thumbErr == nil, thumbErr
+}
+
+// thumbnailCurrent reports whether the thumbnail at path was made from the
+// current version of a file, going by its Thumb::MTime
+func thumbnailCurrent(path string, info os.FileInfo) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return pngText(data)["Thumb::MTime"] == strconv.FormatInt(info.ModTime().Unix(), 10)
+}
+
+// pngText returns the tEXt chunks of PNG data by keyword
+func pngText(data []byte) map[string]string {
+	text := map[string]string{}
+	if len(data) < 8 {
+		return text
+	}
+	for pos := 8; pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		name := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) || name == "IDAT" {
+			break
+		}
+		if name == "tEXt" {
+			if key, value, ok := bytes.Cut(data[pos+8:pos+8+length], []byte{0}); ok {
+				text[string(key)] = string(value)
+			}
+		}
+		pos += 12 + length
+	}
+	return text
+}
+
+// ThumbnailDaemon keeps the shared thumbnail cache filled for the images in
+// some directories and their subdirectories until the context ends. New and
+// changed images are found by scanning the directories, so file managers
+// show their thumbnails without generating them.
+func ThumbnailDaemon(ctx context.Context, dirs []string, opts ThumbnailDaemonOptions) error {
+	flavors := opts.Flavors
+	if len(flavors) == 0 {
+		flavors = []string{"normal", "large"}
+	}
+	for _, flavor := range flavors {
+		if _, ok := ThumbnailFlavors[flavor]; !ok {
+			return fmt.Errorf("unknown thumbnail flavor %q", flavor)
+		}
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultThumbnailInterval
+	}
+	slog.Info("thumbnail daemon started", "dirs", dirs, "flavors", flavors, "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		created := 0
+		for _, dir := range dirs {
+			filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if err != nil {
+					slog.Warn("cannot scan", "path", path, "error", err)
+					return nil
+				}
+				if d.IsDir() {
+					// The cache may live inside a watched directory
+					if path != dir && strings.HasPrefix(d.Name(), ".") {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if !d.Type().IsRegular() || thumbnailMIMETypes[extensionFormat(path)] == "" {
+					return nil
+				}
+				for _, flavor := range flavors {
+					ok, err := CacheThumbnail(path, flavor)
+					if err != nil {
+						slog.Warn("cannot create thumbnail", "path", path, "flavor", flavor, "error", err)
+						break
+					}
+					if ok {
+						created++
+					}
+				}
+				return nil
+			})
+		}
+		if created > 0 {
+			slog.Info("thumbnails created", "count", created)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ThumbnailerEntry returns a freedesktop .thumbnailer file that registers a
+// command as the thumbnailer of the supported formats. Installed in
+// /usr/share/thumbnailers or ~/.local/share/thumbnailers, it lets file
+// managers call the thumbnail command for the files they show.
+func ThumbnailerEntry(command string) string {
+	var mimeTypes []string
+	for _, format := range []string{FormatJPEG, FormatPNG} {
+		mimeTypes = append(mimeTypes, thumbnailMIMETypes[format])
+	}
+	exec := command
+	if strings.ContainsAny(command, " \t\"'\\") {
+		exec = strconv.Quote(command)
+	}
+	return fmt.Sprintf("[Thumbnailer Entry]\nTryExec=%s\nExec=%s thumbnail -size %%s %%i %%o\nMimeType=%s;\n",
+		command, exec, strings.Join(mimeTypes, ";"))
+}
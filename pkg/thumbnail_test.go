@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteThumbnail(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_thumbnail.jpg")
+	if err := generateSingleTestImage(testInputPath, 400, 200); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WriteThumbnail(&buf, testInputPath, 128); err != nil {
+		t.Fatalf("Failed to create thumbnail: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Expected a PNG thumbnail: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 128 || b.Dy() != 64 {
+		t.Errorf("Expected a 128x64 thumbnail, got %v", b)
+	}
+	text := pngText(buf.Bytes())
+	if !strings.HasPrefix(text["Thumb::URI"], "file:///") || text["Thumb::MTime"] == "" ||
+		text["Thumb::Mimetype"] != "image/jpeg" || text["Thumb::Image::Width"] != "400" {
+		t.Errorf("Unexpected thumbnail metadata %v", text)
+	}
+
+	// Small images are not enlarged
+	buf.Reset()
+	if err := WriteThumbnail(&buf, testInputPath, 1024); err != nil {
+		t.Fatalf("Failed to create thumbnail: %v", err)
+	}
+	if img, _ := png.Decode(&buf); img == nil || img.Bounds().Dx() != 400 {
+		t.Error("Expected the thumbnail of a small image to keep its size")
+	}
+}
+
+func TestSquareThumbnail(t *testing.T) {
+	// A fine checkerboard between red bands that the square leaves out
+	img := image.NewRGBA(image.Rect(0, 0, 600, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 600; x++ {
+			c := color.RGBA{0xff, 0, 0, 0xff}
+			if x >= 100 && x < 500 {
+				v := uint8(0xff * ((x + y) % 2))
+				c = color.RGBA{v, v, v, 0xff}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	for _, size := range []int{100, 150} {
+		thumb, err := SquareThumbnail(img, size)
+		if err != nil {
+			t.Fatalf("SquareThumbnail failed: %v", err)
+		}
+		if want := image.Rect(0, 0, size, size); thumb.Bounds() != want {
+			t.Fatalf("Expected %v, got %v", want, thumb.Bounds())
+		}
+		// Averaged before scaling, the checkerboard is an even gray
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				r, g, _, _ := thumb.At(x, y).RGBA()
+				if r != g || absDiff(uint8(r>>8), 128) > 8 {
+					t.Fatalf("Expected an even gray at %d,%d of the %d thumbnail, got %d,%d", x, y, size, r>>8, g>>8)
+				}
+			}
+		}
+	}
+
+	small, err := SquareThumbnail(image.NewRGBA(image.Rect(0, 0, 50, 80)), 100)
+	if err != nil || small.Bounds() != image.Rect(0, 0, 50, 50) {
+		t.Errorf("Expected a small image to be cropped but not enlarged, got %v, %v", small.Bounds(), err)
+	}
+	if _, err := SquareThumbnail(img, 0); err == nil {
+		t.Error("Expected an error for a zero size")
+	}
+
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	input := writeTestImage(t, testDir, "test_input.png", img, encodePNGBuffer)
+	output := filepath.Join(testDir, "test_output.jpg")
+	if err := Thumbnail(input, output, 64); err != nil {
+		t.Fatalf("Thumbnail failed: %v", err)
+	}
+	if got := decodeTestFile(t, output).Bounds(); got != image.Rect(0, 0, 64, 64) {
+		t.Errorf("Expected a 64x64 output, got %v", got)
+	}
+}
+
+func TestCacheThumbnail(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(testDir, "cache"))
+
+	photos := filepath.Join(testDir, "photos")
+	if err := os.MkdirAll(photos, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	goodPath := filepath.Join(photos, "good.jpg")
+	if err := generateSingleTestImage(goodPath, 300, 300); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	badPath := filepath.Join(photos, "bad.jpg")
+	if err := os.WriteFile(badPath, []byte("not a jpeg"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if created, err := CacheThumbnail(goodPath, "normal"); err != nil || !created {
+		t.Fatalf("Expected a thumbnail to be created, got %v (%v)", created, err)
+	}
+	cachePath, _ := ThumbnailCachePath(goodPath, "normal")
+	if info, err := os.Stat(cachePath); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected a private cache entry at %s: %v", cachePath, err)
+	}
+	if created, _ := CacheThumbnail(goodPath, "normal"); created {
+		t.Error("An up-to-date thumbnail should not be recreated")
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(goodPath, later, later); err != nil {
+		t.Fatalf("Failed to touch file: %v", err)
+	}
+	if created, _ := CacheThumbnail(goodPath, "normal"); !created {
+		t.Error("A changed file should get a new thumbnail")
+	}
+
+	if _, err := CacheThumbnail(badPath, "normal"); err == nil {
+		t.Error("A broken file should fail")
+	}
+	if created, err := CacheThumbnail(badPath, "normal"); created || err != nil {
+		t.Errorf("A recorded failure should not be retried, got %v (%v)", created, err)
+	}
+	if _, err := CacheThumbnail(goodPath, "huge"); err == nil {
+		t.Error("An unknown flavor should be rejected")
+	}
+
+	// The daemon fills the other flavors
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := ThumbnailDaemon(ctx, []string{photos}, ThumbnailDaemonOptions{Flavors: []string{"large"}, Interval: 20 * time.Millisecond}); err != nil {
+		t.Fatalf("Daemon failed: %v", err)
+	}
+	largePath, _ := ThumbnailCachePath(goodPath, "large")
+	if _, err := os.Stat(largePath); err != nil {
+		t.Errorf("Expected the daemon to create %s: %v", largePath, err)
+	}
+}
+
+func TestThumbnailerEntry(t *testing.T) {
+	entry := ThumbnailerEntry("/opt/gip/go-image-processor")
+	for _, want := range []string{"[Thumbnailer Entry]", "Exec=/opt/gip/go-image-processor thumbnail -size %s %i %o", "MimeType=image/jpeg;image/png;"} {
+		if !strings.Contains(entry, want) {
+			t.Errorf("Expected %q in entry:\n%s", want, entry)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+)
+
+// WithTiled processes a file a few rows at a time instead of decoding it
+// whole, so scans of maps and posters too large for memory can be resized,
+// binarized and edge-detected. PNGs and TIFFs are read row by row, as
+// openRows describes; JPEGs and other formats are still decoded whole, but the
+// result is never held in memory. The result is saved as PNG when the output
+// path ends in .png and as JPEG otherwise, and the rows written are reported
+// to the function set by WithProgress. It is accepted by ResizeImageWith,
+// BinarizeImageWith and DetectEdgesWith.
+func WithTiled() Option {
+	return func(s *settings) {
+		s.tiled = true
+	}
+}
+
+// rowWindow is the number of rows of a rowImage held at a time; the JPEG
+// encoder reads its input in bands of 16 rows and the PNG encoder row by row
+const rowWindow = 16
+
+// rowImage is an image whose rows are computed in order while it is encoded,
+// so the result of a tiled operation is never held whole. The rows are 16-bit
+// gray, one sample per pixel, or premultiplied 16-bit RGBA, four samples per
+// pixel.
+type rowImage struct {
+	width, height int
+	gray          bool
+	// ctx is checked before each row is produced, so a cancelled operation
+	// stops with ctx's error
+	ctx context.Context
+	// produce computes row y into row
+	produce func(y int, row []uint16) error
+	window  [rowWindow][]uint16
+	// next is the first row not produced yet
+	next int
+	// err is the first error of produce; the rows after it are left black
+	err error
+}
+
+// row returns row y, producing the rows up to it
+func (m *rowImage) row(y int) []uint16 {
+	for m.next <= y {
+		row := m.window[m.next%rowWindow]
+		if row == nil {
+			channels := 4
+			if m.gray {
+				channels = 1
+			}
+			row = make([]uint16, channels*m.width)
+			m.window[m.next%rowWindow] = row
+		}
+		if m.err == nil {
+			m.err = m.ctx.Err()
+		}
+		if m.err == nil {
+			m.err = m.produce(m.next, row)
+		}
+		if m.err != nil {
+			clear(row)
+		}
+		m.next++
+	}
+	if y < m.next-rowWindow {
+		panic("processor: row read after it left the window")
+	}
+	return m.window[y%rowWindow]
+}
+
+func (m *rowImage) ColorModel() color.Model {
+	if m.gray {
+		return color.Gray16Model
+	}
+	return color.RGBA64Model
+}
+
+func (m *rowImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, m.width, m.height)
+}
+
+func (m *rowImage) At(x, y int) color.Color {
+	row := m.row(y)
+	if m.gray {
+		return color.Gray16{row[x]}
+	}
+	px := row[4*x : 4*x+4]
+	return color.RGBA64{px[0], px[1], px[2], px[3]}
+}
+
+// saveRows encodes m to outputPath while it is produced: as PNG when the path
+// ends in .png, gray images with the given bit depth, and as JPEG with the
+// given quality otherwise. A positive dpi is recorded in either.
+func (p *Processor) saveRows(outputPath string, m *rowImage, depth uint8, quality int, dpi float64) error {
+	out, err := p.createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if extensionFormat(outputPath) == FormatPNG {
+		err = encodeRowsPNG(out, m, depth, dpi)
+	} else {
+		err = encodeJPEGWithDPI(out, m, dpi, quality)
+	}
+	if err != nil {
+		return err
+	}
+	if m.err != nil {
+		return m.err
+	}
+	return out.Commit()
+}
+
+// encodeRowsPNG writes m to w as a PNG, gray with the given bit depth or
+// 8-bit RGBA
+func encodeRowsPNG(w io.Writer, m *rowImage, depth uint8, dpi float64) error {
+	hdr := pngHeader{width: m.width, height: m.height, colorType: pngColorRGBA, bitDepth: 8, dpi: dpi}
+	if m.gray {
+		hdr.colorType, hdr.bitDepth = pngColorGray, depth
+	}
+	shift := 16 - hdr.bitDepth
+	sample := func(x, y int, samples []uint16) {
+		row := m.row(y)
+		if m.gray {
+			samples[0] = row[x] >> shift
+			return
+		}
+		px := row[4*x : 4*x+4]
+		c := color.NRGBA64Model.Convert(color.RGBA64{px[0], px[1], px[2], px[3]}).(color.NRGBA64)
+		samples[0], samples[1], samples[2], samples[3] = c.R>>8, c.G>>8, c.B>>8, c.A>>8
+	}
+	if err := encodePNG(w, hdr, sample); err != nil {
+		return &ErrProcessing{Op: "encode", Err: err}
+	}
+	return nil
+}
+
+// grayRows reads the rows of a rowReader as 8-bit gray levels, converted like
+// color.GrayModel converts them
+type grayRows struct {
+	rows rowReader
+	rgba []uint16
+}
+
+func newGrayRows(rows rowReader) *grayRows {
+	return &grayRows{rows: rows, rgba: make([]uint16, 4*rows.size().X)}
+}
+
+// read reads the next row into gray
+func (g *grayRows) read(gray []uint8) error {
+	if err := g.rows.readRow(g.rgba); err != nil {
+		return &ErrProcessing{Op: "decode", Err: err}
+	}
+	for i := range gray {
+		px := g.rgba[4*i : 4*i+3]
+		gray[i] = uint8((19595*uint32(px[0]) + 38470*uint32(px[1]) + 7471*uint32(px[2]) + 1<<15) >> 24)
+	}
+	return nil
+}
+
+// binarizeTiled binarizes the file like binarize, a row at a time, into a
+// 1-bit PNG or a JPEG. Otsu's method needs the histogram of the whole image,
+// so without a fixed threshold the input is read twice.
+func (p *Processor) binarizeTiled(ctx context.Context, inputPath, outputPath string, s *settings) error {
+	threshold, progress := s.threshold, s.progress
+	if threshold < 0 {
+		histogram := make([]int, 256)
+		size, err := p.eachGrayRow(ctx, inputPath, progress.phase(0, 2), func(gray []uint8) {
+			for _, v := range gray {
+				histogram[v]++
+			}
+		})
+		if err != nil {
+			return err
+		}
+		threshold = int(otsuThreshold(histogram, size.X*size.Y))
+		progress = progress.phase(1, 2)
+	}
+
+	rows, err := p.openRows(inputPath)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	size := rows.size()
+	g := newGrayRows(rows)
+	gray := make([]uint8, size.X)
+	m := &rowImage{width: size.X, height: size.Y, gray: true, ctx: ctx, produce: func(y int, row []uint16) error {
+		if err := g.read(gray); err != nil {
+			return err
+		}
+		for i, v := range gray {
+			row[i] = 0
+			if int(v) > threshold {
+				row[i] = 0xffff
+			}
+		}
+		progress.report(y+1, size.Y)
+		return nil
+	}}
+	return p.saveRows(outputPath, m, 1, s.jpegQuality(jpeg.DefaultQuality), 0)
+}
+
+// eachGrayRow passes the rows of the file at path to fn as gray levels,
+// reporting them to progress, and returns the size of the image. It stops
+// with ctx's error when ctx is cancelled.
+func (p *Processor) eachGrayRow(ctx context.Context, path string, progress ProgressFunc, fn func(gray []uint8)) (image.Point, error) {
+	rows, err := p.openRows(path)
+	if err != nil {
+		return image.Point{}, err
+	}
+	defer rows.Close()
+	size := rows.size()
+	g := newGrayRows(rows)
+	gray := make([]uint8, size.X)
+	for y := range size.Y {
+		if err := ctx.Err(); err != nil {
+			return image.Point{}, err
+		}
+		if err := g.read(gray); err != nil {
+			return image.Point{}, err
+		}
+		fn(gray)
+		progress.report(y+1, size.Y)
+	}
+	return size, nil
+}
+
+// edgesTiled detects the edges of the file like edges, holding the three gray
+// rows around the row being computed
+func (p *Processor) edgesTiled(ctx context.Context, inputPath, outputPath string, s *settings) error {
+	rows, err := p.openRows(inputPath)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	size := rows.size()
+	g := newGrayRows(rows)
+	var ring [3][]uint8
+	for i := range ring {
+		ring[i] = make([]uint8, size.X)
+	}
+	gx := make([]int32, max(size.X-2, 0))
+	gy := make([]int32, len(gx))
+	read := 0
+	m := &rowImage{width: size.X, height: size.Y, gray: true, ctx: ctx, produce: func(y int, row []uint16) error {
+		for read <= min(y+1, size.Y-1) {
+			if err := g.read(ring[read%3]); err != nil {
+				return err
+			}
+			read++
+		}
+		clear(row)
+		if y > 0 && y < size.Y-1 && size.X > 2 {
+			sobelRow(ring[(y-1)%3], ring[y%3], ring[(y+1)%3], gx, gy)
+			for i := range gx {
+				row[i+1] = uint16(edgeLevel(int(gx[i]), int(gy[i]), s.threshold)) * 0x101
+			}
+		}
+		s.progress.report(y+1, size.Y)
+		return nil
+	}}
+	return p.saveRows(outputPath, m, 8, s.jpegQuality(jpeg.DefaultQuality), 0)
+}
+
+// resizeTiled resizes the file like resizeImageFile, one output row at a
+// time: each input row is resampled horizontally as it is read, and each
+// output row is the weighted sum of the resampled rows under the filter, so
+// only as many rows as the filter spans are held
+func (p *Processor) resizeTiled(ctx context.Context, inputPath, outputPath string, opts ResizeOptions, quality int, progress ProgressFunc) (*ResizeResult, error) {
+	rows, err := p.openRows(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	srcDPI := opts.DPI
+	if srcDPI <= 0 {
+		srcDPI = readDPI(inputPath)
+	}
+	size := rows.size()
+	result, scaled, err := resizeTarget(size, srcDPI, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Rows are resampled as they are read, with no room to crop or pad
+	if scaled != image.Pt(result.Width, result.Height) {
+		return nil, &ErrProcessing{Op: "resize", Err: fmt.Errorf("the %s mode cannot be tiled", opts.Mode)}
+	}
+	width, height := result.Width, result.Height
+
+	cols := resamplingFor(size.X, width, opts.Interpolation)
+	lines := resamplingFor(size.Y, height, opts.Interpolation)
+	// resampled holds the horizontally resampled input rows under the filter,
+	// row i at i % lines.length
+	resampled := make([][]float64, lines.length)
+	in := make([]uint16, 4*size.X)
+	acc := make([]float64, 4*width)
+	read := 0
+	m := &rowImage{width: width, height: height, ctx: ctx, produce: func(y int, row []uint16) error {
+		first, last := lines.span(y, size.Y)
+		for ; read <= last; read++ {
+			if err := rows.readRow(in); err != nil {
+				return &ErrProcessing{Op: "decode", Err: err}
+			}
+			slot := &resampled[read%lines.length]
+			if *slot == nil {
+				*slot = make([]float64, 4*width)
+			}
+			cols.apply(*slot, in)
+		}
+
+		clear(acc)
+		sum := 0.0
+		for k, c := range lines.coeffs[y*lines.length : (y+1)*lines.length] {
+			if c == 0 {
+				continue
+			}
+			src := resampled[min(max(lines.start[y]+k, first), last)%lines.length]
+			for i, v := range src {
+				acc[i] += c * v
+			}
+			sum += c
+		}
+		if sum == 0 {
+			sum = 1
+		}
+		for i := 0; i < len(row); i += 4 {
+			// Overshooting filters can leave a color above its alpha, which
+			// premultiplied colors cannot have
+			a := clampSample(acc[i+3] / sum)
+			row[i+3] = a
+			for c := range 3 {
+				row[i+c] = min(clampSample(acc[i+c]/sum), a)
+			}
+		}
+		progress.report(y+1, height)
+		return nil
+	}}
+	if err := p.saveRows(outputPath, m, 8, quality, result.DPI); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// clampSample rounds v to a 16-bit sample
+func clampSample(v float64) uint16 {
+	return uint16(min(max(v+0.5, 0), 0xffff))
+}
@@ -0,0 +1,249 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// tiledTestImage draws an opaque pattern of gradients and hard edges
+func tiledTestImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / w)
+			if (x/9+y/7)%3 == 0 {
+				v = 255 - v
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, uint8(y * 255 / h), uint8(x * y), 255})
+		}
+	}
+	return img
+}
+
+// writeTestImage encodes img with encode into a file of dir
+func writeTestImage(t *testing.T, dir, name string, img image.Image, encode func(*bytes.Buffer, image.Image) error) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode %s: %v", name, err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func encodePNGBuffer(buf *bytes.Buffer, img image.Image) error {
+	return png.Encode(buf, img)
+}
+
+func decodeTestFile(t *testing.T, path string) image.Image {
+	t.Helper()
+	img, err := Default().loadImage(path)
+	if err != nil {
+		t.Fatalf("Failed to decode %s: %v", path, err)
+	}
+	return img
+}
+
+func TestTiledMatchesInMemory(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	img := tiledTestImage(97, 61)
+	inputPath := writeTestImage(t, testDir, "test_input_tiled.png", img, encodePNGBuffer)
+	outputPath := filepath.Join(testDir, "test_output_tiled.png")
+
+	for _, tt := range []struct {
+		name string
+		run  func(opts ...Option) error
+		want func(threshold int) image.Image
+	}{
+		{"binarize", func(opts ...Option) error { return BinarizeImageWith(inputPath, outputPath, opts...) },
+			func(threshold int) image.Image { return binarize(img, threshold, nil) }},
+		{"edges", func(opts ...Option) error { return DetectEdgesWith(inputPath, outputPath, opts...) },
+			func(threshold int) image.Image { return edges(img, threshold, nil) }},
+	} {
+		for _, threshold := range []int{-1, 100} {
+			opts := []Option{WithTiled()}
+			if threshold >= 0 {
+				opts = append(opts, WithThreshold(uint8(threshold)))
+			}
+			var calls [][2]int
+			if err := tt.run(append(opts, WithProgress(progressRecorder(&calls)))...); err != nil {
+				t.Fatalf("%s: failed to run tiled: %v", tt.name, err)
+			}
+			checkProgress(t, tt.name, calls)
+			got, want := decodeTestFile(t, outputPath), tt.want(threshold)
+			if got.Bounds() != want.Bounds() {
+				t.Fatalf("%s: expected bounds %v, got %v", tt.name, want.Bounds(), got.Bounds())
+			}
+			for y := 0; y < 61; y++ {
+				for x := 0; x < 97; x++ {
+					if g, w := color.GrayModel.Convert(got.At(x, y)), want.At(x, y); g != w {
+						t.Fatalf("%s, threshold %d: expected %v at (%d, %d), got %v", tt.name, threshold, w, x, y, g)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestResizeTiled(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	img := tiledTestImage(97, 61)
+	inputPath := writeTestImage(t, testDir, "test_input_tiled.png", img, encodePNGBuffer)
+	outputPath := filepath.Join(testDir, "test_output_tiled.png")
+	// The resize package rounds its weights to 1/256 for 8-bit images, so the
+	// tiled resize is compared with it on a 16-bit copy
+	deep := image.NewRGBA64(img.Bounds())
+	draw.Draw(deep, deep.Bounds(), img, image.Point{}, draw.Src)
+
+	for _, opts := range []ResizeOptions{
+		{Width: 40},
+		{Width: 250, Interpolation: Bicubic},
+		{Scale: 0.3, Interpolation: NearestNeighbor},
+		{Width: 60, Height: 60, Interpolation: MitchellNetravali},
+	} {
+		want, wantResult, err := ResizeWithOptions(deep, opts)
+		if err != nil {
+			t.Fatalf("Failed to resize in memory: %v", err)
+		}
+		opts.Tiled = true
+		result, err := ResizeImageWithOptions(inputPath, outputPath, opts)
+		if err != nil {
+			t.Fatalf("%v: failed to resize tiled: %v", opts.Interpolation, err)
+		}
+		if *result != *wantResult {
+			t.Errorf("%v: expected %+v, got %+v", opts.Interpolation, wantResult, result)
+		}
+		got := decodeTestFile(t, outputPath)
+		if got.Bounds().Size() != want.Bounds().Size() {
+			t.Fatalf("%v: expected size %v, got %v", opts.Interpolation, want.Bounds().Size(), got.Bounds().Size())
+		}
+		for y := 0; y < got.Bounds().Dy(); y++ {
+			for x := 0; x < got.Bounds().Dx(); x++ {
+				gr, gg, gb, _ := got.At(x, y).RGBA()
+				wr, wg, wb, _ := want.At(want.Bounds().Min.X+x, want.Bounds().Min.Y+y).RGBA()
+				for _, d := range []int{int(gr>>8) - int(wr>>8), int(gg>>8) - int(wg>>8), int(gb>>8) - int(wb>>8)} {
+					if d < -1 || d > 1 {
+						t.Fatalf("%v: expected (%d, %d) close to %d %d %d, got %d %d %d", opts.Interpolation, x, y, wr>>8, wg>>8, wb>>8, gr>>8, gg>>8, gb>>8)
+					}
+				}
+			}
+		}
+	}
+
+	// The resolution is kept in JPEG and PNG output
+	for _, name := range []string{"test_output_tiled_dpi.jpg", "test_output_tiled_dpi.png"} {
+		path := filepath.Join(testDir, name)
+		if _, err := ResizeImageWithOptions(inputPath, path, ResizeOptions{Scale: 0.5, DPI: 300, Tiled: true}); err != nil {
+			t.Fatalf("Failed to resize to %s: %v", name, err)
+		}
+		if dpi := readDPI(path); dpi < 299 || dpi > 301 {
+			t.Errorf("%s: expected 300 dpi, got %g", name, dpi)
+		}
+	}
+}
+
+func TestOpenRows(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	base := tiledTestImage(53, 37)
+
+	translucent := image.NewNRGBA(base.Bounds())
+	deep := image.NewNRGBA64(base.Bounds())
+	gray := image.NewGray16(base.Bounds())
+	paletted := image.NewPaletted(base.Bounds(), color.Palette{
+		color.NRGBA{0, 0, 0, 255}, color.NRGBA{255, 0, 0, 128}, color.NRGBA{0, 0, 255, 0}, color.NRGBA{255, 255, 255, 255},
+	})
+	for y := 0; y < 37; y++ {
+		for x := 0; x < 53; x++ {
+			c := base.NRGBAAt(x, y)
+			translucent.SetNRGBA(x, y, color.NRGBA{c.R, c.G, c.B, uint8(x * 4)})
+			deep.SetNRGBA64(x, y, color.NRGBA64{uint16(x) * 1111, uint16(y) * 1501, 12345, uint16(x*y) * 31})
+			gray.SetGray16(x, y, color.Gray16{uint16(x*y) * 33})
+			paletted.SetColorIndex(x, y, uint8((x+y)%4))
+		}
+	}
+	tiffOptions := func(opts *tiff.Options) func(*bytes.Buffer, image.Image) error {
+		return func(buf *bytes.Buffer, img image.Image) error { return tiff.Encode(buf, img, opts) }
+	}
+	deflate := &tiff.Options{Compression: tiff.Deflate, Predictor: true}
+
+	for _, tt := range []struct {
+		name        string
+		img         image.Image
+		encode      func(*bytes.Buffer, image.Image) error
+		incremental bool
+	}{
+		{"translucent.png", translucent, encodePNGBuffer, true},
+		{"deep.png", deep, encodePNGBuffer, true},
+		{"gray16.png", gray, encodePNGBuffer, true},
+		{"paletted.png", paletted, encodePNGBuffer, true},
+		{"plain.tif", base, tiffOptions(nil), true},
+		{"translucent.tif", translucent, tiffOptions(deflate), true},
+		{"deep.tif", deep, tiffOptions(deflate), true},
+		{"gray16.tif", gray, tiffOptions(&tiff.Options{Compression: tiff.Deflate}), true},
+		{"photo.jpg", base, func(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) }, false},
+	} {
+		path := writeTestImage(t, testDir, "test_rows_"+tt.name, tt.img, tt.encode)
+		want := decodeTestFile(t, path)
+		rows, err := Default().openRows(path)
+		if err != nil {
+			t.Fatalf("%s: failed to open: %v", tt.name, err)
+		}
+		if _, whole := rows.(*imageRows); whole == tt.incremental {
+			t.Errorf("%s: expected incremental reading %v", tt.name, tt.incremental)
+		}
+		if rows.size() != want.Bounds().Size() {
+			t.Fatalf("%s: expected size %v, got %v", tt.name, want.Bounds().Size(), rows.size())
+		}
+		row := make([]uint16, 4*53)
+		for y := 0; y < 37; y++ {
+			if err := rows.readRow(row); err != nil {
+				t.Fatalf("%s: failed to read row %d: %v", tt.name, y, err)
+			}
+			for x := 0; x < 53; x++ {
+				r, g, b, a := want.At(x, y).RGBA()
+				if got := [4]uint16(row[4*x : 4*x+4]); got != [4]uint16{uint16(r), uint16(g), uint16(b), uint16(a)} {
+					t.Fatalf("%s: expected %v at (%d, %d), got %v", tt.name, want.At(x, y), x, y, got)
+				}
+			}
+		}
+		rows.Close()
+	}
+}
+
+func TestTiledCorruptInput(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, tiledTestImage(97, 61)); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+	inputPath := filepath.Join(testDir, "test_input_tiled_corrupt.png")
+	if err := os.WriteFile(inputPath, data, 0o644); err != nil {
+		t.Fatalf("Failed to write test image: %v", err)
+	}
+
+	outputPath := filepath.Join(testDir, "test_output_tiled_corrupt.jpg")
+	if err := DetectEdgesWith(inputPath, outputPath, WithTiled()); err == nil {
+		t.Error("Expected an error for a corrupt input")
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no output for a corrupt input, got %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"math"
+)
+
+// traceMinArea is the smallest outline area, in pixels, kept when tracing (speckle removal)
+const traceMinArea = 3
+
+// traceTolerance is the maximum distance, in pixels, a simplified outline may stray from the traced one
+const traceTolerance = 1.0
+
+// traceCornerAngle is the turn, in radians, above which an outline vertex is kept as a sharp corner
+const traceCornerAngle = math.Pi * 5 / 12
+
+// tracePoint is a vertex on the pixel grid
+type tracePoint struct {
+	X, Y float64
+}
+
+// TraceImage converts the dark areas of a line-art image into SVG paths.
+// The image is binarized with Otsu's method, the outlines of the ink are followed
+// along pixel edges, simplified into polygons and smoothed with quadratic Bezier curves.
+// It takes the path of the input image and the path of the SVG file to write.
+// Returns an error if the operation fails.
+func TraceImage(inputPath string, outputPath string) error {
+	slog.Info("tracing image", "input", inputPath)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+
+	out, err := createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := writeTraceSVG(out, img); err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+// TraceImageReader converts the dark areas of the image read from r into SVG
+// paths like TraceImage and writes the SVG document to w.
+// Returns an error if the operation fails.
+func TraceImageReader(r io.Reader, w io.Writer) error {
+	img, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	return writeTraceSVG(w, img)
+}
+
+// writeTraceSVG traces the ink of the image and writes the outlines to w as SVG
+func writeTraceSVG(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	outlines := traceOutlines(otsuInkMask(toGray(img)), width, height)
+
+	writer := bufio.NewWriter(w)
+	fmt.Fprintf(writer, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", width, height, width, height)
+	fmt.Fprint(writer, "<path fill=\"black\" fill-rule=\"evenodd\" d=\"")
+	for _, outline := range outlines {
+		if math.Abs(polygonArea(outline)) < traceMinArea {
+			continue
+		}
+		fmt.Fprint(writer, svgPathData(simplifyClosedPolygon(outline, traceTolerance)))
+	}
+	fmt.Fprint(writer, "\"/>\n</svg>\n")
+
+	if err := writer.Flush(); err != nil {
+		return &ErrProcessing{Op: "encode", Err: err}
+	}
+	return nil
+}
+
+// traceOutlines follows the boundaries between ink and background along pixel edges.
+// Every outline is closed and keeps the ink on its right-hand side.
+func traceOutlines(mask []bool, w, h int) [][]tracePoint {
+	ink := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < w && y < h && mask[y*w+x]
+	}
+	vertex := func(x, y int) int { return y*(w+1) + x }
+
+	type edge struct {
+		from, to int
+		used     bool
+	}
+	var edges []edge
+	outgoing := make(map[int][]int)
+	add := func(fromX, fromY, toX, toY int) {
+		from := vertex(fromX, fromY)
+		outgoing[from] = append(outgoing[from], len(edges))
+		edges = append(edges, edge{from: from, to: vertex(toX, toY)})
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !mask[y*w+x] {
+				continue
+			}
+			if !ink(x, y-1) {
+				add(x, y, x+1, y)
+			}
+			if !ink(x+1, y) {
+				add(x+1, y, x+1, y+1)
+			}
+			if !ink(x, y+1) {
+				add(x+1, y+1, x, y+1)
+			}
+			if !ink(x-1, y) {
+				add(x, y+1, x, y)
+			}
+		}
+	}
+
+	point := func(v int) tracePoint {
+		return tracePoint{X: float64(v % (w + 1)), Y: float64(v / (w + 1))}
+	}
+
+	var outlines [][]tracePoint
+	for start := range edges {
+		if edges[start].used {
+			continue
+		}
+		var outline []tracePoint
+		from := edges[start].from
+		current := start
+		for !edges[current].used {
+			edges[current].used = true
+			outline = append(outline, point(from))
+			from = edges[current].to
+			// Where two outlines touch diagonally, prefer the unused edge that
+			// turns right so each stays a separate shape
+			next := -1
+			for _, e := range outgoing[from] {
+				if edges[e].used {
+					continue
+				}
+				if next == -1 || turnsRight(point(from), outline[len(outline)-1], point(edges[e].to)) {
+					next = e
+				}
+			}
+			if next == -1 {
+				break
+			}
+			current = next
+		}
+		outlines = append(outlines, outline)
+	}
+	return outlines
+}
+
+// turnsRight reports whether going prev -> at -> next is a clockwise turn in image coordinates
+func turnsRight(at, prev, next tracePoint) bool {
+	return (at.X-prev.X)*(next.Y-at.Y)-(at.Y-prev.Y)*(next.X-at.X) > 0
+}
+
+// polygonArea returns the signed area of a closed polygon
+func polygonArea(polygon []tracePoint) float64 {
+	area := 0.0
+	for i, p := range polygon {
+		q := polygon[(i+1)%len(polygon)]
+		area += p.X*q.Y - q.X*p.Y
+	}
+	return area / 2
+}
+
+// simplifyClosedPolygon removes vertices that lie within tolerance of the
+// simplified outline (Ramer-Douglas-Peucker)
+func simplifyClosedPolygon(polygon []tracePoint, tolerance float64) []tracePoint {
+	if len(polygon) < 4 {
+		return polygon
+	}
+	// Split the loop at the vertex farthest from the first one
+	far, farDist := 0, -1.0
+	for i, p := range polygon {
+		if d := math.Hypot(p.X-polygon[0].X, p.Y-polygon[0].Y); d > farDist {
+			far, farDist = i, d
+		}
+	}
+	closed := append(append([]tracePoint{}, polygon...), polygon[0])
+	first := simplifyPolyline(closed[:far+1], tolerance)
+	second := simplifyPolyline(closed[far:], tolerance)
+	return append(first[:len(first)-1], second[:len(second)-1]...)
+}
+
+// simplifyPolyline simplifies an open polyline, keeping both end points
+func simplifyPolyline(points []tracePoint, tolerance float64) []tracePoint {
+	if len(points) < 3 {
+		return points
+	}
+	a, b := points[0], points[len(points)-1]
+	index, maxDist := 0, 0.0
+	for i := 1; i < len(points)-1; i++ {
+		if d := pointSegmentDistance(points[i], a, b); d > maxDist {
+			index, maxDist = i, d
+		}
+	}
+	if maxDist <= tolerance {
+		return []tracePoint{a, b}
+	}
+	left := simplifyPolyline(points[:index+1], tolerance)
+	right := simplifyPolyline(points[index:], tolerance)
+	return append(left[:len(left)-1], right...)
+}
+
+// pointSegmentDistance returns the distance from p to the segment a-b
+func pointSegmentDistance(p, a, b tracePoint) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	lengthSq := dx*dx + dy*dy
+	if lengthSq == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y)
+	}
+	t := math.Max(0, math.Min(1, ((p.X-a.X)*dx+(p.Y-a.Y)*dy)/lengthSq))
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
+
+// svgPathData renders a closed polygon as SVG path data. Sharp vertices are kept
+// as corners; the others become control points of quadratic Bezier curves
+// running between edge midpoints.
+func svgPathData(polygon []tracePoint) string {
+	n := len(polygon)
+	if n < 3 {
+		return ""
+	}
+	mid := func(i int) tracePoint {
+		p, q := polygon[i%n], polygon[(i+1)%n]
+		return tracePoint{X: (p.X + q.X) / 2, Y: (p.Y + q.Y) / 2}
+	}
+
+	start := mid(n - 1)
+	data := fmt.Sprintf("M%.1f %.1f", start.X, start.Y)
+	for i := 0; i < n; i++ {
+		prev, p, next := polygon[(i+n-1)%n], polygon[i], polygon[(i+1)%n]
+		m := mid(i)
+		if turnAngle(prev, p, next) > traceCornerAngle {
+			data += fmt.Sprintf("L%.1f %.1fL%.1f %.1f", p.X, p.Y, m.X, m.Y)
+		} else {
+			data += fmt.Sprintf("Q%.1f %.1f %.1f %.1f", p.X, p.Y, m.X, m.Y)
+		}
+	}
+	return data + "Z"
+}
+
+// turnAngle returns the absolute change of direction at p, in radians
+func turnAngle(prev, p, next tracePoint) float64 {
+	a := math.Atan2(p.Y-prev.Y, p.X-prev.X)
+	b := math.Atan2(next.Y-p.Y, next.X-p.X)
+	d := math.Abs(b - a)
+	if d > math.Pi {
+		d = 2*math.Pi - d
+	}
+	return d
+}
@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTraceOutlines(t *testing.T) {
+	// A 6x6 square with a 2x2 hole traces to an outer outline and a hole
+	w, h := 10, 10
+	mask := make([]bool, w*h)
+	for y := 2; y < 8; y++ {
+		for x := 2; x < 8; x++ {
+			mask[y*w+x] = !(x >= 4 && x < 6 && y >= 4 && y < 6)
+		}
+	}
+
+	outlines := traceOutlines(mask, w, h)
+	if len(outlines) != 2 {
+		t.Fatalf("Expected 2 outlines, got %d", len(outlines))
+	}
+
+	total := 0.0
+	for _, outline := range outlines {
+		total += polygonArea(outline)
+	}
+	if math.Abs(total) != 32 {
+		t.Errorf("Expected traced ink area 32, got %v", math.Abs(total))
+	}
+
+	simplified := simplifyClosedPolygon(outlines[0], traceTolerance)
+	if len(simplified) != 4 {
+		t.Errorf("Expected square outline to simplify to 4 vertices, got %d", len(simplified))
+	}
+}
+
+func TestTraceImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_trace.svg")
+
+	if err := generateSingleTestImage(testInputPath, 100, 100); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	if err := TraceImage(testInputPath, testOutputPath); err != nil {
+		t.Fatalf("Failed to trace image: %v", err)
+	}
+
+	data, err := os.ReadFile(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to read SVG: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "<svg") || !strings.Contains(string(data), "M") {
+		t.Errorf("Output is not an SVG with path data")
+	}
+}
@@ -0,0 +1,292 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// opKind is the kind of a geometric operation
+type opKind int
+
+const (
+	opResize opKind = iota
+	opRotate
+	opCrop
+	opFlipHorizontal
+	opFlipVertical
+)
+
+// Op is a geometric operation composed by Transform. The operations are
+// created with ResizeOp, ScaleOp, RotateOp, CropOp, FlipHorizontalOp and
+// FlipVerticalOp, or parsed with ParseOp.
+type Op struct {
+	kind          opKind
+	width, height uint
+	scale         float64
+	angle         float64
+	rect          image.Rectangle
+}
+
+// ResizeOp fits the image into a width x height box keeping its aspect
+// ratio, like ResizeImage; when one of them is zero it follows from the other
+func ResizeOp(width, height uint) Op {
+	return Op{kind: opResize, width: width, height: height}
+}
+
+// ScaleOp resizes the image by a factor of its size (0.5 halves it)
+func ScaleOp(factor float64) Op {
+	return Op{kind: opResize, scale: factor}
+}
+
+// RotateOp rotates the image clockwise by angle degrees on a canvas enlarged
+// to hold it, like RotateImage
+func RotateOp(angle float64) Op {
+	return Op{kind: opRotate, angle: angle}
+}
+
+// CropOp keeps the part of the image inside rect, in the coordinates of the
+// image the previous operations produced
+func CropOp(rect image.Rectangle) Op {
+	return Op{kind: opCrop, rect: rect}
+}
+
+// FlipHorizontalOp mirrors the image left to right
+func FlipHorizontalOp() Op {
+	return Op{kind: opFlipHorizontal}
+}
+
+// FlipVerticalOp mirrors the image top to bottom
+func FlipVerticalOp() Op {
+	return Op{kind: opFlipVertical}
+}
+
+// ParseOp parses an operation in the notation of the transform command:
+// resize:<geometry> with a size such as 800x600 or a scale such as 50%,
+// rotate:<degrees>, crop:<width>x<height>+<x>+<y>, flipx and flipy.
+// Returns an error for other operations.
+func ParseOp(s string) (Op, error) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(s), ":")
+	switch strings.ToLower(name) {
+	case "resize":
+		g, err := ParseGeometry(arg)
+		if err != nil {
+			return Op{}, err
+		}
+		if g.Scale > 0 {
+			return ScaleOp(g.Scale), nil
+		}
+		if !g.IsSize() || g.HasOffset || g.Width.IsPhysical() || g.Height.IsPhysical() {
+			return Op{}, fmt.Errorf("resize needs a size in pixels or a scale, got %q", arg)
+		}
+		return ResizeOp(g.Width.Pixels(0), g.Height.Pixels(0)), nil
+	case "rotate":
+		angle, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return Op{}, fmt.Errorf("invalid angle %q", arg)
+		}
+		return RotateOp(angle), nil
+	case "crop":
+		g, err := ParseGeometry(arg)
+		if err != nil {
+			return Op{}, err
+		}
+		rect, err := g.Rect()
+		if err != nil {
+			return Op{}, err
+		}
+		return CropOp(rect), nil
+	case "flipx":
+		return FlipHorizontalOp(), nil
+	case "flipy":
+		return FlipVerticalOp(), nil
+	}
+	return Op{}, fmt.Errorf("unknown operation %q", s)
+}
+
+// String returns the operation in the notation ParseOp accepts
+func (o Op) String() string {
+	switch o.kind {
+	case opResize:
+		if o.scale > 0 {
+			return "resize:" + strconv.FormatFloat(o.scale*100, 'f', -1, 64) + "%"
+		}
+		return fmt.Sprintf("resize:%dx%d", o.width, o.height)
+	case opRotate:
+		return "rotate:" + strconv.FormatFloat(o.angle, 'f', -1, 64)
+	case opCrop:
+		return fmt.Sprintf("crop:%dx%d%+d%+d", o.rect.Dx(), o.rect.Dy(), o.rect.Min.X, o.rect.Min.Y)
+	case opFlipHorizontal:
+		return "flipx"
+	case opFlipVertical:
+		return "flipy"
+	}
+	return fmt.Sprintf("Op(%d)", int(o.kind))
+}
+
+// affine is the matrix of an affine map, taking (x, y) to
+// (a[0]x + a[1]y + a[2], a[3]x + a[4]y + a[5])
+type affine f64.Aff3
+
+// identityAffine leaves every point in place
+var identityAffine = affine{1, 0, 0, 0, 1, 0}
+
+// then returns the map applying m and then n
+func (m affine) then(n affine) affine {
+	return affine{
+		n[0]*m[0] + n[1]*m[3], n[0]*m[1] + n[1]*m[4], n[0]*m[2] + n[1]*m[5] + n[2],
+		n[3]*m[0] + n[4]*m[3], n[3]*m[1] + n[4]*m[4], n[3]*m[2] + n[4]*m[5] + n[5],
+	}
+}
+
+// step returns the map the operation applies to an image of the given size,
+// in continuous coordinates where pixel (x, y) covers [x, x+1) x [y, y+1),
+// and the size of the result
+func (o Op) step(size image.Point) (affine, image.Point, error) {
+	w, h := float64(size.X), float64(size.Y)
+	switch o.kind {
+	case opResize:
+		if o.scale <= 0 && o.width == 0 && o.height == 0 {
+			return affine{}, image.Point{}, errors.New("resize needs a width, a height or a scale")
+		}
+		nw, nh := fitSize(size.X, size.Y, ResizeOptions{Width: o.width, Height: o.height, Scale: o.scale})
+		return affine{float64(nw) / w, 0, 0, 0, float64(nh) / h, 0}, image.Pt(nw, nh), nil
+	case opRotate:
+		radians := o.angle * math.Pi / 180
+		nw, nh := rotatedSize(size.X, size.Y, radians)
+		if nw <= 0 || nh <= 0 {
+			return affine{}, image.Point{}, fmt.Errorf("rotating a %dx%d image leaves nothing", size.X, size.Y)
+		}
+		// Quarter turns are kept exact, so they move pixels without blurring
+		sin, cos := snapUnit(math.Sin(radians)), snapUnit(math.Cos(radians))
+		// Turn about the center, then move it to the center of the new canvas
+		m := affine{1, 0, -w / 2, 0, 1, -h / 2}.
+			then(affine{cos, -sin, 0, sin, cos, 0}).
+			then(affine{1, 0, float64(nw) / 2, 0, 1, float64(nh) / 2})
+		return m, image.Pt(nw, nh), nil
+	case opCrop:
+		r := o.rect.Intersect(image.Rectangle{Max: size})
+		if r.Empty() {
+			return affine{}, image.Point{}, fmt.Errorf("crop %v is outside the %dx%d image", o.rect, size.X, size.Y)
+		}
+		return affine{1, 0, -float64(r.Min.X), 0, 1, -float64(r.Min.Y)}, r.Size(), nil
+	case opFlipHorizontal:
+		return affine{-1, 0, w, 0, 1, 0}, size, nil
+	case opFlipVertical:
+		return affine{1, 0, 0, 0, -1, h}, size, nil
+	}
+	return affine{}, image.Point{}, fmt.Errorf("unknown operation %v", o)
+}
+
+// snapUnit rounds v to -1, 0 or 1 when it is within rounding error of them
+func snapUnit(v float64) float64 {
+	if r := math.Round(v); math.Abs(v-r) < 1e-12 {
+		return r
+	}
+	return v
+}
+
+// Transform applies geometric operations to the input image in one pass:
+// the operations are composed into a single affine map and the pixels are
+// resampled once, with a Catmull-Rom filter, instead of once per operation.
+// A resize followed by a rotation and a crop thus loses no more detail than
+// the resize alone, and only the pixels left after the crop are computed.
+// Areas the rotations uncover are transparent, black in the JPEG output.
+// The result of Pipeline.Transform on a 16-bit image is 16-bit.
+// Returns an error if an operation is invalid or the operation fails.
+func Transform(inputPath string, outputPath string, ops ...Op) error {
+	return defaultProcessor.Transform(inputPath, outputPath, ops...)
+}
+
+// Transform is the package function Transform with the configuration and logger of p
+func (p *Processor) Transform(inputPath string, outputPath string, ops ...Op) error {
+	return p.TransformContext(context.Background(), inputPath, outputPath, ops...)
+}
+
+// TransformContext applies the operations like Transform, stopping early
+// with ctx's error when ctx is cancelled.
+func TransformContext(ctx context.Context, inputPath string, outputPath string, ops ...Op) error {
+	return defaultProcessor.TransformContext(ctx, inputPath, outputPath, ops...)
+}
+
+// TransformContext is the package function TransformContext with the configuration and logger of p
+func (p *Processor) TransformContext(ctx context.Context, inputPath string, outputPath string, ops ...Op) error {
+	p.logger().Info("transforming image", "input", inputPath, "ops", len(ops))
+
+	img, err := p.loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	transformed, err := transformContext(ctx, img, ops)
+	if err != nil {
+		return err
+	}
+	return p.saveJPEG(outputPath, transformed)
+}
+
+// Transform adds a step applying the operations in one pass, like the
+// package function Transform
+func (p *Pipeline) Transform(ops ...Op) *Pipeline {
+	desc := make([]string, len(ops))
+	for i, op := range ops {
+		desc[i] = op.String()
+	}
+	return p.ThenContext("transform "+strings.Join(desc, " "), func(ctx context.Context, img image.Image) (image.Image, error) {
+		return transformContext(ctx, img, ops)
+	})
+}
+
+// transformBand is the number of rows of the result resampled between checks
+// of the context
+const transformBand = 64
+
+// transformImage composes the operations and resamples img once
+func transformImage(img image.Image, ops []Op) (image.Image, error) {
+	return transformContext(context.Background(), img, ops)
+}
+
+// transformContext transforms img like transformImage, resampling the result
+// in bands of rows and checking ctx for cancellation between them. Each pixel
+// of the result is computed on its own, so the bands match one pass.
+func transformContext(ctx context.Context, img image.Image, ops []Op) (image.Image, error) {
+	bounds := img.Bounds()
+	m := affine{1, 0, -float64(bounds.Min.X), 0, 1, -float64(bounds.Min.Y)}
+	size := bounds.Size()
+	for i, op := range ops {
+		step, next, err := op.step(size)
+		if err != nil {
+			return nil, &ErrProcessing{Op: "transform", Err: fmt.Errorf("operation %d, %v: %w", i+1, op, err)}
+		}
+		m, size = m.then(step), next
+	}
+	// 16-bit sources keep their depth, for PNG outputs
+	var dst interface {
+		draw.Image
+		SubImage(r image.Rectangle) image.Image
+	}
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		dst = image.NewRGBA64(image.Rectangle{Max: size})
+	default:
+		dst = image.NewRGBA(image.Rectangle{Max: size})
+	}
+	if m == identityAffine {
+		draw.Copy(dst, image.Point{}, img, bounds, draw.Src, nil)
+		return dst, nil
+	}
+	for y := 0; y < size.Y; y += transformBand {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		band := image.Rect(0, y, size.X, min(y+transformBand, size.Y))
+		draw.CatmullRom.Transform(dst.SubImage(band).(draw.Image), f64.Aff3(m), img, bounds, draw.Src, nil)
+	}
+	return dst, nil
+}
@@ -0,0 +1,71 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	img := kernelTestImages(60, 40)["rgba"]
+
+	// Mirroring twice and turning by 180 degrees move pixels without
+	// resampling them
+	twice, err := transformImage(img, []Op{FlipHorizontalOp(), FlipHorizontalOp()})
+	if err != nil {
+		t.Fatalf("Failed to flip: %v", err)
+	}
+	if !bytes.Equal(twice.(*image.RGBA).Pix, toRGBA(img).Pix) {
+		t.Error("Flipping twice changed the image")
+	}
+	turned, err := transformImage(img, []Op{RotateOp(180)})
+	if err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	flipped, err := transformImage(img, []Op{FlipHorizontalOp(), FlipVerticalOp()})
+	if err != nil {
+		t.Fatalf("Failed to flip: %v", err)
+	}
+	if !bytes.Equal(turned.(*image.RGBA).Pix, flipped.(*image.RGBA).Pix) {
+		t.Error("Rotating by 180 degrees differs from flipping both ways")
+	}
+
+	// The sizes follow the operations in turn
+	composed, err := transformImage(img, []Op{ResizeOp(120, 0), RotateOp(90), CropOp(image.Rect(10, 20, 50, 60))})
+	if err != nil {
+		t.Fatalf("Failed to transform: %v", err)
+	}
+	if composed.Bounds() != image.Rect(0, 0, 40, 40) {
+		t.Errorf("Expected a 40x40 image, got %v", composed.Bounds())
+	}
+	if _, err := transformImage(img, []Op{CropOp(image.Rect(100, 100, 120, 120))}); err == nil {
+		t.Error("Expected an error for a crop outside the image")
+	}
+
+	for _, s := range []string{"resize:800x600", "resize:50%", "rotate:-12.5", "crop:300x200+10-20", "flipx", "flipy"} {
+		op, err := ParseOp(s)
+		if err != nil {
+			t.Errorf("ParseOp(%q) failed: %v", s, err)
+			continue
+		}
+		if op.String() != s {
+			t.Errorf("ParseOp(%q).String() = %q", s, op.String())
+		}
+	}
+	if _, err := ParseOp("shear:10"); err == nil {
+		t.Error("Expected an error for an unknown operation")
+	}
+
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+	input := writeTestImage(t, testDir, "test_input.png", img, encodePNGBuffer)
+	output := filepath.Join(testDir, "test_output.jpg")
+	if err := Transform(input, output, ScaleOp(0.5), RotateOp(-90)); err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+	if got := decodeTestFile(t, output).Bounds(); got != image.Rect(0, 0, 20, 30) {
+		t.Errorf("Expected a 20x30 output, got %v", got)
+	}
+}
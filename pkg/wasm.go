@@ -0,0 +1,222 @@
+package processor
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+const (
+	// defaultWasmTimeout bounds how long a WASM filter may run on one image
+	defaultWasmTimeout = 30 * time.Second
+	// wasmMemoryLimitPages caps the memory of a WASM filter at 1 GiB
+	wasmMemoryLimitPages = 16384
+)
+
+// WasmOptions controls WasmFilterImage
+type WasmOptions struct {
+	// Module is the path of the WASM module implementing the filter
+	Module string
+	// Params are passed to the filter as float64 values
+	Params []float64
+	// Timeout bounds the run of the filter; zero uses 30 seconds
+	Timeout time.Duration
+}
+
+// wasmRuntime compiles and runs WASM filters. Modules get no imports, so
+// they can only see the buffers they are given.
+var wasmRuntime = sync.OnceValue(func() wazero.Runtime {
+	rc := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(wasmMemoryLimitPages).
+		WithCloseOnContextDone(true)
+	return wazero.NewRuntimeWithConfig(context.Background(), rc)
+})
+
+// wasmModules caches compiled modules by path, recompiling them when the file changes
+var wasmModules = struct {
+	sync.Mutex
+	byPath map[string]wasmModule
+}{byPath: map[string]wasmModule{}}
+
+// wasmModule is a compiled module and the file it was compiled from
+type wasmModule struct {
+	modTime  time.Time
+	size     int64
+	compiled wazero.CompiledModule
+}
+
+// WasmFilterImage runs a filter compiled to WebAssembly on an image.
+// The module must export its memory as "memory" and two functions:
+//
+//	alloc(size i32) i32
+//	filter(pixels, width, height, params, nparams i32) i32
+//
+// alloc returns the address of size bytes of the module's memory. The image
+// is passed to filter as width*height non-premultiplied RGBA pixels, 4 bytes
+// each and row by row, which it changes in place; params points to nparams
+// little-endian float64 values. filter returns 0 on success and an error
+// code otherwise. Every image gets a fresh instance of the module, which has
+// no imports, limited memory and a time limit.
+// It takes the paths of the input and output files and the options.
+// Returns an error if the module is invalid or the filter fails.
+func WasmFilterImage(inputPath string, outputPath string, opts WasmOptions) error {
+	slog.Info("running WASM filter",
+		"module", opts.Module,
+		"input", inputPath,
+		"output", outputPath)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return err
+	}
+	out, err := WasmFilter(img, opts)
+	if err != nil {
+		return err
+	}
+	return saveJPEG(outputPath, out)
+}
+
+// WasmFilterImageReader runs the filter of a WebAssembly module on the image
+// read from r like WasmFilterImage and writes the result to w as JPEG.
+// Returns an error if the module is invalid or the filter fails.
+func WasmFilterImageReader(r io.Reader, w io.Writer, opts WasmOptions) error {
+	img, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	out, err := WasmFilter(img, opts)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, out)
+}
+
+// WasmFilter runs the filter of a WebAssembly module on the image, like
+// WasmFilterImage.
+// Returns an error if the module is invalid or the filter fails.
+func WasmFilter(img image.Image, opts WasmOptions) (image.Image, error) {
+	out, err := runWasmFilter(img, opts)
+	if err != nil {
+		return nil, &ErrProcessing{Op: "wasm", Err: err}
+	}
+	return out, nil
+}
+
+// runWasmFilter runs the filter of a module on an image
+func runWasmFilter(img image.Image, opts WasmOptions) (*image.NRGBA, error) {
+	compiled, err := compileWasm(opts.Module)
+	if err != nil {
+		return nil, err
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultWasmTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	mod, err := wasmRuntime().InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName(""))
+	if err != nil {
+		return nil, err
+	}
+	defer mod.Close(ctx)
+	memory := mod.Memory()
+	alloc, filter := mod.ExportedFunction("alloc"), mod.ExportedFunction("filter")
+	if memory == nil || alloc == nil || filter == nil {
+		return nil, errors.New("module must export memory, alloc and filter")
+	}
+
+	nrgba := toNRGBA(img)
+	bounds := nrgba.Bounds()
+	pixels, err := wasmAlloc(ctx, alloc, memory, nrgba.Pix)
+	if err != nil {
+		return nil, err
+	}
+	params := make([]byte, 8*len(opts.Params))
+	for i, p := range opts.Params {
+		binary.LittleEndian.PutUint64(params[8*i:], math.Float64bits(p))
+	}
+	paramsPtr, err := wasmAlloc(ctx, alloc, memory, params)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := filter.Call(ctx, uint64(pixels), uint64(bounds.Dx()), uint64(bounds.Dy()), uint64(paramsPtr), uint64(len(opts.Params)))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("filter did not finish within %v", timeout)
+		}
+		return nil, err
+	}
+	if code := int32(status[0]); code != 0 {
+		return nil, fmt.Errorf("filter failed with code %d", code)
+	}
+	result, ok := memory.Read(pixels, uint32(len(nrgba.Pix)))
+	if !ok {
+		return nil, errors.New("pixel buffer out of range")
+	}
+	copy(nrgba.Pix, result)
+	return nrgba, nil
+}
+
+// wasmAlloc copies data into memory allocated by the module
+func wasmAlloc(ctx context.Context, alloc api.Function, memory api.Memory, data []byte) (uint32, error) {
+	if uint64(len(data)) > math.MaxUint32 {
+		return 0, errors.New("image too large for a WASM filter")
+	}
+	ptr, err := alloc.Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("alloc: %w", err)
+	}
+	if !memory.Write(uint32(ptr[0]), data) {
+		return 0, fmt.Errorf("alloc returned an address out of range")
+	}
+	return uint32(ptr[0]), nil
+}
+
+// compileWasm returns the compiled module at path, compiling it once
+func compileWasm(path string) (wazero.CompiledModule, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	wasmModules.Lock()
+	defer wasmModules.Unlock()
+	if m, ok := wasmModules.byPath[path]; ok && m.modTime.Equal(info.ModTime()) && m.size == info.Size() {
+		return m.compiled, nil
+	}
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := wasmRuntime().CompileModule(context.Background(), code)
+	if err != nil {
+		return nil, fmt.Errorf("invalid module %s: %w", path, err)
+	}
+	if len(compiled.ImportedFunctions()) > 0 {
+		compiled.Close(context.Background())
+		return nil, fmt.Errorf("module %s must not import functions", path)
+	}
+	wasmModules.byPath[path] = wasmModule{modTime: info.ModTime(), size: info.Size(), compiled: compiled}
+	return compiled, nil
+}
+
+// toNRGBA copies an image into a zero-origin non-premultiplied RGBA image
+func toNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	return nrgba
+}
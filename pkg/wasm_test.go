@@ -0,0 +1,124 @@
+package processor
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wasmVector prefixes WASM bytes with their length
+func wasmVector(b ...byte) []byte {
+	return append([]byte{byte(len(b))}, b...)
+}
+
+// wasmSection builds a section of a WASM module
+func wasmSection(id byte, content ...byte) []byte {
+	return append([]byte{id}, wasmVector(content...)...)
+}
+
+// invertWasmModule builds a filter that inverts the colors and returns its
+// first parameter, truncated, as the status. The filter body is given so the
+// test can swap in other behaviors.
+func invertWasmModule(filterBody []byte) []byte {
+	// alloc bumps a heap pointer held in global 0
+	alloc := wasmVector(0x00,
+		0x23, 0x00, // global.get 0 (the result)
+		0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00, // heap += size
+		0x0b)
+	filter := wasmVector(append([]byte{0x01, 0x01, 0x7f}, filterBody...)...)
+
+	module := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	module = append(module, wasmSection(1, 0x02,
+		0x60, 0x01, 0x7f, 0x01, 0x7f,
+		0x60, 0x05, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7f)...)
+	module = append(module, wasmSection(3, 0x02, 0x00, 0x01)...)
+	module = append(module, wasmSection(5, 0x01, 0x00, 0x01)...)
+	module = append(module, wasmSection(6, 0x01, 0x7f, 0x01, 0x41, 0x80, 0x08, 0x0b)...)
+	module = append(module, wasmSection(7, 0x03,
+		0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+		0x05, 'a', 'l', 'l', 'o', 'c', 0x00, 0x00,
+		0x06, 'f', 'i', 'l', 't', 'e', 'r', 0x00, 0x01)...)
+	code := append([]byte{0x02}, alloc...)
+	code = append(code, filter...)
+	return append(module, wasmSection(10, code...)...)
+}
+
+// wasmInvertBody inverts every pixel, then returns the first parameter
+var wasmInvertBody = []byte{
+	// end = pixels + width*height*4
+	0x20, 0x01, 0x20, 0x02, 0x6c, 0x41, 0x04, 0x6c, 0x20, 0x00, 0x6a, 0x21, 0x05,
+	0x02, 0x40, 0x03, 0x40,
+	0x20, 0x00, 0x20, 0x05, 0x4f, 0x0d, 0x01, // break when pixels >= end
+	0x20, 0x00, 0x20, 0x00, 0x28, 0x02, 0x00, 0x41, 0xff, 0xff, 0xff, 0x07, 0x73, 0x36, 0x02, 0x00, // flip RGB
+	0x20, 0x00, 0x41, 0x04, 0x6a, 0x21, 0x00,
+	0x0c, 0x00, 0x0b, 0x0b,
+	// return nparams > 0 ? int(params[0]) : 0
+	0x20, 0x04, 0x04, 0x7f, 0x20, 0x03, 0x2b, 0x03, 0x00, 0xaa, 0x05, 0x41, 0x00, 0x0b,
+	0x0b,
+}
+
+// wasmLoopBody never returns
+var wasmLoopBody = []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x41, 0x00, 0x0b}
+
+func TestWasmFilterImage(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	modulePath := filepath.Join(testDir, "invert.wasm")
+	if err := os.WriteFile(modulePath, invertWasmModule(wasmInvertBody), 0644); err != nil {
+		t.Fatalf("Failed to write module: %v", err)
+	}
+	testInputPath := filepath.Join(testDir, "test_input_wasm.jpg")
+	testOutputPath := filepath.Join(testDir, "test_output_wasm.jpg")
+	if err := generateSingleTestImage(testInputPath, 32, 16); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	if err := WasmFilterImage(testInputPath, testOutputPath, WasmOptions{Module: modulePath, Params: []float64{0}}); err != nil {
+		t.Fatalf("Failed to run filter: %v", err)
+	}
+	in, _ := loadImage(testInputPath)
+	out, err := loadImage(testOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to load output: %v", err)
+	}
+	a := color.GrayModel.Convert(in.At(16, 8)).(color.Gray)
+	b := color.GrayModel.Convert(out.At(16, 8)).(color.Gray)
+	if diff := int(a.Y) + int(b.Y) - 255; diff < -12 || diff > 12 {
+		t.Errorf("Expected inverted pixels, got %d and %d", a.Y, b.Y)
+	}
+
+	err = WasmFilterImage(testInputPath, filepath.Join(testDir, "failed.jpg"), WasmOptions{Module: modulePath, Params: []float64{7}})
+	if err == nil || !strings.Contains(err.Error(), "code 7") {
+		t.Errorf("Expected the filter to fail with code 7, got %v", err)
+	}
+
+	// Runaway filters are stopped
+	loopPath := filepath.Join(testDir, "loop.wasm")
+	if err := os.WriteFile(loopPath, invertWasmModule(wasmLoopBody), 0644); err != nil {
+		t.Fatalf("Failed to write module: %v", err)
+	}
+	err = WasmFilterImage(testInputPath, filepath.Join(testDir, "loop.jpg"), WasmOptions{Module: loopPath, Timeout: 50 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "did not finish") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+
+	if err := os.WriteFile(loopPath, []byte("not wasm"), 0644); err != nil {
+		t.Fatalf("Failed to write module: %v", err)
+	}
+	if err := WasmFilterImage(testInputPath, filepath.Join(testDir, "bad.jpg"), WasmOptions{Module: loopPath}); err == nil {
+		t.Error("An invalid module should be rejected")
+	}
+
+	// Filters are recipe steps
+	recipe, err := ParseRecipe("wasm \"" + modulePath + "\" 0")
+	if err != nil {
+		t.Fatalf("Failed to parse recipe: %v", err)
+	}
+	if _, err := recipe.Run(testInputPath, filepath.Join(testDir, "recipe.jpg")); err != nil {
+		t.Errorf("Failed to run recipe: %v", err)
+	}
+}
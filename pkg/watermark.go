@@ -0,0 +1,185 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log/slog"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+// Watermark positions accepted by WatermarkImage. Any gravity accepted by
+// ParseGravity works as well.
+const (
+	WatermarkTopLeft     = "top-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkBottomRight = "bottom-right"
+	WatermarkCenter      = "center"
+	WatermarkAuto        = "auto"
+)
+
+// defaultWatermarkOpacity is used when WatermarkOptions.Opacity is not set
+const defaultWatermarkOpacity = 0.5
+
+// WatermarkOptions controls WatermarkImage
+type WatermarkOptions struct {
+	// Position is a gravity, such as one of the Watermark* constants or
+	// "30%,70%". Auto places the mark in the corner with the least detail,
+	// avoiding faces.
+	Position string
+	// Scale is the width of the mark relative to the image width
+	Scale float64
+	// Opacity is the strength of the mark, up to 1; zero uses defaultWatermarkOpacity
+	Opacity float64
+	// Margin is the distance from the image edges, in pixels
+	Margin int
+}
+
+// WatermarkResult describes where WatermarkImage placed the mark
+type WatermarkResult struct {
+	Position string `json:"position"`
+	Box      Box    `json:"box"`
+}
+
+// WatermarkImage blends the watermark image onto the input image.
+// It takes the paths of the input, watermark and output files and the options.
+// Returns the position of the mark, or an error if the operation fails.
+func WatermarkImage(inputPath string, watermarkPath string, outputPath string, opts WatermarkOptions) (*WatermarkResult, error) {
+	slog.Info("watermarking image",
+		"input", inputPath,
+		"watermark", watermarkPath,
+		"position", opts.Position)
+
+	img, err := loadImage(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	mark, err := loadImage(watermarkPath)
+	if err != nil {
+		return nil, err
+	}
+
+	out, result, err := Watermark(img, mark, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveJPEG(outputPath, out); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// WatermarkImageReader blends the watermark read from mark onto the image
+// read from r like WatermarkImage and writes the result to w as JPEG.
+// Returns the position of the mark, or an error if the operation fails.
+func WatermarkImageReader(r io.Reader, mark io.Reader, w io.Writer, opts WatermarkOptions) (*WatermarkResult, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	markImg, err := decodeImage(mark)
+	if err != nil {
+		return nil, err
+	}
+	out, result, err := Watermark(img, markImg, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := encodeJPEG(w, out); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Watermark returns a copy of the image with the mark blended onto it, like
+// WatermarkImage.
+// Returns the watermarked image and the position of the mark, or an error if
+// the position is invalid.
+func Watermark(img image.Image, mark image.Image, opts WatermarkOptions) (image.Image, *WatermarkResult, error) {
+	out := toRGBA(img)
+	bounds := out.Bounds()
+	if opts.Scale > 0 {
+		width := uint(math.Max(1, float64(bounds.Dx())*opts.Scale))
+		mark = resize.Resize(width, 0, mark, resize.Lanczos3)
+	}
+	size := image.Pt(min(mark.Bounds().Dx(), bounds.Dx()), min(mark.Bounds().Dy(), bounds.Dy()))
+
+	position := opts.Position
+	if position == WatermarkAuto {
+		faces, err := detectFaces(out)
+		if err != nil {
+			return nil, nil, err
+		}
+		position = quietestCorner(toGray(out), size, opts.Margin, faces)
+		slog.Info("chose watermark position", "position", position)
+	}
+	r, err := watermarkRect(bounds, size, position, opts.Margin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opacity := math.Min(opts.Opacity, 1)
+	if opacity <= 0 {
+		opacity = defaultWatermarkOpacity
+	}
+	mask := image.NewUniform(color.Alpha{A: uint8(opacity*255 + 0.5)})
+	draw.DrawMask(out, r, mark, mark.Bounds().Min, mask, image.Point{}, draw.Over)
+
+	return out, &WatermarkResult{Position: position, Box: boxFromRect(r)}, nil
+}
+
+// watermarkRect returns where a mark of the given size goes for a position
+func watermarkRect(bounds image.Rectangle, size image.Point, position string, margin int) (image.Rectangle, error) {
+	gravity := GravitySouthEast
+	if position != "" {
+		var err error
+		gravity, err = ParseGravity(position)
+		if err != nil {
+			return image.Rectangle{}, &ErrProcessing{Op: "watermark", Err: fmt.Errorf("unknown position: %s", position)}
+		}
+	}
+	return gravity.Place(bounds, size, margin).Intersect(bounds), nil
+}
+
+// quietestCorner returns the corner whose area under the mark has the lowest
+// luma standard deviation. Corners overlapping a face are only used when
+// every corner does.
+func quietestCorner(gray *image.Gray, size image.Point, margin int, faces []Face) string {
+	best, bestScore := WatermarkBottomRight, math.Inf(1)
+	for _, position := range []string{WatermarkBottomRight, WatermarkBottomLeft, WatermarkTopRight, WatermarkTopLeft} {
+		r, _ := watermarkRect(gray.Bounds(), size, position, margin)
+		score := regionStdDev(gray, r)
+		for _, face := range faces {
+			if r.Overlaps(face.Rect()) {
+				score += 1000
+			}
+		}
+		if score < bestScore {
+			best, bestScore = position, score
+		}
+	}
+	return best
+}
+
+// regionStdDev returns the standard deviation of the gray values within r
+func regionStdDev(gray *image.Gray, r image.Rectangle) float64 {
+	var sum, sumSq, n float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			v := float64(gray.GrayAt(x, y).Y)
+			sum += v
+			sumSq += v * v
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	mean := sum / n
+	return math.Sqrt(math.Max(0, sumSq/n-mean*mean))
+}
@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWatermarkRect(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 80)
+	size := image.Pt(20, 10)
+	tests := map[string]image.Rectangle{
+		WatermarkTopLeft:     image.Rect(5, 5, 25, 15),
+		WatermarkTopRight:    image.Rect(75, 5, 95, 15),
+		WatermarkBottomLeft:  image.Rect(5, 65, 25, 75),
+		WatermarkBottomRight: image.Rect(75, 65, 95, 75),
+		WatermarkCenter:      image.Rect(40, 35, 60, 45),
+	}
+	for position, want := range tests {
+		got, err := watermarkRect(bounds, size, position, 5)
+		if err != nil {
+			t.Fatalf("Failed to place watermark at %s: %v", position, err)
+		}
+		if got != want {
+			t.Errorf("Position %s: expected %v, got %v", position, want, got)
+		}
+	}
+	if _, err := watermarkRect(bounds, size, "middle", 5); err == nil {
+		t.Errorf("Expected an error for an unknown position")
+	}
+}
+
+func TestWatermarkImageAuto(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// A flat gray image with a busy checkerboard everywhere but the top-left corner
+	img := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.Gray{Y: 128}}, image.Point{}, draw.Src)
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 200; x++ {
+			if (x >= 100 || y >= 100) && (x/4+y/4)%2 == 0 {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	testInputPath := filepath.Join(testDir, "test_input_watermark.jpg")
+	if err := saveJPEG(testInputPath, img); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+
+	mark := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	draw.Draw(mark, mark.Bounds(), &image.Uniform{color.NRGBA{R: 255, A: 255}}, image.Point{}, draw.Src)
+	markPath := filepath.Join(testDir, "test_watermark.png")
+	file, err := os.Create(markPath)
+	if err != nil {
+		t.Fatalf("Failed to create watermark: %v", err)
+	}
+	if err := png.Encode(file, mark); err != nil {
+		t.Fatalf("Failed to encode watermark: %v", err)
+	}
+	file.Close()
+
+	testOutputPath := filepath.Join(testDir, "test_output_watermark.jpg")
+	result, err := WatermarkImage(testInputPath, markPath, testOutputPath, WatermarkOptions{
+		Position: WatermarkAuto,
+		Scale:    0.2,
+		Margin:   10,
+	})
+	if err != nil {
+		t.Fatalf("Failed to watermark image: %v", err)
+	}
+	if result.Position != WatermarkTopLeft {
+		t.Errorf("Expected the mark in the quiet top-left corner, got %s", result.Position)
+	}
+	if result.Box != (Box{X: 10, Y: 10, Width: 40, Height: 20}) {
+		t.Errorf("Unexpected watermark box %+v", result.Box)
+	}
+}
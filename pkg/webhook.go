@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/okamyuji/go-image-processor/config"
+)
+
+// Webhook events
+const (
+	EventBatchCompleted = "batch.completed"
+	EventBatchFailed    = "batch.failed"
+)
+
+// webhookTimeout bounds a single delivery attempt
+const webhookTimeout = 10 * time.Second
+
+// WebhookSignatureHeader carries the hex HMAC-SHA256 of the request body,
+// keyed with the webhook secret, as "sha256=<hex>"
+const WebhookSignatureHeader = "X-Signature-256"
+
+// WebhookEvent is the JSON body sent to webhooks
+type WebhookEvent struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	// Report is the result of the batch run
+	Report *BatchReport `json:"report,omitempty"`
+}
+
+// BatchEvent returns the completion event of a batch run: batch.failed when
+// any file failed and batch.completed otherwise
+func BatchEvent(report *BatchReport) WebhookEvent {
+	event := EventBatchCompleted
+	if len(report.Failures) > 0 {
+		event = EventBatchFailed
+	}
+	return WebhookEvent{Event: event, Time: time.Now().UTC(), Report: report}
+}
+
+// NotifyWebhooks sends an event to every configured webhook that accepts it.
+// Deliveries that still fail after their retries are logged and returned
+// together; they do not affect the job itself.
+func NotifyWebhooks(event WebhookEvent) error {
+	var errs []error
+	for _, hook := range currentConfig().Webhooks {
+		if len(hook.Events) > 0 && !slices.Contains(hook.Events, event.Event) {
+			continue
+		}
+		if err := SendWebhook(hook, event); err != nil {
+			slog.Warn("webhook delivery failed", "url", hook.URL, "event", event.Event, "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SendWebhook posts an event to a webhook, signing the body when the webhook
+// has a secret. Network errors, 429 and 5xx responses are retried with
+// exponential backoff; other responses fail at once.
+// Returns an error if no attempt succeeded.
+func SendWebhook(hook config.Webhook, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return &ErrProcessing{Op: "webhook", Err: err}
+	}
+	retries := hook.Retries
+	if retries == 0 {
+		retries = 3
+	}
+	delay := hook.RetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	for attempt := 0; ; attempt++ {
+		retry, err := postWebhook(client, hook, body)
+		if err == nil {
+			slog.Info("webhook delivered", "url", hook.URL, "event", event.Event, "attempts", attempt+1)
+			return nil
+		}
+		if !retry || attempt >= retries {
+			return &ErrProcessing{Op: "webhook", Err: fmt.Errorf("%s: %w", hook.URL, err)}
+		}
+		time.Sleep(delay << attempt)
+	}
+}
+
+// postWebhook makes one delivery attempt.
+// Returns whether a failed attempt is worth retrying.
+func postWebhook(client *http.Client, hook config.Webhook, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if hook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(hook.Secret))
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected status %s", resp.Status)
+}
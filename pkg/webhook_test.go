@@ -0,0 +1,95 @@
+package processor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/okamyuji/go-image-processor/config"
+	"gopkg.in/yaml.v2"
+)
+
+func TestSendWebhook(t *testing.T) {
+	var calls atomic.Int32
+	var received WebhookEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt fails with a retryable status
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		if r.Header.Get(WebhookSignatureHeader) != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("Unexpected signature %q", r.Header.Get(WebhookSignatureHeader))
+		}
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Errorf("Failed to decode event: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	report := &BatchReport{Succeeded: 1, Failures: []BatchFailure{{File: "a.jpg", Error: "broken"}}}
+	hook := config.Webhook{URL: server.URL, Secret: "s3cret", RetryDelay: time.Millisecond}
+	if err := SendWebhook(hook, BatchEvent(report)); err != nil {
+		t.Fatalf("Failed to send webhook: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected one retry, got %d calls", calls.Load())
+	}
+	if received.Event != EventBatchFailed || received.Report == nil || len(received.Report.Failures) != 1 {
+		t.Errorf("Unexpected event %+v", received)
+	}
+}
+
+func TestSendWebhookGivesUp(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	event := BatchEvent(&BatchReport{Succeeded: 1})
+	if event.Event != EventBatchCompleted {
+		t.Errorf("Expected %s, got %s", EventBatchCompleted, event.Event)
+	}
+	if err := SendWebhook(config.Webhook{URL: server.URL, Retries: 2, RetryDelay: time.Millisecond}, event); err == nil {
+		t.Error("Expected an error after the retries")
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls.Load())
+	}
+
+	// Client errors are not retried
+	calls.Store(0)
+	if err := SendWebhook(config.Webhook{URL: server.URL + "/missing", RetryDelay: time.Millisecond}, event); err == nil {
+		t.Error("Expected an error for a 404")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected a single attempt, got %d", calls.Load())
+	}
+}
+
+func TestWebhookConfig(t *testing.T) {
+	var c config.Config
+	source := "webhooks:\n  - url: https://example.com/hook\n    events: [batch.failed]\n    retry_delay: 2s\n"
+	if err := yaml.Unmarshal([]byte(source), &c); err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if len(c.Webhooks) != 1 || c.Webhooks[0].RetryDelay != 2*time.Second || c.Webhooks[0].Events[0] != EventBatchFailed {
+		t.Errorf("Unexpected webhooks %+v", c.Webhooks)
+	}
+}
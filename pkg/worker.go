@@ -0,0 +1,300 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a message received from a queue
+type Message struct {
+	Body []byte
+	// Ack marks the message as handled, so it is not delivered again;
+	// queues without acknowledgements ignore it
+	Ack func() error
+}
+
+// MessageQueue is a topic processing requests are consumed from, with a
+// second topic completion events are published to
+type MessageQueue interface {
+	// Receive blocks until a message arrives or the context ends
+	Receive(ctx context.Context) (*Message, error)
+	// Publish sends a completion event to the results topic; it does nothing
+	// when the queue has none
+	Publish(ctx context.Context, body []byte) error
+	Close() error
+}
+
+// WorkRequest is a processing request read from a queue: a recipe applied to
+// a source file, both files given as storage locations (local paths, sftp://
+// or dav:// URLs)
+type WorkRequest struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Output string `json:"output"`
+	// Recipe is the source of the recipe to apply, in the language of ParseRecipe
+	Recipe string `json:"recipe,omitempty"`
+	// Preset names a recipe of the tenant to apply instead
+	Preset string `json:"preset,omitempty"`
+	// APIKey identifies the tenant whose presets and limits apply
+	APIKey string `json:"api_key,omitempty"`
+}
+
+// WorkResult is the completion event published for a request
+type WorkResult struct {
+	ID     string `json:"id"`
+	Tenant string `json:"tenant,omitempty"`
+	Source string `json:"source"`
+	Output string `json:"output"`
+	// Status is "ok" or "error"
+	Status     string   `json:"status"`
+	Error      string   `json:"error,omitempty"`
+	Steps      []string `json:"steps,omitempty"`
+	DurationMS float64  `json:"duration_ms"`
+}
+
+// WorkerOptions controls RunWorker
+type WorkerOptions struct {
+	// Workers is the number of requests processed in parallel; zero uses the number of CPUs
+	Workers int
+	// GracePeriod is how long requests in progress may take to finish once
+	// the context ends; zero waits for them however long they take
+	GracePeriod time.Duration
+	// Health, when set, is kept up to date with the state of the worker
+	Health *Health
+	// Roots are the storage locations requests may read from and write to,
+	// local directories and sftp:// or dav:// URLs, see ResolveLocation.
+	// Empty allows only the working directory.
+	Roots []string
+}
+
+// OpenQueue connects to the queue a URL names:
+// nats://host:4222/<subject>?results=<subject>&group=<queue group> or
+// kafka://broker1:9092,broker2:9092/<topic>?results=<topic>&group=<consumer group>.
+// Workers sharing a group split the requests between them, so the worker
+// tier scales by starting more processes.
+func OpenQueue(location string) (MessageQueue, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid queue %q", location)
+	}
+	topic := strings.TrimPrefix(u.Path, "/")
+	if topic == "" {
+		return nil, fmt.Errorf("invalid queue %q: no topic", location)
+	}
+	results := u.Query().Get("results")
+	group := u.Query().Get("group")
+	if group == "" {
+		group = "go-image-processor"
+	}
+
+	slog.Info("opening queue", "scheme", u.Scheme, "host", u.Host, "topic", topic, "results", results, "group", group)
+	switch u.Scheme {
+	case "nats":
+		return dialNATS(u, topic, results, group)
+	case "kafka":
+		return newKafkaQueue(strings.Split(u.Host, ","), topic, results, group), nil
+	default:
+		return nil, fmt.Errorf("unsupported queue scheme %q", u.Scheme)
+	}
+}
+
+// RunWorker consumes requests from the queue and processes them until the
+// context ends or the queue fails. Each request is acknowledged once its
+// completion event has been published, whether it succeeded or not;
+// malformed messages are acknowledged and dropped.
+// When the context ends the worker drains: it takes no new requests and waits
+// up to the grace period for the ones in progress, which are cancelled and
+// left unacknowledged if they do not finish in time.
+// Returns nil once drained, or an error if the queue fails or the grace period runs out.
+func RunWorker(ctx context.Context, q MessageQueue, opts WorkerOptions) error {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	health := opts.Health
+	if health == nil {
+		health = &Health{}
+	}
+	slog.Info("worker started", "workers", workers)
+	health.SetReady(true)
+
+	// Requests in progress outlive ctx for the grace period
+	work, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, workers)
+	err := func() error {
+		for {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+			msg, err := q.Receive(ctx)
+			if err != nil {
+				<-slots
+				if ctx.Err() != nil {
+					return nil
+				}
+				return &ErrProcessing{Op: "worker", Err: err}
+			}
+
+			wg.Add(1)
+			health.inFlight.Add(1)
+			go func() {
+				defer wg.Done()
+				defer health.inFlight.Add(-1)
+				defer func() { <-slots }()
+				handleMessage(work, q, msg, opts.Roots)
+			}()
+		}
+	}()
+
+	health.Drain()
+	slog.Info("worker draining", "in_flight", health.inFlight.Load(), "grace_period", opts.GracePeriod)
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	var grace <-chan time.Time
+	if opts.GracePeriod > 0 {
+		timer := time.NewTimer(opts.GracePeriod)
+		defer timer.Stop()
+		grace = timer.C
+	}
+	select {
+	case <-drained:
+	case <-grace:
+		cancelWork()
+		return &ErrProcessing{Op: "worker", Err: fmt.Errorf("%d requests still in progress after the %s grace period", health.inFlight.Load(), opts.GracePeriod)}
+	}
+	slog.Info("worker stopped")
+	return err
+}
+
+// handleMessage processes one message within roots and publishes its
+// completion event. A request cancelled by ctx is left unacknowledged to be
+// delivered again.
+func handleMessage(ctx context.Context, q MessageQueue, msg *Message, roots []string) {
+	var req WorkRequest
+	if err := json.Unmarshal(msg.Body, &req); err != nil {
+		slog.Warn("dropping malformed request", "error", err)
+		msg.Ack()
+		return
+	}
+	result := processRequest(ctx, req, roots)
+	if ctx.Err() != nil {
+		slog.Warn("request cancelled", "id", req.ID)
+		return
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		slog.Warn("encoding result failed", "id", req.ID, "error", err)
+		return
+	}
+	if err := q.Publish(ctx, body); err != nil {
+		slog.Warn("publishing result failed", "id", req.ID, "error", err)
+		return
+	}
+	if err := msg.Ack(); err != nil {
+		slog.Warn("acknowledging request failed", "id", req.ID, "error", err)
+	}
+}
+
+// ProcessRequest applies the recipe of a request to its source and writes the
+// result to its output, downloading and uploading remote files as needed.
+// When tenants are configured, the API key of the request selects the presets
+// and limits that apply. The source and output must be inside the working
+// directory; RunWorker allows the roots of its options instead.
+// Returns the completion event; failures are recorded in it.
+func ProcessRequest(req WorkRequest) *WorkResult {
+	return ProcessRequestContext(context.Background(), req)
+}
+
+// ProcessRequestContext is ProcessRequest stopping early when ctx is
+// cancelled; the cancellation is recorded in the completion event as a
+// failure.
+func ProcessRequestContext(ctx context.Context, req WorkRequest) *WorkResult {
+	return processRequest(ctx, req, nil)
+}
+
+// processRequest is ProcessRequestContext confining the locations of the
+// request to roots, or to the working directory when there are none
+func processRequest(ctx context.Context, req WorkRequest, roots []string) *WorkResult {
+	slog.Info("processing request", "id", req.ID, "source", RedactLocation(req.Source))
+	start := time.Now()
+	result := &WorkResult{ID: req.ID, Source: RedactLocation(req.Source), Output: RedactLocation(req.Output)}
+
+	steps, err := runRequest(ctx, req, roots, result)
+	result.DurationMS = durationMS(time.Since(start))
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		slog.Warn("request failed", "id", req.ID, "error", err)
+		return result
+	}
+	result.Status = "ok"
+	result.Steps = steps
+	return result
+}
+
+// runRequest does the work of ProcessRequest, within roots and the limits of
+// the tenant of the request, and records the tenant in the result.
+// Returns the recipe steps that ran.
+func runRequest(ctx context.Context, req WorkRequest, roots []string, result *WorkResult) ([]string, error) {
+	tenant, err := LookupTenant(req.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	if tenant != nil {
+		result.Tenant = tenant.Name
+	}
+	if req.Source == "" || req.Output == "" {
+		return nil, errors.New("request needs a source and an output")
+	}
+	recipe, err := tenantRecipe(tenant, req.Preset, req.Recipe)
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	source, err := resolveTenantLocation(tenant, req.Source, roots)
+	if err != nil {
+		return nil, err
+	}
+	output, err := resolveTenantLocation(tenant, req.Output, roots)
+	if err != nil {
+		return nil, err
+	}
+	in, inputName, err := OpenStorage(source)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	out, outputName, err := OpenStorage(output)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	var steps []string
+	err = ProcessStored(in, inputName, out, outputName, func(inputPath, outputPath string) error {
+		result, err := runTenantRecipe(ctx, tenant, recipe, inputPath, outputPath)
+		if err == nil {
+			steps = result.Steps
+		}
+		return err
+	})
+	return steps, err
+}
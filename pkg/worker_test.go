@@ -0,0 +1,169 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryQueue is a MessageQueue backed by channels
+type memoryQueue struct {
+	requests chan []byte
+	mu       sync.Mutex
+	results  []WorkResult
+	acked    int
+	// block, when set, holds every Publish until it is closed
+	block chan struct{}
+}
+
+func (q *memoryQueue) Receive(ctx context.Context) (*Message, error) {
+	select {
+	case body := <-q.requests:
+		return &Message{Body: body, Ack: func() error {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.acked++
+			return nil
+		}}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (q *memoryQueue) Publish(ctx context.Context, body []byte) error {
+	if q.block != nil {
+		<-q.block
+	}
+	var result WorkResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.results = append(q.results, result)
+	return nil
+}
+
+func (q *memoryQueue) Close() error {
+	return nil
+}
+
+func TestRunWorker(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_worker.jpg")
+	if err := generateSingleTestImage(testInputPath, 200, 100); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+
+	q := &memoryQueue{requests: make(chan []byte, 6)}
+	for _, req := range []WorkRequest{
+		{ID: "1", Source: testInputPath, Output: filepath.Join(testDir, "out", "small.jpg"), Recipe: "fit 50 50"},
+		{ID: "2", Source: filepath.Join(testDir, "missing.jpg"), Output: filepath.Join(testDir, "out", "missing.jpg"), Recipe: "binarize"},
+		{ID: "3", Source: testInputPath, Output: filepath.Join(testDir, "..", "escaped.jpg"), Recipe: "binarize"},
+		{ID: "4", Source: "/etc/passwd", Output: filepath.Join(testDir, "out", "passwd.jpg"), Recipe: "binarize"},
+		{ID: "5", Source: "sftp://internal/etc/passwd", Output: filepath.Join(testDir, "out", "remote.jpg"), Recipe: "binarize"},
+	} {
+		body, _ := json.Marshal(req)
+		q.requests <- body
+	}
+	q.requests <- []byte("not json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- RunWorker(ctx, q, WorkerOptions{Workers: 2, Roots: []string{testDir}}) }()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		q.mu.Lock()
+		acked := q.acked
+		q.mu.Unlock()
+		if acked == 6 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Worker failed: %v", err)
+	}
+
+	if q.acked != 6 || len(q.results) != 5 {
+		t.Fatalf("Expected 6 acknowledged messages and 5 results, got %d and %d", q.acked, len(q.results))
+	}
+	results := map[string]WorkResult{}
+	for _, r := range q.results {
+		results[r.ID] = r
+	}
+	if r := results["1"]; r.Status != "ok" || len(r.Steps) != 1 {
+		t.Errorf("Expected request 1 to succeed with one step, got %+v", r)
+	}
+	if r := results["2"]; r.Status != "error" || r.Error == "" {
+		t.Errorf("Expected request 2 to fail, got %+v", r)
+	}
+	for _, id := range []string{"3", "4", "5"} {
+		if r := results[id]; r.Status != "error" || !strings.Contains(r.Error, "outside the allowed roots") {
+			t.Errorf("Expected request %s outside the roots to be rejected, got %+v", id, r)
+		}
+	}
+	img, err := loadImage(filepath.Join(testDir, "out", "small.jpg"))
+	if err != nil {
+		t.Fatalf("Failed to load output: %v", err)
+	}
+	if img.Bounds().Dx() != 50 || img.Bounds().Dy() != 25 {
+		t.Errorf("Expected a 50x25 output, got %v", img.Bounds())
+	}
+}
+
+func TestOpenQueueInvalid(t *testing.T) {
+	for _, location := range []string{"nats://localhost:4222", "amqp://localhost/jobs"} {
+		if _, err := OpenQueue(location); err == nil {
+			t.Errorf("OpenQueue(%q) should fail", location)
+		}
+	}
+}
+
+func TestRunWorkerGracePeriod(t *testing.T) {
+	testDir := setupTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	testInputPath := filepath.Join(testDir, "test_input_worker.jpg")
+	if err := generateSingleTestImage(testInputPath, 64, 64); err != nil {
+		t.Fatalf("Failed to generate test image: %v", err)
+	}
+	q := &memoryQueue{requests: make(chan []byte, 1), block: make(chan struct{})}
+	defer close(q.block)
+	body, _ := json.Marshal(WorkRequest{ID: "1", Source: testInputPath, Output: filepath.Join(testDir, "out.jpg"), Recipe: "binarize"})
+	q.requests <- body
+
+	health := &Health{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- RunWorker(ctx, q, WorkerOptions{Workers: 1, GracePeriod: 50 * time.Millisecond, Health: health})
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for health.inFlight.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !health.Ready() {
+		t.Error("A running worker should be ready")
+	}
+	cancel()
+
+	// The request never finishes, so the grace period runs out
+	if err := <-done; err == nil {
+		t.Error("Expected an error when the grace period runs out")
+	}
+	if health.Ready() {
+		t.Error("A draining worker should not be ready")
+	}
+	if q.acked != 0 {
+		t.Error("An unfinished request should not be acknowledged")
+	}
+}